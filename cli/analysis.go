@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var analysisOutcomeOrder = map[string]int{"fail": 0, "warn": 1, "pass": 2}
+
+func AnalysisCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "analysis",
+		Short: "Show the analyzer results stored in a support bundle",
+		Long: `Show the analyzer results stored in a support bundle.
+
+Bundles collected with analyzers contain their results in analysis.json. Results are listed with
+failures first. The same results are served by the API server as the cluster scoped
+analysisresults.troubleshoot.sh resource, e.g. "kubectl get analysisresults".`,
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			clusterData, cleanup, err := loadClusterData(v)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			if clusterData.AnalysisFile == "" {
+				fmt.Println("No analysis.json found in support bundle")
+				return nil
+			}
+
+			results, err := sbctl.ReadAnalysis(clusterData)
+			if err != nil {
+				return errors.Wrap(err, "failed to read analysis results")
+			}
+
+			outcomes := v.GetStringSlice("outcome")
+			filtered := []sbctl.AnalysisResult{}
+			for _, r := range results {
+				if len(outcomes) == 0 || containsString(outcomes, r.Outcome()) {
+					filtered = append(filtered, r)
+				}
+			}
+
+			sort.SliceStable(filtered, func(i, j int) bool {
+				return analysisOutcomeOrder[filtered[i].Outcome()] < analysisOutcomeOrder[filtered[j].Outcome()]
+			})
+
+			printAnalysisResults(os.Stdout, filtered)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	cmd.Flags().StringSlice("outcome", nil, "only show results with these outcomes. One or more of: fail, warn, pass")
+	return cmd
+}
+
+func printAnalysisResults(out io.Writer, results []sbctl.AnalysisResult) {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "OUTCOME\tANALYZER\tTITLE\tMESSAGE")
+	for _, r := range results {
+		message := r.Message()
+		if message == "" {
+			message = "<none>"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Outcome(), r.Name, r.Title(), message)
+	}
+}
@@ -0,0 +1,158 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func AnalyzeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "analyze",
+		Short: "Run analyzers against a support bundle",
+		Long: `Run analyzers against a support bundle.
+
+Analyzers built into sbctl run along with external analyzers, which are executables named
+sbctl-analyzer-<name> found in the analyzers directory of the sbctl config dir, e.g.
+~/.config/sbctl/analyzers, or in PATH, and the ones given with --analyzer. External analyzers read
+a JSON request with the locations of the extracted bundle from stdin, and write a JSON array of
+analyzer results, in the format of analysis.json, to stdout. Analyzers written in Go implement
+the Analyzer interface of the sbctl package and call sbctl.ServeAnalyzer from their main function.
+
+Results are listed with failures first. An analyzer that fails is reported, and the others still run.`,
+		Example: `  sbctl analyze -s ./support-bundle.tar.gz
+  sbctl analyze -s ./support-bundle.tar.gz --analyzer ./bin/sbctl-analyzer-license --outcome fail,warn`,
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			format := v.GetString("format")
+			if format != "text" && format != "json" {
+				return usererrors.New(usererrors.InvalidArgument, errors.Errorf("unsupported format %q, must be one of: text, json", format), "--format")
+			}
+
+			analyzers, err := findAnalyzers(v.GetStringSlice("analyzer"))
+			if err != nil {
+				return err
+			}
+			if v.GetBool("list") {
+				for _, a := range analyzers {
+					if external, ok := a.(sbctl.ExternalAnalyzer); ok {
+						fmt.Printf("%s\t%s\n", a.Name(), external.Path)
+					} else {
+						fmt.Printf("%s\t<built-in>\n", a.Name())
+					}
+				}
+				return nil
+			}
+
+			clusterData, cleanup, err := loadClusterData(v)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			bundle := sbctl.NewBundleReader(clusterData)
+			results := []sbctl.AnalysisResult{}
+			failed := 0
+			for _, a := range analyzers {
+				r, err := a.Analyze(context.Background(), bundle)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Analyzer %s failed: %v\n", a.Name(), err)
+					failed++
+					continue
+				}
+				results = append(results, r...)
+			}
+
+			outcomes := v.GetStringSlice("outcome")
+			filtered := []sbctl.AnalysisResult{}
+			for _, r := range results {
+				if len(outcomes) == 0 || containsString(outcomes, r.Outcome()) {
+					filtered = append(filtered, r)
+				}
+			}
+			sort.SliceStable(filtered, func(i, j int) bool {
+				return analysisOutcomeOrder[filtered[i].Outcome()] < analysisOutcomeOrder[filtered[j].Outcome()]
+			})
+
+			if format == "json" {
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				if err := encoder.Encode(filtered); err != nil {
+					return errors.Wrap(err, "failed to write results")
+				}
+			} else if len(analyzers) == 0 {
+				fmt.Fprintln(os.Stderr, "No analyzers found")
+			} else {
+				printAnalysisResults(os.Stdout, filtered)
+			}
+
+			if failed > 0 {
+				return errors.Errorf("%d of %d analyzers failed", failed, len(analyzers))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	cmd.Flags().StringSlice("analyzer", nil, "path of an external analyzer to run, in addition to the ones found in the analyzers directory and PATH")
+	cmd.Flags().StringSlice("outcome", nil, "only show results with these outcomes. One or more of: fail, warn, pass")
+	cmd.Flags().Bool("list", false, "list the analyzers that would run, without running them")
+	cmd.Flags().String("format", "text", "output format. One of: text, json")
+	return cmd
+}
+
+// findAnalyzers returns the built-in analyzers, then the external ones. External analyzers given
+// with --analyzer are preferred over ones of the same name in the analyzers directory, which are
+// preferred over ones in PATH.
+func findAnalyzers(paths []string) ([]sbctl.Analyzer, error) {
+	analyzers := sbctl.RegisteredAnalyzers()
+	names := map[string]bool{}
+	for _, a := range analyzers {
+		names[a.Name()] = true
+	}
+
+	external := []sbctl.ExternalAnalyzer{}
+	for _, p := range paths {
+		if _, err := os.Stat(p); err != nil {
+			return nil, errors.Wrap(err, "failed to find analyzer")
+		}
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get absolute path of %s", p)
+		}
+		external = append(external, sbctl.ExternalAnalyzer{Path: abs})
+	}
+
+	dirs := []string{}
+	if configDir, err := os.UserConfigDir(); err == nil {
+		dirs = append(dirs, filepath.Join(configDir, "sbctl", "analyzers"))
+	}
+	dirs = append(dirs, filepath.SplitList(os.Getenv("PATH"))...)
+	external = append(external, sbctl.FindExternalAnalyzers(dirs)...)
+
+	for _, a := range external {
+		if names[a.Name()] {
+			continue
+		}
+		names[a.Name()] = true
+		analyzers = append(analyzers, a)
+	}
+	return analyzers, nil
+}
@@ -0,0 +1,168 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+)
+
+func AuditCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Query kube-apiserver audit logs collected in a support bundle",
+		Long: `Query kube-apiserver audit logs collected in a support bundle.
+
+Audit logs are only in a bundle when copied from control plane hosts by collectors. Every file
+with audit in its name outside of cluster-resources is read. Requests logged at several stages
+are shown once, at the last stage logged.
+
+--since and --until accept RFC3339 timestamps or durations, which are relative to the last audit
+event, since bundles do not record when they were collected. Use -o ndjson to export events with
+one JSON event per line, e.g. for jq.`,
+		Example: `  sbctl audit --verb delete --resource configmaps -n velero
+  sbctl audit --user 'system:serviceaccount:*' --since 1h
+  sbctl audit --verb delete,patch -o ndjson > changes.ndjson`,
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			output := v.GetString("output")
+			if output != "" && output != "json" && output != "ndjson" {
+				return usererrors.New(usererrors.InvalidArgument, errors.Errorf("unsupported output format %q, must be json or ndjson", output), "--output")
+			}
+
+			clusterData, cleanup, err := loadClusterData(v)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			files, err := sbctl.FindAuditLogs(clusterData)
+			if err != nil {
+				return errors.Wrap(err, "failed to find audit logs")
+			}
+			if len(files) == 0 {
+				return errors.New("no audit logs found in support bundle")
+			}
+
+			indexed, err := sbctl.AuditEvents(clusterData)
+			if err != nil {
+				return err
+			}
+
+			last := time.Now()
+			if len(indexed) > 0 {
+				last = indexed[len(indexed)-1].Received
+			}
+
+			query := sbctl.AuditQuery{
+				User:      v.GetString("user"),
+				Verbs:     v.GetStringSlice("verb"),
+				Resource:  v.GetString("resource"),
+				Namespace: v.GetString("namespace"),
+				Name:      v.GetString("name"),
+			}
+			query.Since, err = parseExportTime(v.GetString("since"), last)
+			if err != nil {
+				return errors.Wrap(err, "invalid --since")
+			}
+			query.Until, err = parseExportTime(v.GetString("until"), last)
+			if err != nil {
+				return errors.Wrap(err, "invalid --until")
+			}
+
+			events, err := sbctl.ReadAuditEvents(clusterData, sbctl.FilterAuditEvents(indexed, query))
+			if err != nil {
+				return err
+			}
+			if len(events) == 0 && output == "" {
+				fmt.Fprintln(os.Stderr, "No audit events found")
+				return nil
+			}
+
+			tf, err := newTimeFormat(v, last)
+			if err != nil {
+				return err
+			}
+			return printAuditEvents(os.Stdout, output, events, tf)
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	cmd.Flags().String("user", "", "user or impersonated user, as a glob pattern or a substring")
+	cmd.Flags().StringSlice("verb", nil, "verbs to show, e.g. delete,patch")
+	cmd.Flags().String("resource", "", "resource, e.g. configmaps or deployments.apps")
+	cmd.Flags().StringP("namespace", "n", "", "only show requests in this namespace")
+	cmd.Flags().String("name", "", "object name, as a glob pattern or a substring")
+	cmd.Flags().String("since", "", "only show requests at or after this time (RFC3339 or duration before the last audit event)")
+	cmd.Flags().String("until", "", "only show requests at or before this time (RFC3339 or duration before the last audit event)")
+	cmd.Flags().StringP("output", "o", "", "output format: json or ndjson. A table is printed by default.")
+	return cmd
+}
+
+func printAuditEvents(out io.Writer, output string, events []auditv1.Event, tf timeFormat) error {
+	switch output {
+	case "json":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(events)
+	case "ndjson":
+		encoder := json.NewEncoder(out)
+		for _, event := range events {
+			if err := encoder.Encode(event); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "TIME\tUSER\tVERB\tRESOURCE\tNAMESPACE\tNAME\tCODE")
+	for _, event := range events {
+		user := event.User.Username
+		if event.ImpersonatedUser != nil {
+			user = fmt.Sprintf("%s (as %s)", user, event.ImpersonatedUser.Username)
+		}
+		resource, namespace, name := "-", "-", "-"
+		if ref := event.ObjectRef; ref != nil {
+			resource = ref.Resource
+			if ref.Subresource != "" {
+				resource += "/" + ref.Subresource
+			}
+			if ref.APIGroup != "" {
+				resource += "." + ref.APIGroup
+			}
+			if ref.Namespace != "" {
+				namespace = ref.Namespace
+			}
+			if ref.Name != "" {
+				name = ref.Name
+			}
+		}
+		code := "-"
+		if event.ResponseStatus != nil {
+			code = strconv.Itoa(int(event.ResponseStatus.Code))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", tf.Format(event.RequestReceivedTimestamp.Time), user, event.Verb, resource, namespace, name, code)
+	}
+	return nil
+}
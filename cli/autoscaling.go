@@ -0,0 +1,152 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/output"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// maxAutoscalerStatusLines is how much of cluster-autoscaler's status is printed
+const maxAutoscalerStatusLines = 20
+
+func AutoscalingCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "autoscaling",
+		Short: "Summarize cluster-autoscaler and Karpenter scale-up failures and blocking pods",
+		Long: `Summarize cluster-autoscaler and Karpenter scale-up failures and blocking pods.
+
+Failed scale-ups are read from autoscaler events, the conditions of Karpenter NodeClaims, and
+the errors in the collected logs of cluster-autoscaler and Karpenter pods. Unschedulable pods are
+listed with the reason the autoscalers gave for not adding a node for them, and pods annotated to
+keep their node from being removed with the events about nodes that could not be removed.`,
+		Example:       `  sbctl autoscaling -s ./support-bundle.tar.gz`,
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			format := v.GetString("format")
+			if format != "text" && format != "json" {
+				return usererrors.New(usererrors.InvalidArgument, errors.Errorf("unsupported format %q, must be one of: text, json", format), "--format")
+			}
+
+			clusterData, cleanup, err := loadClusterData(v)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			summary, err := sbctl.FindAutoscaling(clusterData)
+			if err != nil {
+				return err
+			}
+
+			if format == "json" {
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				if err := encoder.Encode(summary); err != nil {
+					return errors.Wrap(err, "failed to write results")
+				}
+				return nil
+			}
+
+			events, err := sbctl.ListResources(clusterData, "", "events")
+			if err != nil {
+				return errors.Wrap(err, "failed to list events")
+			}
+			tf, err := newTimeFormat(v, bundleCollectionTime(events))
+			if err != nil {
+				return err
+			}
+			p, err := newPrinter(os.Stdout)
+			if err != nil {
+				return err
+			}
+			return printAutoscaling(p, summary, tf)
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	cmd.Flags().String("format", "text", "output format. One of: text, json")
+	return cmd
+}
+
+func printAutoscaling(p *output.Printer, summary *sbctl.AutoscalingSummary, tf timeFormat) error {
+	out := p.Writer()
+	if len(summary.Autoscalers) == 0 {
+		fmt.Fprintln(out, p.Faint("No cluster-autoscaler or Karpenter found in support bundle"))
+	} else {
+		fmt.Fprintf(out, "%s %s\n", p.Bold("Autoscalers:"), strings.Join(summary.Autoscalers, ", "))
+	}
+
+	if summary.ClusterAutoscalerStatus != "" {
+		fmt.Fprintf(out, "\n%s\n", p.Bold("cluster-autoscaler status:"))
+		lines := strings.Split(summary.ClusterAutoscalerStatus, "\n")
+		for i, line := range lines {
+			if i == maxAutoscalerStatusLines {
+				fmt.Fprintf(out, "  %s\n", p.Faint(fmt.Sprintf("... %d more lines, see --format json", len(lines)-i)))
+				break
+			}
+			fmt.Fprintf(out, "  %s\n", line)
+		}
+	}
+
+	for _, section := range []struct {
+		title  string
+		issues []sbctl.AutoscalerIssue
+	}{
+		{"Scale-up failures", summary.ScaleUpFailures},
+		{"Scale-down blocked", summary.ScaleDownBlocked},
+	} {
+		fmt.Fprintf(out, "\n%s\n", p.Bold(section.title+":"))
+		if len(section.issues) == 0 {
+			fmt.Fprintf(out, "  %s\n", p.Green("<none>"))
+			continue
+		}
+		t := p.NewTable("LAST SEEN", "AUTOSCALER", "OBJECT", "REASON", "COUNT", "MESSAGE")
+		for _, issue := range section.issues {
+			t.AddRow(tf.Format(issue.LastTime), valueOrNone(issue.Autoscaler), valueOrNone(issue.Object), valueOrNone(issue.Reason),
+				fmt.Sprint(issue.Count), p.Red(issue.Message))
+		}
+		if err := t.Print(); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(out, "\n%s\n", p.Bold("Unschedulable pods:"))
+	if len(summary.PendingPods) == 0 {
+		fmt.Fprintf(out, "  %s\n", p.Green("<none>"))
+	} else {
+		t := p.NewTable("NAMESPACE", "POD", "AUTOSCALER REASON")
+		for _, pod := range summary.PendingPods {
+			t.AddRow(pod.Namespace, pod.Name, pod.Reason)
+		}
+		if err := t.Print(); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(out, "\n%s\n", p.Bold("Pods blocking scale-down:"))
+	if len(summary.BlockingPods) == 0 {
+		fmt.Fprintf(out, "  %s\n", p.Green("<none>"))
+		return nil
+	}
+	t := p.NewTable("NAMESPACE", "POD", "NODE", "REASON")
+	for _, pod := range summary.BlockingPods {
+		t.AddRow(pod.Namespace, pod.Name, pod.Node, p.Yellow(pod.Reason))
+	}
+	return t.Print()
+}
@@ -0,0 +1,341 @@
+package cli
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// batchRow is a result of a query in one bundle. Every query fills the same columns, so results
+// of several queries can be consolidated in one spreadsheet.
+type batchRow struct {
+	Bundle    string `json:"bundle"`
+	Query     string `json:"query"`
+	Kind      string `json:"kind,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Details   string `json:"details,omitempty"`
+}
+
+// batchOptions are the flags of the queries, read before bundles are loaded concurrently
+type batchOptions struct {
+	Image string
+	Find  sbctl.FindQuery
+}
+
+type batchQuery struct {
+	Name string
+	Run  func(clusterData sbctl.ClusterData, opts batchOptions) ([]batchRow, error)
+}
+
+var batchQueries = []batchQuery{
+	{Name: "version", Run: batchVersion},
+	{Name: "images", Run: batchImages},
+	{Name: "checks", Run: batchChecks},
+	{Name: "analysis", Run: batchAnalysis},
+	{Name: "find", Run: batchFind},
+}
+
+func BatchCmd() *cobra.Command {
+	names := []string{}
+	for _, q := range batchQueries {
+		names = append(names, q.Name)
+	}
+
+	cmd := &cobra.Command{
+		Use:   "batch <dir>",
+		Short: "Run queries across a directory of support bundles",
+		Long: `Run queries across a directory of support bundles.
+
+Every bundle archive and extracted bundle in the directory is loaded, several at a time, and the
+results of all bundles are written as one CSV or JSON document with a row per result. Bundles
+that fail to load are reported in rows of the "error" query, and do not stop the others.
+
+Queries:
+  version    the Kubernetes version
+  images     images of workloads, filtered with --image
+  checks     inconsistencies found by sbctl check
+  analysis   analyzers that did not pass
+  find       objects matching --selector, --name and --kind, as sbctl find`,
+		Example: `  sbctl batch ./bundles --query images --image 'velero/velero:v1.9*'
+  sbctl batch ./bundles --query version,checks --format json -o fleet.json`,
+		Args:          cobra.ExactArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			selected := []batchQuery{}
+			for _, name := range v.GetStringSlice("query") {
+				found := false
+				for _, q := range batchQueries {
+					if q.Name == name {
+						selected = append(selected, q)
+						found = true
+					}
+				}
+				if !found {
+					return usererrors.New(usererrors.InvalidArgument, errors.Errorf("unknown query %q, must be one of: %s", name, strings.Join(names, ", ")), "--query")
+				}
+			}
+			if len(selected) == 0 {
+				return usererrors.New(usererrors.MissingArgument, nil, "--query")
+			}
+
+			format := v.GetString("format")
+			if format != "csv" && format != "json" {
+				return usererrors.New(usererrors.InvalidArgument, errors.Errorf("unsupported format %q, must be csv or json", format), "--format")
+			}
+
+			findQuery, err := sbctl.ParseFindQuery(v.GetStringSlice("kind"), "", v.GetString("name"), v.GetString("selector"), "")
+			if err != nil {
+				return err
+			}
+			opts := batchOptions{Image: v.GetString("image"), Find: findQuery}
+
+			bundles, err := findBatchBundles(args[0])
+			if err != nil {
+				return err
+			}
+			if len(bundles) == 0 {
+				return errors.Errorf("no support bundles found in %s", args[0])
+			}
+
+			rows := runBatch(bundles, selected, opts, v.GetInt("parallel"))
+
+			out := io.Writer(os.Stdout)
+			if outFile := v.GetString("output"); outFile != "" {
+				f, err := os.Create(outFile)
+				if err != nil {
+					return errors.Wrap(err, "failed to create output file")
+				}
+				defer f.Close()
+				out = f
+			}
+			return writeBatchRows(out, format, rows)
+		},
+	}
+
+	cmd.Flags().StringSlice("query", nil, fmt.Sprintf("queries to run: %s", strings.Join(names, ", ")))
+	cmd.Flags().Int("parallel", runtime.NumCPU(), "bundles to load at the same time")
+	cmd.Flags().String("format", "csv", "output format. One of: csv, json")
+	cmd.Flags().StringP("output", "o", "", "file to write to. Defaults to stdout.")
+	cmd.Flags().String("image", "", "images query: image glob pattern, or substring when it has no wildcards")
+	cmd.Flags().StringP("selector", "l", "", "find query: label selector, e.g. app=foo,tier!=db")
+	cmd.Flags().String("name", "", "find query: name glob pattern, or substring when it has no wildcards")
+	cmd.Flags().StringSlice("kind", nil, "find query: resources or kinds to search, e.g. deployments,Service")
+	return cmd
+}
+
+// findBatchBundles returns the bundle archives and extracted bundles in dir, sorted by name
+func findBatchBundles(dir string) ([]string, error) {
+	archives, err := findBundleArchives(dir)
+	if err != nil {
+		return nil, err
+	}
+	bundles := []string{}
+	for _, a := range archives {
+		bundles = append(bundles, a.path)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read dir")
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		clusterData, err := sbctl.FindClusterData(path)
+		if err != nil {
+			continue
+		}
+		if clusterData.ClusterResourcesDir != "" || clusterData.SupportBundleKitDir != "" {
+			bundles = append(bundles, path)
+		}
+	}
+
+	sort.Strings(bundles)
+	return bundles, nil
+}
+
+// runBatch runs the queries in every bundle with up to parallel bundles loaded at once. Rows are
+// returned in the order of the bundles, whichever finishes first.
+func runBatch(bundles []string, queries []batchQuery, opts batchOptions, parallel int) []batchRow {
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	results := make([][]batchRow, len(bundles))
+	indexes := make(chan int)
+	wg := sync.WaitGroup{}
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = runBatchBundle(bundles[i], queries, opts)
+			}
+		}()
+	}
+	for i := range bundles {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	rows := []batchRow{}
+	for _, r := range results {
+		rows = append(rows, r...)
+	}
+	return rows
+}
+
+func runBatchBundle(bundle string, queries []batchQuery, opts batchOptions) []batchRow {
+	name := filepath.Base(bundle)
+	errorRow := func(err error) batchRow {
+		return batchRow{Bundle: name, Query: "error", Details: err.Error()}
+	}
+
+	bundleDir, deleteBundleDir, err := getBundleDir(bundle, "")
+	if err != nil {
+		return []batchRow{errorRow(err)}
+	}
+	if deleteBundleDir {
+		defer removeBundleData(bundleDir)
+	}
+
+	clusterData, convertedDir, err := getClusterData(bundleDir)
+	if convertedDir != "" {
+		defer removeBundleData(convertedDir)
+	}
+	if err != nil {
+		return []batchRow{errorRow(err)}
+	}
+	clusterData = indexClusterData(bundle, deleteBundleDir, clusterData)
+
+	rows := []batchRow{}
+	for _, q := range queries {
+		found, err := q.Run(clusterData, opts)
+		if err != nil {
+			rows = append(rows, errorRow(errors.Wrapf(err, "query %s", q.Name)))
+			continue
+		}
+		for i := range found {
+			found[i].Bundle = name
+			found[i].Query = q.Name
+		}
+		rows = append(rows, found...)
+	}
+	return rows
+}
+
+func batchVersion(clusterData sbctl.ClusterData, opts batchOptions) ([]batchRow, error) {
+	return []batchRow{{Kind: "Cluster", Details: clusterVersion(clusterData)}}, nil
+}
+
+func batchImages(clusterData sbctl.ClusterData, opts batchOptions) ([]batchRow, error) {
+	images, err := collectImages(clusterData)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []batchRow{}
+	for _, image := range images {
+		if opts.Image != "" && !sbctl.MatchesNamePattern(opts.Image, image.Image) {
+			continue
+		}
+		rows = append(rows, batchRow{Kind: "Image", Name: image.Image, Details: strings.Join(image.Workloads, ", ")})
+	}
+	return rows, nil
+}
+
+func batchChecks(clusterData sbctl.ClusterData, opts batchOptions) ([]batchRow, error) {
+	d, err := loadCheckData(clusterData)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []batchRow{}
+	for _, c := range consistencyChecks {
+		issues, err := c.Run(d)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to run check %s", c.Name)
+		}
+		for _, issue := range issues {
+			rows = append(rows, batchRow{
+				Kind:      issue.Kind,
+				Namespace: issue.Namespace,
+				Name:      issue.Name,
+				Details:   fmt.Sprintf("%s: %s", c.Name, issue.Message),
+			})
+		}
+	}
+	return rows, nil
+}
+
+func batchAnalysis(clusterData sbctl.ClusterData, opts batchOptions) ([]batchRow, error) {
+	results, err := sbctl.ReadAnalysis(clusterData)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []batchRow{}
+	for _, r := range results {
+		if r.Outcome() == "pass" {
+			continue
+		}
+		rows = append(rows, batchRow{Kind: "Analyzer", Name: r.Title(), Details: fmt.Sprintf("%s: %s", r.Outcome(), r.Message())})
+	}
+	return rows, nil
+}
+
+func batchFind(clusterData sbctl.ClusterData, opts batchOptions) ([]batchRow, error) {
+	resources, err := sbctl.ListIndexedResources(clusterData)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list resources")
+	}
+
+	rows := []batchRow{}
+	for _, o := range findObjects(resources, opts.Find) {
+		rows = append(rows, batchRow{Kind: o.Kind, Namespace: o.Namespace, Name: o.Name})
+	}
+	return rows, nil
+}
+
+func writeBatchRows(out io.Writer, format string, rows []batchRow) error {
+	if format == "json" {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(rows)
+	}
+
+	w := csv.NewWriter(out)
+	if err := w.Write([]string{"bundle", "query", "kind", "namespace", "name", "details"}); err != nil {
+		return errors.Wrap(err, "failed to write header")
+	}
+	for _, r := range rows {
+		if err := w.Write([]string{r.Bundle, r.Query, r.Kind, r.Namespace, r.Name, r.Details}); err != nil {
+			return errors.Wrap(err, "failed to write row")
+		}
+	}
+	w.Flush()
+	return errors.Wrap(w.Error(), "failed to write output")
+}
@@ -0,0 +1,346 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/api"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// tableAccept is the Accept header kubectl sends for "kubectl get", which asks for server side printing
+const tableAccept = "application/json;as=Table;v=v1;g=meta.k8s.io,application/json;as=Table;v=v1beta1;g=meta.k8s.io,application/json"
+
+type benchQuery struct {
+	Name   string
+	Weight int
+	Accept string
+	// paths returns the request paths the query picks from
+	paths func(b *benchTargets) []string
+}
+
+// benchTargets are the objects of the bundle that queries are made against
+type benchTargets struct {
+	Namespaces []string
+	Pods       []corev1.Pod
+}
+
+// benchQueries is a mix of the requests kubectl makes for the commands most used when triaging a bundle
+var benchQueries = []benchQuery{
+	{Name: "discovery", Weight: 2, paths: func(b *benchTargets) []string {
+		return []string{"/api", "/apis", "/api/v1", "/apis/apps/v1", "/version"}
+	}},
+	{Name: "get pods -A", Weight: 2, Accept: tableAccept, paths: func(b *benchTargets) []string {
+		return []string{"/api/v1/pods?limit=500"}
+	}},
+	{Name: "get pods -n", Weight: 4, Accept: tableAccept, paths: func(b *benchTargets) []string {
+		paths := []string{}
+		for _, ns := range b.Namespaces {
+			paths = append(paths, fmt.Sprintf("/api/v1/namespaces/%s/pods?limit=500", ns))
+		}
+		return paths
+	}},
+	{Name: "get pod -o yaml", Weight: 4, Accept: "application/json", paths: func(b *benchTargets) []string {
+		paths := []string{}
+		for _, p := range b.Pods {
+			paths = append(paths, fmt.Sprintf("/api/v1/namespaces/%s/pods/%s", p.Namespace, p.Name))
+		}
+		return paths
+	}},
+	{Name: "describe pod events", Weight: 2, Accept: "application/json", paths: func(b *benchTargets) []string {
+		paths := []string{}
+		for _, p := range b.Pods {
+			selector := url.QueryEscape(fmt.Sprintf("involvedObject.name=%s,involvedObject.namespace=%s", p.Name, p.Namespace))
+			paths = append(paths, fmt.Sprintf("/api/v1/namespaces/%s/events?fieldSelector=%s", p.Namespace, selector))
+		}
+		return paths
+	}},
+	{Name: "get events -n", Weight: 2, Accept: tableAccept, paths: func(b *benchTargets) []string {
+		paths := []string{}
+		for _, ns := range b.Namespaces {
+			paths = append(paths, fmt.Sprintf("/api/v1/namespaces/%s/events?limit=500", ns))
+		}
+		return paths
+	}},
+	{Name: "get deployments -A", Weight: 1, Accept: tableAccept, paths: func(b *benchTargets) []string {
+		return []string{"/apis/apps/v1/deployments?limit=500"}
+	}},
+	{Name: "get nodes", Weight: 1, Accept: tableAccept, paths: func(b *benchTargets) []string {
+		return []string{"/api/v1/nodes?limit=500"}
+	}},
+	{Name: "logs", Weight: 2, paths: func(b *benchTargets) []string {
+		paths := []string{}
+		for _, p := range b.Pods {
+			if len(p.Spec.Containers) > 0 {
+				paths = append(paths, fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/log?container=%s", p.Namespace, p.Name, p.Spec.Containers[0].Name))
+			}
+		}
+		return paths
+	}},
+}
+
+type benchResult struct {
+	Query      string        `json:"query"`
+	Requests   int           `json:"requests"`
+	Errors     int           `json:"errors"`
+	Throughput float64       `json:"requestsPerSecond"`
+	P50        time.Duration `json:"p50"`
+	P95        time.Duration `json:"p95"`
+	P99        time.Duration `json:"p99"`
+	Max        time.Duration `json:"max"`
+	latencies  []time.Duration
+}
+
+func BenchCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bench [bundle]",
+		Short: "Benchmark the API server against a support bundle",
+		Long: `Benchmark the API server against a support bundle.
+
+The bundle is served by an in-process API server, which is sent a weighted mix of the requests
+kubectl makes for common commands (discovery, get, get -o yaml, describe, logs) from concurrent
+clients. Throughput and latency percentiles are reported for each query.
+
+Use --format json and --max-p95 to track performance in CI. The command fails when the p95
+latency of any query exceeds --max-p95, or when any request fails.`,
+		Args:          cobra.MaximumNArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+			if len(args) == 1 {
+				v.Set("support-bundle-location", args[0])
+			}
+
+			format := v.GetString("format")
+			if format != "table" && format != "json" {
+				return usererrors.New(usererrors.InvalidArgument, errors.Errorf("unsupported format %q, must be one of: table, json", format), "--format")
+			}
+
+			clusterData, cleanup, err := loadClusterData(v)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			// Request logs would dominate the output and the timings
+			log.SetOutput(io.Discard)
+			kubeConfig, err := api.StartAPIServer(clusterData, io.Discard)
+			if err != nil {
+				return usererrors.New(usererrors.ServerStartFailed, err)
+			}
+			defer os.RemoveAll(kubeConfig)
+
+			config, err := clientcmd.BuildConfigFromFlags("", kubeConfig)
+			if err != nil {
+				return errors.Wrap(err, "failed to load kubeconfig")
+			}
+
+			client := &http.Client{
+				Timeout: 5 * time.Minute,
+				Transport: &http.Transport{
+					MaxIdleConnsPerHost: v.GetInt("concurrency"),
+				},
+			}
+
+			targets, err := loadBenchTargets(client, config.Host)
+			if err != nil {
+				return err
+			}
+
+			results, elapsed := runBench(client, config.Host, targets, v.GetInt("concurrency"), v.GetDuration("duration"))
+			if format == "json" {
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				if err := encoder.Encode(results); err != nil {
+					return errors.Wrap(err, "failed to write results")
+				}
+			} else {
+				printBenchResults(os.Stdout, results, elapsed)
+			}
+
+			maxP95 := v.GetDuration("max-p95")
+			for _, r := range results {
+				if r.Errors > 0 {
+					return errors.Errorf("%d %q requests failed", r.Errors, r.Query)
+				}
+				if maxP95 > 0 && r.P95 > maxP95 {
+					return errors.Errorf("p95 latency of %q is %s, which exceeds %s", r.Query, r.P95, maxP95)
+				}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	cmd.Flags().IntP("concurrency", "c", 8, "number of concurrent clients")
+	cmd.Flags().DurationP("duration", "d", 10*time.Second, "how long to send requests for")
+	cmd.Flags().Duration("max-p95", 0, "fail if the p95 latency of any query exceeds this duration")
+	cmd.Flags().String("format", "table", "output format. One of: table, json")
+	return cmd
+}
+
+func loadBenchTargets(client *http.Client, host string) (*benchTargets, error) {
+	resp, err := client.Get(host + "/api/v1/pods")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list pods")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("failed to list pods: unexpected status %d", resp.StatusCode)
+	}
+
+	pods := corev1.PodList{}
+	if err := json.NewDecoder(resp.Body).Decode(&pods); err != nil {
+		return nil, errors.Wrap(err, "failed to decode pods")
+	}
+
+	targets := &benchTargets{Namespaces: []string{}, Pods: pods.Items}
+	for _, p := range pods.Items {
+		if !containsString(targets.Namespaces, p.Namespace) {
+			targets.Namespaces = append(targets.Namespaces, p.Namespace)
+		}
+	}
+	return targets, nil
+}
+
+// runBench sends requests from concurrent clients until duration has passed. Each client cycles
+// through the queries in proportion to their weights, and through the paths of each query.
+func runBench(client *http.Client, host string, targets *benchTargets, concurrency int, duration time.Duration) ([]*benchResult, time.Duration) {
+	queryPaths := map[string][]string{}
+	schedule := []*benchQuery{}
+	for i := range benchQueries {
+		q := &benchQueries[i]
+		queryPaths[q.Name] = q.paths(targets)
+		if len(queryPaths[q.Name]) == 0 {
+			continue
+		}
+		for w := 0; w < q.Weight; w++ {
+			schedule = append(schedule, q)
+		}
+	}
+
+	results := map[string]*benchResult{}
+	for _, q := range benchQueries {
+		results[q.Name] = &benchResult{Query: q.Name}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	start := time.Now()
+	deadline := start.Add(duration)
+	for c := 0; c < concurrency; c++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			counters := map[string]int{}
+			for i := worker; time.Now().Before(deadline); i++ {
+				q := schedule[i%len(schedule)]
+				paths := queryPaths[q.Name]
+				path := paths[(counters[q.Name]*concurrency+worker)%len(paths)]
+				counters[q.Name]++
+
+				latency, err := benchRequest(client, host+path, q.Accept)
+				mu.Lock()
+				r := results[q.Name]
+				r.Requests++
+				if err != nil {
+					r.Errors++
+				} else {
+					r.latencies = append(r.latencies, latency)
+				}
+				mu.Unlock()
+			}
+		}(c)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	sorted := []*benchResult{}
+	for _, q := range benchQueries {
+		r := results[q.Name]
+		if r.Requests == 0 {
+			continue
+		}
+		sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+		r.Throughput = float64(r.Requests) / elapsed.Seconds()
+		r.P50 = latencyPercentile(r.latencies, 50)
+		r.P95 = latencyPercentile(r.latencies, 95)
+		r.P99 = latencyPercentile(r.latencies, 99)
+		r.Max = latencyPercentile(r.latencies, 100)
+		sorted = append(sorted, r)
+	}
+	return sorted, elapsed
+}
+
+func benchRequest(client *http.Client, url string, accept string) (time.Duration, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// The response is read completely, since clients pay for the whole body
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return 0, err
+	}
+	latency := time.Since(start)
+
+	// Objects missing from the bundle are expected, e.g. logs that were not collected
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return latency, errors.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return latency, nil
+}
+
+// latencyPercentile returns the p-th percentile of sorted latencies using the nearest rank method
+func latencyPercentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func printBenchResults(out io.Writer, results []*benchResult, elapsed time.Duration) {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	defer w.Flush()
+
+	total := 0
+	fmt.Fprintln(w, "QUERY\tREQUESTS\tERRORS\tREQ/S\tP50\tP95\tP99\tMAX")
+	for _, r := range results {
+		total += r.Requests
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.1f\t%s\t%s\t%s\t%s\n", r.Query, r.Requests, r.Errors, r.Throughput,
+			r.P50.Round(time.Microsecond), r.P95.Round(time.Microsecond), r.P99.Round(time.Microsecond), r.Max.Round(time.Microsecond))
+	}
+	fmt.Fprintf(w, "TOTAL\t%d\t\t%.1f\t\t\t\t\n", total, float64(total)/elapsed.Seconds())
+}
@@ -0,0 +1,373 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
+	sbctlutil "github.com/replicatedhq/sbctl/pkg/util"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+)
+
+// getBundleDir resolves a support bundle location (URL, archive or directory) to a directory on disk.
+// The returned bool is true when the directory was created by sbctl and should be removed when done.
+func getBundleDir(bundleLocation string, token string) (string, bool, error) {
+	if bundleLocation == "" {
+		return "", false, usererrors.New(usererrors.BundleLocationRequired, nil)
+	}
+
+	if strings.HasPrefix(bundleLocation, "http") && isMultiPartLocation(bundleLocation) {
+		dir, err := downloadMultiPartBundle(bundleLocation, token)
+		if err != nil {
+			return "", false, usererrors.New(usererrors.BundleDownloadFailed, err, bundleLocation)
+		}
+		return dir, true, nil
+	}
+
+	if strings.HasPrefix(bundleLocation, "http") {
+		if token == "" {
+			portal, err := portalToken(bundleLocation)
+			if err != nil {
+				return "", false, err
+			}
+			if portal == "" {
+				return "", false, usererrors.New(usererrors.BundleTokenRequired, nil)
+			}
+			token = portal
+		}
+
+		fmt.Printf("Downloading bundle\n")
+
+		dir, err := downloadAndExtractBundle(bundleLocation, token)
+		if err != nil {
+			return "", false, usererrors.New(usererrors.BundleDownloadFailed, err, bundleLocation)
+		}
+		return dir, true, nil
+	}
+
+	fileInfo, err := os.Stat(bundleLocation)
+	if os.IsNotExist(err) {
+		return "", false, usererrors.New(usererrors.BundleNotFound, err, bundleLocation)
+	}
+	if err != nil {
+		return "", false, errors.Wrap(err, "failed to stat input path")
+	}
+
+	if fileInfo.IsDir() {
+		archive, err := pickBundleArchive(bundleLocation, os.Stdin, os.Stderr)
+		if err != nil {
+			return "", false, err
+		}
+		if archive == "" {
+			return bundleLocation, false, nil
+		}
+		bundleLocation = archive
+	}
+
+	bundleDir, err := os.MkdirTemp("", "sbctl-")
+	if err != nil {
+		return "", false, errors.Wrap(err, "failed to create temp dir")
+	}
+
+	err = sbctl.ExtractBundle(bundleLocation, bundleDir)
+	if err != nil {
+		_ = removeBundleData(bundleDir)
+		return "", false, usererrors.New(usererrors.BundleExtractFailed, err, bundleLocation)
+	}
+
+	return bundleDir, true, nil
+}
+
+// overlayDeltas overlays the --delta bundles, collected after the bundle in bundleDir, on it.
+// The result is in a new temp dir, which is returned with the bool true, and the dirs of the
+// bundles are removed when deleteBundleDir is true. Without deltas, bundleDir is returned as is.
+func overlayDeltas(bundleDir string, deleteBundleDir bool, token string) (string, bool, error) {
+	deltas := viper.GetStringSlice("delta")
+	if len(deltas) == 0 {
+		return bundleDir, deleteBundleDir, nil
+	}
+	if deleteBundleDir {
+		defer removeBundleData(bundleDir)
+	}
+
+	base, convertedDir, err := getClusterData(bundleDir)
+	if convertedDir != "" {
+		defer removeBundleData(convertedDir)
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	deltaData := []sbctl.ClusterData{}
+	for _, delta := range deltas {
+		dir, deleteDir, err := getBundleDir(delta, token)
+		if err != nil {
+			return "", false, errors.Wrapf(err, "failed to load delta %s", delta)
+		}
+		if deleteDir {
+			defer removeBundleData(dir)
+		}
+		clusterData, convertedDir, err := getClusterData(dir)
+		if convertedDir != "" {
+			defer removeBundleData(convertedDir)
+		}
+		if err != nil {
+			return "", false, errors.Wrapf(err, "failed to load delta %s", delta)
+		}
+		deltaData = append(deltaData, clusterData)
+	}
+
+	outDir, err := os.MkdirTemp("", "sbctl-overlay-")
+	if err != nil {
+		return "", false, errors.Wrap(err, "failed to create temp dir")
+	}
+	if _, err := sbctl.OverlayBundles(base, deltaData, outDir); err != nil {
+		_ = removeBundleData(outDir)
+		return "", false, errors.Wrap(err, "failed to overlay delta bundles")
+	}
+	return outDir, true, nil
+}
+
+// removeBundleData removes a directory sbctl extracted or converted a bundle into. With
+// --secure-cleanup, the files are overwritten before they are removed.
+func removeBundleData(dir string) error {
+	if dir == "" {
+		return nil
+	}
+	if viper.GetBool("secure-cleanup") {
+		return sbctlutil.ShredDir(dir)
+	}
+	return os.RemoveAll(dir)
+}
+
+// getClusterData finds the cluster data in bundleDir. Bundles which are not in the troubleshoot
+// format are converted into a temp dir, which is returned so that it can be removed when done.
+func getClusterData(bundleDir string) (sbctl.ClusterData, string, error) {
+	clusterData, err := sbctl.FindClusterData(bundleDir)
+	if err != nil {
+		return clusterData, "", errors.Wrap(err, "failed to find cluster data")
+	}
+
+	if clusterData.ClusterResourcesDir != "" || clusterData.SupportBundleKitDir == "" {
+		return clusterData, "", nil
+	}
+
+	convertedDir, err := os.MkdirTemp("", "sbctl-converted-")
+	if err != nil {
+		return clusterData, "", errors.Wrap(err, "failed to create temp dir")
+	}
+
+	clusterData, err = sbctl.ConvertSupportBundleKit(clusterData.SupportBundleKitDir, convertedDir)
+	if err != nil {
+		_ = removeBundleData(convertedDir)
+		return clusterData, "", usererrors.New(usererrors.BundleConvertFailed, err)
+	}
+
+	return clusterData, convertedDir, nil
+}
+
+// loadClusterData resolves the support bundle from the support-bundle-location and token flags.
+// The returned function removes any temporary files and should be called when done with the bundle.
+func loadClusterData(v *viper.Viper) (sbctl.ClusterData, func(), error) {
+	bundleDir, deleteBundleDir, err := getBundleDir(v.GetString("support-bundle-location"), v.GetString("token"))
+	if err != nil {
+		return sbctl.ClusterData{}, func() {}, err
+	}
+	bundleDir, deleteBundleDir, err = overlayDeltas(bundleDir, deleteBundleDir, v.GetString("token"))
+	if err != nil {
+		return sbctl.ClusterData{}, func() {}, err
+	}
+
+	clusterData, convertedDir, err := getClusterData(bundleDir)
+	cleanup := func() {
+		if deleteBundleDir {
+			_ = removeBundleData(bundleDir)
+		}
+		if convertedDir != "" {
+			_ = removeBundleData(convertedDir)
+		}
+	}
+	if err != nil {
+		cleanup()
+		return clusterData, func() {}, err
+	}
+
+	return indexClusterData(v.GetString("support-bundle-location"), deleteBundleDir, clusterData), cleanup, nil
+}
+
+// indexClusterData loads the index saved next to the bundle at location, or builds and saves it
+// when there is none or the bundle changed since. extracted is true when the bundle was
+// extracted from location. Bundles are used without an index when it cannot be built, and
+// indexes that cannot be saved, e.g. next to read-only bundles, are only used this time.
+func indexClusterData(location string, extracted bool, clusterData sbctl.ClusterData) sbctl.ClusterData {
+	if viper.GetBool("no-index") || len(viper.GetStringSlice("delta")) > 0 || clusterData.ClusterResourcesDir == "" || strings.HasPrefix(location, "http") {
+		return clusterData
+	}
+	info, err := os.Stat(location)
+	if err != nil || (info.IsDir() && extracted) {
+		// An archive picked from a folder of bundles is not indexed
+		return clusterData
+	}
+
+	index, err := sbctl.LoadBundleIndex(location)
+	if err != nil {
+		log.Debugf("Failed to load bundle index: %v", err)
+	}
+	if index == nil {
+		index, err = sbctl.BuildBundleIndex(location, clusterData)
+		if err != nil {
+			log.Debugf("Failed to build bundle index: %v", err)
+			return clusterData
+		}
+		if err := sbctl.SaveBundleIndex(location, index); err != nil {
+			log.Debugf("Failed to save bundle index: %v", err)
+		}
+	}
+
+	clusterData.Index = index
+	return clusterData
+}
+
+// pickBundleArchive chooses a bundle archive when dir is a folder of bundles rather than an
+// extracted bundle, e.g. a customer's support folder. With several archives, --latest picks the
+// most recently modified one, otherwise the user is asked to choose when running in a terminal.
+// An empty string is returned when dir should be used as is.
+func pickBundleArchive(dir string, in *os.File, out io.Writer) (string, error) {
+	clusterData, err := sbctl.FindClusterData(dir)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to find cluster data")
+	}
+	if clusterData.ClusterResourcesDir != "" || clusterData.SupportBundleKitDir != "" {
+		return "", nil
+	}
+
+	archives, err := findBundleArchives(dir)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case len(archives) == 0:
+		return "", nil
+	case len(archives) == 1:
+		return archives[0].path, nil
+	case viper.GetBool("latest"):
+		return archives[0].path, nil
+	case !term.IsTerminal(int(in.Fd())):
+		names := []string{}
+		for _, a := range archives {
+			names = append(names, filepath.Base(a.path))
+		}
+		return "", errors.Errorf("%s contains %d support bundles, pass one of them or use --latest: %s", dir, len(archives), strings.Join(names, ", "))
+	}
+
+	fmt.Fprintf(out, "%s contains %d support bundles:\n", dir, len(archives))
+	for i, a := range archives {
+		fmt.Fprintf(out, "  %d) %s (modified %s)\n", i+1, filepath.Base(a.path), a.modTime.Format("2006-01-02 15:04"))
+	}
+
+	reader := bufio.NewReader(in)
+	for {
+		fmt.Fprintf(out, "Select a bundle [1-%d, default 1]: ", len(archives))
+		line, err := reader.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line == "" && err == nil {
+			return archives[0].path, nil
+		}
+		if n, convErr := strconv.Atoi(line); convErr == nil && n >= 1 && n <= len(archives) {
+			return archives[n-1].path, nil
+		}
+		if err != nil {
+			return "", errors.New("no support bundle selected")
+		}
+		fmt.Fprintf(out, "%q is not a number between 1 and %d\n", line, len(archives))
+	}
+}
+
+type bundleArchive struct {
+	path    string
+	modTime time.Time
+}
+
+// findBundleArchives returns the bundle archives in dir, most recently modified first
+func findBundleArchives(dir string) ([]bundleArchive, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read dir")
+	}
+
+	archives := []bundleArchive{}
+	for _, entry := range entries {
+		name := strings.ToLower(entry.Name())
+		if entry.IsDir() || !(strings.HasSuffix(name, ".tgz") || strings.HasSuffix(name, ".tar.gz")) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to stat %s", entry.Name())
+		}
+		archives = append(archives, bundleArchive{path: filepath.Join(dir, entry.Name()), modTime: info.ModTime()})
+	}
+
+	sort.SliceStable(archives, func(i, j int) bool {
+		return archives[i].modTime.After(archives[j].modTime)
+	})
+	return archives, nil
+}
+
+// maxCollectorErrors is how many collector errors are printed when a bundle is loaded
+const maxCollectorErrors = 10
+
+// printCollectorErrors warns about collectors that failed, so missing data is not mistaken for
+// resources that did not exist in the cluster
+func printCollectorErrors(out io.Writer, clusterData sbctl.ClusterData) {
+	collectorErrors, err := sbctl.ReadCollectorErrors(clusterData)
+	if err != nil {
+		fmt.Fprintf(out, "Failed to read collector errors: %v\n", err)
+		return
+	}
+	if len(collectorErrors) == 0 {
+		return
+	}
+
+	collectors := map[string]bool{}
+	for _, e := range collectorErrors {
+		collectors[e.Collector] = true
+	}
+	noun := "collectors"
+	if len(collectors) == 1 {
+		noun = "collector"
+	}
+	fmt.Fprintf(out, "Warning: %d %s failed, their data may be missing from the bundle:\n", len(collectors), noun)
+	for i, e := range collectorErrors {
+		if i == maxCollectorErrors {
+			fmt.Fprintf(out, "  ... and %d more errors, see /sbctl/v1/collector-errors\n", len(collectorErrors)-maxCollectorErrors)
+			break
+		}
+		message, _, _ := strings.Cut(e.Message, "\n")
+		fmt.Fprintf(out, "  %s: %s\n", e.Collector, message)
+	}
+	fmt.Fprintln(out)
+}
+
+// bundleArchiveName is the directory the files of a bundle sbctl writes are in, the name of the archive
+// without its extension
+func bundleArchiveName(output string) string {
+	name := filepath.Base(output)
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar"} {
+		if strings.HasSuffix(name, ext) {
+			return strings.TrimSuffix(name, ext)
+		}
+	}
+	return name
+}
@@ -0,0 +1,265 @@
+package cli
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	certManagerGroup     = "cert-manager.io"
+	certManagerACMEGroup = "acme.cert-manager.io"
+)
+
+// certExpiryWarning is how close to expiry a certificate has to be to be reported
+const certExpiryWarning = 14 * 24 * time.Hour
+
+type certificateDiagnosis struct {
+	Namespace    string
+	Name         string
+	Ready        string
+	NotAfter     string
+	RenewalTime  string
+	SecretName   string
+	SecretExpiry string
+	Issues       []string
+}
+
+func CertManagerCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cert-manager",
+		Short: "Diagnose cert-manager certificates in a support bundle",
+		Long: `Diagnose cert-manager certificates in a support bundle.
+
+Each Certificate's Ready condition and expiry is checked and correlated with the certificate
+stored in its Secret (when collected), pending ACME challenges for its DNS names, and warning
+events for the Certificate and its CertificateRequests. Expiry is evaluated relative to the
+time the bundle was collected.`,
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			clusterData, cleanup, err := loadClusterData(v)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			certificates, err := sbctl.ListResources(clusterData, certManagerGroup, "certificates")
+			if err != nil {
+				return errors.Wrap(err, "failed to list certificates")
+			}
+			if len(certificates) == 0 {
+				fmt.Println("No cert-manager Certificates found in support bundle")
+				return nil
+			}
+
+			challenges, err := sbctl.ListResources(clusterData, certManagerACMEGroup, "challenges")
+			if err != nil {
+				return errors.Wrap(err, "failed to list challenges")
+			}
+
+			events, err := sbctl.ListResources(clusterData, "", "events")
+			if err != nil {
+				return errors.Wrap(err, "failed to list events")
+			}
+
+			secretExpiries, err := findSecretCertificateExpiries(clusterData)
+			if err != nil {
+				return errors.Wrap(err, "failed to read collected secrets")
+			}
+
+			sortByCreationTimestamp(certificates)
+			now := bundleCollectionTime(events)
+
+			diagnoses := []certificateDiagnosis{}
+			for _, c := range certificates {
+				diagnoses = append(diagnoses, diagnoseCertificate(c, challenges, events, secretExpiries, now))
+			}
+
+			tf, err := newTimeFormat(v, now)
+			if err != nil {
+				return err
+			}
+
+			printCertificateDiagnoses(os.Stdout, diagnoses, tf)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	return cmd
+}
+
+func diagnoseCertificate(cert unstructured.Unstructured, challenges []unstructured.Unstructured, events []unstructured.Unstructured, secretExpiries map[string]time.Time, now time.Time) certificateDiagnosis {
+	d := certificateDiagnosis{
+		Namespace:    cert.GetNamespace(),
+		Name:         cert.GetName(),
+		Ready:        "Unknown",
+		NotAfter:     nestedStringOrNone(cert, "status", "notAfter"),
+		RenewalTime:  nestedStringOrNone(cert, "status", "renewalTime"),
+		SecretName:   nestedStringOrNone(cert, "spec", "secretName"),
+		SecretExpiry: "<unknown>",
+		Issues:       []string{},
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(cert.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok || condition["type"] != "Ready" {
+			continue
+		}
+		d.Ready = fmt.Sprint(condition["status"])
+		if d.Ready != "True" {
+			d.Issues = append(d.Issues, fmt.Sprintf("not ready: %v: %v", condition["reason"], condition["message"]))
+		}
+	}
+
+	notAfter, err := time.Parse(time.RFC3339, d.NotAfter)
+	if err == nil {
+		if notAfter.Before(now) {
+			d.Issues = append(d.Issues, fmt.Sprintf("expired %s before the bundle was collected", now.Sub(notAfter).Round(time.Hour)))
+		} else if notAfter.Sub(now) < certExpiryWarning {
+			d.Issues = append(d.Issues, fmt.Sprintf("expires %s after the bundle was collected", notAfter.Sub(now).Round(time.Hour)))
+		}
+	}
+
+	renewalTime, err := time.Parse(time.RFC3339, d.RenewalTime)
+	if err == nil && renewalTime.Before(now) {
+		d.Issues = append(d.Issues, fmt.Sprintf("renewal was due at %s but has not happened", d.RenewalTime))
+	}
+
+	if secretExpiry, ok := secretExpiries[fmt.Sprintf("%s/%s", d.Namespace, d.SecretName)]; ok {
+		d.SecretExpiry = secretExpiry.UTC().Format(time.RFC3339)
+		if !notAfter.IsZero() && !secretExpiry.Equal(notAfter) {
+			d.Issues = append(d.Issues, fmt.Sprintf("secret %s contains a certificate expiring at %s, which does not match the Certificate status", d.SecretName, d.SecretExpiry))
+		}
+		if secretExpiry.Before(now) {
+			d.Issues = append(d.Issues, fmt.Sprintf("certificate in secret %s is expired", d.SecretName))
+		}
+	}
+
+	dnsNames, _, _ := unstructured.NestedStringSlice(cert.Object, "spec", "dnsNames")
+	for _, ch := range challenges {
+		if ch.GetNamespace() != d.Namespace {
+			continue
+		}
+		dnsName := nestedStringOrNone(ch, "spec", "dnsName")
+		if !containsString(dnsNames, dnsName) {
+			continue
+		}
+		state := nestedStringOrNone(ch, "status", "state")
+		if state == "valid" {
+			continue
+		}
+		d.Issues = append(d.Issues, fmt.Sprintf("challenge %s for %s is %s: %s", ch.GetName(), dnsName, state, nestedStringOrNone(ch, "status", "reason")))
+	}
+
+	for _, e := range events {
+		if nestedStringOrNone(e, "type") != "Warning" || nestedStringOrNone(e, "involvedObject", "namespace") != d.Namespace {
+			continue
+		}
+		kind := nestedStringOrNone(e, "involvedObject", "kind")
+		name := nestedStringOrNone(e, "involvedObject", "name")
+		// CertificateRequests and Orders are named after the Certificate with a generated suffix
+		if (kind == "Certificate" && name == d.Name) ||
+			((kind == "CertificateRequest" || kind == "Order") && strings.HasPrefix(name, d.Name+"-")) {
+			d.Issues = append(d.Issues, fmt.Sprintf("%s %s: %s: %s", kind, name, nestedStringOrNone(e, "reason"), nestedStringOrNone(e, "message")))
+		}
+	}
+
+	return d
+}
+
+// findSecretCertificateExpiries returns the expiry of certificates stored in secrets collected with
+// the troubleshoot "secret" collector, keyed by namespace/name. Only secrets collected with their
+// values contain a certificate.
+func findSecretCertificateExpiries(clusterData sbctl.ClusterData) (map[string]time.Time, error) {
+	expiries := map[string]time.Time{}
+	if clusterData.ClusterResourcesDir == "" {
+		return expiries, nil
+	}
+
+	secretsDir := filepath.Join(filepath.Dir(clusterData.ClusterResourcesDir), "secrets")
+	if !isDir(secretsDir) {
+		return expiries, nil
+	}
+
+	err := filepath.Walk(secretsDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || info.Name() != "tls.crt.json" {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read %s", path)
+		}
+
+		secret := struct {
+			Namespace string `json:"namespace"`
+			Name      string `json:"name"`
+			Value     string `json:"value"`
+		}{}
+		if err := json.Unmarshal(data, &secret); err != nil || secret.Value == "" {
+			return nil
+		}
+
+		block, _ := pem.Decode([]byte(secret.Value))
+		if block == nil {
+			return nil
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil
+		}
+
+		expiries[fmt.Sprintf("%s/%s", secret.Namespace, secret.Name)] = cert.NotAfter
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return expiries, nil
+}
+
+func printCertificateDiagnoses(out io.Writer, diagnoses []certificateDiagnosis, tf timeFormat) {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tCERTIFICATE\tREADY\tNOT AFTER\tRENEWAL TIME\tSECRET\tSECRET EXPIRY\tISSUES")
+	for _, d := range diagnoses {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\n", d.Namespace, d.Name, d.Ready, tf.FormatString(d.NotAfter), tf.FormatString(d.RenewalTime), d.SecretName, tf.FormatString(d.SecretExpiry), len(d.Issues))
+	}
+	w.Flush()
+
+	for _, d := range diagnoses {
+		if len(d.Issues) == 0 {
+			continue
+		}
+		fmt.Fprintf(out, "\n%s/%s:\n", d.Namespace, d.Name)
+		for _, issue := range d.Issues {
+			fmt.Fprintf(out, "  - %s\n", issue)
+		}
+	}
+}
@@ -0,0 +1,403 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/output"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// checkData is the bundle state the consistency checks run against
+type checkData struct {
+	Pods         []corev1.Pod
+	Services     []corev1.Service
+	Endpoints    []corev1.Endpoints
+	PVCs         []corev1.PersistentVolumeClaim
+	PVs          []corev1.PersistentVolume
+	ConfigMaps   []corev1.ConfigMap
+	Ingresses    []networkingv1.Ingress
+	HPAs         []autoscalingv2.HorizontalPodAutoscaler
+	objectExists func(group string, resource string, namespace string, name string) (bool, error)
+}
+
+type checkIssue struct {
+	Check     string
+	Kind      string
+	Namespace string
+	Name      string
+	Message   string
+}
+
+type consistencyCheck struct {
+	Name string
+	Run  func(d *checkData) ([]checkIssue, error)
+}
+
+var consistencyChecks = []consistencyCheck{
+	{Name: "service-endpoints", Run: checkServiceEndpoints},
+	{Name: "pvc-bound", Run: checkPVCsBound},
+	{Name: "pv-claimed", Run: checkPVsClaimed},
+	{Name: "pod-references", Run: checkPodReferences},
+	{Name: "ingress-backends", Run: checkIngressBackends},
+	{Name: "hpa-targets", Run: checkHPATargets},
+}
+
+func CheckCmd() *cobra.Command {
+	names := []string{}
+	for _, c := range consistencyChecks {
+		names = append(names, c.Name)
+	}
+
+	cmd := &cobra.Command{
+		Use:   "check",
+		Short: "Check a support bundle for inconsistencies between resources",
+		Long: fmt.Sprintf(`Check a support bundle for inconsistencies between resources.
+
+Objects are checked for references that don't resolve, or resolve to nothing usable, which
+often explain outages: Services without ready endpoints, unbound claims, released volumes, pods
+referencing missing ConfigMaps or claims, Ingresses routing to missing Services and
+HorizontalPodAutoscalers scaling missing workloads.
+
+Available checks: %s`, strings.Join(names, ", ")),
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			selected := v.GetStringSlice("checks")
+			for _, name := range selected {
+				if !containsString(names, name) {
+					return usererrors.New(usererrors.InvalidArgument, errors.Errorf("unknown check %q, must be one of: %s", name, strings.Join(names, ", ")), "--checks")
+				}
+			}
+
+			clusterData, cleanup, err := loadClusterData(v)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			d, err := loadCheckData(clusterData)
+			if err != nil {
+				return err
+			}
+
+			issues := []checkIssue{}
+			for _, c := range consistencyChecks {
+				if len(selected) > 0 && !containsString(selected, c.Name) {
+					continue
+				}
+				found, err := c.Run(d)
+				if err != nil {
+					return errors.Wrapf(err, "failed to run check %s", c.Name)
+				}
+				for i := range found {
+					found[i].Check = c.Name
+				}
+				issues = append(issues, found...)
+			}
+
+			p, err := newPrinter(os.Stdout)
+			if err != nil {
+				return err
+			}
+			if len(issues) == 0 {
+				fmt.Fprintln(p.Writer(), p.Green("No inconsistencies found"))
+				return nil
+			}
+			return printCheckIssues(p, issues)
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	cmd.Flags().StringSlice("checks", nil, "only run these checks. Defaults to all checks.")
+	return cmd
+}
+
+func loadCheckData(clusterData sbctl.ClusterData) (*checkData, error) {
+	var err error
+	d := &checkData{}
+
+	if d.Pods, err = sbctl.ListTypedResources[corev1.Pod](clusterData, "", "pods"); err != nil {
+		return nil, errors.Wrap(err, "failed to list pods")
+	}
+	if d.Services, err = sbctl.ListTypedResources[corev1.Service](clusterData, "", "services"); err != nil {
+		return nil, errors.Wrap(err, "failed to list services")
+	}
+	if d.Endpoints, err = sbctl.ListTypedResources[corev1.Endpoints](clusterData, "", "endpoints"); err != nil {
+		return nil, errors.Wrap(err, "failed to list endpoints")
+	}
+	if d.PVCs, err = sbctl.ListTypedResources[corev1.PersistentVolumeClaim](clusterData, "", "persistentvolumeclaims"); err != nil {
+		return nil, errors.Wrap(err, "failed to list persistent volume claims")
+	}
+	if d.PVs, err = sbctl.ListTypedResources[corev1.PersistentVolume](clusterData, "", "persistentvolumes"); err != nil {
+		return nil, errors.Wrap(err, "failed to list persistent volumes")
+	}
+	if d.ConfigMaps, err = sbctl.ListTypedResources[corev1.ConfigMap](clusterData, "", "configmaps"); err != nil {
+		return nil, errors.Wrap(err, "failed to list config maps")
+	}
+	if d.Ingresses, err = sbctl.ListTypedResources[networkingv1.Ingress](clusterData, "networking.k8s.io", "ingresses"); err != nil {
+		return nil, errors.Wrap(err, "failed to list ingresses")
+	}
+	if d.HPAs, err = sbctl.ListTypedResources[autoscalingv2.HorizontalPodAutoscaler](clusterData, "autoscaling", "horizontalpodautoscalers"); err != nil {
+		return nil, errors.Wrap(err, "failed to list horizontal pod autoscalers")
+	}
+
+	d.objectExists = func(group string, resource string, namespace string, name string) (bool, error) {
+		items, err := sbctl.ListResources(clusterData, group, resource)
+		if err != nil {
+			return false, err
+		}
+		for _, item := range items {
+			if item.GetNamespace() == namespace && item.GetName() == name {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	return d, nil
+}
+
+// checkServiceEndpoints reports Services with a selector that have no ready endpoints. Bundles
+// without Endpoints fall back to looking for ready pods matching the selector.
+func checkServiceEndpoints(d *checkData) ([]checkIssue, error) {
+	endpoints := map[string]corev1.Endpoints{}
+	for _, e := range d.Endpoints {
+		endpoints[e.Namespace+"/"+e.Name] = e
+	}
+
+	issues := []checkIssue{}
+	for _, svc := range d.Services {
+		if len(svc.Spec.Selector) == 0 || svc.Spec.Type == corev1.ServiceTypeExternalName {
+			continue
+		}
+
+		ready, notReady := 0, 0
+		if e, ok := endpoints[svc.Namespace+"/"+svc.Name]; ok {
+			for _, subset := range e.Subsets {
+				ready += len(subset.Addresses)
+				notReady += len(subset.NotReadyAddresses)
+			}
+		} else if len(d.Endpoints) == 0 {
+			selector := labels.SelectorFromSet(svc.Spec.Selector)
+			for _, p := range d.Pods {
+				if p.Namespace != svc.Namespace || !selector.Matches(labels.Set(p.Labels)) {
+					continue
+				}
+				if isPodReady(p) {
+					ready++
+				} else {
+					notReady++
+				}
+			}
+		}
+
+		if ready > 0 {
+			continue
+		}
+		message := fmt.Sprintf("no pods match selector %s", labels.SelectorFromSet(svc.Spec.Selector))
+		if notReady > 0 {
+			message = fmt.Sprintf("none of %d endpoints are ready", notReady)
+		}
+		issues = append(issues, checkIssue{Kind: "Service", Namespace: svc.Namespace, Name: svc.Name, Message: message})
+	}
+	return issues, nil
+}
+
+func checkPVCsBound(d *checkData) ([]checkIssue, error) {
+	pvs := map[string]bool{}
+	for _, pv := range d.PVs {
+		pvs[pv.Name] = true
+	}
+
+	issues := []checkIssue{}
+	for _, pvc := range d.PVCs {
+		switch {
+		case pvc.Status.Phase != corev1.ClaimBound:
+			issues = append(issues, checkIssue{Kind: "PersistentVolumeClaim", Namespace: pvc.Namespace, Name: pvc.Name,
+				Message: fmt.Sprintf("claim is %s", pvc.Status.Phase)})
+		case len(d.PVs) > 0 && !pvs[pvc.Spec.VolumeName]:
+			issues = append(issues, checkIssue{Kind: "PersistentVolumeClaim", Namespace: pvc.Namespace, Name: pvc.Name,
+				Message: fmt.Sprintf("bound volume %s does not exist", pvc.Spec.VolumeName)})
+		}
+	}
+	return issues, nil
+}
+
+func checkPVsClaimed(d *checkData) ([]checkIssue, error) {
+	issues := []checkIssue{}
+	for _, pv := range d.PVs {
+		if pv.Status.Phase != corev1.VolumeReleased && pv.Status.Phase != corev1.VolumeFailed {
+			continue
+		}
+		message := fmt.Sprintf("volume is %s", pv.Status.Phase)
+		if pv.Spec.ClaimRef != nil {
+			message = fmt.Sprintf("volume is %s, its claim %s/%s was deleted", pv.Status.Phase, pv.Spec.ClaimRef.Namespace, pv.Spec.ClaimRef.Name)
+		}
+		issues = append(issues, checkIssue{Kind: "PersistentVolume", Name: pv.Name, Message: message})
+	}
+	return issues, nil
+}
+
+// checkPodReferences reports pods that reference ConfigMaps or claims that don't exist. Optional
+// references are not reported, since pods start without them.
+func checkPodReferences(d *checkData) ([]checkIssue, error) {
+	configMaps := map[string]bool{}
+	for _, cm := range d.ConfigMaps {
+		configMaps[cm.Namespace+"/"+cm.Name] = true
+	}
+	pvcs := map[string]bool{}
+	for _, pvc := range d.PVCs {
+		pvcs[pvc.Namespace+"/"+pvc.Name] = true
+	}
+
+	issues := []checkIssue{}
+	for _, p := range d.Pods {
+		if isTerminatedPod(p) {
+			continue
+		}
+
+		missing := []string{}
+		missingConfigMap := func(name string, optional *bool) {
+			if len(d.ConfigMaps) > 0 && !configMaps[p.Namespace+"/"+name] && (optional == nil || !*optional) {
+				missing = append(missing, "configmap/"+name)
+			}
+		}
+
+		for _, v := range p.Spec.Volumes {
+			if v.ConfigMap != nil {
+				missingConfigMap(v.ConfigMap.Name, v.ConfigMap.Optional)
+			}
+			if v.PersistentVolumeClaim != nil && len(d.PVCs) > 0 && !pvcs[p.Namespace+"/"+v.PersistentVolumeClaim.ClaimName] {
+				missing = append(missing, "persistentvolumeclaim/"+v.PersistentVolumeClaim.ClaimName)
+			}
+		}
+		for _, c := range append(append([]corev1.Container{}, p.Spec.InitContainers...), p.Spec.Containers...) {
+			for _, e := range c.EnvFrom {
+				if e.ConfigMapRef != nil {
+					missingConfigMap(e.ConfigMapRef.Name, e.ConfigMapRef.Optional)
+				}
+			}
+			for _, e := range c.Env {
+				if e.ValueFrom != nil && e.ValueFrom.ConfigMapKeyRef != nil {
+					missingConfigMap(e.ValueFrom.ConfigMapKeyRef.Name, e.ValueFrom.ConfigMapKeyRef.Optional)
+				}
+			}
+		}
+
+		seen := map[string]bool{}
+		for _, m := range missing {
+			if seen[m] {
+				continue
+			}
+			seen[m] = true
+			issues = append(issues, checkIssue{Kind: "Pod", Namespace: p.Namespace, Name: p.Name, Message: fmt.Sprintf("references missing %s", m)})
+		}
+	}
+	return issues, nil
+}
+
+func checkIngressBackends(d *checkData) ([]checkIssue, error) {
+	services := map[string]bool{}
+	for _, svc := range d.Services {
+		services[svc.Namespace+"/"+svc.Name] = true
+	}
+
+	issues := []checkIssue{}
+	for _, ing := range d.Ingresses {
+		backends := []*networkingv1.IngressBackend{}
+		if ing.Spec.DefaultBackend != nil {
+			backends = append(backends, ing.Spec.DefaultBackend)
+		}
+		for _, rule := range ing.Spec.Rules {
+			if rule.HTTP == nil {
+				continue
+			}
+			for i := range rule.HTTP.Paths {
+				backends = append(backends, &rule.HTTP.Paths[i].Backend)
+			}
+		}
+
+		seen := map[string]bool{}
+		for _, b := range backends {
+			if b.Service == nil || services[ing.Namespace+"/"+b.Service.Name] || seen[b.Service.Name] {
+				continue
+			}
+			seen[b.Service.Name] = true
+			issues = append(issues, checkIssue{Kind: "Ingress", Namespace: ing.Namespace, Name: ing.Name,
+				Message: fmt.Sprintf("routes to missing service %s", b.Service.Name)})
+		}
+	}
+	return issues, nil
+}
+
+func checkHPATargets(d *checkData) ([]checkIssue, error) {
+	issues := []checkIssue{}
+	for _, hpa := range d.HPAs {
+		ref := hpa.Spec.ScaleTargetRef
+		gv, err := schema.ParseGroupVersion(ref.APIVersion)
+		if err != nil {
+			continue
+		}
+
+		resource := strings.ToLower(ref.Kind) + "s"
+		exists, err := d.objectExists(gv.Group, resource, hpa.Namespace, ref.Name)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			issues = append(issues, checkIssue{Kind: "HorizontalPodAutoscaler", Namespace: hpa.Namespace, Name: hpa.Name,
+				Message: fmt.Sprintf("scale target %s/%s does not exist", ref.Kind, ref.Name)})
+			continue
+		}
+
+		for _, c := range hpa.Status.Conditions {
+			if c.Type == autoscalingv2.ScalingActive && c.Status == corev1.ConditionFalse {
+				issues = append(issues, checkIssue{Kind: "HorizontalPodAutoscaler", Namespace: hpa.Namespace, Name: hpa.Name,
+					Message: fmt.Sprintf("not scaling: %s: %s", c.Reason, c.Message)})
+			}
+		}
+	}
+	return issues, nil
+}
+
+func printCheckIssues(p *output.Printer, issues []checkIssue) error {
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].Check != issues[j].Check {
+			return issues[i].Check < issues[j].Check
+		}
+		if issues[i].Namespace != issues[j].Namespace {
+			return issues[i].Namespace < issues[j].Namespace
+		}
+		return issues[i].Name < issues[j].Name
+	})
+
+	t := p.NewTable("CHECK", "KIND", "NAMESPACE", "NAME", "MESSAGE")
+	for _, i := range issues {
+		t.AddRow(i.Check, i.Kind, valueOrNone(i.Namespace), i.Name, i.Message)
+	}
+	if err := t.Print(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(p.Writer(), "\n%s\n", p.Yellow(fmt.Sprintf("%d inconsistencies found", len(issues))))
+	return err
+}
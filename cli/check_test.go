@@ -0,0 +1,235 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+)
+
+// fixtureList returns a list of items as troubleshoot stores it in bundles
+func fixtureList(apiVersion string, kind string, items ...string) string {
+	return fmt.Sprintf(`{"apiVersion": %q, "kind": %q, "items": [%s]}`, apiVersion, kind+"List", strings.Join(items, ","))
+}
+
+// runCheck writes files to the cluster resources of a test bundle and runs a check against it
+func runCheck(check func(d *checkData) ([]checkIssue, error), files map[string]string) []checkIssue {
+	dir := GinkgoT().TempDir()
+	for name, data := range files {
+		writeClusterResource(dir, name, data)
+	}
+
+	clusterData, err := sbctl.FindClusterData(dir)
+	Expect(err).NotTo(HaveOccurred())
+	d, err := loadCheckData(clusterData)
+	Expect(err).NotTo(HaveOccurred())
+	issues, err := check(d)
+	Expect(err).NotTo(HaveOccurred())
+	return issues
+}
+
+func issueMessages(issues []checkIssue) []string {
+	messages := []string{}
+	for _, i := range issues {
+		messages = append(messages, fmt.Sprintf("%s %s/%s: %s", i.Kind, i.Namespace, i.Name, i.Message))
+	}
+	return messages
+}
+
+var _ = Describe("Consistency checks", func() {
+	webService := `{"metadata": {"name": "web", "namespace": "default"}, "spec": {"selector": {"app": "web"}}}`
+
+	Describe("service-endpoints", func() {
+		It("Passes services with ready endpoints", func() {
+			issues := runCheck(checkServiceEndpoints, map[string]string{
+				"services/default.json": fixtureList("v1", "Service", webService),
+				"endpoints/default.json": fixtureList("v1", "Endpoints",
+					`{"metadata": {"name": "web", "namespace": "default"}, "subsets": [{"addresses": [{"ip": "10.0.0.1"}]}]}`),
+			})
+			Expect(issues).To(BeEmpty())
+		})
+
+		It("Reports services without ready endpoints", func() {
+			issues := runCheck(checkServiceEndpoints, map[string]string{
+				"services/default.json": fixtureList("v1", "Service", webService),
+				"endpoints/default.json": fixtureList("v1", "Endpoints",
+					`{"metadata": {"name": "web", "namespace": "default"}, "subsets": [{"notReadyAddresses": [{"ip": "10.0.0.1"}, {"ip": "10.0.0.2"}]}]}`),
+			})
+			Expect(issueMessages(issues)).To(ConsistOf("Service default/web: none of 2 endpoints are ready"))
+		})
+
+		It("Falls back to pods matching the selector without endpoints", func() {
+			issues := runCheck(checkServiceEndpoints, map[string]string{
+				"services/default.json": fixtureList("v1", "Service", webService,
+					`{"metadata": {"name": "api", "namespace": "default"}, "spec": {"selector": {"app": "api"}}}`),
+				"pods/default.json": fixtureList("v1", "Pod",
+					`{"metadata": {"name": "web-0", "namespace": "default", "labels": {"app": "web"}}, "status": {"conditions": [{"type": "Ready", "status": "True"}]}}`),
+			})
+			Expect(issueMessages(issues)).To(ConsistOf("Service default/api: no pods match selector app=api"))
+		})
+	})
+
+	Describe("pvc-bound", func() {
+		pv := `{"metadata": {"name": "pv-1"}, "status": {"phase": "Bound"}}`
+
+		It("Passes claims bound to existing volumes", func() {
+			issues := runCheck(checkPVCsBound, map[string]string{
+				"pvcs/default.json": fixtureList("v1", "PersistentVolumeClaim",
+					`{"metadata": {"name": "data", "namespace": "default"}, "spec": {"volumeName": "pv-1"}, "status": {"phase": "Bound"}}`),
+				"pvs.json": fixtureList("v1", "PersistentVolume", pv),
+			})
+			Expect(issues).To(BeEmpty())
+		})
+
+		It("Reports unbound claims and claims bound to missing volumes", func() {
+			issues := runCheck(checkPVCsBound, map[string]string{
+				"pvcs/default.json": fixtureList("v1", "PersistentVolumeClaim",
+					`{"metadata": {"name": "data", "namespace": "default"}, "status": {"phase": "Pending"}}`,
+					`{"metadata": {"name": "logs", "namespace": "default"}, "spec": {"volumeName": "pv-2"}, "status": {"phase": "Bound"}}`),
+				"pvs.json": fixtureList("v1", "PersistentVolume", pv),
+			})
+			Expect(issueMessages(issues)).To(ConsistOf(
+				"PersistentVolumeClaim default/data: claim is Pending",
+				"PersistentVolumeClaim default/logs: bound volume pv-2 does not exist",
+			))
+		})
+	})
+
+	Describe("pv-claimed", func() {
+		It("Passes bound and available volumes", func() {
+			issues := runCheck(checkPVsClaimed, map[string]string{
+				"pvs.json": fixtureList("v1", "PersistentVolume",
+					`{"metadata": {"name": "pv-1"}, "status": {"phase": "Bound"}}`,
+					`{"metadata": {"name": "pv-2"}, "status": {"phase": "Available"}}`),
+			})
+			Expect(issues).To(BeEmpty())
+		})
+
+		It("Reports released and failed volumes", func() {
+			issues := runCheck(checkPVsClaimed, map[string]string{
+				"pvs.json": fixtureList("v1", "PersistentVolume",
+					`{"metadata": {"name": "pv-1"}, "spec": {"claimRef": {"namespace": "default", "name": "data"}}, "status": {"phase": "Released"}}`,
+					`{"metadata": {"name": "pv-2"}, "status": {"phase": "Failed"}}`),
+			})
+			Expect(issueMessages(issues)).To(ConsistOf(
+				"PersistentVolume /pv-1: volume is Released, its claim default/data was deleted",
+				"PersistentVolume /pv-2: volume is Failed",
+			))
+		})
+	})
+
+	Describe("pod-references", func() {
+		files := func(pod string) map[string]string {
+			return map[string]string{
+				"pods/default.json":       fixtureList("v1", "Pod", pod),
+				"configmaps/default.json": fixtureList("v1", "ConfigMap", `{"metadata": {"name": "settings", "namespace": "default"}}`),
+				"pvcs/default.json": fixtureList("v1", "PersistentVolumeClaim",
+					`{"metadata": {"name": "data", "namespace": "default"}, "status": {"phase": "Bound"}}`),
+			}
+		}
+
+		It("Passes pods whose references exist or are optional", func() {
+			issues := runCheck(checkPodReferences, files(`{
+				"metadata": {"name": "web-0", "namespace": "default"},
+				"spec": {
+					"volumes": [
+						{"name": "settings", "configMap": {"name": "settings"}},
+						{"name": "data", "persistentVolumeClaim": {"claimName": "data"}},
+						{"name": "extra", "configMap": {"name": "extra", "optional": true}}
+					],
+					"containers": [{"name": "web", "envFrom": [{"configMapRef": {"name": "settings"}}]}]
+				},
+				"status": {"phase": "Running"}
+			}`))
+			Expect(issues).To(BeEmpty())
+		})
+
+		It("Reports each missing reference of running pods once", func() {
+			issues := runCheck(checkPodReferences, files(`{
+				"metadata": {"name": "web-0", "namespace": "default"},
+				"spec": {
+					"volumes": [
+						{"name": "settings", "configMap": {"name": "old-settings"}},
+						{"name": "data", "persistentVolumeClaim": {"claimName": "old-data"}}
+					],
+					"containers": [{"name": "web", "env": [{"name": "MODE", "valueFrom": {"configMapKeyRef": {"name": "old-settings", "key": "mode"}}}]}]
+				},
+				"status": {"phase": "Running"}
+			}`))
+			Expect(issueMessages(issues)).To(ConsistOf(
+				"Pod default/web-0: references missing configmap/old-settings",
+				"Pod default/web-0: references missing persistentvolumeclaim/old-data",
+			))
+		})
+	})
+
+	Describe("ingress-backends", func() {
+		It("Passes ingresses that route to existing services", func() {
+			issues := runCheck(checkIngressBackends, map[string]string{
+				"services/default.json": fixtureList("v1", "Service", webService),
+				"ingress/default.json": fixtureList("networking.k8s.io/v1", "Ingress", `{
+					"metadata": {"name": "web", "namespace": "default"},
+					"spec": {"rules": [{"http": {"paths": [{"path": "/", "pathType": "Prefix", "backend": {"service": {"name": "web", "port": {"number": 80}}}}]}}]}
+				}`),
+			})
+			Expect(issues).To(BeEmpty())
+		})
+
+		It("Reports each missing service once", func() {
+			issues := runCheck(checkIngressBackends, map[string]string{
+				"services/default.json": fixtureList("v1", "Service", webService),
+				"ingress/default.json": fixtureList("networking.k8s.io/v1", "Ingress", `{
+					"metadata": {"name": "web", "namespace": "default"},
+					"spec": {
+						"defaultBackend": {"service": {"name": "old", "port": {"number": 80}}},
+						"rules": [{"http": {"paths": [
+							{"path": "/", "pathType": "Prefix", "backend": {"service": {"name": "web", "port": {"number": 80}}}},
+							{"path": "/old", "pathType": "Prefix", "backend": {"service": {"name": "old", "port": {"number": 80}}}}
+						]}}]
+					}
+				}`),
+			})
+			Expect(issueMessages(issues)).To(ConsistOf("Ingress default/web: routes to missing service old"))
+		})
+	})
+
+	Describe("hpa-targets", func() {
+		hpa := func(target string, conditions string) string {
+			return fmt.Sprintf(`{
+				"metadata": {"name": "web", "namespace": "default"},
+				"spec": {"scaleTargetRef": {"apiVersion": "apps/v1", "kind": "Deployment", "name": %q}, "maxReplicas": 3},
+				"status": {"conditions": [%s]}
+			}`, target, conditions)
+		}
+		deployments := fixtureList("apps/v1", "Deployment", `{"metadata": {"name": "web", "namespace": "default"}}`)
+
+		It("Passes autoscalers of existing workloads that are scaling", func() {
+			issues := runCheck(checkHPATargets, map[string]string{
+				"deployments/default.json": deployments,
+				"horizontalpodautoscalers/default.json": fixtureList("autoscaling/v2", "HorizontalPodAutoscaler",
+					hpa("web", `{"type": "ScalingActive", "status": "True"}`)),
+			})
+			Expect(issues).To(BeEmpty())
+		})
+
+		It("Reports missing targets", func() {
+			issues := runCheck(checkHPATargets, map[string]string{
+				"deployments/default.json": deployments,
+				"horizontalpodautoscalers/default.json": fixtureList("autoscaling/v2", "HorizontalPodAutoscaler",
+					hpa("api", `{"type": "ScalingActive", "status": "True"}`)),
+			})
+			Expect(issueMessages(issues)).To(ConsistOf("HorizontalPodAutoscaler default/web: scale target Deployment/api does not exist"))
+		})
+
+		It("Reports autoscalers that are not scaling", func() {
+			issues := runCheck(checkHPATargets, map[string]string{
+				"deployments/default.json": deployments,
+				"horizontalpodautoscalers/default.json": fixtureList("autoscaling/v2", "HorizontalPodAutoscaler",
+					hpa("web", `{"type": "ScalingActive", "status": "False", "reason": "FailedGetResourceMetric", "message": "no metrics"}`)),
+			})
+			Expect(issueMessages(issues)).To(ConsistOf("HorizontalPodAutoscaler default/web: not scaling: FailedGetResourceMetric: no metrics"))
+		})
+	})
+})
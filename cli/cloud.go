@@ -0,0 +1,203 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/output"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func CloudCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cloud",
+		Short: "Correlate nodes and services with the cloud resources behind them",
+		Long: `Correlate nodes and services with the cloud resources behind them.
+
+Bundles can include the output of cloud collectors, such as the instance metadata of AWS, GCP and
+Azure VMs, and load balancer descriptions from aws elbv2 describe-load-balancers, gcloud compute
+forwarding-rules list or az network lb list. These files are found by their content anywhere
+outside cluster-resources, and matched with nodes by provider ID or internal IP, and with
+Services of type LoadBalancer by the hostname or IP in their status.`,
+	}
+	cmd.AddCommand(cloudNodesCmd())
+	cmd.AddCommand(cloudServicesCmd())
+	return cmd
+}
+
+func cloudNodesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:           "nodes",
+		Short:         "Show the cloud instance each node runs on",
+		Example:       `  sbctl cloud nodes -s ./support-bundle.tar.gz`,
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			format, err := cloudFormat(v)
+			if err != nil {
+				return err
+			}
+
+			clusterData, cleanup, err := loadClusterData(v)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			cloud, err := sbctl.FindCloudData(clusterData)
+			if err != nil {
+				return errors.Wrap(err, "failed to read cloud metadata")
+			}
+			nodes, err := sbctl.ListTypedResources[corev1.Node](clusterData, "", "nodes")
+			if err != nil {
+				return errors.Wrap(err, "failed to list nodes")
+			}
+
+			resources := sbctl.CorrelateNodes(nodes, cloud)
+			if format == "json" {
+				return printCloudJSON(resources)
+			}
+			if len(cloud.Instances) == 0 {
+				fmt.Fprintln(os.Stderr, "No instance metadata found in the support bundle, showing what nodes report")
+			}
+
+			p, err := newPrinter(os.Stdout)
+			if err != nil {
+				return err
+			}
+			t := p.NewTable("NODE", "PROVIDER", "INSTANCE", "TYPE", "ZONE", "METADATA")
+			for _, r := range resources {
+				metadata := p.Faint("<none>")
+				if r.Metadata != nil {
+					metadata = r.Metadata.File
+				}
+				t.AddRow(r.Node, valueOrNone(r.Provider), valueOrNone(r.Instance), valueOrNone(r.Type), valueOrNone(r.Zone), metadata)
+			}
+			return t.Print()
+		},
+	}
+
+	addCloudFlags(cmd)
+	return cmd
+}
+
+func cloudServicesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:           "services",
+		Short:         "Show the cloud load balancer of each Service of type LoadBalancer",
+		Example:       `  sbctl cloud services -s ./support-bundle.tar.gz -n ingress-nginx`,
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			format, err := cloudFormat(v)
+			if err != nil {
+				return err
+			}
+
+			clusterData, cleanup, err := loadClusterData(v)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			cloud, err := sbctl.FindCloudData(clusterData)
+			if err != nil {
+				return errors.Wrap(err, "failed to read cloud metadata")
+			}
+			services, err := sbctl.ListTypedResources[corev1.Service](clusterData, "", "services")
+			if err != nil {
+				return errors.Wrap(err, "failed to list services")
+			}
+			if namespace := v.GetString("namespace"); namespace != "" {
+				filtered := []corev1.Service{}
+				for _, svc := range services {
+					if svc.Namespace == namespace {
+						filtered = append(filtered, svc)
+					}
+				}
+				services = filtered
+			}
+
+			resources := sbctl.CorrelateServices(services, cloud)
+			if format == "json" {
+				return printCloudJSON(resources)
+			}
+			if len(resources) == 0 {
+				fmt.Fprintln(os.Stderr, "No Services of type LoadBalancer found in the support bundle")
+				return nil
+			}
+			if len(cloud.LoadBalancers) == 0 {
+				fmt.Fprintln(os.Stderr, "No load balancer descriptions found in the support bundle, showing what services report")
+			}
+
+			p, err := newPrinter(os.Stdout)
+			if err != nil {
+				return err
+			}
+			return printCloudServices(p, resources)
+		},
+	}
+
+	addCloudFlags(cmd)
+	cmd.Flags().StringP("namespace", "n", "", "only show services in this namespace")
+	return cmd
+}
+
+func printCloudServices(p *output.Printer, resources []sbctl.ServiceCloudResource) error {
+	t := p.NewTable("NAMESPACE", "NAME", "EXTERNAL", "LOAD BALANCER", "TYPE", "STATE", "METADATA")
+	for _, r := range resources {
+		external := p.Yellow("<pending>")
+		if len(r.Ingress) > 0 {
+			external = strings.Join(r.Ingress, ",")
+		}
+		if r.LoadBalancer == nil {
+			t.AddRow(r.Namespace, r.Name, external, p.Faint("<none>"), "", "", "")
+			continue
+		}
+		lb := r.LoadBalancer
+		t.AddRow(r.Namespace, r.Name, external, lb.Name, valueOrNone(lb.Type), p.Status(valueOrNone(lb.State)), lb.File)
+	}
+	return t.Print()
+}
+
+func cloudFormat(v *viper.Viper) (string, error) {
+	format := v.GetString("format")
+	if format != "table" && format != "json" {
+		return "", usererrors.New(usererrors.InvalidArgument, errors.Errorf("unsupported format %q, must be one of: table, json", format), "--format")
+	}
+	return format, nil
+}
+
+func printCloudJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return errors.Wrap(err, "failed to write output")
+	}
+	return nil
+}
+
+func addCloudFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	cmd.Flags().String("format", "table", "output format. One of: table, json")
+}
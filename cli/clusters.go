@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func ClustersCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "clusters [bundle]",
+		Short: "List the clusters of a bundle collected from several clusters",
+		Long: `List the clusters of a bundle collected from several clusters.
+
+Fleet bundles have a cluster-resources directory for each cluster, e.g. one for a management
+cluster and one below it for each of its workload clusters. serve exposes each cluster as a
+kubeconfig context with the name listed here. The cluster at the top of the bundle is named
+default.`,
+		Example:       `  sbctl clusters ./fleet-bundle.tar.gz`,
+		Args:          cobra.MaximumNArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+			if len(args) == 1 {
+				v.Set("support-bundle-location", args[0])
+			}
+
+			clusterData, cleanup, err := loadClusterData(v)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			clusters, err := fleetClusters(clusterData)
+			if err != nil {
+				return err
+			}
+			if len(clusters) == 0 {
+				clusters = []sbctl.FleetCluster{{Name: sbctl.DefaultClusterName, ClusterData: clusterData}}
+			}
+
+			p, err := newPrinter(os.Stdout)
+			if err != nil {
+				return err
+			}
+			t := p.NewTable("CONTEXT", "VERSION", "NODES", "NAMESPACES", "PATH")
+			for _, c := range clusters {
+				nodes, err := sbctl.ListResources(c.ClusterData, "", "nodes")
+				if err != nil {
+					return errors.Wrapf(err, "failed to list nodes of %s", c.Name)
+				}
+				namespaces, err := sbctl.ListResources(c.ClusterData, "", "namespaces")
+				if err != nil {
+					return errors.Wrapf(err, "failed to list namespaces of %s", c.Name)
+				}
+				path := "."
+				if clusterData.BundleDir != "" {
+					if rel, err := filepath.Rel(clusterData.BundleDir, filepath.Dir(c.ClusterData.ClusterResourcesDir)); err == nil {
+						path = filepath.ToSlash(rel)
+					}
+				}
+				t.AddRow(c.Name, clusterVersion(c.ClusterData), fmt.Sprint(len(nodes)), fmt.Sprint(len(namespaces)), path)
+			}
+			return t.Print()
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	return cmd
+}
+
+// fleetClusters returns the clusters of a bundle, or none when it was converted or is still
+// being collected, which are served as one cluster
+func fleetClusters(clusterData sbctl.ClusterData) ([]sbctl.FleetCluster, error) {
+	if clusterData.BundleDir == "" || clusterData.ClusterResourcesDir == "" {
+		return nil, nil
+	}
+	clusters, err := sbctl.FindFleetClusters(clusterData.BundleDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find clusters")
+	}
+	return clusters, nil
+}
@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func CollectCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "collect [spec] [flags] [-- support-bundle args]",
+		Short: "Collect a support bundle and open a shell for it",
+		Long: `Collect a support bundle and open a shell for it.
+
+The troubleshoot support-bundle CLI is run with the given spec, which can be a file, URL or
+secret reference, and the resulting bundle is opened with "sbctl shell" once collection is
+complete. The bundle is kept after the shell exits. Arguments after "--" are passed to
+support-bundle as is.`,
+		Example:       `  sbctl collect ./support-bundle.yaml --kubeconfig ~/.kube/config -- --namespace app`,
+		Args:          cobra.MinimumNArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			supportBundlePath, err := findSupportBundleBinary(v.GetString("support-bundle-path"))
+			if err != nil {
+				return err
+			}
+
+			output := v.GetString("output")
+			if output == "" {
+				output = fmt.Sprintf("support-bundle-%s.tar.gz", time.Now().Format("2006-01-02T15_04_05"))
+			}
+
+			collectArgs := []string{args[0], "--interactive=false", "--output", output}
+			if kubeConfig := v.GetString("kubeconfig"); kubeConfig != "" {
+				collectArgs = append(collectArgs, "--kubeconfig", kubeConfig)
+			}
+			collectArgs = append(collectArgs, args[1:]...)
+
+			collect := exec.Command(supportBundlePath, collectArgs...)
+			collect.Stdin = os.Stdin
+			collect.Stdout = os.Stdout
+			collect.Stderr = os.Stderr
+			if err := collect.Run(); err != nil {
+				return errors.Wrap(err, "failed to collect support bundle")
+			}
+
+			if _, err := os.Stat(output); err != nil {
+				return errors.Wrapf(err, "support bundle %s was not created", output)
+			}
+			fmt.Printf("Support bundle saved to %s\n", output)
+
+			shell := ShellCmd()
+			shell.SetArgs([]string{"--support-bundle-location", output})
+			return shell.Execute()
+		},
+	}
+
+	cmd.Flags().String("kubeconfig", "", "kubeconfig of the cluster to collect from. Defaults to the support-bundle default.")
+	cmd.Flags().StringP("output", "o", "", "path to save the support bundle to. Defaults to a timestamped file in the current directory.")
+	cmd.Flags().String("support-bundle-path", "", "path to the support-bundle binary. Defaults to support-bundle or kubectl-support_bundle in PATH.")
+	return cmd
+}
+
+// findSupportBundleBinary returns the support-bundle CLI, which is also distributed as a kubectl plugin
+func findSupportBundleBinary(path string) (string, error) {
+	if path != "" {
+		if !fileExists(path) {
+			return "", errors.Errorf("support-bundle not found at %s", path)
+		}
+		return path, nil
+	}
+
+	for _, name := range []string{"support-bundle", "kubectl-support_bundle"} {
+		if p, err := exec.LookPath(name); err == nil {
+			return p, nil
+		}
+	}
+
+	return "", errors.New("support-bundle not found in PATH, install it from https://troubleshoot.sh or set --support-bundle-path")
+}
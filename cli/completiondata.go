@@ -0,0 +1,155 @@
+package cli
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// completionData is a compact index of a bundle for external tools. Its fields are only added to,
+// so tools can rely on them.
+type completionData struct {
+	Namespaces []string               `json:"namespaces"`
+	Kinds      []completionDataKind   `json:"kinds"`
+	Objects    []completionDataObject `json:"objects"`
+}
+
+type completionDataKind struct {
+	Group      string   `json:"group,omitempty"`
+	Version    string   `json:"version"`
+	Resource   string   `json:"resource"`
+	Kind       string   `json:"kind"`
+	Namespaced bool     `json:"namespaced"`
+	ShortNames []string `json:"shortNames,omitempty"`
+	Count      int      `json:"count"`
+}
+
+type completionDataObject struct {
+	Group     string `json:"group,omitempty"`
+	Resource  string `json:"resource"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	// File is relative to the root of the bundle
+	File string `json:"file"`
+}
+
+func CompletionDataCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "completion-data",
+		Short: "Print a JSON index of the objects in a support bundle",
+		Long: `Print a JSON index of the objects in a support bundle.
+
+The index lists the namespaces, the kinds of collected objects, and every object with the file it
+is stored in, relative to the root of the bundle. It is meant for external tools such as fuzzy
+finder scripts to build their own navigation on top of bundles.`,
+		Example:       `  sbctl completion-data -s ./support-bundle.tar.gz | jq -r '.objects[] | "\(.kind)/\(.name)"' | fzf`,
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			clusterData, cleanup, err := loadClusterData(v)
+			defer cleanup()
+			if err != nil {
+				return err
+			}
+
+			data, err := buildCompletionData(clusterData)
+			if err != nil {
+				return err
+			}
+			return writeCompletionData(os.Stdout, data, v.GetBool("pretty"))
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	cmd.Flags().Bool("pretty", false, "indent the JSON output")
+	return cmd
+}
+
+// buildCompletionData reads every resource listed in resources.json. Resources served in several
+// versions are only listed once.
+func buildCompletionData(clusterData sbctl.ClusterData) (*completionData, error) {
+	resources, err := sbctl.ListCollectedResources(clusterData)
+	if err != nil {
+		return nil, err
+	}
+
+	bundleRoot := filepath.Dir(clusterData.ClusterResourcesDir)
+	data := &completionData{
+		Namespaces: []string{},
+		Kinds:      []completionDataKind{},
+		Objects:    []completionDataObject{},
+	}
+	namespaces := map[string]bool{}
+	for _, r := range resources {
+		if len(r.Items) == 0 {
+			continue
+		}
+		data.Kinds = append(data.Kinds, completionDataKind{
+			Group:      r.Group,
+			Version:    r.Version,
+			Resource:   r.Resource,
+			Kind:       r.Kind,
+			Namespaced: r.Namespaced,
+			ShortNames: r.ShortNames,
+			Count:      len(r.Items),
+		})
+
+		for i, item := range r.Items {
+			file, err := filepath.Rel(bundleRoot, r.Files[i])
+			if err != nil {
+				file = r.Files[i]
+			}
+			if item.GetNamespace() != "" {
+				namespaces[item.GetNamespace()] = true
+			}
+			data.Objects = append(data.Objects, completionDataObject{
+				Group:     r.Group,
+				Resource:  r.Resource,
+				Kind:      r.Kind,
+				Namespace: item.GetNamespace(),
+				Name:      item.GetName(),
+				File:      filepath.ToSlash(file),
+			})
+		}
+	}
+
+	for namespace := range namespaces {
+		data.Namespaces = append(data.Namespaces, namespace)
+	}
+	sort.Strings(data.Namespaces)
+	sort.SliceStable(data.Objects, func(i, j int) bool {
+		a, b := data.Objects[i], data.Objects[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+
+	return data, nil
+}
+
+func writeCompletionData(out io.Writer, data *completionData, pretty bool) error {
+	encoder := json.NewEncoder(out)
+	if pretty {
+		encoder.SetIndent("", "  ")
+	}
+	return errors.Wrap(encoder.Encode(data), "failed to write completion data")
+}
@@ -0,0 +1,38 @@
+package cli
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Completion data", func() {
+	It("Lists the kinds and objects of the test bundle with their files", func() {
+		data, err := buildCompletionData(testBundleData())
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(data.Namespaces).To(ContainElements("default", "kube-system", "velero"))
+
+		kinds := map[string]completionDataKind{}
+		for _, kind := range data.Kinds {
+			Expect(kind.Count).To(BeNumerically(">", 0), kind.Kind)
+			kinds[kind.Resource] = kind
+		}
+		Expect(kinds["pods"]).To(Equal(completionDataKind{Version: "v1", Resource: "pods", Kind: "Pod", Namespaced: true, ShortNames: []string{"po"}, Count: 58}))
+		Expect(kinds["namespaces"].Count).To(Equal(9))
+		Expect(kinds["deployments"].Group).To(Equal("apps"))
+
+		Expect(data.Objects).To(ContainElement(completionDataObject{
+			Resource:  "pods",
+			Kind:      "Pod",
+			Namespace: "velero",
+			Name:      "velero-6796549f-5j2vv",
+			File:      "cluster-resources/pods/velero.json",
+		}))
+		Expect(data.Objects).To(ContainElement(completionDataObject{
+			Resource: "namespaces",
+			Kind:     "Namespace",
+			Name:     "kube-system",
+			File:     "cluster-resources/namespaces.json",
+		}))
+	})
+})
@@ -0,0 +1,187 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/api"
+	"github.com/replicatedhq/sbctl/pkg/output"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// crashLoop is a container in CrashLoopBackOff with the last lines of the log of its crashed run
+type crashLoop struct {
+	sbctl.CrashLoop
+	Logs []string `json:"logs"`
+}
+
+func CrashLoopsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "crashloops",
+		Short: "Triage containers in CrashLoopBackOff",
+		Long: `Triage containers in CrashLoopBackOff.
+
+Containers are listed most restarted first, with the reason and exit code their last run
+terminated with, the warning events of their pods such as failed probes, and the last lines of the
+log of their last run, which is the previous log of the container when it was collected.`,
+		Example: `  sbctl crashloops -s ./support-bundle.tar.gz
+  sbctl crashloops -n velero --tail 50`,
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			format := v.GetString("format")
+			if format != "text" && format != "json" {
+				return usererrors.New(usererrors.InvalidArgument, errors.Errorf("unsupported format %q, must be one of: text, json", format), "--format")
+			}
+			tail := v.GetInt("tail")
+			if tail < 0 {
+				return usererrors.New(usererrors.InvalidArgument, errors.Errorf("invalid --tail %d, must not be negative", tail), "--tail")
+			}
+
+			clusterData, cleanup, err := loadClusterData(v)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			found, err := sbctl.FindCrashLoops(clusterData)
+			if err != nil {
+				return err
+			}
+
+			namespace := v.GetString("namespace")
+			crashLoops := []crashLoop{}
+			for _, c := range found {
+				if namespace != "" && c.Namespace != namespace {
+					continue
+				}
+				logs, err := tailCrashLoopLog(clusterData, c.LogFile, tail)
+				if err != nil {
+					return err
+				}
+				crashLoops = append(crashLoops, crashLoop{CrashLoop: c, Logs: logs})
+			}
+
+			if format == "json" {
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				if err := encoder.Encode(crashLoops); err != nil {
+					return errors.Wrap(err, "failed to write results")
+				}
+				return nil
+			}
+
+			p, err := newPrinter(os.Stdout)
+			if err != nil {
+				return err
+			}
+			if len(crashLoops) == 0 {
+				fmt.Fprintln(p.Writer(), p.Green("No containers in CrashLoopBackOff"))
+				return nil
+			}
+
+			events, err := sbctl.ListResources(clusterData, "", "events")
+			if err != nil {
+				return errors.Wrap(err, "failed to list events")
+			}
+			tf, err := newTimeFormat(v, bundleCollectionTime(events))
+			if err != nil {
+				return err
+			}
+			printCrashLoops(p, crashLoops, tf)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	cmd.Flags().StringP("namespace", "n", "", "only list containers in this namespace")
+	cmd.Flags().Int("tail", 10, "number of lines of the log of the last run to print")
+	cmd.Flags().String("format", "text", "output format. One of: text, json")
+	return cmd
+}
+
+// tailCrashLoopLog returns the last lines of a log relative to the cluster resources directory
+func tailCrashLoopLog(clusterData sbctl.ClusterData, logFile string, tail int) ([]string, error) {
+	lines := []string{}
+	if logFile == "" || tail == 0 {
+		return lines, nil
+	}
+
+	opts := api.NewLogOptions()
+	opts.TailLines = int64(tail)
+	f, err := api.OpenLog(filepath.Join(clusterData.ClusterResourcesDir, filepath.FromSlash(logFile)), opts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open %s", logFile)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", logFile)
+	}
+	return lines, nil
+}
+
+func printCrashLoops(p *output.Printer, crashLoops []crashLoop, tf timeFormat) {
+	out := p.Writer()
+	for i, c := range crashLoops {
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		fmt.Fprintf(out, "%s %s\n", p.Bold(fmt.Sprintf("%s/%s", c.Namespace, c.Pod)), c.Container)
+		fmt.Fprintf(out, "  Node:        %s\n", valueOrNone(c.Node))
+		fmt.Fprintf(out, "  Restarts:    %d\n", c.Restarts)
+
+		last := "<none>"
+		if c.LastReason != "" || !c.LastFinished.IsZero() {
+			last = fmt.Sprintf("%s, exit code %d", valueOrNone(c.LastReason), c.LastExitCode)
+			if c.LastSignal != 0 {
+				last += fmt.Sprintf(", signal %d", c.LastSignal)
+			}
+			last = fmt.Sprintf("%s at %s", p.Red(last), tf.Format(c.LastFinished))
+		}
+		fmt.Fprintf(out, "  Last state:  %s\n", last)
+		if c.LastMessage != "" {
+			fmt.Fprintf(out, "  Message:     %s\n", strings.TrimSpace(c.LastMessage))
+		}
+
+		for j, e := range c.Events {
+			label := ""
+			if j == 0 {
+				label = "Events:"
+			}
+			fmt.Fprintf(out, "  %-12s %s x%d: %s\n", label, p.Yellow(e.Reason), e.Count, e.Message)
+		}
+
+		if c.LogFile == "" {
+			fmt.Fprintf(out, "  %s\n", p.Faint("No logs collected"))
+			continue
+		}
+		if len(c.Logs) == 0 {
+			continue
+		}
+		fmt.Fprintf(out, "  Last %d lines of %s:\n", len(c.Logs), c.LogFile)
+		for _, line := range c.Logs {
+			fmt.Fprintf(out, "    %s\n", p.Faint(line))
+		}
+	}
+}
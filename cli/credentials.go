@@ -0,0 +1,148 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// tokenExpiryLeeway refreshes access tokens shortly before they expire, so they do not expire
+// while a bundle is downloaded
+const tokenExpiryLeeway = time.Minute
+
+// portalCredentials are the tokens of a vendor portal logged in to with sbctl login. The issuer
+// and client ID are kept to refresh the access token.
+type portalCredentials struct {
+	Issuer       string    `json:"issuer"`
+	ClientID     string    `json:"clientId"`
+	AccessToken  string    `json:"accessToken"`
+	RefreshToken string    `json:"refreshToken,omitempty"`
+	Expiry       time.Time `json:"expiry,omitempty"`
+}
+
+type credentialsFile struct {
+	Portals map[string]portalCredentials `json:"portals"`
+}
+
+// credentialsFileName is where portal credentials are cached. The file is only readable by the
+// user, as kubectl and cloud CLIs do with their credentials.
+func credentialsFileName() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get config dir")
+	}
+	return filepath.Join(configDir, "sbctl", "credentials.json"), nil
+}
+
+// portalKey returns the host credentials of a portal are cached for, so that every bundle URL of
+// a portal uses the same credentials
+func portalKey(portalURL string) (string, error) {
+	parsed, err := url.Parse(portalURL)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to parse portal url")
+	}
+	if parsed.Host == "" {
+		return "", errors.Errorf("%q is not a portal url", portalURL)
+	}
+	return parsed.Host, nil
+}
+
+func readCredentials() (credentialsFile, error) {
+	creds := credentialsFile{Portals: map[string]portalCredentials{}}
+
+	fileName, err := credentialsFileName()
+	if err != nil {
+		return creds, err
+	}
+	data, err := os.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return creds, nil
+	}
+	if err != nil {
+		return creds, errors.Wrap(err, "failed to read credentials")
+	}
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return creds, errors.Wrapf(err, "failed to parse %s", fileName)
+	}
+	if creds.Portals == nil {
+		creds.Portals = map[string]portalCredentials{}
+	}
+	return creds, nil
+}
+
+// writeCredentials replaces the credentials file in one step, creating it with 0600 permissions
+// so that tokens are never readable by other users
+func writeCredentials(creds credentialsFile) error {
+	fileName, err := credentialsFileName()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fileName), 0700); err != nil {
+		return errors.Wrap(err, "failed to create config dir")
+	}
+
+	data, err := json.MarshalIndent(creds, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal credentials")
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(fileName), ".credentials-")
+	if err != nil {
+		return errors.Wrap(err, "failed to create temp file")
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if err := tmpFile.Chmod(0600); err != nil {
+		tmpFile.Close()
+		return errors.Wrap(err, "failed to set temp file permissions")
+	}
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return errors.Wrap(err, "failed to write temp file")
+	}
+	if err := tmpFile.Close(); err != nil {
+		return errors.Wrap(err, "failed to close temp file")
+	}
+	return errors.Wrap(os.Rename(tmpFile.Name(), fileName), "failed to rename temp file")
+}
+
+// portalToken returns the Authorization header for a bundle URL from the credentials cached by
+// sbctl login, refreshing the access token when it has expired. An empty string is returned when
+// the portal was not logged in to.
+func portalToken(bundleURL string) (string, error) {
+	key, err := portalKey(bundleURL)
+	if err != nil {
+		return "", err
+	}
+
+	creds, err := readCredentials()
+	if err != nil {
+		return "", err
+	}
+	portal, ok := creds.Portals[key]
+	if !ok {
+		return "", nil
+	}
+
+	if !portal.Expiry.IsZero() && time.Now().Add(tokenExpiryLeeway).After(portal.Expiry) {
+		if portal.RefreshToken == "" {
+			return "", errors.Errorf("the login to %s has expired, run sbctl login %s again", key, key)
+		}
+		refreshed, err := refreshPortalToken(portal)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to refresh the login to %s, run sbctl login %s again", key, key)
+		}
+		creds.Portals[key] = refreshed
+		if err := writeCredentials(creds); err != nil {
+			return "", err
+		}
+		portal = refreshed
+	}
+
+	return fmt.Sprintf("Bearer %s", portal.AccessToken), nil
+}
@@ -0,0 +1,152 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// newOIDCServer serves the discovery document, device authorization and token endpoints of an
+// issuer that issues the given token response
+func newOIDCServer(token tokenResponse) *httptest.Server {
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(oidcProvider{
+			DeviceAuthorizationEndpoint: server.URL + "/device",
+			TokenEndpoint:               server.URL + "/token",
+		})
+	})
+	mux.HandleFunc("/device", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(deviceAuthorization{
+			DeviceCode:      "device-code",
+			UserCode:        "ABCD-EFGH",
+			VerificationURI: server.URL + "/activate",
+			ExpiresIn:       60,
+			Interval:        1,
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("client_id") != "sbctl" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(tokenResponse{Error: "invalid_client"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(token)
+	})
+	server = httptest.NewServer(mux)
+	return server
+}
+
+var _ = Describe("Credentials", func() {
+	BeforeEach(func() {
+		// os.UserConfigDir uses XDG_CONFIG_HOME on Linux and HOME on macOS
+		dir := GinkgoT().TempDir()
+		for _, name := range []string{"XDG_CONFIG_HOME", "HOME"} {
+			DeferCleanup(os.Setenv, name, os.Getenv(name))
+			Expect(os.Setenv(name, dir)).To(Succeed())
+		}
+	})
+
+	It("Has no credentials before the first login", func() {
+		creds, err := readCredentials()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(creds.Portals).To(BeEmpty())
+
+		Expect(portalToken("https://vendor.example.com/troubleshoot/bundles/abc")).To(BeEmpty())
+	})
+
+	It("Saves credentials only readable by the user and loads them again", func() {
+		expiry := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+		saved := credentialsFile{Portals: map[string]portalCredentials{
+			"vendor.example.com": {Issuer: "https://sso.example.com", ClientID: "sbctl", AccessToken: "access", RefreshToken: "refresh", Expiry: expiry},
+		}}
+		Expect(writeCredentials(saved)).To(Succeed())
+
+		fileName, err := credentialsFileName()
+		Expect(err).NotTo(HaveOccurred())
+		info, err := os.Stat(fileName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+		info, err = os.Stat(filepath.Dir(fileName))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0700)))
+
+		loaded, err := readCredentials()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loaded.Portals).To(HaveLen(1))
+		Expect(loaded.Portals["vendor.example.com"].AccessToken).To(Equal("access"))
+		Expect(loaded.Portals["vendor.example.com"].Expiry.Equal(expiry)).To(BeTrue())
+
+		Expect(portalToken("https://vendor.example.com/troubleshoot/bundles/abc")).To(Equal("Bearer access"))
+		Expect(portalToken("https://other.example.com/troubleshoot/bundles/abc")).To(BeEmpty())
+
+		entries, err := os.ReadDir(filepath.Dir(fileName))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+	})
+
+	It("Fails on a corrupt credentials file", func() {
+		fileName, err := credentialsFileName()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.MkdirAll(filepath.Dir(fileName), 0700)).To(Succeed())
+		Expect(os.WriteFile(fileName, []byte("{not json"), 0600)).To(Succeed())
+
+		_, err = readCredentials()
+		Expect(err).To(MatchError(ContainSubstring("failed to parse " + fileName)))
+		_, err = portalToken("https://vendor.example.com/troubleshoot/bundles/abc")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Refreshes expired access tokens and keeps refresh tokens that are not rotated", func() {
+		issuer := newOIDCServer(tokenResponse{AccessToken: "new-access", ExpiresIn: 3600})
+		defer issuer.Close()
+
+		Expect(writeCredentials(credentialsFile{Portals: map[string]portalCredentials{
+			"vendor.example.com": {Issuer: issuer.URL, ClientID: "sbctl", AccessToken: "old-access", RefreshToken: "refresh", Expiry: time.Now().Add(-time.Minute)},
+		}})).To(Succeed())
+
+		Expect(portalToken("https://vendor.example.com/troubleshoot/bundles/abc")).To(Equal("Bearer new-access"))
+		creds, err := readCredentials()
+		Expect(err).NotTo(HaveOccurred())
+		portal := creds.Portals["vendor.example.com"]
+		Expect(portal.AccessToken).To(Equal("new-access"))
+		Expect(portal.RefreshToken).To(Equal("refresh"))
+		Expect(portal.Expiry).To(BeTemporally("~", time.Now().Add(time.Hour), time.Minute))
+
+		Expect(writeCredentials(credentialsFile{Portals: map[string]portalCredentials{
+			"vendor.example.com": {Issuer: issuer.URL, ClientID: "sbctl", AccessToken: "old-access", Expiry: time.Now().Add(-time.Minute)},
+		}})).To(Succeed())
+		_, err = portalToken("https://vendor.example.com/troubleshoot/bundles/abc")
+		Expect(err).To(MatchError("the login to vendor.example.com has expired, run sbctl login vendor.example.com again"))
+	})
+
+	It("Logs in with the device flow", func() {
+		issuer := newOIDCServer(tokenResponse{AccessToken: "access", RefreshToken: "refresh"})
+		defer issuer.Close()
+
+		out := bytes.Buffer{}
+		portal, err := deviceLogin(issuer.URL, "sbctl", []string{"openid"}, &out)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out.String()).To(Equal("Open " + issuer.URL + "/activate in a browser and enter the code ABCD-EFGH\n"))
+		Expect(portal).To(Equal(portalCredentials{Issuer: issuer.URL, ClientID: "sbctl", AccessToken: "access", RefreshToken: "refresh"}))
+
+		denied := newOIDCServer(tokenResponse{Error: "access_denied"})
+		defer denied.Close()
+		_, err = deviceLogin(denied.URL, "sbctl", []string{"openid"}, &out)
+		Expect(err).To(MatchError("login was denied"))
+	})
+
+	It("Caches credentials by the host of portal urls", func() {
+		Expect(portalKey("https://vendor.example.com/troubleshoot/bundles/abc")).To(Equal("vendor.example.com"))
+		_, err := portalKey("vendor.example.com")
+		Expect(err).To(MatchError(`"vendor.example.com" is not a portal url`))
+	})
+})
@@ -0,0 +1,400 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// redactedValue replaces values troubleshoot's redactors removed from the bundle
+const redactedValue = "***HIDDEN***"
+
+// defaultDiffLiveResources are compared unless --resources is set. They are the resources whose
+// changes usually explain a difference in behaviour.
+var defaultDiffLiveResources = []diffLiveResource{
+	{GVR: schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}},
+	{GVR: schema.GroupVersionResource{Version: "v1", Resource: "nodes"}},
+	{GVR: schema.GroupVersionResource{Version: "v1", Resource: "services"}, Namespaced: true},
+	{GVR: schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}, Namespaced: true},
+	{GVR: schema.GroupVersionResource{Version: "v1", Resource: "persistentvolumeclaims"}, Namespaced: true},
+	{GVR: schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}, Namespaced: true},
+	{GVR: schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "statefulsets"}, Namespaced: true},
+	{GVR: schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "daemonsets"}, Namespaced: true},
+	{GVR: schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "cronjobs"}, Namespaced: true},
+	{GVR: schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"}, Namespaced: true},
+	{GVR: schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}},
+}
+
+type diffLiveResource struct {
+	GVR        schema.GroupVersionResource
+	Namespaced bool
+}
+
+const (
+	driftAdded   = "added"
+	driftRemoved = "removed"
+	driftChanged = "changed"
+)
+
+type drift struct {
+	Resource  string
+	Namespace string
+	Name      string
+	Change    string
+	Details   []string
+}
+
+func DiffLiveCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff-live [bundle]",
+		Short: "Compare a support bundle with the live cluster",
+		Long: `Compare a support bundle with the live cluster, to find what changed since the bundle was collected.
+
+Objects are matched by resource, namespace and name. Objects are reported as added when they only
+exist in the cluster, removed when they only exist in the bundle, and changed when they were
+recreated or their spec, data, images, replicas or node versions differ. Values redacted from the
+bundle are not compared. Namespaced resources are only compared in namespaces the bundle has
+files for, since bundles are often collected for some namespaces only.`,
+		Example:       `  sbctl diff-live --kubeconfig prod.yaml support-bundle.tar.gz`,
+		Args:          cobra.MaximumNArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+			if len(args) == 1 {
+				v.Set("support-bundle-location", args[0])
+			}
+
+			resources, err := parseDiffLiveResources(v.GetStringSlice("resources"))
+			if err != nil {
+				return err
+			}
+
+			clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+				&clientcmd.ClientConfigLoadingRules{ExplicitPath: v.GetString("kubeconfig")},
+				&clientcmd.ConfigOverrides{CurrentContext: v.GetString("context")},
+			)
+			restConfig, err := clientConfig.ClientConfig()
+			if err != nil {
+				return errors.Wrap(err, "failed to load kubeconfig")
+			}
+			client, err := dynamic.NewForConfig(restConfig)
+			if err != nil {
+				return errors.Wrap(err, "failed to create client")
+			}
+
+			clusterData, cleanup, err := loadClusterData(v)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			namespace := v.GetString("namespace")
+			drifts := []drift{}
+			for _, r := range resources {
+				bundleObjects, collectedNamespaces, collected, err := listDiffLiveBundleObjects(clusterData, r.GVR, namespace)
+				if err != nil {
+					return err
+				}
+				if !collected {
+					fmt.Fprintf(os.Stderr, "Skipping %s, which the bundle has no files for\n", r.GVR.GroupResource())
+					continue
+				}
+
+				resourceClient := client.Resource(r.GVR)
+				var list *unstructured.UnstructuredList
+				if r.Namespaced {
+					list, err = resourceClient.Namespace(namespace).List(context.Background(), metav1.ListOptions{})
+				} else {
+					list, err = resourceClient.List(context.Background(), metav1.ListOptions{})
+				}
+				if err != nil {
+					return errors.Wrapf(err, "failed to list %s in the live cluster", r.GVR.GroupResource())
+				}
+				liveItems, err := normalizeLiveObjects(r.GVR.Resource, list)
+				if err != nil {
+					return err
+				}
+				liveObjects := []unstructured.Unstructured{}
+				for _, item := range liveItems {
+					if collectedNamespaces == nil || item.GetNamespace() == "" || collectedNamespaces[item.GetNamespace()] {
+						liveObjects = append(liveObjects, item)
+					}
+				}
+
+				drifts = append(drifts, diffObjects(r.GVR.GroupResource().String(), bundleObjects, liveObjects)...)
+			}
+
+			if len(drifts) == 0 {
+				fmt.Println("No differences found")
+				return nil
+			}
+			printDrifts(os.Stdout, drifts)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	cmd.Flags().String("kubeconfig", "", "kubeconfig of the live cluster. The default kubeconfig is used when not set.")
+	cmd.Flags().String("context", "", "kubeconfig context of the live cluster")
+	cmd.Flags().StringP("namespace", "n", "", "only compare this namespace")
+	cmd.Flags().StringSlice("resources", nil, "resources to compare, e.g. deployments.apps,configmaps. Defaults to common workload and configuration resources.")
+	return cmd
+}
+
+// parseDiffLiveResources resolves resource[.group] names to the version sbctl reads them in
+func parseDiffLiveResources(names []string) ([]diffLiveResource, error) {
+	if len(names) == 0 {
+		return defaultDiffLiveResources, nil
+	}
+
+	resources := []diffLiveResource{}
+	for _, name := range names {
+		gr := schema.ParseGroupResource(name)
+		found := false
+		for _, r := range defaultDiffLiveResources {
+			if r.GVR.GroupResource() == gr {
+				resources = append(resources, r)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, usererrors.New(usererrors.InvalidArgument, errors.Errorf("unsupported resource %s, must be one of %s", name, strings.Join(diffLiveResourceNames(), ", ")), "resource")
+		}
+	}
+	return resources, nil
+}
+
+func diffLiveResourceNames() []string {
+	names := []string{}
+	for _, r := range defaultDiffLiveResources {
+		names = append(names, r.GVR.GroupResource().String())
+	}
+	return names
+}
+
+// listDiffLiveBundleObjects returns the objects of a resource in the bundle and the namespaces it
+// has files for. The namespaces are nil when the resource is stored in a single file. The returned
+// bool is false when the resource was not collected at all.
+func listDiffLiveBundleObjects(clusterData sbctl.ClusterData, gvr schema.GroupVersionResource, namespace string) ([]unstructured.Unstructured, map[string]bool, bool, error) {
+	fileNames, err := sbctl.FindResourceFiles(clusterData, gvr.Group, gvr.Resource)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if len(fileNames) == 0 {
+		return nil, nil, false, nil
+	}
+	objects, err := sbctl.ListResources(clusterData, gvr.Group, gvr.Resource)
+	if err != nil {
+		return nil, nil, false, errors.Wrapf(err, "failed to read %s from the bundle", gvr.GroupResource())
+	}
+
+	var collectedNamespaces map[string]bool
+	if len(fileNames) != 1 || filepath.Dir(fileNames[0]) != clusterData.ClusterResourcesDir {
+		collectedNamespaces = map[string]bool{}
+		for _, fileName := range fileNames {
+			collectedNamespaces[strings.TrimSuffix(filepath.Base(fileName), filepath.Ext(fileName))] = true
+		}
+	}
+
+	filtered := []unstructured.Unstructured{}
+	for _, o := range objects {
+		if namespace == "" || o.GetNamespace() == namespace {
+			filtered = append(filtered, o)
+		}
+	}
+	return filtered, collectedNamespaces, true, nil
+}
+
+// normalizeLiveObjects decodes live objects the way bundle files are decoded, so that fields
+// defaulted by the decoding do not show up as changes
+func normalizeLiveObjects(resource string, list *unstructured.UnstructuredList) ([]unstructured.Unstructured, error) {
+	data, err := list.MarshalJSON()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to marshal %s", resource)
+	}
+	decoded, _, err := sbctl.Decode(resource, data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decode %s", resource)
+	}
+	normalized, err := sbctl.ToUnstructuredList(decoded)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to convert %s", resource)
+	}
+	return normalized.Items, nil
+}
+
+func diffObjects(resource string, bundleObjects []unstructured.Unstructured, liveObjects []unstructured.Unstructured) []drift {
+	key := func(o unstructured.Unstructured) string {
+		return o.GetNamespace() + "/" + o.GetName()
+	}
+
+	live := map[string]unstructured.Unstructured{}
+	for _, o := range liveObjects {
+		live[key(o)] = o
+	}
+
+	drifts := []drift{}
+	seen := map[string]bool{}
+	for _, b := range bundleObjects {
+		seen[key(b)] = true
+		l, ok := live[key(b)]
+		if !ok {
+			drifts = append(drifts, drift{Resource: resource, Namespace: b.GetNamespace(), Name: b.GetName(), Change: driftRemoved})
+			continue
+		}
+		if details := objectChanges(b, l); len(details) > 0 {
+			drifts = append(drifts, drift{Resource: resource, Namespace: b.GetNamespace(), Name: b.GetName(), Change: driftChanged, Details: details})
+		}
+	}
+	for _, l := range liveObjects {
+		if !seen[key(l)] {
+			drifts = append(drifts, drift{Resource: resource, Namespace: l.GetNamespace(), Name: l.GetName(), Change: driftAdded})
+		}
+	}
+
+	sort.SliceStable(drifts, func(i, j int) bool {
+		if drifts[i].Namespace != drifts[j].Namespace {
+			return drifts[i].Namespace < drifts[j].Namespace
+		}
+		return drifts[i].Name < drifts[j].Name
+	})
+	return drifts
+}
+
+// objectChanges describes how the live object differs from the bundle one. Changes to the spec
+// or data are only reported on their own when no more specific change explains them.
+func objectChanges(b unstructured.Unstructured, l unstructured.Unstructured) []string {
+	details := []string{}
+	if b.GetUID() != "" && l.GetUID() != "" && b.GetUID() != l.GetUID() {
+		details = append(details, "recreated")
+	}
+
+	if bundleReplicas, found, _ := unstructured.NestedInt64(b.Object, "spec", "replicas"); found {
+		if liveReplicas, _, _ := unstructured.NestedInt64(l.Object, "spec", "replicas"); liveReplicas != bundleReplicas {
+			details = append(details, fmt.Sprintf("replicas %d -> %d", bundleReplicas, liveReplicas))
+		}
+	}
+
+	bundleImages, liveImages := containerImages(b), containerImages(l)
+	names := []string{}
+	for name := range bundleImages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if liveImage, ok := liveImages[name]; ok && !equalIgnoringRedacted(bundleImages[name], liveImage) {
+			details = append(details, fmt.Sprintf("image %s: %s -> %s", name, bundleImages[name], liveImage))
+		}
+	}
+
+	bundleKubelet, _, _ := unstructured.NestedString(b.Object, "status", "nodeInfo", "kubeletVersion")
+	liveKubelet, _, _ := unstructured.NestedString(l.Object, "status", "nodeInfo", "kubeletVersion")
+	if bundleKubelet != liveKubelet {
+		details = append(details, fmt.Sprintf("kubelet %s -> %s", bundleKubelet, liveKubelet))
+	}
+
+	if len(details) > 0 {
+		return details
+	}
+	for _, field := range []string{"spec", "data", "binaryData"} {
+		if !equalIgnoringRedacted(b.Object[field], l.Object[field]) {
+			details = append(details, field+" changed")
+		}
+	}
+	return details
+}
+
+// containerImages returns the images of a pod spec or pod template by container name
+func containerImages(o unstructured.Unstructured) map[string]string {
+	images := map[string]string{}
+	for _, path := range [][]string{{"spec"}, {"spec", "template", "spec"}, {"spec", "jobTemplate", "spec", "template", "spec"}} {
+		for _, containersField := range []string{"initContainers", "containers"} {
+			containers, _, _ := unstructured.NestedSlice(o.Object, append(path, containersField)...)
+			for _, c := range containers {
+				container, ok := c.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				name, _ := container["name"].(string)
+				image, _ := container["image"].(string)
+				images[name] = image
+			}
+		}
+	}
+	return images
+}
+
+// equalIgnoringRedacted compares values from the bundle and the live cluster, treating strings
+// redacted from the bundle as equal to anything
+func equalIgnoringRedacted(bundleValue interface{}, liveValue interface{}) bool {
+	switch b := bundleValue.(type) {
+	case string:
+		if strings.Contains(b, redactedValue) {
+			return true
+		}
+	case map[string]interface{}:
+		l, ok := liveValue.(map[string]interface{})
+		if !ok || len(b) != len(l) {
+			return false
+		}
+		for k, v := range b {
+			if lv, ok := l[k]; !ok || !equalIgnoringRedacted(v, lv) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		l, ok := liveValue.([]interface{})
+		if !ok || len(b) != len(l) {
+			return false
+		}
+		for i := range b {
+			if !equalIgnoringRedacted(b[i], l[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(bundleValue, liveValue)
+}
+
+func printDrifts(out io.Writer, drifts []drift) {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "RESOURCE\tNAMESPACE\tNAME\tCHANGE\tDETAILS")
+	for _, d := range drifts {
+		namespace := d.Namespace
+		if namespace == "" {
+			namespace = "-"
+		}
+		details := strings.Join(d.Details, "; ")
+		if details == "" {
+			details = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", d.Resource, namespace, d.Name, d.Change, details)
+	}
+}
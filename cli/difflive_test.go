@@ -0,0 +1,118 @@
+package cli
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// unstructuredFixture decodes a JSON object for tests
+func unstructuredFixture(data string) unstructured.Unstructured {
+	o := unstructured.Unstructured{}
+	Expect(o.UnmarshalJSON([]byte(data))).To(Succeed())
+	return o
+}
+
+var _ = Describe("Diff live", func() {
+	deployment := func(metadata string, spec string, status string) unstructured.Unstructured {
+		return unstructuredFixture(`{
+			"apiVersion": "apps/v1",
+			"kind": "Deployment",
+			"metadata": {"name": "web", "namespace": "default", "uid": "1"` + metadata + `},
+			"spec": ` + spec + `,
+			"status": ` + status + `
+		}`)
+	}
+	webSpec := `{"replicas": 2, "template": {"spec": {"containers": [{"name": "web", "image": "nginx:1.25"}]}}}`
+
+	It("Ignores managed fields, resource versions and status", func() {
+		b := deployment(`, "resourceVersion": "100", "generation": 3`, webSpec, `{"readyReplicas": 2}`)
+		l := deployment(`, "resourceVersion": "250", "generation": 4, "managedFields": [{"manager": "kubectl", "operation": "Update"}]`,
+			webSpec, `{"readyReplicas": 1, "conditions": [{"type": "Available", "status": "False"}]}`)
+		Expect(objectChanges(b, l)).To(BeEmpty())
+	})
+
+	It("Normalizes live objects like bundle files", func() {
+		bundleItem := `{"metadata": {"name": "web", "namespace": "default", "uid": "1", "resourceVersion": "100"}, "spec": ` + webSpec + `}`
+		liveItem := `{"metadata": {"name": "web", "namespace": "default", "uid": "1", "resourceVersion": "250", "managedFields": [{"manager": "kubectl"}]}, "spec": ` + webSpec + `, "status": {"readyReplicas": 1}}`
+
+		dir := GinkgoT().TempDir()
+		writeClusterResource(dir, "deployments/default.json", fixtureList("apps/v1", "Deployment", bundleItem))
+		clusterData, err := sbctl.FindClusterData(dir)
+		Expect(err).NotTo(HaveOccurred())
+		bundleObjects, _, _, err := listDiffLiveBundleObjects(clusterData, schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}, "")
+		Expect(err).NotTo(HaveOccurred())
+
+		list := &unstructured.UnstructuredList{}
+		Expect(list.UnmarshalJSON([]byte(fixtureList("apps/v1", "Deployment", liveItem)))).To(Succeed())
+		liveObjects, err := normalizeLiveObjects("deployments", list)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(liveObjects).To(HaveLen(1))
+
+		Expect(diffObjects("deployments.apps", bundleObjects, liveObjects)).To(BeEmpty())
+	})
+
+	It("Describes specific changes rather than the spec", func() {
+		b := deployment(``, webSpec, `{}`)
+		l := deployment(``, `{"replicas": 3, "template": {"spec": {"containers": [{"name": "web", "image": "nginx:1.27"}]}}}`, `{}`)
+		Expect(objectChanges(b, l)).To(Equal([]string{"replicas 2 -> 3", "image web: nginx:1.25 -> nginx:1.27"}))
+
+		l = deployment(``, `{"replicas": 2, "paused": true, "template": {"spec": {"containers": [{"name": "web", "image": "nginx:1.25"}]}}}`, `{}`)
+		Expect(objectChanges(b, l)).To(Equal([]string{"spec changed"}))
+
+		l = unstructuredFixture(`{"metadata": {"name": "web", "namespace": "default", "uid": "2"}, "spec": ` + webSpec + `}`)
+		Expect(objectChanges(b, l)).To(Equal([]string{"recreated"}))
+	})
+
+	It("Does not compare values redacted from the bundle", func() {
+		b := unstructuredFixture(`{"metadata": {"name": "settings", "namespace": "default"}, "data": {"password": "***HIDDEN***", "mode": "fast"}}`)
+		l := unstructuredFixture(`{"metadata": {"name": "settings", "namespace": "default"}, "data": {"password": "hunter2", "mode": "fast"}}`)
+		Expect(objectChanges(b, l)).To(BeEmpty())
+
+		l = unstructuredFixture(`{"metadata": {"name": "settings", "namespace": "default"}, "data": {"password": "hunter2", "mode": "slow"}}`)
+		Expect(objectChanges(b, l)).To(Equal([]string{"data changed"}))
+	})
+
+	It("Reports objects that only exist on one side", func() {
+		configMap := func(namespace string, name string) unstructured.Unstructured {
+			return unstructuredFixture(`{"metadata": {"name": "` + name + `", "namespace": "` + namespace + `"}, "data": {"mode": "fast"}}`)
+		}
+		bundleObjects := []unstructured.Unstructured{configMap("default", "settings"), configMap("default", "old")}
+		liveObjects := []unstructured.Unstructured{configMap("default", "settings"), configMap("default", "new"), configMap("app", "new")}
+
+		drifts := diffObjects("configmaps", bundleObjects, liveObjects)
+		Expect(drifts).To(Equal([]drift{
+			{Resource: "configmaps", Namespace: "app", Name: "new", Change: driftAdded},
+			{Resource: "configmaps", Namespace: "default", Name: "new", Change: driftAdded},
+			{Resource: "configmaps", Namespace: "default", Name: "old", Change: driftRemoved},
+		}))
+
+		Expect(diffObjects("configmaps", nil, liveObjects[:1])).To(Equal([]drift{
+			{Resource: "configmaps", Namespace: "default", Name: "settings", Change: driftAdded},
+		}))
+		Expect(diffObjects("configmaps", bundleObjects[:1], nil)).To(Equal([]drift{
+			{Resource: "configmaps", Namespace: "default", Name: "settings", Change: driftRemoved},
+		}))
+	})
+
+	It("Lists the namespaces bundles have files for", func() {
+		dir := GinkgoT().TempDir()
+		writeClusterResource(dir, "configmaps/default.json", fixtureList("v1", "ConfigMap", `{"metadata": {"name": "settings", "namespace": "default"}}`))
+		writeClusterResource(dir, "configmaps/app.json", fixtureList("v1", "ConfigMap", `{"metadata": {"name": "settings", "namespace": "app"}}`))
+		clusterData, err := sbctl.FindClusterData(dir)
+		Expect(err).NotTo(HaveOccurred())
+
+		objects, namespaces, collected, err := listDiffLiveBundleObjects(clusterData, schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}, "app")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(collected).To(BeTrue())
+		Expect(namespaces).To(Equal(map[string]bool{"default": true, "app": true}))
+		Expect(objects).To(HaveLen(1))
+		Expect(objects[0].GetNamespace()).To(Equal("app"))
+
+		_, _, collected, err = listDiffLiveBundleObjects(clusterData, schema.GroupVersionResource{Version: "v1", Resource: "services"}, "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(collected).To(BeFalse())
+	})
+})
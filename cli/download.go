@@ -0,0 +1,248 @@
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+)
+
+// maxParallelDownloads is how many parts of a bundle are downloaded at the same time
+const maxParallelDownloads = 4
+
+// bundlePart is a part of a bundle that a portal split into several downloads. Joined in order,
+// the parts are the bundle archive.
+type bundlePart struct {
+	URL string `json:"url"`
+	// Size and SHA256 are verified when they are set
+	Size   int64  `json:"size,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// bundleManifest lists the parts of a bundle, e.g.
+//
+//	{"parts": [{"url": "bundle.tgz.part1", "size": 1073741824, "sha256": "..."}, ...], "sha256": "..."}
+//
+// URLs of parts are relative to the manifest. SHA256 is the checksum of the joined bundle.
+type bundleManifest struct {
+	Parts  []bundlePart `json:"parts"`
+	SHA256 string       `json:"sha256,omitempty"`
+}
+
+// isMultiPartLocation returns whether a bundle location is a comma separated list of the URLs of
+// its parts, or the URL of a JSON manifest of its parts
+func isMultiPartLocation(location string) bool {
+	if strings.Contains(location, ",") {
+		return true
+	}
+	u, err := url.Parse(location)
+	return err == nil && strings.HasSuffix(u.Path, ".json")
+}
+
+// downloadMultiPartBundle downloads the parts of a bundle in parallel, verifies them, and
+// extracts the joined archive into a temp dir. The token is only sent for the manifest, parts
+// are expected to be signed URLs.
+func downloadMultiPartBundle(location string, token string) (string, error) {
+	manifest := bundleManifest{}
+	if strings.Contains(location, ",") {
+		for _, partURL := range strings.Split(location, ",") {
+			if partURL = strings.TrimSpace(partURL); partURL != "" {
+				manifest.Parts = append(manifest.Parts, bundlePart{URL: partURL})
+			}
+		}
+	} else {
+		var err error
+		manifest, err = loadBundleManifest(location, token)
+		if err != nil {
+			return "", err
+		}
+	}
+	if len(manifest.Parts) == 0 {
+		return "", errors.New("bundle has no parts")
+	}
+
+	partsDir, err := os.MkdirTemp("", "sbctl-parts-")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create temp dir")
+	}
+	defer removeBundleData(partsDir)
+
+	fmt.Printf("Downloading bundle in %d parts\n", len(manifest.Parts))
+	files, err := downloadBundleParts(manifest.Parts, partsDir)
+	if err != nil {
+		return "", err
+	}
+
+	archive, err := os.CreateTemp(partsDir, "bundle-")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create temp file")
+	}
+	defer archive.Close()
+
+	sum := sha256.New()
+	for _, file := range files {
+		if err := appendFile(io.MultiWriter(archive, sum), file); err != nil {
+			return "", err
+		}
+		// Parts are not needed once joined, which halves the disk space huge bundles take
+		_ = removeBundleData(file)
+	}
+	if err := archive.Close(); err != nil {
+		return "", errors.Wrap(err, "failed to write bundle")
+	}
+	if err := verifyChecksum(sum, manifest.SHA256, "bundle"); err != nil {
+		return "", err
+	}
+
+	bundleDir, err := os.MkdirTemp("", "sbctl-")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create temp dir")
+	}
+	if err := sbctl.ExtractBundle(archive.Name(), bundleDir); err != nil {
+		_ = removeBundleData(bundleDir)
+		return "", errors.Wrap(err, "failed to extract joined bundle parts")
+	}
+	return bundleDir, nil
+}
+
+func loadBundleManifest(location string, token string) (bundleManifest, error) {
+	manifest := bundleManifest{}
+
+	req, err := http.NewRequest(http.MethodGet, location, nil)
+	if err != nil {
+		return manifest, errors.Wrap(err, "failed to create HTTP request")
+	}
+	if token != "" {
+		req.Header.Add("Authorization", token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return manifest, errors.Wrap(err, "failed to download manifest")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return manifest, errors.Errorf("unexpected status code downloading manifest: %v", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
+		return manifest, errors.Wrap(err, "failed to decode manifest")
+	}
+
+	base, err := url.Parse(location)
+	if err != nil {
+		return manifest, errors.Wrap(err, "failed to parse url")
+	}
+	for i, part := range manifest.Parts {
+		ref, err := url.Parse(part.URL)
+		if err != nil {
+			return manifest, errors.Wrapf(err, "failed to parse url of part %d", i+1)
+		}
+		manifest.Parts[i].URL = base.ResolveReference(ref).String()
+	}
+	return manifest, nil
+}
+
+// downloadBundleParts downloads parts into dir, several at a time, and returns their files in
+// the order of parts
+func downloadBundleParts(parts []bundlePart, dir string) ([]string, error) {
+	files := make([]string, len(parts))
+	errs := make([]error, len(parts))
+
+	sem := make(chan struct{}, maxParallelDownloads)
+	wg := sync.WaitGroup{}
+	for i := range parts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			files[i] = filepath.Join(dir, fmt.Sprintf("part-%04d", i+1))
+			if err := downloadBundlePart(parts[i], files[i]); err != nil {
+				errs[i] = errors.Wrapf(err, "failed to download part %d", i+1)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func downloadBundlePart(part bundlePart, fileName string) error {
+	resp, err := http.Get(part.URL) // nolint: gosec // the user asked for these URLs
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("unexpected status code: %v", resp.StatusCode)
+	}
+
+	f, err := os.Create(fileName)
+	if err != nil {
+		return errors.Wrap(err, "failed to create part file")
+	}
+	defer f.Close()
+
+	sum := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, sum), resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "failed to write part file")
+	}
+
+	// Truncated downloads are only detected when the size is known
+	size := part.Size
+	if size == 0 {
+		size = resp.ContentLength
+	}
+	if size > 0 && n != size {
+		return errors.Errorf("downloaded %d bytes, expected %d", n, size)
+	}
+	if err := verifyChecksum(sum, part.SHA256, "part"); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// verifyChecksum compares the SHA-256 sum of what was written to sum with expected, a hex
+// encoded checksum. Nothing is verified when expected is empty.
+func verifyChecksum(sum hash.Hash, expected string, what string) error {
+	if expected == "" {
+		return nil
+	}
+	actual := hex.EncodeToString(sum.Sum(nil))
+	if !strings.EqualFold(actual, expected) {
+		return errors.Errorf("%s checksum mismatch: expected %s, got %s", what, expected, actual)
+	}
+	return nil
+}
+
+func appendFile(out io.Writer, fileName string) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return errors.Wrap(err, "failed to open part file")
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(out, f); err != nil {
+		return errors.Wrap(err, "failed to join bundle parts")
+	}
+	return nil
+}
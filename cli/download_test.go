@@ -0,0 +1,155 @@
+package cli
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// bundleArchive returns a gzipped tar archive of a bundle with the given files
+func bundleArchive(files map[string]string) []byte {
+	archive := bytes.Buffer{}
+	gzw := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gzw)
+	for name, data := range files {
+		Expect(tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg})).To(Succeed())
+		_, err := tw.Write([]byte(data))
+		Expect(err).NotTo(HaveOccurred())
+	}
+	Expect(tw.Close()).To(Succeed())
+	Expect(gzw.Close()).To(Succeed())
+	return archive.Bytes()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+var _ = Describe("Download", func() {
+	var tmpDir string
+	var archive []byte
+	var parts [][]byte
+	var server *httptest.Server
+	var manifest bundleManifest
+	var mu sync.Mutex
+	var authorizations map[string]string
+
+	BeforeEach(func() {
+		// Temp files and dirs of downloads are made in TMPDIR, so that tests can see what is left
+		tmpDir = GinkgoT().TempDir()
+		DeferCleanup(os.Setenv, "TMPDIR", os.Getenv("TMPDIR"))
+		Expect(os.Setenv("TMPDIR", tmpDir)).To(Succeed())
+
+		archive = bundleArchive(map[string]string{
+			"support-bundle/cluster-resources/namespaces.json": `{"kind": "NamespaceList", "apiVersion": "v1", "items": []}`,
+			"support-bundle/version.yaml":                      "apiVersion: troubleshoot.sh/v1beta2\n",
+		})
+		third := len(archive) / 3
+		parts = [][]byte{archive[:third], archive[third : 2*third], archive[2*third:]}
+		manifest = bundleManifest{SHA256: sha256Hex(archive)}
+		for i, part := range parts {
+			manifest.Parts = append(manifest.Parts, bundlePart{
+				URL:    "parts/" + strconv.Itoa(i+1),
+				Size:   int64(len(part)),
+				SHA256: sha256Hex(part),
+			})
+		}
+
+		authorizations = map[string]string{}
+		mux := http.NewServeMux()
+		mux.HandleFunc("/bundles/bundle.json", func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			authorizations[r.URL.Path] = r.Header.Get("Authorization")
+			mu.Unlock()
+			_ = json.NewEncoder(w).Encode(manifest)
+		})
+		for i, part := range parts {
+			part := part
+			mux.HandleFunc("/bundles/parts/"+strconv.Itoa(i+1), func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				authorizations[r.URL.Path] = r.Header.Get("Authorization")
+				mu.Unlock()
+				_, _ = w.Write(part)
+			})
+		}
+		server = httptest.NewServer(mux)
+		DeferCleanup(server.Close)
+	})
+
+	It("Downloads, verifies and extracts the parts of a manifest", func() {
+		bundleDir, err := downloadMultiPartBundle(server.URL+"/bundles/bundle.json", "Bearer token")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, bundleDir)
+
+		data, err := os.ReadFile(filepath.Join(bundleDir, "support-bundle", "cluster-resources", "namespaces.json"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring("NamespaceList"))
+
+		// Parts are signed URLs, the token is only sent for the manifest
+		mu.Lock()
+		defer mu.Unlock()
+		Expect(authorizations).To(Equal(map[string]string{
+			"/bundles/bundle.json": "Bearer token",
+			"/bundles/parts/1":     "",
+			"/bundles/parts/2":     "",
+			"/bundles/parts/3":     "",
+		}))
+
+		// Only the extracted bundle is left, the parts and the joined archive are removed
+		entries, err := os.ReadDir(tmpDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+		Expect(filepath.Join(tmpDir, entries[0].Name())).To(Equal(bundleDir))
+	})
+
+	It("Downloads a comma separated list of parts", func() {
+		location := server.URL + "/bundles/parts/1, " + server.URL + "/bundles/parts/2," + server.URL + "/bundles/parts/3"
+		Expect(isMultiPartLocation(location)).To(BeTrue())
+
+		bundleDir, err := downloadMultiPartBundle(location, "Bearer token")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, bundleDir)
+		Expect(filepath.Join(bundleDir, "support-bundle", "version.yaml")).To(BeAnExistingFile())
+	})
+
+	It("Fails on responses other than 200", func() {
+		_, err := downloadMultiPartBundle(server.URL+"/bundles/missing.json", "")
+		Expect(err).To(MatchError("unexpected status code downloading manifest: 404"))
+
+		manifest.Parts[1].URL = "parts/missing"
+		_, err = downloadMultiPartBundle(server.URL+"/bundles/bundle.json", "")
+		Expect(err).To(MatchError("failed to download part 2: unexpected status code: 404"))
+	})
+
+	It("Removes partial files when a download fails", func() {
+		manifest.Parts[2].Size++
+		_, err := downloadMultiPartBundle(server.URL+"/bundles/bundle.json", "")
+		Expect(err).To(MatchError(ContainSubstring("failed to download part 3: downloaded")))
+
+		entries, err := os.ReadDir(tmpDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(BeEmpty())
+
+		manifest.Parts[2].Size--
+		manifest.SHA256 = sha256Hex([]byte("other"))
+		_, err = downloadMultiPartBundle(server.URL+"/bundles/bundle.json", "")
+		Expect(err).To(MatchError(ContainSubstring("bundle checksum mismatch")))
+
+		entries, err = os.ReadDir(tmpDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(BeEmpty())
+	})
+})
@@ -0,0 +1,321 @@
+package cli
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	bolt "go.etcd.io/bbolt"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+)
+
+// etcd stores keys in the "key" bucket by revision: 8 bytes of main revision, '_', 8 bytes of sub
+// revision, and a trailing 't' for deletions
+const (
+	etcdKeyBucket      = "key"
+	etcdRevisionLength = 17
+	etcdTombstoneMark  = 't'
+)
+
+type etcdPrefixStats struct {
+	Prefix    string
+	Keys      int
+	Revisions int
+	Size      int64
+}
+
+type etcdKeyStats struct {
+	Key  string
+	Size int64
+}
+
+type etcdStats struct {
+	Snapshot  string
+	DBSize    int64
+	FreeSize  int64
+	Revision  int64
+	Keys      int
+	Revisions int
+	Prefixes  []etcdPrefixStats
+	Largest   []etcdKeyStats
+}
+
+func EtcdCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "etcd",
+		Short: "Inspect etcd snapshots included in a support bundle",
+	}
+	cmd.AddCommand(etcdStatsCmd())
+	return cmd
+}
+
+func etcdStatsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Show the size of an etcd snapshot by key prefix",
+		Long: `Show the size of an etcd snapshot by key prefix.
+
+The snapshot is read without restoring it. Bundles are searched for etcd snapshots, usually
+*.db files collected with etcdctl snapshot save, unless one is given with --snapshot. The
+database size, the number of keys and revisions per prefix, and the largest objects help
+diagnose etcd running out of space, e.g. because of many events or large secrets.`,
+		Example: `  sbctl etcd stats -s ./support-bundle.tar.gz
+  sbctl etcd stats --snapshot ./etcd/snapshot.db --depth 3`,
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			snapshot := v.GetString("snapshot")
+			if snapshot == "" || v.GetString("support-bundle-location") != "" {
+				clusterData, cleanup, err := loadClusterData(v)
+				defer cleanup()
+				if err != nil {
+					return err
+				}
+
+				snapshot, err = findEtcdSnapshot(clusterData, snapshot)
+				if err != nil {
+					return err
+				}
+			}
+
+			stats, err := readEtcdStats(snapshot, v.GetInt("depth"), v.GetInt("top"))
+			if err != nil {
+				return err
+			}
+			printEtcdStats(os.Stdout, stats)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	cmd.Flags().String("snapshot", "", "etcd snapshot file. Relative to the bundle when a bundle is given.")
+	cmd.Flags().Int("depth", 2, "number of key path segments to group keys by, e.g. 2 for /registry/pods")
+	cmd.Flags().Int("top", 10, "number of largest objects to show")
+	return cmd
+}
+
+// findEtcdSnapshot returns the snapshot in the bundle. name selects one by its path relative to
+// the bundle when there are several.
+func findEtcdSnapshot(clusterData sbctl.ClusterData, name string) (string, error) {
+	root := clusterData.BundleDir
+	if root == "" {
+		root = filepath.Dir(clusterData.ClusterResourcesDir)
+	}
+
+	if name != "" {
+		path := filepath.Join(root, name)
+		if !isEtcdSnapshot(path) {
+			return "", errors.Errorf("%s is not an etcd snapshot", name)
+		}
+		return path, nil
+	}
+
+	snapshots := []string{}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path == clusterData.ClusterResourcesDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isEtcdSnapshot(path) {
+			snapshots = append(snapshots, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to walk bundle dir")
+	}
+
+	switch len(snapshots) {
+	case 0:
+		return "", errors.New("no etcd snapshot found in support bundle")
+	case 1:
+		return snapshots[0], nil
+	}
+
+	names := []string{}
+	for _, s := range snapshots {
+		rel, _ := filepath.Rel(root, s)
+		names = append(names, rel)
+	}
+	return "", errors.Errorf("found %d etcd snapshots, select one with --snapshot: %s", len(snapshots), strings.Join(names, ", "))
+}
+
+// isEtcdSnapshot checks for the magic number of bolt databases in the first meta page
+func isEtcdSnapshot(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	// The page header is 16 bytes, followed by the meta page's magic number
+	header := make([]byte, 20)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return false
+	}
+	return binary.LittleEndian.Uint32(header[16:]) == 0xED0CDAED
+}
+
+func readEtcdStats(snapshot string, depth int, top int) (*etcdStats, error) {
+	info, err := os.Stat(snapshot)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read snapshot")
+	}
+
+	db, err := bolt.Open(snapshot, 0400, &bolt.Options{ReadOnly: true, Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open snapshot")
+	}
+	defer db.Close()
+
+	stats := &etcdStats{Snapshot: snapshot, DBSize: info.Size()}
+	dbStats := db.Stats()
+	stats.FreeSize = int64(dbStats.FreePageN+dbStats.PendingPageN) * int64(db.Info().PageSize)
+
+	latest := map[string]int64{}
+	revisions := map[string]int{}
+	err = db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(etcdKeyBucket))
+		if bucket == nil {
+			return errors.New("snapshot has no key bucket, it may not be an etcd snapshot")
+		}
+
+		// Revisions are sorted, so later revisions of a key replace earlier ones
+		return bucket.ForEach(func(k []byte, v []byte) error {
+			if len(k) < etcdRevisionLength {
+				return nil
+			}
+			stats.Revision = int64(binary.BigEndian.Uint64(k[:8]))
+
+			kv := mvccpb.KeyValue{}
+			if err := kv.Unmarshal(v); err != nil {
+				return errors.Wrap(err, "failed to decode key value")
+			}
+			key := string(kv.Key)
+			revisions[key]++
+			if len(k) > etcdRevisionLength && k[etcdRevisionLength] == etcdTombstoneMark {
+				delete(latest, key)
+				return nil
+			}
+			latest[key] = int64(len(kv.Value))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	prefixes := map[string]*etcdPrefixStats{}
+	for key, count := range revisions {
+		prefix := etcdKeyPrefix(key, depth)
+		if prefixes[prefix] == nil {
+			prefixes[prefix] = &etcdPrefixStats{Prefix: prefix}
+		}
+		prefixes[prefix].Revisions += count
+		stats.Revisions += count
+		if size, ok := latest[key]; ok {
+			prefixes[prefix].Keys++
+			prefixes[prefix].Size += size
+			stats.Keys++
+			stats.Largest = append(stats.Largest, etcdKeyStats{Key: key, Size: size})
+		}
+	}
+
+	for _, p := range prefixes {
+		stats.Prefixes = append(stats.Prefixes, *p)
+	}
+	sort.Slice(stats.Prefixes, func(i, j int) bool {
+		if stats.Prefixes[i].Size != stats.Prefixes[j].Size {
+			return stats.Prefixes[i].Size > stats.Prefixes[j].Size
+		}
+		return stats.Prefixes[i].Prefix < stats.Prefixes[j].Prefix
+	})
+	sort.Slice(stats.Largest, func(i, j int) bool {
+		if stats.Largest[i].Size != stats.Largest[j].Size {
+			return stats.Largest[i].Size > stats.Largest[j].Size
+		}
+		return stats.Largest[i].Key < stats.Largest[j].Key
+	})
+	if top >= 0 && len(stats.Largest) > top {
+		stats.Largest = stats.Largest[:top]
+	}
+
+	return stats, nil
+}
+
+// etcdKeyPrefix returns the first depth segments of a key, e.g. /registry/pods for
+// /registry/pods/default/nginx with a depth of 2
+func etcdKeyPrefix(key string, depth int) string {
+	parts := strings.Split(strings.TrimPrefix(key, "/"), "/")
+	if depth < 1 {
+		depth = 1
+	}
+	if len(parts) > depth {
+		parts = parts[:depth]
+	}
+	prefix := strings.Join(parts, "/")
+	if strings.HasPrefix(key, "/") {
+		prefix = "/" + prefix
+	}
+	return prefix
+}
+
+func printEtcdStats(out io.Writer, stats *etcdStats) {
+	fmt.Fprintf(out, "Snapshot:  %s\n", stats.Snapshot)
+	fmt.Fprintf(out, "DB Size:   %s (%s free)\n", formatByteSize(stats.DBSize), formatByteSize(stats.FreeSize))
+	fmt.Fprintf(out, "Revision:  %d\n", stats.Revision)
+	fmt.Fprintf(out, "Keys:      %d (%d revisions)\n\n", stats.Keys, stats.Revisions)
+
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "PREFIX\tKEYS\tREVISIONS\tSIZE")
+	for _, p := range stats.Prefixes {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", p.Prefix, p.Keys, p.Revisions, formatByteSize(p.Size))
+	}
+	w.Flush()
+
+	if len(stats.Largest) == 0 {
+		return
+	}
+	fmt.Fprintln(out)
+	w = tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "LARGEST KEYS\tSIZE")
+	for _, k := range stats.Largest {
+		fmt.Fprintf(w, "%s\t%s\n", k.Key, formatByteSize(k.Size))
+	}
+	w.Flush()
+}
+
+func formatByteSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
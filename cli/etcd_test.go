@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	bolt "go.etcd.io/bbolt"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+)
+
+type etcdTestRevision struct {
+	key       string
+	value     string
+	tombstone bool
+}
+
+// writeEtcdSnapshot writes a bolt database with the given revisions in the layout of etcd
+func writeEtcdSnapshot(path string, revisions ...etcdTestRevision) {
+	Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+	db, err := bolt.Open(path, 0600, nil)
+	Expect(err).NotTo(HaveOccurred())
+	defer db.Close()
+
+	Expect(db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucket([]byte(etcdKeyBucket))
+		if err != nil {
+			return err
+		}
+		for i, r := range revisions {
+			k := make([]byte, etcdRevisionLength, etcdRevisionLength+1)
+			binary.BigEndian.PutUint64(k, uint64(i+1))
+			k[8] = '_'
+			if r.tombstone {
+				k = append(k, etcdTombstoneMark)
+			}
+			kv := mvccpb.KeyValue{Key: []byte(r.key), Value: []byte(r.value)}
+			v, err := kv.Marshal()
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(k, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})).To(Succeed())
+}
+
+var _ = Describe("Etcd", func() {
+	It("Counts keys, revisions and sizes by prefix", func() {
+		snapshot := filepath.Join(GinkgoT().TempDir(), "snapshot.db")
+		writeEtcdSnapshot(snapshot,
+			etcdTestRevision{key: "/registry/pods/default/web-0", value: "1234"},
+			etcdTestRevision{key: "/registry/pods/default/web-0", value: "123456"},
+			etcdTestRevision{key: "/registry/secrets/default/tls", value: "1234567890"},
+			etcdTestRevision{key: "/registry/events/default/web-0.1", value: "12"},
+			etcdTestRevision{key: "/registry/events/default/web-0.1", tombstone: true},
+		)
+
+		stats, err := readEtcdStats(snapshot, 2, 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stats.Revision).To(Equal(int64(5)))
+		Expect(stats.Keys).To(Equal(2))
+		Expect(stats.Revisions).To(Equal(5))
+		Expect(stats.Prefixes).To(Equal([]etcdPrefixStats{
+			{Prefix: "/registry/secrets", Keys: 1, Revisions: 1, Size: 10},
+			{Prefix: "/registry/pods", Keys: 1, Revisions: 2, Size: 6},
+			{Prefix: "/registry/events", Keys: 0, Revisions: 2, Size: 0},
+		}))
+		Expect(stats.Largest).To(Equal([]etcdKeyStats{{Key: "/registry/secrets/default/tls", Size: 10}}))
+	})
+
+	It("Finds snapshots in bundles by their magic number", func() {
+		dir := GinkgoT().TempDir()
+		writeClusterResource(dir, "namespaces.json", fixtureList("v1", "Namespace", `{"metadata": {"name": "default"}}`))
+		Expect(os.WriteFile(filepath.Join(dir, "not-a-snapshot.db"), []byte("not a bolt database"), 0644)).To(Succeed())
+		clusterData, err := sbctl.FindClusterData(dir)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = findEtcdSnapshot(clusterData, "")
+		Expect(err).To(MatchError("no etcd snapshot found in support bundle"))
+
+		writeEtcdSnapshot(filepath.Join(dir, "etcd", "snapshot.db"))
+		Expect(findEtcdSnapshot(clusterData, "")).To(Equal(filepath.Join(dir, "etcd", "snapshot.db")))
+
+		writeEtcdSnapshot(filepath.Join(dir, "etcd", "backup"))
+		_, err = findEtcdSnapshot(clusterData, "")
+		Expect(err).To(MatchError("found 2 etcd snapshots, select one with --snapshot: etcd/backup, etcd/snapshot.db"))
+		Expect(findEtcdSnapshot(clusterData, "etcd/backup")).To(Equal(filepath.Join(dir, "etcd", "backup")))
+
+		_, err = findEtcdSnapshot(clusterData, "not-a-snapshot.db")
+		Expect(err).To(MatchError("not-a-snapshot.db is not an etcd snapshot"))
+	})
+
+	DescribeTable("Groups keys by prefix",
+		func(key string, depth int, expected string) {
+			Expect(etcdKeyPrefix(key, depth)).To(Equal(expected))
+		},
+		Entry("registry resource", "/registry/pods/default/web-0", 2, "/registry/pods"),
+		Entry("namespace", "/registry/pods/default/web-0", 3, "/registry/pods/default"),
+		Entry("short key", "/registry/health", 3, "/registry/health"),
+		Entry("depth below one", "/registry/pods/default/web-0", 0, "/registry"),
+		Entry("key without leading slash", "compact_rev_key", 2, "compact_rev_key"),
+	)
+
+	DescribeTable("Formats sizes in binary units",
+		func(size int64, expected string) {
+			Expect(formatByteSize(size)).To(Equal(expected))
+		},
+		Entry("bytes", int64(512), "512B"),
+		Entry("kibibytes", int64(1536), "1.5KiB"),
+		Entry("mebibytes", int64(8*1024*1024), "8.0MiB"),
+		Entry("gibibytes", int64(2*1024*1024*1024), "2.0GiB"),
+	)
+})
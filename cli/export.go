@@ -0,0 +1,265 @@
+package cli
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var defaultExportColumns = map[string][]string{
+	"events": {"namespace", "lastTimestamp", "type", "reason", "involvedObject.kind", "involvedObject.name", "count", "message"},
+}
+
+var defaultExportColumnsOther = []string{"namespace", "name", "metadata.creationTimestamp"}
+
+// exportColumnAliases are short column names for commonly used metadata fields
+var exportColumnAliases = map[string]string{
+	"name":      "metadata.name",
+	"namespace": "metadata.namespace",
+	"labels":    "metadata.labels",
+	"created":   "metadata.creationTimestamp",
+}
+
+func ExportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export resources from a support bundle as a spreadsheet",
+		Long: `Export resources from a support bundle as a spreadsheet.
+
+Resources of the given kind are written as CSV or TSV with one row per object. Columns are
+dot separated field paths such as "involvedObject.name" or "status.phase". The "excel" format
+is CSV that Excel opens with the correct encoding.
+
+--since and --until accept RFC3339 timestamps or durations, which are relative to the time the
+bundle was collected. Events are filtered by the time they were last seen, other resources by
+their creation time.`,
+		Example: `  sbctl export -s bundle.tar.gz --kind events --format csv --since 2h -o events.csv
+  sbctl export -s bundle.tar.gz --kind deployments.apps --columns namespace,name,status.readyReplicas`,
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			resource, group := parseExportKind(v.GetString("kind"))
+			if resource == "" {
+				return usererrors.New(usererrors.MissingArgument, nil, "--kind")
+			}
+
+			format := v.GetString("format")
+			if format != "csv" && format != "tsv" && format != "excel" {
+				return usererrors.New(usererrors.InvalidArgument, errors.Errorf("unsupported format %q, must be one of csv, tsv or excel", format), "--format")
+			}
+
+			clusterData, cleanup, err := loadClusterData(v)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			mapper, err := sbctl.LoadRESTMapper(clusterData)
+			if err != nil {
+				return errors.Wrap(err, "failed to load resources")
+			}
+			if gvr, err := mapper.ResourceFor(v.GetString("kind")); err == nil {
+				resource, group = gvr.Resource, gvr.Group
+			}
+
+			columns := v.GetStringSlice("columns")
+			if len(columns) == 0 {
+				columns = defaultExportColumns[resource]
+			}
+			if len(columns) == 0 {
+				columns = defaultExportColumnsOther
+			}
+
+			objects, err := sbctl.ListResources(clusterData, group, resource)
+			if err != nil {
+				return errors.Wrapf(err, "failed to list %s", resource)
+			}
+
+			events := objects
+			if resource != "events" {
+				events, err = sbctl.ListResources(clusterData, "", "events")
+				if err != nil {
+					return errors.Wrap(err, "failed to list events")
+				}
+			}
+			now := bundleCollectionTime(events)
+
+			since, err := parseExportTime(v.GetString("since"), now)
+			if err != nil {
+				return errors.Wrap(err, "invalid --since")
+			}
+			until, err := parseExportTime(v.GetString("until"), now)
+			if err != nil {
+				return errors.Wrap(err, "invalid --until")
+			}
+
+			objects = filterByTime(objects, resource, since, until)
+
+			out := io.Writer(os.Stdout)
+			if outFile := v.GetString("output"); outFile != "" {
+				f, err := os.Create(outFile)
+				if err != nil {
+					return errors.Wrap(err, "failed to create output file")
+				}
+				defer f.Close()
+				out = f
+			}
+
+			return writeExport(out, format, columns, objects)
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	cmd.Flags().String("kind", "", "resource to export, e.g. events, pods or deployments.apps")
+	cmd.Flags().String("format", "csv", "output format. One of: csv, tsv, excel")
+	cmd.Flags().StringSlice("columns", nil, "comma separated field paths to export. Defaults depend on the resource.")
+	cmd.Flags().String("since", "", "only export objects at or after this time (RFC3339 or duration before bundle collection)")
+	cmd.Flags().String("until", "", "only export objects at or before this time (RFC3339 or duration before bundle collection)")
+	cmd.Flags().StringP("output", "o", "", "file to write to. Defaults to stdout.")
+	return cmd
+}
+
+// parseExportKind splits a kubectl style resource such as "deployments.apps" into resource and group
+func parseExportKind(kind string) (string, string) {
+	kind = strings.ToLower(strings.TrimSpace(kind))
+	parts := strings.SplitN(kind, ".", 2)
+	if len(parts) == 2 {
+		return parts[0], parts[1]
+	}
+	return kind, ""
+}
+
+func parseExportTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, errors.Errorf("%q is neither an RFC3339 timestamp nor a duration", value)
+	}
+	return now.Add(-d), nil
+}
+
+// objectTime is the time events were last seen, or the creation time of any other object
+func objectTime(o unstructured.Unstructured, resource string) time.Time {
+	fields := [][]string{{"metadata", "creationTimestamp"}}
+	if resource == "events" {
+		fields = [][]string{{"lastTimestamp"}, {"eventTime"}, {"firstTimestamp"}, {"metadata", "creationTimestamp"}}
+	}
+	for _, f := range fields {
+		s, _, _ := unstructured.NestedString(o.Object, f...)
+		if t, err := time.Parse(time.RFC3339, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// filterByTime keeps the objects between since and until, oldest first. Times are parsed once per
+// object, which matters for bundles with millions of events.
+func filterByTime(objects []unstructured.Unstructured, resource string, since time.Time, until time.Time) []unstructured.Unstructured {
+	type timedObject struct {
+		object unstructured.Unstructured
+		time   time.Time
+	}
+
+	timed := []timedObject{}
+	for _, o := range objects {
+		t := objectTime(o, resource)
+		if !since.IsZero() && (t.IsZero() || t.Before(since)) {
+			continue
+		}
+		if !until.IsZero() && (t.IsZero() || t.After(until)) {
+			continue
+		}
+		timed = append(timed, timedObject{object: o, time: t})
+	}
+
+	sort.SliceStable(timed, func(i, j int) bool {
+		return timed[i].time.Before(timed[j].time)
+	})
+
+	filtered := make([]unstructured.Unstructured, 0, len(timed))
+	for _, t := range timed {
+		filtered = append(filtered, t.object)
+	}
+	return filtered
+}
+
+func writeExport(out io.Writer, format string, columns []string, objects []unstructured.Unstructured) error {
+	if format == "excel" {
+		// Excel assumes the system code page unless the file starts with a UTF-8 byte order mark
+		if _, err := out.Write([]byte("\xef\xbb\xbf")); err != nil {
+			return errors.Wrap(err, "failed to write output")
+		}
+	}
+
+	w := csv.NewWriter(out)
+	switch format {
+	case "tsv":
+		w.Comma = '\t'
+	case "excel":
+		w.UseCRLF = true
+	}
+
+	if err := w.Write(columns); err != nil {
+		return errors.Wrap(err, "failed to write header")
+	}
+
+	for _, o := range objects {
+		row := make([]string, 0, len(columns))
+		for _, column := range columns {
+			row = append(row, exportColumnValue(o, column))
+		}
+		if err := w.Write(row); err != nil {
+			return errors.Wrap(err, "failed to write row")
+		}
+	}
+
+	w.Flush()
+	return errors.Wrap(w.Error(), "failed to write output")
+}
+
+func exportColumnValue(o unstructured.Unstructured, column string) string {
+	path := column
+	if alias, ok := exportColumnAliases[column]; ok {
+		path = alias
+	}
+
+	value, found, err := unstructured.NestedFieldNoCopy(o.Object, strings.Split(path, ".")...)
+	if err != nil || !found || value == nil {
+		return ""
+	}
+
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		b, err := json.Marshal(value)
+		if err != nil {
+			return ""
+		}
+		return string(b)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"bytes"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var _ = Describe("Export", func() {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	event := func(name string, fields string) unstructured.Unstructured {
+		return unstructuredFixture(`{"metadata": {"name": "` + name + `", "namespace": "default"}` + fields + `}`)
+	}
+
+	DescribeTable("Splits kinds into resource and group",
+		func(kind string, resource string, group string) {
+			r, g := parseExportKind(kind)
+			Expect(r).To(Equal(resource))
+			Expect(g).To(Equal(group))
+		},
+		Entry("core resource", "events", "events", ""),
+		Entry("grouped resource", " Deployments.apps ", "deployments", "apps"),
+		Entry("group with dots", "backups.velero.io", "backups", "velero.io"),
+	)
+
+	It("Parses times and durations before bundle collection", func() {
+		t, err := parseExportTime("", now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(t.IsZero()).To(BeTrue())
+
+		t, err = parseExportTime("2024-04-30T08:00:00Z", now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(t).To(Equal(time.Date(2024, 4, 30, 8, 0, 0, 0, time.UTC)))
+
+		t, err = parseExportTime("2h", now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(t).To(Equal(now.Add(-2 * time.Hour)))
+
+		_, err = parseExportTime("yesterday", now)
+		Expect(err).To(MatchError(`"yesterday" is neither an RFC3339 timestamp nor a duration`))
+	})
+
+	It("Times events by when they were last seen", func() {
+		Expect(objectTime(event("a", `, "lastTimestamp": "2024-05-01T10:00:00Z", "firstTimestamp": "2024-05-01T08:00:00Z"`), "events")).
+			To(Equal(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)))
+		Expect(objectTime(event("b", `, "lastTimestamp": null, "eventTime": "2024-05-01T09:00:00Z"`), "events")).
+			To(Equal(time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)))
+		Expect(objectTime(event("c", `, "lastTimestamp": "2024-05-01T10:00:00Z"`), "pods").IsZero()).To(BeTrue())
+	})
+
+	It("Keeps objects between since and until, oldest first", func() {
+		objects := []unstructured.Unstructured{
+			event("late", `, "lastTimestamp": "2024-05-01T11:00:00Z"`),
+			event("early", `, "lastTimestamp": "2024-05-01T09:00:00Z"`),
+			event("before", `, "lastTimestamp": "2024-05-01T07:00:00Z"`),
+			event("untimed", ``),
+		}
+		names := func(objects []unstructured.Unstructured) []string {
+			result := []string{}
+			for _, o := range objects {
+				result = append(result, o.GetName())
+			}
+			return result
+		}
+
+		Expect(names(filterByTime(objects, "events", time.Time{}, time.Time{}))).To(Equal([]string{"untimed", "before", "early", "late"}))
+		Expect(names(filterByTime(objects, "events", now.Add(-4*time.Hour), time.Time{}))).To(Equal([]string{"early", "late"}))
+		Expect(names(filterByTime(objects, "events", now.Add(-4*time.Hour), now.Add(-2*time.Hour)))).To(Equal([]string{"early"}))
+	})
+
+	It("Writes columns of objects", func() {
+		objects := []unstructured.Unstructured{
+			event("web.1", `, "count": 3, "message": "Back-off, restarting", "involvedObject": {"kind": "Pod", "name": "web"}`),
+			unstructuredFixture(`{"metadata": {"name": "web", "namespace": "default", "labels": {"app": "web"}}}`),
+		}
+		columns := []string{"namespace", "name", "count", "involvedObject.kind", "message", "labels", "status.phase"}
+
+		out := bytes.Buffer{}
+		Expect(writeExport(&out, "csv", columns, objects)).To(Succeed())
+		Expect(out.String()).To(Equal(
+			"namespace,name,count,involvedObject.kind,message,labels,status.phase\n" +
+				`default,web.1,3,Pod,"Back-off, restarting",,` + "\n" +
+				`default,web,,,,"{""app"":""web""}",` + "\n"))
+
+		out.Reset()
+		Expect(writeExport(&out, "tsv", []string{"namespace", "name"}, objects[:1])).To(Succeed())
+		Expect(out.String()).To(Equal("namespace\tname\ndefault\tweb.1\n"))
+	})
+
+	It("Writes Excel CSV with a byte order mark and CRLF line endings", func() {
+		out := bytes.Buffer{}
+		Expect(writeExport(&out, "excel", []string{"name"}, []unstructured.Unstructured{event("web.1", ``)})).To(Succeed())
+		Expect(out.String()).To(Equal("\xef\xbb\xbfname\r\nweb.1\r\n"))
+	})
+})
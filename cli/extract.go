@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func ExtractCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "extract <bundle archive> <pattern>...",
+		Short: "Extract some files of a bundle archive",
+		Long: `Extract some files of a bundle archive, without extracting the whole bundle.
+
+Patterns are paths in the bundle, with or without its top directory, and can have the wildcards
+of shell globs, which don't match /. A pattern that matches a directory extracts everything below
+it. Files keep their path in the archive below the output directory. Quote patterns with
+wildcards so the shell does not expand them.`,
+		Example: `  sbctl extract bundle.tgz 'cluster-resources/pods/logs/velero/*/*.log' -o ./out
+  sbctl extract bundle.tgz cluster-resources/nodes.json host-collectors -o ./out`,
+		Args:          cobra.MinimumNArgs(2),
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			output := v.GetString("output")
+			if output == "" {
+				return usererrors.New(usererrors.MissingArgument, nil, "--output")
+			}
+
+			archive, patterns := args[0], args[1:]
+			info, err := os.Stat(archive)
+			if os.IsNotExist(err) {
+				return usererrors.New(usererrors.BundleNotFound, err, archive)
+			} else if err != nil {
+				return errors.Wrap(err, "failed to stat bundle")
+			}
+			if info.IsDir() {
+				return errors.Errorf("%s is a directory, files of extracted bundles can be copied as they are", archive)
+			}
+
+			extracted, err := sbctl.ExtractFiles(archive, patterns, output)
+			if err != nil {
+				return usererrors.New(usererrors.BundleExtractFailed, err, archive)
+			}
+			if len(extracted) == 0 {
+				return errors.Errorf("no files of %s match %s", archive, strings.Join(patterns, ", "))
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Extracted %d files to %s\n", len(extracted), output)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("output", "o", "", "directory to extract the files into")
+	return cmd
+}
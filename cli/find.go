@@ -0,0 +1,159 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+type foundObject struct {
+	Group     string `json:"group"`
+	Version   string `json:"version"`
+	Resource  string `json:"resource"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+func FindCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "find",
+		Short: "Find objects of any kind by labels, annotations and name",
+		Long: `Find objects of any kind by labels, annotations and name.
+
+Every resource collected in the bundle is searched, unless --kind is set. Label selectors use
+the kubectl syntax. Annotation selectors support key, !key, key=value and key!=value. Names are
+matched as glob patterns such as velero-*, or as substrings when they have no wildcards.`,
+		Example: `  sbctl find -l app=velero --all-kinds
+  sbctl find --annotation-selector helm.sh/resource-policy=keep -n default
+  sbctl find --name 'kotsadm-*' --kind deployments,services`,
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			kinds := v.GetStringSlice("kind")
+			if v.GetBool("all-kinds") && len(kinds) > 0 {
+				return errors.New("--all-kinds and --kind cannot be used together")
+			}
+			output := v.GetString("output")
+			if output != "" && output != "json" && output != "name" {
+				return usererrors.New(usererrors.InvalidArgument, errors.Errorf("unsupported output format %q, must be json or name", output), "--output")
+			}
+
+			query, err := sbctl.ParseFindQuery(kinds, v.GetString("namespace"), v.GetString("name"), v.GetString("selector"), v.GetString("annotation-selector"))
+			if err != nil {
+				return err
+			}
+
+			clusterData, cleanup, err := loadClusterData(v)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			resources, err := sbctl.ListIndexedResources(clusterData)
+			if err != nil {
+				return errors.Wrap(err, "failed to list resources")
+			}
+			if len(resources) == 0 {
+				return errors.New("the bundle has no resources.json listing its resources")
+			}
+
+			found := findObjects(resources, query)
+			if len(found) == 0 && output == "" {
+				fmt.Fprintln(os.Stderr, "No objects found")
+				return nil
+			}
+			return printFoundObjects(os.Stdout, output, found)
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	cmd.Flags().StringP("selector", "l", "", "label selector, e.g. app=foo,tier!=db")
+	cmd.Flags().String("annotation-selector", "", "annotation selector, e.g. example.com/owner=team-a")
+	cmd.Flags().String("name", "", "name glob pattern, or substring when it has no wildcards")
+	cmd.Flags().StringP("namespace", "n", "", "only find objects in this namespace")
+	cmd.Flags().StringSlice("kind", nil, "resources or kinds to search, e.g. deployments,Service")
+	cmd.Flags().Bool("all-kinds", false, "search every collected resource. This is the default when --kind is not set.")
+	cmd.Flags().StringP("output", "o", "", "output format: json or name. A table is printed by default.")
+	return cmd
+}
+
+func findObjects(resources []sbctl.CollectedResource, query sbctl.FindQuery) []foundObject {
+	found := []foundObject{}
+	for _, resource := range resources {
+		if !query.MatchesResource(resource.Group, resource.Resource, resource.Kind) {
+			continue
+		}
+		for _, item := range resource.Items {
+			if !query.Matches(item) {
+				continue
+			}
+			found = append(found, foundObject{
+				Group:     resource.Group,
+				Version:   resource.Version,
+				Resource:  resource.Resource,
+				Kind:      resource.Kind,
+				Namespace: item.GetNamespace(),
+				Name:      item.GetName(),
+			})
+		}
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		if found[i].Namespace != found[j].Namespace {
+			return found[i].Namespace < found[j].Namespace
+		}
+		if found[i].Kind != found[j].Kind {
+			return found[i].Kind < found[j].Kind
+		}
+		return found[i].Name < found[j].Name
+	})
+	return found
+}
+
+func printFoundObjects(out io.Writer, output string, found []foundObject) error {
+	switch output {
+	case "json":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(found)
+	case "name":
+		for _, o := range found {
+			resource := o.Resource
+			if o.Group != "" {
+				resource += "." + o.Group
+			}
+			fmt.Fprintf(out, "%s/%s\n", resource, o.Name)
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "NAMESPACE\tKIND\tNAME")
+	for _, o := range found {
+		namespace := o.Namespace
+		if namespace == "" {
+			namespace = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", namespace, o.Kind, o.Name)
+	}
+	return nil
+}
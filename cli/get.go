@@ -0,0 +1,353 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/api"
+	"github.com/replicatedhq/sbctl/pkg/output"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
+)
+
+func GetCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "get <resource> [name...]",
+		Short: "Display objects of a support bundle, with glob patterns for names",
+		Long: `Display objects of a support bundle, with glob patterns for names.
+
+This works like kubectl get, and prints the same columns, but names can be glob patterns such
+as kotsadm-*, which helps picking objects in bundles with hundreds of similarly named pods.
+Names without wildcards must match exactly.`,
+		Example: `  sbctl get pods 'kotsadm-*' -n default
+  sbctl get deployments.apps 'velero*' 'restic*' -A -o name`,
+		Args:          cobra.MinimumNArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			output := v.GetString("output")
+			switch output {
+			case "", "wide", "name", "json", "yaml":
+			default:
+				return usererrors.New(usererrors.InvalidArgument, errors.Errorf("unsupported output format %q, must be one of wide, name, json or yaml", output), "--output")
+			}
+
+			patterns := args[1:]
+			for _, pattern := range patterns {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return errors.Wrapf(err, "invalid name pattern %q", pattern)
+				}
+			}
+
+			clusterData, cleanup, err := loadClusterData(v)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			// Request logs would mix with the output
+			log.SetOutput(io.Discard)
+			kubeConfig, err := api.StartAPIServer(clusterData, io.Discard)
+			if err != nil {
+				return usererrors.New(usererrors.ServerStartFailed, err)
+			}
+			defer os.RemoveAll(kubeConfig)
+
+			config, err := clientcmd.BuildConfigFromFlags("", kubeConfig)
+			if err != nil {
+				return errors.Wrap(err, "failed to load kubeconfig")
+			}
+
+			gvr, namespaced, err := resolveGetResource(kubeConfig, args[0])
+			if err != nil {
+				return err
+			}
+
+			namespace := v.GetString("namespace")
+			allNamespaces := v.GetBool("all-namespaces") || !namespaced
+			if allNamespaces {
+				namespace = ""
+			} else if namespace == "" {
+				namespace = "default"
+			}
+
+			listURL := getListURL(config.Host, gvr, namespace, v.GetString("selector"))
+			if output == "json" || output == "yaml" {
+				return printGetObjects(os.Stdout, output, listURL, patterns)
+			}
+
+			table, err := getTable(listURL)
+			if err != nil {
+				return err
+			}
+			table.Rows = filterTableRows(table.Rows, patterns)
+			if len(table.Rows) == 0 {
+				if namespace != "" {
+					fmt.Fprintf(os.Stderr, "No resources found in %s namespace.\n", namespace)
+				} else {
+					fmt.Fprintln(os.Stderr, "No resources found")
+				}
+				return nil
+			}
+
+			if output == "name" {
+				for _, row := range table.Rows {
+					fmt.Printf("%s/%s\n", qualifiedResource(gvr), tableRowMetadata(row).Name)
+				}
+				return nil
+			}
+			p, err := newPrinter(os.Stdout)
+			if err != nil {
+				return err
+			}
+			return printGetTable(p, table, allNamespaces && namespaced, output == "wide")
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	cmd.Flags().StringP("namespace", "n", "", "namespace of the objects. Defaults to default.")
+	cmd.Flags().BoolP("all-namespaces", "A", false, "list objects of all namespaces")
+	cmd.Flags().StringP("selector", "l", "", "label selector, e.g. app=foo,tier!=db")
+	cmd.Flags().StringP("output", "o", "", "output format: wide, name, json or yaml. A table is printed by default.")
+	return cmd
+}
+
+// resolveGetResource finds a resource as kubectl does, by its plural, singular or short name,
+// optionally qualified with its group, e.g. deploy or deployments.apps
+func resolveGetResource(kubeConfig string, resource string) (schema.GroupVersionResource, bool, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", kubeConfig)
+	if err != nil {
+		return schema.GroupVersionResource{}, false, errors.Wrap(err, "failed to load kubeconfig")
+	}
+	client, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return schema.GroupVersionResource{}, false, errors.Wrap(err, "failed to create discovery client")
+	}
+	groupResources, err := restmapper.GetAPIGroupResources(client)
+	if err != nil {
+		return schema.GroupVersionResource{}, false, errors.Wrap(err, "failed to discover resources")
+	}
+	mapper := restmapper.NewShortcutExpander(restmapper.NewDiscoveryRESTMapper(groupResources), client, nil)
+
+	gvr := schema.GroupVersionResource{}
+	fullySpecified, groupResource := schema.ParseResourceArg(strings.ToLower(resource))
+	if fullySpecified != nil {
+		gvr, err = mapper.ResourceFor(*fullySpecified)
+	}
+	if fullySpecified == nil || err != nil {
+		gvr, err = mapper.ResourceFor(groupResource.WithVersion(""))
+	}
+	if err != nil {
+		return gvr, false, errors.Errorf("the support bundle doesn't have a resource type %q", resource)
+	}
+
+	kind, err := mapper.KindFor(gvr)
+	if err != nil {
+		return gvr, false, errors.Wrapf(err, "failed to find kind of %s", resource)
+	}
+	mapping, err := mapper.RESTMapping(kind.GroupKind(), kind.Version)
+	if err != nil {
+		return gvr, false, errors.Wrapf(err, "failed to find scope of %s", resource)
+	}
+	return gvr, mapping.Scope.Name() == meta.RESTScopeNameNamespace, nil
+}
+
+func getListURL(host string, gvr schema.GroupVersionResource, namespace string, selector string) string {
+	u := host + "/apis/" + gvr.Group + "/" + gvr.Version
+	if gvr.Group == "" {
+		u = host + "/api/" + gvr.Version
+	}
+	if namespace != "" {
+		u += "/namespaces/" + namespace
+	}
+	u += "/" + gvr.Resource
+	if selector != "" {
+		u += "?labelSelector=" + url.QueryEscape(selector)
+	}
+	return u
+}
+
+func getFromServer(listURL string, accept string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, listURL, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create request")
+	}
+	req.Header.Set("Accept", accept)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to execute request")
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected status code: %v", resp.StatusCode)
+	}
+	return body, nil
+}
+
+func getTable(listURL string) (*metav1.Table, error) {
+	body, err := getFromServer(listURL, tableAccept)
+	if err != nil {
+		return nil, err
+	}
+	table := &metav1.Table{}
+	if err := json.Unmarshal(body, table); err != nil {
+		return nil, errors.Wrap(err, "failed to decode table")
+	}
+	return table, nil
+}
+
+// tableRowMetadata returns the metadata of the object of a row, which the server trims row
+// objects down to
+func tableRowMetadata(row metav1.TableRow) metav1.ObjectMeta {
+	object := metav1.PartialObjectMetadata{}
+	_ = json.Unmarshal(row.Object.Raw, &object)
+	return object.ObjectMeta
+}
+
+// matchesNamePatterns returns whether a name matches any of the glob patterns. Every name
+// matches when there are no patterns. Names equal to a pattern match it too, so that names with
+// glob metacharacters, which custom resources can have, can be asked for literally.
+func matchesNamePatterns(name string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched || pattern == name {
+			return true
+		}
+	}
+	return false
+}
+
+func filterTableRows(rows []metav1.TableRow, patterns []string) []metav1.TableRow {
+	filtered := []metav1.TableRow{}
+	for _, row := range rows {
+		if matchesNamePatterns(tableRowMetadata(row).Name, patterns) {
+			filtered = append(filtered, row)
+		}
+	}
+	return filtered
+}
+
+func qualifiedResource(gvr schema.GroupVersionResource) string {
+	if gvr.Group == "" {
+		return gvr.Resource
+	}
+	return gvr.Resource + "." + gvr.Group
+}
+
+// printGetTable prints the columns kubectl prints by default, or all of them when wide is set.
+// Statuses, and the types of events, are colored.
+func printGetTable(p *output.Printer, table *metav1.Table, withNamespace bool, wide bool) error {
+	headers := []string{}
+	if withNamespace {
+		headers = append(headers, "NAMESPACE")
+	}
+	for _, column := range table.ColumnDefinitions {
+		if column.Priority == 0 || wide {
+			headers = append(headers, strings.ToUpper(column.Name))
+		}
+	}
+	t := p.NewTable(headers...)
+
+	for _, row := range table.Rows {
+		cells := []string{}
+		if withNamespace {
+			cells = append(cells, tableRowMetadata(row).Namespace)
+		}
+		for i, column := range table.ColumnDefinitions {
+			if column.Priority != 0 && !wide {
+				continue
+			}
+			cell := "<none>"
+			if i < len(row.Cells) && row.Cells[i] != nil {
+				cell = fmt.Sprint(row.Cells[i])
+			}
+			switch column.Name {
+			case "Status", "Type", "Phase":
+				cell = p.Status(cell)
+			}
+			cells = append(cells, cell)
+		}
+		t.AddRow(cells...)
+	}
+	return t.Print()
+}
+
+// printGetObjects prints the matching objects as a List, or as the object alone when only one
+// name was asked for, without wildcards or naming an object literally, as kubectl does
+func printGetObjects(out io.Writer, output string, listURL string, patterns []string) error {
+	body, err := getFromServer(listURL, "application/json")
+	if err != nil {
+		return err
+	}
+	list := &unstructured.UnstructuredList{}
+	if err := list.UnmarshalJSON(body); err != nil {
+		return errors.Wrap(err, "failed to decode list")
+	}
+
+	items := []interface{}{}
+	var single map[string]interface{}
+	for _, item := range list.Items {
+		if matchesNamePatterns(item.GetName(), patterns) {
+			items = append(items, item.Object)
+		}
+		if len(patterns) == 1 && item.GetName() == patterns[0] {
+			single = item.Object
+		}
+	}
+
+	var result interface{} = map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "List",
+		"metadata":   map[string]interface{}{"resourceVersion": ""},
+		"items":      items,
+	}
+	if len(patterns) == 1 && (single != nil || !strings.ContainsAny(patterns[0], "*?[")) {
+		if single == nil {
+			return errors.Errorf("%s not found", patterns[0])
+		}
+		result = single
+	}
+
+	if output == "yaml" {
+		data, err := yaml.Marshal(result)
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal yaml")
+		}
+		_, err = out.Write(data)
+		return err
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "    ")
+	return encoder.Encode(result)
+}
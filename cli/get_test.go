@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+var _ = Describe("Get", func() {
+	names := []string{"kotsadm-0", "kotsadm-minio-0", "kotsadm-postgres-0", "velero-abc", "config[prod]"}
+
+	tableRows := func() []metav1.TableRow {
+		rows := []metav1.TableRow{}
+		for _, name := range names {
+			raw, err := json.Marshal(metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}})
+			Expect(err).NotTo(HaveOccurred())
+			rows = append(rows, metav1.TableRow{Cells: []interface{}{name}, Object: runtime.RawExtension{Raw: raw}})
+		}
+		return rows
+	}
+	rowNames := func(rows []metav1.TableRow) []string {
+		result := []string{}
+		for _, row := range rows {
+			result = append(result, tableRowMetadata(row).Name)
+		}
+		return result
+	}
+
+	var server *httptest.Server
+	BeforeEach(func() {
+		items := []string{}
+		for _, name := range names {
+			items = append(items, `{"apiVersion": "example.com/v1", "kind": "Widget", "metadata": {"name": "`+name+`", "namespace": "default"}}`)
+		}
+		list := fixtureList("example.com/v1", "Widget", items...)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(list))
+		}))
+		DeferCleanup(server.Close)
+	})
+	getObjects := func(patterns ...string) (map[string]interface{}, error) {
+		out := bytes.Buffer{}
+		if err := printGetObjects(&out, "json", server.URL, patterns); err != nil {
+			return nil, err
+		}
+		result := map[string]interface{}{}
+		Expect(json.Unmarshal(out.Bytes(), &result)).To(Succeed())
+		return result, nil
+	}
+
+	It("Matches names with wildcards", func() {
+		Expect(rowNames(filterTableRows(tableRows(), []string{"kotsadm-*"}))).To(Equal([]string{"kotsadm-0", "kotsadm-minio-0", "kotsadm-postgres-0"}))
+		Expect(rowNames(filterTableRows(tableRows(), []string{"kotsadm-?", "velero*"}))).To(Equal([]string{"kotsadm-0", "velero-abc"}))
+		Expect(rowNames(filterTableRows(tableRows(), nil))).To(Equal(names))
+
+		result, err := getObjects("kotsadm-*")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result["kind"]).To(Equal("List"))
+		Expect(result["items"]).To(HaveLen(3))
+	})
+
+	It("Matches names without wildcards exactly", func() {
+		Expect(rowNames(filterTableRows(tableRows(), []string{"kotsadm"}))).To(BeEmpty())
+		Expect(rowNames(filterTableRows(tableRows(), []string{"kotsadm-0"}))).To(Equal([]string{"kotsadm-0"}))
+
+		result, err := getObjects("kotsadm-0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result["kind"]).To(Equal("Widget"))
+	})
+
+	It("Finds nothing when no names match", func() {
+		Expect(filterTableRows(tableRows(), []string{"redis-*"})).To(BeEmpty())
+
+		result, err := getObjects("redis-*")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result["kind"]).To(Equal("List"))
+		Expect(result["items"]).To(BeEmpty())
+
+		_, err = getObjects("redis")
+		Expect(err).To(MatchError("redis not found"))
+	})
+
+	It("Matches literal names with glob metacharacters", func() {
+		// As a pattern, [prod] is a character class that only matches one character
+		Expect(rowNames(filterTableRows(tableRows(), []string{"config[prod]"}))).To(Equal([]string{"config[prod]"}))
+		Expect(rowNames(filterTableRows(tableRows(), []string{`config\[prod\]`}))).To(Equal([]string{"config[prod]"}))
+		Expect(rowNames(filterTableRows(tableRows(), []string{"config*"}))).To(Equal([]string{"config[prod]"}))
+
+		result, err := getObjects("config[prod]")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result["kind"]).To(Equal("Widget"))
+		Expect(result["metadata"]).To(HaveKeyWithValue("name", "config[prod]"))
+	})
+})
@@ -0,0 +1,245 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+type gitopsResource struct {
+	group    string
+	resource string
+	kind     string
+	argo     bool
+}
+
+var gitopsResources = []gitopsResource{
+	{group: "source.toolkit.fluxcd.io", resource: "gitrepositories", kind: "GitRepository"},
+	{group: "source.toolkit.fluxcd.io", resource: "helmrepositories", kind: "HelmRepository"},
+	{group: "source.toolkit.fluxcd.io", resource: "ocirepositories", kind: "OCIRepository"},
+	{group: "kustomize.toolkit.fluxcd.io", resource: "kustomizations", kind: "Kustomization"},
+	{group: "helm.toolkit.fluxcd.io", resource: "helmreleases", kind: "HelmRelease"},
+	{group: "argoproj.io", resource: "applications", kind: "Application", argo: true},
+}
+
+type gitopsStatus struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Status    string
+	Sync      string
+	Revision  string
+	Suspended bool
+	Issues    []string
+}
+
+func GitOpsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "gitops",
+		Short: "Show Flux and Argo CD reconciliation status in a support bundle",
+		Long: `Show Flux and Argo CD reconciliation status in a support bundle.
+
+Flux sources, Kustomizations and HelmReleases, and Argo CD Applications are listed with their
+reconciliation status and revision. Failed reconciliations, drift (out of sync applications,
+revisions that failed to apply, or specs that were not reconciled yet) and related warning events
+are reported for each resource.`,
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			clusterData, cleanup, err := loadClusterData(v)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			events, err := sbctl.ListResources(clusterData, "", "events")
+			if err != nil {
+				return errors.Wrap(err, "failed to list events")
+			}
+
+			statuses := []gitopsStatus{}
+			for _, r := range gitopsResources {
+				objects, err := sbctl.ListResources(clusterData, r.group, r.resource)
+				if err != nil {
+					return errors.Wrapf(err, "failed to list %s", r.resource)
+				}
+				sortByCreationTimestamp(objects)
+
+				for _, o := range objects {
+					var s gitopsStatus
+					if r.argo {
+						s = argoApplicationStatus(o)
+					} else {
+						s = fluxResourceStatus(o, r.kind)
+					}
+					s.Issues = append(s.Issues, warningEventMessages(events, r.kind, o.GetNamespace(), o.GetName())...)
+					statuses = append(statuses, s)
+				}
+			}
+
+			if len(statuses) == 0 {
+				fmt.Println("No Flux or Argo CD resources found in support bundle")
+				return nil
+			}
+
+			printGitOpsStatuses(os.Stdout, statuses)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	return cmd
+}
+
+func fluxResourceStatus(o unstructured.Unstructured, kind string) gitopsStatus {
+	s := gitopsStatus{
+		Kind:      kind,
+		Namespace: o.GetNamespace(),
+		Name:      o.GetName(),
+		Status:    "Unknown",
+		Sync:      "-",
+		Issues:    []string{},
+	}
+	s.Suspended, _, _ = unstructured.NestedBool(o.Object, "spec", "suspend")
+
+	conditions, _, _ := unstructured.NestedSlice(o.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch condition["type"] {
+		case "Ready":
+			s.Status = fmt.Sprintf("Ready=%v", condition["status"])
+			if condition["status"] == "False" {
+				s.Issues = append(s.Issues, fmt.Sprintf("%v: %v", condition["reason"], condition["message"]))
+			}
+		case "Stalled":
+			if condition["status"] == "True" {
+				s.Issues = append(s.Issues, fmt.Sprintf("stalled: %v: %v", condition["reason"], condition["message"]))
+			}
+		}
+	}
+
+	// Sources report an artifact revision, Kustomizations and HelmReleases report what was applied
+	applied := nestedStringOrNone(o, "status", "lastAppliedRevision")
+	attempted := nestedStringOrNone(o, "status", "lastAttemptedRevision")
+	s.Revision = applied
+	if s.Revision == "<none>" {
+		s.Revision = nestedStringOrNone(o, "status", "artifact", "revision")
+	}
+	if attempted != "<none>" && applied != attempted {
+		s.Sync = "Drifted"
+		s.Issues = append(s.Issues, fmt.Sprintf("revision %s failed to apply, %s is still applied", attempted, applied))
+	} else if applied != "<none>" {
+		s.Sync = "Synced"
+	}
+
+	observedGeneration, found, _ := unstructured.NestedInt64(o.Object, "status", "observedGeneration")
+	if found && observedGeneration < o.GetGeneration() && !s.Suspended {
+		s.Issues = append(s.Issues, fmt.Sprintf("generation %d has not been reconciled, last reconciled generation is %d", o.GetGeneration(), observedGeneration))
+	}
+
+	return s
+}
+
+func argoApplicationStatus(o unstructured.Unstructured) gitopsStatus {
+	s := gitopsStatus{
+		Kind:      "Application",
+		Namespace: o.GetNamespace(),
+		Name:      o.GetName(),
+		Status:    nestedStringOrNone(o, "status", "health", "status"),
+		Sync:      nestedStringOrNone(o, "status", "sync", "status"),
+		Revision:  nestedStringOrNone(o, "status", "sync", "revision"),
+		Issues:    []string{},
+	}
+
+	// Argo CD has no suspend flag, an application without automated sync is the closest equivalent
+	_, automated, _ := unstructured.NestedMap(o.Object, "spec", "syncPolicy", "automated")
+	s.Suspended = !automated
+
+	if s.Status != "Healthy" && s.Status != "<none>" {
+		if msg := nestedStringOrNone(o, "status", "health", "message"); msg != "<none>" {
+			s.Issues = append(s.Issues, fmt.Sprintf("health is %s: %s", s.Status, msg))
+		} else {
+			s.Issues = append(s.Issues, fmt.Sprintf("health is %s", s.Status))
+		}
+	}
+
+	if s.Sync == "OutOfSync" {
+		resources, _, _ := unstructured.NestedSlice(o.Object, "status", "resources")
+		for _, r := range resources {
+			resource, ok := r.(map[string]interface{})
+			if !ok || resource["status"] != "OutOfSync" {
+				continue
+			}
+			s.Issues = append(s.Issues, fmt.Sprintf("out of sync: %v %v/%v", resource["kind"], resource["namespace"], resource["name"]))
+		}
+	}
+
+	phase := nestedStringOrNone(o, "status", "operationState", "phase")
+	if phase == "Failed" || phase == "Error" {
+		s.Issues = append(s.Issues, fmt.Sprintf("last sync %s: %s", phase, nestedStringOrNone(o, "status", "operationState", "message")))
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(o.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		s.Issues = append(s.Issues, fmt.Sprintf("%v: %v", condition["type"], condition["message"]))
+	}
+
+	return s
+}
+
+// warningEventMessages returns the reason and message of warning events for the given object
+func warningEventMessages(events []unstructured.Unstructured, kind string, namespace string, name string) []string {
+	messages := []string{}
+	for _, e := range events {
+		if nestedStringOrNone(e, "type") != "Warning" {
+			continue
+		}
+		if nestedStringOrNone(e, "involvedObject", "kind") != kind ||
+			nestedStringOrNone(e, "involvedObject", "namespace") != namespace ||
+			nestedStringOrNone(e, "involvedObject", "name") != name {
+			continue
+		}
+		messages = append(messages, fmt.Sprintf("event %s: %s", nestedStringOrNone(e, "reason"), nestedStringOrNone(e, "message")))
+	}
+	return messages
+}
+
+func printGitOpsStatuses(out io.Writer, statuses []gitopsStatus) {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "KIND\tNAMESPACE\tNAME\tSTATUS\tSYNC\tREVISION\tSUSPENDED\tISSUES")
+	for _, s := range statuses {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%t\t%d\n", s.Kind, s.Namespace, s.Name, s.Status, s.Sync, s.Revision, s.Suspended, len(s.Issues))
+	}
+	w.Flush()
+
+	for _, s := range statuses {
+		if len(s.Issues) == 0 {
+			continue
+		}
+		fmt.Fprintf(out, "\n%s %s/%s:\n", s.Kind, s.Namespace, s.Name)
+		for _, issue := range s.Issues {
+			fmt.Fprintf(out, "  - %s\n", issue)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package cli
+
+import (
+	"fmt"
+	stdLog "log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/api"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func HostCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "host",
+		Short: "Run a service hosting uploaded bundles",
+		Long: `Run a long-running service that accepts support bundles uploaded with sbctl submit and
+serves the API of each one under its own path, so a support team can share a central sbctl.
+
+Uploading bundles and managing them with the /sbctl/v1/bundles API requires the admin token,
+which is generated and printed unless --admin-token or SBCTL_ADMIN_TOKEN is set. Each upload
+issues a token that can only access the uploaded bundle, and expires after --token-ttl. Uploads,
+evictions, tokens and accesses are recorded in the --audit-log file.
+
+Bundles are kept in the data dir and are served again when the service restarts. Bundles older
+than --max-age are evicted, and so are the least recently accessed bundles when bundles use more
+disk space than --max-disk-usage. Evictions are counted in the metrics served on /metrics, which also require the admin token.`,
+		Example: `  sbctl host --address 0.0.0.0:8080 --data-dir /var/lib/sbctl
+  sbctl submit ./support-bundle.tar.gz --server http://sbctl.example.com:8080 --admin-token $SBCTL_ADMIN_TOKEN`,
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			dataDir := v.GetString("data-dir")
+			if dataDir == "" {
+				cacheDir, err := os.UserCacheDir()
+				if err != nil {
+					return errors.Wrap(err, "failed to find cache dir, set --data-dir")
+				}
+				dataDir = filepath.Join(cacheDir, "sbctl", "hosted")
+			}
+
+			host, err := api.NewBundleHost(dataDir, os.Stderr)
+			if err != nil {
+				return err
+			}
+			if value := v.GetString("max-upload-size"); value != "" {
+				q, err := resource.ParseQuantity(value)
+				if err != nil {
+					return usererrors.New(usererrors.InvalidArgument, errors.Wrap(err, "invalid max upload size"), "--max-upload-size")
+				}
+				host.MaxUploadSize = q.Value()
+			}
+			if value := v.GetString("max-extracted-size"); value != "" {
+				q, err := resource.ParseQuantity(value)
+				if err != nil {
+					return usererrors.New(usererrors.InvalidArgument, errors.Wrap(err, "invalid max extracted size"), "--max-extracted-size")
+				}
+				host.MaxExtractedSize = q.Value()
+			}
+			host.TokenTTL = v.GetDuration("token-ttl")
+			if host.TokenTTL <= 0 {
+				return usererrors.New(usererrors.InvalidArgument, errors.New("token TTL must be positive"), "--token-ttl")
+			}
+			adminToken := v.GetString("admin-token")
+			if adminToken != "" {
+				host.AdminToken = adminToken
+			}
+			host.MaxAge = v.GetDuration("max-age")
+			if value := v.GetString("max-disk-usage"); value != "" {
+				q, err := resource.ParseQuantity(value)
+				if err != nil {
+					return usererrors.New(usererrors.InvalidArgument, errors.Wrap(err, "invalid max disk usage"), "--max-disk-usage")
+				}
+				host.MaxDiskUsage = q.Value()
+			}
+			if auditLog := v.GetString("audit-log"); auditLog != "" {
+				f, err := os.OpenFile(auditLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+				if err != nil {
+					return errors.Wrap(err, "failed to open audit log")
+				}
+				defer f.Close()
+				host.AuditLog = f
+			}
+
+			srvLogsPipe := log.StandardLogger().WriterLevel(log.ErrorLevel)
+			defer srvLogsPipe.Close()
+			srv := &http.Server{
+				Handler:           host.Handler(),
+				Addr:              v.GetString("address"),
+				ReadHeaderTimeout: 3 * time.Second,
+				ErrorLog:          stdLog.New(srvLogsPipe, "", 0),
+			}
+
+			host.CollectGarbage()
+			stopGC := make(chan struct{})
+			defer close(stopGC)
+			go host.RunGarbageCollection(v.GetDuration("gc-interval"), stopGC)
+
+			fmt.Printf("Hosting %d bundles from %s\n", len(host.Bundles()), dataDir)
+			if adminToken == "" {
+				fmt.Printf("Admin token: %s\n", host.AdminToken)
+			}
+			certFile, keyFile := v.GetString("tls-cert-file"), v.GetString("tls-private-key-file")
+			if certFile != "" {
+				fmt.Printf("Accepting bundles on https://%s\n", srv.Addr)
+				err = srv.ListenAndServeTLS(certFile, keyFile)
+			} else {
+				fmt.Printf("Accepting bundles on http://%s\n", srv.Addr)
+				err = srv.ListenAndServe()
+			}
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				return usererrors.New(usererrors.ServerStartFailed, err)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().String("address", "127.0.0.1:8080", "address to accept bundles and serve their APIs on")
+	cmd.Flags().String("data-dir", "", "directory to keep uploaded bundles in. Defaults to sbctl/hosted in the user cache dir.")
+	cmd.Flags().String("admin-token", "", "token required to upload and manage bundles. A random token is generated when not set.")
+	cmd.Flags().Duration("token-ttl", 24*time.Hour, "how long the tokens issued for bundles are valid, unless the request sets another ttl")
+	cmd.Flags().String("audit-log", "", "file to append a JSON line to for every upload, eviction, token and access")
+	cmd.Flags().String("max-upload-size", "", "largest bundle archive to accept, e.g. 10Gi. No limit by default.")
+	cmd.Flags().String("max-extracted-size", "", "largest total size of the files of a bundle archive to accept, e.g. 50Gi. 100Gi by default, 0 means no limit.")
+	cmd.Flags().Duration("max-age", 0, "evict bundles this long after they are uploaded, e.g. 720h. 0 means never.")
+	cmd.Flags().String("max-disk-usage", "", "evict the least recently accessed bundles when bundles use more disk space than this, e.g. 500Gi. No limit by default.")
+	cmd.Flags().Duration("gc-interval", time.Minute, "how often to check for bundles to evict")
+	cmd.Flags().String("tls-cert-file", "", "certificate to serve https with. Plain http is served when not set.")
+	cmd.Flags().String("tls-private-key-file", "", "private key of --tls-cert-file")
+	cmd.Flags().Bool("debug", false, "enable debug logging. This will include HTTP response bodies in logs.")
+	return cmd
+}
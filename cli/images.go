@@ -0,0 +1,433 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// imageWorkloads are the resources whose pod templates reference images, with the path of the pod spec
+var imageWorkloads = []struct {
+	group    string
+	resource string
+	kind     string
+	path     []string
+}{
+	{"apps", "deployments", "Deployment", []string{"spec", "template", "spec"}},
+	{"apps", "statefulsets", "StatefulSet", []string{"spec", "template", "spec"}},
+	{"apps", "daemonsets", "DaemonSet", []string{"spec", "template", "spec"}},
+	{"apps", "replicasets", "ReplicaSet", []string{"spec", "template", "spec"}},
+	{"batch", "jobs", "Job", []string{"spec", "template", "spec"}},
+	{"batch", "cronjobs", "CronJob", []string{"spec", "jobTemplate", "spec", "template", "spec"}},
+	{"", "pods", "Pod", []string{"spec"}},
+}
+
+type imageReference struct {
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+type imageUsage struct {
+	Image     string
+	Reference imageReference
+	Digests   []string
+	Workloads []string
+	Vulns     []imageVulnerability
+}
+
+// imageVulnerability is an entry of the offline vulnerability file passed with --vulnerabilities
+type imageVulnerability struct {
+	Image        string `json:"image"`
+	ID           string `json:"id"`
+	Severity     string `json:"severity"`
+	Title        string `json:"title,omitempty"`
+	FixedVersion string `json:"fixedVersion,omitempty"`
+}
+
+func ImagesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "images",
+		Short: "List the container images referenced by workloads in a support bundle",
+		Long: `List the container images referenced by workloads in a support bundle.
+
+Images are collected from pods and the pod templates of Deployments, StatefulSets, DaemonSets,
+ReplicaSets, Jobs and CronJobs. Digests are taken from the image IDs reported in pod statuses.
+Pods, ReplicaSets and Jobs owned by another workload are listed under their owner.
+
+With --vulnerabilities, images are cross-referenced with an offline JSON file of known
+vulnerabilities, a list of {"image", "id", "severity", "title", "fixedVersion"} objects. The image
+of an entry is a repository, which matches all tags, or a repository with a tag or digest.
+
+With --format cyclonedx, a CycloneDX 1.5 JSON document is written with one container component per
+image, for security review tooling.`,
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			format := v.GetString("format")
+			if format != "table" && format != "cyclonedx" {
+				return usererrors.New(usererrors.InvalidArgument, errors.Errorf("unsupported format %q, must be one of: table, cyclonedx", format), "--format")
+			}
+
+			vulns := []imageVulnerability{}
+			if vulnFile := v.GetString("vulnerabilities"); vulnFile != "" {
+				data, err := os.ReadFile(vulnFile)
+				if err != nil {
+					return errors.Wrap(err, "failed to read vulnerabilities file")
+				}
+				if err := json.Unmarshal(data, &vulns); err != nil {
+					return errors.Wrap(err, "failed to parse vulnerabilities file")
+				}
+			}
+
+			clusterData, cleanup, err := loadClusterData(v)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			images, err := collectImages(clusterData)
+			if err != nil {
+				return err
+			}
+			for _, image := range images {
+				image.Vulns = matchVulnerabilities(image, vulns)
+			}
+
+			out := io.Writer(os.Stdout)
+			if outFile := v.GetString("output"); outFile != "" {
+				f, err := os.Create(outFile)
+				if err != nil {
+					return errors.Wrap(err, "failed to create output file")
+				}
+				defer f.Close()
+				out = f
+			}
+
+			if format == "cyclonedx" {
+				events, err := sbctl.ListResources(clusterData, "", "events")
+				if err != nil {
+					return errors.Wrap(err, "failed to list events")
+				}
+				return writeCycloneDX(out, images, bundleCollectionTime(events))
+			}
+
+			printImages(out, images, len(vulns) > 0)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	cmd.Flags().String("format", "table", "output format. One of: table, cyclonedx")
+	cmd.Flags().String("vulnerabilities", "", "offline JSON file of known image vulnerabilities to cross-reference")
+	cmd.Flags().StringP("output", "o", "", "file to write to. Defaults to stdout.")
+	return cmd
+}
+
+// collectImages returns the images referenced by workloads, sorted by image
+func collectImages(clusterData sbctl.ClusterData) ([]*imageUsage, error) {
+	images := map[string]*imageUsage{}
+	use := func(image string) *imageUsage {
+		if _, ok := images[image]; !ok {
+			images[image] = &imageUsage{Image: image, Reference: parseImageReference(image)}
+		}
+		return images[image]
+	}
+
+	for _, w := range imageWorkloads {
+		objects, err := sbctl.ListResources(clusterData, w.group, w.resource)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list %s", w.resource)
+		}
+
+		for _, o := range objects {
+			spec, ok, err := unstructured.NestedMap(o.Object, w.path...)
+			if err != nil || !ok {
+				continue
+			}
+			podSpec := corev1.PodSpec{}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(spec, &podSpec); err != nil {
+				continue
+			}
+
+			workload := fmt.Sprintf("%s %s/%s", w.kind, o.GetNamespace(), o.GetName())
+			// Images of owned pods, ReplicaSets and Jobs are listed under the workload that owns them
+			listed := w.kind != "Pod" && w.kind != "ReplicaSet" && w.kind != "Job" || len(o.GetOwnerReferences()) == 0
+			for _, image := range podSpecImages(podSpec) {
+				u := use(image)
+				if listed && !containsString(u.Workloads, workload) {
+					u.Workloads = append(u.Workloads, workload)
+				}
+			}
+
+			if w.resource != "pods" {
+				continue
+			}
+			pod := corev1.Pod{}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(o.Object, &pod); err != nil {
+				continue
+			}
+			// Runtimes report normalized image names in statuses, so digests are matched to the spec by container name
+			specImages := map[string]string{}
+			for _, c := range pod.Spec.InitContainers {
+				specImages[c.Name] = c.Image
+			}
+			for _, c := range pod.Spec.Containers {
+				specImages[c.Name] = c.Image
+			}
+			for _, c := range pod.Spec.EphemeralContainers {
+				specImages[c.Name] = c.Image
+			}
+			for _, s := range podContainerStatuses(pod) {
+				digest := imageIDDigest(s.ImageID)
+				image, ok := specImages[s.Name]
+				if digest == "" || !ok {
+					continue
+				}
+				u := use(image)
+				if !containsString(u.Digests, digest) {
+					u.Digests = append(u.Digests, digest)
+				}
+			}
+		}
+	}
+
+	result := []*imageUsage{}
+	for _, u := range images {
+		if u.Reference.Digest != "" && !containsString(u.Digests, u.Reference.Digest) {
+			u.Digests = append(u.Digests, u.Reference.Digest)
+		}
+		sort.Strings(u.Digests)
+		sort.Strings(u.Workloads)
+		result = append(result, u)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Image < result[j].Image
+	})
+	return result, nil
+}
+
+func podSpecImages(spec corev1.PodSpec) []string {
+	images := []string{}
+	for _, c := range spec.InitContainers {
+		images = append(images, c.Image)
+	}
+	for _, c := range spec.Containers {
+		images = append(images, c.Image)
+	}
+	for _, c := range spec.EphemeralContainers {
+		images = append(images, c.Image)
+	}
+	return images
+}
+
+func podContainerStatuses(pod corev1.Pod) []corev1.ContainerStatus {
+	statuses := []corev1.ContainerStatus{}
+	statuses = append(statuses, pod.Status.InitContainerStatuses...)
+	statuses = append(statuses, pod.Status.ContainerStatuses...)
+	statuses = append(statuses, pod.Status.EphemeralContainerStatuses...)
+	return statuses
+}
+
+// imageIDDigest returns the digest of a container status image ID such as
+// "docker-pullable://nginx@sha256:...". Image IDs of locally built images have no digest.
+func imageIDDigest(imageID string) string {
+	i := strings.LastIndex(imageID, "@")
+	if i < 0 {
+		return ""
+	}
+	return imageID[i+1:]
+}
+
+// parseImageReference splits an image into repository, tag and digest, normalizing Docker Hub
+// repositories the way the container runtime does, e.g. "nginx" is "docker.io/library/nginx"
+func parseImageReference(image string) imageReference {
+	ref := imageReference{}
+	name := image
+	if i := strings.Index(name, "@"); i >= 0 {
+		ref.Digest = name[i+1:]
+		name = name[:i]
+	}
+	// A colon after the last slash separates the tag, a colon before it is a registry port
+	if i := strings.LastIndex(name, ":"); i >= 0 && i > strings.LastIndex(name, "/") {
+		ref.Tag = name[i+1:]
+		name = name[:i]
+	}
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = "latest"
+	}
+
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) == 1 || (!strings.ContainsAny(parts[0], ".:") && parts[0] != "localhost") {
+		name = "docker.io/" + name
+	}
+	if strings.HasPrefix(name, "docker.io/") && strings.Count(name, "/") == 1 {
+		name = "docker.io/library/" + strings.TrimPrefix(name, "docker.io/")
+	}
+	ref.Repository = name
+	return ref
+}
+
+func matchVulnerabilities(image *imageUsage, vulns []imageVulnerability) []imageVulnerability {
+	matched := []imageVulnerability{}
+	for _, vuln := range vulns {
+		ref := parseImageReference(vuln.Image)
+		if ref.Repository != image.Reference.Repository {
+			continue
+		}
+		switch {
+		case ref.Digest != "":
+			if !containsString(image.Digests, ref.Digest) {
+				continue
+			}
+		case !strings.Contains(vuln.Image[strings.LastIndex(vuln.Image, "/")+1:], ":"):
+			// A repository without a tag matches all tags
+		case ref.Tag != image.Reference.Tag:
+			continue
+		}
+		matched = append(matched, vuln)
+	}
+	return matched
+}
+
+func printImages(out io.Writer, images []*imageUsage, showVulns bool) {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	defer w.Flush()
+
+	if showVulns {
+		fmt.Fprintln(w, "IMAGE\tDIGEST\tWORKLOADS\tVULNERABILITIES")
+	} else {
+		fmt.Fprintln(w, "IMAGE\tDIGEST\tWORKLOADS")
+	}
+	for _, image := range images {
+		line := fmt.Sprintf("%s\t%s\t%s", image.Image, valueOrNone(strings.Join(image.Digests, ",")), valueOrNone(strings.Join(image.Workloads, ", ")))
+		if showVulns {
+			ids := []string{}
+			for _, vuln := range image.Vulns {
+				ids = append(ids, fmt.Sprintf("%s (%s)", vuln.ID, strings.ToLower(vuln.Severity)))
+			}
+			line += "\t" + valueOrNone(strings.Join(ids, ", "))
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+func writeCycloneDX(out io.Writer, images []*imageUsage, collectedAt time.Time) error {
+	type hash struct {
+		Alg     string `json:"alg"`
+		Content string `json:"content"`
+	}
+	type property struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	type component struct {
+		BOMRef     string     `json:"bom-ref"`
+		Type       string     `json:"type"`
+		Name       string     `json:"name"`
+		Version    string     `json:"version,omitempty"`
+		PURL       string     `json:"purl"`
+		Hashes     []hash     `json:"hashes,omitempty"`
+		Properties []property `json:"properties,omitempty"`
+	}
+	type rating struct {
+		Severity string `json:"severity"`
+	}
+	type affects struct {
+		Ref string `json:"ref"`
+	}
+	type vulnerability struct {
+		ID          string    `json:"id"`
+		Ratings     []rating  `json:"ratings,omitempty"`
+		Description string    `json:"description,omitempty"`
+		Affects     []affects `json:"affects"`
+	}
+
+	components := []component{}
+	vulns := []vulnerability{}
+	for _, image := range images {
+		ref := image.Reference
+		c := component{
+			BOMRef:  image.Image,
+			Type:    "container",
+			Name:    ref.Repository,
+			Version: ref.Tag,
+			PURL:    ociPURL(ref, image.Digests),
+		}
+		for _, digest := range image.Digests {
+			if alg, content, ok := strings.Cut(digest, ":"); ok && alg == "sha256" {
+				c.Hashes = append(c.Hashes, hash{Alg: "SHA-256", Content: content})
+			}
+		}
+		for _, workload := range image.Workloads {
+			c.Properties = append(c.Properties, property{Name: "sbctl:workload", Value: workload})
+		}
+		components = append(components, c)
+
+		for _, v := range image.Vulns {
+			vuln := vulnerability{ID: v.ID, Description: v.Title, Affects: []affects{{Ref: c.BOMRef}}}
+			if v.Severity != "" {
+				vuln.Ratings = []rating{{Severity: strings.ToLower(v.Severity)}}
+			}
+			vulns = append(vulns, vuln)
+		}
+	}
+
+	bom := map[string]interface{}{
+		"bomFormat":   "CycloneDX",
+		"specVersion": "1.5",
+		"version":     1,
+		"metadata": map[string]interface{}{
+			"timestamp": collectedAt.UTC().Format(time.RFC3339),
+			"tools": map[string]interface{}{
+				"components": []interface{}{map[string]string{"type": "application", "name": "sbctl"}},
+			},
+		},
+		"components": components,
+	}
+	if len(vulns) > 0 {
+		bom["vulnerabilities"] = vulns
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return errors.Wrap(encoder.Encode(bom), "failed to write CycloneDX document")
+}
+
+// ociPURL returns the package URL of an image, see https://github.com/package-url/purl-spec
+func ociPURL(ref imageReference, digests []string) string {
+	name := ref.Repository[strings.LastIndex(ref.Repository, "/")+1:]
+	purl := "pkg:oci/" + name
+	if len(digests) > 0 {
+		purl += "@" + url.QueryEscape(digests[0])
+	}
+
+	query := url.Values{}
+	query.Set("repository_url", ref.Repository)
+	if ref.Tag != "" {
+		query.Set("tag", ref.Tag)
+	}
+	return purl + "?" + query.Encode()
+}
@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+)
+
+// writeClusterResource writes a file to the cluster resources of the test bundle in dir
+func writeClusterResource(dir string, name string, data string) {
+	fileName := filepath.Join(dir, "cluster-resources", name)
+	Expect(os.MkdirAll(filepath.Dir(fileName), 0755)).To(Succeed())
+	Expect(os.WriteFile(fileName, []byte(data), 0644)).To(Succeed())
+}
+
+var _ = Describe("Images", func() {
+	DescribeTable("Parses image references",
+		func(image string, expected imageReference) {
+			Expect(parseImageReference(image)).To(Equal(expected))
+		},
+		Entry("Docker Hub image", "nginx", imageReference{Repository: "docker.io/library/nginx", Tag: "latest"}),
+		Entry("Docker Hub image with a tag", "nginx:1.25", imageReference{Repository: "docker.io/library/nginx", Tag: "1.25"}),
+		Entry("Docker Hub organization", "bitnami/redis:7.2", imageReference{Repository: "docker.io/bitnami/redis", Tag: "7.2"}),
+		Entry("registry", "quay.io/org/app:v1", imageReference{Repository: "quay.io/org/app", Tag: "v1"}),
+		Entry("registry with a port", "registry.example.com:5000/team/app:v2", imageReference{Repository: "registry.example.com:5000/team/app", Tag: "v2"}),
+		Entry("registry with a port without a tag", "registry.example.com:5000/team/app", imageReference{Repository: "registry.example.com:5000/team/app", Tag: "latest"}),
+		Entry("localhost", "localhost/app", imageReference{Repository: "localhost/app", Tag: "latest"}),
+		Entry("digest", "quay.io/org/app@sha256:abc", imageReference{Repository: "quay.io/org/app", Digest: "sha256:abc"}),
+		Entry("tag and digest", "org/app:1.0@sha256:abc", imageReference{Repository: "docker.io/org/app", Tag: "1.0", Digest: "sha256:abc"}),
+		Entry("registry with a port and digest", "localhost:5000/app@sha256:abc", imageReference{Repository: "localhost:5000/app", Digest: "sha256:abc"}),
+	)
+
+	DescribeTable("Takes digests from image IDs",
+		func(imageID string, expected string) {
+			Expect(imageIDDigest(imageID)).To(Equal(expected))
+		},
+		Entry("docker", "docker-pullable://nginx@sha256:abc", "sha256:abc"),
+		Entry("containerd", "docker.io/library/nginx@sha256:abc", "sha256:abc"),
+		Entry("locally built", "sha256:abc", ""),
+		Entry("empty", "", ""),
+	)
+
+	It("Lists every image once, including those of init and ephemeral containers", func() {
+		dir := GinkgoT().TempDir()
+		writeClusterResource(dir, "pods/default.json", `{
+			"kind": "PodList",
+			"apiVersion": "v1",
+			"items": [
+				{
+					"metadata": {"name": "web-0", "namespace": "default"},
+					"spec": {
+						"initContainers": [{"name": "init", "image": "busybox"}],
+						"containers": [{"name": "web", "image": "nginx:1.25"}, {"name": "sidecar", "image": "busybox"}],
+						"ephemeralContainers": [{"name": "debug", "image": "nginx:1.25"}]
+					},
+					"status": {
+						"initContainerStatuses": [{"name": "init", "imageID": "docker-pullable://busybox@sha256:bbb"}],
+						"containerStatuses": [
+							{"name": "web", "imageID": "docker-pullable://nginx@sha256:aaa"},
+							{"name": "sidecar", "imageID": "docker-pullable://busybox@sha256:bbb"}
+						]
+					}
+				},
+				{
+					"metadata": {"name": "web-1", "namespace": "default", "ownerReferences": [{"apiVersion": "apps/v1", "kind": "StatefulSet", "name": "web", "uid": "1"}]},
+					"spec": {"containers": [{"name": "web", "image": "nginx:1.25"}]},
+					"status": {"containerStatuses": [{"name": "web", "imageID": "docker-pullable://nginx@sha256:ccc"}]}
+				}
+			]
+		}`)
+
+		clusterData, err := sbctl.FindClusterData(dir)
+		Expect(err).NotTo(HaveOccurred())
+		images, err := collectImages(clusterData)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(images).To(HaveLen(2))
+		Expect(images[0].Image).To(Equal("busybox"))
+		Expect(images[0].Digests).To(Equal([]string{"sha256:bbb"}))
+		Expect(images[0].Workloads).To(Equal([]string{"Pod default/web-0"}))
+		Expect(images[1].Image).To(Equal("nginx:1.25"))
+		Expect(images[1].Digests).To(Equal([]string{"sha256:aaa", "sha256:ccc"}))
+		// Pods owned by another workload are listed under their owner
+		Expect(images[1].Workloads).To(Equal([]string{"Pod default/web-0"}))
+	})
+})
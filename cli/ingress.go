@@ -0,0 +1,417 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/output"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// gatewayRouteResources are the Gateway API routes with HTTP style rules of matches and backends
+var gatewayRouteResources = []struct {
+	resource string
+	kind     string
+}{
+	{"httproutes", "HTTPRoute"},
+	{"grpcroutes", "GRPCRoute"},
+}
+
+// ingressRoute is a host and path routed to a Service by an Ingress or Gateway API route
+type ingressRoute struct {
+	Host  string `json:"host"`
+	Path  string `json:"path"`
+	Route string `json:"route"`
+	// Via is the ingress class of an Ingress, or the parent Gateways of a route
+	Via            string `json:"via,omitempty"`
+	Service        string `json:"service"`
+	Port           string `json:"port,omitempty"`
+	ReadyEndpoints int    `json:"readyEndpoints"`
+	ReadyPods      int    `json:"readyPods"`
+	Pods           int    `json:"pods"`
+	Issue          string `json:"issue,omitempty"`
+
+	// serviceName is empty when the backend is not a Service
+	serviceNamespace string
+	serviceName      string
+}
+
+func IngressCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ingress",
+		Short: "Show how hosts and paths are routed to Services and pods",
+		Long: `Show how hosts and paths are routed to Services and pods.
+
+The rules of Ingresses, and of Gateway API HTTPRoutes and GRPCRoutes, are listed with the
+Service they route to, the ready addresses in the Service's Endpoints and EndpointSlices, and how
+many of the pods the Service selects are ready. Backends whose Service or Service port is missing,
+or whose Service has no ready endpoints, are flagged, since requests routed to them fail.`,
+		Example: `  sbctl ingress -s ./support-bundle.tar.gz
+  sbctl ingress -n my-app --format json`,
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			format := v.GetString("format")
+			if format != "table" && format != "json" {
+				return usererrors.New(usererrors.InvalidArgument, errors.Errorf("unsupported format %q, must be one of: table, json", format), "--format")
+			}
+
+			clusterData, cleanup, err := loadClusterData(v)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			ingresses, err := sbctl.ListTypedResources[networkingv1.Ingress](clusterData, "networking.k8s.io", "ingresses")
+			if err != nil {
+				return errors.Wrap(err, "failed to list ingresses")
+			}
+			routes := []ingressRoute{}
+			for _, ing := range ingresses {
+				routes = append(routes, ingressRoutes(ing)...)
+			}
+			for _, r := range gatewayRouteResources {
+				objects, err := sbctl.ListResources(clusterData, sbctl.GatewayAPIGroup, r.resource)
+				if err != nil {
+					return errors.Wrapf(err, "failed to list %s", r.resource)
+				}
+				for _, o := range objects {
+					routes = append(routes, gatewayRoutes(o, r.kind)...)
+				}
+			}
+
+			namespace := v.GetString("namespace")
+			if namespace != "" {
+				filtered := []ingressRoute{}
+				for _, r := range routes {
+					if r.serviceNamespace == namespace {
+						filtered = append(filtered, r)
+					}
+				}
+				routes = filtered
+			}
+
+			services, err := sbctl.ListTypedResources[corev1.Service](clusterData, "", "services")
+			if err != nil {
+				return errors.Wrap(err, "failed to list services")
+			}
+			endpoints, err := sbctl.ListTypedResources[corev1.Endpoints](clusterData, "", "endpoints")
+			if err != nil {
+				return errors.Wrap(err, "failed to list endpoints")
+			}
+			slices, err := sbctl.ListTypedResources[discoveryv1.EndpointSlice](clusterData, "discovery.k8s.io", "endpointslices")
+			if err != nil {
+				return errors.Wrap(err, "failed to list endpoint slices")
+			}
+			pods, err := sbctl.ListTypedResources[corev1.Pod](clusterData, "", "pods")
+			if err != nil {
+				return errors.Wrap(err, "failed to list pods")
+			}
+			for i := range routes {
+				checkIngressBackend(&routes[i], services, endpoints, slices, pods)
+			}
+
+			sort.SliceStable(routes, func(i, j int) bool {
+				if routes[i].Host != routes[j].Host {
+					return routes[i].Host < routes[j].Host
+				}
+				return routes[i].Path < routes[j].Path
+			})
+
+			if format == "json" {
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				if err := encoder.Encode(routes); err != nil {
+					return errors.Wrap(err, "failed to write results")
+				}
+				return nil
+			}
+
+			if len(routes) == 0 {
+				fmt.Println("No Ingresses or Gateway API routes found in support bundle")
+				return nil
+			}
+			p, err := newPrinter(os.Stdout)
+			if err != nil {
+				return err
+			}
+			return printIngressRoutes(p, routes)
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	cmd.Flags().StringP("namespace", "n", "", "only show routes to services in this namespace")
+	cmd.Flags().String("format", "table", "output format. One of: table, json")
+	return cmd
+}
+
+func ingressRoutes(ing networkingv1.Ingress) []ingressRoute {
+	route := fmt.Sprintf("ingress/%s/%s", ing.Namespace, ing.Name)
+	via := ""
+	if ing.Spec.IngressClassName != nil {
+		via = *ing.Spec.IngressClassName
+	} else if class := ing.Annotations["kubernetes.io/ingress.class"]; class != "" {
+		via = class
+	}
+
+	newRoute := func(host string, path string, backend networkingv1.IngressBackend) ingressRoute {
+		r := ingressRoute{Host: host, Path: path, Route: route, Via: via, serviceNamespace: ing.Namespace}
+		if backend.Service == nil {
+			if backend.Resource != nil {
+				r.Service = fmt.Sprintf("%s/%s", strings.ToLower(backend.Resource.Kind), backend.Resource.Name)
+			}
+			return r
+		}
+		r.serviceName = backend.Service.Name
+		r.Service = fmt.Sprintf("%s/%s", ing.Namespace, backend.Service.Name)
+		if backend.Service.Port.Name != "" {
+			r.Port = backend.Service.Port.Name
+		} else if backend.Service.Port.Number != 0 {
+			r.Port = fmt.Sprint(backend.Service.Port.Number)
+		}
+		return r
+	}
+
+	routes := []ingressRoute{}
+	if ing.Spec.DefaultBackend != nil {
+		routes = append(routes, newRoute("*", "<default>", *ing.Spec.DefaultBackend))
+	}
+	for _, rule := range ing.Spec.Rules {
+		host := rule.Host
+		if host == "" {
+			host = "*"
+		}
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			p := path.Path
+			if p == "" {
+				p = "/"
+			}
+			routes = append(routes, newRoute(host, p, path.Backend))
+		}
+	}
+	return routes
+}
+
+// gatewayRoutes lists the backends of each rule of an HTTPRoute or GRPCRoute for each of its
+// hostnames. Matches on headers and query parameters are not shown.
+func gatewayRoutes(o unstructured.Unstructured, kind string) []ingressRoute {
+	route := fmt.Sprintf("%s/%s/%s", strings.ToLower(kind), o.GetNamespace(), o.GetName())
+
+	parents := []string{}
+	parentRefs, _, _ := unstructured.NestedSlice(o.Object, "spec", "parentRefs")
+	for _, ref := range parentRefs {
+		if m, ok := ref.(map[string]interface{}); ok {
+			parent := fmt.Sprint(m["name"])
+			if section, ok := m["sectionName"].(string); ok && section != "" {
+				parent += "/" + section
+			}
+			parents = append(parents, parent)
+		}
+	}
+
+	hosts, _, _ := unstructured.NestedStringSlice(o.Object, "spec", "hostnames")
+	if len(hosts) == 0 {
+		hosts = []string{"*"}
+	}
+
+	routes := []ingressRoute{}
+	rules, _, _ := unstructured.NestedSlice(o.Object, "spec", "rules")
+	for _, rule := range rules {
+		ruleMap, ok := rule.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		paths := []string{}
+		matches, _, _ := unstructured.NestedSlice(ruleMap, "matches")
+		for _, match := range matches {
+			matchMap, ok := match.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if value, found, _ := unstructured.NestedString(matchMap, "path", "value"); found {
+				paths = append(paths, value)
+			} else if service, found, _ := unstructured.NestedString(matchMap, "method", "service"); found {
+				method, _, _ := unstructured.NestedString(matchMap, "method", "method")
+				paths = append(paths, strings.TrimSuffix("/"+service+"/"+method, "/"))
+			}
+		}
+		if len(paths) == 0 {
+			paths = []string{"/"}
+		}
+
+		backendRefs, _, _ := unstructured.NestedSlice(ruleMap, "backendRefs")
+		for _, ref := range backendRefs {
+			refMap, ok := ref.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			backendKind, _, _ := unstructured.NestedString(refMap, "kind")
+			name, _, _ := unstructured.NestedString(refMap, "name")
+			namespace, _, _ := unstructured.NestedString(refMap, "namespace")
+			if namespace == "" {
+				namespace = o.GetNamespace()
+			}
+			port := ""
+			if p, found, _ := unstructured.NestedFieldNoCopy(refMap, "port"); found {
+				port = fmt.Sprint(p)
+			}
+
+			for _, host := range hosts {
+				for _, path := range paths {
+					r := ingressRoute{Host: host, Path: path, Route: route, Via: strings.Join(parents, ","), Port: port, serviceNamespace: namespace}
+					if backendKind != "" && backendKind != "Service" {
+						r.Service = fmt.Sprintf("%s/%s", strings.ToLower(backendKind), name)
+					} else {
+						r.serviceName = name
+						r.Service = fmt.Sprintf("%s/%s", namespace, name)
+					}
+					routes = append(routes, r)
+				}
+			}
+		}
+	}
+	return routes
+}
+
+// checkIngressBackend counts the ready endpoints and pods of a route's Service, and flags the
+// route when requests to it cannot be served
+func checkIngressBackend(r *ingressRoute, services []corev1.Service, endpoints []corev1.Endpoints, slices []discoveryv1.EndpointSlice, pods []corev1.Pod) {
+	if r.serviceName == "" {
+		if r.Service == "" {
+			r.Issue = "no backend"
+		}
+		return
+	}
+
+	var svc *corev1.Service
+	for i := range services {
+		if services[i].Namespace == r.serviceNamespace && services[i].Name == r.serviceName {
+			svc = &services[i]
+			break
+		}
+	}
+	if svc == nil {
+		r.Issue = "service not found"
+		return
+	}
+	if svc.Spec.Type == corev1.ServiceTypeExternalName {
+		r.Service += " -> " + svc.Spec.ExternalName
+		return
+	}
+	if r.Port != "" && !serviceHasPort(*svc, r.Port) {
+		r.Issue = "service port not found"
+		return
+	}
+
+	// Pod IPs listed by Endpoints or EndpointSlices, and whether they are ready, as resolve tracks them
+	addresses := map[string]bool{}
+	for _, e := range endpoints {
+		if e.Namespace != svc.Namespace || e.Name != svc.Name {
+			continue
+		}
+		for _, subset := range e.Subsets {
+			for _, a := range subset.Addresses {
+				addresses[a.IP] = true
+			}
+			for _, a := range subset.NotReadyAddresses {
+				if _, ok := addresses[a.IP]; !ok {
+					addresses[a.IP] = false
+				}
+			}
+		}
+	}
+	for _, s := range slices {
+		if s.Namespace != svc.Namespace || s.Labels[discoveryv1.LabelServiceName] != svc.Name {
+			continue
+		}
+		for _, e := range s.Endpoints {
+			ready := e.Conditions.Ready == nil || *e.Conditions.Ready
+			for _, a := range e.Addresses {
+				if ready || !addresses[a] {
+					addresses[a] = ready
+				}
+			}
+		}
+	}
+	for _, ready := range addresses {
+		if ready {
+			r.ReadyEndpoints++
+		}
+	}
+
+	if len(svc.Spec.Selector) > 0 {
+		selector := labels.SelectorFromSet(svc.Spec.Selector)
+		for _, p := range pods {
+			if p.Namespace != svc.Namespace || !selector.Matches(labels.Set(p.Labels)) || isTerminatedPod(p) {
+				continue
+			}
+			r.Pods++
+			if isPodReady(p) {
+				r.ReadyPods++
+			}
+		}
+	}
+
+	if r.ReadyEndpoints == 0 {
+		r.Issue = "no ready endpoints"
+	}
+}
+
+// serviceHasPort returns whether a Service has a port of the given name or number
+func serviceHasPort(svc corev1.Service, port string) bool {
+	for _, p := range svc.Spec.Ports {
+		if p.Name == port || fmt.Sprint(p.Port) == port {
+			return true
+		}
+	}
+	return false
+}
+
+func printIngressRoutes(p *output.Printer, routes []ingressRoute) error {
+	t := p.NewTable("HOST", "PATH", "ROUTE", "VIA", "SERVICE", "PORT", "ENDPOINTS", "PODS", "STATUS")
+	issues := 0
+	for _, r := range routes {
+		status := p.Green("OK")
+		if r.Issue != "" {
+			status = p.Red(r.Issue)
+			issues++
+		}
+		pods := "<none>"
+		if r.serviceName != "" {
+			pods = fmt.Sprintf("%d/%d", r.ReadyPods, r.Pods)
+		}
+		t.AddRow(r.Host, r.Path, r.Route, valueOrNone(r.Via), valueOrNone(r.Service), valueOrNone(r.Port),
+			fmt.Sprint(r.ReadyEndpoints), pods, status)
+	}
+	if err := t.Print(); err != nil {
+		return err
+	}
+	if issues > 0 {
+		_, err := fmt.Fprintf(p.Writer(), "\n%s\n", p.Yellow(fmt.Sprintf("%d routes have backends that cannot serve requests", issues)))
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package cli
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var _ = Describe("Ingress", func() {
+	serviceBackend := func(name string, port networkingv1.ServiceBackendPort) networkingv1.IngressBackend {
+		return networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{Name: name, Port: port}}
+	}
+
+	Describe("Routes", func() {
+		It("Lists the default backend of ingresses", func() {
+			class := "nginx"
+			backend := serviceBackend("web", networkingv1.ServiceBackendPort{Number: 80})
+			ing := networkingv1.Ingress{
+				ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+				Spec:       networkingv1.IngressSpec{IngressClassName: &class, DefaultBackend: &backend},
+			}
+
+			routes := ingressRoutes(ing)
+			Expect(routes).To(HaveLen(1))
+			Expect(routes[0].Host).To(Equal("*"))
+			Expect(routes[0].Path).To(Equal("<default>"))
+			Expect(routes[0].Route).To(Equal("ingress/default/web"))
+			Expect(routes[0].Via).To(Equal("nginx"))
+			Expect(routes[0].Service).To(Equal("default/web"))
+			Expect(routes[0].Port).To(Equal("80"))
+		})
+
+		It("Lists rules with their hosts, paths and backends", func() {
+			ing := networkingv1.Ingress{
+				ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Annotations: map[string]string{"kubernetes.io/ingress.class": "traefik"}},
+				Spec: networkingv1.IngressSpec{Rules: []networkingv1.IngressRule{
+					{IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{Paths: []networkingv1.HTTPIngressPath{
+						{Backend: serviceBackend("web", networkingv1.ServiceBackendPort{Name: "http"})},
+					}}}},
+					{Host: "assets.example.com", IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{Paths: []networkingv1.HTTPIngressPath{
+						{Path: "/static", Backend: networkingv1.IngressBackend{Resource: &corev1.TypedLocalObjectReference{Kind: "StorageBucket", Name: "assets"}}},
+					}}}},
+				}},
+			}
+
+			routes := ingressRoutes(ing)
+			Expect(routes).To(HaveLen(2))
+			Expect(routes[0].Host).To(Equal("*"))
+			Expect(routes[0].Path).To(Equal("/"))
+			Expect(routes[0].Via).To(Equal("traefik"))
+			Expect(routes[0].Service).To(Equal("default/web"))
+			Expect(routes[0].Port).To(Equal("http"))
+			Expect(routes[1].Host).To(Equal("assets.example.com"))
+			Expect(routes[1].Path).To(Equal("/static"))
+			Expect(routes[1].Service).To(Equal("storagebucket/assets"))
+			Expect(routes[1].Port).To(BeEmpty())
+		})
+
+		It("Lists backends of Gateway API routes without ports", func() {
+			route := unstructured.Unstructured{Object: map[string]interface{}{
+				"metadata": map[string]interface{}{"name": "web", "namespace": "default"},
+				"spec": map[string]interface{}{
+					"parentRefs": []interface{}{map[string]interface{}{"name": "public", "sectionName": "https"}},
+					"rules": []interface{}{map[string]interface{}{
+						"backendRefs": []interface{}{map[string]interface{}{"name": "web"}},
+					}},
+				},
+			}}
+
+			routes := gatewayRoutes(route, "HTTPRoute")
+			Expect(routes).To(HaveLen(1))
+			Expect(routes[0].Host).To(Equal("*"))
+			Expect(routes[0].Path).To(Equal("/"))
+			Expect(routes[0].Route).To(Equal("httproute/default/web"))
+			Expect(routes[0].Via).To(Equal("public/https"))
+			Expect(routes[0].Service).To(Equal("default/web"))
+			Expect(routes[0].Port).To(BeEmpty())
+		})
+	})
+
+	Describe("Backends", func() {
+		services := []corev1.Service{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+				Spec: corev1.ServiceSpec{
+					Selector: map[string]string{"app": "web"},
+					Ports:    []corev1.ServicePort{{Name: "http", Port: 80}},
+				},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "docs", Namespace: "default"},
+				Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeExternalName, ExternalName: "docs.example.com"},
+			},
+		}
+		endpoints := []corev1.Endpoints{{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Subsets: []corev1.EndpointSubset{{
+				Addresses:         []corev1.EndpointAddress{{IP: "10.0.0.1"}},
+				NotReadyAddresses: []corev1.EndpointAddress{{IP: "10.0.0.2"}},
+			}},
+		}}
+		notReady := false
+		slices := []discoveryv1.EndpointSlice{{
+			ObjectMeta: metav1.ObjectMeta{Name: "web-abc", Namespace: "default", Labels: map[string]string{discoveryv1.LabelServiceName: "web"}},
+			Endpoints: []discoveryv1.Endpoint{
+				{Addresses: []string{"10.0.0.2"}, Conditions: discoveryv1.EndpointConditions{Ready: &notReady}},
+				{Addresses: []string{"10.0.0.3"}},
+			},
+		}}
+		pods := []corev1.Pod{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "web-0", Namespace: "default", Labels: map[string]string{"app": "web"}},
+				Status:     corev1.PodStatus{Phase: corev1.PodRunning, Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "default", Labels: map[string]string{"app": "web"}},
+				Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+			},
+		}
+
+		check := func(r ingressRoute) ingressRoute {
+			checkIngressBackend(&r, services, endpoints, slices, pods)
+			return r
+		}
+
+		It("Counts ready endpoints and pods of services", func() {
+			r := check(ingressRoute{Service: "default/web", Port: "http", serviceNamespace: "default", serviceName: "web"})
+			Expect(r.Issue).To(BeEmpty())
+			Expect(r.ReadyEndpoints).To(Equal(2))
+			Expect(r.ReadyPods).To(Equal(1))
+			Expect(r.Pods).To(Equal(2))
+
+			r = check(ingressRoute{Service: "default/web", Port: "80", serviceNamespace: "default", serviceName: "web"})
+			Expect(r.Issue).To(BeEmpty())
+		})
+
+		It("Flags routes to missing services", func() {
+			r := check(ingressRoute{Service: "default/api", Port: "80", serviceNamespace: "default", serviceName: "api"})
+			Expect(r.Issue).To(Equal("service not found"))
+
+			r = check(ingressRoute{Service: "velero/web", serviceNamespace: "velero", serviceName: "web"})
+			Expect(r.Issue).To(Equal("service not found"))
+		})
+
+		It("Flags routes to missing service ports", func() {
+			r := check(ingressRoute{Service: "default/web", Port: "8080", serviceNamespace: "default", serviceName: "web"})
+			Expect(r.Issue).To(Equal("service port not found"))
+
+			r = check(ingressRoute{Service: "default/web", Port: "https", serviceNamespace: "default", serviceName: "web"})
+			Expect(r.Issue).To(Equal("service port not found"))
+		})
+
+		It("Resolves external names", func() {
+			r := check(ingressRoute{Service: "default/docs", Port: "80", serviceNamespace: "default", serviceName: "docs"})
+			Expect(r.Issue).To(BeEmpty())
+			Expect(r.Service).To(Equal("default/docs -> docs.example.com"))
+		})
+
+		It("Flags routes without backends but not to other resources", func() {
+			r := check(ingressRoute{serviceNamespace: "default"})
+			Expect(r.Issue).To(Equal("no backend"))
+
+			r = check(ingressRoute{Service: "storagebucket/assets", serviceNamespace: "default"})
+			Expect(r.Issue).To(BeEmpty())
+		})
+
+		It("Flags services without ready endpoints", func() {
+			r := ingressRoute{Service: "default/web", serviceNamespace: "default", serviceName: "web"}
+			checkIngressBackend(&r, services, nil, nil, nil)
+			Expect(r.Issue).To(Equal("no ready endpoints"))
+		})
+	})
+})
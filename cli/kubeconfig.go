@@ -0,0 +1,314 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/api"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// instance is an API server started by serve or shell, recorded so that other sbctl commands
+// can find it
+type instance struct {
+	PID        int       `json:"pid"`
+	Server     string    `json:"server"`
+	Bundle     string    `json:"bundle"`
+	KubeConfig string    `json:"kubeconfig"`
+	StartedAt  time.Time `json:"startedAt"`
+}
+
+func KubeconfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "kubeconfig",
+		Short: "Print a kubeconfig for a support bundle API server",
+		Long: `Print a kubeconfig for a support bundle API server.
+
+The kubeconfig points at an API server already started with serve or shell. When
+--support-bundle-location is given, the server serving that bundle is used, and one is started
+if there is none, which runs until interrupted. This allows pointing IDE Kubernetes plugins at
+a bundle without a shell, e.g. with --output set to a file the IDE is configured to read.`,
+		Example: `  sbctl kubeconfig --list
+  sbctl kubeconfig -s ./support-bundle.tar.gz --output ~/.kube/sbctl`,
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			instances, err := runningInstances()
+			if err != nil {
+				return errors.Wrap(err, "failed to list running instances")
+			}
+
+			if v.GetBool("list") {
+				if len(instances) == 0 {
+					fmt.Println("No running sbctl API servers found")
+					return nil
+				}
+				printInstances(os.Stdout, instances)
+				return nil
+			}
+
+			bundle := v.GetString("support-bundle-location")
+			selected := []instance{}
+			for _, i := range instances {
+				if bundle == "" || i.Bundle == bundleKey(bundle) {
+					selected = append(selected, i)
+				}
+			}
+
+			switch {
+			case len(selected) == 1:
+				return writeKubeConfig(v.GetString("output"), selected[0].KubeConfig)
+			case len(selected) > 1:
+				return errors.Errorf("%d sbctl API servers are running, select one with --support-bundle-location. Run with --list to see them", len(selected))
+			case bundle == "":
+				return errors.New("no running sbctl API servers found, use --support-bundle-location to start one")
+			}
+
+			return serveForKubeConfig(v)
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	cmd.Flags().StringP("output", "o", "", "write the kubeconfig to this file instead of stdout")
+	cmd.Flags().Bool("list", false, "list running API servers")
+	cmd.Flags().Duration("ttl", 0, "when a server is started, stop it and remove its temporary files after this long without requests, e.g. 4h. 0 means never.")
+	return cmd
+}
+
+// serveForKubeConfig starts an API server for the bundle and serves it until interrupted
+func serveForKubeConfig(v *viper.Viper) error {
+	bundleDir, deleteBundleDir, err := getBundleDir(v.GetString("support-bundle-location"), v.GetString("token"))
+	if err != nil {
+		return err
+	}
+	clusterData, convertedDir, err := getClusterData(bundleDir)
+	cleanup := func() {
+		if deleteBundleDir {
+			_ = removeBundleData(bundleDir)
+		}
+		if convertedDir != "" {
+			_ = removeBundleData(convertedDir)
+		}
+	}
+	if err != nil {
+		cleanup()
+		return err
+	}
+
+	kubeConfig, err := api.StartAPIServer(clusterData, io.Discard)
+	if err != nil {
+		cleanup()
+		return usererrors.New(usererrors.ServerStartFailed, err)
+	}
+
+	instanceFile, err := registerInstance(v.GetString("support-bundle-location"), kubeConfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to record the running server: %v\n", err)
+	}
+
+	if err := writeKubeConfig(v.GetString("output"), kubeConfig); err != nil {
+		_ = os.RemoveAll(kubeConfig)
+		_ = os.RemoveAll(instanceFile)
+		cleanup()
+		return err
+	}
+
+	fmt.Fprintln(os.Stderr, "Server is running, press Ctrl-C to stop it")
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, os.Interrupt)
+	ttl := v.GetDuration("ttl")
+	select {
+	case <-signalChan:
+	case <-idleTimeout(ttl):
+		fmt.Fprintf(os.Stderr, "No requests for %s, stopping the server\n", ttl)
+	}
+
+	_ = os.RemoveAll(kubeConfig)
+	_ = os.RemoveAll(instanceFile)
+	cleanup()
+	return nil
+}
+
+// writeKubeConfig copies the kubeconfig of a server, which has the token the server requires when
+// it has views
+func writeKubeConfig(output string, kubeConfig string) error {
+	config, err := os.ReadFile(kubeConfig)
+	if err != nil {
+		return errors.Wrap(err, "failed to read kubeconfig")
+	}
+	if output == "" {
+		fmt.Print(string(config))
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return errors.Wrap(err, "failed to create output dir")
+	}
+	if err := os.WriteFile(output, config, 0600); err != nil {
+		return errors.Wrap(err, "failed to write kubeconfig")
+	}
+	fmt.Fprintf(os.Stderr, "Wrote kubeconfig to %s\n", output)
+	return nil
+}
+
+func kubeConfigServer(kubeConfig string) (string, error) {
+	restConfig, err := clientcmd.BuildConfigFromFlags("", kubeConfig)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read kubeconfig")
+	}
+	return restConfig.Host, nil
+}
+
+func instancesDir() string {
+	return filepath.Join(os.TempDir(), "sbctl-instances")
+}
+
+// bundleKey returns how a bundle location is recorded, so that relative paths match
+func bundleKey(location string) string {
+	if strings.HasPrefix(location, "http") {
+		return location
+	}
+	if abs, err := filepath.Abs(location); err == nil {
+		return abs
+	}
+	return location
+}
+
+// registerInstance records a running API server. The returned file should be removed when the
+// server stops. Entries of servers that stopped without removing it are ignored and cleaned up
+// by runningInstances.
+func registerInstance(bundle string, kubeConfig string) (string, error) {
+	server, err := kubeConfigServer(kubeConfig)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(instance{
+		PID:        os.Getpid(),
+		Server:     server,
+		Bundle:     bundleKey(bundle),
+		KubeConfig: kubeConfig,
+		StartedAt:  time.Now(),
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to marshal instance")
+	}
+
+	if err := os.MkdirAll(instancesDir(), 0700); err != nil {
+		return "", errors.Wrap(err, "failed to create instances dir")
+	}
+	fileName := filepath.Join(instancesDir(), fmt.Sprintf("%d.json", os.Getpid()))
+	if err := os.WriteFile(fileName, data, 0600); err != nil {
+		return "", errors.Wrap(err, "failed to write instance file")
+	}
+	return fileName, nil
+}
+
+// runningInstances returns the recorded API servers that still respond, oldest first
+func runningInstances() ([]instance, error) {
+	entries, err := os.ReadDir(instancesDir())
+	if os.IsNotExist(err) {
+		return []instance{}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read instances dir")
+	}
+
+	client := &http.Client{Timeout: time.Second}
+	instances := []instance{}
+	for _, entry := range entries {
+		fileName := filepath.Join(instancesDir(), entry.Name())
+		if entry.IsDir() || filepath.Ext(fileName) != ".json" {
+			continue
+		}
+
+		data, err := os.ReadFile(fileName)
+		if err != nil {
+			continue
+		}
+		var i instance
+		if err := json.Unmarshal(data, &i); err != nil {
+			_ = os.Remove(fileName)
+			continue
+		}
+
+		resp, err := client.Get(i.Server + "/api/v1")
+		if err != nil {
+			_ = os.Remove(fileName)
+			continue
+		}
+		resp.Body.Close()
+		instances = append(instances, i)
+	}
+
+	sort.Slice(instances, func(a, b int) bool {
+		return instances[a].StartedAt.Before(instances[b].StartedAt)
+	})
+	return instances, nil
+}
+
+func printInstances(out io.Writer, instances []instance) {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "PID\tSERVER\tSTARTED\tBUNDLE")
+	for _, i := range instances {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", i.PID, i.Server, i.StartedAt.Format(time.RFC3339), i.Bundle)
+	}
+}
+
+// loadViews reads the views given with --views and makes API servers enforce them
+func loadViews(v *viper.Viper) ([]api.View, error) {
+	fileName := v.GetString("views")
+	if fileName == "" {
+		return nil, nil
+	}
+
+	views, err := api.LoadViews(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if err := api.SetViews(views); err != nil {
+		return nil, err
+	}
+	return views, nil
+}
+
+// writeViewKubeConfigs writes a kubeconfig for each view next to the server's kubeconfig and
+// returns their file names
+func writeViewKubeConfigs(kubeConfig string, views []api.View) ([]string, error) {
+	server, err := kubeConfigServer(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	fileNames := []string{}
+	for _, view := range views {
+		fileName := fmt.Sprintf("%s-%s", kubeConfig, view.Name)
+		if err := os.WriteFile(fileName, []byte(api.KubeConfig(server, view.Token)), 0600); err != nil {
+			return fileNames, errors.Wrapf(err, "failed to write kubeconfig for view %s", view.Name)
+		}
+		fileNames = append(fileNames, fileName)
+	}
+	return fileNames, nil
+}
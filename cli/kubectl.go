@@ -0,0 +1,266 @@
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/api"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	// kubectlVersion is the kubectl release downloaded when no usable kubectl is found.
+	// Keep this in sync with the k8s.io/client-go version in go.mod.
+	kubectlVersion = "v1.30.1"
+	kubectlBaseURL = "https://dl.k8s.io/release"
+)
+
+func KubectlCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "kubectl [flags] -- [kubectl args]",
+		Short: "Run kubectl against a support bundle",
+		Long: `Run kubectl against a support bundle.
+
+The API server is started in the background and kubectl is executed with KUBECONFIG
+pointing at it. If kubectl is not found in PATH, a pinned version is downloaded
+and cached for later use.`,
+		Example:       `  sbctl kubectl -s ./support-bundle.tar.gz -- get pods -A`,
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var kubeConfig string
+			var bundleDir string
+			var convertedDir string
+			deleteBundleDir := false
+
+			cleanup := func() {
+				if kubeConfig != "" {
+					_ = os.RemoveAll(kubeConfig)
+				}
+				if deleteBundleDir && bundleDir != "" {
+					_ = removeBundleData(bundleDir)
+				}
+				if convertedDir != "" {
+					_ = removeBundleData(convertedDir)
+				}
+			}
+			defer cleanup()
+
+			go func() {
+				signalChan := make(chan os.Signal, 1)
+				signal.Notify(signalChan, os.Interrupt)
+				<-signalChan
+				cleanup()
+				os.Exit(0)
+			}()
+
+			v := viper.GetViper()
+
+			// Keep API server logs from mixing with kubectl output unless asked for
+			var logOutput io.Writer = io.Discard
+			if v.GetBool("debug") {
+				logOutput = os.Stderr
+			}
+			log.SetOutput(logOutput)
+
+			kubectlPath, err := findKubectl(v.GetString("kubectl-path"), v.GetBool("download-kubectl"))
+			if err != nil {
+				return errors.Wrap(err, "failed to find kubectl")
+			}
+
+			bundleDir, deleteBundleDir, err = getBundleDir(v.GetString("support-bundle-location"), v.GetString("token"))
+			if err != nil {
+				return err
+			}
+			bundleDir, deleteBundleDir, err = overlayDeltas(bundleDir, deleteBundleDir, v.GetString("token"))
+			if err != nil {
+				return err
+			}
+
+			clusterData, convertedDir, err := getClusterData(bundleDir)
+			if err != nil {
+				return err
+			}
+			clusterData = indexClusterData(v.GetString("support-bundle-location"), deleteBundleDir, clusterData)
+
+			if err := api.LoadPrinterPlugins(v.GetStringSlice("printer-plugin")); err != nil {
+				return err
+			}
+
+			kubeConfig, err = api.StartAPIServer(clusterData, logOutput)
+			if err != nil {
+				return usererrors.New(usererrors.ServerStartFailed, err)
+			}
+
+			kubectlExec := exec.Command(kubectlPath, args...)
+			kubectlExec.Env = append(os.Environ(), fmt.Sprintf("KUBECONFIG=%s", kubeConfig))
+			kubectlExec.Stdin = os.Stdin
+			kubectlExec.Stdout = os.Stdout
+			kubectlExec.Stderr = os.Stderr
+
+			err = kubectlExec.Run()
+			printUnservedSummary(os.Stderr)
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				// kubectl already printed its own error, just pass the exit code through
+				cleanup()
+				os.Exit(exitErr.ExitCode())
+			}
+			if err != nil {
+				return errors.Wrap(err, "failed to run kubectl")
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	cmd.Flags().String("kubectl-path", "", "path to the kubectl binary to use")
+	cmd.Flags().Bool("download-kubectl", false, fmt.Sprintf("always use the pinned kubectl %s instead of the one in PATH", kubectlVersion))
+	cmd.Flags().Bool("debug", false, "enable debug logging. This will include HTTP response bodies in logs.")
+	cmd.Flags().String("max-response-size", "256Mi", "largest API response to send, e.g. 64Mi. Larger lists must be paged. Set to 0 to disable.")
+	cmd.Flags().Bool("disable-compression", false, "do not gzip large API responses")
+	cmd.Flags().Bool("no-aggregate", false, "list every collected event rather than combining repeated events about the same object and reason")
+	cmd.Flags().Duration("request-timeout", 0, "longest time to spend on an API request, unless the client asks for another timeout. 0 means no limit.")
+	cmd.Flags().String("usage-report", "", "opt in to recording which resources sbctl could not serve, without names or namespaces, in this JSON file")
+	cmd.Flags().StringSlice("printer-plugin", nil, "Go plugin registering table printers for custom resources. Can be repeated.")
+	return cmd
+}
+
+// findKubectl returns the path of the kubectl binary to run. An explicit path always wins,
+// then kubectl from PATH, and finally the pinned version which is downloaded if not yet cached.
+func findKubectl(kubectlPath string, forceDownload bool) (string, error) {
+	if kubectlPath != "" {
+		if !fileExists(kubectlPath) {
+			return "", errors.Errorf("%s does not exist", kubectlPath)
+		}
+		return kubectlPath, nil
+	}
+
+	if !forceDownload {
+		if p, err := exec.LookPath("kubectl"); err == nil {
+			return p, nil
+		}
+	}
+
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get cache dir")
+	}
+
+	binName := "kubectl"
+	if runtime.GOOS == "windows" {
+		binName = "kubectl.exe"
+	}
+
+	cachedPath := filepath.Join(cacheDir, "sbctl", "kubectl", kubectlVersion, binName)
+	if fileExists(cachedPath) {
+		return cachedPath, nil
+	}
+
+	fmt.Fprintf(os.Stderr, "Downloading kubectl %s\n", kubectlVersion)
+	err = downloadKubectl(cachedPath, binName)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to download kubectl")
+	}
+
+	return cachedPath, nil
+}
+
+func downloadKubectl(outFilename string, binName string) error {
+	binURL := fmt.Sprintf("%s/%s/bin/%s/%s/%s", kubectlBaseURL, kubectlVersion, runtime.GOOS, runtime.GOARCH, binName)
+
+	expectedSum, err := getKubectlChecksum(binURL + ".sha256")
+	if err != nil {
+		return errors.Wrap(err, "failed to get checksum")
+	}
+
+	resp, err := http.Get(binURL) // nolint: gosec // URL is built from constants
+	if err != nil {
+		return errors.Wrap(err, "failed to execute request")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("unexpected status code: %v", resp.StatusCode)
+	}
+
+	err = os.MkdirAll(filepath.Dir(outFilename), 0755)
+	if err != nil {
+		return errors.Wrap(err, "failed to create cache dir")
+	}
+
+	// Download next to the final location and rename once verified,
+	// so a partial download is never picked up from the cache.
+	tmpFile, err := os.CreateTemp(filepath.Dir(outFilename), "kubectl-")
+	if err != nil {
+		return errors.Wrap(err, "failed to create temp file")
+	}
+	defer os.RemoveAll(tmpFile.Name())
+	defer tmpFile.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmpFile, hash), resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "failed to copy kubectl to tmp file")
+	}
+
+	actualSum := hex.EncodeToString(hash.Sum(nil))
+	if actualSum != expectedSum {
+		return errors.Errorf("checksum mismatch: expected %s, got %s", expectedSum, actualSum)
+	}
+
+	err = tmpFile.Chmod(0755)
+	if err != nil {
+		return errors.Wrap(err, "failed to make kubectl executable")
+	}
+
+	_ = tmpFile.Close()
+
+	err = os.Rename(tmpFile.Name(), outFilename)
+	if err != nil {
+		return errors.Wrap(err, "failed to move kubectl to cache dir")
+	}
+
+	return nil
+}
+
+func getKubectlChecksum(sumURL string) (string, error) {
+	resp, err := http.Get(sumURL) // nolint: gosec // URL is built from constants
+	if err != nil {
+		return "", errors.Wrap(err, "failed to execute request")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("unexpected status code: %v", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read checksum")
+	}
+
+	fields := strings.Fields(string(body))
+	if len(fields) == 0 {
+		return "", errors.New("empty checksum file")
+	}
+
+	return fields[0], nil
+}
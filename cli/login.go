@@ -0,0 +1,284 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// deviceCodeGrantType is the grant type of the OAuth 2.0 device authorization grant, RFC 8628
+const deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// oidcProvider is the part of an OpenID provider's discovery document used to log in
+type oidcProvider struct {
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint"`
+	TokenEndpoint               string `json:"token_endpoint"`
+}
+
+type deviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int    `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func LoginCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "login <portal-url>",
+		Short: "Log in to a vendor portal with single sign-on",
+		Long: `Log in to a vendor portal with single sign-on.
+
+The OpenID Connect device flow is used: sbctl prints a URL and a code to confirm in a browser,
+which can be on another machine. The tokens are cached in the sbctl config dir, in a file only
+readable by the user, and used to download bundles from the portal when no --token is given.
+Access tokens are refreshed when they expire, until the portal ends the session.`,
+		Example: `  sbctl login https://vendor.example.com --issuer https://sso.example.com --client-id sbctl
+  sbctl shell https://vendor.example.com/troubleshoot/bundles/abc123`,
+		Args:          cobra.ExactArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			key, err := portalKey(args[0])
+			if err != nil {
+				return err
+			}
+			issuer := v.GetString("issuer")
+			if issuer == "" {
+				return usererrors.New(usererrors.MissingArgument, nil, "--issuer")
+			}
+			clientID := v.GetString("client-id")
+			if clientID == "" {
+				return usererrors.New(usererrors.MissingArgument, nil, "--client-id")
+			}
+
+			portal, err := deviceLogin(issuer, clientID, v.GetStringSlice("scopes"), os.Stdout)
+			if err != nil {
+				return err
+			}
+
+			creds, err := readCredentials()
+			if err != nil {
+				return err
+			}
+			creds.Portals[key] = portal
+			if err := writeCredentials(creds); err != nil {
+				return err
+			}
+
+			fmt.Printf("Logged in to %s\n", key)
+			return nil
+		},
+	}
+
+	cmd.Flags().String("issuer", "", "URL of the portal's OpenID Connect issuer")
+	cmd.Flags().String("client-id", "", "OAuth client ID sbctl is registered with at the issuer")
+	cmd.Flags().StringSlice("scopes", []string{"openid", "offline_access"}, "scopes to request. offline_access is needed to refresh tokens.")
+	return cmd
+}
+
+func LogoutCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:           "logout <portal-url>",
+		Short:         "Remove the cached login to a vendor portal",
+		Args:          cobra.ExactArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			key, err := portalKey(args[0])
+			if err != nil {
+				return err
+			}
+
+			creds, err := readCredentials()
+			if err != nil {
+				return err
+			}
+			if _, ok := creds.Portals[key]; !ok {
+				fmt.Printf("Not logged in to %s\n", key)
+				return nil
+			}
+			delete(creds.Portals, key)
+			if err := writeCredentials(creds); err != nil {
+				return err
+			}
+
+			fmt.Printf("Logged out of %s\n", key)
+			return nil
+		},
+	}
+	return cmd
+}
+
+func discoverOIDCProvider(issuer string) (oidcProvider, error) {
+	provider := oidcProvider{}
+
+	resp, err := http.Get(strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		return provider, errors.Wrap(err, "failed to get OpenID configuration")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return provider, errors.Errorf("unexpected status code getting OpenID configuration: %v", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&provider); err != nil {
+		return provider, errors.Wrap(err, "failed to decode OpenID configuration")
+	}
+	if provider.TokenEndpoint == "" {
+		return provider, errors.Errorf("issuer %s has no token endpoint", issuer)
+	}
+	return provider, nil
+}
+
+// postForm posts a form to an OAuth endpoint and decodes the JSON response. OAuth errors are
+// returned in the body with a 4xx status, so the body is decoded whatever the status.
+func postForm(endpoint string, form url.Values, out interface{}) (int, error) {
+	resp, err := http.PostForm(endpoint, form)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to execute request")
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, errors.Wrap(err, "failed to read response")
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return resp.StatusCode, errors.Errorf("unexpected response with status code %v: %s", resp.StatusCode, body)
+	}
+	return resp.StatusCode, nil
+}
+
+// deviceLogin runs the device authorization grant: the user confirms a code in a browser while
+// the token endpoint is polled at the interval the issuer asks for
+func deviceLogin(issuer string, clientID string, scopes []string, out io.Writer) (portalCredentials, error) {
+	provider, err := discoverOIDCProvider(issuer)
+	if err != nil {
+		return portalCredentials{}, err
+	}
+	if provider.DeviceAuthorizationEndpoint == "" {
+		return portalCredentials{}, errors.Errorf("issuer %s does not support the device flow", issuer)
+	}
+
+	auth := deviceAuthorization{}
+	statusCode, err := postForm(provider.DeviceAuthorizationEndpoint, url.Values{
+		"client_id": {clientID},
+		"scope":     {strings.Join(scopes, " ")},
+	}, &auth)
+	if err != nil {
+		return portalCredentials{}, errors.Wrap(err, "failed to start device login")
+	}
+	if statusCode != http.StatusOK || auth.DeviceCode == "" {
+		return portalCredentials{}, errors.Errorf("failed to start device login: unexpected status code: %v", statusCode)
+	}
+
+	if auth.VerificationURIComplete != "" {
+		fmt.Fprintf(out, "Open %s in a browser and confirm the code %s\n", auth.VerificationURIComplete, auth.UserCode)
+	} else {
+		fmt.Fprintf(out, "Open %s in a browser and enter the code %s\n", auth.VerificationURI, auth.UserCode)
+	}
+
+	// RFC 8628 defaults to polling every 5 seconds
+	interval := 5 * time.Second
+	if auth.Interval > 0 {
+		interval = time.Duration(auth.Interval) * time.Second
+	}
+	deadline := time.Now().Add(time.Duration(auth.ExpiresIn) * time.Second)
+	if auth.ExpiresIn <= 0 {
+		deadline = time.Now().Add(10 * time.Minute)
+	}
+
+	for time.Now().Before(deadline) {
+		time.Sleep(interval)
+
+		token := tokenResponse{}
+		_, err := postForm(provider.TokenEndpoint, url.Values{
+			"grant_type":  {deviceCodeGrantType},
+			"device_code": {auth.DeviceCode},
+			"client_id":   {clientID},
+		}, &token)
+		if err != nil {
+			return portalCredentials{}, errors.Wrap(err, "failed to get token")
+		}
+
+		switch token.Error {
+		case "":
+			return token.credentials(issuer, clientID, ""), nil
+		case "authorization_pending":
+			continue
+		case "slow_down":
+			interval += 5 * time.Second
+			continue
+		case "access_denied":
+			return portalCredentials{}, errors.New("login was denied")
+		case "expired_token":
+			return portalCredentials{}, errors.New("login code expired, run sbctl login again")
+		}
+		return portalCredentials{}, errors.Errorf("failed to get token: %s %s", token.Error, token.ErrorDescription)
+	}
+	return portalCredentials{}, errors.New("login code expired, run sbctl login again")
+}
+
+// refreshPortalToken gets a new access token with the refresh token of a login
+func refreshPortalToken(portal portalCredentials) (portalCredentials, error) {
+	provider, err := discoverOIDCProvider(portal.Issuer)
+	if err != nil {
+		return portal, err
+	}
+
+	token := tokenResponse{}
+	_, err = postForm(provider.TokenEndpoint, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {portal.RefreshToken},
+		"client_id":     {portal.ClientID},
+	}, &token)
+	if err != nil {
+		return portal, err
+	}
+	if token.Error != "" {
+		return portal, errors.Errorf("%s %s", token.Error, token.ErrorDescription)
+	}
+	return token.credentials(portal.Issuer, portal.ClientID, portal.RefreshToken), nil
+}
+
+// credentials keeps the previous refresh token when the issuer does not rotate refresh tokens
+func (t tokenResponse) credentials(issuer string, clientID string, previousRefreshToken string) portalCredentials {
+	portal := portalCredentials{
+		Issuer:       issuer,
+		ClientID:     clientID,
+		AccessToken:  t.AccessToken,
+		RefreshToken: t.RefreshToken,
+	}
+	if portal.RefreshToken == "" {
+		portal.RefreshToken = previousRefreshToken
+	}
+	if t.ExpiresIn > 0 {
+		portal.Expiry = time.Now().Add(time.Duration(t.ExpiresIn) * time.Second)
+	}
+	return portal
+}
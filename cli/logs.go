@@ -0,0 +1,138 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/api"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func LogsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "logs node/<name>",
+		Short: "Print logs of node services such as kubelet and containerd",
+		Long: `Print logs of node services such as kubelet and containerd.
+
+Node service logs are not served by the API server, so they are only in a bundle when collected
+from hosts, e.g. with journald or run host collectors. Without --component, the components with
+logs on the node are listed. Pod logs are available with kubectl logs in sbctl shell.`,
+		Example: `  sbctl logs node/node-1
+  sbctl logs node/node-1 --component kubelet --tail 100
+  sbctl logs node/node-1 --component containerd --since-time 2024-01-02T15:04:05Z`,
+		Args:          cobra.ExactArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			kind, node, ok := strings.Cut(args[0], "/")
+			if !ok || node == "" {
+				return errors.Errorf("expected node/<name>, got %q", args[0])
+			}
+			if kind != "node" && kind != "nodes" && kind != "no" {
+				return errors.Errorf("only node logs are supported, use kubectl logs in sbctl shell for %s logs", kind)
+			}
+
+			opts, err := nodeLogOptions(v)
+			if err != nil {
+				return err
+			}
+
+			clusterData, cleanup, err := loadClusterData(v)
+			defer cleanup()
+			if err != nil {
+				return err
+			}
+
+			component := v.GetString("component")
+			if component == "" {
+				logs, err := sbctl.FindNodeLogs(clusterData)
+				if err != nil {
+					return errors.Wrap(err, "failed to find node logs")
+				}
+				return printNodeLogs(os.Stdout, node, logs)
+			}
+
+			nodeLog, err := sbctl.FindNodeLog(clusterData, node, component)
+			if err != nil {
+				return err
+			}
+
+			f, err := api.OpenLog(filepath.Join(filepath.Dir(clusterData.ClusterResourcesDir), filepath.FromSlash(nodeLog.File)), opts)
+			if err != nil {
+				return errors.Wrap(err, "failed to open log")
+			}
+			defer f.Close()
+
+			_, err = io.Copy(os.Stdout, f)
+			return err
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	cmd.Flags().StringP("component", "c", "", "component to print the log of, e.g. kubelet, or the file of the log when a component has several")
+	cmd.Flags().Int64("tail", -1, "lines of the end of the log to print. -1 prints every line.")
+	cmd.Flags().Duration("since", 0, "only print lines newer than a relative duration like 5s, 2m, or 3h")
+	cmd.Flags().String("since-time", "", "only print lines after a time in RFC3339 format")
+	cmd.Flags().Int64("limit-bytes", 0, "maximum bytes of the log to print")
+	return cmd
+}
+
+// nodeLogOptions builds log options from flags named like the ones of kubectl logs
+func nodeLogOptions(v *viper.Viper) (api.LogOptions, error) {
+	opts := api.NewLogOptions()
+	opts.TailLines = v.GetInt64("tail")
+	opts.LimitBytes = v.GetInt64("limit-bytes")
+
+	since := v.GetDuration("since")
+	sinceTime := v.GetString("since-time")
+	if since != 0 && sinceTime != "" {
+		return opts, errors.New("--since and --since-time cannot be used together")
+	}
+	if since != 0 {
+		opts.Since = time.Now().Add(-since)
+	}
+	if sinceTime != "" {
+		t, err := time.Parse(time.RFC3339, sinceTime)
+		if err != nil {
+			return opts, usererrors.New(usererrors.InvalidArgument, errors.Errorf("invalid --since-time %q, must be in RFC3339 format", sinceTime), "--since-time")
+		}
+		opts.Since = t
+	}
+	return opts, nil
+}
+
+func printNodeLogs(out io.Writer, node string, logs []sbctl.NodeLog) error {
+	found := []sbctl.NodeLog{}
+	for _, l := range logs {
+		if l.Node == node {
+			found = append(found, l)
+		}
+	}
+	if len(found) == 0 {
+		return errors.Errorf("no logs of node %s found in support bundle", node)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "COMPONENT\tFILE")
+	for _, l := range found {
+		fmt.Fprintf(w, "%s\t%s\n", l.Component, l.File)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func MergeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "merge <bundle> <bundle>...",
+		Short: "Combine bundles collected one after another into one bundle",
+		Long: `Combine bundles collected one after another into one bundle.
+
+This is for tools that can only load one archive. Bundles are ordered by when they were collected,
+from the events in them, and their files are merged by path. When bundles have different files at
+the same path, --conflict decides which are kept:
+  latest      the file of the most recently collected bundle
+  keep-both   the file of the most recently collected bundle, and those of earlier bundles next to
+              it with .1, .2 and so on appended, newest first, as rotated logs are. sbctl serves
+              the latest files only.`,
+		Example: `  sbctl merge monday.tgz tuesday.tgz -o merged.tgz
+  sbctl merge monday.tgz tuesday.tgz --conflict keep-both -o merged.tgz`,
+		Args:          cobra.MinimumNArgs(2),
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			output := v.GetString("output")
+			if output == "" {
+				return usererrors.New(usererrors.MissingArgument, nil, "--output")
+			}
+			conflict := v.GetString("conflict")
+			if conflict != sbctl.MergeConflictLatest && conflict != sbctl.MergeConflictKeepBoth {
+				return usererrors.New(usererrors.InvalidArgument, errors.Errorf("unsupported conflict policy %q, must be %s or %s", conflict, sbctl.MergeConflictLatest, sbctl.MergeConflictKeepBoth), "--conflict")
+			}
+
+			type collectedBundle struct {
+				clusterData sbctl.ClusterData
+				collectedAt time.Time
+			}
+			bundles := []collectedBundle{}
+			for _, arg := range args {
+				bundleDir, deleteBundleDir, err := getBundleDir(arg, v.GetString("token"))
+				if err != nil {
+					return errors.Wrapf(err, "failed to load %s", arg)
+				}
+				if deleteBundleDir {
+					defer removeBundleData(bundleDir)
+				}
+				clusterData, convertedDir, err := getClusterData(bundleDir)
+				if convertedDir != "" {
+					defer removeBundleData(convertedDir)
+				}
+				if err != nil {
+					return errors.Wrapf(err, "failed to load %s", arg)
+				}
+
+				events, err := sbctl.ListResources(clusterData, "", "events")
+				if err != nil {
+					return errors.Wrapf(err, "failed to list events of %s", arg)
+				}
+				bundles = append(bundles, collectedBundle{clusterData: clusterData, collectedAt: bundleCollectionTime(events)})
+			}
+			sort.SliceStable(bundles, func(i, j int) bool {
+				return bundles[i].collectedAt.Before(bundles[j].collectedAt)
+			})
+
+			clusterData := []sbctl.ClusterData{}
+			for _, b := range bundles {
+				clusterData = append(clusterData, b.clusterData)
+			}
+
+			f, err := os.Create(output)
+			if err != nil {
+				return errors.Wrap(err, "failed to create output file")
+			}
+			defer f.Close()
+
+			count, err := sbctl.MergeBundles(clusterData, conflict, f, bundleArchiveName(output))
+			if err != nil {
+				_ = os.Remove(output)
+				return errors.Wrap(err, "failed to write bundle")
+			}
+			if err := f.Close(); err != nil {
+				return errors.Wrap(err, "failed to write bundle")
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Wrote %d files of %d bundles to %s\n", count, len(bundles), output)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	cmd.Flags().String("conflict", sbctl.MergeConflictLatest, "files to keep when bundles differ at the same path. One of: latest, keep-both")
+	cmd.Flags().StringP("output", "o", "", "file to write the merged bundle to, as a gzipped tar archive")
+	return cmd
+}
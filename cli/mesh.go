@@ -0,0 +1,299 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Envoy config dumps are collected with custom collectors (e.g. exec of "pilot-agent request GET config_dump"),
+// so they can be anywhere in the bundle. Only the parts needed for the summary are decoded.
+type envoyConfigDump struct {
+	Configs []envoyConfig `json:"configs"`
+}
+
+type envoyConfig struct {
+	Type string `json:"@type"`
+
+	// BootstrapConfigDump
+	Bootstrap *struct {
+		Node struct {
+			ID string `json:"id"`
+		} `json:"node"`
+	} `json:"bootstrap,omitempty"`
+
+	// ListenersConfigDump
+	StaticListeners []struct {
+		Listener envoyNamed `json:"listener"`
+	} `json:"static_listeners,omitempty"`
+	DynamicListeners []struct {
+		Name        string `json:"name"`
+		ActiveState *struct {
+			Listener envoyNamed `json:"listener"`
+		} `json:"active_state,omitempty"`
+		WarmingState *struct{} `json:"warming_state,omitempty"`
+		ErrorState   *struct {
+			Details string `json:"details"`
+		} `json:"error_state,omitempty"`
+	} `json:"dynamic_listeners,omitempty"`
+
+	// ClustersConfigDump
+	StaticClusters []struct {
+		Cluster envoyNamed `json:"cluster"`
+	} `json:"static_clusters,omitempty"`
+	DynamicActiveClusters []struct {
+		Cluster envoyNamed `json:"cluster"`
+	} `json:"dynamic_active_clusters,omitempty"`
+	DynamicWarmingClusters []struct {
+		Cluster envoyNamed `json:"cluster"`
+	} `json:"dynamic_warming_clusters,omitempty"`
+
+	// RoutesConfigDump
+	StaticRouteConfigs []struct {
+		RouteConfig envoyRouteConfig `json:"route_config"`
+	} `json:"static_route_configs,omitempty"`
+	DynamicRouteConfigs []struct {
+		RouteConfig envoyRouteConfig `json:"route_config"`
+	} `json:"dynamic_route_configs,omitempty"`
+}
+
+type envoyNamed struct {
+	Name string `json:"name"`
+}
+
+type envoyRouteConfig struct {
+	Name         string `json:"name"`
+	VirtualHosts []struct {
+		Name    string   `json:"name"`
+		Domains []string `json:"domains"`
+	} `json:"virtual_hosts"`
+}
+
+type meshWorkloadSummary struct {
+	Workload        string
+	Source          string
+	Listeners       []string
+	ListenerErrors  []string
+	WarmingCount    int
+	Clusters        []string
+	WarmingClusters []string
+	Routes          []string
+}
+
+func MeshCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "mesh [workload]",
+		Short: "Summarize Envoy proxy configuration collected in a support bundle",
+		Long: `Summarize Envoy proxy configuration collected in a support bundle.
+
+Envoy config dumps (for example from istio-proxy sidecars) are found anywhere in the bundle and
+summarized per workload with counts of listeners, clusters and routes, and any listeners that
+failed to apply. Pass a workload name (pod.namespace) to list the individual listeners, clusters and routes.
+
+Istio custom resources such as VirtualServices are served by the API server like any other custom resource.`,
+		Args:          cobra.MaximumNArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			clusterData, cleanup, err := loadClusterData(v)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			summaries, err := findEnvoyConfigDumps(clusterData)
+			if err != nil {
+				return errors.Wrap(err, "failed to find envoy config dumps")
+			}
+
+			if len(args) == 1 {
+				for _, s := range summaries {
+					if s.Workload == args[0] {
+						printMeshWorkload(os.Stdout, s)
+						return nil
+					}
+				}
+				return errors.Errorf("no envoy config dump found for workload %q", args[0])
+			}
+
+			if len(summaries) == 0 {
+				fmt.Println("No Envoy config dumps found in support bundle")
+				return nil
+			}
+
+			printMeshSummaries(os.Stdout, summaries)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	return cmd
+}
+
+func findEnvoyConfigDumps(clusterData sbctl.ClusterData) ([]meshWorkloadSummary, error) {
+	summaries := []meshWorkloadSummary{}
+	if clusterData.ClusterResourcesDir == "" {
+		return summaries, nil
+	}
+
+	bundleRoot := filepath.Dir(clusterData.ClusterResourcesDir)
+	err := filepath.Walk(bundleRoot, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			// Regular resources and pod logs never contain config dumps
+			if path == clusterData.ClusterResourcesDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		ext := filepath.Ext(path)
+		if ext != ".json" && ext != ".txt" {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read %s", path)
+		}
+		if !strings.Contains(string(data), "envoy.admin.v3.") {
+			return nil
+		}
+
+		dump := envoyConfigDump{}
+		if err := json.Unmarshal(data, &dump); err != nil {
+			// Not a config dump, but mentions envoy types. Nothing to summarize.
+			return nil
+		}
+
+		rel, _ := filepath.Rel(bundleRoot, path)
+		summaries = append(summaries, summarizeEnvoyConfigDump(dump, rel))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Workload < summaries[j].Workload
+	})
+
+	return summaries, nil
+}
+
+func summarizeEnvoyConfigDump(dump envoyConfigDump, source string) meshWorkloadSummary {
+	s := meshWorkloadSummary{
+		Workload: source,
+		Source:   source,
+	}
+
+	for _, c := range dump.Configs {
+		if c.Bootstrap != nil {
+			// Istio node IDs look like sidecar~10.0.0.1~pod-name.namespace~namespace.svc.cluster.local
+			parts := strings.Split(c.Bootstrap.Node.ID, "~")
+			if len(parts) == 4 {
+				s.Workload = parts[2]
+			} else if c.Bootstrap.Node.ID != "" {
+				s.Workload = c.Bootstrap.Node.ID
+			}
+		}
+
+		for _, l := range c.StaticListeners {
+			s.Listeners = append(s.Listeners, l.Listener.Name)
+		}
+		for _, l := range c.DynamicListeners {
+			if l.ActiveState != nil {
+				s.Listeners = append(s.Listeners, l.ActiveState.Listener.Name)
+			}
+			if l.WarmingState != nil {
+				s.WarmingCount++
+			}
+			if l.ErrorState != nil {
+				s.ListenerErrors = append(s.ListenerErrors, fmt.Sprintf("%s: %s", l.Name, l.ErrorState.Details))
+			}
+		}
+
+		for _, cl := range c.StaticClusters {
+			s.Clusters = append(s.Clusters, cl.Cluster.Name)
+		}
+		for _, cl := range c.DynamicActiveClusters {
+			s.Clusters = append(s.Clusters, cl.Cluster.Name)
+		}
+		for _, cl := range c.DynamicWarmingClusters {
+			s.WarmingClusters = append(s.WarmingClusters, cl.Cluster.Name)
+		}
+
+		routeConfigs := []envoyRouteConfig{}
+		for _, r := range c.StaticRouteConfigs {
+			routeConfigs = append(routeConfigs, r.RouteConfig)
+		}
+		for _, r := range c.DynamicRouteConfigs {
+			routeConfigs = append(routeConfigs, r.RouteConfig)
+		}
+		for _, r := range routeConfigs {
+			for _, vh := range r.VirtualHosts {
+				s.Routes = append(s.Routes, fmt.Sprintf("%s -> %s (%s)", r.Name, vh.Name, strings.Join(vh.Domains, ",")))
+			}
+		}
+	}
+
+	return s
+}
+
+func printMeshSummaries(out io.Writer, summaries []meshWorkloadSummary) {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "WORKLOAD\tLISTENERS\tCLUSTERS\tROUTES\tWARMING\tERRORS\tSOURCE")
+	for _, s := range summaries {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%s\n",
+			s.Workload,
+			len(s.Listeners),
+			len(s.Clusters),
+			len(s.Routes),
+			s.WarmingCount+len(s.WarmingClusters),
+			len(s.ListenerErrors),
+			s.Source,
+		)
+	}
+}
+
+func printMeshWorkload(out io.Writer, s meshWorkloadSummary) {
+	fmt.Fprintf(out, "Workload: %s\n", s.Workload)
+	fmt.Fprintf(out, "Source:   %s\n", s.Source)
+
+	printSection := func(title string, items []string) {
+		fmt.Fprintf(out, "\n%s (%d):\n", title, len(items))
+		for _, i := range items {
+			fmt.Fprintf(out, "  %s\n", i)
+		}
+	}
+
+	printSection("Listeners", s.Listeners)
+	if len(s.ListenerErrors) > 0 {
+		printSection("Listener Errors", s.ListenerErrors)
+	}
+	printSection("Clusters", s.Clusters)
+	if len(s.WarmingClusters) > 0 {
+		printSection("Warming Clusters", s.WarmingClusters)
+	}
+	printSection("Routes", s.Routes)
+}
@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+)
+
+var _ = Describe("Mesh", func() {
+	configDump := `{
+		"configs": [
+			{
+				"@type": "type.googleapis.com/envoy.admin.v3.BootstrapConfigDump",
+				"bootstrap": {"node": {"id": "sidecar~10.0.0.1~web-0.default~default.svc.cluster.local"}}
+			},
+			{
+				"@type": "type.googleapis.com/envoy.admin.v3.ListenersConfigDump",
+				"static_listeners": [{"listener": {"name": "admin"}}],
+				"dynamic_listeners": [
+					{"name": "0.0.0.0_8080", "active_state": {"listener": {"name": "0.0.0.0_8080"}}},
+					{"name": "0.0.0.0_9090", "warming_state": {}},
+					{"name": "0.0.0.0_443", "error_state": {"details": "address already in use"}}
+				]
+			},
+			{
+				"@type": "type.googleapis.com/envoy.admin.v3.ClustersConfigDump",
+				"static_clusters": [{"cluster": {"name": "prometheus_stats"}}],
+				"dynamic_active_clusters": [{"cluster": {"name": "outbound|80||api.default.svc.cluster.local"}}],
+				"dynamic_warming_clusters": [{"cluster": {"name": "outbound|80||db.default.svc.cluster.local"}}]
+			},
+			{
+				"@type": "type.googleapis.com/envoy.admin.v3.RoutesConfigDump",
+				"dynamic_route_configs": [{"route_config": {"name": "80", "virtual_hosts": [{"name": "api.default.svc.cluster.local:80", "domains": ["api", "api.default"]}]}}]
+			}
+		]
+	}`
+
+	writeBundleFile := func(dir string, name string, data string) {
+		fileName := filepath.Join(dir, name)
+		Expect(os.MkdirAll(filepath.Dir(fileName), 0755)).To(Succeed())
+		Expect(os.WriteFile(fileName, []byte(data), 0644)).To(Succeed())
+	}
+
+	It("Summarizes config dumps by the workload of their node", func() {
+		dir := GinkgoT().TempDir()
+		writeClusterResource(dir, "namespaces.json", fixtureList("v1", "Namespace", `{"metadata": {"name": "default"}}`))
+		writeBundleFile(dir, "istio/config-dump/web-0.txt", configDump)
+
+		clusterData, err := sbctl.FindClusterData(dir)
+		Expect(err).NotTo(HaveOccurred())
+
+		summaries, err := findEnvoyConfigDumps(clusterData)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(summaries).To(HaveLen(1))
+
+		s := summaries[0]
+		Expect(s.Workload).To(Equal("web-0.default"))
+		Expect(s.Source).To(Equal(filepath.Join("istio", "config-dump", "web-0.txt")))
+		Expect(s.Listeners).To(Equal([]string{"admin", "0.0.0.0_8080"}))
+		Expect(s.WarmingCount).To(Equal(1))
+		Expect(s.ListenerErrors).To(Equal([]string{"0.0.0.0_443: address already in use"}))
+		Expect(s.Clusters).To(Equal([]string{"prometheus_stats", "outbound|80||api.default.svc.cluster.local"}))
+		Expect(s.WarmingClusters).To(Equal([]string{"outbound|80||db.default.svc.cluster.local"}))
+		Expect(s.Routes).To(Equal([]string{"80 -> api.default.svc.cluster.local:80 (api,api.default)"}))
+	})
+
+	It("Skips cluster resources and files that are not config dumps", func() {
+		dir := GinkgoT().TempDir()
+		writeClusterResource(dir, "configmaps/istio-system.json", configDump)
+		writeBundleFile(dir, "istio/notes.txt", "envoy.admin.v3.ListenersConfigDump is not json")
+		writeBundleFile(dir, "istio/config.yaml", configDump)
+
+		clusterData, err := sbctl.FindClusterData(dir)
+		Expect(err).NotTo(HaveOccurred())
+
+		summaries, err := findEnvoyConfigDumps(clusterData)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(summaries).To(BeEmpty())
+	})
+
+	It("Names workloads after the source of dumps without an Istio node ID", func() {
+		s := summarizeEnvoyConfigDump(envoyConfigDump{}, "envoy/dump.json")
+		Expect(s.Workload).To(Equal("envoy/dump.json"))
+
+		dump := envoyConfigDump{}
+		Expect(json.Unmarshal([]byte(`{"configs": [{"bootstrap": {"node": {"id": "gateway"}}}]}`), &dump)).To(Succeed())
+		Expect(summarizeEnvoyConfigDump(dump, "envoy/dump.json").Workload).To(Equal("gateway"))
+	})
+
+	It("Counts warming listeners and clusters together", func() {
+		out := bytes.Buffer{}
+		printMeshSummaries(&out, []meshWorkloadSummary{{
+			Workload:        "web-0.default",
+			Source:          "istio/web-0.txt",
+			Listeners:       []string{"admin"},
+			WarmingCount:    1,
+			WarmingClusters: []string{"db"},
+			ListenerErrors:  []string{"443: in use"},
+		}})
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		Expect(lines).To(HaveLen(2))
+		Expect(strings.Fields(lines[0])).To(Equal([]string{"WORKLOAD", "LISTENERS", "CLUSTERS", "ROUTES", "WARMING", "ERRORS", "SOURCE"}))
+		Expect(strings.Fields(lines[1])).To(Equal([]string{"web-0.default", "1", "0", "0", "2", "1", "istio/web-0.txt"}))
+	})
+})
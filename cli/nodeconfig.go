@@ -0,0 +1,217 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// maxNodeConfigFileSize skips large files, such as logs, when looking for node config files
+const maxNodeConfigFileSize = 1 << 20
+
+// nodeConfigFile is a static pod manifest or kubelet config copied from a host, e.g. with a
+// copyFromHost collector of /etc/kubernetes/manifests or /var/lib/kubelet/config.yaml
+type nodeConfigFile struct {
+	Kind   string
+	Name   string
+	Source string
+	object unstructured.Unstructured
+	data   []byte
+}
+
+func NodeConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "node-config [name|file]",
+		Short: "List static pod manifests and kubelet configs collected from hosts",
+		Long: `List static pod manifests and kubelet configs collected from hosts.
+
+Static pod manifests (/etc/kubernetes/manifests) and kubelet configs are not API objects, so they
+are only in a bundle when copied from hosts by collectors, and can be anywhere in it. Pass a name
+or a file to show the commands and images of a static pod, or the contents of a kubelet config.`,
+		Example: `  sbctl node-config
+  sbctl node-config kube-apiserver`,
+		Args:          cobra.MaximumNArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			clusterData, cleanup, err := loadClusterData(v)
+			defer cleanup()
+			if err != nil {
+				return err
+			}
+
+			files, err := findNodeConfigFiles(clusterData)
+			if err != nil {
+				return errors.Wrap(err, "failed to find node config files")
+			}
+
+			if len(args) == 1 {
+				matched := 0
+				for _, f := range files {
+					if f.Name == args[0] || f.Source == args[0] {
+						if matched > 0 {
+							fmt.Println()
+						}
+						if err := printNodeConfigFile(os.Stdout, f); err != nil {
+							return err
+						}
+						matched++
+					}
+				}
+				if matched == 0 {
+					return errors.Errorf("no static pod manifest or kubelet config %q found", args[0])
+				}
+				return nil
+			}
+
+			if len(files) == 0 {
+				fmt.Println("No static pod manifests or kubelet configs found in support bundle")
+				return nil
+			}
+
+			printNodeConfigFiles(os.Stdout, files)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	return cmd
+}
+
+func findNodeConfigFiles(clusterData sbctl.ClusterData) ([]nodeConfigFile, error) {
+	files := []nodeConfigFile{}
+	if clusterData.ClusterResourcesDir == "" {
+		return files, nil
+	}
+
+	bundleRoot := filepath.Dir(clusterData.ClusterResourcesDir)
+	err := filepath.Walk(bundleRoot, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			// Pods in cluster resources are API objects, not manifests
+			if path == clusterData.ClusterResourcesDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".yaml", ".yml", ".json", ".manifest", ".conf":
+		default:
+			return nil
+		}
+		if info.Size() > maxNodeConfigFileSize {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read %s", path)
+		}
+		if !bytes.Contains(data, []byte("kind")) {
+			return nil
+		}
+
+		obj := unstructured.Unstructured{}
+		if err := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), len(data)).Decode(&obj.Object); err != nil || obj.Object == nil {
+			return nil
+		}
+
+		rel, _ := filepath.Rel(bundleRoot, path)
+		file := nodeConfigFile{Kind: obj.GetKind(), Source: rel, object: obj, data: data}
+		switch {
+		case obj.GetKind() == "Pod" && obj.GetAPIVersion() == "v1":
+			file.Name = obj.GetName()
+		case obj.GetKind() == "KubeletConfiguration":
+			file.Name = "kubelet"
+		default:
+			return nil
+		}
+		files = append(files, file)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Name != files[j].Name {
+			return files[i].Name < files[j].Name
+		}
+		return files[i].Source < files[j].Source
+	})
+
+	return files, nil
+}
+
+func printNodeConfigFiles(out io.Writer, files []nodeConfigFile) {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "KIND\tNAME\tSOURCE")
+	for _, f := range files {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", f.Kind, valueOrNone(f.Name), f.Source)
+	}
+}
+
+// printNodeConfigFile prints the containers of static pods, whose flags are what usually needs
+// checking, and other files as they are
+func printNodeConfigFile(out io.Writer, f nodeConfigFile) error {
+	fmt.Fprintf(out, "Kind:   %s\n", f.Kind)
+	fmt.Fprintf(out, "Name:   %s\n", valueOrNone(f.Name))
+	fmt.Fprintf(out, "Source: %s\n", f.Source)
+
+	if f.Kind != "Pod" {
+		fmt.Fprintf(out, "\n%s", f.data)
+		if !bytes.HasSuffix(f.data, []byte("\n")) {
+			fmt.Fprintln(out)
+		}
+		return nil
+	}
+
+	pod := corev1.Pod{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(f.object.Object, &pod); err != nil {
+		return errors.Wrapf(err, "failed to decode %s", f.Source)
+	}
+	if pod.Spec.HostNetwork {
+		fmt.Fprintln(out, "Host Network: true")
+	}
+
+	for _, c := range pod.Spec.Containers {
+		fmt.Fprintf(out, "\nContainer %s:\n", c.Name)
+		fmt.Fprintf(out, "  Image: %s\n", c.Image)
+		args := append(append([]string{}, c.Command...), c.Args...)
+		if len(args) > 0 {
+			fmt.Fprintln(out, "  Command:")
+			for _, arg := range args {
+				fmt.Fprintf(out, "    %s\n", arg)
+			}
+		}
+		for _, m := range c.VolumeMounts {
+			fmt.Fprintf(out, "  Mount: %s\n", m.MountPath)
+		}
+	}
+	return nil
+}
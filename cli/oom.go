@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/output"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func OOMCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "oom",
+		Short: "List containers and processes killed for running out of memory",
+		Long: `List containers and processes killed for running out of memory.
+
+Containers terminated as OOMKilled are listed with their restart count and memory request and
+limit, next to kills nodes reported in SystemOOM and OOMKilling events and in kubelet and
+kernel logs collected by host collectors. A kill a node reported within a minute of a container's
+termination on that node is taken for the container's. The node's MemoryPressure condition at
+the time tells a container exceeding its limit apart from a node running out of memory.`,
+		Example:       `  sbctl oom -s ./support-bundle.tar.gz -n velero`,
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			format := v.GetString("format")
+			if format != "table" && format != "json" {
+				return usererrors.New(usererrors.InvalidArgument, errors.Errorf("unsupported format %q, must be one of: table, json", format), "--format")
+			}
+
+			clusterData, cleanup, err := loadClusterData(v)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			kills, err := sbctl.FindOOMKills(clusterData)
+			if err != nil {
+				return err
+			}
+			if namespace := v.GetString("namespace"); namespace != "" {
+				filtered := []sbctl.OOMKill{}
+				for _, kill := range kills {
+					if kill.Namespace == namespace {
+						filtered = append(filtered, kill)
+					}
+				}
+				kills = filtered
+			}
+
+			if format == "json" {
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				if err := encoder.Encode(kills); err != nil {
+					return errors.Wrap(err, "failed to write results")
+				}
+				return nil
+			}
+
+			p, err := newPrinter(os.Stdout)
+			if err != nil {
+				return err
+			}
+			if len(kills) == 0 {
+				fmt.Fprintln(p.Writer(), p.Green("No OOM kills found"))
+				return nil
+			}
+
+			events, err := sbctl.ListResources(clusterData, "", "events")
+			if err != nil {
+				return errors.Wrap(err, "failed to list events")
+			}
+			tf, err := newTimeFormat(v, bundleCollectionTime(events))
+			if err != nil {
+				return err
+			}
+			return printOOMKills(p, kills, tf)
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	cmd.Flags().StringP("namespace", "n", "", "only list containers in this namespace")
+	cmd.Flags().String("format", "table", "output format. One of: table, json")
+	return cmd
+}
+
+func printOOMKills(p *output.Printer, kills []sbctl.OOMKill, tf timeFormat) error {
+	t := p.NewTable("TIME", "NODE", "POD", "CONTAINER", "RESTARTS", "REQUEST", "LIMIT", "MEMORY PRESSURE", "SOURCE")
+	for _, kill := range kills {
+		pod := "<none>"
+		if kill.Pod != "" {
+			pod = kill.Namespace + "/" + kill.Pod
+		}
+		container := kill.Container
+		if container == "" && kill.Process != "" {
+			container = fmt.Sprintf("process %s (%s)", kill.Process, kill.PID)
+		}
+
+		pressure := valueOrNone(kill.NodeMemoryPressure)
+		if kill.NodeMemoryPressure == "True" {
+			pressure = p.Red(pressure)
+		}
+		limit := valueOrNone(kill.MemoryLimit)
+		if kill.Container != "" && kill.MemoryLimit == "" {
+			limit = p.Yellow(limit)
+		}
+
+		t.AddRow(tf.Format(kill.Time), valueOrNone(kill.Node), pod, valueOrNone(container), fmt.Sprint(kill.Restarts),
+			valueOrNone(kill.MemoryRequest), limit, pressure, strings.Join(kill.Sources, ","))
+	}
+	return t.Print()
+}
@@ -0,0 +1,202 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// defaultOwnerResources are scanned for bundles without resources.json. They are the resources
+// that own, or are owned by, other objects most often.
+var defaultOwnerResources = []metav1.APIResourceList{
+	{GroupVersion: "v1", APIResources: []metav1.APIResource{
+		{Name: "pods", Kind: "Pod", Namespaced: true},
+		{Name: "services", Kind: "Service", Namespaced: true},
+		{Name: "configmaps", Kind: "ConfigMap", Namespaced: true},
+		{Name: "persistentvolumeclaims", Kind: "PersistentVolumeClaim", Namespaced: true},
+		{Name: "persistentvolumes", Kind: "PersistentVolume"},
+		{Name: "nodes", Kind: "Node"},
+		{Name: "namespaces", Kind: "Namespace"},
+	}},
+	{GroupVersion: "apps/v1", APIResources: []metav1.APIResource{
+		{Name: "deployments", Kind: "Deployment", Namespaced: true},
+		{Name: "replicasets", Kind: "ReplicaSet", Namespaced: true},
+		{Name: "statefulsets", Kind: "StatefulSet", Namespaced: true},
+		{Name: "daemonsets", Kind: "DaemonSet", Namespaced: true},
+	}},
+	{GroupVersion: "batch/v1", APIResources: []metav1.APIResource{
+		{Name: "jobs", Kind: "Job", Namespaced: true},
+		{Name: "cronjobs", Kind: "CronJob", Namespaced: true},
+	}},
+}
+
+type orphan struct {
+	Object unstructured.Unstructured
+	Kind   string
+	Owner  metav1.OwnerReference
+	Reason string
+}
+
+func OrphansCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "orphans",
+		Short: "List objects whose owners are missing from a support bundle",
+		Long: `List objects whose owners are missing from a support bundle.
+
+Every ownerReference in the bundle is checked against the collected objects. Owners can be
+missing because their kind was not collected, which usually means the collection failed part
+way or lacked permissions, or because the owner was deleted, e.g. a controller that was removed
+without cleaning up. Owners that exist with a different uid were deleted and recreated.`,
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			clusterData, cleanup, err := loadClusterData(v)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			resources, err := listOwnerResources(clusterData)
+			if err != nil {
+				return errors.Wrap(err, "failed to list resources")
+			}
+
+			orphans := findOrphans(resources)
+			if len(orphans) == 0 {
+				fmt.Println("No objects with missing owners found")
+				return nil
+			}
+			printOrphans(os.Stdout, orphans)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	return cmd
+}
+
+// listOwnerResources reads the collected resources, or the default owner resources for bundles
+// without resources.json
+func listOwnerResources(clusterData sbctl.ClusterData) ([]sbctl.CollectedResource, error) {
+	resources, err := sbctl.ListCollectedResources(clusterData)
+	if err != nil || len(resources) > 0 {
+		return resources, err
+	}
+	return sbctl.ReadCollectedResources(clusterData, defaultOwnerResources)
+}
+
+// findOrphans checks the owner references of every collected object against the objects
+// collected of the owners' kinds
+func findOrphans(resources []sbctl.CollectedResource) []orphan {
+	type object struct {
+		obj  unstructured.Unstructured
+		kind string
+	}
+
+	// Kinds are keyed by group, since owner references only have the API version of the owner
+	namespaced := map[schema.GroupKind]bool{}
+	collected := map[schema.GroupKind]bool{}
+	byUID := map[types.UID]bool{}
+	byName := map[string]types.UID{}
+	objects := []object{}
+
+	for _, r := range resources {
+		gk := schema.GroupKind{Group: r.Group, Kind: r.Kind}
+		namespaced[gk] = r.Namespaced
+
+		for _, item := range r.Items {
+			if byUID[item.GetUID()] {
+				continue
+			}
+			byUID[item.GetUID()] = true
+			byName[ownerKey(r.Group, r.Kind, item.GetNamespace(), item.GetName())] = item.GetUID()
+			collected[gk] = true
+			objects = append(objects, object{obj: item, kind: r.Kind})
+		}
+	}
+
+	orphans := []orphan{}
+	for _, o := range objects {
+		for _, owner := range o.obj.GetOwnerReferences() {
+			gv, err := schema.ParseGroupVersion(owner.APIVersion)
+			if err != nil {
+				continue
+			}
+			gk := schema.GroupKind{Group: gv.Group, Kind: owner.Kind}
+			namespace := ""
+			if namespaced[gk] {
+				namespace = o.obj.GetNamespace()
+			}
+
+			uid, found := byName[ownerKey(gv.Group, owner.Kind, namespace, owner.Name)]
+			reason := ""
+			switch {
+			case byUID[owner.UID]:
+				continue
+			case found && uid != owner.UID:
+				reason = "owner was recreated, uid differs"
+			case found:
+				continue
+			case !collected[gk]:
+				reason = fmt.Sprintf("%s objects were not collected", gk.String())
+			default:
+				reason = "owner not found"
+			}
+			orphans = append(orphans, orphan{Object: o.obj, Kind: o.kind, Owner: owner, Reason: reason})
+		}
+	}
+
+	sort.SliceStable(orphans, func(i, j int) bool {
+		a, b := orphans[i], orphans[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Object.GetNamespace() != b.Object.GetNamespace() {
+			return a.Object.GetNamespace() < b.Object.GetNamespace()
+		}
+		return a.Object.GetName() < b.Object.GetName()
+	})
+	return orphans
+}
+
+func ownerKey(group string, kind string, namespace string, name string) string {
+	return strings.Join([]string{group, kind, namespace, name}, "/")
+}
+
+func printOrphans(out io.Writer, orphans []orphan) {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+
+	reasons := map[string]int{}
+	fmt.Fprintln(w, "KIND\tNAMESPACE\tNAME\tOWNER\tREASON")
+	for _, o := range orphans {
+		reasons[o.Reason]++
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s/%s\t%s\n", o.Kind, valueOrNone(o.Object.GetNamespace()), o.Object.GetName(), o.Owner.Kind, o.Owner.Name, o.Reason)
+	}
+	w.Flush()
+
+	summary := []string{}
+	for reason, count := range reasons {
+		summary = append(summary, fmt.Sprintf("%d %s", count, reason))
+	}
+	sort.Strings(summary)
+	fmt.Fprintf(out, "\n%d owner references unresolved: %s\n", len(orphans), strings.Join(summary, ", "))
+}
@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+)
+
+var _ = Describe("Orphans", func() {
+	var dir string
+
+	// owned returns an object with an owner reference
+	owned := func(name string, uid string, ownerAPIVersion string, ownerKind string, ownerName string, ownerUID string) string {
+		return `{"metadata": {"name": "` + name + `", "namespace": "default", "uid": "` + uid + `", "ownerReferences": [` +
+			`{"apiVersion": "` + ownerAPIVersion + `", "kind": "` + ownerKind + `", "name": "` + ownerName + `", "uid": "` + ownerUID + `"}]}}`
+	}
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		writeClusterResource(dir, "nodes.json", fixtureList("v1", "Node",
+			`{"metadata": {"name": "node-1", "uid": "node-1"}}`))
+		writeClusterResource(dir, "deployments/default.json", fixtureList("apps/v1", "Deployment",
+			`{"metadata": {"name": "web", "namespace": "default", "uid": "web"}}`))
+		writeClusterResource(dir, "replicasets/default.json", fixtureList("apps/v1", "ReplicaSet",
+			owned("web-1", "web-1", "apps/v1", "Deployment", "web", "web"),
+			owned("api-1", "api-1", "apps/v1", "Deployment", "api", "api")))
+		writeClusterResource(dir, "pods/default.json", fixtureList("v1", "Pod",
+			owned("web-1-a", "web-1-a", "apps/v1", "ReplicaSet", "web-1", "web-1"),
+			owned("web-1-b", "web-1-b", "apps/v1", "ReplicaSet", "web-1", "web-1-old"),
+			owned("mirror", "mirror", "v1", "Node", "node-1", "node-1"),
+			owned("widget-1", "widget-1", "example.com/v1", "Widget", "widget", "widget")))
+	})
+
+	orphanNames := func(orphans []orphan) []string {
+		result := []string{}
+		for _, o := range orphans {
+			result = append(result, o.Kind+" "+o.Object.GetName()+": "+o.Reason)
+		}
+		return result
+	}
+	expected := []string{
+		"Pod web-1-b: owner was recreated, uid differs",
+		"Pod widget-1: Widget.example.com objects were not collected",
+		"ReplicaSet api-1: owner not found",
+	}
+
+	It("Reads the default owner resources of bundles without resources.json", func() {
+		clusterData, err := sbctl.FindClusterData(dir)
+		Expect(err).NotTo(HaveOccurred())
+
+		resources, err := listOwnerResources(clusterData)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resources).To(HaveLen(len(defaultOwnerResources[0].APIResources) + len(defaultOwnerResources[1].APIResources) + len(defaultOwnerResources[2].APIResources)))
+		Expect(orphanNames(findOrphans(resources))).To(Equal(expected))
+	})
+
+	It("Checks the owners of every resource in resources.json", func() {
+		writeClusterResource(dir, "resources.json", `[
+			{"kind": "APIResourceList", "groupVersion": "v1", "resources": [
+				{"name": "nodes", "namespaced": false, "kind": "Node", "verbs": ["get", "list"]},
+				{"name": "pods", "namespaced": true, "kind": "Pod", "verbs": ["get", "list"]},
+				{"name": "pods/log", "namespaced": true, "kind": "Pod", "verbs": ["get"]}
+			]},
+			{"kind": "APIResourceList", "groupVersion": "apps/v1", "resources": [
+				{"name": "deployments", "namespaced": true, "kind": "Deployment", "verbs": ["get", "list"]},
+				{"name": "replicasets", "namespaced": true, "kind": "ReplicaSet", "verbs": ["get", "list"]}
+			]}
+		]`)
+		clusterData, err := sbctl.FindClusterData(dir)
+		Expect(err).NotTo(HaveOccurred())
+
+		resources, err := listOwnerResources(clusterData)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resources).To(HaveLen(4))
+		orphans := findOrphans(resources)
+		Expect(orphanNames(orphans)).To(Equal(expected))
+
+		out := bytes.Buffer{}
+		printOrphans(&out, orphans)
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		Expect(strings.Fields(lines[0])).To(Equal([]string{"KIND", "NAMESPACE", "NAME", "OWNER", "REASON"}))
+		Expect(strings.Fields(lines[3])).To(Equal([]string{"ReplicaSet", "default", "api-1", "Deployment/api", "owner", "not", "found"}))
+		Expect(lines[len(lines)-1]).To(Equal("3 owner references unresolved: 1 Widget.example.com objects were not collected, 1 owner not found, 1 owner was recreated, uid differs"))
+	})
+})
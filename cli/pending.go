@@ -0,0 +1,313 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/output"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	pendingSourceScheduler = "scheduler"
+	pendingSourceKubelet   = "kubelet"
+	pendingSourceSbctl     = "sbctl"
+
+	unboundPVCReason = "pod has unbound immediate PersistentVolumeClaims"
+)
+
+// schedulerReasonCountPattern matches the node count the scheduler prefixes its reasons with
+var schedulerReasonCountPattern = regexp.MustCompile(`^\d+ `)
+
+type pendingPod struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Owner     string `json:"owner,omitempty"`
+	// Source is where the reasons came from: the scheduler's condition or events, the waiting
+	// containers of a scheduled pod, or sbctl evaluating the nodes when the scheduler left none
+	Source string `json:"source"`
+}
+
+type pendingReason struct {
+	Reason string       `json:"reason"`
+	Pods   []pendingPod `json:"pods"`
+}
+
+func PendingCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "pending",
+		Short: "Summarize Pending pods by the reason they are not running",
+		Long: `Summarize Pending pods by the reason they are not running.
+
+Unscheduled pods are grouped by the reasons in the scheduler's PodScheduled condition or latest
+FailedScheduling event, such as insufficient cpu, untolerated taints and unbound
+PersistentVolumeClaims. When the bundle has neither, the reasons are found the way
+schedule-explain finds them. Scheduled pods are grouped by the reasons their containers are
+waiting. A pod with several reasons is listed under each. Use schedule-explain for the details of
+a single pod.`,
+		Example:       `  sbctl pending -s ./support-bundle.tar.gz`,
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			format := v.GetString("format")
+			if format != "text" && format != "json" {
+				return usererrors.New(usererrors.InvalidArgument, errors.Errorf("unsupported format %q, must be one of: text, json", format), "--format")
+			}
+
+			clusterData, cleanup, err := loadClusterData(v)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			nodes, err := sbctl.ListTypedResources[corev1.Node](clusterData, "", "nodes")
+			if err != nil {
+				return errors.Wrap(err, "failed to list nodes")
+			}
+			pods, err := sbctl.ListTypedResources[corev1.Pod](clusterData, "", "pods")
+			if err != nil {
+				return errors.Wrap(err, "failed to list pods")
+			}
+			pvcs, err := sbctl.ListTypedResources[corev1.PersistentVolumeClaim](clusterData, "", "persistentvolumeclaims")
+			if err != nil {
+				return errors.Wrap(err, "failed to list persistentvolumeclaims")
+			}
+			events, err := sbctl.ListTypedResources[corev1.Event](clusterData, "", "events")
+			if err != nil {
+				return errors.Wrap(err, "failed to list events")
+			}
+
+			reasons := groupPendingPods(v.GetString("namespace"), nodes, pods, pvcs, events)
+
+			if format == "json" {
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				if err := encoder.Encode(reasons); err != nil {
+					return errors.Wrap(err, "failed to write results")
+				}
+				return nil
+			}
+
+			p, err := newPrinter(os.Stdout)
+			if err != nil {
+				return err
+			}
+			return printPendingReasons(p, reasons)
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	cmd.Flags().StringP("namespace", "n", "", "only summarize pods in this namespace")
+	cmd.Flags().String("format", "text", "output format. One of: text, json")
+	return cmd
+}
+
+// groupPendingPods groups the Pending pods by reason, the reasons with the most pods first
+func groupPendingPods(namespace string, nodes []corev1.Node, pods []corev1.Pod, pvcs []corev1.PersistentVolumeClaim, events []corev1.Event) []pendingReason {
+	resources := newNodeResources(nodes, pods)
+	byReason := map[string]*pendingReason{}
+	for _, pod := range pods {
+		if pod.Status.Phase != corev1.PodPending || (namespace != "" && pod.Namespace != namespace) {
+			continue
+		}
+
+		source, reasons := podPendingReasons(pod, nodes, resources, pvcs, events)
+		p := pendingPod{Namespace: pod.Namespace, Name: pod.Name, Source: source}
+		if owner := pod.OwnerReferences; len(owner) > 0 {
+			p.Owner = owner[0].Kind + "/" + owner[0].Name
+		}
+		for _, reason := range reasons {
+			r, ok := byReason[reason]
+			if !ok {
+				r = &pendingReason{Reason: reason, Pods: []pendingPod{}}
+				byReason[reason] = r
+			}
+			r.Pods = append(r.Pods, p)
+		}
+	}
+
+	result := []pendingReason{}
+	for _, r := range byReason {
+		sort.Slice(r.Pods, func(i, j int) bool {
+			if r.Pods[i].Namespace != r.Pods[j].Namespace {
+				return r.Pods[i].Namespace < r.Pods[j].Namespace
+			}
+			return r.Pods[i].Name < r.Pods[j].Name
+		})
+		result = append(result, *r)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if len(result[i].Pods) != len(result[j].Pods) {
+			return len(result[i].Pods) > len(result[j].Pods)
+		}
+		return result[i].Reason < result[j].Reason
+	})
+	return result
+}
+
+func podPendingReasons(pod corev1.Pod, nodes []corev1.Node, resources map[string]*nodeResources, pvcs []corev1.PersistentVolumeClaim, events []corev1.Event) (string, []string) {
+	if pod.Spec.NodeName != "" {
+		return pendingSourceKubelet, waitingReasons(pod)
+	}
+
+	if message := schedulerMessage(pod, events); message != "" {
+		return pendingSourceScheduler, parseSchedulerReasons(message)
+	}
+
+	// Without a word from the scheduler, evaluate the filters schedule-explain evaluates
+	reasons := []string{}
+	if unboundClaims(pod, pvcs) {
+		reasons = append(reasons, unboundPVCReason)
+	}
+	if len(nodes) == 0 {
+		return pendingSourceSbctl, append(reasons, "no nodes in support bundle")
+	}
+	requests := podRequests(pod)
+	summaries := map[string]bool{}
+	available := false
+	for _, n := range nodes {
+		f := explainNodeFit(pod, requests, resources[n.Name])
+		if len(f.Summaries) == 0 {
+			available = true
+		}
+		for _, s := range f.Summaries {
+			summaries[s] = true
+		}
+	}
+	if available && len(reasons) == 0 {
+		return pendingSourceSbctl, []string{"not scheduled yet, fits on a node"}
+	}
+	if !available {
+		for s := range summaries {
+			reasons = append(reasons, s)
+		}
+	}
+	sort.Strings(reasons)
+	return pendingSourceSbctl, reasons
+}
+
+// schedulerMessage returns the message of the pod's unschedulable condition, or else of its
+// latest FailedScheduling event
+func schedulerMessage(pod corev1.Pod, events []corev1.Event) string {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodScheduled && c.Status != corev1.ConditionTrue && c.Message != "" {
+			return c.Message
+		}
+	}
+
+	message := ""
+	var latest *corev1.Event
+	for i, e := range events {
+		if e.Reason != "FailedScheduling" || e.InvolvedObject.Kind != "Pod" ||
+			e.InvolvedObject.Namespace != pod.Namespace || e.InvolvedObject.Name != pod.Name {
+			continue
+		}
+		if latest == nil || e.LastTimestamp.After(latest.LastTimestamp.Time) {
+			latest = &events[i]
+			message = e.Message
+		}
+	}
+	return message
+}
+
+// parseSchedulerReasons splits a scheduler message such as "0/3 nodes are available: 1
+// Insufficient cpu, 2 node(s) had untolerated taint {dedicated: db}. preemption: ..." into its
+// reasons without the node counts, so pods group by reason whatever the number of nodes
+func parseSchedulerReasons(message string) []string {
+	message = strings.SplitN(message, " preemption:", 2)[0]
+	message = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(message), "."))
+	_, list, ok := strings.Cut(message, "nodes are available: ")
+	if !ok {
+		return []string{message}
+	}
+
+	reasons := []string{}
+	for _, reason := range strings.Split(list, ", ") {
+		reason = schedulerReasonCountPattern.ReplaceAllString(strings.TrimSpace(reason), "")
+		if reason != "" {
+			reasons = append(reasons, strings.TrimSuffix(reason, "."))
+		}
+	}
+	return reasons
+}
+
+// waitingReasons returns why the containers of a scheduled pod are not running, e.g.
+// ImagePullBackOff or ContainerCreating
+func waitingReasons(pod corev1.Pod) []string {
+	reasons := []string{}
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if status.State.Waiting == nil || status.State.Waiting.Reason == "" {
+			continue
+		}
+		if !containsString(reasons, status.State.Waiting.Reason) {
+			reasons = append(reasons, status.State.Waiting.Reason)
+		}
+	}
+	if len(reasons) == 0 {
+		reasons = append(reasons, "scheduled, containers not started")
+	}
+	return reasons
+}
+
+func unboundClaims(pod corev1.Pod, pvcs []corev1.PersistentVolumeClaim) bool {
+	for _, volume := range pod.Spec.Volumes {
+		if volume.PersistentVolumeClaim == nil {
+			continue
+		}
+		bound := false
+		for _, pvc := range pvcs {
+			if pvc.Namespace == pod.Namespace && pvc.Name == volume.PersistentVolumeClaim.ClaimName {
+				bound = pvc.Status.Phase == corev1.ClaimBound
+				break
+			}
+		}
+		if !bound {
+			return true
+		}
+	}
+	return false
+}
+
+func printPendingReasons(p *output.Printer, reasons []pendingReason) error {
+	out := p.Writer()
+	if len(reasons) == 0 {
+		fmt.Fprintln(out, p.Green("No Pending pods"))
+		return nil
+	}
+
+	pods := map[string]bool{}
+	for i, r := range reasons {
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		fmt.Fprintf(out, "%s %s\n", p.Yellow(r.Reason), p.Faint(fmt.Sprintf("(%d pods)", len(r.Pods))))
+
+		t := p.NewTable("NAMESPACE", "POD", "OWNER", "SOURCE")
+		for _, pod := range r.Pods {
+			pods[pod.Namespace+"/"+pod.Name] = true
+			t.AddRow(pod.Namespace, pod.Name, valueOrNone(pod.Owner), pod.Source)
+		}
+		if err := t.Print(); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(out, "\n%d pods Pending\n", len(pods))
+	return err
+}
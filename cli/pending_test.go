@@ -0,0 +1,138 @@
+package cli
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Pending", func() {
+	pendingPodFixture := func(namespace string, name string) corev1.Pod {
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+			Status:     corev1.PodStatus{Phase: corev1.PodPending},
+		}
+	}
+	failedScheduling := func(name string, message string, lastSeen time.Time) corev1.Event {
+		return corev1.Event{
+			Reason:         "FailedScheduling",
+			Message:        message,
+			InvolvedObject: corev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: name},
+			LastTimestamp:  metav1.NewTime(lastSeen),
+		}
+	}
+
+	DescribeTable("Splits scheduler messages into reasons without node counts",
+		func(message string, expected []string) {
+			Expect(parseSchedulerReasons(message)).To(Equal(expected))
+		},
+		Entry("several reasons",
+			"0/3 nodes are available: 1 Insufficient cpu, 2 node(s) had untolerated taint {dedicated: db}. preemption: 0/3 nodes are available: 3 Preemption is not helpful for scheduling.",
+			[]string{"Insufficient cpu", "node(s) had untolerated taint {dedicated: db}"}),
+		Entry("unbound claims", "0/2 nodes are available: 2 pod has unbound immediate PersistentVolumeClaims.", []string{unboundPVCReason}),
+		Entry("other messages", `running PreFilter plugin "VolumeBinding": not found.`, []string{`running PreFilter plugin "VolumeBinding": not found`}),
+	)
+
+	It("Prefers the unschedulable condition over the latest FailedScheduling event", func() {
+		now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		events := []corev1.Event{
+			failedScheduling("web-0", "0/1 nodes are available: 1 Insufficient memory.", now.Add(-time.Hour)),
+			failedScheduling("web-0", "0/1 nodes are available: 1 Insufficient cpu.", now),
+			failedScheduling("web-1", "0/1 nodes are available: 1 Too many pods.", now.Add(time.Hour)),
+		}
+		pod := pendingPodFixture("default", "web-0")
+		Expect(schedulerMessage(pod, events)).To(Equal("0/1 nodes are available: 1 Insufficient cpu."))
+
+		pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodScheduled, Status: corev1.ConditionFalse, Message: "0/1 nodes are available: 1 node(s) were unschedulable."}}
+		Expect(schedulerMessage(pod, events)).To(Equal("0/1 nodes are available: 1 node(s) were unschedulable."))
+
+		Expect(schedulerMessage(pendingPodFixture("app", "web-0"), events)).To(BeEmpty())
+	})
+
+	It("Lists why the containers of scheduled pods are waiting", func() {
+		pod := pendingPodFixture("default", "web-0")
+		Expect(waitingReasons(pod)).To(Equal([]string{"scheduled, containers not started"}))
+
+		waiting := func(reason string) corev1.ContainerState {
+			return corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reason}}
+		}
+		pod.Status.InitContainerStatuses = []corev1.ContainerStatus{{Name: "init", State: waiting("PodInitializing")}}
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+			{Name: "app", State: waiting("ImagePullBackOff")},
+			{Name: "sidecar", State: waiting("ImagePullBackOff")},
+		}
+		Expect(waitingReasons(pod)).To(Equal([]string{"PodInitializing", "ImagePullBackOff"}))
+	})
+
+	It("Groups Pending pods by reason, the most common reasons first", func() {
+		nodes := []corev1.Node{{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+			Status:     corev1.NodeStatus{Allocatable: resourceList("cpu", "1", "pods", "110")},
+		}}
+
+		unscheduled := pendingPodFixture("default", "web-0")
+		unscheduled.OwnerReferences = []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "web-abc"}}
+		unscheduled.Status.Conditions = []corev1.PodCondition{{
+			Type:    corev1.PodScheduled,
+			Status:  corev1.ConditionFalse,
+			Message: "0/1 nodes are available: 1 Insufficient cpu. preemption: 0/1 nodes are available: 1 No preemption victims found for incoming pod.",
+		}}
+
+		tooLarge := pendingPodFixture("app", "api-0")
+		tooLarge.Spec.Containers[0].Resources.Requests = resourceList("cpu", "2")
+
+		waiting := pendingPodFixture("default", "web-1")
+		waiting.Spec.NodeName = "node-1"
+		waiting.Status.ContainerStatuses = []corev1.ContainerStatus{{Name: "app", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff"}}}}
+
+		unbound := pendingPodFixture("default", "db-0")
+		unbound.Spec.Volumes = []corev1.Volume{{Name: "data", VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "data"}}}}
+
+		running := pendingPodFixture("default", "web-2")
+		running.Status.Phase = corev1.PodRunning
+
+		pods := []corev1.Pod{unscheduled, tooLarge, waiting, unbound, running}
+		pvcs := []corev1.PersistentVolumeClaim{{
+			ObjectMeta: metav1.ObjectMeta{Name: "data", Namespace: "default"},
+			Status:     corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimPending},
+		}}
+
+		Expect(groupPendingPods("", nodes, pods, pvcs, nil)).To(Equal([]pendingReason{
+			{Reason: "Insufficient cpu", Pods: []pendingPod{
+				{Namespace: "app", Name: "api-0", Source: pendingSourceSbctl},
+				{Namespace: "default", Name: "web-0", Owner: "ReplicaSet/web-abc", Source: pendingSourceScheduler},
+			}},
+			{Reason: "ImagePullBackOff", Pods: []pendingPod{{Namespace: "default", Name: "web-1", Source: pendingSourceKubelet}}},
+			{Reason: unboundPVCReason, Pods: []pendingPod{{Namespace: "default", Name: "db-0", Source: pendingSourceSbctl}}},
+		}))
+
+		Expect(groupPendingPods("app", nodes, pods, pvcs, nil)).To(Equal([]pendingReason{
+			{Reason: "Insufficient cpu", Pods: []pendingPod{{Namespace: "app", Name: "api-0", Source: pendingSourceSbctl}}},
+		}))
+	})
+
+	It("Evaluates nodes when the scheduler left no reasons", func() {
+		pod := pendingPodFixture("default", "web-0")
+		nodes := []corev1.Node{{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+			Status:     corev1.NodeStatus{Allocatable: resourceList("cpu", "1")},
+		}}
+
+		source, reasons := podPendingReasons(pod, nil, nil, nil, nil)
+		Expect(source).To(Equal(pendingSourceSbctl))
+		Expect(reasons).To(Equal([]string{"no nodes in support bundle"}))
+
+		source, reasons = podPendingReasons(pod, nodes, newNodeResources(nodes, nil), nil, nil)
+		Expect(source).To(Equal(pendingSourceSbctl))
+		Expect(reasons).To(Equal([]string{"not scheduled yet, fits on a node"}))
+
+		nodes[0].Spec.Unschedulable = true
+		source, reasons = podPendingReasons(pod, nodes, newNodeResources(nodes, nil), nil, nil)
+		Expect(source).To(Equal(pendingSourceSbctl))
+		Expect(reasons).To(Equal([]string{"node(s) were unschedulable"}))
+	})
+})
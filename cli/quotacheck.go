@@ -0,0 +1,452 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// quotaWorkload is the pod template of a workload and the number of replicas it runs
+type quotaWorkload struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Replicas  int32
+	Template  corev1.PodTemplateSpec
+}
+
+type quotaCheckResult struct {
+	Quota    string
+	Resource corev1.ResourceName
+	Used     resource.Quantity
+	Hard     resource.Quantity
+	Change   resource.Quantity
+	After    resource.Quantity
+	Exceeded bool
+}
+
+func QuotaCheckCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "quota-check <kind>/<name>",
+		Short: "Check whether scaling a workload would exceed resource quotas and limit ranges",
+		Long: `Check whether scaling a workload would exceed resource quotas and limit ranges.
+
+The pod template of a deployment, statefulset or replicaset is admitted the way the API server
+would: defaults of LimitRanges in the namespace are applied to its containers, which are then
+checked against the LimitRange minimums, maximums and ratios. The requests and limits of the
+additional replicas are added to what ResourceQuotas in the namespace used when the bundle was
+collected. Quota scopes are not evaluated, and surge pods of rolling updates are not counted.`,
+		Example:       `  sbctl quota-check deployment/velero -n velero --replicas 5`,
+		Args:          cobra.ExactArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			kind, name, err := parseWorkloadArg(args[0])
+			if err != nil {
+				return err
+			}
+			namespace := v.GetString("namespace")
+
+			clusterData, cleanup, err := loadClusterData(v)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			workload, err := findQuotaWorkload(clusterData, kind, namespace, name)
+			if err != nil {
+				return err
+			}
+
+			replicas := workload.Replicas
+			if cmd.Flags().Changed("replicas") {
+				replicas = int32(v.GetInt("replicas"))
+			}
+			if replicas < 0 {
+				return errors.New("--replicas must not be negative")
+			}
+
+			limitRanges, err := sbctl.ListTypedResources[corev1.LimitRange](clusterData, "", "limitranges")
+			if err != nil {
+				return errors.Wrap(err, "failed to list limit ranges")
+			}
+			quotas, err := sbctl.ListTypedResources[corev1.ResourceQuota](clusterData, "", "resourcequotas")
+			if err != nil {
+				return errors.Wrap(err, "failed to list resource quotas")
+			}
+			limitRanges = filterLimitRanges(limitRanges, namespace)
+			quotas = filterResourceQuotas(quotas, namespace)
+
+			out := os.Stdout
+			fmt.Fprintf(out, "%s %s/%s: %d -> %d replicas\n", workload.Kind, workload.Namespace, workload.Name, workload.Replicas, replicas)
+
+			pod := corev1.Pod{ObjectMeta: workload.Template.ObjectMeta, Spec: workload.Template.Spec}
+			applyLimitRangeDefaults(&pod, limitRanges)
+			violations := checkLimitRanges(pod, limitRanges)
+			fmt.Fprintf(out, "Per pod: requests cpu %s, memory %s; limits cpu %s, memory %s\n",
+				formatQuantity(podRequests(pod), corev1.ResourceCPU), formatQuantity(podRequests(pod), corev1.ResourceMemory),
+				formatQuantity(podLimits(pod), corev1.ResourceCPU), formatQuantity(podLimits(pod), corev1.ResourceMemory))
+
+			if len(limitRanges) == 0 {
+				fmt.Fprintln(out, "\nNo LimitRanges in namespace")
+			} else if len(violations) > 0 {
+				fmt.Fprintln(out, "\nLimitRange violations:")
+				for _, violation := range violations {
+					fmt.Fprintf(out, "  - %s\n", violation)
+				}
+			}
+
+			results, missing := checkResourceQuotas(pod, replicas-workload.Replicas, quotas)
+			if len(quotas) == 0 {
+				fmt.Fprintln(out, "No ResourceQuotas in namespace")
+			} else {
+				fmt.Fprintln(out)
+				printQuotaCheckResults(out, results)
+			}
+			if len(missing) > 0 {
+				fmt.Fprintln(out, "\nResourceQuota violations:")
+				for _, m := range missing {
+					fmt.Fprintf(out, "  - %s\n", m)
+				}
+			}
+
+			exceeded := len(violations) + len(missing)
+			for _, r := range results {
+				if r.Exceeded {
+					exceeded++
+				}
+			}
+
+			fmt.Fprintln(out)
+			if exceeded > 0 {
+				fmt.Fprintf(out, "Scaling to %d replicas would be rejected (%d problems)\n", replicas, exceeded)
+			} else {
+				fmt.Fprintf(out, "Scaling to %d replicas fits within quotas and limit ranges\n", replicas)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	cmd.Flags().StringP("namespace", "n", "default", "namespace of the workload")
+	cmd.Flags().Int("replicas", 0, "number of replicas to check. Defaults to the current number of replicas.")
+	return cmd
+}
+
+// parseWorkloadArg returns the normalized kind and the name of a kind/name argument
+func parseWorkloadArg(arg string) (string, string, error) {
+	parts := strings.SplitN(arg, "/", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", "", errors.Errorf("expected <kind>/<name>, got %q", arg)
+	}
+
+	mapper := sbctl.DefaultRESTMapper()
+	if gvr, err := mapper.ResourceFor(parts[0]); err == nil && gvr.Group == "apps" {
+		gvk, err := mapper.KindFor(gvr)
+		if err == nil && (gvk.Kind == "Deployment" || gvk.Kind == "StatefulSet" || gvk.Kind == "ReplicaSet") {
+			return gvk.Kind, parts[1], nil
+		}
+	}
+	return "", "", usererrors.New(usererrors.InvalidArgument, errors.Errorf("unsupported kind %q, expected deployment, statefulset or replicaset", parts[0]), "workload")
+}
+
+func findQuotaWorkload(clusterData sbctl.ClusterData, kind string, namespace string, name string) (*quotaWorkload, error) {
+	var workload *quotaWorkload
+	switch kind {
+	case "Deployment":
+		items, err := sbctl.ListTypedResources[appsv1.Deployment](clusterData, "apps", "deployments")
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list deployments")
+		}
+		for _, d := range items {
+			if d.Namespace == namespace && d.Name == name {
+				workload = &quotaWorkload{Replicas: replicasOrDefault(d.Spec.Replicas), Template: d.Spec.Template}
+			}
+		}
+	case "StatefulSet":
+		items, err := sbctl.ListTypedResources[appsv1.StatefulSet](clusterData, "apps", "statefulsets")
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list statefulsets")
+		}
+		for _, s := range items {
+			if s.Namespace == namespace && s.Name == name {
+				workload = &quotaWorkload{Replicas: replicasOrDefault(s.Spec.Replicas), Template: s.Spec.Template}
+			}
+		}
+	case "ReplicaSet":
+		items, err := sbctl.ListTypedResources[appsv1.ReplicaSet](clusterData, "apps", "replicasets")
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list replicasets")
+		}
+		for _, r := range items {
+			if r.Namespace == namespace && r.Name == name {
+				workload = &quotaWorkload{Replicas: replicasOrDefault(r.Spec.Replicas), Template: r.Spec.Template}
+			}
+		}
+	}
+
+	if workload == nil {
+		return nil, errors.Errorf("%s %s/%s not found in support bundle", strings.ToLower(kind), namespace, name)
+	}
+	workload.Kind = kind
+	workload.Namespace = namespace
+	workload.Name = name
+	return workload, nil
+}
+
+func replicasOrDefault(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+	return *replicas
+}
+
+func filterLimitRanges(limitRanges []corev1.LimitRange, namespace string) []corev1.LimitRange {
+	result := []corev1.LimitRange{}
+	for _, l := range limitRanges {
+		if l.Namespace == namespace {
+			result = append(result, l)
+		}
+	}
+	return result
+}
+
+func filterResourceQuotas(quotas []corev1.ResourceQuota, namespace string) []corev1.ResourceQuota {
+	result := []corev1.ResourceQuota{}
+	for _, q := range quotas {
+		if q.Namespace == namespace {
+			result = append(result, q)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// applyLimitRangeDefaults sets default requests and limits of containers the way the LimitRanger
+// admission plugin does. Requests that are still missing default to the limits.
+func applyLimitRangeDefaults(pod *corev1.Pod, limitRanges []corev1.LimitRange) {
+	apply := func(c *corev1.Container) {
+		if c.Resources.Requests == nil {
+			c.Resources.Requests = corev1.ResourceList{}
+		}
+		if c.Resources.Limits == nil {
+			c.Resources.Limits = corev1.ResourceList{}
+		}
+		for _, l := range limitRanges {
+			for _, item := range l.Spec.Limits {
+				if item.Type != corev1.LimitTypeContainer {
+					continue
+				}
+				for name, q := range item.Default {
+					if _, ok := c.Resources.Limits[name]; !ok {
+						c.Resources.Limits[name] = q.DeepCopy()
+					}
+				}
+				for name, q := range item.DefaultRequest {
+					if _, ok := c.Resources.Requests[name]; !ok {
+						c.Resources.Requests[name] = q.DeepCopy()
+					}
+				}
+			}
+		}
+		for name, q := range c.Resources.Limits {
+			if _, ok := c.Resources.Requests[name]; !ok {
+				c.Resources.Requests[name] = q.DeepCopy()
+			}
+		}
+	}
+
+	for i := range pod.Spec.InitContainers {
+		apply(&pod.Spec.InitContainers[i])
+	}
+	for i := range pod.Spec.Containers {
+		apply(&pod.Spec.Containers[i])
+	}
+}
+
+// checkLimitRanges returns the container and pod constraints of limit ranges the pod violates
+func checkLimitRanges(pod corev1.Pod, limitRanges []corev1.LimitRange) []string {
+	violations := []string{}
+	for _, l := range limitRanges {
+		for _, item := range l.Spec.Limits {
+			switch item.Type {
+			case corev1.LimitTypeContainer:
+				for _, c := range append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...) {
+					for _, v := range checkLimitRangeItem(item, c.Resources.Requests, c.Resources.Limits) {
+						violations = append(violations, fmt.Sprintf("%s: container %s: %s", l.Name, c.Name, v))
+					}
+				}
+			case corev1.LimitTypePod:
+				for _, v := range checkLimitRangeItem(item, podRequests(pod), podLimits(pod)) {
+					violations = append(violations, fmt.Sprintf("%s: pod: %s", l.Name, v))
+				}
+			}
+		}
+	}
+	return violations
+}
+
+func checkLimitRangeItem(item corev1.LimitRangeItem, requests corev1.ResourceList, limits corev1.ResourceList) []string {
+	violations := []string{}
+	for _, name := range sortedResourceNames(item.Min) {
+		min := item.Min[name]
+		if q, ok := requests[name]; !ok || q.Cmp(min) < 0 {
+			violations = append(violations, fmt.Sprintf("minimum %s request is %s, got %s", name, min.String(), formatQuantity(requests, name)))
+		}
+	}
+	for _, name := range sortedResourceNames(item.Max) {
+		max := item.Max[name]
+		if q, ok := limits[name]; !ok || q.Cmp(max) > 0 {
+			violations = append(violations, fmt.Sprintf("maximum %s limit is %s, got %s", name, max.String(), formatQuantity(limits, name)))
+		}
+	}
+	for _, name := range sortedResourceNames(item.MaxLimitRequestRatio) {
+		ratio := item.MaxLimitRequestRatio[name]
+		request, hasRequest := requests[name]
+		limit, hasLimit := limits[name]
+		if !hasRequest || !hasLimit || request.IsZero() {
+			continue
+		}
+		if float64(limit.MilliValue())/float64(request.MilliValue()) > float64(ratio.MilliValue())/1000 {
+			violations = append(violations, fmt.Sprintf("%s limit to request ratio must be at most %s, got %s/%s", name, ratio.String(), limit.String(), request.String()))
+		}
+	}
+	return violations
+}
+
+// checkResourceQuotas adds the requests and limits of the additional pods to the usage of every quota.
+// It also returns the resources a quota tracks that the pod does not specify, which the quota admission
+// plugin rejects.
+func checkResourceQuotas(pod corev1.Pod, additional int32, quotas []corev1.ResourceQuota) ([]quotaCheckResult, []string) {
+	usage := podQuotaUsage(pod)
+
+	results := []quotaCheckResult{}
+	missing := []string{}
+	for _, quota := range quotas {
+		for _, name := range sortedResourceNames(quota.Spec.Hard) {
+			perPod, ok := usage[name]
+			if !ok {
+				switch name {
+				case corev1.ResourceRequestsCPU, corev1.ResourceRequestsMemory, corev1.ResourceLimitsCPU, corev1.ResourceLimitsMemory:
+					if additional > 0 {
+						missing = append(missing, fmt.Sprintf("%s: pods must specify %s", quota.Name, name))
+					}
+				}
+				continue
+			}
+
+			r := quotaCheckResult{
+				Quota:    quota.Name,
+				Resource: name,
+				Used:     quota.Status.Used[name].DeepCopy(),
+				Hard:     quota.Spec.Hard[name].DeepCopy(),
+				Change:   *resource.NewMilliQuantity(perPod.MilliValue()*int64(additional), perPod.Format),
+			}
+			r.After = r.Used.DeepCopy()
+			r.After.Add(r.Change)
+			r.Exceeded = additional > 0 && r.After.Cmp(r.Hard) > 0
+			results = append(results, r)
+		}
+	}
+
+	return results, missing
+}
+
+// podQuotaUsage returns what a single pod counts against quotas
+func podQuotaUsage(pod corev1.Pod) corev1.ResourceList {
+	usage := corev1.ResourceList{
+		corev1.ResourcePods:               *resource.NewQuantity(1, resource.DecimalSI),
+		corev1.ResourceName("count/pods"): *resource.NewQuantity(1, resource.DecimalSI),
+	}
+
+	requests := podRequests(pod)
+	limits := podLimits(pod)
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory, corev1.ResourceEphemeralStorage} {
+		if q, ok := requests[name]; ok {
+			usage[name] = q.DeepCopy()
+			usage[corev1.ResourceName("requests."+string(name))] = q.DeepCopy()
+		}
+		if q, ok := limits[name]; ok {
+			usage[corev1.ResourceName("limits."+string(name))] = q.DeepCopy()
+		}
+	}
+	return usage
+}
+
+// podLimits returns the limits of a pod, computed like podRequests
+func podLimits(pod corev1.Pod) corev1.ResourceList {
+	limits := corev1.ResourceList{}
+	for _, c := range pod.Spec.Containers {
+		for name, q := range c.Resources.Limits {
+			total := limits[name]
+			total.Add(q)
+			limits[name] = total
+		}
+	}
+
+	for _, c := range pod.Spec.InitContainers {
+		for name, q := range c.Resources.Limits {
+			if current, ok := limits[name]; !ok || q.Cmp(current) > 0 {
+				limits[name] = q.DeepCopy()
+			}
+		}
+	}
+
+	for name, q := range pod.Spec.Overhead {
+		if total, ok := limits[name]; ok {
+			total.Add(q)
+			limits[name] = total
+		}
+	}
+
+	return limits
+}
+
+func sortedResourceNames(list corev1.ResourceList) []corev1.ResourceName {
+	names := []corev1.ResourceName{}
+	for name := range list {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return names[i] < names[j]
+	})
+	return names
+}
+
+func printQuotaCheckResults(out io.Writer, results []quotaCheckResult) {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "QUOTA\tRESOURCE\tUSED\tHARD\tCHANGE\tAFTER\tRESULT")
+	for _, r := range results {
+		result := "ok"
+		if r.Exceeded {
+			result = "exceeded"
+		}
+		change := r.Change.String()
+		if r.Change.Sign() > 0 {
+			change = "+" + change
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Quota, r.Resource, r.Used.String(), r.Hard.String(), change, r.After.String(), result)
+	}
+}
@@ -0,0 +1,186 @@
+package cli
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/types"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// equalQuantity matches quantities that are equal to s, however they are formatted
+func equalQuantity(s string) types.GomegaMatcher {
+	expected := resource.MustParse(s)
+	return WithTransform(func(q resource.Quantity) int {
+		return q.Cmp(expected)
+	}, BeZero())
+}
+
+func resourceList(pairs ...string) corev1.ResourceList {
+	list := corev1.ResourceList{}
+	for i := 0; i < len(pairs); i += 2 {
+		list[corev1.ResourceName(pairs[i])] = resource.MustParse(pairs[i+1])
+	}
+	return list
+}
+
+func quotaPod(containers ...corev1.Container) corev1.Pod {
+	return corev1.Pod{Spec: corev1.PodSpec{Containers: containers}}
+}
+
+func resourceQuota(name string, hard corev1.ResourceList, used corev1.ResourceList) corev1.ResourceQuota {
+	return corev1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec:       corev1.ResourceQuotaSpec{Hard: hard},
+		Status:     corev1.ResourceQuotaStatus{Hard: hard, Used: used},
+	}
+}
+
+var _ = Describe("Quota check", func() {
+	It("Adds up requests and limits of containers like the scheduler", func() {
+		pod := corev1.Pod{Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{Name: "a", Resources: corev1.ResourceRequirements{Requests: resourceList("cpu", "100m", "memory", "64Mi"), Limits: resourceList("cpu", "200m")}},
+				{Name: "b", Resources: corev1.ResourceRequirements{Requests: resourceList("cpu", "250m")}},
+			},
+			InitContainers: []corev1.Container{
+				{Name: "init", Resources: corev1.ResourceRequirements{Requests: resourceList("cpu", "500m", "memory", "32Mi")}},
+			},
+			Overhead: resourceList("cpu", "10m"),
+		}}
+
+		requests := podRequests(pod)
+		Expect(requests[corev1.ResourceCPU]).To(equalQuantity("510m"))
+		Expect(requests[corev1.ResourceMemory]).To(equalQuantity("64Mi"))
+
+		limits := podLimits(pod)
+		Expect(limits[corev1.ResourceCPU]).To(equalQuantity("210m"))
+		Expect(limits).NotTo(HaveKey(corev1.ResourceMemory))
+	})
+
+	It("Counts only pods against quotas for pods without requests or limits", func() {
+		usage := podQuotaUsage(quotaPod(corev1.Container{Name: "a"}))
+		Expect(usage).To(HaveLen(2))
+		Expect(usage[corev1.ResourcePods]).To(equalQuantity("1"))
+		Expect(usage[corev1.ResourceName("count/pods")]).To(equalQuantity("1"))
+	})
+
+	DescribeTable("Checks additional pods against quotas",
+		func(pod corev1.Pod, additional int32, quota corev1.ResourceQuota, resourceName string, change string, after string, exceeded bool) {
+			results, missing := checkResourceQuotas(pod, additional, []corev1.ResourceQuota{quota})
+			Expect(missing).To(BeEmpty())
+
+			var result *quotaCheckResult
+			for i := range results {
+				if results[i].Resource == corev1.ResourceName(resourceName) {
+					result = &results[i]
+				}
+			}
+			Expect(result).NotTo(BeNil())
+			Expect(result.Quota).To(Equal(quota.Name))
+			Expect(result.Change).To(equalQuantity(change))
+			Expect(result.After).To(equalQuantity(after))
+			Expect(result.Exceeded).To(Equal(exceeded))
+		},
+		Entry("within the quota",
+			quotaPod(corev1.Container{Name: "a", Resources: corev1.ResourceRequirements{Requests: resourceList("cpu", "250m")}}),
+			int32(2), resourceQuota("compute", resourceList("requests.cpu", "2"), resourceList("requests.cpu", "1")),
+			"requests.cpu", "500m", "1500m", false),
+		Entry("exceeding the quota",
+			quotaPod(corev1.Container{Name: "a", Resources: corev1.ResourceRequirements{Requests: resourceList("cpu", "500m")}}),
+			int32(1), resourceQuota("compute", resourceList("requests.cpu", "1"), resourceList("requests.cpu", "800m")),
+			"requests.cpu", "500m", "1300m", true),
+		Entry("scaling down over the quota",
+			quotaPod(corev1.Container{Name: "a", Resources: corev1.ResourceRequirements{Requests: resourceList("cpu", "500m")}}),
+			int32(-1), resourceQuota("compute", resourceList("requests.cpu", "1"), resourceList("requests.cpu", "2")),
+			"requests.cpu", "-500m", "1500m", false),
+		Entry("counting pods",
+			quotaPod(corev1.Container{Name: "a"}),
+			int32(3), resourceQuota("pods", resourceList("pods", "10"), resourceList("pods", "8")),
+			"pods", "3", "11", true),
+		Entry("without usage recorded",
+			quotaPod(corev1.Container{Name: "a", Resources: corev1.ResourceRequirements{Limits: resourceList("memory", "1Gi")}}),
+			int32(2), resourceQuota("memory", resourceList("limits.memory", "4Gi"), nil),
+			"limits.memory", "2Gi", "2Gi", false),
+	)
+
+	It("Reports resources quotas track that pods without requests or limits do not specify", func() {
+		pod := quotaPod(corev1.Container{Name: "a"})
+		quota := resourceQuota("compute", resourceList("pods", "10", "requests.cpu", "2", "limits.memory", "4Gi"), resourceList("pods", "3"))
+
+		results, missing := checkResourceQuotas(pod, 2, []corev1.ResourceQuota{quota})
+		Expect(missing).To(Equal([]string{
+			"compute: pods must specify limits.memory",
+			"compute: pods must specify requests.cpu",
+		}))
+		Expect(results).To(HaveLen(1))
+		Expect(results[0].Resource).To(Equal(corev1.ResourcePods))
+		Expect(results[0].After).To(equalQuantity("5"))
+
+		_, missing = checkResourceQuotas(pod, 0, []corev1.ResourceQuota{quota})
+		Expect(missing).To(BeEmpty())
+	})
+
+	It("Applies limit range defaults to containers", func() {
+		limitRanges := []corev1.LimitRange{{
+			ObjectMeta: metav1.ObjectMeta{Name: "defaults", Namespace: "default"},
+			Spec: corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{{
+				Type:           corev1.LimitTypeContainer,
+				Default:        resourceList("cpu", "500m"),
+				DefaultRequest: resourceList("cpu", "100m"),
+			}}},
+		}}
+		pod := quotaPod(
+			corev1.Container{Name: "a"},
+			corev1.Container{Name: "b", Resources: corev1.ResourceRequirements{Limits: resourceList("cpu", "1", "memory", "1Gi")}},
+		)
+
+		applyLimitRangeDefaults(&pod, limitRanges)
+		a, b := pod.Spec.Containers[0].Resources, pod.Spec.Containers[1].Resources
+		Expect(a.Requests[corev1.ResourceCPU]).To(equalQuantity("100m"))
+		Expect(a.Limits[corev1.ResourceCPU]).To(equalQuantity("500m"))
+		Expect(b.Requests[corev1.ResourceCPU]).To(equalQuantity("100m"))
+		Expect(b.Limits[corev1.ResourceCPU]).To(equalQuantity("1"))
+		// Requests that are still missing default to the limits
+		Expect(b.Requests[corev1.ResourceMemory]).To(equalQuantity("1Gi"))
+	})
+
+	It("Reports limit range violations of containers and pods", func() {
+		limitRanges := []corev1.LimitRange{{
+			ObjectMeta: metav1.ObjectMeta{Name: "limits", Namespace: "default"},
+			Spec: corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{
+				{
+					Type:                 corev1.LimitTypeContainer,
+					Max:                  resourceList("cpu", "1"),
+					Min:                  resourceList("memory", "64Mi"),
+					MaxLimitRequestRatio: resourceList("cpu", "2"),
+				},
+				{
+					Type: corev1.LimitTypePod,
+					Max:  resourceList("memory", "1Gi"),
+				},
+			}},
+		}}
+		pod := quotaPod(
+			corev1.Container{Name: "a", Resources: corev1.ResourceRequirements{
+				Requests: resourceList("cpu", "500m", "memory", "32Mi"),
+				Limits:   resourceList("cpu", "2", "memory", "2Gi"),
+			}},
+			corev1.Container{Name: "b", Resources: corev1.ResourceRequirements{
+				Requests: resourceList("cpu", "500m", "memory", "128Mi"),
+				Limits:   resourceList("cpu", "1", "memory", "256Mi"),
+			}},
+		)
+
+		Expect(checkLimitRanges(pod, limitRanges)).To(Equal([]string{
+			"limits: container a: minimum memory request is 64Mi, got 32Mi",
+			"limits: container a: maximum cpu limit is 1, got 2",
+			"limits: container a: cpu limit to request ratio must be at most 2, got 2/500m",
+			"limits: pod: maximum memory limit is 1Gi, got 2304Mi",
+		}))
+
+		pod.Spec.Containers = pod.Spec.Containers[1:]
+		Expect(checkLimitRanges(pod, limitRanges)).To(BeEmpty())
+	})
+})
@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// writeReadyFileWhenReady waits for the API server of kubeConfig to report ready on /readyz and
+// then writes the kubeconfig path to fileName, so that wrapper scripts can wait for the file
+// instead of sleeping. It returns when the file is written.
+func writeReadyFileWhenReady(fileName string, kubeConfig string, interval time.Duration) {
+	server, err := kubeConfigServer(kubeConfig)
+	if err != nil {
+		log.Warnf("failed to write ready file: %v", err)
+		return
+	}
+
+	client := &http.Client{Timeout: time.Second}
+	for {
+		resp, err := client.Get(server + "/readyz")
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				break
+			}
+		}
+		time.Sleep(interval)
+	}
+
+	if err := writeReadyFile(fileName, kubeConfig); err != nil {
+		log.Warnf("failed to write ready file: %v", err)
+	}
+}
+
+// writeReadyFile creates the file in one step, so that it never exists with partial contents
+func writeReadyFile(fileName string, kubeConfig string) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(fileName), ".sbctl-ready-")
+	if err != nil {
+		return errors.Wrap(err, "failed to create temp file")
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.WriteString(kubeConfig + "\n"); err != nil {
+		tmpFile.Close()
+		return errors.Wrap(err, "failed to write temp file")
+	}
+	if err := tmpFile.Close(); err != nil {
+		return errors.Wrap(err, "failed to close temp file")
+	}
+	return errors.Wrap(os.Rename(tmpFile.Name(), fileName), "failed to rename temp file")
+}
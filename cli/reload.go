@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	log "github.com/sirupsen/logrus"
+)
+
+// watchBundleDir polls bundleDir and calls reload once its contents changed and stopped changing.
+// Polling is used because bundles are deeply nested and usually small enough to walk quickly.
+func watchBundleDir(bundleDir string, interval time.Duration, reload func() error) {
+	last, err := bundleFingerprint(bundleDir)
+	if err != nil {
+		log.Errorf("failed to watch %s: %v", bundleDir, err)
+		return
+	}
+
+	for {
+		time.Sleep(interval)
+
+		current, err := bundleFingerprint(bundleDir)
+		if err != nil || current == last {
+			continue
+		}
+
+		// Wait for collectors or editors to finish writing before reloading
+		for {
+			time.Sleep(interval)
+			settled, err := bundleFingerprint(bundleDir)
+			if err == nil && settled == current {
+				break
+			}
+			current = settled
+		}
+		last = current
+
+		if err := reload(); err != nil {
+			log.Errorf("failed to reload bundle: %v", err)
+			continue
+		}
+		log.Infof("reloaded bundle after changes in %s", bundleDir)
+	}
+}
+
+// bundleFingerprint hashes the names, sizes and modification times of all files in dir
+func bundleFingerprint(dir string) (uint64, error) {
+	h := fnv.New64a()
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s %d %d\n", path, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return h.Sum64(), nil
+}
+
+// refreshClusterData returns the cluster data to serve after files in bundleDir changed. Files in
+// the troubleshoot layout are read on every request, so only the location of the cluster data can
+// change, e.g. when a bundle that is still being collected gains its cluster resources. Converted
+// bundles are converted again and swapped into convertedDir, so the paths the server uses stay the same.
+func refreshClusterData(bundleDir string, current sbctl.ClusterData, convertedDir string) (sbctl.ClusterData, error) {
+	found, err := sbctl.FindClusterData(bundleDir)
+	if err != nil {
+		return current, errors.Wrap(err, "failed to find cluster data")
+	}
+
+	if convertedDir == "" {
+		if found.ClusterResourcesDir == "" {
+			// Nothing collected yet
+			return current, nil
+		}
+		if found.ClusterInfoFile == "" {
+			found.ClusterInfoFile = current.ClusterInfoFile
+		}
+		return found, nil
+	}
+
+	if found.SupportBundleKitDir == "" {
+		return current, errors.New("support-bundle-kit resources no longer found, restart sbctl to serve the bundle")
+	}
+
+	tmpDir, err := os.MkdirTemp("", "sbctl-converted-")
+	if err != nil {
+		return current, errors.Wrap(err, "failed to create temp dir")
+	}
+	defer removeBundleData(tmpDir)
+
+	if _, err := sbctl.ConvertSupportBundleKit(found.SupportBundleKitDir, tmpDir); err != nil {
+		return current, errors.Wrap(err, "failed to convert support-bundle-kit bundle")
+	}
+
+	for _, name := range []string{"cluster-resources", "cluster-info"} {
+		if err := removeBundleData(filepath.Join(convertedDir, name)); err != nil {
+			return current, errors.Wrapf(err, "failed to remove %s", name)
+		}
+		if !isDir(filepath.Join(tmpDir, name)) {
+			continue
+		}
+		if err := os.Rename(filepath.Join(tmpDir, name), filepath.Join(convertedDir, name)); err != nil {
+			return current, errors.Wrapf(err, "failed to replace %s", name)
+		}
+	}
+
+	return current, nil
+}
+
+// streamingClusterData returns where the cluster data of a bundle that is still being collected
+// will be written, so it can be served as soon as the collectors write it.
+func streamingClusterData(bundleDir string) sbctl.ClusterData {
+	return sbctl.ClusterData{
+		ClusterResourcesDir: filepath.Join(bundleDir, "cluster-resources"),
+		ClusterInfoFile:     filepath.Join(bundleDir, "cluster-info", "cluster_version.json"),
+	}
+}
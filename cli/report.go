@@ -0,0 +1,305 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/output"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+type triageReport struct {
+	Title    string
+	Facts    []triageFact
+	Sections []triageSection
+}
+
+type triageFact struct {
+	Name  string
+	Value string
+}
+
+type triageSection struct {
+	Title string
+	Items []string
+}
+
+// Markup escapes user controlled text such as event messages so that they render literally
+var (
+	slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	jiraEscaper  = strings.NewReplacer("{", "\\{", "}", "\\}", "[", "\\[", "]", "\\]", "|", "\\|")
+)
+
+func ReportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "report",
+		Short: "Print a triage summary of a support bundle",
+		Long: `Print a triage summary of a support bundle.
+
+The summary lists the cluster version, nodes that are not ready, unhealthy pods and the most
+frequent warning events. Use --format slack or --format jira to render it with the markup of
+the respective tool, so it can be pasted into a channel or ticket as is.`,
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			format := v.GetString("format")
+			if format != "text" && format != "slack" && format != "jira" {
+				return usererrors.New(usererrors.InvalidArgument, errors.Errorf("unsupported format %q, must be one of text, slack or jira", format), "--format")
+			}
+
+			clusterData, cleanup, err := loadClusterData(v)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			// Only the timezone applies, the collection time is always shown as an absolute time
+			tf, err := newTimeFormat(v, time.Time{})
+			if err != nil {
+				return err
+			}
+
+			report, err := buildTriageReport(clusterData, v.GetInt("max-items"), tf.Location)
+			if err != nil {
+				return err
+			}
+
+			switch format {
+			case "slack":
+				printSlackReport(os.Stdout, report)
+			case "jira":
+				printJiraReport(os.Stdout, report)
+			default:
+				p, err := newPrinter(os.Stdout)
+				if err != nil {
+					return err
+				}
+				printTextReport(p, report)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	cmd.Flags().String("format", "text", "output format. One of: text, slack, jira")
+	cmd.Flags().Int("max-items", 10, "maximum number of items listed in each section")
+	return cmd
+}
+
+func buildTriageReport(clusterData sbctl.ClusterData, maxItems int, loc *time.Location) (triageReport, error) {
+	report := triageReport{
+		Title: "Support bundle triage summary",
+	}
+
+	nodes, err := sbctl.ListResources(clusterData, "", "nodes")
+	if err != nil {
+		return report, errors.Wrap(err, "failed to list nodes")
+	}
+	pods, err := sbctl.ListResources(clusterData, "", "pods")
+	if err != nil {
+		return report, errors.Wrap(err, "failed to list pods")
+	}
+	events, err := sbctl.ListResources(clusterData, "", "events")
+	if err != nil {
+		return report, errors.Wrap(err, "failed to list events")
+	}
+
+	notReadyNodes := notReadyNodeIssues(nodes)
+	unhealthyPods := unhealthyPodIssues(pods)
+	warnings := topWarningEvents(events)
+
+	report.Facts = []triageFact{
+		{Name: "Kubernetes version", Value: clusterVersion(clusterData)},
+		{Name: "Collected at", Value: bundleCollectionTime(events).In(loc).Format("2006-01-02 15:04:05 MST")},
+		{Name: "Nodes", Value: fmt.Sprintf("%d (%d not ready)", len(nodes), len(notReadyNodes))},
+		{Name: "Pods", Value: fmt.Sprintf("%d (%d unhealthy)", len(pods), len(unhealthyPods))},
+	}
+
+	report.Sections = []triageSection{
+		{Title: "Nodes not ready", Items: truncateItems(notReadyNodes, maxItems)},
+		{Title: "Unhealthy pods", Items: truncateItems(unhealthyPods, maxItems)},
+		{Title: "Top warning events", Items: truncateItems(warnings, maxItems)},
+	}
+
+	return report, nil
+}
+
+func clusterVersion(clusterData sbctl.ClusterData) string {
+	data, err := os.ReadFile(clusterData.ClusterInfoFile)
+	if err != nil {
+		return "<unknown>"
+	}
+	version := struct {
+		String string `json:"string"`
+	}{}
+	if err := json.Unmarshal(data, &version); err != nil || version.String == "" {
+		return "<unknown>"
+	}
+	return version.String
+}
+
+func notReadyNodeIssues(nodes []unstructured.Unstructured) []string {
+	issues := []string{}
+	for _, n := range nodes {
+		conditions, _, _ := unstructured.NestedSlice(n.Object, "status", "conditions")
+		for _, c := range conditions {
+			condition, ok := c.(map[string]interface{})
+			if !ok || condition["type"] != "Ready" || condition["status"] == "True" {
+				continue
+			}
+			issues = append(issues, fmt.Sprintf("%s: %v: %v", n.GetName(), condition["reason"], condition["message"]))
+		}
+	}
+	return issues
+}
+
+func unhealthyPodIssues(pods []unstructured.Unstructured) []string {
+	issues := []string{}
+	for _, p := range pods {
+		phase := nestedStringOrNone(p, "status", "phase")
+		if phase == "Succeeded" {
+			continue
+		}
+
+		reasons := []string{}
+		if phase != "Running" {
+			reasons = append(reasons, phase)
+		}
+
+		statuses, _, _ := unstructured.NestedSlice(p.Object, "status", "containerStatuses")
+		for _, s := range statuses {
+			status, ok := s.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			container := unstructured.Unstructured{Object: status}
+			if reason := nestedStringOrNone(container, "state", "waiting", "reason"); reason != "<none>" {
+				reasons = append(reasons, fmt.Sprintf("%s %s", container.Object["name"], reason))
+			}
+			if restarts := nestedInt(container, "restartCount"); restarts > 0 {
+				reasons = append(reasons, fmt.Sprintf("%s restarted %d times", container.Object["name"], restarts))
+			}
+		}
+
+		if len(reasons) == 0 {
+			continue
+		}
+		issues = append(issues, fmt.Sprintf("%s/%s: %s", p.GetNamespace(), p.GetName(), strings.Join(reasons, ", ")))
+	}
+	return issues
+}
+
+// topWarningEvents groups warning events by reason, most frequent first, with an example message
+func topWarningEvents(events []unstructured.Unstructured) []string {
+	counts := map[string]int64{}
+	examples := map[string]string{}
+	for _, e := range events {
+		if nestedStringOrNone(e, "type") != "Warning" {
+			continue
+		}
+		reason := nestedStringOrNone(e, "reason")
+		count := nestedInt(e, "count")
+		if count == 0 {
+			count = 1
+		}
+		counts[reason] += count
+		if _, ok := examples[reason]; !ok {
+			examples[reason] = fmt.Sprintf("%s/%s: %s", nestedStringOrNone(e, "involvedObject", "kind"), nestedStringOrNone(e, "involvedObject", "name"), nestedStringOrNone(e, "message"))
+		}
+	}
+
+	reasons := make([]string, 0, len(counts))
+	for reason := range counts {
+		reasons = append(reasons, reason)
+	}
+	sort.Slice(reasons, func(i, j int) bool {
+		if counts[reasons[i]] != counts[reasons[j]] {
+			return counts[reasons[i]] > counts[reasons[j]]
+		}
+		return reasons[i] < reasons[j]
+	})
+
+	issues := []string{}
+	for _, reason := range reasons {
+		issues = append(issues, fmt.Sprintf("%s (%d): %s", reason, counts[reason], examples[reason]))
+	}
+	return issues
+}
+
+func truncateItems(items []string, maxItems int) []string {
+	if maxItems <= 0 || len(items) <= maxItems {
+		return items
+	}
+	truncated := append([]string{}, items[:maxItems]...)
+	return append(truncated, fmt.Sprintf("... and %d more", len(items)-maxItems))
+}
+
+// printTextReport prints the report for a terminal, with titles in bold and sections that have
+// no issues in green
+func printTextReport(p *output.Printer, report triageReport) {
+	out := p.Writer()
+	fmt.Fprintf(out, "%s\n\n", p.Bold(report.Title))
+	for _, f := range report.Facts {
+		fmt.Fprintf(out, "%s: %s\n", f.Name, f.Value)
+	}
+	for _, s := range report.Sections {
+		fmt.Fprintf(out, "\n%s\n", p.Bold(s.Title+":"))
+		if len(s.Items) == 0 {
+			fmt.Fprintf(out, "  %s\n", p.Green("<none>"))
+		}
+		for _, item := range s.Items {
+			fmt.Fprintf(out, "  - %s\n", item)
+		}
+	}
+}
+
+// printSlackReport renders the report with Slack mrkdwn
+func printSlackReport(out io.Writer, report triageReport) {
+	fmt.Fprintf(out, "*%s*\n", slackEscaper.Replace(report.Title))
+	for _, f := range report.Facts {
+		fmt.Fprintf(out, "*%s:* %s\n", f.Name, slackEscaper.Replace(f.Value))
+	}
+	for _, s := range report.Sections {
+		fmt.Fprintf(out, "\n*%s*\n", s.Title)
+		if len(s.Items) == 0 {
+			fmt.Fprintln(out, "_none_")
+		}
+		for _, item := range s.Items {
+			fmt.Fprintf(out, "• %s\n", slackEscaper.Replace(item))
+		}
+	}
+}
+
+// printJiraReport renders the report with Jira wiki markup
+func printJiraReport(out io.Writer, report triageReport) {
+	fmt.Fprintf(out, "h2. %s\n\n", jiraEscaper.Replace(report.Title))
+	for _, f := range report.Facts {
+		fmt.Fprintf(out, "||%s|%s|\n", f.Name, jiraEscaper.Replace(f.Value))
+	}
+	for _, s := range report.Sections {
+		fmt.Fprintf(out, "\nh3. %s\n", s.Title)
+		if len(s.Items) == 0 {
+			fmt.Fprintln(out, "_none_")
+		}
+		for _, item := range s.Items {
+			fmt.Fprintf(out, "* %s\n", jiraEscaper.Replace(item))
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var _ = Describe("Report", func() {
+	nodes := []unstructured.Unstructured{
+		unstructuredFixture(`{"metadata": {"name": "node-1"}, "status": {"conditions": [{"type": "Ready", "status": "True"}]}}`),
+		unstructuredFixture(`{"metadata": {"name": "node-2"}, "status": {"conditions": [
+			{"type": "MemoryPressure", "status": "True"},
+			{"type": "Ready", "status": "Unknown", "reason": "NodeStatusUnknown", "message": "Kubelet stopped posting node status."}
+		]}}`),
+	}
+	pods := []unstructured.Unstructured{
+		unstructuredFixture(`{"metadata": {"name": "web-0", "namespace": "default"}, "status": {"phase": "Running", "containerStatuses": [{"name": "web", "restartCount": 0}]}}`),
+		unstructuredFixture(`{"metadata": {"name": "web-1", "namespace": "default"}, "status": {"phase": "Running", "containerStatuses": [
+			{"name": "web", "restartCount": 4, "state": {"waiting": {"reason": "CrashLoopBackOff"}}}
+		]}}`),
+		unstructuredFixture(`{"metadata": {"name": "job-1", "namespace": "default"}, "status": {"phase": "Succeeded"}}`),
+		unstructuredFixture(`{"metadata": {"name": "api-0", "namespace": "app"}, "status": {"phase": "Pending"}}`),
+	}
+	events := []unstructured.Unstructured{
+		unstructuredFixture(`{"metadata": {"name": "a"}, "type": "Warning", "reason": "BackOff", "count": 5, "message": "Back-off restarting <web>", "involvedObject": {"kind": "Pod", "name": "web-1"}, "lastTimestamp": "2024-05-01T12:00:00Z"}`),
+		unstructuredFixture(`{"metadata": {"name": "b"}, "type": "Warning", "reason": "FailedScheduling", "count": 2, "message": "0/2 nodes are available", "involvedObject": {"kind": "Pod", "name": "api-0"}}`),
+		unstructuredFixture(`{"metadata": {"name": "c"}, "type": "Warning", "reason": "FailedScheduling", "message": "0/3 nodes are available", "involvedObject": {"kind": "Pod", "name": "api-1"}}`),
+		unstructuredFixture(`{"metadata": {"name": "d"}, "type": "Normal", "reason": "Pulled", "count": 10}`),
+	}
+
+	It("Lists nodes that are not ready", func() {
+		Expect(notReadyNodeIssues(nodes)).To(Equal([]string{"node-2: NodeStatusUnknown: Kubelet stopped posting node status."}))
+	})
+
+	It("Lists pods that are not running or have restarted", func() {
+		Expect(unhealthyPodIssues(pods)).To(Equal([]string{
+			"default/web-1: web CrashLoopBackOff, web restarted 4 times",
+			"app/api-0: Pending",
+		}))
+	})
+
+	It("Groups warning events by reason, most frequent first", func() {
+		Expect(topWarningEvents(events)).To(Equal([]string{
+			"BackOff (5): Pod/web-1: Back-off restarting <web>",
+			"FailedScheduling (3): Pod/api-0: 0/2 nodes are available",
+		}))
+	})
+
+	It("Truncates long sections", func() {
+		Expect(truncateItems([]string{"a", "b", "c"}, 2)).To(Equal([]string{"a", "b", "... and 1 more"}))
+		Expect(truncateItems([]string{"a", "b"}, 2)).To(Equal([]string{"a", "b"}))
+		Expect(truncateItems([]string{"a", "b"}, 0)).To(Equal([]string{"a", "b"}))
+	})
+
+	It("Builds reports from bundles", func() {
+		dir := GinkgoT().TempDir()
+		writeClusterResource(dir, "nodes.json", fixtureList("v1", "Node", `{"metadata": {"name": "node-1"}, "status": {"conditions": [{"type": "Ready", "status": "False", "reason": "KubeletNotReady", "message": "PLEG is not healthy"}]}}`))
+		writeClusterResource(dir, "pods/default.json", fixtureList("v1", "Pod", `{"metadata": {"name": "web-0", "namespace": "default"}, "status": {"phase": "Running"}}`))
+		writeClusterResource(dir, "events/default.json", fixtureList("v1", "Event",
+			`{"metadata": {"name": "a", "namespace": "default"}, "type": "Warning", "reason": "NodeNotReady", "count": 1, "message": "Node is not ready", "involvedObject": {"kind": "Node", "name": "node-1"}, "lastTimestamp": "2024-05-01T12:00:00Z"}`))
+		versionFile := filepath.Join(dir, "cluster-info", "cluster_version.json")
+		Expect(os.MkdirAll(filepath.Dir(versionFile), 0755)).To(Succeed())
+		Expect(os.WriteFile(versionFile, []byte(`{"info": {"major": "1", "minor": "29"}, "string": "v1.29.2"}`), 0644)).To(Succeed())
+
+		clusterData, err := sbctl.FindClusterData(dir)
+		Expect(err).NotTo(HaveOccurred())
+		report, err := buildTriageReport(clusterData, 10, time.UTC)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(report.Facts).To(Equal([]triageFact{
+			{Name: "Kubernetes version", Value: "v1.29.2"},
+			{Name: "Collected at", Value: "2024-05-01 12:00:00 UTC"},
+			{Name: "Nodes", Value: "1 (1 not ready)"},
+			{Name: "Pods", Value: "1 (0 unhealthy)"},
+		}))
+		Expect(report.Sections).To(Equal([]triageSection{
+			{Title: "Nodes not ready", Items: []string{"node-1: KubeletNotReady: PLEG is not healthy"}},
+			{Title: "Unhealthy pods", Items: []string{}},
+			{Title: "Top warning events", Items: []string{"NodeNotReady (1): Node/node-1: Node is not ready"}},
+		}))
+	})
+
+	Describe("Markup", func() {
+		report := triageReport{
+			Title: "Summary",
+			Facts: []triageFact{{Name: "Nodes", Value: "1 (0 not ready)"}},
+			Sections: []triageSection{
+				{Title: "Unhealthy pods", Items: []string{"default/web: <waiting> & [crashing] {x|y}"}},
+				{Title: "Nodes not ready"},
+			},
+		}
+
+		It("Escapes Slack markup", func() {
+			out := bytes.Buffer{}
+			printSlackReport(&out, report)
+			Expect(out.String()).To(Equal("*Summary*\n" +
+				"*Nodes:* 1 (0 not ready)\n" +
+				"\n*Unhealthy pods*\n" +
+				"• default/web: &lt;waiting&gt; &amp; [crashing] {x|y}\n" +
+				"\n*Nodes not ready*\n" +
+				"_none_\n"))
+		})
+
+		It("Escapes Jira markup", func() {
+			out := bytes.Buffer{}
+			printJiraReport(&out, report)
+			Expect(out.String()).To(Equal("h2. Summary\n\n" +
+				"||Nodes|1 (0 not ready)|\n" +
+				"\nh3. Unhealthy pods\n" +
+				"* default/web: <waiting> & \\[crashing\\] \\{x\\|y\\}\n" +
+				"\nh3. Nodes not ready\n" +
+				"_none_\n"))
+		})
+	})
+})
@@ -0,0 +1,323 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func ResolveCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "resolve <service>[.<namespace>[.svc[.<cluster domain>]]]",
+		Short: "Trace a Service name to the pods that serve it",
+		Long: `Trace a Service name to the pods that serve it, using the objects in a support bundle.
+
+The Service is looked up from its DNS name, e.g. "my-svc.my-ns.svc.cluster.local", "my-svc.my-ns" or
+"my-svc" with --namespace. Its Endpoints and EndpointSlices, the pods selected by the Service with
+their readiness, and the NetworkPolicies that apply to those pods are shown.`,
+		Args:          cobra.ExactArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			name, namespace := parseServiceName(args[0], v.GetString("namespace"))
+
+			clusterData, cleanup, err := loadClusterData(v)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			services, err := sbctl.ListTypedResources[corev1.Service](clusterData, "", "services")
+			if err != nil {
+				return errors.Wrap(err, "failed to list services")
+			}
+
+			var svc *corev1.Service
+			for i := range services {
+				if services[i].Namespace == namespace && services[i].Name == name {
+					svc = &services[i]
+					break
+				}
+			}
+			if svc == nil {
+				return errors.Errorf("service %s/%s not found in support bundle", namespace, name)
+			}
+
+			out := os.Stdout
+			printServiceSummary(out, *svc)
+			if svc.Spec.Type == corev1.ServiceTypeExternalName {
+				fmt.Fprintf(out, "\n%s.%s.svc resolves to CNAME %s, which is outside the cluster\n", name, namespace, svc.Spec.ExternalName)
+				return nil
+			}
+
+			endpoints, err := sbctl.ListTypedResources[corev1.Endpoints](clusterData, "", "endpoints")
+			if err != nil {
+				return errors.Wrap(err, "failed to list endpoints")
+			}
+			slices, err := sbctl.ListTypedResources[discoveryv1.EndpointSlice](clusterData, "discovery.k8s.io", "endpointslices")
+			if err != nil {
+				return errors.Wrap(err, "failed to list endpoint slices")
+			}
+			pods, err := sbctl.ListTypedResources[corev1.Pod](clusterData, "", "pods")
+			if err != nil {
+				return errors.Wrap(err, "failed to list pods")
+			}
+			policies, err := sbctl.ListTypedResources[networkingv1.NetworkPolicy](clusterData, "networking.k8s.io", "networkpolicies")
+			if err != nil {
+				return errors.Wrap(err, "failed to list network policies")
+			}
+
+			// Pod IPs listed by Endpoints or EndpointSlices, and whether they are ready to receive traffic
+			addresses := map[string]bool{}
+
+			fmt.Fprintln(out, "\nEndpoints:")
+			found := false
+			for _, e := range endpoints {
+				if e.Namespace != namespace || e.Name != name {
+					continue
+				}
+				found = true
+				printEndpoints(out, e, addresses)
+			}
+			if !found {
+				fmt.Fprintln(out, "  <none>")
+			}
+
+			fmt.Fprintln(out, "\nEndpointSlices:")
+			found = false
+			for _, s := range slices {
+				if s.Namespace != namespace || s.Labels[discoveryv1.LabelServiceName] != name {
+					continue
+				}
+				found = true
+				printEndpointSlice(out, s, addresses)
+			}
+			if !found {
+				fmt.Fprintln(out, "  <none>")
+			}
+
+			targets := servicePods(*svc, pods)
+
+			fmt.Fprintln(out, "\nPods:")
+			if len(svc.Spec.Selector) == 0 {
+				fmt.Fprintln(out, "  service has no selector, endpoints are managed outside of Kubernetes")
+			} else if len(targets) == 0 {
+				fmt.Fprintf(out, "  no pods match selector %s\n", labels.SelectorFromSet(svc.Spec.Selector))
+			} else {
+				printServicePods(out, targets, addresses)
+			}
+
+			fmt.Fprintln(out, "\nNetworkPolicies:")
+			applied := appliedNetworkPolicies(policies, namespace, targets)
+			if len(applied) == 0 {
+				fmt.Fprintln(out, "  <none>, traffic to the pods is not restricted")
+			} else {
+				printNetworkPolicies(out, applied)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	cmd.Flags().StringP("namespace", "n", "default", "namespace of the service when the name does not include one")
+	return cmd
+}
+
+// parseServiceName splits a Service DNS name into the service name and namespace
+func parseServiceName(dnsName string, defaultNamespace string) (string, string) {
+	parts := strings.Split(strings.TrimSuffix(dnsName, "."), ".")
+	if len(parts) == 1 {
+		return parts[0], defaultNamespace
+	}
+	return parts[0], parts[1]
+}
+
+// servicePods returns the pods in the namespace of the Service that its selector matches. Services
+// without a selector select no pods.
+func servicePods(svc corev1.Service, pods []corev1.Pod) []corev1.Pod {
+	targets := []corev1.Pod{}
+	if len(svc.Spec.Selector) == 0 {
+		return targets
+	}
+	selector := labels.SelectorFromSet(svc.Spec.Selector)
+	for _, p := range pods {
+		if p.Namespace == svc.Namespace && selector.Matches(labels.Set(p.Labels)) {
+			targets = append(targets, p)
+		}
+	}
+	return targets
+}
+
+func printServiceSummary(out io.Writer, svc corev1.Service) {
+	ports := []string{}
+	for _, p := range svc.Spec.Ports {
+		port := fmt.Sprintf("%d->%s/%s", p.Port, p.TargetPort.String(), p.Protocol)
+		if p.Name != "" {
+			port = fmt.Sprintf("%s:%s", p.Name, port)
+		}
+		ports = append(ports, port)
+	}
+
+	clusterIP := svc.Spec.ClusterIP
+	if clusterIP == corev1.ClusterIPNone {
+		clusterIP = "None (headless, DNS returns pod IPs)"
+	}
+
+	fmt.Fprintf(out, "Service:    %s/%s\n", svc.Namespace, svc.Name)
+	fmt.Fprintf(out, "Type:       %s\n", svc.Spec.Type)
+	fmt.Fprintf(out, "ClusterIP:  %s\n", valueOrNone(clusterIP))
+	fmt.Fprintf(out, "Ports:      %s\n", valueOrNone(strings.Join(ports, ", ")))
+	fmt.Fprintf(out, "Selector:   %s\n", valueOrNone(labels.SelectorFromSet(svc.Spec.Selector).String()))
+}
+
+func printEndpoints(out io.Writer, e corev1.Endpoints, addresses map[string]bool) {
+	for _, subset := range e.Subsets {
+		ports := []string{}
+		for _, p := range subset.Ports {
+			ports = append(ports, fmt.Sprintf("%d/%s", p.Port, p.Protocol))
+		}
+		for _, a := range subset.Addresses {
+			addresses[a.IP] = true
+			fmt.Fprintf(out, "  %s %s ready %s\n", a.IP, strings.Join(ports, ","), endpointTarget(a.TargetRef))
+		}
+		for _, a := range subset.NotReadyAddresses {
+			if _, ok := addresses[a.IP]; !ok {
+				addresses[a.IP] = false
+			}
+			fmt.Fprintf(out, "  %s %s not ready %s\n", a.IP, strings.Join(ports, ","), endpointTarget(a.TargetRef))
+		}
+	}
+}
+
+func printEndpointSlice(out io.Writer, s discoveryv1.EndpointSlice, addresses map[string]bool) {
+	ports := []string{}
+	for _, p := range s.Ports {
+		if p.Port != nil && p.Protocol != nil {
+			ports = append(ports, fmt.Sprintf("%d/%s", *p.Port, *p.Protocol))
+		}
+	}
+
+	fmt.Fprintf(out, "  %s (%s)\n", s.Name, s.AddressType)
+	for _, e := range s.Endpoints {
+		// Endpoints without a ready condition are ready, see the EndpointConditions API docs
+		ready := e.Conditions.Ready == nil || *e.Conditions.Ready
+		readiness := "ready"
+		if !ready {
+			readiness = "not ready"
+		}
+		for _, a := range e.Addresses {
+			if ready || !addresses[a] {
+				addresses[a] = ready
+			}
+			fmt.Fprintf(out, "    %s %s %s %s\n", a, strings.Join(ports, ","), readiness, endpointTarget(e.TargetRef))
+		}
+	}
+}
+
+func endpointTarget(ref *corev1.ObjectReference) string {
+	if ref == nil {
+		return ""
+	}
+	return fmt.Sprintf("-> %s/%s", strings.ToLower(ref.Kind), ref.Name)
+}
+
+func printServicePods(out io.Writer, pods []corev1.Pod, addresses map[string]bool) {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "  NAME\tNODE\tIP\tPHASE\tREADY\tENDPOINT")
+	for _, p := range pods {
+		endpoint := "missing"
+		if ready, ok := addresses[p.Status.PodIP]; ok {
+			endpoint = "not ready"
+			if ready {
+				endpoint = "ready"
+			}
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%t\t%s\n",
+			p.Name, valueOrNone(p.Spec.NodeName), valueOrNone(p.Status.PodIP), p.Status.Phase, isPodReady(p), endpoint)
+	}
+}
+
+// appliedNetworkPolicies returns the policies in the namespace selecting any of the pods. Without
+// target pods, every policy with an empty pod selector is returned since it applies to all pods.
+func appliedNetworkPolicies(policies []networkingv1.NetworkPolicy, namespace string, pods []corev1.Pod) []networkingv1.NetworkPolicy {
+	applied := []networkingv1.NetworkPolicy{}
+	for _, np := range policies {
+		if np.Namespace != namespace {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(&np.Spec.PodSelector)
+		if err != nil {
+			continue
+		}
+		matches := selector.Empty()
+		for _, p := range pods {
+			matches = matches || selector.Matches(labels.Set(p.Labels))
+		}
+		if matches {
+			applied = append(applied, np)
+		}
+	}
+	sort.Slice(applied, func(i, j int) bool {
+		return applied[i].Name < applied[j].Name
+	})
+	return applied
+}
+
+func printNetworkPolicies(out io.Writer, policies []networkingv1.NetworkPolicy) {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "  NAME\tPOD SELECTOR\tINGRESS\tEGRESS")
+	for _, np := range policies {
+		selector := metav1.FormatLabelSelector(&np.Spec.PodSelector)
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", np.Name, selector,
+			describePolicyRules(np, networkingv1.PolicyTypeIngress, len(np.Spec.Ingress)),
+			describePolicyRules(np, networkingv1.PolicyTypeEgress, len(np.Spec.Egress)))
+	}
+}
+
+func describePolicyRules(np networkingv1.NetworkPolicy, policyType networkingv1.PolicyType, rules int) string {
+	types := np.Spec.PolicyTypes
+	if len(types) == 0 {
+		// Policies without types always restrict ingress, and restrict egress when they have egress rules
+		types = []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}
+		if len(np.Spec.Egress) > 0 {
+			types = append(types, networkingv1.PolicyTypeEgress)
+		}
+	}
+
+	restricted := false
+	for _, t := range types {
+		restricted = restricted || t == policyType
+	}
+	switch {
+	case !restricted:
+		return "not restricted"
+	case rules == 0:
+		return "deny all"
+	default:
+		return fmt.Sprintf("%d rules", rules)
+	}
+}
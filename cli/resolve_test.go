@@ -0,0 +1,140 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Resolve", func() {
+	var services []corev1.Service
+	var pods []corev1.Pod
+
+	BeforeEach(func() {
+		clusterData := testBundleData()
+		var err error
+		services, err = sbctl.ListTypedResources[corev1.Service](clusterData, "", "services")
+		Expect(err).NotTo(HaveOccurred())
+		pods, err = sbctl.ListTypedResources[corev1.Pod](clusterData, "", "pods")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	service := func(namespace string, name string) corev1.Service {
+		for _, svc := range services {
+			if svc.Namespace == namespace && svc.Name == name {
+				return svc
+			}
+		}
+		Fail("service " + namespace + "/" + name + " not found in the test bundle")
+		return corev1.Service{}
+	}
+
+	DescribeTable("Splits Service DNS names into name and namespace",
+		func(dnsName string, name string, namespace string) {
+			actualName, actualNamespace := parseServiceName(dnsName, "default")
+			Expect(actualName).To(Equal(name))
+			Expect(actualNamespace).To(Equal(namespace))
+		},
+		Entry("name", "kube-dns", "kube-dns", "default"),
+		Entry("name and namespace", "kube-dns.kube-system", "kube-dns", "kube-system"),
+		Entry("fully qualified", "kube-dns.kube-system.svc.cluster.local.", "kube-dns", "kube-system"),
+	)
+
+	It("Summarizes a Service", func() {
+		out := bytes.Buffer{}
+		printServiceSummary(&out, service("kube-system", "kube-dns"))
+		Expect(out.String()).To(ContainSubstring("Service:    kube-system/kube-dns\nType:       ClusterIP\n"))
+		Expect(out.String()).To(ContainSubstring("Ports:      dns:53->53/UDP, dns-tcp:53->53/TCP, metrics:9153->9153/TCP\n"))
+		Expect(out.String()).To(ContainSubstring("Selector:   k8s-app=kube-dns\n"))
+
+		out.Reset()
+		printServiceSummary(&out, service("default", "kubernetes"))
+		Expect(out.String()).To(ContainSubstring("Selector:   <none>\n"))
+	})
+
+	It("Finds the pods of a Service and whether their endpoints are ready", func() {
+		targets := servicePods(service("kube-system", "kube-dns"), pods)
+		Expect(targets).To(HaveLen(2))
+		Expect(targets[0].Name).To(Equal("coredns-64897985d-2wvxr"))
+		Expect(targets[1].Name).To(Equal("coredns-64897985d-jv9lv"))
+		Expect(servicePods(service("default", "kubernetes"), pods)).To(BeEmpty())
+
+		// Pod IPs are redacted in the test bundle
+		targets[0].Status.PodIP = "10.32.0.2"
+		targets[1].Status.PodIP = "10.32.0.3"
+
+		out := bytes.Buffer{}
+		addresses := map[string]bool{}
+		printEndpoints(&out, corev1.Endpoints{Subsets: []corev1.EndpointSubset{{
+			Addresses:         []corev1.EndpointAddress{{IP: "10.32.0.2", TargetRef: &corev1.ObjectReference{Kind: "Pod", Name: targets[0].Name}}},
+			NotReadyAddresses: []corev1.EndpointAddress{{IP: "10.32.0.3"}},
+			Ports:             []corev1.EndpointPort{{Port: 53, Protocol: corev1.ProtocolUDP}},
+		}}}, addresses)
+		Expect(out.String()).To(Equal("  10.32.0.2 53/UDP ready -> pod/coredns-64897985d-2wvxr\n  10.32.0.3 53/UDP not ready \n"))
+		Expect(addresses).To(Equal(map[string]bool{"10.32.0.2": true, "10.32.0.3": false}))
+
+		// Slices mark addresses ready that Endpoints did not, and never mark ready ones not ready
+		notReady := false
+		out.Reset()
+		printEndpointSlice(&out, discoveryv1.EndpointSlice{
+			ObjectMeta:  metav1.ObjectMeta{Name: "kube-dns-abc"},
+			AddressType: discoveryv1.AddressTypeIPv4,
+			Endpoints: []discoveryv1.Endpoint{
+				{Addresses: []string{"10.32.0.2"}, Conditions: discoveryv1.EndpointConditions{Ready: &notReady}},
+				{Addresses: []string{"10.32.0.3"}},
+			},
+		}, addresses)
+		Expect(out.String()).To(HavePrefix("  kube-dns-abc (IPv4)\n"))
+		Expect(addresses).To(Equal(map[string]bool{"10.32.0.2": true, "10.32.0.3": true}))
+
+		out.Reset()
+		delete(addresses, "10.32.0.3")
+		printServicePods(&out, targets, addresses)
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		Expect(lines).To(HaveLen(3))
+		Expect(strings.Fields(lines[1])).To(Equal([]string{"coredns-64897985d-2wvxr", "troubleshoot-demo-001", "10.32.0.2", "Running", "true", "ready"}))
+		Expect(strings.Fields(lines[2])).To(Equal([]string{"coredns-64897985d-jv9lv", "troubleshoot-demo-001", "10.32.0.3", "Running", "true", "missing"}))
+	})
+
+	It("Lists the NetworkPolicies that apply to the pods of a Service", func() {
+		targets := servicePods(service("kube-system", "kube-dns"), pods)
+		policy := func(namespace string, name string, selector map[string]string, spec networkingv1.NetworkPolicySpec) networkingv1.NetworkPolicy {
+			spec.PodSelector = metav1.LabelSelector{MatchLabels: selector}
+			return networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}, Spec: spec}
+		}
+		policies := []networkingv1.NetworkPolicy{
+			policy("kube-system", "dns", map[string]string{"k8s-app": "kube-dns"}, networkingv1.NetworkPolicySpec{
+				Ingress: []networkingv1.NetworkPolicyIngressRule{{}, {}},
+			}),
+			policy("kube-system", "default-deny", nil, networkingv1.NetworkPolicySpec{
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress},
+			}),
+			policy("kube-system", "proxy", map[string]string{"k8s-app": "kube-proxy"}, networkingv1.NetworkPolicySpec{}),
+			policy("default", "dns", map[string]string{"k8s-app": "kube-dns"}, networkingv1.NetworkPolicySpec{}),
+		}
+
+		applied := appliedNetworkPolicies(policies, "kube-system", targets)
+		Expect(applied).To(HaveLen(2))
+		Expect(applied[0].Name).To(Equal("default-deny"))
+		Expect(applied[1].Name).To(Equal("dns"))
+
+		out := bytes.Buffer{}
+		printNetworkPolicies(&out, applied)
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		Expect(lines).To(HaveLen(3))
+		Expect(strings.Fields(lines[1])).To(Equal([]string{"default-deny", "<none>", "deny", "all", "deny", "all"}))
+		Expect(strings.Fields(lines[2])).To(Equal([]string{"dns", "k8s-app=kube-dns", "2", "rules", "not", "restricted"}))
+
+		// Without pods, only policies for all pods of the namespace apply
+		applied = appliedNetworkPolicies(policies, "kube-system", nil)
+		Expect(applied).To(HaveLen(1))
+		Expect(applied[0].Name).To(Equal("default-deny"))
+	})
+})
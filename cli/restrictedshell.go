@@ -0,0 +1,300 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// defaultRestrictedCommands are the kubectl commands the restricted shell allows. They only read
+// from the API server, which only serves the bundle, and do not touch local files.
+var defaultRestrictedCommands = []string{"get", "describe", "logs", "explain", "api-resources", "api-versions", "version"}
+
+// restrictedFlag is a kubectl flag the restricted shell allows
+type restrictedFlag struct {
+	name      string
+	shorthand string
+	hasValue  bool
+}
+
+// commonRestrictedFlags are allowed with every command. Flags that change which server or
+// credentials kubectl uses, or that read or write local files, are never allowed.
+var commonRestrictedFlags = []restrictedFlag{
+	{name: "namespace", shorthand: "n", hasValue: true},
+	{name: "request-timeout", hasValue: true},
+	{name: "v", shorthand: "v", hasValue: true},
+	{name: "help", shorthand: "h"},
+}
+
+var (
+	allNamespacesFlag = restrictedFlag{name: "all-namespaces", shorthand: "A"}
+	selectorFlag      = restrictedFlag{name: "selector", shorthand: "l", hasValue: true}
+	outputFlag        = restrictedFlag{name: "output", shorthand: "o", hasValue: true}
+)
+
+// restrictedCommandFlags are the flags allowed with each command, in addition to the common ones.
+// Commands that are not listed only allow the common flags.
+var restrictedCommandFlags = map[string][]restrictedFlag{
+	"get": {
+		allNamespacesFlag, selectorFlag, outputFlag,
+		{name: "field-selector", hasValue: true},
+		{name: "watch", shorthand: "w"},
+		{name: "watch-only"},
+		{name: "output-watch-events"},
+		{name: "show-labels"},
+		{name: "show-kind"},
+		{name: "label-columns", shorthand: "L", hasValue: true},
+		{name: "sort-by", hasValue: true},
+		{name: "no-headers"},
+		{name: "chunk-size", hasValue: true},
+		{name: "ignore-not-found"},
+		{name: "subresource", hasValue: true},
+	},
+	"describe": {
+		allNamespacesFlag, selectorFlag,
+		{name: "show-events"},
+		{name: "chunk-size", hasValue: true},
+	},
+	"logs": {
+		selectorFlag,
+		{name: "container", shorthand: "c", hasValue: true},
+		{name: "all-containers"},
+		{name: "follow", shorthand: "f"},
+		{name: "previous", shorthand: "p"},
+		{name: "tail", hasValue: true},
+		{name: "since", hasValue: true},
+		{name: "since-time", hasValue: true},
+		{name: "timestamps"},
+		{name: "prefix"},
+		{name: "limit-bytes", hasValue: true},
+		{name: "max-log-requests", hasValue: true},
+		{name: "ignore-errors"},
+		{name: "pod-running-timeout", hasValue: true},
+	},
+	"explain": {
+		outputFlag,
+		{name: "recursive"},
+		{name: "api-version", hasValue: true},
+	},
+	"api-resources": {
+		outputFlag,
+		{name: "namespaced"},
+		{name: "api-group", hasValue: true},
+		{name: "verbs", hasValue: true},
+		{name: "sort-by", hasValue: true},
+		{name: "no-headers"},
+		{name: "cached"},
+	},
+	"version": {
+		outputFlag,
+		{name: "client"},
+	},
+	"top": {
+		allNamespacesFlag, selectorFlag,
+		{name: "containers"},
+		{name: "no-headers"},
+		{name: "sort-by", hasValue: true},
+		{name: "sum"},
+	},
+}
+
+// restrictedOutputFormats are the output formats allowed with --output. Formats that read
+// templates from files, such as go-template-file, are not allowed.
+var restrictedOutputFormats = []string{
+	"json", "yaml", "wide", "name", "jsonpath", "jsonpath-as-json", "go-template", "custom-columns",
+	"plaintext", "plaintext-openapiv2",
+}
+
+// runRestrictedShell reads commands from in and runs the ones that are allowed kubectl commands.
+// Commands are run without a shell, so pipes, redirects and variables are passed to kubectl as
+// literal arguments rather than interpreted.
+func runRestrictedShell(in io.Reader, out io.Writer, errOut io.Writer, kubeConfig string, allowed []string) error {
+	kubectl, err := exec.LookPath("kubectl")
+	if err != nil {
+		return errors.Wrap(err, "kubectl is required for the restricted shell")
+	}
+
+	fmt.Fprintf(out, "Restricted shell. Allowed commands: kubectl %s. Type exit or press Ctl-D when done.\n", strings.Join(allowed, ", kubectl "))
+
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, "sbctl> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return scanner.Err()
+		}
+
+		args, err := splitCommandLine(scanner.Text())
+		if err != nil {
+			fmt.Fprintf(errOut, "error: %v\n", err)
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		switch args[0] {
+		case "exit", "quit", "logout":
+			return nil
+		case "help":
+			fmt.Fprintf(out, "Allowed commands: kubectl %s\n", strings.Join(allowed, ", kubectl "))
+			continue
+		}
+
+		if err := checkRestrictedCommand(args, allowed); err != nil {
+			fmt.Fprintf(errOut, "error: %v\n", err)
+			continue
+		}
+
+		c := exec.Command(kubectl, args[1:]...)
+		c.Env = append(os.Environ(), "KUBECONFIG="+kubeConfig)
+		c.Stdin = nil
+		c.Stdout = out
+		c.Stderr = errOut
+		// kubectl prints its own errors, only the exit code is left
+		_ = c.Run()
+	}
+}
+
+// checkRestrictedCommand returns an error unless args are an allowed kubectl command with only
+// the flags allowed for it
+func checkRestrictedCommand(args []string, allowed []string) error {
+	if args[0] != "kubectl" && args[0] != "k" {
+		return errors.Errorf("%s is not allowed in the restricted shell", args[0])
+	}
+
+	// Flags before the command could hide it, e.g. in kubectl -n get delete pod
+	if len(args) < 2 || strings.HasPrefix(args[1], "-") {
+		return errors.New("the kubectl command must come first, e.g. kubectl get pods -n default")
+	}
+	command := args[1]
+	if !containsString(allowed, command) {
+		return errors.Errorf("kubectl %s is not allowed in the restricted shell", command)
+	}
+
+	flags := append(append([]restrictedFlag{}, commonRestrictedFlags...), restrictedCommandFlags[command]...)
+	rest := args[2:]
+	for len(rest) > 0 {
+		arg := rest[0]
+		rest = rest[1:]
+
+		switch {
+		case arg == "--":
+			return errors.New("-- is not allowed in the restricted shell")
+		case strings.HasPrefix(arg, "--"):
+			name, value, hasValue := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+			flag, ok := findRestrictedFlag(flags, func(f restrictedFlag) bool { return f.name == name })
+			if !ok {
+				return errors.Errorf("flag --%s is not allowed with kubectl %s in the restricted shell", name, command)
+			}
+			if flag.hasValue && !hasValue {
+				if len(rest) == 0 {
+					return errors.Errorf("flag --%s needs a value", name)
+				}
+				value, rest = rest[0], rest[1:]
+			}
+			if err := checkRestrictedFlagValue(flag, value); err != nil {
+				return err
+			}
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			// Short flags can be combined and have their values attached, e.g. -Aowide or -ojson
+			shorthands := strings.TrimPrefix(arg, "-")
+			for i := 0; i < len(shorthands); i++ {
+				shorthand := shorthands[i : i+1]
+				flag, ok := findRestrictedFlag(flags, func(f restrictedFlag) bool { return f.shorthand == shorthand })
+				if !ok {
+					return errors.Errorf("flag -%s is not allowed with kubectl %s in the restricted shell", shorthand, command)
+				}
+				if !flag.hasValue {
+					continue
+				}
+				value := strings.TrimPrefix(shorthands[i+1:], "=")
+				if value == "" {
+					if len(rest) == 0 {
+						return errors.Errorf("flag -%s needs a value", shorthand)
+					}
+					value, rest = rest[0], rest[1:]
+				}
+				if err := checkRestrictedFlagValue(flag, value); err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func findRestrictedFlag(flags []restrictedFlag, match func(restrictedFlag) bool) (restrictedFlag, bool) {
+	for _, f := range flags {
+		if match(f) {
+			return f, true
+		}
+	}
+	return restrictedFlag{}, false
+}
+
+// checkRestrictedFlagValue returns an error when the value of a flag would make kubectl read a
+// local file
+func checkRestrictedFlagValue(flag restrictedFlag, value string) error {
+	if flag.name != outputFlag.name {
+		return nil
+	}
+	format := strings.SplitN(value, "=", 2)[0]
+	if !containsString(restrictedOutputFormats, format) {
+		return errors.Errorf("output format %s is not allowed in the restricted shell", format)
+	}
+	return nil
+}
+
+// splitCommandLine splits a line into words the way a shell does for simple commands, with single
+// and double quotes and backslash escapes
+func splitCommandLine(line string) ([]string, error) {
+	words := []string{}
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
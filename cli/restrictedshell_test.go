@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Restricted shell", func() {
+	check := func(line string) error {
+		args, err := splitCommandLine(line)
+		Expect(err).NotTo(HaveOccurred())
+		return checkRestrictedCommand(args, defaultRestrictedCommands)
+	}
+
+	DescribeTable("Allows read-only commands",
+		func(line string) {
+			Expect(check(line)).To(Succeed())
+		},
+		Entry("get", "kubectl get pods -n default -o wide"),
+		Entry("get with combined short flags", "kubectl get pods -Aojson"),
+		Entry("get with a selector", "kubectl get deploy -l 'app in (web)' --show-labels"),
+		Entry("get with a jsonpath", "kubectl get pods -o jsonpath='{.items[*].metadata.name}'"),
+		Entry("get with custom columns", "kubectl get pods --output=custom-columns=NAME:.metadata.name"),
+		Entry("describe", "kubectl describe pod web-0 --namespace default"),
+		Entry("logs", "k logs web-0 -c nginx --tail 10 -f"),
+	)
+
+	DescribeTable("Rejects flags that read local files or change the server",
+		func(line string) {
+			Expect(check(line)).To(HaveOccurred())
+		},
+		Entry("-f", "kubectl get -f pod.yaml"),
+		Entry("--filename", "kubectl get --filename=pod.yaml"),
+		Entry("-k", "kubectl get -k ./overlay"),
+		Entry("--kustomize", "kubectl describe --kustomize ./overlay"),
+		Entry("-o go-template-file", "kubectl get pods -o go-template-file=/etc/passwd"),
+		Entry("-o jsonpath-file", "kubectl get pods -ojsonpath-file=/etc/passwd"),
+		Entry("--output custom-columns-file", "kubectl get pods --output custom-columns-file=/etc/passwd"),
+		Entry("--template", "kubectl get pods -o go-template --template=/etc/passwd"),
+		Entry("-s", "kubectl get pods -s https://example.com"),
+		Entry("-s combined", "kubectl get pods -As https://example.com"),
+		Entry("--kubeconfig", "kubectl get pods --kubeconfig /tmp/config"),
+		Entry("--", "kubectl get -- pods"),
+		Entry("a flag of another command", "kubectl logs web-0 --show-labels"),
+	)
+
+	It("Rejects commands that are not allowed", func() {
+		err := check("kubectl delete pod web-0")
+		Expect(err).To(HaveOccurred())
+		Expect(strings.Contains(err.Error(), "kubectl delete")).To(BeTrue())
+
+		Expect(check("rm -rf /")).To(HaveOccurred())
+		Expect(check("kubectl -n default get pods")).To(HaveOccurred())
+	})
+})
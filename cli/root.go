@@ -1,9 +1,12 @@
 package cli
 
 import (
+	"fmt"
+	"io"
 	"os"
 	"strings"
 
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -14,6 +17,8 @@ func RootCmd() *cobra.Command {
 		Short:        "Run commands against a support bundle",
 		Long:         `Run commands against a support bundle`,
 		SilenceUsage: true,
+		// Errors are printed by InitAndExecute, as JSON when asked for
+		SilenceErrors: true,
 		PreRunE: func(cmd *cobra.Command, args []string) error {
 			return viper.BindPFlags(cmd.Flags())
 		},
@@ -24,8 +29,65 @@ func RootCmd() *cobra.Command {
 		viper.AutomaticEnv()
 	})
 
+	cmd.PersistentFlags().String("timezone", "UTC", "timezone to show timestamps in: UTC, local, or a name such as America/New_York")
+	cmd.PersistentFlags().Bool("latest", false, "when the support bundle location is a directory of bundle archives, use the most recently modified one")
+	cmd.PersistentFlags().String("time-format", "absolute", "show timestamps as absolute times or relative to bundle collection, e.g. 5m ago. One of: absolute, relative")
+	cmd.PersistentFlags().String("color", "auto", "color output of sbctl's own commands: auto, always or never. auto colors terminals unless NO_COLOR is set.")
+	cmd.PersistentFlags().Bool("secure-cleanup", false, "overwrite files extracted or converted from the bundle before removing them on exit, best effort")
+	cmd.PersistentFlags().StringSlice("delta", nil, "bundles collected after the support bundle with only what changed since, oldest first. Their objects shadow older ones of the same name.")
+	cmd.PersistentFlags().Bool("no-index", false, "do not read or save the .sbctl-index file that indexes the bundle next to it")
+
 	cmd.AddCommand(ServeCmd())
 	cmd.AddCommand(ShellCmd())
+	cmd.AddCommand(KubectlCmd())
+	cmd.AddCommand(CollectCmd())
+	cmd.AddCommand(AnalysisCmd())
+	cmd.AddCommand(VeleroCmd())
+	cmd.AddCommand(MeshCmd())
+	cmd.AddCommand(CertManagerCmd())
+	cmd.AddCommand(GitOpsCmd())
+	cmd.AddCommand(ExportCmd())
+	cmd.AddCommand(ReportCmd())
+	cmd.AddCommand(SimulateCmd())
+	cmd.AddCommand(ScheduleExplainCmd())
+	cmd.AddCommand(ResolveCmd())
+	cmd.AddCommand(StorageCmd())
+	cmd.AddCommand(ImagesCmd())
+	cmd.AddCommand(BenchCmd())
+	cmd.AddCommand(OrphansCmd())
+	cmd.AddCommand(CheckCmd())
+	cmd.AddCommand(KubeconfigCmd())
+	cmd.AddCommand(CompletionDataCmd())
+	cmd.AddCommand(NodeConfigCmd())
+	cmd.AddCommand(EtcdCmd())
+	cmd.AddCommand(QuotaCheckCmd())
+	cmd.AddCommand(UpCmd())
+	cmd.AddCommand(DiffLiveCmd())
+	cmd.AddCommand(FindCmd())
+	cmd.AddCommand(LogsCmd())
+	cmd.AddCommand(AuditCmd())
+	cmd.AddCommand(LoginCmd())
+	cmd.AddCommand(LogoutCmd())
+	cmd.AddCommand(BatchCmd())
+	cmd.AddCommand(GetCmd())
+	cmd.AddCommand(TopCmd())
+	cmd.AddCommand(SplitCmd())
+	cmd.AddCommand(MergeCmd())
+	cmd.AddCommand(CloudCmd())
+	cmd.AddCommand(ClustersCmd())
+	cmd.AddCommand(RunbookCmd())
+	cmd.AddCommand(OOMCmd())
+	cmd.AddCommand(CrashLoopsCmd())
+	cmd.AddCommand(PendingCmd())
+	cmd.AddCommand(IngressCmd())
+	cmd.AddCommand(AutoscalingCmd())
+	cmd.AddCommand(WebhooksCmd())
+	cmd.AddCommand(TaintsCmd())
+	cmd.AddCommand(AnalyzeCmd())
+	cmd.AddCommand(ScriptCmd())
+	cmd.AddCommand(HostCmd())
+	cmd.AddCommand(SubmitCmd())
+	cmd.AddCommand(ExtractCmd())
 
 	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
 
@@ -33,7 +95,25 @@ func RootCmd() *cobra.Command {
 }
 
 func InitAndExecute() {
-	if err := RootCmd().Execute(); err != nil {
+	cmd := RootCmd()
+	cmd.SetFlagErrorFunc(func(c *cobra.Command, err error) error {
+		return usererrors.New(usererrors.InvalidArgument, err, "flags")
+	})
+	if err := cmd.Execute(); err != nil {
+		printError(os.Stderr, err)
 		os.Exit(1)
 	}
 }
+
+// printError prints an error as cobra does, or as a JSON object with the code of the error when
+// the output of the command is JSON, so that scripts can classify failures
+func printError(out io.Writer, err error) {
+	if viper.GetString("output") == "json" || viper.GetString("output") == "ndjson" || viper.GetString("format") == "json" {
+		data, jsonErr := usererrors.JSON(err)
+		if jsonErr == nil {
+			fmt.Fprintln(out, string(data))
+			return
+		}
+	}
+	fmt.Fprintln(out, "Error:", err.Error())
+}
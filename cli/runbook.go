@@ -0,0 +1,139 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/output"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func RunbookCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "runbook",
+		Short: "Run vendor-defined triage runbooks against a support bundle",
+	}
+	cmd.AddCommand(runbookRunCmd())
+	return cmd
+}
+
+func runbookRunCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "run <runbook.yaml>",
+		Short: "Run the steps of a runbook against a support bundle",
+		Long: `Run the steps of a runbook against a support bundle.
+
+Runbooks are YAML files vendors ship with their product to guide triage. Steps run in order, and
+each is one of:
+  query     select objects of a resource, and extract a value of each with a JSONPath
+  assert    check the number or values of the result of an earlier step
+  logs      extract lines matching a pattern from pod logs, with context
+  message   render a Go template, e.g. {{ (step "velero-pods").Count }}
+Steps with when only run when their template renders to true. The command fails when an
+assert fails.`,
+		Example:       `  sbctl runbook run ./velero-runbook.yaml -s ./support-bundle.tar.gz`,
+		Args:          cobra.ExactArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			format := v.GetString("format")
+			if format != "text" && format != "json" {
+				return usererrors.New(usererrors.InvalidArgument, errors.Errorf("unsupported format %q, must be one of: text, json", format), "--format")
+			}
+
+			runbook, err := sbctl.LoadRunbook(args[0])
+			if err != nil {
+				return err
+			}
+
+			clusterData, cleanup, err := loadClusterData(v)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			results, err := sbctl.RunRunbook(clusterData, runbook)
+			if err != nil {
+				return err
+			}
+
+			if format == "json" {
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				if err := encoder.Encode(results); err != nil {
+					return errors.Wrap(err, "failed to write results")
+				}
+			} else {
+				p, err := newPrinter(os.Stdout)
+				if err != nil {
+					return err
+				}
+				printRunbookResults(p, runbook, results)
+			}
+
+			failed := 0
+			for _, r := range results {
+				if r.Failed {
+					failed++
+				}
+			}
+			if failed > 0 {
+				return errors.Errorf("%d of the runbook's assertions failed", failed)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	cmd.Flags().String("format", "text", "output format. One of: text, json")
+	return cmd
+}
+
+func printRunbookResults(p *output.Printer, runbook *sbctl.Runbook, results []sbctl.RunbookStepResult) {
+	out := p.Writer()
+	fmt.Fprintln(out, p.Bold(runbook.Name))
+	if runbook.Description != "" {
+		fmt.Fprintln(out, runbook.Description)
+	}
+	fmt.Fprintln(out)
+
+	for _, r := range results {
+		switch {
+		case r.Skipped:
+			fmt.Fprintf(out, "%s %s\n", p.Faint("SKIP"), r.Name)
+			continue
+		case r.Type == sbctl.RunbookStepMessage:
+			fmt.Fprintln(out, r.Message)
+			continue
+		case r.Failed:
+			fmt.Fprintf(out, "%s %s\n", p.Red("FAIL"), r.Name)
+		case r.Type == sbctl.RunbookStepAssert:
+			fmt.Fprintf(out, "%s %s\n", p.Green("PASS"), r.Name)
+		case r.Type == sbctl.RunbookStepQuery:
+			fmt.Fprintf(out, "     %s: %d objects\n", r.Name, r.Count)
+		case r.Type == sbctl.RunbookStepLogs:
+			fmt.Fprintf(out, "     %s: %d matching lines\n", r.Name, r.Count)
+		}
+
+		if r.Message != "" {
+			for _, line := range strings.Split(r.Message, "\n") {
+				fmt.Fprintf(out, "     %s\n", line)
+			}
+		}
+		for _, line := range r.Lines {
+			fmt.Fprintf(out, "     %s\n", p.Faint(line))
+		}
+	}
+}
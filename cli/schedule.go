@@ -0,0 +1,189 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+)
+
+type nodeFit struct {
+	Node       corev1.Node
+	CPUFree    string
+	MemoryFree string
+	Reasons    []string
+	// Summaries are the reasons in the short form the scheduler uses in FailedScheduling events
+	Summaries []string
+}
+
+func ScheduleExplainCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "schedule-explain pod/<name>",
+		Short: "Explain why a pod can or cannot be scheduled on the nodes in a support bundle",
+		Long: `Explain why a pod can or cannot be scheduled on the nodes in a support bundle.
+
+Every node is checked against the pod's node selector, required node affinity, tolerations and
+resource requests, the filters that most often keep pods Pending. The scheduler's own condition and
+FailedScheduling events for the pod are shown when the bundle has them. Pod affinity, topology
+spread and volume constraints are not evaluated.`,
+		Args:          cobra.ExactArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			podName, err := parseObjectArg(args[0], "pods")
+			if err != nil {
+				return err
+			}
+			namespace := v.GetString("namespace")
+
+			clusterData, cleanup, err := loadClusterData(v)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			nodes, err := sbctl.ListTypedResources[corev1.Node](clusterData, "", "nodes")
+			if err != nil {
+				return errors.Wrap(err, "failed to list nodes")
+			}
+			pods, err := sbctl.ListTypedResources[corev1.Pod](clusterData, "", "pods")
+			if err != nil {
+				return errors.Wrap(err, "failed to list pods")
+			}
+			events, err := sbctl.ListResources(clusterData, "", "events")
+			if err != nil {
+				return errors.Wrap(err, "failed to list events")
+			}
+
+			var pod *corev1.Pod
+			others := []corev1.Pod{}
+			for i := range pods {
+				if pods[i].Namespace == namespace && pods[i].Name == podName {
+					pod = &pods[i]
+					continue
+				}
+				others = append(others, pods[i])
+			}
+			if pod == nil {
+				return errors.Errorf("pod %s/%s not found in support bundle", namespace, podName)
+			}
+
+			out := os.Stdout
+			if pod.Spec.NodeName != "" {
+				fmt.Fprintf(out, "Pod %s/%s is scheduled on node %s (phase %s)\n", pod.Namespace, pod.Name, pod.Spec.NodeName, pod.Status.Phase)
+			} else {
+				fmt.Fprintf(out, "Pod %s/%s is not scheduled (phase %s)\n", pod.Namespace, pod.Name, pod.Status.Phase)
+			}
+			for _, c := range pod.Status.Conditions {
+				if c.Type == corev1.PodScheduled && c.Status != corev1.ConditionTrue {
+					fmt.Fprintf(out, "Scheduler condition: %s: %s\n", c.Reason, c.Message)
+				}
+			}
+			for _, m := range warningEventMessages(events, "Pod", pod.Namespace, pod.Name) {
+				fmt.Fprintf(out, "Warning %s\n", m)
+			}
+
+			requests := podRequests(*pod)
+			fmt.Fprintf(out, "Requests: cpu %s, memory %s\n\n", formatQuantity(requests, corev1.ResourceCPU), formatQuantity(requests, corev1.ResourceMemory))
+
+			// The pod's own requests are not counted on the node it is bound to, so that it is evaluated like a new pod
+			resources := newNodeResources(nodes, others)
+			fits := []nodeFit{}
+			for _, n := range nodes {
+				fits = append(fits, explainNodeFit(*pod, requests, resources[n.Name]))
+			}
+			sort.Slice(fits, func(i, j int) bool {
+				return fits[i].Node.Name < fits[j].Node.Name
+			})
+
+			printNodeFits(out, fits)
+
+			available := 0
+			summaries := map[string]int{}
+			for _, f := range fits {
+				if len(f.Reasons) == 0 {
+					available++
+				}
+				for _, s := range f.Summaries {
+					summaries[s]++
+				}
+			}
+			fmt.Fprintf(out, "\n%d/%d nodes are available%s\n", available, len(fits), formatReasonCounts(summaries))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	cmd.Flags().StringP("namespace", "n", "default", "namespace of the pod")
+	return cmd
+}
+
+// explainNodeFit runs the pod through the scheduler filters sbctl can evaluate offline. Unlike the scheduler,
+// it does not stop at the first failing filter, so that every problem with a node is reported at once.
+func explainNodeFit(pod corev1.Pod, requests corev1.ResourceList, n *nodeResources) nodeFit {
+	f := nodeFit{
+		Node:       n.Node,
+		CPUFree:    n.free(corev1.ResourceCPU),
+		MemoryFree: n.free(corev1.ResourceMemory),
+		Reasons:    []string{},
+		Summaries:  []string{},
+	}
+	add := func(reason string, summary string) {
+		f.Reasons = append(f.Reasons, reason)
+		f.Summaries = append(f.Summaries, summary)
+	}
+
+	if n.Node.Spec.Unschedulable && !toleratesUnschedulable(pod) {
+		add("node is cordoned", "node(s) were unschedulable")
+	}
+	if reason := nodeSelectorMismatch(pod, n.Node); reason != "" {
+		add(reason, "node(s) didn't match Pod's node affinity/selector")
+	}
+	// Cordoned nodes also carry the unschedulable taint, which is reported above
+	if taint := untoleratedTaint(pod, n.Node); taint != nil && !(taint.Key == corev1.TaintNodeUnschedulable && n.Node.Spec.Unschedulable) {
+		add(fmt.Sprintf("untolerated taint %s", taint.ToString()), fmt.Sprintf("node(s) had untolerated taint {%s}", taint.ToString()))
+	}
+	for _, r := range n.insufficientResources(requests) {
+		add(r, strings.SplitN(r, " (", 2)[0])
+	}
+
+	return f
+}
+
+func toleratesUnschedulable(pod corev1.Pod) bool {
+	taint := &corev1.Taint{Key: corev1.TaintNodeUnschedulable, Effect: corev1.TaintEffectNoSchedule}
+	for _, t := range pod.Spec.Tolerations {
+		if t.ToleratesTaint(taint) {
+			return true
+		}
+	}
+	return false
+}
+
+func printNodeFits(out io.Writer, fits []nodeFit) {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "NODE\tREADY\tCPU FREE\tMEMORY FREE\tRESULT")
+	for _, f := range fits {
+		result := "fits"
+		if len(f.Reasons) > 0 {
+			result = strings.Join(f.Reasons, "; ")
+		}
+		fmt.Fprintf(w, "%s\t%t\t%s\t%s\t%s\n", f.Node.Name, isNodeReady(f.Node), f.CPUFree, f.MemoryFree, result)
+	}
+}
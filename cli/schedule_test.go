@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("Schedule explain", func() {
+	var nodes []corev1.Node
+	var pod corev1.Pod
+	var others []corev1.Pod
+
+	BeforeEach(func() {
+		clusterData := testBundleData()
+		var err error
+		nodes, err = sbctl.ListTypedResources[corev1.Node](clusterData, "", "nodes")
+		Expect(err).NotTo(HaveOccurred())
+		pods, err := sbctl.ListTypedResources[corev1.Pod](clusterData, "", "pods")
+		Expect(err).NotTo(HaveOccurred())
+
+		others = []corev1.Pod{}
+		for _, p := range pods {
+			if p.Namespace == "velero" && p.Name == "velero-6796549f-5j2vv" {
+				pod = p
+				continue
+			}
+			others = append(others, p)
+		}
+		Expect(pod.Spec.NodeName).To(Equal("troubleshoot-demo-003"))
+	})
+
+	explain := func() []nodeFit {
+		resources := newNodeResources(nodes, others)
+		fits := []nodeFit{}
+		for _, n := range nodes {
+			fits = append(fits, explainNodeFit(pod, podRequests(pod), resources[n.Name]))
+		}
+		return fits
+	}
+
+	It("Accepts pod arguments with any name of the pods resource", func() {
+		for _, arg := range []string{"velero-6796549f-5j2vv", "pod/velero-6796549f-5j2vv", "po/velero-6796549f-5j2vv", "pods/velero-6796549f-5j2vv"} {
+			Expect(parseObjectArg(arg, "pods")).To(Equal("velero-6796549f-5j2vv"))
+		}
+		_, err := parseObjectArg("deploy/velero", "pods")
+		Expect(err).To(MatchError(`expected pod/<name>, got "deploy/velero"`))
+	})
+
+	It("Fits a scheduled pod on every node, without counting its own requests", func() {
+		fits := explain()
+		Expect(fits).To(HaveLen(3))
+		for _, f := range fits {
+			Expect(f.Reasons).To(BeEmpty(), f.Node.Name)
+		}
+		Expect(fits[2].Node.Name).To(Equal("troubleshoot-demo-003"))
+		Expect(fits[2].CPUFree).To(Equal("2410m"))
+
+		out := bytes.Buffer{}
+		printNodeFits(&out, fits)
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		Expect(lines).To(HaveLen(4))
+		Expect(strings.Fields(lines[0])).To(Equal([]string{"NODE", "READY", "CPU", "FREE", "MEMORY", "FREE", "RESULT"}))
+		Expect(strings.Fields(lines[3])).To(ContainElements("troubleshoot-demo-003", "true", "2410m", "fits"))
+	})
+
+	It("Reports every filter a node fails", func() {
+		nodes[0].Spec.Unschedulable = true
+		nodes[0].Spec.Taints = []corev1.Taint{{Key: corev1.TaintNodeUnschedulable, Effect: corev1.TaintEffectNoSchedule}}
+		nodes[1].Spec.Taints = []corev1.Taint{{Key: "dedicated", Value: "db", Effect: corev1.TaintEffectNoSchedule}}
+		pod.Spec.NodeSelector = map[string]string{"kubernetes.io/hostname": "troubleshoot-demo-003"}
+		pod.Spec.Containers[0].Resources.Requests = resourceList("cpu", "3")
+
+		fits := explain()
+		Expect(fits[0].Reasons).To(Equal([]string{
+			"node is cordoned",
+			"node selector kubernetes.io/hostname=troubleshoot-demo-003 does not match",
+			"Insufficient cpu (requested 3, 1460m free)",
+		}))
+		Expect(fits[1].Reasons).To(Equal([]string{
+			"node selector kubernetes.io/hostname=troubleshoot-demo-003 does not match",
+			"untolerated taint dedicated=db:NoSchedule",
+			"Insufficient cpu (requested 3, 1910m free)",
+		}))
+		Expect(fits[1].Summaries).To(Equal([]string{
+			"node(s) didn't match Pod's node affinity/selector",
+			"node(s) had untolerated taint {dedicated=db:NoSchedule}",
+			"Insufficient cpu",
+		}))
+		Expect(fits[2].Reasons).To(Equal([]string{"Insufficient cpu (requested 3, 2410m free)"}))
+		Expect(fits[2].Summaries).To(Equal([]string{"Insufficient cpu"}))
+	})
+})
@@ -0,0 +1,295 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// nodeResources tracks what is requested on a node compared to what it can allocate,
+// the same way the scheduler's resource fit check does
+type nodeResources struct {
+	Node        corev1.Node
+	Allocatable corev1.ResourceList
+	Requested   corev1.ResourceList
+	PodCount    int64
+}
+
+func newNodeResources(nodes []corev1.Node, pods []corev1.Pod) map[string]*nodeResources {
+	result := map[string]*nodeResources{}
+	for _, n := range nodes {
+		result[n.Name] = &nodeResources{
+			Node:        n,
+			Allocatable: n.Status.Allocatable,
+			Requested:   corev1.ResourceList{},
+		}
+	}
+
+	for _, p := range pods {
+		n, ok := result[p.Spec.NodeName]
+		if !ok || isTerminatedPod(p) {
+			continue
+		}
+		n.add(podRequests(p))
+	}
+
+	return result
+}
+
+func (n *nodeResources) add(requests corev1.ResourceList) {
+	for name, q := range requests {
+		total := n.Requested[name]
+		total.Add(q)
+		n.Requested[name] = total
+	}
+	n.PodCount++
+}
+
+// insufficientResources returns the resources the node does not have enough of to run a pod with requests
+func (n *nodeResources) insufficientResources(requests corev1.ResourceList) []string {
+	insufficient := []string{}
+
+	if maxPods, ok := n.Allocatable[corev1.ResourcePods]; ok && n.PodCount+1 > maxPods.Value() {
+		insufficient = append(insufficient, "Too many pods")
+	}
+
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory, corev1.ResourceEphemeralStorage} {
+		requested, ok := requests[name]
+		if !ok || requested.IsZero() {
+			continue
+		}
+		allocatable, ok := n.Allocatable[name]
+		if !ok {
+			continue
+		}
+		free := allocatable.DeepCopy()
+		free.Sub(n.Requested[name])
+		if requested.Cmp(free) > 0 {
+			insufficient = append(insufficient, fmt.Sprintf("Insufficient %s (requested %s, %s free)", name, requested.String(), free.String()))
+		}
+	}
+
+	return insufficient
+}
+
+// free returns the allocatable amount of a resource that is not requested by pods on the node
+func (n *nodeResources) free(name corev1.ResourceName) string {
+	allocatable, ok := n.Allocatable[name]
+	if !ok {
+		return "<none>"
+	}
+	free := allocatable.DeepCopy()
+	free.Sub(n.Requested[name])
+	return free.String()
+}
+
+// podRequests returns the effective CPU, memory and ephemeral storage requests of a pod. Init containers
+// run one at a time before the regular containers, so the largest init container request counts if it is bigger.
+func podRequests(pod corev1.Pod) corev1.ResourceList {
+	requests := corev1.ResourceList{}
+	for _, c := range pod.Spec.Containers {
+		for name, q := range c.Resources.Requests {
+			total := requests[name]
+			total.Add(q)
+			requests[name] = total
+		}
+	}
+
+	for _, c := range pod.Spec.InitContainers {
+		for name, q := range c.Resources.Requests {
+			if current, ok := requests[name]; !ok || q.Cmp(current) > 0 {
+				requests[name] = q.DeepCopy()
+			}
+		}
+	}
+
+	for name, q := range pod.Spec.Overhead {
+		total := requests[name]
+		total.Add(q)
+		requests[name] = total
+	}
+
+	return requests
+}
+
+func formatQuantity(list corev1.ResourceList, name corev1.ResourceName) string {
+	q, ok := list[name]
+	if !ok {
+		return "0"
+	}
+	return q.String()
+}
+
+func isTerminatedPod(pod corev1.Pod) bool {
+	return pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed
+}
+
+func isDaemonSetPod(pod corev1.Pod) bool {
+	for _, o := range pod.OwnerReferences {
+		if o.Kind == "DaemonSet" {
+			return true
+		}
+	}
+	return false
+}
+
+func isMirrorPod(pod corev1.Pod) bool {
+	_, ok := pod.Annotations[corev1.MirrorPodAnnotationKey]
+	return ok
+}
+
+func isNodeReady(node corev1.Node) bool {
+	for _, c := range node.Status.Conditions {
+		if c.Type == corev1.NodeReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func isPodReady(pod corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// untoleratedTaint returns the first taint of the node that keeps the pod from being scheduled on it
+func untoleratedTaint(pod corev1.Pod, node corev1.Node) *corev1.Taint {
+	for i := range node.Spec.Taints {
+		taint := &node.Spec.Taints[i]
+		if taint.Effect == corev1.TaintEffectPreferNoSchedule {
+			continue
+		}
+		tolerated := false
+		for _, t := range pod.Spec.Tolerations {
+			if t.ToleratesTaint(taint) {
+				tolerated = true
+				break
+			}
+		}
+		if !tolerated {
+			return taint
+		}
+	}
+	return nil
+}
+
+// nodeSelectorMismatch explains why the node does not match the pod's node selector or required
+// node affinity. An empty string means the node matches.
+func nodeSelectorMismatch(pod corev1.Pod, node corev1.Node) string {
+	for k, v := range pod.Spec.NodeSelector {
+		if actual, ok := node.Labels[k]; !ok || actual != v {
+			return fmt.Sprintf("node selector %s=%s does not match", k, v)
+		}
+	}
+
+	affinity := pod.Spec.Affinity
+	if affinity == nil || affinity.NodeAffinity == nil || affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return ""
+	}
+
+	terms := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	for _, term := range terms {
+		if nodeSelectorTermMatches(term, node) {
+			return ""
+		}
+	}
+
+	descriptions := []string{}
+	for _, term := range terms {
+		descriptions = append(descriptions, describeNodeSelectorTerm(term))
+	}
+	return fmt.Sprintf("required node affinity does not match: %s", strings.Join(descriptions, " or "))
+}
+
+// nodeSelectorTermMatches matches all expressions of a term, which is how required node affinity is evaluated
+func nodeSelectorTermMatches(term corev1.NodeSelectorTerm, node corev1.Node) bool {
+	if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+		return false
+	}
+
+	selector := labels.NewSelector()
+	for _, e := range term.MatchExpressions {
+		r, err := nodeSelectorRequirement(e)
+		if err != nil {
+			return false
+		}
+		selector = selector.Add(*r)
+	}
+	if !selector.Matches(labels.Set(node.Labels)) {
+		return false
+	}
+
+	// metadata.name is the only supported field
+	for _, f := range term.MatchFields {
+		r, err := nodeSelectorRequirement(f)
+		if err != nil || f.Key != "metadata.name" {
+			return false
+		}
+		if !r.Matches(labels.Set{f.Key: node.Name}) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func nodeSelectorRequirement(e corev1.NodeSelectorRequirement) (*labels.Requirement, error) {
+	var op selection.Operator
+	switch e.Operator {
+	case corev1.NodeSelectorOpIn:
+		op = selection.In
+	case corev1.NodeSelectorOpNotIn:
+		op = selection.NotIn
+	case corev1.NodeSelectorOpExists:
+		op = selection.Exists
+	case corev1.NodeSelectorOpDoesNotExist:
+		op = selection.DoesNotExist
+	case corev1.NodeSelectorOpGt:
+		op = selection.GreaterThan
+	case corev1.NodeSelectorOpLt:
+		op = selection.LessThan
+	default:
+		return nil, errors.Errorf("unknown operator %q", e.Operator)
+	}
+	return labels.NewRequirement(e.Key, op, e.Values)
+}
+
+func describeNodeSelectorTerm(term corev1.NodeSelectorTerm) string {
+	parts := []string{}
+	for _, e := range append(append([]corev1.NodeSelectorRequirement{}, term.MatchExpressions...), term.MatchFields...) {
+		if len(e.Values) == 0 {
+			parts = append(parts, fmt.Sprintf("%s %s", e.Key, e.Operator))
+		} else {
+			parts = append(parts, fmt.Sprintf("%s %s [%s]", e.Key, e.Operator, strings.Join(e.Values, ",")))
+		}
+	}
+	return fmt.Sprintf("{%s}", strings.Join(parts, ", "))
+}
+
+// parseObjectArg accepts both "kind/name" and "name" arguments, like kubectl. kind can be any
+// name of resource, such as po, pod or pods for pods.
+func parseObjectArg(arg string, resource string) (string, error) {
+	parts := strings.SplitN(arg, "/", 2)
+	if len(parts) == 1 {
+		return arg, nil
+	}
+	mapper := sbctl.DefaultRESTMapper()
+	if gvr, err := mapper.ResourceFor(parts[0]); err != nil || gvr.Resource != resource {
+		kind := resource
+		if gvk, err := mapper.KindFor(schema.GroupVersionResource{Resource: resource}); err == nil {
+			kind = strings.ToLower(gvk.Kind)
+		}
+		return "", errors.Errorf("expected %s/<name>, got %q", kind, arg)
+	}
+	return parts[1], nil
+}
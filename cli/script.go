@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/script"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func ScriptCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "script [script file] [args...]",
+		Short: "Run a Starlark script against a support bundle",
+		Long: `Run a Starlark script against a support bundle, for analyses too ad-hoc to be written as
+analyzers but too complex for jq.
+
+Scripts can call these functions to query the bundle:
+
+  list(resource, namespace="")        objects of a resource, e.g. "pods" or "deployments.apps"
+  get(resource, name, namespace="")   an object, or None when it is not in the bundle
+  logs(pod, namespace="default", container="", previous=False, tail=-1)
+                                      lines of a container's log
+  events(namespace="", kind="", name="")
+                                      events, optionally only the ones about an object
+
+Objects are dicts in the form of their JSON. Arguments after the script file are available as
+the args list. The script is read from stdin when the file is "-".`,
+		Example: `  sbctl script -s ./support-bundle.tar.gz ./triage.star
+  sbctl script -s ./support-bundle.tar.gz ./restarts.star kube-system`,
+		Args:          cobra.MinimumNArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			fileName := args[0]
+			var src []byte
+			var err error
+			if fileName == "-" {
+				fileName = "<stdin>"
+				src, err = io.ReadAll(os.Stdin)
+			} else {
+				src, err = os.ReadFile(fileName)
+			}
+			if err != nil {
+				return errors.Wrap(err, "failed to read script")
+			}
+
+			clusterData, cleanup, err := loadClusterData(v)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			runner, err := script.NewRunner(clusterData, os.Stdout)
+			if err != nil {
+				return err
+			}
+			return runner.Run(fileName, src, args[1:])
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	return cmd
+}
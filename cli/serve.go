@@ -4,25 +4,43 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
 	"path"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/replicatedhq/sbctl/pkg/api"
 	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 func ServeCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:           "serve",
-		Short:         "Start API server",
-		Long:          `Start API server`,
+		Use:   "serve [bundle]",
+		Short: "Start API server",
+		Long: `Start API server
+
+When serving a directory, files are read as they change, so a bundle can be served while
+support-bundle is still collecting it. Resources appear as their collectors finish.
+
+Bundles collected from several clusters, e.g. a management cluster with a directory of
+cluster-resources for each workload cluster, are served with a kubeconfig context per cluster.
+Run sbctl clusters to list them.
+
+The server does not need a terminal and runs until it is interrupted or gets SIGTERM, so it can
+run in CI jobs or as a service. --address, --port and --kubeconfig-out make its address and
+kubeconfig predictable for the tools pointed at it.`,
+		Example: `  sbctl serve bundle.tar.gz
+  sbctl serve bundle.tar.gz --address 0.0.0.0 --port 6443 --kubeconfig-out ./kubeconfig`,
+		Args:          cobra.MaximumNArgs(1),
 		SilenceUsage:  true,
 		SilenceErrors: false,
 		PreRunE: func(cmd *cobra.Command, args []string) error {
@@ -30,89 +48,196 @@ func ServeCmd() *cobra.Command {
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			var kubeConfig string
+			var instanceFile string
+			var readyFile string
+			var viewKubeConfigs []string
 			var bundleDir string
+			var convertedDir string
 			deleteBundleDir := false
+			var err error
 
 			go func() {
 				signalChan := make(chan os.Signal, 1)
-				signal.Notify(signalChan, os.Interrupt)
+				// Services and CI jobs stop the server with SIGTERM
+				signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
 				<-signalChan
 				if kubeConfig != "" {
 					_ = os.RemoveAll(kubeConfig)
 				}
+				if instanceFile != "" {
+					_ = os.RemoveAll(instanceFile)
+				}
+				if readyFile != "" {
+					_ = os.RemoveAll(readyFile)
+				}
+				for _, fileName := range viewKubeConfigs {
+					_ = os.RemoveAll(fileName)
+				}
 				if deleteBundleDir && bundleDir != "" {
-					os.RemoveAll(bundleDir)
+					_ = removeBundleData(bundleDir)
 				}
+				if convertedDir != "" {
+					_ = removeBundleData(convertedDir)
+				}
+				api.CloseListeners()
+				printUnservedSummary(os.Stdout)
 				os.Exit(0)
 			}()
 
 			v := viper.GetViper()
+			if len(args) == 1 {
+				v.Set("support-bundle-location", args[0])
+			}
 
-			// This only works with generated config, so let's make sure we don't mess up user's real files.
-			bundleLocation := v.GetString("support-bundle-location")
-			if bundleLocation == "" {
-				return errors.New("support-bundle-location is required")
+			// A file left by an earlier run must not signal that this one is ready
+			readyFile = v.GetString("ready-file")
+			if readyFile != "" {
+				_ = os.RemoveAll(readyFile)
 			}
 
-			if strings.HasPrefix(bundleLocation, "http") {
-				token := v.GetString("token")
-				if token == "" {
-					return errors.New("token is required when downloading bundle")
-				}
+			// This only works with generated config, so let's make sure we don't mess up user's real files.
+			bundleDir, deleteBundleDir, err = getBundleDir(v.GetString("support-bundle-location"), v.GetString("token"))
+			if err != nil {
+				return err
+			}
+			bundleDir, deleteBundleDir, err = overlayDeltas(bundleDir, deleteBundleDir, v.GetString("token"))
+			if err != nil {
+				return err
+			}
+			if deleteBundleDir {
+				defer removeBundleData(bundleDir)
+			}
 
-				fmt.Printf("Downloading bundle\n")
+			clusterData, convertedDir, err := getClusterData(bundleDir)
+			if err != nil {
+				return err
+			}
+			defer removeBundleData(convertedDir)
 
-				dir, err := downloadAndExtractBundle(bundleLocation, token)
-				if err != nil {
-					return errors.Wrap(err, "failed to stat input path")
-				}
-				bundleDir = dir
-				deleteBundleDir = true
+			if !deleteBundleDir && clusterData.ClusterResourcesDir == "" && clusterData.SupportBundleKitDir == "" {
+				fmt.Printf("No cluster resources found yet, serving %s as it is collected\n", bundleDir)
+				clusterData = streamingClusterData(bundleDir)
 			} else {
-				fileInfo, err := os.Stat(bundleLocation)
+				clusterData = indexClusterData(v.GetString("support-bundle-location"), deleteBundleDir, clusterData)
+			}
+			printCollectorErrors(os.Stdout, clusterData)
+
+			clusters, err := fleetClusters(clusterData)
+			if err != nil {
+				return err
+			}
+
+			if address := v.GetString("pprof"); address != "" {
+				pprofAddress, err := api.StartPprofServer(address)
 				if err != nil {
-					return errors.Wrap(err, "failed to stat input path")
+					return errors.Wrap(err, "failed to start pprof server")
 				}
+				fmt.Printf("Profiles are served at http://%s/debug/pprof/\n", pprofAddress)
+			}
 
-				bundleDir = bundleLocation
-				if !fileInfo.IsDir() {
-					deleteBundleDir = true
-					bundleDir, err = os.MkdirTemp("", "sbctl-")
-					if err != nil {
-						return errors.Wrap(err, "failed to create temp dir")
-					}
+			if err := api.LoadPrinterPlugins(v.GetStringSlice("printer-plugin")); err != nil {
+				return err
+			}
+
+			views, err := loadViews(v)
+			if err != nil {
+				return errors.Wrap(err, "failed to load views")
+			}
 
-					err = sbctl.ExtractBundle(bundleLocation, bundleDir)
+			source := api.NewClusterDataSource(clusterData)
+			if !deleteBundleDir && v.GetBool("reload") && len(clusters) < 2 {
+				go watchBundleDir(bundleDir, time.Second, func() error {
+					updated, err := refreshClusterData(bundleDir, source.Get(), convertedDir)
 					if err != nil {
-						return errors.Wrap(err, "failed to extract bundle")
+						return err
 					}
-				}
+					source.Set(updated)
+					return nil
+				})
 			}
 
-			clusterData, err := sbctl.FindClusterData(bundleDir)
+			if len(clusters) > 1 {
+				kubeConfig, err = api.StartFleetAPIServer(clusters, os.Stderr)
+			} else {
+				kubeConfig, err = api.StartAPIServerFromSource(source, os.Stderr)
+			}
 			if err != nil {
-				return errors.Wrap(err, "failed to find cluster data")
+				return usererrors.New(usererrors.ServerStartFailed, err)
 			}
+			defer os.RemoveAll(kubeConfig)
+			defer api.CloseListeners()
 
-			kubeConfig, err = api.StartAPIServer(clusterData, os.Stderr)
+			instanceFile, err = registerInstance(v.GetString("support-bundle-location"), kubeConfig)
 			if err != nil {
-				return errors.Wrap(err, "failed to create api server")
+				fmt.Fprintf(os.Stderr, "Failed to record the running server: %v\n", err)
+			}
+			defer os.RemoveAll(instanceFile)
 
+			viewKubeConfigs, err = writeViewKubeConfigs(kubeConfig, views)
+			defer func() {
+				for _, fileName := range viewKubeConfigs {
+					_ = os.RemoveAll(fileName)
+				}
+			}()
+			if err != nil {
+				return err
+			}
+
+			if readyFile != "" {
+				go writeReadyFileWhenReady(readyFile, kubeConfig, 250*time.Millisecond)
+				defer os.RemoveAll(readyFile)
+			}
+
+			if ip := net.ParseIP(v.GetString("address")); ip != nil && !ip.IsLoopback() && len(views) == 0 {
+				fmt.Fprintf(os.Stderr, "Warning: the API server is reachable from other hosts on %s, and anyone who can reach it can read the bundle. Use --views to require tokens.\n", v.GetString("address"))
 			}
-			defer os.RemoveAll(kubeConfig)
 
 			fmt.Printf("Server is running\n\n")
 			fmt.Printf("export KUBECONFIG=%s\n\n", kubeConfig)
+			if len(clusters) > 1 {
+				fmt.Printf("The bundle has %d clusters, select one with kubectl --context:\n", len(clusters))
+				for _, c := range clusters {
+					fmt.Printf("  %s\n", c.Name)
+				}
+				fmt.Println()
+			}
+			for _, u := range api.ListenURLs() {
+				fmt.Printf("Also serving on %s\n", u)
+			}
+			for i, view := range views {
+				fmt.Printf("View %s: export KUBECONFIG=%s\n", view.Name, viewKubeConfigs[i])
+			}
 
-			<-make(chan struct{})
+			ttl := v.GetDuration("ttl")
+			<-idleTimeout(ttl)
 
+			fmt.Printf("No requests for %s, stopping the server\n", ttl)
+			printUnservedSummary(os.Stdout)
 			return nil
 		},
 	}
 
 	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
 	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	cmd.Flags().String("address", "127.0.0.1", "IP address for the API server to listen on, e.g. 0.0.0.0 for all interfaces")
+	cmd.Flags().Int("port", 0, "port for the API server to listen on. A random free port is used by default.")
+	cmd.Flags().String("kubeconfig-out", "", "file to write the kubeconfig to instead of a temp file. It is removed on exit.")
+	cmd.Flags().String("ready-file", "", "file to create once the API server is ready to answer queries. It contains the kubeconfig path and is removed on exit.")
 	cmd.Flags().Bool("debug", false, "enable debug logging. This will include HTTP response bodies in logs.")
+	cmd.Flags().String("max-response-size", "256Mi", "largest API response to send, e.g. 64Mi. Larger lists must be paged. Set to 0 to disable.")
+	cmd.Flags().Bool("disable-compression", false, "do not gzip large API responses")
+	cmd.Flags().Bool("no-aggregate", false, "list every collected event rather than combining repeated events about the same object and reason")
+	cmd.Flags().Duration("request-timeout", 0, "longest time to spend on an API request, unless the client asks for another timeout. 0 means no limit.")
+	cmd.Flags().String("usage-report", "", "opt in to recording which resources sbctl could not serve, without names or namespaces, in this JSON file")
+	cmd.Flags().String("views", "", "YAML file of views restricting tokens to some namespaces and resources. The generated kubeconfigs of views can be shared.")
+	cmd.Flags().StringSlice("printer-plugin", nil, "Go plugin registering table printers for custom resources. Can be repeated.")
+	cmd.Flags().String("pprof", "", "address to serve net/http/pprof profiles on, e.g. localhost:6060. Disabled by default.")
+	cmd.Flags().Bool("reload", true, "reload the bundle when files change. Only applies when serving a directory.")
+	cmd.Flags().StringSlice("listen", nil, "additional addresses to serve the API on, e.g. unix:///tmp/sbctl.sock or https://127.0.0.1:8443. Can be repeated.")
+	cmd.Flags().String("tls-cert-file", "", "certificate for https listeners. A self-signed certificate is generated when not set.")
+	cmd.Flags().String("tls-private-key-file", "", "private key of --tls-cert-file")
+	cmd.Flags().Bool("serve-files", false, "also serve the files of the bundle under /files/ with directory listings, to browse and download them")
+	cmd.Flags().Duration("ttl", 0, "stop the server and remove its temporary files after this long without requests, e.g. 4h. 0 means never.")
 	return cmd
 }
 
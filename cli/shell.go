@@ -6,13 +6,13 @@ import (
 	"os"
 	"os/exec"
 	"os/signal"
-	"strings"
 	"syscall"
+	"time"
 
 	"github.com/creack/pty"
 	"github.com/pkg/errors"
 	"github.com/replicatedhq/sbctl/pkg/api"
-	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -21,9 +21,10 @@ import (
 
 func ShellCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:           "shell",
+		Use:           "shell [bundle]",
 		Short:         "Start interractive shell",
 		Long:          `Start interractive shell`,
+		Args:          cobra.MaximumNArgs(1),
 		SilenceUsage:  true,
 		SilenceErrors: false,
 		PreRunE: func(cmd *cobra.Command, args []string) error {
@@ -31,7 +32,11 @@ func ShellCmd() *cobra.Command {
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			var kubeConfig string
+			var instanceFile string
+			var readyFile string
+			var viewKubeConfigs []string
 			var bundleDir string
+			var convertedDir string
 			deleteBundleDir := false
 
 			logOutput := os.Stderr
@@ -51,65 +56,105 @@ func ShellCmd() *cobra.Command {
 				if kubeConfig != "" {
 					_ = os.RemoveAll(kubeConfig)
 				}
+				if instanceFile != "" {
+					_ = os.RemoveAll(instanceFile)
+				}
+				if readyFile != "" {
+					_ = os.RemoveAll(readyFile)
+				}
+				for _, fileName := range viewKubeConfigs {
+					_ = os.RemoveAll(fileName)
+				}
 				if deleteBundleDir && bundleDir != "" {
-					_ = os.RemoveAll(bundleDir)
+					_ = removeBundleData(bundleDir)
+				}
+				if convertedDir != "" {
+					_ = removeBundleData(convertedDir)
 				}
 				os.Exit(0)
 			}()
 
 			v := viper.GetViper()
+			if len(args) == 1 {
+				v.Set("support-bundle-location", args[0])
+			}
 
-			// This only works with generated config, so let's make sure we don't mess up user's real files.
-			bundleLocation := v.GetString("support-bundle-location")
-			if bundleLocation == "" {
-				return errors.New("support-bundle-location is required")
+			// A file left by an earlier run must not signal that this one is ready
+			readyFile = v.GetString("ready-file")
+			if readyFile != "" {
+				_ = os.RemoveAll(readyFile)
 			}
 
-			if strings.HasPrefix(bundleLocation, "http") {
-				token := v.GetString("token")
-				if token == "" {
-					return errors.New("token is required when downloading bundle")
-				}
+			// This only works with generated config, so let's make sure we don't mess up user's real files.
+			bundleDir, deleteBundleDir, err = getBundleDir(v.GetString("support-bundle-location"), v.GetString("token"))
+			if err != nil {
+				return err
+			}
+			bundleDir, deleteBundleDir, err = overlayDeltas(bundleDir, deleteBundleDir, v.GetString("token"))
+			if err != nil {
+				return err
+			}
 
-				fmt.Printf("Downloading bundle\n")
+			clusterData, convertedDir, err := getClusterData(bundleDir)
+			if err != nil {
+				return err
+			}
+			defer removeBundleData(convertedDir)
+			clusterData = indexClusterData(v.GetString("support-bundle-location"), deleteBundleDir, clusterData)
+			printCollectorErrors(os.Stdout, clusterData)
 
-				dir, err := downloadAndExtractBundle(bundleLocation, token)
+			if address := v.GetString("pprof"); address != "" {
+				pprofAddress, err := api.StartPprofServer(address)
 				if err != nil {
-					return errors.Wrap(err, "failed to stat input path")
+					return errors.Wrap(err, "failed to start pprof server")
 				}
-				bundleDir = dir
-				deleteBundleDir = true
-			} else {
-				fileInfo, err := os.Stat(bundleLocation)
-				if err != nil {
-					return errors.Wrap(err, "failed to stat input path")
-				}
-
-				bundleDir = bundleLocation
-				if !fileInfo.IsDir() {
-					deleteBundleDir = true
-					bundleDir, err = os.MkdirTemp("", "sbctl-")
-					if err != nil {
-						return errors.Wrap(err, "failed to create temp dir")
-					}
+				fmt.Printf("Profiles are served at http://%s/debug/pprof/\n", pprofAddress)
+			}
 
-					err = sbctl.ExtractBundle(bundleLocation, bundleDir)
-					if err != nil {
-						return errors.Wrap(err, "failed to extract bundle")
-					}
-				}
+			if err := api.LoadPrinterPlugins(v.GetStringSlice("printer-plugin")); err != nil {
+				return err
 			}
 
-			clusterData, err := sbctl.FindClusterData(bundleDir)
+			views, err := loadViews(v)
 			if err != nil {
-				return errors.Wrap(err, "failed to find cluster data")
+				return errors.Wrap(err, "failed to load views")
 			}
 
 			kubeConfig, err = api.StartAPIServer(clusterData, logOutput)
 			if err != nil {
-				return errors.Wrap(err, "failed to create api server")
+				return usererrors.New(usererrors.ServerStartFailed, err)
 			}
 			defer os.RemoveAll(kubeConfig)
+			defer printUnservedSummary(os.Stdout)
+
+			instanceFile, err = registerInstance(v.GetString("support-bundle-location"), kubeConfig)
+			if err != nil {
+				log.Warnf("failed to record the running server: %v", err)
+			}
+			defer os.RemoveAll(instanceFile)
+
+			viewKubeConfigs, err = writeViewKubeConfigs(kubeConfig, views)
+			defer func() {
+				for _, fileName := range viewKubeConfigs {
+					_ = os.RemoveAll(fileName)
+				}
+			}()
+			if err != nil {
+				return err
+			}
+
+			for i, view := range views {
+				fmt.Printf("Kubeconfig for view %s: %s\n", view.Name, viewKubeConfigs[i])
+			}
+
+			if readyFile != "" {
+				go writeReadyFileWhenReady(readyFile, kubeConfig, 250*time.Millisecond)
+				defer os.RemoveAll(readyFile)
+			}
+
+			if v.GetBool("restricted") {
+				return runRestrictedShell(os.Stdin, os.Stdout, os.Stderr, kubeConfig, v.GetStringSlice("restricted-commands"))
+			}
 
 			shellCmd := os.Getenv("SHELL")
 			if shellCmd == "" {
@@ -162,6 +207,18 @@ func ShellCmd() *cobra.Command {
 
 	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
 	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	cmd.Flags().Int("port", 0, "port for the API server to listen on. A random free port is used by default.")
+	cmd.Flags().String("ready-file", "", "file to create once the API server is ready to answer queries. It contains the kubeconfig path and is removed on exit.")
 	cmd.Flags().Bool("debug", false, "enable debug logging. This will include HTTP response bodies in logs.")
+	cmd.Flags().String("max-response-size", "256Mi", "largest API response to send, e.g. 64Mi. Larger lists must be paged. Set to 0 to disable.")
+	cmd.Flags().Bool("disable-compression", false, "do not gzip large API responses")
+	cmd.Flags().Bool("no-aggregate", false, "list every collected event rather than combining repeated events about the same object and reason")
+	cmd.Flags().Duration("request-timeout", 0, "longest time to spend on an API request, unless the client asks for another timeout. 0 means no limit.")
+	cmd.Flags().String("usage-report", "", "opt in to recording which resources sbctl could not serve, without names or namespaces, in this JSON file")
+	cmd.Flags().String("views", "", "YAML file of views restricting tokens to some namespaces and resources. The generated kubeconfigs of views can be shared.")
+	cmd.Flags().StringSlice("printer-plugin", nil, "Go plugin registering table printers for custom resources. Can be repeated.")
+	cmd.Flags().String("pprof", "", "address to serve net/http/pprof profiles on, e.g. localhost:6060. Disabled by default.")
+	cmd.Flags().Bool("restricted", false, "start a restricted shell that only runs read-only kubectl commands, e.g. for screen sharing")
+	cmd.Flags().StringSlice("restricted-commands", defaultRestrictedCommands, "kubectl commands the restricted shell allows")
 	return cmd
 }
@@ -0,0 +1,268 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+type drainedPod struct {
+	Pod      corev1.Pod
+	Owner    string
+	Requests corev1.ResourceList
+	Result   string
+}
+
+func SimulateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "simulate",
+		Short: "Simulate operations against the state in a support bundle",
+		Long:  `Simulate operations against the state in a support bundle, to plan remediation before touching the real cluster.`,
+	}
+
+	cmd.AddCommand(simulateDrainCmd())
+	return cmd
+}
+
+func simulateDrainCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "drain node/<name>",
+		Short: "Simulate draining a node",
+		Long: `Simulate draining a node.
+
+Pods that would be evicted are listed with the node they would be rescheduled to. Placement uses
+resource requests, node selectors, required node affinity and taints of the remaining schedulable
+nodes, largest pods first. PodDisruptionBudgets that would block or delay evictions are reported.
+Pod affinity, topology spread and volume constraints are not simulated.`,
+		Args:          cobra.ExactArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			nodeName, err := parseObjectArg(args[0], "nodes")
+			if err != nil {
+				return err
+			}
+
+			clusterData, cleanup, err := loadClusterData(v)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			nodes, err := sbctl.ListTypedResources[corev1.Node](clusterData, "", "nodes")
+			if err != nil {
+				return errors.Wrap(err, "failed to list nodes")
+			}
+			pods, err := sbctl.ListTypedResources[corev1.Pod](clusterData, "", "pods")
+			if err != nil {
+				return errors.Wrap(err, "failed to list pods")
+			}
+			pdbs, err := sbctl.ListTypedResources[policyv1.PodDisruptionBudget](clusterData, "policy", "poddisruptionbudgets")
+			if err != nil {
+				return errors.Wrap(err, "failed to list pod disruption budgets")
+			}
+
+			found := false
+			for _, n := range nodes {
+				found = found || n.Name == nodeName
+			}
+			if !found {
+				return errors.Errorf("node %q not found in support bundle", nodeName)
+			}
+
+			evicted, ignored := simulateDrain(nodeName, nodes, pods)
+			printDrainedPods(os.Stdout, append(evicted, ignored...))
+
+			pdbIssues := drainPDBIssues(evicted, pdbs)
+			if len(pdbIssues) > 0 {
+				fmt.Println("\nPodDisruptionBudgets:")
+				for _, issue := range pdbIssues {
+					fmt.Printf("  - %s\n", issue)
+				}
+			}
+
+			unschedulable := 0
+			for _, p := range evicted {
+				if strings.HasPrefix(p.Result, "unschedulable") {
+					unschedulable++
+				}
+			}
+			fmt.Println()
+			if unschedulable > 0 {
+				fmt.Printf("Draining %s leaves %d of %d evicted pods without a node to run on\n", nodeName, unschedulable, len(evicted))
+			} else {
+				fmt.Printf("All %d evicted pods fit on the remaining nodes\n", len(evicted))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	return cmd
+}
+
+// simulateDrain returns the pods evicted from the node, with where they would be rescheduled,
+// and the pods drain leaves alone
+func simulateDrain(nodeName string, nodes []corev1.Node, pods []corev1.Pod) ([]drainedPod, []drainedPod) {
+	resources := newNodeResources(nodes, pods)
+
+	evicted := []drainedPod{}
+	ignored := []drainedPod{}
+	for _, p := range pods {
+		if p.Spec.NodeName != nodeName || isTerminatedPod(p) {
+			continue
+		}
+
+		d := drainedPod{Pod: p, Owner: "<none>", Requests: podRequests(p)}
+		if len(p.OwnerReferences) > 0 {
+			d.Owner = fmt.Sprintf("%s/%s", p.OwnerReferences[0].Kind, p.OwnerReferences[0].Name)
+		}
+
+		switch {
+		case isDaemonSetPod(p):
+			d.Result = "ignored, DaemonSet pod"
+			ignored = append(ignored, d)
+		case isMirrorPod(p):
+			d.Result = "ignored, static pod"
+			ignored = append(ignored, d)
+		case len(p.OwnerReferences) == 0:
+			d.Result = "deleted, not managed by a controller (requires --force)"
+			evicted = append(evicted, d)
+		default:
+			evicted = append(evicted, d)
+		}
+	}
+
+	// Place the largest pods first, so that small pods don't fragment the remaining capacity
+	sort.SliceStable(evicted, func(i, j int) bool {
+		ci := evicted[i].Requests[corev1.ResourceCPU]
+		cj := evicted[j].Requests[corev1.ResourceCPU]
+		return ci.Cmp(cj) > 0
+	})
+
+	candidates := []*nodeResources{}
+	for _, n := range nodes {
+		if n.Name == nodeName || n.Spec.Unschedulable || !isNodeReady(n) {
+			continue
+		}
+		candidates = append(candidates, resources[n.Name])
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Node.Name < candidates[j].Node.Name
+	})
+
+	for i := range evicted {
+		d := &evicted[i]
+		if d.Result != "" {
+			continue
+		}
+
+		reasons := map[string]int{}
+		for _, n := range candidates {
+			if reason := nodeSelectorMismatch(d.Pod, n.Node); reason != "" {
+				reasons["node selector or affinity mismatch"]++
+				continue
+			}
+			if taint := untoleratedTaint(d.Pod, n.Node); taint != nil {
+				reasons[fmt.Sprintf("untolerated taint %s", taint.ToString())]++
+				continue
+			}
+			if insufficient := n.insufficientResources(d.Requests); len(insufficient) > 0 {
+				for _, r := range insufficient {
+					reasons[strings.SplitN(r, " (", 2)[0]]++
+				}
+				continue
+			}
+
+			n.add(d.Requests)
+			d.Result = fmt.Sprintf("rescheduled to %s", n.Node.Name)
+			break
+		}
+
+		if d.Result == "" {
+			d.Result = fmt.Sprintf("unschedulable: 0/%d nodes available%s", len(candidates), formatReasonCounts(reasons))
+		}
+	}
+
+	return evicted, ignored
+}
+
+func formatReasonCounts(reasons map[string]int) string {
+	if len(reasons) == 0 {
+		return ""
+	}
+	parts := []string{}
+	for reason, count := range reasons {
+		parts = append(parts, fmt.Sprintf("%d %s", count, reason))
+	}
+	sort.Strings(parts)
+	return ": " + strings.Join(parts, ", ")
+}
+
+// drainPDBIssues reports PodDisruptionBudgets that block evictions, or that make drain wait for
+// replacement pods to become ready between evictions
+func drainPDBIssues(evicted []drainedPod, pdbs []policyv1.PodDisruptionBudget) []string {
+	issues := []string{}
+	for _, pdb := range pdbs {
+		selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+		if err != nil || selector.Empty() {
+			continue
+		}
+
+		matching := 0
+		for _, d := range evicted {
+			if d.Pod.Namespace == pdb.Namespace && selector.Matches(labels.Set(d.Pod.Labels)) {
+				matching++
+			}
+		}
+		if matching == 0 {
+			continue
+		}
+
+		allowed := int(pdb.Status.DisruptionsAllowed)
+		switch {
+		case allowed == 0:
+			issues = append(issues, fmt.Sprintf("%s/%s blocks eviction of %d pods, it allows no disruptions (%d of %d pods healthy)",
+				pdb.Namespace, pdb.Name, matching, pdb.Status.CurrentHealthy, pdb.Status.ExpectedPods))
+		case matching > allowed:
+			issues = append(issues, fmt.Sprintf("%s/%s allows %d disruptions, %d pods are evicted as their replacements become ready",
+				pdb.Namespace, pdb.Name, allowed, matching-allowed))
+		}
+	}
+	return issues
+}
+
+func printDrainedPods(out io.Writer, pods []drainedPod) {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "NAMESPACE\tPOD\tOWNER\tCPU\tMEMORY\tRESULT")
+	for _, d := range pods {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			d.Pod.Namespace,
+			d.Pod.Name,
+			d.Owner,
+			formatQuantity(d.Requests, corev1.ResourceCPU),
+			formatQuantity(d.Requests, corev1.ResourceMemory),
+			d.Result,
+		)
+	}
+}
@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testBundleData returns the cluster data of the bundle the API tests serve
+func testBundleData() sbctl.ClusterData {
+	clusterData, err := sbctl.FindClusterData(filepath.Join("..", "tests", "support-bundle"))
+	Expect(err).NotTo(HaveOccurred())
+	return clusterData
+}
+
+var _ = Describe("Simulate drain", func() {
+	var nodes []corev1.Node
+	var pods []corev1.Pod
+
+	BeforeEach(func() {
+		clusterData := testBundleData()
+		var err error
+		nodes, err = sbctl.ListTypedResources[corev1.Node](clusterData, "", "nodes")
+		Expect(err).NotTo(HaveOccurred())
+		pods, err = sbctl.ListTypedResources[corev1.Pod](clusterData, "", "pods")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	results := func(drained []drainedPod) map[string]string {
+		result := map[string]string{}
+		for _, d := range drained {
+			result[d.Pod.Namespace+"/"+d.Pod.Name] = d.Result
+		}
+		return result
+	}
+
+	It("Reschedules the evicted pods of a node, largest first", func() {
+		evicted, ignored := simulateDrain("troubleshoot-demo-003", nodes, pods)
+
+		Expect(evicted).To(HaveLen(3))
+		Expect(evicted[0].Pod.Name).To(Equal("velero-6796549f-5j2vv"))
+		Expect(results(evicted)).To(Equal(map[string]string{
+			"velero/velero-6796549f-5j2vv":                "rescheduled to troubleshoot-demo-001",
+			"longhorn-system/instance-manager-e-d5743cd9": "rescheduled to troubleshoot-demo-001",
+			"longhorn-system/instance-manager-r-af1c7a93": "rescheduled to troubleshoot-demo-001",
+		}))
+
+		ignoredResults := results(ignored)
+		Expect(ignoredResults).To(HaveKeyWithValue("kube-system/haproxy-troubleshoot-demo-003", "ignored, static pod"))
+		Expect(ignoredResults).To(HaveKeyWithValue("kube-system/kube-proxy-svkbc", "ignored, DaemonSet pod"))
+		Expect(ignoredResults).To(HaveKeyWithValue("velero/restic-f8vwl", "ignored, DaemonSet pod"))
+		for name, result := range ignoredResults {
+			Expect(result).To(HavePrefix("ignored"), name)
+		}
+
+		out := bytes.Buffer{}
+		printDrainedPods(&out, evicted)
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		Expect(strings.Fields(lines[0])).To(Equal([]string{"NAMESPACE", "POD", "OWNER", "CPU", "MEMORY", "RESULT"}))
+		Expect(strings.Fields(lines[1])).To(Equal([]string{"velero", "velero-6796549f-5j2vv", "ReplicaSet/velero-6796549f", "500m", "128Mi", "rescheduled", "to", "troubleshoot-demo-001"}))
+	})
+
+	It("Reports evicted pods that no remaining node can run", func() {
+		for i := range nodes {
+			switch nodes[i].Name {
+			case "troubleshoot-demo-001":
+				nodes[i].Spec.Unschedulable = true
+			case "troubleshoot-demo-002":
+				nodes[i].Spec.Taints = []corev1.Taint{{Key: "dedicated", Value: "db", Effect: corev1.TaintEffectNoSchedule}}
+			}
+		}
+
+		evicted, _ := simulateDrain("troubleshoot-demo-003", nodes, pods)
+		for name, result := range results(evicted) {
+			Expect(result).To(Equal("unschedulable: 0/1 nodes available: 1 untolerated taint dedicated=db:NoSchedule"), name)
+		}
+	})
+
+	It("Reports PodDisruptionBudgets that block or delay evictions", func() {
+		evicted, _ := simulateDrain("troubleshoot-demo-003", nodes, pods)
+		pdb := func(name string, selector map[string]string, allowed int32) policyv1.PodDisruptionBudget {
+			return policyv1.PodDisruptionBudget{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "longhorn-system", Name: name},
+				Spec:       policyv1.PodDisruptionBudgetSpec{Selector: &metav1.LabelSelector{MatchLabels: selector}},
+				Status:     policyv1.PodDisruptionBudgetStatus{DisruptionsAllowed: allowed, CurrentHealthy: 3, ExpectedPods: 3},
+			}
+		}
+
+		Expect(drainPDBIssues(evicted, []policyv1.PodDisruptionBudget{
+			pdb("instance-manager", map[string]string{"longhorn.io/component": "instance-manager"}, 1),
+			pdb("engine", map[string]string{"longhorn.io/instance-manager-type": "engine"}, 0),
+			pdb("replica", map[string]string{"longhorn.io/instance-manager-type": "replica"}, 1),
+			pdb("everything", nil, 0),
+		})).To(Equal([]string{
+			"longhorn-system/instance-manager allows 1 disruptions, 1 pods are evicted as their replacements become ready",
+			"longhorn-system/engine blocks eviction of 1 pods, it allows no disruptions (3 of 3 pods healthy)",
+		}))
+	})
+})
@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func SplitCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "split",
+		Short: "Write a smaller bundle with only some namespaces or resources",
+		Long: `Write a smaller bundle with only some namespaces or resources.
+
+The new bundle has the files of the selected namespaces and resources, and pod logs unless
+--no-logs is set. Cluster-scoped resources are kept unless --kind leaves them out, and the
+namespace list only has the selected namespaces. Files outside cluster-resources, such as host
+collector output and analysis results, can mention any namespace and are left out unless
+--keep-other-files is set. This is useful to forward a slim part of a bundle to a third party or
+to attach it to a ticket with a size limit.`,
+		Example: `  sbctl split -s bundle.tar.gz --namespace velero -o velero-only.tgz
+  sbctl split -s bundle.tar.gz --kind pods,events,deployments --no-logs -o workloads.tgz`,
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			output := v.GetString("output")
+			if output == "" {
+				return usererrors.New(usererrors.MissingArgument, nil, "--output")
+			}
+
+			clusterData, cleanup, err := loadClusterData(v)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			opts := sbctl.SplitOptions{
+				Namespaces:     v.GetStringSlice("namespace"),
+				NoLogs:         v.GetBool("no-logs"),
+				KeepOtherFiles: v.GetBool("keep-other-files"),
+			}
+			if kinds := v.GetStringSlice("kind"); len(kinds) > 0 {
+				mapper, err := sbctl.LoadRESTMapper(clusterData)
+				if err != nil {
+					return errors.Wrap(err, "failed to load resources")
+				}
+				for _, kind := range kinds {
+					gvr, err := mapper.ResourceFor(kind)
+					if err != nil {
+						return err
+					}
+					opts.Resources = append(opts.Resources, schema.GroupResource{Group: gvr.Group, Resource: gvr.Resource})
+				}
+			}
+
+			f, err := os.Create(output)
+			if err != nil {
+				return errors.Wrap(err, "failed to create output file")
+			}
+			defer f.Close()
+
+			count, err := sbctl.SplitBundle(clusterData, opts, f, bundleArchiveName(output))
+			if err != nil {
+				_ = os.Remove(output)
+				return errors.Wrap(err, "failed to write bundle")
+			}
+			if err := f.Close(); err != nil {
+				return errors.Wrap(err, "failed to write bundle")
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Wrote %d files to %s\n", count, output)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	cmd.Flags().StringSliceP("namespace", "n", nil, "comma separated namespaces to keep. All namespaces are kept when not set.")
+	cmd.Flags().StringSlice("kind", nil, "comma separated resources to keep, e.g. pods,events,deployments.apps. All resources are kept when not set.")
+	cmd.Flags().Bool("no-logs", false, "leave out pod logs")
+	cmd.Flags().Bool("keep-other-files", false, "keep files outside cluster-resources, such as host collector output")
+	cmd.Flags().StringP("output", "o", "", "file to write the new bundle to, as a gzipped tar archive")
+	return cmd
+}
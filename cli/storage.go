@@ -0,0 +1,329 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func StorageCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "storage pvc/<name>",
+		Short: "Inspect the chain of storage objects behind a PersistentVolumeClaim",
+		Long: `Inspect the chain of storage objects behind a PersistentVolumeClaim.
+
+The claim is followed to its PersistentVolume, StorageClass and CSI driver, the VolumeAttachments
+that attach the volume to nodes, and the pods that mount the claim. Events of each object are
+shown, to debug volume binding, provisioning, attach and mount problems.`,
+		Args:          cobra.ExactArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			name, err := parseObjectArg(args[0], "persistentvolumeclaims")
+			if err != nil {
+				return err
+			}
+			namespace := v.GetString("namespace")
+
+			clusterData, cleanup, err := loadClusterData(v)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			pvcs, err := sbctl.ListTypedResources[corev1.PersistentVolumeClaim](clusterData, "", "persistentvolumeclaims")
+			if err != nil {
+				return errors.Wrap(err, "failed to list persistent volume claims")
+			}
+			pvs, err := sbctl.ListTypedResources[corev1.PersistentVolume](clusterData, "", "persistentvolumes")
+			if err != nil {
+				return errors.Wrap(err, "failed to list persistent volumes")
+			}
+			storageClasses, err := sbctl.ListTypedResources[storagev1.StorageClass](clusterData, "storage.k8s.io", "storageclasses")
+			if err != nil {
+				return errors.Wrap(err, "failed to list storage classes")
+			}
+			csiDrivers, err := sbctl.ListTypedResources[storagev1.CSIDriver](clusterData, "storage.k8s.io", "csidrivers")
+			if err != nil {
+				return errors.Wrap(err, "failed to list CSI drivers")
+			}
+			attachments, err := sbctl.ListTypedResources[storagev1.VolumeAttachment](clusterData, "storage.k8s.io", "volumeattachments")
+			if err != nil {
+				return errors.Wrap(err, "failed to list volume attachments")
+			}
+			pods, err := sbctl.ListTypedResources[corev1.Pod](clusterData, "", "pods")
+			if err != nil {
+				return errors.Wrap(err, "failed to list pods")
+			}
+			events, err := sbctl.ListResources(clusterData, "", "events")
+			if err != nil {
+				return errors.Wrap(err, "failed to list events")
+			}
+
+			var pvc *corev1.PersistentVolumeClaim
+			for i := range pvcs {
+				if pvcs[i].Namespace == namespace && pvcs[i].Name == name {
+					pvc = &pvcs[i]
+					break
+				}
+			}
+			if pvc == nil {
+				return errors.Errorf("persistent volume claim %s/%s not found in support bundle", namespace, name)
+			}
+
+			tf, err := newTimeFormat(v, bundleCollectionTime(events))
+			if err != nil {
+				return err
+			}
+
+			out := os.Stdout
+			printPVC(out, *pvc)
+			printObjectEvents(out, events, "PersistentVolumeClaim", pvc.Namespace, pvc.Name, tf)
+
+			var pv *corev1.PersistentVolume
+			for i := range pvs {
+				if pvs[i].Name == pvc.Spec.VolumeName {
+					pv = &pvs[i]
+					break
+				}
+			}
+			fmt.Fprintln(out)
+			if pv == nil {
+				if pvc.Spec.VolumeName == "" {
+					fmt.Fprintln(out, "PersistentVolume: <none>, claim is not bound")
+				} else {
+					fmt.Fprintf(out, "PersistentVolume: %s not found in support bundle\n", pvc.Spec.VolumeName)
+				}
+			} else {
+				printPV(out, *pv)
+				printObjectEvents(out, events, "PersistentVolume", "", pv.Name, tf)
+			}
+
+			className := storageClassName(*pvc, pv)
+			fmt.Fprintln(out)
+			var sc *storagev1.StorageClass
+			for i := range storageClasses {
+				if storageClasses[i].Name == className {
+					sc = &storageClasses[i]
+					break
+				}
+			}
+			if sc == nil {
+				fmt.Fprintf(out, "StorageClass: %s\n", valueOrNone(className))
+				if className != "" {
+					fmt.Fprintln(out, "  not found in support bundle")
+				}
+			} else {
+				printStorageClass(out, *sc)
+			}
+
+			driver := ""
+			if pv != nil && pv.Spec.CSI != nil {
+				driver = pv.Spec.CSI.Driver
+			} else if sc != nil {
+				driver = sc.Provisioner
+			}
+			fmt.Fprintln(out)
+			printCSIDriver(out, driver, csiDrivers)
+
+			fmt.Fprintln(out, "\nVolumeAttachments:")
+			found := false
+			for _, a := range attachments {
+				if pv == nil || a.Spec.Source.PersistentVolumeName == nil || *a.Spec.Source.PersistentVolumeName != pv.Name {
+					continue
+				}
+				found = true
+				printVolumeAttachment(out, a)
+			}
+			if !found {
+				fmt.Fprintln(out, "  <none>")
+			}
+
+			fmt.Fprintln(out, "\nPods:")
+			found = false
+			for _, p := range pods {
+				if p.Namespace != pvc.Namespace || !podUsesClaim(p, pvc.Name) {
+					continue
+				}
+				found = true
+				fmt.Fprintf(out, "  %s on %s (%s)\n", p.Name, valueOrNone(p.Spec.NodeName), p.Status.Phase)
+				for _, m := range warningEventMessages(events, "Pod", p.Namespace, p.Name) {
+					fmt.Fprintf(out, "    %s\n", m)
+				}
+			}
+			if !found {
+				fmt.Fprintln(out, "  <none>")
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	cmd.Flags().StringP("namespace", "n", "default", "namespace of the persistent volume claim")
+	return cmd
+}
+
+func printPVC(out io.Writer, pvc corev1.PersistentVolumeClaim) {
+	requested := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	capacity := "<none>"
+	if q, ok := pvc.Status.Capacity[corev1.ResourceStorage]; ok {
+		capacity = q.String()
+	}
+
+	fmt.Fprintf(out, "PersistentVolumeClaim: %s/%s\n", pvc.Namespace, pvc.Name)
+	fmt.Fprintf(out, "  Status:        %s\n", pvc.Status.Phase)
+	fmt.Fprintf(out, "  Requested:     %s\n", requested.String())
+	fmt.Fprintf(out, "  Capacity:      %s\n", capacity)
+	fmt.Fprintf(out, "  Access modes:  %s\n", formatAccessModes(pvc.Spec.AccessModes))
+	fmt.Fprintf(out, "  Volume:        %s\n", valueOrNone(pvc.Spec.VolumeName))
+	if node := pvc.Annotations["volume.kubernetes.io/selected-node"]; node != "" {
+		fmt.Fprintf(out, "  Selected node: %s\n", node)
+	}
+	for _, c := range pvc.Status.Conditions {
+		fmt.Fprintf(out, "  Condition %s=%s: %s\n", c.Type, c.Status, c.Message)
+	}
+}
+
+func printPV(out io.Writer, pv corev1.PersistentVolume) {
+	capacity := pv.Spec.Capacity[corev1.ResourceStorage]
+
+	fmt.Fprintf(out, "PersistentVolume: %s\n", pv.Name)
+	fmt.Fprintf(out, "  Status:         %s\n", pv.Status.Phase)
+	if pv.Status.Message != "" {
+		fmt.Fprintf(out, "  Message:        %s\n", pv.Status.Message)
+	}
+	fmt.Fprintf(out, "  Capacity:       %s\n", capacity.String())
+	fmt.Fprintf(out, "  Reclaim policy: %s\n", pv.Spec.PersistentVolumeReclaimPolicy)
+	if pv.Spec.CSI != nil {
+		fmt.Fprintf(out, "  Source:         CSI %s, volume handle %s\n", pv.Spec.CSI.Driver, pv.Spec.CSI.VolumeHandle)
+	} else if pv.Spec.HostPath != nil {
+		fmt.Fprintf(out, "  Source:         host path %s\n", pv.Spec.HostPath.Path)
+	} else if pv.Spec.Local != nil {
+		fmt.Fprintf(out, "  Source:         local path %s\n", pv.Spec.Local.Path)
+	} else if pv.Spec.NFS != nil {
+		fmt.Fprintf(out, "  Source:         NFS %s:%s\n", pv.Spec.NFS.Server, pv.Spec.NFS.Path)
+	}
+	if pv.Spec.NodeAffinity != nil && pv.Spec.NodeAffinity.Required != nil {
+		terms := []string{}
+		for _, term := range pv.Spec.NodeAffinity.Required.NodeSelectorTerms {
+			terms = append(terms, describeNodeSelectorTerm(term))
+		}
+		fmt.Fprintf(out, "  Node affinity:  %s\n", strings.Join(terms, " or "))
+	}
+}
+
+func printStorageClass(out io.Writer, sc storagev1.StorageClass) {
+	bindingMode := storagev1.VolumeBindingImmediate
+	if sc.VolumeBindingMode != nil {
+		bindingMode = *sc.VolumeBindingMode
+	}
+	reclaimPolicy := corev1.PersistentVolumeReclaimDelete
+	if sc.ReclaimPolicy != nil {
+		reclaimPolicy = *sc.ReclaimPolicy
+	}
+
+	fmt.Fprintf(out, "StorageClass: %s\n", sc.Name)
+	fmt.Fprintf(out, "  Provisioner:     %s\n", sc.Provisioner)
+	fmt.Fprintf(out, "  Binding mode:    %s\n", bindingMode)
+	fmt.Fprintf(out, "  Reclaim policy:  %s\n", reclaimPolicy)
+	fmt.Fprintf(out, "  Allow expansion: %t\n", sc.AllowVolumeExpansion != nil && *sc.AllowVolumeExpansion)
+	if sc.Annotations["storageclass.kubernetes.io/is-default-class"] == "true" {
+		fmt.Fprintln(out, "  Default:         true")
+	}
+}
+
+func printCSIDriver(out io.Writer, name string, drivers []storagev1.CSIDriver) {
+	fmt.Fprintf(out, "CSIDriver: %s\n", valueOrNone(name))
+	if name == "" {
+		return
+	}
+
+	for _, d := range drivers {
+		if d.Name != name {
+			continue
+		}
+		fmt.Fprintf(out, "  Attach required: %t\n", d.Spec.AttachRequired == nil || *d.Spec.AttachRequired)
+		if d.Spec.FSGroupPolicy != nil {
+			fmt.Fprintf(out, "  FSGroup policy:  %s\n", *d.Spec.FSGroupPolicy)
+		}
+		return
+	}
+
+	if len(drivers) == 0 {
+		fmt.Fprintln(out, "  CSI drivers were not collected in support bundle")
+	} else {
+		fmt.Fprintln(out, "  not found in support bundle, the driver may not be installed")
+	}
+}
+
+func printVolumeAttachment(out io.Writer, a storagev1.VolumeAttachment) {
+	fmt.Fprintf(out, "  %s on %s, attached %t\n", a.Name, a.Spec.NodeName, a.Status.Attached)
+	if a.Status.AttachError != nil {
+		fmt.Fprintf(out, "    attach error: %s\n", a.Status.AttachError.Message)
+	}
+	if a.Status.DetachError != nil {
+		fmt.Fprintf(out, "    detach error: %s\n", a.Status.DetachError.Message)
+	}
+}
+
+// printObjectEvents prints all events of an object, since normal events such as WaitForFirstConsumer
+// explain binding delays as well as warnings do
+func printObjectEvents(out io.Writer, events []unstructured.Unstructured, kind string, namespace string, name string, tf timeFormat) {
+	for _, e := range events {
+		if nestedStringOrNone(e, "involvedObject", "kind") != kind || nestedStringOrNone(e, "involvedObject", "name") != name {
+			continue
+		}
+		if namespace != "" && nestedStringOrNone(e, "involvedObject", "namespace") != namespace {
+			continue
+		}
+		fmt.Fprintf(out, "  Event %s %s (%s): %s\n", nestedStringOrNone(e, "type"), nestedStringOrNone(e, "reason"), tf.Format(eventTimestamp(e)), nestedStringOrNone(e, "message"))
+	}
+}
+
+// storageClassName returns the class of the claim, or of its volume for claims which leave it to the default class
+func storageClassName(pvc corev1.PersistentVolumeClaim, pv *corev1.PersistentVolume) string {
+	if pvc.Spec.StorageClassName != nil {
+		return *pvc.Spec.StorageClassName
+	}
+	if pv != nil {
+		return pv.Spec.StorageClassName
+	}
+	return ""
+}
+
+func podUsesClaim(pod corev1.Pod, claimName string) bool {
+	for _, v := range pod.Spec.Volumes {
+		if v.PersistentVolumeClaim != nil && v.PersistentVolumeClaim.ClaimName == claimName {
+			return true
+		}
+		// Generic ephemeral volumes are backed by a claim named after the pod and volume
+		if v.Ephemeral != nil && fmt.Sprintf("%s-%s", pod.Name, v.Name) == claimName {
+			return true
+		}
+	}
+	return false
+}
+
+func formatAccessModes(modes []corev1.PersistentVolumeAccessMode) string {
+	names := []string{}
+	for _, m := range modes {
+		names = append(names, string(m))
+	}
+	return valueOrNone(strings.Join(names, ","))
+}
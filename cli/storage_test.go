@@ -0,0 +1,143 @@
+package cli
+
+import (
+	"bytes"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var _ = Describe("Storage", func() {
+	It("Accepts claims with or without their kind", func() {
+		Expect(parseObjectArg("data", "persistentvolumeclaims")).To(Equal("data"))
+		Expect(parseObjectArg("pvc/data", "persistentvolumeclaims")).To(Equal("data"))
+		Expect(parseObjectArg("persistentvolumeclaim/data", "persistentvolumeclaims")).To(Equal("data"))
+
+		_, err := parseObjectArg("pod/data", "persistentvolumeclaims")
+		Expect(err).To(MatchError(`expected persistentvolumeclaim/<name>, got "pod/data"`))
+	})
+
+	It("Takes the class of claims that leave it to the default from their volume", func() {
+		fast, none := "fast", ""
+		pv := &corev1.PersistentVolume{Spec: corev1.PersistentVolumeSpec{StorageClassName: "standard"}}
+
+		Expect(storageClassName(corev1.PersistentVolumeClaim{Spec: corev1.PersistentVolumeClaimSpec{StorageClassName: &fast}}, pv)).To(Equal("fast"))
+		Expect(storageClassName(corev1.PersistentVolumeClaim{Spec: corev1.PersistentVolumeClaimSpec{StorageClassName: &none}}, pv)).To(BeEmpty())
+		Expect(storageClassName(corev1.PersistentVolumeClaim{}, pv)).To(Equal("standard"))
+		Expect(storageClassName(corev1.PersistentVolumeClaim{}, nil)).To(BeEmpty())
+	})
+
+	It("Finds pods that mount claims, including generic ephemeral volumes", func() {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "web-0", Namespace: "default"},
+			Spec: corev1.PodSpec{Volumes: []corev1.Volume{
+				{Name: "data", VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "data"}}},
+				{Name: "scratch", VolumeSource: corev1.VolumeSource{Ephemeral: &corev1.EphemeralVolumeSource{}}},
+				{Name: "config", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{}}},
+			}},
+		}
+
+		Expect(podUsesClaim(pod, "data")).To(BeTrue())
+		Expect(podUsesClaim(pod, "web-0-scratch")).To(BeTrue())
+		Expect(podUsesClaim(pod, "web-0-config")).To(BeFalse())
+		Expect(podUsesClaim(pod, "logs")).To(BeFalse())
+	})
+
+	It("Prints claims", func() {
+		pvc := corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "data", Namespace: "default", Annotations: map[string]string{"volume.kubernetes.io/selected-node": "node-1"}},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce, corev1.ReadOnlyMany},
+				Resources:   corev1.VolumeResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")}},
+			},
+			Status: corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimPending},
+		}
+
+		out := bytes.Buffer{}
+		printPVC(&out, pvc)
+		Expect(out.String()).To(Equal("PersistentVolumeClaim: default/data\n" +
+			"  Status:        Pending\n" +
+			"  Requested:     10Gi\n" +
+			"  Capacity:      <none>\n" +
+			"  Access modes:  ReadWriteOnce,ReadOnlyMany\n" +
+			"  Volume:        <none>\n" +
+			"  Selected node: node-1\n"))
+	})
+
+	It("Prints volumes with their source and node affinity", func() {
+		pv := corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pv-1"},
+			Spec: corev1.PersistentVolumeSpec{
+				Capacity:                      corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")},
+				PersistentVolumeReclaimPolicy: corev1.PersistentVolumeReclaimRetain,
+				PersistentVolumeSource:        corev1.PersistentVolumeSource{CSI: &corev1.CSIPersistentVolumeSource{Driver: "ebs.csi.aws.com", VolumeHandle: "vol-1"}},
+				NodeAffinity: &corev1.VolumeNodeAffinity{Required: &corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+					MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "topology.kubernetes.io/zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"us-east-1a"}}},
+				}}}},
+			},
+			Status: corev1.PersistentVolumeStatus{Phase: corev1.VolumeBound},
+		}
+
+		out := bytes.Buffer{}
+		printPV(&out, pv)
+		Expect(out.String()).To(Equal("PersistentVolume: pv-1\n" +
+			"  Status:         Bound\n" +
+			"  Capacity:       10Gi\n" +
+			"  Reclaim policy: Retain\n" +
+			"  Source:         CSI ebs.csi.aws.com, volume handle vol-1\n" +
+			"  Node affinity:  {topology.kubernetes.io/zone In [us-east-1a]}\n"))
+	})
+
+	It("Prints the defaults of storage classes", func() {
+		out := bytes.Buffer{}
+		printStorageClass(&out, storagev1.StorageClass{
+			ObjectMeta:  metav1.ObjectMeta{Name: "standard", Annotations: map[string]string{"storageclass.kubernetes.io/is-default-class": "true"}},
+			Provisioner: "ebs.csi.aws.com",
+		})
+		Expect(out.String()).To(Equal("StorageClass: standard\n" +
+			"  Provisioner:     ebs.csi.aws.com\n" +
+			"  Binding mode:    Immediate\n" +
+			"  Reclaim policy:  Delete\n" +
+			"  Allow expansion: false\n" +
+			"  Default:         true\n"))
+	})
+
+	It("Reports whether CSI drivers are installed", func() {
+		attachRequired := false
+		drivers := []storagev1.CSIDriver{{
+			ObjectMeta: metav1.ObjectMeta{Name: "ebs.csi.aws.com"},
+			Spec:       storagev1.CSIDriverSpec{AttachRequired: &attachRequired},
+		}}
+		printDriver := func(name string, drivers []storagev1.CSIDriver) string {
+			out := bytes.Buffer{}
+			printCSIDriver(&out, name, drivers)
+			return out.String()
+		}
+
+		Expect(printDriver("ebs.csi.aws.com", drivers)).To(Equal("CSIDriver: ebs.csi.aws.com\n  Attach required: false\n"))
+		Expect(printDriver("efs.csi.aws.com", drivers)).To(Equal("CSIDriver: efs.csi.aws.com\n  not found in support bundle, the driver may not be installed\n"))
+		Expect(printDriver("efs.csi.aws.com", nil)).To(Equal("CSIDriver: efs.csi.aws.com\n  CSI drivers were not collected in support bundle\n"))
+		Expect(printDriver("", drivers)).To(Equal("CSIDriver: <none>\n"))
+	})
+
+	It("Prints all events of an object", func() {
+		events := []unstructured.Unstructured{
+			unstructuredFixture(`{"type": "Normal", "reason": "WaitForFirstConsumer", "message": "waiting for first consumer", "lastTimestamp": "2024-05-01T12:00:00Z",
+				"involvedObject": {"kind": "PersistentVolumeClaim", "namespace": "default", "name": "data"}}`),
+			unstructuredFixture(`{"type": "Warning", "reason": "ProvisioningFailed", "message": "other namespace",
+				"involvedObject": {"kind": "PersistentVolumeClaim", "namespace": "app", "name": "data"}}`),
+			unstructuredFixture(`{"type": "Warning", "reason": "FailedMount", "message": "other kind",
+				"involvedObject": {"kind": "Pod", "namespace": "default", "name": "data"}}`),
+		}
+
+		out := bytes.Buffer{}
+		printObjectEvents(&out, events, "PersistentVolumeClaim", "default", "data", timeFormat{Location: time.UTC})
+		Expect(out.String()).To(Equal("  Event Normal WaitForFirstConsumer (2024-05-01T12:00:00Z): waiting for first consumer\n"))
+	})
+})
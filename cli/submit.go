@@ -0,0 +1,131 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/api"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func SubmitCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "submit [bundle archive]",
+		Short: "Upload a bundle to a service started with sbctl host",
+		Long: `Upload a support bundle archive to a service started with sbctl host, and print a kubeconfig
+for the bundle's API on that service. The kubeconfig has a token that can only access the
+uploaded bundle, and expires after --ttl, or the service's --token-ttl when not set.
+
+Uploading requires the admin token of the service, from --admin-token or SBCTL_ADMIN_TOKEN.`,
+		Example: `  sbctl submit ./support-bundle.tar.gz --server http://sbctl.example.com:8080
+  sbctl submit ./support-bundle.tar.gz --server http://sbctl.example.com:8080 --name acme-1234 --user alice --ttl 8h -o acme.kubeconfig`,
+		Args:          cobra.ExactArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			server := strings.TrimSuffix(v.GetString("server"), "/")
+			if server == "" {
+				return usererrors.New(usererrors.MissingArgument, nil, "--server")
+			}
+			name := v.GetString("name")
+			if name == "" {
+				name = strings.TrimSuffix(strings.TrimSuffix(filepath.Base(args[0]), ".gz"), ".tar")
+			}
+
+			adminToken := v.GetString("admin-token")
+			if adminToken == "" {
+				return usererrors.New(usererrors.MissingArgument, nil, "--admin-token")
+			}
+
+			query := url.Values{}
+			query.Set("name", name)
+			if user := v.GetString("user"); user != "" {
+				query.Set("user", user)
+			}
+			if ttl := v.GetDuration("ttl"); ttl > 0 {
+				query.Set("ttl", ttl.String())
+			}
+
+			bundle, err := submitBundle(server, adminToken, args[0], query)
+			if err != nil {
+				return err
+			}
+			if bundle.Token == nil {
+				return errors.New("the service did not issue a token for the bundle")
+			}
+			fmt.Fprintf(os.Stderr, "Bundle %s is served at %s%s, its token expires at %s\n", bundle.ID, server, bundle.Path, bundle.Token.Expires.Format(time.RFC3339))
+
+			kubeConfig := api.KubeConfigContexts([]api.KubeContext{{Name: bundle.Name, Server: server + bundle.Path}}, bundle.Token.Token)
+			output := v.GetString("output")
+			if output == "" {
+				fmt.Print(kubeConfig)
+				return nil
+			}
+			if err := os.WriteFile(output, []byte(kubeConfig), 0600); err != nil {
+				return errors.Wrap(err, "failed to write kubeconfig")
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().String("server", "", "URL of the service started with sbctl host")
+	cmd.Flags().String("name", "", "name of the bundle on the service. Defaults to the archive's file name.")
+	cmd.Flags().String("admin-token", "", "admin token of the service")
+	cmd.Flags().String("user", "", "who the bundle's token is for, recorded in the service's audit log")
+	cmd.Flags().Duration("ttl", 0, "how long the bundle's token is valid. Defaults to the service's --token-ttl.")
+	cmd.Flags().StringP("output", "o", "", "write the kubeconfig to this file instead of stdout")
+	return cmd
+}
+
+// submitBundle uploads the bundle archive to the hosted mode API of server
+func submitBundle(server string, adminToken string, fileName string, query url.Values) (api.HostedBundle, error) {
+	f, err := os.Open(fileName)
+	if os.IsNotExist(err) {
+		return api.HostedBundle{}, usererrors.New(usererrors.BundleNotFound, err, fileName)
+	} else if err != nil {
+		return api.HostedBundle{}, errors.Wrap(err, "failed to open bundle")
+	}
+	defer f.Close()
+
+	req, err := http.NewRequest(http.MethodPost, server+"/sbctl/v1/bundles?"+query.Encode(), f)
+	if err != nil {
+		return api.HostedBundle{}, errors.Wrap(err, "failed to create HTTP request")
+	}
+	req.Header.Set("Content-Type", "application/gzip")
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return api.HostedBundle{}, errors.Wrap(err, "failed to upload bundle")
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return api.HostedBundle{}, errors.Wrap(err, "failed to read response")
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return api.HostedBundle{}, errors.Errorf("unexpected status code %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	bundle := api.HostedBundle{}
+	if err := json.Unmarshal(body, &bundle); err != nil {
+		return api.HostedBundle{}, errors.Wrap(err, "failed to unmarshal response")
+	}
+	return bundle, nil
+}
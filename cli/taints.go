@@ -0,0 +1,323 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/output"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// daemonSetTolerations are the tolerations the DaemonSet controller adds to its pods
+var daemonSetTolerations = []corev1.Toleration{
+	{Key: corev1.TaintNodeNotReady, Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoExecute},
+	{Key: corev1.TaintNodeUnreachable, Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoExecute},
+	{Key: corev1.TaintNodeDiskPressure, Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule},
+	{Key: corev1.TaintNodeMemoryPressure, Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule},
+	{Key: corev1.TaintNodePIDPressure, Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule},
+	{Key: corev1.TaintNodeUnschedulable, Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule},
+}
+
+type taintNode struct {
+	Name   string   `json:"name"`
+	Taints []string `json:"taints"`
+}
+
+type taintWorkload struct {
+	Kind        string   `json:"kind"`
+	Namespace   string   `json:"namespace"`
+	Name        string   `json:"name"`
+	Tolerations []string `json:"tolerations"`
+	// Tolerated are the taints of the nodes the workload tolerates
+	Tolerated []string `json:"tolerated"`
+	// Nodes is how many nodes the workload's pods can be scheduled on, by taints, node selector and
+	// required node affinity
+	Nodes int `json:"nodes"`
+	// Reasons are why the other nodes cannot run the workload, with their number of nodes
+	Reasons map[string]int `json:"reasons,omitempty"`
+
+	pod corev1.Pod
+}
+
+type taintMatrix struct {
+	Nodes     []taintNode     `json:"nodes"`
+	Taints    []string        `json:"taints"`
+	Workloads []taintWorkload `json:"workloads"`
+}
+
+func TaintsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "taints",
+		Short: "Show which workloads tolerate the taints of the nodes",
+		Long: `Show which workloads tolerate the taints of the nodes.
+
+The NoSchedule and NoExecute taints of the nodes are matched with the tolerations in the pod templates
+of Deployments, StatefulSets, DaemonSets and Jobs, and of pods without a controller. Workloads whose
+pods cannot be scheduled on any node, because of taints, node selectors or required node affinity,
+are highlighted. Only workloads that tolerate a taint of the nodes, or that cannot run on any node,
+are listed unless --all is set.`,
+		Example:       `  sbctl taints -s ./support-bundle.tar.gz`,
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			format := v.GetString("format")
+			if format != "text" && format != "json" {
+				return usererrors.New(usererrors.InvalidArgument, errors.Errorf("unsupported format %q, must be one of: text, json", format), "--format")
+			}
+
+			clusterData, cleanup, err := loadClusterData(v)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			nodes, err := sbctl.ListTypedResources[corev1.Node](clusterData, "", "nodes")
+			if err != nil {
+				return errors.Wrap(err, "failed to list nodes")
+			}
+			workloads, err := listTaintWorkloads(clusterData, v.GetString("namespace"))
+			if err != nil {
+				return err
+			}
+
+			matrix := newTaintMatrix(nodes, workloads, v.GetBool("all"))
+
+			if format == "json" {
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				if err := encoder.Encode(matrix); err != nil {
+					return errors.Wrap(err, "failed to write results")
+				}
+				return nil
+			}
+
+			p, err := newPrinter(os.Stdout)
+			if err != nil {
+				return err
+			}
+			return printTaintMatrix(p, matrix, len(nodes))
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	cmd.Flags().StringP("namespace", "n", "", "only show workloads in this namespace")
+	cmd.Flags().Bool("all", false, "show all workloads, not only the ones that tolerate taints or cannot run on any node")
+	cmd.Flags().String("format", "text", "output format. One of: text, json")
+	return cmd
+}
+
+// listTaintWorkloads returns the workloads of a namespace, or of all namespaces, with a pod made
+// of their pod template
+func listTaintWorkloads(clusterData sbctl.ClusterData, namespace string) ([]taintWorkload, error) {
+	workloads := []taintWorkload{}
+	add := func(kind string, namespace string, name string, spec corev1.PodSpec) {
+		w := taintWorkload{Kind: kind, Namespace: namespace, Name: name, Tolerations: []string{}, pod: corev1.Pod{Spec: spec}}
+		for _, t := range spec.Tolerations {
+			w.Tolerations = append(w.Tolerations, formatToleration(t))
+		}
+		if kind == "DaemonSet" {
+			w.pod.Spec.Tolerations = append(append([]corev1.Toleration{}, spec.Tolerations...), daemonSetTolerations...)
+		}
+		w.pod.Namespace, w.pod.Name = namespace, name
+		workloads = append(workloads, w)
+	}
+
+	deployments, err := sbctl.ListTypedResources[appsv1.Deployment](clusterData, "apps", "deployments")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list deployments")
+	}
+	for _, d := range deployments {
+		add("Deployment", d.Namespace, d.Name, d.Spec.Template.Spec)
+	}
+	statefulSets, err := sbctl.ListTypedResources[appsv1.StatefulSet](clusterData, "apps", "statefulsets")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list statefulsets")
+	}
+	for _, s := range statefulSets {
+		add("StatefulSet", s.Namespace, s.Name, s.Spec.Template.Spec)
+	}
+	daemonSets, err := sbctl.ListTypedResources[appsv1.DaemonSet](clusterData, "apps", "daemonsets")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list daemonsets")
+	}
+	for _, d := range daemonSets {
+		add("DaemonSet", d.Namespace, d.Name, d.Spec.Template.Spec)
+	}
+	jobs, err := sbctl.ListTypedResources[batchv1.Job](clusterData, "batch", "jobs")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list jobs")
+	}
+	for _, j := range jobs {
+		if j.Status.CompletionTime == nil {
+			add("Job", j.Namespace, j.Name, j.Spec.Template.Spec)
+		}
+	}
+	pods, err := sbctl.ListTypedResources[corev1.Pod](clusterData, "", "pods")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list pods")
+	}
+	for _, p := range pods {
+		if len(p.OwnerReferences) == 0 && !isMirrorPod(p) && !isTerminatedPod(p) {
+			add("Pod", p.Namespace, p.Name, p.Spec)
+		}
+	}
+
+	filtered := []taintWorkload{}
+	for _, w := range workloads {
+		if namespace == "" || w.Namespace == namespace {
+			filtered = append(filtered, w)
+		}
+	}
+	sort.SliceStable(filtered, func(i, j int) bool {
+		if filtered[i].Namespace != filtered[j].Namespace {
+			return filtered[i].Namespace < filtered[j].Namespace
+		}
+		return filtered[i].Name < filtered[j].Name
+	})
+	return filtered, nil
+}
+
+// newTaintMatrix matches the workloads with the taints of the nodes. Taints with the
+// PreferNoSchedule effect do not keep pods off nodes, and are left out.
+func newTaintMatrix(nodes []corev1.Node, workloads []taintWorkload, all bool) taintMatrix {
+	matrix := taintMatrix{Nodes: []taintNode{}, Taints: []string{}, Workloads: []taintWorkload{}}
+
+	taints := []corev1.Taint{}
+	for _, n := range nodes {
+		node := taintNode{Name: n.Name, Taints: []string{}}
+		for _, taint := range n.Spec.Taints {
+			if taint.Effect == corev1.TaintEffectPreferNoSchedule {
+				continue
+			}
+			node.Taints = append(node.Taints, taint.ToString())
+			if !containsString(matrix.Taints, taint.ToString()) {
+				matrix.Taints = append(matrix.Taints, taint.ToString())
+				taints = append(taints, taint)
+			}
+		}
+		matrix.Nodes = append(matrix.Nodes, node)
+	}
+	sort.Slice(matrix.Nodes, func(i, j int) bool {
+		return matrix.Nodes[i].Name < matrix.Nodes[j].Name
+	})
+
+	for _, w := range workloads {
+		w.Tolerated = []string{}
+		for i := range taints {
+			for _, t := range w.pod.Spec.Tolerations {
+				if t.ToleratesTaint(&taints[i]) {
+					w.Tolerated = append(w.Tolerated, taints[i].ToString())
+					break
+				}
+			}
+		}
+
+		w.Reasons = map[string]int{}
+		for _, n := range nodes {
+			if reason := nodeSelectorMismatch(w.pod, n); reason != "" {
+				w.Reasons["node selector or affinity mismatch"]++
+			} else if taint := untoleratedTaint(w.pod, n); taint != nil {
+				w.Reasons[fmt.Sprintf("untolerated taint %s", taint.ToString())]++
+			} else {
+				w.Nodes++
+			}
+		}
+
+		if all || len(w.Tolerated) > 0 || w.Nodes == 0 {
+			matrix.Workloads = append(matrix.Workloads, w)
+		}
+	}
+	return matrix
+}
+
+func formatToleration(t corev1.Toleration) string {
+	s := t.Key
+	if t.Operator == corev1.TolerationOpExists {
+		if s == "" {
+			s = "*"
+		}
+	} else if t.Value != "" {
+		s += "=" + t.Value
+	}
+	if t.Effect != "" {
+		s += ":" + string(t.Effect)
+	}
+	return s
+}
+
+func printTaintMatrix(p *output.Printer, matrix taintMatrix, nodeCount int) error {
+	out := p.Writer()
+
+	t := p.NewTable("NODE", "TAINTS")
+	for _, n := range matrix.Nodes {
+		t.AddRow(n.Name, valueOrNone(strings.Join(n.Taints, ", ")))
+	}
+	if err := t.Print(); err != nil {
+		return err
+	}
+	fmt.Fprintln(out)
+
+	if len(matrix.Workloads) == 0 {
+		fmt.Fprintln(out, p.Green("No workloads tolerate the taints of the nodes, and all of them can be scheduled"))
+		return nil
+	}
+
+	// The taints are numbered in the header of the matrix, so that long taints don't make it too wide
+	headers := []string{"WORKLOAD"}
+	for i, taint := range matrix.Taints {
+		headers = append(headers, fmt.Sprintf("T%d", i+1))
+		fmt.Fprintf(out, "%s %s\n", p.Bold(fmt.Sprintf("T%d", i+1)), taint)
+	}
+	if len(matrix.Taints) > 0 {
+		fmt.Fprintln(out)
+	}
+	headers = append(headers, "NODES", "REASONS")
+
+	t = p.NewTable(headers...)
+	blocked := 0
+	for _, w := range matrix.Workloads {
+		row := []string{fmt.Sprintf("%s %s/%s", w.Kind, w.Namespace, w.Name)}
+		for _, taint := range matrix.Taints {
+			if containsString(w.Tolerated, taint) {
+				row = append(row, p.Green("yes"))
+			} else {
+				row = append(row, p.Faint("-"))
+			}
+		}
+
+		nodes := fmt.Sprintf("%d/%d", w.Nodes, nodeCount)
+		reasons := strings.TrimPrefix(formatReasonCounts(w.Reasons), ": ")
+		if w.Nodes == 0 {
+			blocked++
+			nodes = p.Red(nodes)
+			reasons = p.Red(reasons)
+		}
+		row = append(row, nodes, valueOrNone(reasons))
+		t.AddRow(row...)
+	}
+	if err := t.Print(); err != nil {
+		return err
+	}
+
+	if blocked > 0 {
+		fmt.Fprintf(out, "\n%s\n", p.Red(fmt.Sprintf("%d workloads cannot be scheduled on any node", blocked)))
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package cli
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Taints", func() {
+	DescribeTable("Formats tolerations like taints",
+		func(t corev1.Toleration, expected string) {
+			Expect(formatToleration(t)).To(Equal(expected))
+		},
+		Entry("equal", corev1.Toleration{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "db", Effect: corev1.TaintEffectNoSchedule}, "dedicated=db:NoSchedule"),
+		Entry("exists", corev1.Toleration{Key: "dedicated", Operator: corev1.TolerationOpExists}, "dedicated"),
+		Entry("everything", corev1.Toleration{Operator: corev1.TolerationOpExists}, "*"),
+		Entry("everything with an effect", corev1.Toleration{Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoExecute}, "*:NoExecute"),
+	)
+
+	It("Matches workloads with the taints of the nodes", func() {
+		nodes := []corev1.Node{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "node-2"},
+				Spec: corev1.NodeSpec{Unschedulable: true, Taints: []corev1.Taint{
+					{Key: corev1.TaintNodeUnschedulable, Effect: corev1.TaintEffectNoSchedule},
+				}},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+				Spec: corev1.NodeSpec{Taints: []corev1.Taint{
+					{Key: "dedicated", Value: "db", Effect: corev1.TaintEffectNoSchedule},
+					{Key: "spot", Effect: corev1.TaintEffectPreferNoSchedule},
+				}},
+			},
+			{ObjectMeta: metav1.ObjectMeta{Name: "node-3"}},
+		}
+		workload := func(name string, spec corev1.PodSpec) taintWorkload {
+			return taintWorkload{Kind: "Deployment", Namespace: "default", Name: name, pod: corev1.Pod{Spec: spec}}
+		}
+		workloads := []taintWorkload{
+			workload("db", corev1.PodSpec{Tolerations: []corev1.Toleration{
+				{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "db", Effect: corev1.TaintEffectNoSchedule},
+			}}),
+			workload("web", corev1.PodSpec{}),
+			workload("cache", corev1.PodSpec{NodeSelector: map[string]string{"disk": "ssd"}}),
+		}
+
+		matrix := newTaintMatrix(nodes, workloads, false)
+		Expect(matrix.Nodes).To(Equal([]taintNode{
+			{Name: "node-1", Taints: []string{"dedicated=db:NoSchedule"}},
+			{Name: "node-2", Taints: []string{"node.kubernetes.io/unschedulable:NoSchedule"}},
+			{Name: "node-3", Taints: []string{}},
+		}))
+		Expect(matrix.Taints).To(Equal([]string{"node.kubernetes.io/unschedulable:NoSchedule", "dedicated=db:NoSchedule"}))
+
+		Expect(matrix.Workloads).To(HaveLen(2))
+		db, cache := matrix.Workloads[0], matrix.Workloads[1]
+		Expect(db.Name).To(Equal("db"))
+		Expect(db.Tolerated).To(Equal([]string{"dedicated=db:NoSchedule"}))
+		Expect(db.Nodes).To(Equal(2))
+		Expect(db.Reasons).To(Equal(map[string]int{"untolerated taint node.kubernetes.io/unschedulable:NoSchedule": 1}))
+		Expect(cache.Name).To(Equal("cache"))
+		Expect(cache.Tolerated).To(BeEmpty())
+		Expect(cache.Nodes).To(BeZero())
+		Expect(cache.Reasons).To(Equal(map[string]int{"node selector or affinity mismatch": 3}))
+
+		matrix = newTaintMatrix(nodes, workloads, true)
+		Expect(matrix.Workloads).To(HaveLen(3))
+		web := matrix.Workloads[1]
+		Expect(web.Name).To(Equal("web"))
+		Expect(web.Nodes).To(Equal(1))
+		Expect(web.Reasons).To(Equal(map[string]int{
+			"untolerated taint dedicated=db:NoSchedule":                     1,
+			"untolerated taint node.kubernetes.io/unschedulable:NoSchedule": 1,
+		}))
+	})
+
+	It("Lists workloads that are still running, with the tolerations DaemonSets get", func() {
+		dir := GinkgoT().TempDir()
+		template := `"template": {"spec": {"containers": [{"name": "app", "image": "app"}], "tolerations": [{"key": "dedicated", "operator": "Exists"}]}}`
+		writeClusterResource(dir, "deployments/default.json", fixtureList("apps/v1", "Deployment",
+			`{"metadata": {"name": "web", "namespace": "default"}, "spec": {`+template+`}}`))
+		writeClusterResource(dir, "daemonsets/kube-system.json", fixtureList("apps/v1", "DaemonSet",
+			`{"metadata": {"name": "proxy", "namespace": "kube-system"}, "spec": {`+template+`}}`))
+		writeClusterResource(dir, "jobs/default.json", fixtureList("batch/v1", "Job",
+			`{"metadata": {"name": "migrate", "namespace": "default"}, "spec": {`+template+`}}`,
+			`{"metadata": {"name": "backup", "namespace": "default"}, "spec": {`+template+`}, "status": {"completionTime": "2024-05-01T12:00:00Z"}}`))
+		writeClusterResource(dir, "pods/default.json", fixtureList("v1", "Pod",
+			`{"metadata": {"name": "debug", "namespace": "default"}, "spec": {"containers": [{"name": "app"}]}, "status": {"phase": "Running"}}`,
+			`{"metadata": {"name": "done", "namespace": "default"}, "spec": {"containers": [{"name": "app"}]}, "status": {"phase": "Succeeded"}}`,
+			`{"metadata": {"name": "web-abc", "namespace": "default", "ownerReferences": [{"apiVersion": "apps/v1", "kind": "ReplicaSet", "name": "web", "uid": "1"}]}, "spec": {"containers": [{"name": "app"}]}, "status": {"phase": "Running"}}`))
+		clusterData, err := sbctl.FindClusterData(dir)
+		Expect(err).NotTo(HaveOccurred())
+
+		workloads, err := listTaintWorkloads(clusterData, "")
+		Expect(err).NotTo(HaveOccurred())
+		names := []string{}
+		for _, w := range workloads {
+			names = append(names, w.Kind+" "+w.Namespace+"/"+w.Name)
+		}
+		Expect(names).To(Equal([]string{"Pod default/debug", "Job default/migrate", "Deployment default/web", "DaemonSet kube-system/proxy"}))
+
+		proxy := workloads[3]
+		Expect(proxy.Tolerations).To(Equal([]string{"dedicated"}))
+		Expect(proxy.pod.Spec.Tolerations).To(HaveLen(1 + len(daemonSetTolerations)))
+		Expect(workloads[2].pod.Spec.Tolerations).To(HaveLen(1))
+
+		workloads, err = listTaintWorkloads(clusterData, "kube-system")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(workloads).To(HaveLen(1))
+		Expect(workloads[0].Name).To(Equal("proxy"))
+	})
+})
@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
+	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/util/duration"
+)
+
+// timeFormat renders timestamps from the bundle as set with the --timezone and --time-format
+// flags. Relative times are relative to when the bundle was collected rather than to now, since
+// bundles are usually looked at long after they were collected.
+type timeFormat struct {
+	Location  *time.Location
+	Relative  bool
+	Reference time.Time
+}
+
+func newTimeFormat(v *viper.Viper, reference time.Time) (timeFormat, error) {
+	f := timeFormat{Location: time.UTC, Reference: reference}
+
+	switch zone := v.GetString("timezone"); zone {
+	case "", "UTC":
+	case "local", "Local":
+		f.Location = time.Local
+	default:
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			return f, errors.Wrapf(err, "invalid timezone %q", zone)
+		}
+		f.Location = loc
+	}
+
+	switch format := v.GetString("time-format"); format {
+	case "", "absolute":
+	case "relative":
+		f.Relative = true
+	default:
+		return f, usererrors.New(usererrors.InvalidArgument, errors.Errorf("invalid time format %q, must be absolute or relative", format), "--time-format")
+	}
+
+	return f, nil
+}
+
+func (f timeFormat) Format(t time.Time) string {
+	if t.IsZero() {
+		return "<none>"
+	}
+	if !f.Relative {
+		return t.In(f.Location).Format(time.RFC3339)
+	}
+	if d := f.Reference.Sub(t); d >= 0 {
+		return fmt.Sprintf("%s ago", duration.HumanDuration(d))
+	}
+	return fmt.Sprintf("in %s", duration.HumanDuration(t.Sub(f.Reference)))
+}
+
+// FormatString formats an RFC3339 timestamp read from an object. Anything else, such as
+// <none>, is returned unchanged.
+func (f timeFormat) FormatString(s string) string {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return s
+	}
+	return f.Format(t)
+}
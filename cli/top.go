@@ -0,0 +1,280 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// usageSourceRequests is the source of values that are resource requests rather than usage
+const usageSourceRequests = "requests"
+
+// topRow is the CPU and memory of a node or pod, with where each of them comes from
+type topRow struct {
+	Namespace    string
+	Name         string
+	CPU          *resource.Quantity
+	CPUSource    string
+	Memory       *resource.Quantity
+	MemorySource string
+	// Allocatable is only set for nodes
+	Allocatable corev1.ResourceList
+}
+
+func TopCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "top <node|pod> [name]",
+		Short: "Display CPU and memory of nodes or pods without the metrics API",
+		Long: `Display CPU and memory of nodes or pods without the metrics API.
+
+This prints the usage found in kubelet summary API dumps, such as the node-metrics collected by
+troubleshoot, or in dumps of the kubelet's cAdvisor metrics, which only have memory. Values that
+were not measured are the resource requests of pods instead. The SOURCE column tells which is
+which. The measured usage is also served as metrics.k8s.io, so kubectl top works with bundles
+that have such dumps, but it cannot fall back to requests.`,
+		Example: `  sbctl top node
+  sbctl top pod -A --sort-by memory`,
+		Args:          cobra.RangeArgs(1, 2),
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			sortBy := v.GetString("sort-by")
+			if sortBy != "" && sortBy != "cpu" && sortBy != "memory" {
+				return usererrors.New(usererrors.InvalidArgument, errors.Errorf("unsupported sort field %q, must be cpu or memory", sortBy), "--sort-by")
+			}
+			name := ""
+			if len(args) > 1 {
+				name = args[1]
+			}
+
+			clusterData, cleanup, err := loadClusterData(v)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			nodeList, err := sbctl.ListTypedResources[corev1.Node](clusterData, "", "nodes")
+			if err != nil {
+				return errors.Wrap(err, "failed to list nodes")
+			}
+			pods, err := sbctl.ListTypedResources[corev1.Pod](clusterData, "", "pods")
+			if err != nil {
+				return errors.Wrap(err, "failed to list pods")
+			}
+			usage, err := sbctl.FindResourceUsage(clusterData)
+			if err != nil {
+				return err
+			}
+
+			resource := ""
+			if gvr, err := sbctl.DefaultRESTMapper().ResourceFor(args[0]); err == nil {
+				resource = gvr.Resource
+			}
+
+			var rows []topRow
+			withNamespace := false
+			switch resource {
+			case "nodes":
+				rows = topNodes(nodeList, pods, usage)
+			case "pods":
+				namespace := v.GetString("namespace")
+				if v.GetBool("all-namespaces") {
+					namespace = ""
+					withNamespace = true
+				}
+				rows = topPods(pods, usage, namespace)
+			default:
+				return usererrors.New(usererrors.InvalidArgument, errors.Errorf("unsupported resource %q, must be node or pod", args[0]), "resource")
+			}
+
+			nodes := resource == "nodes"
+			if name != "" {
+				filtered := []topRow{}
+				for _, r := range rows {
+					if r.Name == name {
+						filtered = append(filtered, r)
+					}
+				}
+				if len(filtered) == 0 {
+					return errors.Errorf("%s %s not found in support bundle", args[0], name)
+				}
+				rows = filtered
+			}
+			sortTopRows(rows, sortBy)
+
+			printTopRows(os.Stdout, rows, nodes, withNamespace)
+			for _, r := range rows {
+				if r.CPUSource == usageSourceRequests || r.MemorySource == usageSourceRequests {
+					fmt.Fprintln(os.Stderr, "\nValues from requests are what pods requested, not what they used.")
+					break
+				}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	cmd.Flags().StringP("namespace", "n", "default", "namespace of the pods")
+	cmd.Flags().BoolP("all-namespaces", "A", false, "list pods of all namespaces")
+	cmd.Flags().String("sort-by", "", "sort by cpu or memory, highest first")
+	return cmd
+}
+
+// mergeUsage returns the usage of a node or pod from all the dumps that measured it. Summary
+// dumps are preferred, since they measure both CPU and memory.
+func mergeUsage(usage []sbctl.ResourceUsage, node string, namespace string, pod string) topRow {
+	row := topRow{}
+	for _, source := range []string{sbctl.UsageSourceSummary, sbctl.UsageSourceCadvisor} {
+		for _, u := range usage {
+			if u.Source != source || u.Namespace != namespace || u.Pod != pod || (pod == "" && u.Node != node) {
+				continue
+			}
+			if row.CPU == nil && u.CPU != nil {
+				row.CPU, row.CPUSource = u.CPU, u.Source
+			}
+			if row.Memory == nil && u.Memory != nil {
+				row.Memory, row.MemorySource = u.Memory, u.Source
+			}
+		}
+	}
+	return row
+}
+
+// withRequests fills what was not measured with requests
+func (r *topRow) withRequests(requests corev1.ResourceList) {
+	if r.CPU == nil {
+		r.CPUSource = usageSourceRequests
+		if q, ok := requests[corev1.ResourceCPU]; ok {
+			r.CPU = &q
+		}
+	}
+	if r.Memory == nil {
+		r.MemorySource = usageSourceRequests
+		if q, ok := requests[corev1.ResourceMemory]; ok {
+			r.Memory = &q
+		}
+	}
+}
+
+func topNodes(nodes []corev1.Node, pods []corev1.Pod, usage []sbctl.ResourceUsage) []topRow {
+	resources := newNodeResources(nodes, pods)
+	rows := []topRow{}
+	for _, n := range nodes {
+		row := mergeUsage(usage, n.Name, "", "")
+		row.Name = n.Name
+		row.Allocatable = n.Status.Allocatable
+		row.withRequests(resources[n.Name].Requested)
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func topPods(pods []corev1.Pod, usage []sbctl.ResourceUsage, namespace string) []topRow {
+	rows := []topRow{}
+	for _, p := range pods {
+		if isTerminatedPod(p) || (namespace != "" && p.Namespace != namespace) {
+			continue
+		}
+		row := mergeUsage(usage, p.Spec.NodeName, p.Namespace, p.Name)
+		row.Namespace = p.Namespace
+		row.Name = p.Name
+		row.withRequests(podRequests(p))
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func sortTopRows(rows []topRow, sortBy string) {
+	value := func(q *resource.Quantity) int64 {
+		if q == nil {
+			return -1
+		}
+		return q.MilliValue()
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		switch sortBy {
+		case "cpu":
+			return value(rows[i].CPU) > value(rows[j].CPU)
+		case "memory":
+			return value(rows[i].Memory) > value(rows[j].Memory)
+		}
+		if rows[i].Namespace != rows[j].Namespace {
+			return rows[i].Namespace < rows[j].Namespace
+		}
+		return rows[i].Name < rows[j].Name
+	})
+}
+
+// formatTopCPU and formatTopMemory format values the way kubectl top does
+func formatTopCPU(q *resource.Quantity) string {
+	if q == nil {
+		return "<none>"
+	}
+	return fmt.Sprintf("%dm", q.MilliValue())
+}
+
+func formatTopMemory(q *resource.Quantity) string {
+	if q == nil {
+		return "<none>"
+	}
+	return fmt.Sprintf("%dMi", q.Value()/(1024*1024))
+}
+
+func formatTopPercent(q *resource.Quantity, allocatable corev1.ResourceList, name corev1.ResourceName) string {
+	total, ok := allocatable[name]
+	if q == nil || !ok || total.IsZero() {
+		return "<none>"
+	}
+	return fmt.Sprintf("%d%%", q.MilliValue()*100/total.MilliValue())
+}
+
+func (r topRow) source() string {
+	if r.CPUSource == r.MemorySource {
+		return r.CPUSource
+	}
+	return fmt.Sprintf("cpu: %s, memory: %s", r.CPUSource, r.MemorySource)
+}
+
+func printTopRows(out io.Writer, rows []topRow, nodes bool, withNamespace bool) {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	defer w.Flush()
+
+	switch {
+	case nodes:
+		fmt.Fprintln(w, "NAME\tCPU(cores)\tCPU%\tMEMORY(bytes)\tMEMORY%\tSOURCE")
+	case withNamespace:
+		fmt.Fprintln(w, "NAMESPACE\tNAME\tCPU(cores)\tMEMORY(bytes)\tSOURCE")
+	default:
+		fmt.Fprintln(w, "NAME\tCPU(cores)\tMEMORY(bytes)\tSOURCE")
+	}
+
+	for _, r := range rows {
+		switch {
+		case nodes:
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Name,
+				formatTopCPU(r.CPU), formatTopPercent(r.CPU, r.Allocatable, corev1.ResourceCPU),
+				formatTopMemory(r.Memory), formatTopPercent(r.Memory, r.Allocatable, corev1.ResourceMemory),
+				r.source())
+		case withNamespace:
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Namespace, r.Name, formatTopCPU(r.CPU), formatTopMemory(r.Memory), r.source())
+		default:
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Name, formatTopCPU(r.CPU), formatTopMemory(r.Memory), r.source())
+		}
+	}
+}
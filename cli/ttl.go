@@ -0,0 +1,35 @@
+package cli
+
+import (
+	"time"
+
+	"github.com/replicatedhq/sbctl/pkg/api"
+)
+
+// idleTimeout returns a channel that is closed once the API server has not answered a request
+// for ttl, so that forgotten servers stop and remove the customer data they extracted. The
+// channel is nil, and never ready, when ttl is 0.
+func idleTimeout(ttl time.Duration) <-chan struct{} {
+	if ttl <= 0 {
+		return nil
+	}
+
+	// Check often enough that servers do not outlive their TTL by much
+	interval := ttl / 10
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if api.IdleTime() >= ttl {
+				close(done)
+				return
+			}
+		}
+	}()
+	return done
+}
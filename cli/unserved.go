@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/replicatedhq/sbctl/pkg/api"
+)
+
+// maxUnservedRequests is how many unserved requests are listed when a session ends
+const maxUnservedRequests = 10
+
+// unservedHints explain why requests of well known APIs fail, by path prefix
+var unservedHints = []struct {
+	prefix string
+	hint   string
+}{
+	{"/apis/metrics.k8s.io", "the bundle has no kubelet metrics, use sbctl top instead of kubectl top"},
+	{"/openapi", "OpenAPI schemas are not collected in support bundles, so kubectl explain does not work"},
+	{"/apis/custom.metrics.k8s.io", "metrics are not collected in support bundles"},
+	{"/apis/external.metrics.k8s.io", "metrics are not collected in support bundles"},
+}
+
+// printUnservedSummary lists the requests of the session that sbctl answered with 404 or 405,
+// so that users can tell failures of their tools from problems of the cluster
+func printUnservedSummary(out io.Writer) {
+	requests := api.GetUnservedRequests()
+	if len(requests) == 0 {
+		return
+	}
+
+	fmt.Fprintln(out, "Some requests of this session could not be served:")
+	for i, r := range requests {
+		if i == maxUnservedRequests {
+			fmt.Fprintf(out, "  ... and %d more\n", len(requests)-maxUnservedRequests)
+			break
+		}
+
+		times := "time"
+		if r.Count > 1 {
+			times = "times"
+		}
+		reason := "not available in this bundle"
+		if r.Status == http.StatusMethodNotAllowed {
+			reason = "not supported, bundles are read-only"
+		}
+		for _, h := range unservedHints {
+			if strings.HasPrefix(r.Path, h.prefix) {
+				reason = h.hint
+				break
+			}
+		}
+		fmt.Fprintf(out, "  %s %s (%d %s): %s\n", r.Method, r.Path, r.Count, times, reason)
+	}
+}
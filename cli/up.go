@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func UpCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "up",
+		Short: "Start a session declared in a session file",
+		Long: `Start a session declared in a session file
+
+The session file is validated before anything is started. For example:
+
+  apiVersion: sbctl.replicated.com/v1
+  kind: Session
+  spec:
+    bundle: ./support-bundle.tar.gz
+    mode: shell
+    port: 8443
+    sandbox: true
+    views: ./views.yaml
+
+Relative paths are relative to the session file. Tokens for bundle URLs are read from SBCTL_TOKEN.`,
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			fileName := v.GetString("filename")
+			if fileName == "" {
+				return usererrors.New(usererrors.MissingArgument, nil, "--filename")
+			}
+
+			session, err := sbctl.LoadSession(fileName)
+			if err != nil {
+				return err
+			}
+
+			sessionCmd := ServeCmd()
+			if session.Spec.Mode == sbctl.SessionModeShell {
+				sessionCmd = ShellCmd()
+			}
+			sessionCmd.SetArgs(sessionArgs(session.Spec))
+			return sessionCmd.Execute()
+		},
+	}
+
+	cmd.Flags().StringP("filename", "f", "", "session file to start")
+	return cmd
+}
+
+// sessionArgs returns the serve or shell flags a session spec stands for
+func sessionArgs(spec sbctl.SessionSpec) []string {
+	args := []string{"--support-bundle-location", spec.Bundle}
+	if spec.Port != 0 {
+		args = append(args, fmt.Sprintf("--port=%d", spec.Port))
+	}
+	if spec.Sandbox {
+		args = append(args, "--restricted")
+	}
+	if len(spec.SandboxCommands) > 0 {
+		args = append(args, "--restricted-commands", strings.Join(spec.SandboxCommands, ","))
+	}
+	if spec.Views != "" {
+		args = append(args, "--views", spec.Views)
+	}
+	for _, plugin := range spec.PrinterPlugins {
+		args = append(args, "--printer-plugin", plugin)
+	}
+	if spec.MaxResponseSize != "" {
+		args = append(args, "--max-response-size", spec.MaxResponseSize)
+	}
+	if spec.DisableCompression {
+		args = append(args, "--disable-compression")
+	}
+	if spec.Reload != nil {
+		args = append(args, fmt.Sprintf("--reload=%t", *spec.Reload))
+	}
+	if spec.UsageReport != "" {
+		args = append(args, "--usage-report", spec.UsageReport)
+	}
+	if spec.Debug {
+		args = append(args, "--debug")
+	}
+	return args
+}
@@ -0,0 +1,166 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/output"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
+	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// tailMatchingLines returns the last maxLines lines of fileName which contain substr
+func tailMatchingLines(fileName string, substr string, maxLines int) ([]string, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open file")
+	}
+	defer f.Close()
+
+	lines := []string{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.Contains(line, substr) {
+			continue
+		}
+		lines = append(lines, line)
+		if len(lines) > maxLines {
+			lines = lines[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", fileName)
+	}
+
+	return lines, nil
+}
+
+func sortByCreationTimestamp(items []unstructured.Unstructured) {
+	sort.SliceStable(items, func(i, j int) bool {
+		iT := items[i].GetCreationTimestamp()
+		jT := items[j].GetCreationTimestamp()
+		return iT.Before(&jT)
+	})
+}
+
+func nestedStringOrNone(o unstructured.Unstructured, fields ...string) string {
+	s, found, err := unstructured.NestedFieldNoCopy(o.Object, fields...)
+	if err != nil || !found || s == nil {
+		return "<none>"
+	}
+	str := fmt.Sprint(s)
+	if str == "" {
+		return "<none>"
+	}
+	return str
+}
+
+func nestedInt(o unstructured.Unstructured, fields ...string) int64 {
+	v, found, err := unstructured.NestedFieldNoCopy(o.Object, fields...)
+	if err != nil || !found {
+		return 0
+	}
+	switch n := v.(type) {
+	case int64:
+		return n
+	case float64:
+		return int64(n)
+	}
+	return 0
+}
+
+func nestedStringSliceOrNone(o unstructured.Unstructured, fields ...string) string {
+	s, found, err := unstructured.NestedStringSlice(o.Object, fields...)
+	if err != nil || !found || len(s) == 0 {
+		return "<none>"
+	}
+	return strings.Join(s, ", ")
+}
+
+func nestedStringSliceOrAll(o unstructured.Unstructured, fields ...string) string {
+	s, found, err := unstructured.NestedStringSlice(o.Object, fields...)
+	if err != nil || !found || len(s) == 0 {
+		return "*"
+	}
+	return strings.Join(s, ", ")
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return info.IsDir()
+}
+
+func fileExists(filename string) bool {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return false
+	}
+	return !info.IsDir()
+}
+
+// bundleCollectionTime estimates when the bundle was collected from the most recent event,
+// since bundles do not record the collection time. The current time is used if there are no events.
+func bundleCollectionTime(events []unstructured.Unstructured) time.Time {
+	latest := time.Time{}
+	for _, e := range events {
+		for _, field := range []string{"lastTimestamp", "eventTime", "firstTimestamp"} {
+			s, _, _ := unstructured.NestedString(e.Object, field)
+			t, err := time.Parse(time.RFC3339, s)
+			if err == nil && t.After(latest) {
+				latest = t
+			}
+		}
+	}
+	if latest.IsZero() {
+		return time.Now()
+	}
+	return latest
+}
+
+// eventTimestamp returns when an event was last seen, or the zero time if it has no timestamp
+func eventTimestamp(e unstructured.Unstructured) time.Time {
+	for _, field := range []string{"lastTimestamp", "eventTime", "firstTimestamp"} {
+		s, _, _ := unstructured.NestedString(e.Object, field)
+		if t, err := time.Parse(time.RFC3339, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func valueOrNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return s
+}
+
+// newPrinter returns a printer for human readable output to out, colored as --color asks
+func newPrinter(out io.Writer) (*output.Printer, error) {
+	p, err := output.NewPrinter(out, viper.GetString("color"))
+	if err != nil {
+		return nil, usererrors.New(usererrors.InvalidArgument, err, "--color")
+	}
+	return p, nil
+}
@@ -0,0 +1,253 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const veleroGroup = "velero.io"
+
+func VeleroCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "velero [backup name]",
+		Short: "Show Velero backups and restores in a support bundle",
+		Long: `Show Velero backups and restores in a support bundle.
+
+Without arguments, all backups and restores are listed with their phase and error counts,
+followed by the most recent errors from the Velero logs. When a backup name is given,
+the details of that restore point and the restores created from it are shown.`,
+		Args:          cobra.MaximumNArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			clusterData, cleanup, err := loadClusterData(v)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			backups, err := sbctl.ListResources(clusterData, veleroGroup, "backups")
+			if err != nil {
+				return errors.Wrap(err, "failed to list backups")
+			}
+			restores, err := sbctl.ListResources(clusterData, veleroGroup, "restores")
+			if err != nil {
+				return errors.Wrap(err, "failed to list restores")
+			}
+
+			events, err := sbctl.ListResources(clusterData, "", "events")
+			if err != nil {
+				return errors.Wrap(err, "failed to list events")
+			}
+			tf, err := newTimeFormat(v, bundleCollectionTime(events))
+			if err != nil {
+				return err
+			}
+
+			sortByCreationTimestamp(backups)
+			sortByCreationTimestamp(restores)
+
+			if len(args) == 1 {
+				return printVeleroBackup(os.Stdout, args[0], backups, restores, tf)
+			}
+
+			if len(backups) == 0 && len(restores) == 0 {
+				fmt.Println("No Velero backups or restores found in support bundle")
+				return nil
+			}
+
+			printVeleroBackups(os.Stdout, backups, tf)
+			fmt.Println()
+			printVeleroRestores(os.Stdout, restores, tf)
+
+			maxLines := v.GetInt("log-errors")
+			if maxLines > 0 {
+				fmt.Println()
+				err = printVeleroLogErrors(os.Stdout, clusterData, veleroNamespaces(backups, restores), maxLines)
+				if err != nil {
+					return errors.Wrap(err, "failed to read velero logs")
+				}
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	cmd.Flags().Int("log-errors", 10, "number of most recent error lines to show from each Velero log file. 0 disables log output.")
+	return cmd
+}
+
+func printVeleroBackups(out io.Writer, backups []unstructured.Unstructured, tf timeFormat) {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "BACKUP\tNAMESPACE\tPHASE\tERRORS\tWARNINGS\tSTARTED\tCOMPLETED\tEXPIRES\tSTORAGE LOCATION")
+	for _, b := range backups {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\t%s\t%s\t%s\n",
+			b.GetName(),
+			b.GetNamespace(),
+			nestedStringOrNone(b, "status", "phase"),
+			nestedInt(b, "status", "errors"),
+			nestedInt(b, "status", "warnings"),
+			tf.FormatString(nestedStringOrNone(b, "status", "startTimestamp")),
+			tf.FormatString(nestedStringOrNone(b, "status", "completionTimestamp")),
+			tf.FormatString(nestedStringOrNone(b, "status", "expiration")),
+			nestedStringOrNone(b, "spec", "storageLocation"),
+		)
+	}
+}
+
+func printVeleroRestores(out io.Writer, restores []unstructured.Unstructured, tf timeFormat) {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "RESTORE\tNAMESPACE\tBACKUP\tPHASE\tERRORS\tWARNINGS\tSTARTED\tCOMPLETED")
+	for _, r := range restores {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%s\t%s\n",
+			r.GetName(),
+			r.GetNamespace(),
+			nestedStringOrNone(r, "spec", "backupName"),
+			nestedStringOrNone(r, "status", "phase"),
+			nestedInt(r, "status", "errors"),
+			nestedInt(r, "status", "warnings"),
+			tf.FormatString(nestedStringOrNone(r, "status", "startTimestamp")),
+			tf.FormatString(nestedStringOrNone(r, "status", "completionTimestamp")),
+		)
+	}
+}
+
+func printVeleroBackup(out io.Writer, name string, backups []unstructured.Unstructured, restores []unstructured.Unstructured, tf timeFormat) error {
+	var backup *unstructured.Unstructured
+	for i := range backups {
+		if backups[i].GetName() == name {
+			backup = &backups[i]
+			break
+		}
+	}
+	if backup == nil {
+		return errors.Errorf("backup %q not found in support bundle", name)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 1, ' ', 0)
+	fmt.Fprintf(w, "Name:\t%s\n", backup.GetName())
+	fmt.Fprintf(w, "Namespace:\t%s\n", backup.GetNamespace())
+	fmt.Fprintf(w, "Phase:\t%s\n", nestedStringOrNone(*backup, "status", "phase"))
+	fmt.Fprintf(w, "Errors:\t%d\n", nestedInt(*backup, "status", "errors"))
+	fmt.Fprintf(w, "Warnings:\t%d\n", nestedInt(*backup, "status", "warnings"))
+	if reason := nestedStringOrNone(*backup, "status", "failureReason"); reason != "<none>" {
+		fmt.Fprintf(w, "Failure Reason:\t%s\n", reason)
+	}
+	fmt.Fprintf(w, "Storage Location:\t%s\n", nestedStringOrNone(*backup, "spec", "storageLocation"))
+	fmt.Fprintf(w, "TTL:\t%s\n", nestedStringOrNone(*backup, "spec", "ttl"))
+	fmt.Fprintf(w, "Included Namespaces:\t%s\n", nestedStringSliceOrAll(*backup, "spec", "includedNamespaces"))
+	fmt.Fprintf(w, "Excluded Namespaces:\t%s\n", nestedStringSliceOrNone(*backup, "spec", "excludedNamespaces"))
+	fmt.Fprintf(w, "Included Resources:\t%s\n", nestedStringSliceOrAll(*backup, "spec", "includedResources"))
+	fmt.Fprintf(w, "Excluded Resources:\t%s\n", nestedStringSliceOrNone(*backup, "spec", "excludedResources"))
+	fmt.Fprintf(w, "Started:\t%s\n", tf.FormatString(nestedStringOrNone(*backup, "status", "startTimestamp")))
+	fmt.Fprintf(w, "Completed:\t%s\n", tf.FormatString(nestedStringOrNone(*backup, "status", "completionTimestamp")))
+	fmt.Fprintf(w, "Expires:\t%s\n", tf.FormatString(nestedStringOrNone(*backup, "status", "expiration")))
+	itemsBackedUp := nestedInt(*backup, "status", "progress", "itemsBackedUp")
+	totalItems := nestedInt(*backup, "status", "progress", "totalItems")
+	fmt.Fprintf(w, "Items Backed Up:\t%d/%d\n", itemsBackedUp, totalItems)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	backupRestores := []unstructured.Unstructured{}
+	for _, r := range restores {
+		if nestedStringOrNone(r, "spec", "backupName") == name {
+			backupRestores = append(backupRestores, r)
+		}
+	}
+
+	fmt.Fprintln(out)
+	if len(backupRestores) == 0 {
+		fmt.Fprintln(out, "No restores from this backup found in support bundle")
+		return nil
+	}
+	printVeleroRestores(out, backupRestores, tf)
+
+	return nil
+}
+
+// printVeleroLogErrors prints the last maxLines error lines of every pod log in the given namespaces.
+// Velero logs in logfmt, so errors are lines containing level=error.
+func printVeleroLogErrors(out io.Writer, clusterData sbctl.ClusterData, namespaces []string, maxLines int) error {
+	found := false
+	for _, namespace := range namespaces {
+		logsDir := filepath.Join(clusterData.ClusterResourcesDir, "pods", "logs", namespace)
+		if !isDir(logsDir) {
+			continue
+		}
+
+		err := filepath.Walk(logsDir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() || filepath.Ext(path) != ".log" {
+				return nil
+			}
+
+			errorLines, err := tailMatchingLines(path, "level=error", maxLines)
+			if err != nil {
+				return err
+			}
+			if len(errorLines) == 0 {
+				return nil
+			}
+
+			found = true
+			rel, _ := filepath.Rel(filepath.Join(clusterData.ClusterResourcesDir, "pods", "logs"), path)
+			fmt.Fprintf(out, "Errors in %s:\n", rel)
+			for _, line := range errorLines {
+				fmt.Fprintf(out, "  %s\n", line)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if !found {
+		fmt.Fprintln(out, "No errors found in Velero logs")
+	}
+
+	return nil
+}
+
+// veleroNamespaces returns the namespaces Velero is installed in, defaulting to "velero"
+func veleroNamespaces(objects ...[]unstructured.Unstructured) []string {
+	seen := map[string]bool{}
+	namespaces := []string{}
+	for _, list := range objects {
+		for _, o := range list {
+			if ns := o.GetNamespace(); ns != "" && !seen[ns] {
+				seen[ns] = true
+				namespaces = append(namespaces, ns)
+			}
+		}
+	}
+	if len(namespaces) == 0 {
+		namespaces = append(namespaces, "velero")
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
@@ -0,0 +1,189 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/output"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// webhookTraceResult is the webhooks traced for one object of a manifest
+type webhookTraceResult struct {
+	Object    string               `json:"object"`
+	Operation string               `json:"operation"`
+	Webhooks  []sbctl.WebhookTrace `json:"webhooks"`
+}
+
+func WebhooksCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "webhooks",
+		Short: "Evaluate the admission webhooks of a support bundle",
+		Long: `Evaluate the admission webhooks of a support bundle.
+
+Mutating and validating webhook configurations are read from the bundle when it includes them.
+A webhook that intercepts a request and whose Service has no ready endpoints makes the request fail,
+or wait for the webhook's timeout, which is a common cause of kubectl apply hanging or being rejected.`,
+	}
+	cmd.AddCommand(webhooksTraceCmd())
+	return cmd
+}
+
+func webhooksTraceCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "trace -f <manifest>",
+		Short: "List the admission webhooks that would intercept the objects of a manifest",
+		Long: `List the admission webhooks that would intercept the objects of a manifest.
+
+The rules, namespaceSelector and objectSelector of every webhook are evaluated against each object,
+using the labels of its namespace in the bundle. Match conditions are CEL expressions and are not
+evaluated, webhooks that have them are listed as called. Mutating webhooks are listed in the order
+the API server calls them, validating webhooks are called in parallel after them.`,
+		Example: `  sbctl webhooks trace -s ./support-bundle.tar.gz -f deployment.yaml
+  kubectl create deployment web --image nginx --dry-run=client -o yaml | sbctl webhooks trace -f -`,
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			format := v.GetString("format")
+			if format != "text" && format != "json" {
+				return usererrors.New(usererrors.InvalidArgument, errors.Errorf("unsupported format %q, must be one of: text, json", format), "--format")
+			}
+			operation := strings.ToUpper(v.GetString("operation"))
+			if !containsString([]string{"CREATE", "UPDATE", "DELETE", "CONNECT"}, operation) {
+				return usererrors.New(usererrors.InvalidArgument, errors.Errorf("unsupported operation %q, must be one of: CREATE, UPDATE, DELETE, CONNECT", operation), "--operation")
+			}
+			fileName := v.GetString("filename")
+			if fileName == "" {
+				return usererrors.New(usererrors.InvalidArgument, errors.New("a manifest is required"), "--filename")
+			}
+
+			var in io.Reader = os.Stdin
+			if fileName != "-" {
+				f, err := os.Open(fileName)
+				if err != nil {
+					return errors.Wrap(err, "failed to open manifest")
+				}
+				defer f.Close()
+				in = f
+			}
+			objects, err := sbctl.ReadManifestObjects(in)
+			if err != nil {
+				return err
+			}
+			if len(objects) == 0 {
+				return errors.Errorf("no objects found in %s", fileName)
+			}
+
+			clusterData, cleanup, err := loadClusterData(v)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			tracer, err := sbctl.LoadWebhookTracer(clusterData)
+			if err != nil {
+				return err
+			}
+
+			results := []webhookTraceResult{}
+			for _, obj := range objects {
+				traces, err := tracer.Trace(obj, operation)
+				if err != nil {
+					return err
+				}
+				name := obj.GetName()
+				if obj.GetNamespace() != "" {
+					name = obj.GetNamespace() + "/" + name
+				}
+				results = append(results, webhookTraceResult{
+					Object:    fmt.Sprintf("%s %s", obj.GetKind(), name),
+					Operation: operation,
+					Webhooks:  traces,
+				})
+			}
+
+			if format == "json" {
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				if err := encoder.Encode(results); err != nil {
+					return errors.Wrap(err, "failed to write results")
+				}
+				return nil
+			}
+
+			p, err := newPrinter(os.Stdout)
+			if err != nil {
+				return err
+			}
+			return printWebhookTraces(p, results, v.GetBool("all"))
+		},
+	}
+
+	cmd.Flags().StringP("support-bundle-location", "s", "", "path to support bundle archive, directory, or URL")
+	cmd.Flags().StringP("token", "t", "", "API token for authentication when fetching on-line bundles")
+	cmd.Flags().StringP("filename", "f", "", "manifest of the objects to trace, or - to read it from stdin")
+	cmd.Flags().String("operation", "CREATE", "operation to trace. One of: CREATE, UPDATE, DELETE, CONNECT")
+	cmd.Flags().Bool("all", false, "also list the webhooks that are not called, with the reason")
+	cmd.Flags().String("format", "text", "output format. One of: text, json")
+	return cmd
+}
+
+func printWebhookTraces(p *output.Printer, results []webhookTraceResult, all bool) error {
+	out := p.Writer()
+	for i, result := range results {
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		fmt.Fprintf(out, "%s (%s):\n", p.Bold(result.Object), result.Operation)
+
+		if len(result.Webhooks) == 0 {
+			fmt.Fprintf(out, "  %s\n", p.Faint("No webhook configurations found in support bundle"))
+			continue
+		}
+
+		t := p.NewTable("TYPE", "CONFIGURATION", "WEBHOOK", "FAILURE POLICY", "TIMEOUT", "BACKEND", "NOTE")
+		called := 0
+		for _, w := range result.Webhooks {
+			if !w.Called {
+				if all {
+					t.AddRow(p.Faint(w.Type), p.Faint(w.Configuration), p.Faint(w.Webhook), p.Faint(w.FailurePolicy),
+						p.Faint(fmt.Sprintf("%ds", w.TimeoutSeconds)), p.Faint(w.Backend), p.Faint("not called: "+w.Reason))
+				}
+				continue
+			}
+			called++
+
+			backend := w.Backend
+			note := w.Reason
+			if w.BackendIssue != "" {
+				backend = p.Red(backend)
+				note = strings.TrimPrefix(strings.Join([]string{note, w.BackendIssue}, "; "), "; ")
+				if w.FailurePolicy == "Fail" {
+					note += ", requests are rejected"
+				}
+			}
+			t.AddRow(w.Type, w.Configuration, w.Webhook, w.FailurePolicy, fmt.Sprintf("%ds", w.TimeoutSeconds), backend, valueOrNone(note))
+		}
+		if called == 0 && !all {
+			fmt.Fprintf(out, "  %s\n", p.Green("No admission webhooks intercept this request"))
+			continue
+		}
+		if err := t.Print(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
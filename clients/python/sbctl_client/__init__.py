@@ -0,0 +1,185 @@
+"""Client of the sbctl API, the JSON API for browsing a support bundle that sbctl serves at
+/sbctl/v1 next to the emulated Kubernetes API.
+
+Start a server with ``sbctl serve bundle.tar.gz`` and point the client at the kubeconfig it
+prints::
+
+    from sbctl_client import Client
+
+    c = Client.from_kubeconfig("/tmp/local-kubeconfig-123")
+    pods = c.search(resource="pods", namespace="velero")
+
+Results are plain lists and dicts, which ``pandas.DataFrame`` accepts as they are.
+"""
+
+import json
+import os
+import urllib.error
+import urllib.parse
+import urllib.request
+
+__all__ = ["Client", "APIError"]
+
+API_PREFIX = "/sbctl/v1"
+
+
+class APIError(Exception):
+    """An error response of the sbctl API."""
+
+    def __init__(self, status, message, request_id=None):
+        super().__init__("%s (status %d)" % (message, status))
+        self.status = status
+        self.message = message
+        self.request_id = request_id
+
+
+class Client:
+    """Calls the sbctl API of a running sbctl server."""
+
+    def __init__(self, server, token=None, timeout=300):
+        """server is a URL such as http://127.0.0.1:41235. The token is only needed when the
+        server has views."""
+        self.server = server.rstrip("/")
+        self.token = token
+        self.timeout = timeout
+
+    @classmethod
+    def from_kubeconfig(cls, path=None, context=None):
+        """Returns a client of the server of a context of a kubeconfig written by sbctl, the
+        current context unless one is given. path defaults to $KUBECONFIG."""
+        import yaml
+
+        path = path or os.environ.get("KUBECONFIG")
+        if not path:
+            raise ValueError("no kubeconfig given and KUBECONFIG is not set")
+        with open(path) as f:
+            config = yaml.safe_load(f)
+
+        context = context or config.get("current-context")
+        ctx = _named(config.get("contexts"), context, "context")
+        cluster = _named(config.get("clusters"), ctx["cluster"], "cluster")
+        user = _named(config.get("users"), ctx.get("user"), "user") or {}
+        return cls(cluster["server"], token=user.get("token"))
+
+    def resources(self):
+        """Collected resources and how many objects each has."""
+        return self._get_json("/resources")
+
+    def tree(self):
+        """Object names grouped by namespace and resource."""
+        return self._get_json("/tree")
+
+    def search(self, q=None, resource=None, namespace=None, label_selector=None,
+               annotation_selector=None, limit=None):
+        """Objects whose name contains or matches the glob pattern q. resource can be a list."""
+        if isinstance(resource, (list, tuple)):
+            resource = ",".join(resource)
+        return self._get_json("/search", {
+            "q": q,
+            "resource": resource,
+            "namespace": namespace,
+            "labelSelector": label_selector,
+            "annotationSelector": annotation_selector,
+            "limit": limit,
+        })
+
+    def manifest(self, resource, name, namespace=None, group="core"):
+        """A single object. group is core for the core group."""
+        return self._get_json("/manifests/%s/%s/%s" % (_quote(group or "core"), _quote(resource), _quote(name)),
+                              {"namespace": namespace})
+
+    def container_logs(self, namespace, pod):
+        """Containers of a pod with collected logs."""
+        return self._get_json("/logs/%s/%s" % (_quote(namespace), _quote(pod)))
+
+    def container_log(self, namespace, pod, container, previous=False, tail_lines=None,
+                      since_time=None, limit_bytes=None):
+        """A container log as text. since_time is an RFC 3339 time."""
+        return self._get_text("/logs/%s/%s/%s" % (_quote(namespace), _quote(pod), _quote(container)), {
+            "previous": "true" if previous else None,
+            "tailLines": tail_lines,
+            "sinceTime": since_time,
+            "limitBytes": limit_bytes,
+        })
+
+    def node_logs(self):
+        """Logs of node services such as kubelet, collected by host collectors."""
+        return self._get_json("/node-logs")
+
+    def node_log(self, node, component, file=None, tail_lines=None, since_time=None, limit_bytes=None):
+        """A node service log as text."""
+        return self._get_text("/node-logs/%s/%s" % (_quote(node), _quote(component)), {
+            "file": file,
+            "tailLines": tail_lines,
+            "sinceTime": since_time,
+            "limitBytes": limit_bytes,
+        })
+
+    def audit(self, user=None, verb=None, resource=None, namespace=None, name=None, since=None, until=None):
+        """kube-apiserver audit events, oldest first. verb can be a list."""
+        if isinstance(verb, (list, tuple)):
+            verb = ",".join(verb)
+        return self._get_json("/audit", {
+            "user": user,
+            "verb": verb,
+            "resource": resource,
+            "namespace": namespace,
+            "name": name,
+            "since": since,
+            "until": until,
+        })
+
+    def analysis(self):
+        """Analyzer results."""
+        return self._get_json("/analysis")
+
+    def collector_errors(self):
+        """Errors of collectors that failed, whose data is missing."""
+        return self._get_json("/collector-errors")
+
+    def related(self, kind, name, namespace=None, group=None):
+        """Objects related to an object by owners, selectors and references."""
+        return self._get_json("/related", {"kind": kind, "name": name, "namespace": namespace, "group": group})
+
+    def openapi(self):
+        """The OpenAPI document of the API."""
+        return self._get_json("/openapi.json")
+
+    def _get(self, path, params=None):
+        url = self.server + API_PREFIX + path
+        params = {k: v for k, v in (params or {}).items() if v is not None}
+        if params:
+            url += "?" + urllib.parse.urlencode(params)
+
+        req = urllib.request.Request(url)
+        if self.token:
+            req.add_header("Authorization", "Bearer " + self.token)
+        try:
+            return urllib.request.urlopen(req, timeout=self.timeout).read()
+        except urllib.error.HTTPError as e:
+            message, request_id = e.reason, None
+            try:
+                body = json.loads(e.read())
+                message, request_id = body.get("error", message), body.get("requestId")
+            except ValueError:
+                pass
+            raise APIError(e.code, message, request_id) from None
+
+    def _get_json(self, path, params=None):
+        return json.loads(self._get(path, params))
+
+    def _get_text(self, path, params=None):
+        return self._get(path, params).decode("utf-8", errors="replace")
+
+
+def _quote(value):
+    return urllib.parse.quote(str(value), safe="")
+
+
+def _named(items, name, what):
+    for item in items or []:
+        if item.get("name") == name:
+            return item.get(what)
+    if what == "user":
+        return None
+    raise ValueError("%s %r not found in kubeconfig" % (what, name))
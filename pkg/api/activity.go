@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// activity tracks when the API server last answered a request, so that servers nobody uses any
+// more can be stopped
+var activity = struct {
+	mu     sync.Mutex
+	active int
+	last   time.Time
+}{last: time.Now()}
+
+// trackActivity records the start and end of requests. Requests in progress, such as watches and
+// followed logs, keep the server active. Readiness checks do not, since scripts poll them.
+func trackActivity(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/readyz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		activity.mu.Lock()
+		activity.active++
+		activity.mu.Unlock()
+		defer func() {
+			activity.mu.Lock()
+			activity.active--
+			activity.last = time.Now()
+			activity.mu.Unlock()
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// IdleTime returns how long the API server has not answered any request, or 0 while requests
+// are in progress
+func IdleTime() time.Duration {
+	activity.mu.Lock()
+	defer activity.mu.Unlock()
+	if activity.active > 0 {
+		return 0
+	}
+	return time.Since(activity.last)
+}
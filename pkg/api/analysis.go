@@ -0,0 +1,167 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Analyzer results from analysis.json are served as a synthetic cluster scoped custom resource
+const (
+	analysisGroup        = "troubleshoot.sh"
+	analysisVersion      = "v1beta2"
+	analysisGroupVersion = analysisGroup + "/" + analysisVersion
+	analysisResource     = "analysisresults"
+	analysisKind         = "AnalysisResult"
+)
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+func analysisAPIResource() metav1.APIResource {
+	return metav1.APIResource{
+		Name:         analysisResource,
+		SingularName: strings.ToLower(analysisKind),
+		Namespaced:   false,
+		Kind:         analysisKind,
+		Verbs:        metav1.Verbs{"get", "list"},
+		ShortNames:   []string{"analysis"},
+	}
+}
+
+func analysisAPIGroup() metav1.APIGroup {
+	version := metav1.GroupVersionForDiscovery{
+		GroupVersion: analysisGroupVersion,
+		Version:      analysisVersion,
+	}
+	return metav1.APIGroup{
+		Name:             analysisGroup,
+		Versions:         []metav1.GroupVersionForDiscovery{version},
+		PreferredVersion: version,
+	}
+}
+
+func (h handler) getAnalysisResults(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+	logger.Println("called getAnalysisResults")
+
+	list, err := h.analysisResultList()
+	if err != nil {
+		logger.Error("failed to read analysis results: ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "as=Table") {
+		table, err := analysisResultTable(list)
+		if err != nil {
+			logger.Error("failed to convert analysis results to table: ", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		JSON(w, http.StatusOK, table)
+		return
+	}
+
+	JSON(w, http.StatusOK, list)
+}
+
+func (h handler) getAnalysisResult(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+	logger.Println("called getAnalysisResult")
+
+	name := mux.Vars(r)["name"]
+
+	list, err := h.analysisResultList()
+	if err != nil {
+		logger.Error("failed to read analysis results: ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	for _, item := range list.Items {
+		if item.GetName() == name {
+			item := item
+			JSON(w, http.StatusOK, &item)
+			return
+		}
+	}
+
+	JSON(w, http.StatusNotFound, errorNotFound)
+}
+
+func (h handler) analysisResultList() (*unstructured.UnstructuredList, error) {
+	results, err := sbctl.ReadAnalysis(h.clusterData)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &unstructured.UnstructuredList{}
+	list.SetAPIVersion(analysisGroupVersion)
+	list.SetKind(analysisKind + "List")
+
+	seen := map[string]int{}
+	for _, result := range results {
+		name := strings.Trim(invalidNameChars.ReplaceAllString(strings.ToLower(result.Name), "-"), "-.")
+		if name == "" {
+			name = "analyzer"
+		}
+		seen[name]++
+		if seen[name] > 1 {
+			name = fmt.Sprintf("%s-%d", name, seen[name])
+		}
+
+		item := unstructured.Unstructured{Object: map[string]interface{}{
+			"status": map[string]interface{}{
+				"analyzer": result.Name,
+				"outcome":  result.Outcome(),
+				"severity": result.Severity,
+				"title":    result.Title(),
+				"message":  result.Message(),
+			},
+		}}
+		item.SetAPIVersion(analysisGroupVersion)
+		item.SetKind(analysisKind)
+		item.SetName(name)
+		if len(result.Labels) > 0 {
+			item.SetLabels(result.Labels)
+		}
+		list.Items = append(list.Items, item)
+	}
+
+	return list, nil
+}
+
+func analysisResultTable(list *unstructured.UnstructuredList) (*metav1.Table, error) {
+	table := &metav1.Table{
+		ColumnDefinitions: []metav1.TableColumnDefinition{
+			{Name: "Name", Type: "string", Format: "name"},
+			{Name: "Outcome", Type: "string"},
+			{Name: "Title", Type: "string"},
+			{Name: "Message", Type: "string"},
+		},
+		Rows: []metav1.TableRow{},
+	}
+	table.SetGroupVersionKind(metav1.SchemeGroupVersion.WithKind("Table"))
+
+	for _, item := range list.Items {
+		raw, err := json.Marshal(&item)
+		if err != nil {
+			return nil, err
+		}
+		status, _, _ := unstructured.NestedStringMap(item.Object, "status")
+		table.Rows = append(table.Rows, metav1.TableRow{
+			Cells:  []interface{}{item.GetName(), status["outcome"], status["title"], status["message"]},
+			Object: runtime.RawExtension{Raw: raw},
+		})
+	}
+
+	return table, nil
+}
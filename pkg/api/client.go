@@ -4,31 +4,62 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 
 	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/spf13/viper"
 )
 
-func createConfigFile(endPoint string) (string, error) {
-	ctxTemplate := `
+// KubeConfig returns a kubeconfig for an API server started by sbctl. The token is only needed
+// when the server has views.
+func KubeConfig(endPoint string, token string) string {
+	return KubeConfigContexts([]KubeContext{{Name: sbctl.DefaultClusterName, Server: endPoint}}, token)
+}
+
+// KubeContext is a context of a kubeconfig for API servers started by sbctl
+type KubeContext struct {
+	Name   string
+	Server string
+}
+
+// KubeConfigContexts returns a kubeconfig with a context for each API server, e.g. one for each
+// cluster of a fleet bundle. The first context is the current one.
+func KubeConfigContexts(contexts []KubeContext, token string) string {
+	user := "{}"
+	if token != "" {
+		user = fmt.Sprintf("\n    token: %s", token)
+	}
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, `
 apiVersion: v1
 kind: Config
 preferences: {}
-current-context: default
+current-context: %s
 clusters:
-- name: default
-  cluster:
-    server: %s
-contexts:
-- name: default
-  context:
-    cluster: default
-    user: default
-users:
-- name: default
-  user: {}
-`
-
-	configString := fmt.Sprintf(ctxTemplate, endPoint)
+`, contexts[0].Name)
+	for _, c := range contexts {
+		fmt.Fprintf(b, "- name: %s\n  cluster:\n    server: %s\n", c.Name, c.Server)
+	}
+	fmt.Fprintln(b, "contexts:")
+	for _, c := range contexts {
+		fmt.Fprintf(b, "- name: %s\n  context:\n    cluster: %s\n    user: default\n", c.Name, c.Name)
+	}
+	fmt.Fprintf(b, "users:\n- name: default\n  user: %s\n", user)
+	return b.String()
+}
+
+// createConfigFile writes the kubeconfig of the API servers to a temp file, or to the file set
+// with --kubeconfig-out, and returns its path
+func createConfigFile(contexts []KubeContext) (string, error) {
+	configString := KubeConfigContexts(contexts, serverAdminToken())
+	if out := viper.GetString("kubeconfig-out"); out != "" {
+		if err := os.WriteFile(out, []byte(configString), 0600); err != nil {
+			return "", errors.Wrap(err, "failed to write config file")
+		}
+		return out, nil
+	}
 	kubeconfigFile, err := os.CreateTemp("", "local-kubeconfig-")
 	if err != nil {
 		return "", errors.Wrap(err, "failed to create config file")
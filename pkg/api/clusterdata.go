@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	log "github.com/sirupsen/logrus"
+)
+
+// ClusterDataSource holds the cluster data the API server serves. It can be replaced while the
+// server is running, e.g. when a bundle that is still being collected gains its cluster resources.
+type ClusterDataSource struct {
+	v atomic.Value
+}
+
+// servedClusterData is cluster data with the mapper of the resources the cluster served
+type servedClusterData struct {
+	clusterData sbctl.ClusterData
+	mapper      *sbctl.RESTMapper
+}
+
+func NewClusterDataSource(clusterData sbctl.ClusterData) *ClusterDataSource {
+	s := &ClusterDataSource{}
+	s.Set(clusterData)
+	return s
+}
+
+func (s *ClusterDataSource) Get() sbctl.ClusterData {
+	return s.v.Load().(servedClusterData).clusterData
+}
+
+func (s *ClusterDataSource) Set(clusterData sbctl.ClusterData) {
+	mapper, err := sbctl.LoadRESTMapper(clusterData)
+	if err != nil {
+		log.Warnf("serving built-in resources only, failed to load the resources of the bundle: %v", err)
+		mapper = sbctl.DefaultRESTMapper()
+	}
+	s.v.Store(servedClusterData{clusterData: clusterData, mapper: mapper})
+}
+
+// handler returns a handler for the current cluster data
+func (s *ClusterDataSource) handler() handler {
+	served := s.v.Load().(servedClusterData)
+	return handler{clusterData: served.clusterData, mapper: served.mapper}
+}
+
+// handle calls f with a handler for the cluster data that is current when the request is received
+func (s *ClusterDataSource) handle(f func(handler, http.ResponseWriter, *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		f(s.handler(), w, r)
+	}
+}
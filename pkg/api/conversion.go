@@ -0,0 +1,151 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	eventsv1 "k8s.io/api/events/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/kubernetes/pkg/api/legacyscheme"
+	_ "k8s.io/kubernetes/pkg/apis/apps/install"
+	_ "k8s.io/kubernetes/pkg/apis/autoscaling/install"
+	_ "k8s.io/kubernetes/pkg/apis/batch/install"
+	_ "k8s.io/kubernetes/pkg/apis/core/install"
+	_ "k8s.io/kubernetes/pkg/apis/discovery/install"
+	_ "k8s.io/kubernetes/pkg/apis/events/install"
+	_ "k8s.io/kubernetes/pkg/apis/networking/install"
+	_ "k8s.io/kubernetes/pkg/apis/policy/install"
+	_ "k8s.io/kubernetes/pkg/apis/rbac/install"
+	_ "k8s.io/kubernetes/pkg/apis/storage/install"
+)
+
+// convertToRequestedVersion converts objects read from the bundle to the group version a request
+// asked for, e.g. apps/v1 deployments to apps/v1beta2 for clients pinned to old client libraries,
+// or core events to events.k8s.io/v1. Objects that can't be converted, such as custom resources,
+// are returned as they are.
+func convertToRequestedVersion(obj runtime.Object, gv schema.GroupVersion) runtime.Object {
+	converted, err := convertToVersion(obj, gv)
+	if err != nil {
+		log.Debugf("not converting %T to %s: %v", obj, gv, err)
+		return obj
+	}
+	return converted
+}
+
+func convertToVersion(obj runtime.Object, gv schema.GroupVersion) (runtime.Object, error) {
+	switch o := obj.(type) {
+	case *unstructured.Unstructured:
+		return convertUnstructuredToVersion(o, gv)
+	case *unstructured.UnstructuredList:
+		list := o.DeepCopy()
+		for i := range list.Items {
+			item, err := convertUnstructuredToVersion(&list.Items[i], gv)
+			if err != nil {
+				return nil, err
+			}
+			list.Items[i] = *item
+		}
+		list.SetAPIVersion(gv.String())
+		return list, nil
+	}
+
+	kinds, _, err := legacyscheme.Scheme.ObjectKinds(obj)
+	if err != nil {
+		return nil, err
+	}
+	from := kinds[0]
+	if from.GroupVersion() == gv {
+		return obj, nil
+	}
+	if !legacyscheme.Scheme.Recognizes(gv.WithKind(from.Kind)) {
+		return nil, errors.Errorf("%s is not served in %s", from.Kind, gv)
+	}
+
+	converted, err := convertThroughInternal(obj, from.Group, gv)
+	if err != nil {
+		return nil, err
+	}
+
+	// Items of typed lists have no kind of their own after conversion
+	if meta.IsListType(converted) {
+		items, err := meta.ExtractList(converted)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to extract list")
+		}
+		itemGVK := gv.WithKind(strings.TrimSuffix(from.Kind, "List"))
+		for _, item := range items {
+			item.GetObjectKind().SetGroupVersionKind(itemGVK)
+		}
+	}
+	return converted, nil
+}
+
+func convertUnstructuredToVersion(u *unstructured.Unstructured, gv schema.GroupVersion) (*unstructured.Unstructured, error) {
+	gvk := u.GroupVersionKind()
+	if gvk.GroupVersion() == gv {
+		return u, nil
+	}
+	if !legacyscheme.Scheme.Recognizes(gvk) || !legacyscheme.Scheme.Recognizes(gv.WithKind(gvk.Kind)) {
+		return nil, errors.Errorf("%s is not served in %s", gvk.Kind, gv)
+	}
+
+	typed, err := legacyscheme.Scheme.New(gvk)
+	if err != nil {
+		return nil, err
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, typed); err != nil {
+		return nil, errors.Wrap(err, "failed to convert from unstructured")
+	}
+	converted, err := convertThroughInternal(typed, gvk.Group, gv)
+	if err != nil {
+		return nil, err
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(converted)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert to unstructured")
+	}
+	return &unstructured.Unstructured{Object: content}, nil
+}
+
+// convertThroughInternal converts between two external versions. The scheme only has conversions
+// between each external version and the internal one. Groups that share internal types can be
+// converted between too, such as core events, which are served as events.k8s.io events.
+func convertThroughInternal(obj runtime.Object, group string, gv schema.GroupVersion) (runtime.Object, error) {
+	internal, err := legacyscheme.Scheme.ConvertToVersion(obj, schema.GroupVersion{Group: group, Version: runtime.APIVersionInternal})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert to internal version")
+	}
+	converted, err := legacyscheme.Scheme.ConvertToVersion(internal, gv)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to convert to %s", gv)
+	}
+	return converted, nil
+}
+
+func eventsAPIGroup() metav1.APIGroup {
+	version := metav1.GroupVersionForDiscovery{
+		GroupVersion: eventsv1.SchemeGroupVersion.String(),
+		Version:      eventsv1.SchemeGroupVersion.Version,
+	}
+	return metav1.APIGroup{
+		Name:             eventsv1.GroupName,
+		Versions:         []metav1.GroupVersionForDiscovery{version},
+		PreferredVersion: version,
+	}
+}
+
+func eventsAPIResource() metav1.APIResource {
+	return metav1.APIResource{
+		Name:         "events",
+		SingularName: "event",
+		Namespaced:   true,
+		Kind:         "Event",
+		Verbs:        metav1.Verbs{"get", "list", "watch"},
+		ShortNames:   []string{"ev"},
+	}
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// wellKnownCRDResources returns discovery data of the resources of well-known CRDs in the bundle
+func (h handler) wellKnownCRDResources() []metav1.APIResourceList {
+	lists, err := sbctl.WellKnownCRDResources(h.clusterData)
+	if err != nil {
+		log.Warnf("ignoring well-known custom resources: %v", err)
+		return []metav1.APIResourceList{}
+	}
+	return lists
+}
+
+// wellKnownCRDGroups returns the groups of well-known CRDs with the versions of the resources in
+// the bundle, the first of which is preferred
+func (h handler) wellKnownCRDGroups() []metav1.APIGroup {
+	groups := []metav1.APIGroup{}
+	index := map[string]int{}
+	for _, list := range h.wellKnownCRDResources() {
+		group, version, _ := strings.Cut(list.GroupVersion, "/")
+		gvd := metav1.GroupVersionForDiscovery{GroupVersion: list.GroupVersion, Version: version}
+		i, ok := index[group]
+		if !ok {
+			index[group] = len(groups)
+			groups = append(groups, metav1.APIGroup{
+				Name:             group,
+				Versions:         []metav1.GroupVersionForDiscovery{gvd},
+				PreferredVersion: gvd,
+			})
+			continue
+		}
+		groups[i].Versions = append(groups[i].Versions, gvd)
+	}
+	return groups
+}
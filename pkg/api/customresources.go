@@ -0,0 +1,50 @@
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// getCustomResourceFileListFromDir returns the JSON files in dir, falling back to YAML files when
+// there is no JSON file with the same name.
+func getCustomResourceFileListFromDir(dir string) ([]string, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read dir")
+	}
+
+	filenames := []string{}
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+
+		ext := strings.ToLower(filepath.Ext(file.Name()))
+		switch ext {
+		case ".json":
+			filenames = append(filenames, filepath.Join(dir, file.Name()))
+		case ".yaml", ".yml":
+			base := strings.TrimSuffix(file.Name(), filepath.Ext(file.Name()))
+			if fileExists(filepath.Join(dir, base+".json")) {
+				continue
+			}
+			filenames = append(filenames, filepath.Join(dir, file.Name()))
+		}
+	}
+
+	return filenames, nil
+}
+
+// findJSONOrYAMLFile returns the first existing file out of name.json, name.yaml and name.yml,
+// or an empty string if none exist.
+func findJSONOrYAMLFile(name string) string {
+	for _, ext := range []string{".json", ".yaml", ".yml"} {
+		if fileExists(name + ext) {
+			return name + ext
+		}
+	}
+	return ""
+}
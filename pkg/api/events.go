@@ -0,0 +1,124 @@
+package api
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// AggregatedEventsAnnotation is set on events that stand for several events of the bundle, to
+// how many they are
+const AggregatedEventsAnnotation = "sbctl.replicated.com/aggregated-events"
+
+// combinedEventsPrefix is what the kubelet's event aggregator prefixes messages of similar
+// events with
+const combinedEventsPrefix = "(combined from similar events): "
+
+type eventKey struct {
+	kind      string
+	namespace string
+	name      string
+	uid       string
+	fieldPath string
+	reason    string
+	eventType string
+	source    string
+}
+
+// aggregateEvents combines events with the same reason and type about the same object into one,
+// with the counts added up and the first and last times of all of them, unless --no-aggregate is
+// set. The message is the one of the latest event. Other lists are returned as they are.
+func aggregateEvents(obj runtime.Object) runtime.Object {
+	list, ok := obj.(*corev1.EventList)
+	if !ok || viper.GetBool("no-aggregate") {
+		return obj
+	}
+
+	groups := map[eventKey][]corev1.Event{}
+	keys := []eventKey{}
+	for _, event := range list.Items {
+		key := eventKey{
+			kind:      event.InvolvedObject.Kind,
+			namespace: event.InvolvedObject.Namespace,
+			name:      event.InvolvedObject.Name,
+			uid:       string(event.InvolvedObject.UID),
+			fieldPath: event.InvolvedObject.FieldPath,
+			reason:    event.Reason,
+			eventType: event.Type,
+			source:    event.Source.Component,
+		}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], event)
+	}
+	if len(keys) == len(list.Items) {
+		return list
+	}
+
+	aggregated := list.DeepCopy()
+	aggregated.Items = make([]corev1.Event, 0, len(keys))
+	for _, key := range keys {
+		aggregated.Items = append(aggregated.Items, combineEvents(groups[key]))
+	}
+	return aggregated
+}
+
+func combineEvents(events []corev1.Event) corev1.Event {
+	if len(events) == 1 {
+		return events[0]
+	}
+
+	latest := events[0]
+	var count int32
+	first, last := eventFirstTime(events[0]), eventLastTime(events[0])
+	messages := map[string]bool{}
+	for _, event := range events {
+		count += max(event.Count, 1)
+		if t := eventFirstTime(event); !t.IsZero() && (first.IsZero() || t.Before(first)) {
+			first = t
+		}
+		if t := eventLastTime(event); t.After(last) {
+			last = t
+			latest = event
+		}
+		messages[event.Message] = true
+	}
+
+	combined := *latest.DeepCopy()
+	combined.Count = count
+	combined.FirstTimestamp = metav1.NewTime(first)
+	combined.LastTimestamp = metav1.NewTime(last)
+	if len(messages) > 1 {
+		combined.Message = combinedEventsPrefix + combined.Message
+	}
+	if combined.Annotations == nil {
+		combined.Annotations = map[string]string{}
+	}
+	combined.Annotations[AggregatedEventsAnnotation] = strconv.Itoa(len(events))
+	return combined
+}
+
+func eventFirstTime(event corev1.Event) time.Time {
+	switch {
+	case !event.FirstTimestamp.IsZero():
+		return event.FirstTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	}
+	return event.CreationTimestamp.Time
+}
+
+func eventLastTime(event corev1.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case event.Series != nil && !event.Series.LastObservedTime.IsZero():
+		return event.Series.LastObservedTime.Time
+	}
+	return eventFirstTime(event)
+}
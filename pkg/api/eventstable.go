@@ -0,0 +1,130 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/duration"
+	apicore "k8s.io/kubernetes/pkg/apis/core"
+)
+
+var eventColumns = []metav1.TableColumnDefinition{
+	{Name: "Last Seen", Type: "string", Description: "Time when the event was last observed, with how many times and over how long it was observed"},
+	{Name: "Type", Type: "string", Description: "Type of the event, Normal or Warning"},
+	{Name: "Reason", Type: "string", Description: "Short reason for the transition into the object's current status"},
+	{Name: "Object", Type: "string", Description: "Kind and name of the object the event is about"},
+	{Name: "Subobject", Type: "string", Priority: 1, Description: "Field of the object the event is about, e.g. a container"},
+	{Name: "Source", Type: "string", Priority: 1, Description: "Component and host reporting the event"},
+	{Name: "Message", Type: "string", Description: "Human readable description of the event"},
+	{Name: "First Seen", Type: "string", Priority: 1, Description: "Time when the event was first observed"},
+	{Name: "Count", Type: "integer", Priority: 1, Description: "Number of times the event was observed"},
+	{Name: "Name", Type: "string", Format: "name", Priority: 1, Description: metav1.ObjectMeta{}.SwaggerDoc()["name"]},
+}
+
+// eventsTable prints events with the columns of kubectl get events, as a timeline sorted by when
+// they were last seen. Counts of events in a series and of events sbctl aggregated are shown in
+// the Last Seen column, as in "5m (x3 over 40m)".
+func eventsTable(events []*apicore.Event, now time.Time) *metav1.Table {
+	sorted := append([]*apicore.Event{}, events...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return internalEventLastTime(sorted[i]).Before(internalEventLastTime(sorted[j]))
+	})
+
+	table := &metav1.Table{
+		ColumnDefinitions: eventColumns,
+		Rows:              make([]metav1.TableRow, 0, len(sorted)),
+	}
+	for _, event := range sorted {
+		first := internalEventFirstTime(event)
+		last := internalEventLastTime(event)
+		count := internalEventCount(event)
+
+		lastSeen := eventAge(last, now)
+		if count > 1 {
+			lastSeen = fmt.Sprintf("%s (x%d over %s)", lastSeen, count, eventAge(first, now))
+		}
+
+		table.Rows = append(table.Rows, metav1.TableRow{
+			Cells: []interface{}{
+				lastSeen,
+				event.Type,
+				event.Reason,
+				strings.ToLower(event.InvolvedObject.Kind) + "/" + event.InvolvedObject.Name,
+				event.InvolvedObject.FieldPath,
+				eventSource(event),
+				strings.TrimSpace(event.Message),
+				eventAge(first, now),
+				int64(count),
+				event.Name,
+			},
+			Object: runtime.RawExtension{Object: event},
+		})
+	}
+	return table
+}
+
+func eventListTable(list *apicore.EventList, now time.Time) *metav1.Table {
+	events := make([]*apicore.Event, 0, len(list.Items))
+	for i := range list.Items {
+		events = append(events, &list.Items[i])
+	}
+	table := eventsTable(events, now)
+	table.ResourceVersion = list.ResourceVersion
+	table.Continue = list.Continue
+	table.RemainingItemCount = list.RemainingItemCount
+	return table
+}
+
+// internalEventCount is how many times an event was observed. Events of the events.k8s.io API
+// count their series instead, and have no count at all when they were observed once.
+func internalEventCount(event *apicore.Event) int32 {
+	count := event.Count
+	if event.Series != nil && event.Series.Count > count {
+		count = event.Series.Count
+	}
+	return max(count, 1)
+}
+
+func internalEventFirstTime(event *apicore.Event) time.Time {
+	switch {
+	case !event.FirstTimestamp.IsZero():
+		return event.FirstTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	}
+	return event.CreationTimestamp.Time
+}
+
+func internalEventLastTime(event *apicore.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case event.Series != nil && !event.Series.LastObservedTime.IsZero():
+		return event.Series.LastObservedTime.Time
+	}
+	return internalEventFirstTime(event)
+}
+
+func eventAge(t time.Time, now time.Time) string {
+	if t.IsZero() {
+		return "<unknown>"
+	}
+	return duration.HumanDuration(now.Sub(t))
+}
+
+// eventSource formats the reporting component and host as kubectl does, falling back to the
+// reporting controller of events.k8s.io events
+func eventSource(event *apicore.Event) string {
+	component, host := event.Source.Component, event.Source.Host
+	if component == "" {
+		component, host = event.ReportingController, event.ReportingInstance
+	}
+	if host == "" {
+		return component
+	}
+	return component + ", " + host
+}
@@ -0,0 +1,221 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// Resources declared in the bundle's sbctl-extensions.yaml are served like custom resources
+
+func (h handler) virtualResources() []sbctl.VirtualResource {
+	resources, err := sbctl.ReadExtensions(h.clusterData)
+	if err != nil {
+		// A broken manifest should not break the rest of the bundle
+		log.Warnf("ignoring %s: %v", sbctl.ExtensionsFileName, err)
+		return []sbctl.VirtualResource{}
+	}
+	return resources
+}
+
+func (h handler) findVirtualResource(group string, version string, resource string) *sbctl.VirtualResource {
+	for _, r := range h.virtualResources() {
+		if r.Group == group && r.Version == version && r.Resource == resource {
+			r := r
+			return &r
+		}
+	}
+	return nil
+}
+
+func virtualAPIResource(r sbctl.VirtualResource) metav1.APIResource {
+	return metav1.APIResource{
+		Name:         r.Resource,
+		SingularName: strings.ToLower(r.Kind),
+		Namespaced:   r.Namespaced,
+		Kind:         r.Kind,
+		Verbs:        metav1.Verbs{"get", "list"},
+		ShortNames:   r.ShortNames,
+	}
+}
+
+// virtualAPIGroups returns the groups of virtual resources, with the versions of each group
+func (h handler) virtualAPIGroups() []metav1.APIGroup {
+	groups := []metav1.APIGroup{}
+	index := map[string]int{}
+	for _, r := range h.virtualResources() {
+		version := metav1.GroupVersionForDiscovery{
+			GroupVersion: r.Group + "/" + r.Version,
+			Version:      r.Version,
+		}
+		i, ok := index[r.Group]
+		if !ok {
+			index[r.Group] = len(groups)
+			groups = append(groups, metav1.APIGroup{
+				Name:             r.Group,
+				Versions:         []metav1.GroupVersionForDiscovery{version},
+				PreferredVersion: version,
+			})
+			continue
+		}
+		if !containsGroupVersion(groups[i].Versions, version) {
+			groups[i].Versions = append(groups[i].Versions, version)
+		}
+	}
+	return groups
+}
+
+func containsGroupVersion(versions []metav1.GroupVersionForDiscovery, version metav1.GroupVersionForDiscovery) bool {
+	for _, v := range versions {
+		if v.GroupVersion == version.GroupVersion {
+			return true
+		}
+	}
+	return false
+}
+
+// serveVirtualResource responds to requests for virtual resources. It returns false when the
+// request is for another resource.
+func (h handler) serveVirtualResource(w http.ResponseWriter, r *http.Request) bool {
+	vars := mux.Vars(r)
+	resource := h.findVirtualResource(vars["group"], vars["version"], vars["resource"])
+	if resource == nil {
+		return false
+	}
+
+	logger := requestLogger(r)
+	logger.Println("serving virtual resource ", resource.Resource)
+
+	namespace, name := vars["namespace"], vars["name"]
+	if namespace != "" && !resource.Namespaced {
+		JSON(w, http.StatusNotFound, errorNotFound)
+		return true
+	}
+
+	objects, err := resource.Objects(filepath.Dir(h.clusterData.ExtensionsFile))
+	if err != nil {
+		logger.Error("failed to read virtual resource objects: ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return true
+	}
+
+	selector, err := labels.Parse(r.URL.Query().Get("labelSelector"))
+	if err != nil {
+		JSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid label selector: %v", err)})
+		return true
+	}
+
+	list := &unstructured.UnstructuredList{}
+	list.SetAPIVersion(resource.Group + "/" + resource.Version)
+	list.SetKind(resource.Kind + "List")
+	for _, obj := range objects {
+		if namespace != "" && obj.GetNamespace() != namespace {
+			continue
+		}
+		if name != "" && obj.GetName() != name {
+			continue
+		}
+		if !selector.Matches(labels.Set(obj.GetLabels())) {
+			continue
+		}
+		list.Items = append(list.Items, obj)
+	}
+
+	asTable := strings.Contains(r.Header.Get("Accept"), "as=Table")
+	if name != "" {
+		if len(list.Items) == 0 {
+			JSON(w, http.StatusNotFound, errorNotFound)
+			return true
+		}
+		list.Items = list.Items[:1]
+		if !asTable {
+			JSON(w, http.StatusOK, &list.Items[0])
+			return true
+		}
+	}
+
+	if asTable {
+		table, err := virtualResourceTable(*resource, list)
+		if err != nil {
+			logger.Error("failed to convert virtual resources to table: ", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return true
+		}
+		JSON(w, http.StatusOK, table)
+		return true
+	}
+
+	JSON(w, http.StatusOK, list)
+	return true
+}
+
+func virtualResourceTable(resource sbctl.VirtualResource, list *unstructured.UnstructuredList) (*metav1.Table, error) {
+	table := &metav1.Table{
+		ColumnDefinitions: []metav1.TableColumnDefinition{
+			{Name: "Name", Type: "string", Format: "name"},
+		},
+		Rows: []metav1.TableRow{},
+	}
+	table.SetGroupVersionKind(metav1.SchemeGroupVersion.WithKind("Table"))
+
+	paths := []*jsonpath.JSONPath{}
+	for _, column := range resource.Columns {
+		columnType := column.Type
+		if columnType == "" {
+			columnType = "string"
+		}
+		table.ColumnDefinitions = append(table.ColumnDefinitions, metav1.TableColumnDefinition{Name: column.Name, Type: columnType})
+
+		path := jsonpath.New(column.Name).AllowMissingKeys(true)
+		if err := path.Parse(fmt.Sprintf("{%s}", column.JSONPath)); err != nil {
+			return nil, errors.Wrapf(err, "invalid jsonPath of column %s", column.Name)
+		}
+		paths = append(paths, path)
+	}
+
+	for _, item := range list.Items {
+		raw, err := json.Marshal(&item)
+		if err != nil {
+			return nil, err
+		}
+		cells := []interface{}{item.GetName()}
+		for _, path := range paths {
+			cells = append(cells, jsonPathCell(path, item.Object))
+		}
+		table.Rows = append(table.Rows, metav1.TableRow{
+			Cells:  cells,
+			Object: runtime.RawExtension{Raw: raw},
+		})
+	}
+
+	return table, nil
+}
+
+func jsonPathCell(path *jsonpath.JSONPath, obj map[string]interface{}) interface{} {
+	results, err := path.FindResults(obj)
+	if err != nil || len(results) == 0 || len(results[0]) == 0 {
+		return nil
+	}
+	value := results[0][0].Interface()
+	switch value.(type) {
+	case string, bool, int64, float64, nil:
+		return value
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	return string(data)
+}
@@ -0,0 +1,193 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// serveFallback serves GET requests for resources sbctl has no mapping for from bundle files whose
+// name matches the resource, as raw objects without conversion or table printing. It returns false
+// if there are no such files, for the caller to respond as it would otherwise.
+func (h handler) serveFallback(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+
+	logger := requestLogger(r)
+	vars := mux.Vars(r)
+	group, version, namespace, resource, name := vars["group"], vars["version"], vars["namespace"], vars["resource"], vars["name"]
+	if resource == "" {
+		return false
+	}
+
+	fileNames, err := h.findFallbackResourceFiles(group, resource, namespace)
+	if err != nil {
+		logger.Warnf("fallback lookup of %s failed: %v", resource, err)
+		return false
+	}
+	if len(fileNames) == 0 {
+		return false
+	}
+	logger.Warnf("serving %s.%s from %s, which sbctl has no mapping for", resource, group, strings.Join(fileNames, ", "))
+
+	items := []unstructured.Unstructured{}
+	for _, fileName := range fileNames {
+		if err := r.Context().Err(); err != nil {
+			writeRequestError(w, logger, err)
+			return true
+		}
+		fileItems, err := readRawObjects(fileName)
+		if err != nil {
+			logger.Warnf("fallback decode of %s failed: %v", fileName, err)
+			continue
+		}
+		for _, item := range fileItems {
+			if namespace != "" && item.GetNamespace() != "" && item.GetNamespace() != namespace {
+				continue
+			}
+			items = append(items, item)
+		}
+	}
+
+	if name != "" {
+		for i := range items {
+			if items[i].GetName() == name {
+				JSON(w, http.StatusOK, &items[i])
+				return true
+			}
+		}
+		JSON(w, http.StatusNotFound, errorNotFound)
+		return true
+	}
+
+	list := &unstructured.UnstructuredList{Items: items}
+	list.SetAPIVersion(version)
+	if group != "" {
+		list.SetAPIVersion(group + "/" + version)
+	}
+	kind := resource
+	if len(items) > 0 && items[0].GetKind() != "" {
+		kind = items[0].GetKind()
+	}
+	list.SetKind(kind + "List")
+	JSON(w, http.StatusOK, list)
+	return true
+}
+
+// findFallbackResourceFiles returns the files of the first entry in cluster-resources or
+// cluster-resources/custom-resources that is named after the resource, with or without its group.
+// Names are compared ignoring case, dashes and underscores, so that e.g. pod-disruption-budgets
+// matches poddisruptionbudgets. Directories are expected to have a file per namespace.
+func (h handler) findFallbackResourceFiles(group string, resource string, namespace string) ([]string, error) {
+	matches := func(name string) bool {
+		name = normalizeResourceName(name)
+		return name == normalizeResourceName(resource) || (group != "" && name == normalizeResourceName(resource+"."+group))
+	}
+
+	for _, dir := range []string{h.clusterData.ClusterResourcesDir, filepath.Join(h.clusterData.ClusterResourcesDir, "custom-resources")} {
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read dir")
+		}
+
+		for _, entry := range entries {
+			name := entry.Name()
+			if !entry.IsDir() {
+				name = strings.TrimSuffix(name, filepath.Ext(name))
+			}
+			if !matches(name) {
+				continue
+			}
+
+			path := filepath.Join(dir, entry.Name())
+			if !entry.IsDir() {
+				if fileName := findJSONOrYAMLFile(filepath.Join(dir, name)); fileName != "" {
+					return []string{fileName}, nil
+				}
+				continue
+			}
+			if namespace != "" {
+				if fileName := findJSONOrYAMLFile(filepath.Join(path, namespace)); fileName != "" {
+					return []string{fileName}, nil
+				}
+				return []string{}, nil
+			}
+			return getCustomResourceFileListFromDir(path)
+		}
+	}
+
+	return []string{}, nil
+}
+
+// parseAPIsPath returns the route variables of /apis/{group}/{version}[/namespaces/{namespace}]/{resource}[/{name}]
+// paths, ignoring anything after the name such as subresources
+func parseAPIsPath(path string) (map[string]string, bool) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) < 4 || parts[0] != "apis" {
+		return nil, false
+	}
+
+	vars := map[string]string{"group": parts[1], "version": parts[2]}
+	parts = parts[3:]
+	if len(parts) >= 3 && parts[0] == "namespaces" {
+		vars["namespace"] = parts[1]
+		parts = parts[2:]
+	}
+	vars["resource"] = parts[0]
+	if len(parts) > 1 {
+		vars["name"] = parts[1]
+	}
+	return vars, true
+}
+
+func normalizeResourceName(name string) string {
+	return strings.NewReplacer("-", "", "_", "").Replace(strings.ToLower(name))
+}
+
+// readRawObjects reads the objects of a JSON or YAML file, which can be a list, a single object or
+// several YAML documents
+func readRawObjects(fileName string) ([]unstructured.Unstructured, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", fileName)
+	}
+
+	items := []unstructured.Unstructured{}
+	decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	for {
+		obj := map[string]interface{}{}
+		if err := decoder.Decode(&obj); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "failed to decode %s", fileName)
+		}
+		if len(obj) == 0 {
+			continue
+		}
+
+		u := unstructured.Unstructured{Object: obj}
+		if !u.IsList() {
+			items = append(items, u)
+			continue
+		}
+		list, err := u.ToList()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to convert %s to list", fileName)
+		}
+		items = append(items, list.Items...)
+	}
+
+	return items, nil
+}
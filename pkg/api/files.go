@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// filesPrefix is where the files of the bundle are served with --serve-files, so they can be
+// browsed and downloaded without a copy of the bundle
+const filesPrefix = "/files"
+
+// textFileExtensions are served as plain text, so browsers show them instead of downloading them
+var textFileExtensions = map[string]bool{
+	".log":  true,
+	".txt":  true,
+	".yaml": true,
+	".yml":  true,
+	".out":  true,
+	".conf": true,
+}
+
+func (h handler) getFiles(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+	logger.Println("called getFiles")
+
+	root := h.clusterData.BundleDir
+	if root == "" {
+		JSON(w, http.StatusNotFound, errorNotFound)
+		return
+	}
+
+	rel := path.Clean("/" + strings.TrimPrefix(r.URL.Path, filesPrefix))
+	if !insideDir(root, filepath.Join(root, filepath.FromSlash(rel))) {
+		// Symlinks of bundle directories given by users can point anywhere
+		JSON(w, http.StatusNotFound, errorNotFound)
+		return
+	}
+	if textFileExtensions[strings.ToLower(path.Ext(rel))] {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+
+	http.StripPrefix(filesPrefix, http.FileServer(http.Dir(root))).ServeHTTP(w, r)
+}
+
+// insideDir returns whether fileName, with symlinks resolved, is in dir. Files that don't exist
+// are inside, so that they are not found rather than forbidden.
+func insideDir(dir string, fileName string) bool {
+	resolvedDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return false
+	}
+	resolved, err := filepath.EvalSymlinks(fileName)
+	if err != nil {
+		return true
+	}
+	rel, err := filepath.Rel(resolvedDir, resolved)
+	return err == nil && filepath.IsLocal(rel)
+}
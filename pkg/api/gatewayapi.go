@@ -0,0 +1,56 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Tables of Gateway API objects have the columns of the printer columns of the upstream CRDs
+func init() {
+	age := metav1.TableColumnDefinition{Name: "Age", Type: "date"}
+	hostnames := func(obj *unstructured.Unstructured) ([]interface{}, error) {
+		hosts, _, _ := unstructured.NestedStringSlice(obj.Object, "spec", "hostnames")
+		return []interface{}{strings.Join(hosts, ","), unstructuredAge(obj)}, nil
+	}
+	ageOnly := func(obj *unstructured.Unstructured) ([]interface{}, error) {
+		return []interface{}{unstructuredAge(obj)}, nil
+	}
+
+	RegisterPrinter(schema.GroupKind{Group: sbctl.GatewayAPIGroup, Kind: "GatewayClass"}, Printer{
+		Columns: []metav1.TableColumnDefinition{{Name: "Controller", Type: "string"}, {Name: "Accepted", Type: "string"}, age},
+		PrintRow: func(obj *unstructured.Unstructured) ([]interface{}, error) {
+			controller, _, _ := unstructured.NestedString(obj.Object, "spec", "controllerName")
+			return []interface{}{controller, unstructuredConditionStatus(obj, "Accepted"), unstructuredAge(obj)}, nil
+		},
+	})
+	RegisterPrinter(schema.GroupKind{Group: sbctl.GatewayAPIGroup, Kind: "Gateway"}, Printer{
+		Columns: []metav1.TableColumnDefinition{{Name: "Class", Type: "string"}, {Name: "Address", Type: "string"}, {Name: "Programmed", Type: "string"}, age},
+		PrintRow: func(obj *unstructured.Unstructured) ([]interface{}, error) {
+			class, _, _ := unstructured.NestedString(obj.Object, "spec", "gatewayClassName")
+			address := ""
+			if addresses, _, _ := unstructured.NestedSlice(obj.Object, "status", "addresses"); len(addresses) > 0 {
+				if a, ok := addresses[0].(map[string]interface{}); ok {
+					address = fmt.Sprint(a["value"])
+				}
+			}
+			return []interface{}{class, address, unstructuredConditionStatus(obj, "Programmed"), unstructuredAge(obj)}, nil
+		},
+	})
+	for _, kind := range []string{"HTTPRoute", "GRPCRoute", "TLSRoute"} {
+		RegisterPrinter(schema.GroupKind{Group: sbctl.GatewayAPIGroup, Kind: kind}, Printer{
+			Columns:  []metav1.TableColumnDefinition{{Name: "Hostnames", Type: "string"}, age},
+			PrintRow: hostnames,
+		})
+	}
+	for _, kind := range []string{"ReferenceGrant", "TCPRoute", "UDPRoute"} {
+		RegisterPrinter(schema.GroupKind{Group: sbctl.GatewayAPIGroup, Kind: kind}, Printer{
+			Columns:  []metav1.TableColumnDefinition{age},
+			PrintRow: ageOnly,
+		})
+	}
+}
@@ -0,0 +1,472 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/handlers"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	log "github.com/sirupsen/logrus"
+)
+
+// The hosted mode is a long-running service that accepts bundles uploaded by sbctl submit, and
+// serves the API of each one under its own path, so a support team can share a central sbctl
+// rather than downloading and extracting bundles on their laptops.
+//
+//	POST   /sbctl/v1/bundles?name=&user=&ttl=     upload a bundle archive as the request body, and
+//	                                              issue a token for it
+//	GET    /sbctl/v1/bundles                      hosted bundles, most recently uploaded first
+//	GET    /sbctl/v1/bundles/{id}                 a hosted bundle
+//	DELETE /sbctl/v1/bundles/{id}                 evict a bundle and remove its files
+//	GET    /sbctl/v1/bundles/{id}/tokens          tokens of a bundle that have not expired
+//	POST   /sbctl/v1/bundles/{id}/tokens?user=&ttl=
+//	                                              issue another token for a bundle
+//	DELETE /sbctl/v1/bundles/{id}/tokens/{token}  revoke a token by its ID
+//	       /bundles/{id}/...                      the Kubernetes and sbctl APIs of a hosted bundle
+//	GET    /metrics                               bundles, disk usage and evictions in the
+//	                                              Prometheus text format
+//
+// The /sbctl/v1/bundles API and /metrics require the admin token. The API of a bundle requires
+// a token of that bundle, so customer data is only visible to who it was shared with, until the
+// token expires. Uploads, evictions, tokens and accesses are recorded in the audit log.
+//
+// Bundles are extracted into a directory of the data dir named after their ID, next to a
+// bundle.json file with their metadata and a tokens.json file with the SHA-256 of their tokens,
+// and are served again when the service restarts. Bundles older than MaxAge, and the least
+// recently accessed bundles when bundles use more than MaxDiskUsage, are evicted by the garbage
+// collection.
+const hostedBundlesPrefix = "/bundles"
+
+const hostedBundleMetadataFile = "bundle.json"
+
+// defaultMaxExtractedSize is the largest total size of the files of a bundle archive that is
+// accepted unless the host sets another
+const defaultMaxExtractedSize = 100 << 30
+
+// HostedBundle is a bundle uploaded to the hosted mode
+type HostedBundle struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Path is where the bundle's API is served, relative to the service's URL
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	Uploaded time.Time `json:"uploaded"`
+	// DiskUsage is the size of the bundle's files in the data dir
+	DiskUsage int64 `json:"diskUsage,omitempty"`
+	// Token is the token issued when the bundle is uploaded
+	Token *HostedToken `json:"token,omitempty"`
+}
+
+type hostedBundle struct {
+	HostedBundle
+	handler http.Handler
+	tokens  []hostedToken
+	// lastAccess is when the bundle was last accessed, in Unix nanoseconds
+	lastAccess atomic.Int64
+}
+
+// BundleHost serves the bundles uploaded to the hosted mode
+type BundleHost struct {
+	dataDir   string
+	logOutput io.Writer
+	// MaxUploadSize is the largest bundle archive accepted, in bytes. 0 means no limit.
+	MaxUploadSize int64
+	// MaxExtractedSize is the largest total size of the files of an accepted bundle archive, in
+	// bytes, which compression can make much larger than the archive. 0 means no limit.
+	MaxExtractedSize int64
+	// AdminToken is required by the /sbctl/v1/bundles API, and can access all bundles
+	AdminToken string
+	// TokenTTL is how long bundle tokens are valid when the request does not set a ttl
+	TokenTTL time.Duration
+	// AuditLog is written a JSON line for every upload, eviction, token and access. No audit
+	// log is written when nil.
+	AuditLog io.Writer
+	// MaxAge is how long bundles are kept after they are uploaded. 0 means forever.
+	MaxAge time.Duration
+	// MaxDiskUsage is how many bytes bundles can use in the data dir before the least recently
+	// accessed ones are evicted. 0 means no limit.
+	MaxDiskUsage int64
+
+	mu      sync.RWMutex
+	bundles map[string]*hostedBundle
+	metrics hostedMetrics
+	auditMu sync.Mutex
+}
+
+// NewBundleHost returns a host keeping uploaded bundles in dataDir, with a random admin token and
+// bundle tokens valid for a day. Bundles uploaded to an earlier host with the same data dir are
+// served again.
+func NewBundleHost(dataDir string, logOutput io.Writer) (*BundleHost, error) {
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return nil, errors.Wrap(err, "failed to create data dir")
+	}
+
+	adminToken, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	h := &BundleHost{
+		dataDir:          dataDir,
+		logOutput:        logOutput,
+		AdminToken:       adminToken,
+		TokenTTL:         24 * time.Hour,
+		MaxExtractedSize: defaultMaxExtractedSize,
+		bundles:          map[string]*hostedBundle{},
+		metrics:          hostedMetrics{evictions: map[string]int64{}, evictedBytes: map[string]int64{}},
+	}
+
+	entries, err := os.ReadDir(dataDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read data dir")
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		b, err := h.loadBundle(entry.Name())
+		if err != nil {
+			log.Warnf("Not serving bundle %s: %v", entry.Name(), err)
+			continue
+		}
+		h.bundles[b.ID] = b
+	}
+
+	return h, nil
+}
+
+// Bundles returns the hosted bundles, most recently uploaded first
+func (h *BundleHost) Bundles() []HostedBundle {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	bundles := make([]HostedBundle, 0, len(h.bundles))
+	for _, b := range h.bundles {
+		bundles = append(bundles, b.HostedBundle)
+	}
+	sort.Slice(bundles, func(i, j int) bool {
+		return bundles[i].Uploaded.After(bundles[j].Uploaded)
+	})
+	return bundles
+}
+
+// Handler returns the handler of the hosted mode's API and of the hosted bundles
+func (h *BundleHost) Handler() http.Handler {
+	r := mux.NewRouter()
+
+	bundlesRouter := r.PathPrefix(sbctlAPIPrefix + "/bundles").Subrouter()
+	bundlesRouter.Use(func(next http.Handler) http.Handler {
+		return withRequestID(handlers.CustomLoggingHandler(h.logOutput, next, writeLogWithRequestID))
+	})
+	bundlesRouter.Use(h.requireAdmin)
+	bundlesRouter.HandleFunc("", h.postBundle).Methods(http.MethodPost)
+	bundlesRouter.HandleFunc("", h.getBundles).Methods(http.MethodGet)
+	bundlesRouter.HandleFunc("/{id}", h.getBundle).Methods(http.MethodGet)
+	bundlesRouter.HandleFunc("/{id}", h.deleteBundle).Methods(http.MethodDelete)
+	bundlesRouter.HandleFunc("/{id}/tokens", h.getTokens).Methods(http.MethodGet)
+	bundlesRouter.HandleFunc("/{id}/tokens", h.postToken).Methods(http.MethodPost)
+	bundlesRouter.HandleFunc("/{id}/tokens/{token}", h.deleteToken).Methods(http.MethodDelete)
+
+	// Metrics tell how many bundles are hosted and how large they are, which is not for anyone
+	// who can reach the service
+	r.Handle("/metrics", h.requireAdmin(http.HandlerFunc(h.getMetrics))).Methods(http.MethodGet)
+	r.PathPrefix(hostedBundlesPrefix + "/{id}/").HandlerFunc(h.serveBundle)
+	return r
+}
+
+func (h *BundleHost) postBundle(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+	logger.Println("called postBundle")
+
+	id, err := randomToken()
+	if err != nil {
+		logger.Error("failed to generate bundle ID: ", err)
+		JSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to generate bundle ID"})
+		return
+	}
+	id = id[:12]
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		name = id
+	}
+	ttl, err := h.tokenTTL(r)
+	if err != nil {
+		JSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+
+	body := r.Body
+	if h.MaxUploadSize > 0 {
+		body = http.MaxBytesReader(w, r.Body, h.MaxUploadSize)
+	}
+
+	b, err := h.addBundle(id, name, body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) || errors.Is(err, sbctl.ErrBundleTooLarge) {
+			JSON(w, http.StatusRequestEntityTooLarge, errorResponse{Error: err.Error()})
+			return
+		}
+		logger.Error("failed to add bundle: ", err)
+		JSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+
+	h.mu.Lock()
+	h.bundles[b.ID] = b
+	h.mu.Unlock()
+	h.recordAudit(hostedAuditEvent{Action: "upload", Bundle: b.ID, Token: "admin"})
+
+	token, err := h.issueToken(b, r.URL.Query().Get("user"), ttl)
+	if err != nil {
+		logger.Error("failed to issue token: ", err)
+		JSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to issue token"})
+		return
+	}
+	h.recordAudit(hostedAuditEvent{Action: "issue-token", Bundle: b.ID, Token: token.ID, User: token.User})
+
+	log.Infof("Hosting bundle %s (%s) at %s", b.Name, b.ID, b.Path)
+	h.CollectGarbage()
+	uploaded := b.HostedBundle
+	uploaded.Token = &token
+	JSON(w, http.StatusCreated, uploaded)
+}
+
+func (h *BundleHost) getBundles(w http.ResponseWriter, r *http.Request) {
+	requestLogger(r).Println("called getBundles")
+
+	JSON(w, http.StatusOK, h.Bundles())
+}
+
+func (h *BundleHost) getBundle(w http.ResponseWriter, r *http.Request) {
+	requestLogger(r).Println("called getBundle")
+
+	b := h.bundle(mux.Vars(r)["id"])
+	if b == nil {
+		JSON(w, http.StatusNotFound, errorNotFound)
+		return
+	}
+	JSON(w, http.StatusOK, b.HostedBundle)
+}
+
+// deleteBundle stops serving a bundle and removes its files
+func (h *BundleHost) deleteBundle(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+	logger.Println("called deleteBundle")
+
+	err := h.evict(mux.Vars(r)["id"], evictionReasonAdmin)
+	if errors.Is(err, os.ErrNotExist) {
+		JSON(w, http.StatusNotFound, errorNotFound)
+		return
+	} else if err != nil {
+		logger.Error("failed to evict bundle: ", err)
+		JSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to evict bundle"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *BundleHost) getTokens(w http.ResponseWriter, r *http.Request) {
+	requestLogger(r).Println("called getTokens")
+
+	b := h.bundle(mux.Vars(r)["id"])
+	if b == nil {
+		JSON(w, http.StatusNotFound, errorNotFound)
+		return
+	}
+	JSON(w, http.StatusOK, h.listTokens(b))
+}
+
+func (h *BundleHost) postToken(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+	logger.Println("called postToken")
+
+	b := h.bundle(mux.Vars(r)["id"])
+	if b == nil {
+		JSON(w, http.StatusNotFound, errorNotFound)
+		return
+	}
+	ttl, err := h.tokenTTL(r)
+	if err != nil {
+		JSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+
+	token, err := h.issueToken(b, r.URL.Query().Get("user"), ttl)
+	if err != nil {
+		logger.Error("failed to issue token: ", err)
+		JSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to issue token"})
+		return
+	}
+	h.recordAudit(hostedAuditEvent{Action: "issue-token", Bundle: b.ID, Token: token.ID, User: token.User})
+	JSON(w, http.StatusCreated, token)
+}
+
+func (h *BundleHost) deleteToken(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+	logger.Println("called deleteToken")
+
+	b := h.bundle(mux.Vars(r)["id"])
+	if b == nil {
+		JSON(w, http.StatusNotFound, errorNotFound)
+		return
+	}
+
+	id := mux.Vars(r)["token"]
+	found, err := h.revokeToken(b, id)
+	if err != nil {
+		logger.Error("failed to revoke token: ", err)
+		JSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to revoke token"})
+		return
+	}
+	if !found {
+		JSON(w, http.StatusNotFound, errorNotFound)
+		return
+	}
+	h.recordAudit(hostedAuditEvent{Action: "revoke-token", Bundle: b.ID, Token: id})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serveBundle passes requests with a token of the bundle to the bundle's API server handler
+func (h *BundleHost) serveBundle(w http.ResponseWriter, r *http.Request) {
+	b := h.bundle(mux.Vars(r)["id"])
+	if b == nil {
+		JSON(w, http.StatusNotFound, errorNotFound)
+		return
+	}
+
+	token, ok := h.authorizeBundle(b, r)
+	if !ok {
+		h.recordAudit(hostedAuditEvent{Action: "denied", Bundle: b.ID, Method: r.Method, Path: r.URL.Path})
+		unauthorizedBundle(w)
+		return
+	}
+	h.recordAudit(hostedAuditEvent{Action: "access", Bundle: b.ID, Token: token.ID, User: token.User, Method: r.Method, Path: strings.TrimPrefix(r.URL.Path, b.Path)})
+	b.lastAccess.Store(time.Now().UnixNano())
+
+	http.StripPrefix(b.Path, b.handler).ServeHTTP(w, r)
+}
+
+// tokenTTL returns the ttl query parameter of the request, or the default TTL
+func (h *BundleHost) tokenTTL(r *http.Request) (time.Duration, error) {
+	value := r.URL.Query().Get("ttl")
+	if value == "" {
+		return h.TokenTTL, nil
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl <= 0 {
+		return 0, errors.Errorf("invalid ttl %q, must be a positive duration such as 8h", value)
+	}
+	return ttl, nil
+}
+
+func (h *BundleHost) bundle(id string) *hostedBundle {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.bundles[id]
+}
+
+// addBundle extracts the bundle archive read from r into the data dir
+func (h *BundleHost) addBundle(id string, name string, r io.Reader) (*hostedBundle, error) {
+	dir := filepath.Join(h.dataDir, id)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "failed to create bundle dir")
+	}
+
+	b, err := func() (*hostedBundle, error) {
+		archive := filepath.Join(dir, "bundle.tar.gz")
+		f, err := os.Create(archive)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create archive file")
+		}
+		size, err := io.Copy(f, r)
+		f.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to receive bundle")
+		}
+
+		if err := sbctl.ExtractBundleLimited(archive, filepath.Join(dir, "bundle"), h.MaxExtractedSize); err != nil {
+			return nil, errors.Wrap(err, "failed to extract bundle")
+		}
+		_ = os.Remove(archive)
+
+		metadata, err := json.Marshal(HostedBundle{
+			ID:       id,
+			Name:     name,
+			Path:     hostedBundlesPrefix + "/" + id,
+			Size:     size,
+			Uploaded: time.Now().UTC(),
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to marshal bundle metadata")
+		}
+		if err := os.WriteFile(filepath.Join(dir, hostedBundleMetadataFile), metadata, 0600); err != nil {
+			return nil, errors.Wrap(err, "failed to write bundle metadata")
+		}
+
+		return h.loadBundle(id)
+	}()
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	return b, nil
+}
+
+// loadBundle reads the metadata and cluster data of the bundle with the ID in the data dir.
+// Bundles collected with support-bundle-kit are converted the first time they are loaded.
+func (h *BundleHost) loadBundle(id string) (*hostedBundle, error) {
+	dir := filepath.Join(h.dataDir, id)
+	data, err := os.ReadFile(filepath.Join(dir, hostedBundleMetadataFile))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read bundle metadata")
+	}
+	b := &hostedBundle{}
+	if err := json.Unmarshal(data, &b.HostedBundle); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal bundle metadata")
+	}
+	if b.ID != id {
+		return nil, errors.Errorf("bundle metadata has ID %q, expected %q", b.ID, id)
+	}
+
+	clusterData, err := sbctl.FindClusterData(filepath.Join(dir, "bundle"))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find cluster data")
+	}
+	if clusterData.ClusterResourcesDir == "" && clusterData.SupportBundleKitDir != "" {
+		convertedDir := filepath.Join(dir, "converted")
+		if pathExists(convertedDir) {
+			clusterData, err = sbctl.FindClusterData(convertedDir)
+		} else {
+			clusterData, err = sbctl.ConvertSupportBundleKit(clusterData.SupportBundleKitDir, convertedDir)
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to convert support-bundle-kit bundle")
+		}
+	}
+	if clusterData.ClusterResourcesDir == "" {
+		return nil, errors.New("no cluster resources found in bundle")
+	}
+
+	b.tokens, err = loadTokens(dir)
+	if err != nil {
+		return nil, err
+	}
+	b.DiskUsage, err = dirSize(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get disk usage")
+	}
+	// Bundles loaded again after a restart count as accessed when they were uploaded
+	b.lastAccess.Store(b.Uploaded.UnixNano())
+	b.handler = newServerHandler(NewClusterDataSource(clusterData), h.logOutput)
+	return b, nil
+}
@@ -0,0 +1,225 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const hostedTokensFile = "tokens.json"
+
+// HostedToken grants access to a single hosted bundle until it expires. Token is only set when
+// the token is issued, the service keeps the SHA-256 of tokens only.
+type HostedToken struct {
+	ID      string    `json:"id"`
+	User    string    `json:"user,omitempty"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+	Token   string    `json:"token,omitempty"`
+}
+
+type hostedToken struct {
+	HostedToken
+	SHA256 string `json:"sha256"`
+}
+
+func (t hostedToken) expired(now time.Time) bool {
+	return !now.Before(t.Expires)
+}
+
+// hostedAuditEvent is a line of the audit log of the hosted mode, recording who uploaded,
+// accessed and evicted bundles, and which tokens were issued and revoked
+type hostedAuditEvent struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	Bundle string    `json:"bundle,omitempty"`
+	// Token is the ID of the bundle token used or changed, or admin for the admin token
+	Token  string `json:"token,omitempty"`
+	User   string `json:"user,omitempty"`
+	Method string `json:"method,omitempty"`
+	Path   string `json:"path,omitempty"`
+	// Reason is why a bundle was evicted
+	Reason string `json:"reason,omitempty"`
+}
+
+// recordAudit writes an audit event to the audit log as a JSON line
+func (h *BundleHost) recordAudit(event hostedAuditEvent) {
+	if h.AuditLog == nil {
+		return
+	}
+	event.Time = time.Now().UTC()
+	line, err := json.Marshal(event)
+	if err != nil {
+		log.Warnf("failed to marshal audit event: %v", err)
+		return
+	}
+
+	h.auditMu.Lock()
+	defer h.auditMu.Unlock()
+	if _, err := h.AuditLog.Write(append(line, '\n')); err != nil {
+		log.Warnf("failed to write audit event: %v", err)
+	}
+}
+
+func bearerToken(r *http.Request) string {
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// requireAdmin is a middleware that only lets requests with the admin token through
+func (h *BundleHost) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !tokensEqual(bearerToken(r), h.AdminToken) {
+			h.recordAudit(hostedAuditEvent{Action: "denied", Method: r.Method, Path: r.URL.Path})
+			JSON(w, http.StatusUnauthorized, errorResponse{Error: "the admin token is required"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorizeBundle returns the token a request to a hosted bundle was made with, or false when
+// the request has no valid token of the bundle. The admin token can access all bundles.
+func (h *BundleHost) authorizeBundle(b *hostedBundle, r *http.Request) (HostedToken, bool) {
+	token := bearerToken(r)
+	if tokensEqual(token, h.AdminToken) {
+		return HostedToken{ID: "admin"}, true
+	}
+	if token == "" {
+		return HostedToken{}, false
+	}
+
+	sum := hashToken(token)
+	now := time.Now()
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, t := range b.tokens {
+		if tokensEqual(sum, t.SHA256) && !t.expired(now) {
+			return t.HostedToken, true
+		}
+	}
+	return HostedToken{}, false
+}
+
+// issueToken adds a token for the bundle, valid for ttl
+func (h *BundleHost) issueToken(b *hostedBundle, user string, ttl time.Duration) (HostedToken, error) {
+	token, err := randomToken()
+	if err != nil {
+		return HostedToken{}, err
+	}
+	sum := hashToken(token)
+	now := time.Now().UTC()
+	t := hostedToken{
+		HostedToken: HostedToken{
+			ID:      sum[:8],
+			User:    user,
+			Created: now,
+			Expires: now.Add(ttl),
+		},
+		SHA256: sum,
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	tokens := append(unexpiredTokens(b.tokens, now), t)
+	if err := h.saveTokens(b, tokens); err != nil {
+		return HostedToken{}, err
+	}
+	b.tokens = tokens
+
+	issued := t.HostedToken
+	issued.Token = token
+	return issued, nil
+}
+
+// revokeToken removes a token of the bundle, and returns false when the bundle has no such token
+func (h *BundleHost) revokeToken(b *hostedBundle, id string) (bool, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	tokens := []hostedToken{}
+	found := false
+	for _, t := range b.tokens {
+		if t.ID == id {
+			found = true
+			continue
+		}
+		tokens = append(tokens, t)
+	}
+	if !found {
+		return false, nil
+	}
+	if err := h.saveTokens(b, tokens); err != nil {
+		return false, err
+	}
+	b.tokens = tokens
+	return true, nil
+}
+
+// listTokens returns the tokens of the bundle that have not expired, without their values
+func (h *BundleHost) listTokens(b *hostedBundle) []HostedToken {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	tokens := []HostedToken{}
+	for _, t := range unexpiredTokens(b.tokens, time.Now()) {
+		tokens = append(tokens, t.HostedToken)
+	}
+	return tokens
+}
+
+func unexpiredTokens(tokens []hostedToken, now time.Time) []hostedToken {
+	unexpired := []hostedToken{}
+	for _, t := range tokens {
+		if !t.expired(now) {
+			unexpired = append(unexpired, t)
+		}
+	}
+	return unexpired
+}
+
+// saveTokens writes the tokens of the bundle next to its metadata, so they are valid after the
+// service restarts
+func (h *BundleHost) saveTokens(b *hostedBundle, tokens []hostedToken) error {
+	data, err := json.Marshal(tokens)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal tokens")
+	}
+	if err := os.WriteFile(filepath.Join(h.dataDir, b.ID, hostedTokensFile), data, 0600); err != nil {
+		return errors.Wrap(err, "failed to write tokens")
+	}
+	return nil
+}
+
+// loadTokens reads the tokens of the bundle in dir. Bundles without tokens can only be accessed
+// with the admin token.
+func loadTokens(dir string) ([]hostedToken, error) {
+	data, err := os.ReadFile(filepath.Join(dir, hostedTokensFile))
+	if os.IsNotExist(err) {
+		return []hostedToken{}, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to read tokens")
+	}
+	tokens := []hostedToken{}
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal tokens")
+	}
+	return tokens, nil
+}
+
+func unauthorizedBundle(w http.ResponseWriter) {
+	viewStatus(w, http.StatusUnauthorized, metav1.StatusReasonUnauthorized, "a valid bearer token of the bundle is required")
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Reasons bundles are evicted for, as recorded in the audit log and the eviction metrics
+const (
+	evictionReasonAdmin = "admin"
+	evictionReasonAge   = "age"
+	evictionReasonDisk  = "disk"
+)
+
+// hostedMetrics counts the evictions of the hosted mode by reason
+type hostedMetrics struct {
+	evictions    map[string]int64
+	evictedBytes map[string]int64
+}
+
+// CollectGarbage evicts bundles uploaded longer than MaxAge ago, then evicts the least recently
+// accessed bundles while the bundles use more than MaxDiskUsage bytes. The most recently accessed
+// bundle is not evicted for disk usage, so a bundle larger than MaxDiskUsage can still be used
+// until it is older than MaxAge. It returns the evicted bundles.
+func (h *BundleHost) CollectGarbage() []HostedBundle {
+	now := time.Now()
+	evicted := []HostedBundle{}
+
+	h.mu.RLock()
+	bundles := make([]*hostedBundle, 0, len(h.bundles))
+	for _, b := range h.bundles {
+		bundles = append(bundles, b)
+	}
+	h.mu.RUnlock()
+
+	kept := []*hostedBundle{}
+	for _, b := range bundles {
+		if h.MaxAge > 0 && now.Sub(b.Uploaded) > h.MaxAge {
+			if err := h.evict(b.ID, evictionReasonAge); err != nil {
+				log.Warnf("Failed to evict bundle %s: %v", b.ID, err)
+				continue
+			}
+			evicted = append(evicted, b.HostedBundle)
+			continue
+		}
+		kept = append(kept, b)
+	}
+
+	if h.MaxDiskUsage <= 0 {
+		return evicted
+	}
+
+	usage := int64(0)
+	for _, b := range kept {
+		usage += b.DiskUsage
+	}
+	sort.Slice(kept, func(i, j int) bool {
+		return kept[i].lastAccess.Load() < kept[j].lastAccess.Load()
+	})
+	for i := 0; usage > h.MaxDiskUsage && i < len(kept)-1; i++ {
+		b := kept[i]
+		if err := h.evict(b.ID, evictionReasonDisk); err != nil {
+			log.Warnf("Failed to evict bundle %s: %v", b.ID, err)
+			continue
+		}
+		usage -= b.DiskUsage
+		evicted = append(evicted, b.HostedBundle)
+	}
+
+	return evicted
+}
+
+// RunGarbageCollection collects garbage every interval until stop is closed
+func (h *BundleHost) RunGarbageCollection(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			h.CollectGarbage()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// evict stops serving a bundle and removes its files
+func (h *BundleHost) evict(id string, reason string) error {
+	h.mu.Lock()
+	b := h.bundles[id]
+	delete(h.bundles, id)
+	h.mu.Unlock()
+	if b == nil {
+		return os.ErrNotExist
+	}
+
+	if err := os.RemoveAll(filepath.Join(h.dataDir, id)); err != nil {
+		return errors.Wrap(err, "failed to remove bundle")
+	}
+
+	h.mu.Lock()
+	h.metrics.evictions[reason]++
+	h.metrics.evictedBytes[reason] += b.DiskUsage
+	h.mu.Unlock()
+	h.recordAudit(hostedAuditEvent{Action: "evict", Bundle: id, Reason: reason})
+
+	log.Infof("Evicted bundle %s (%s), reason: %s", b.Name, b.ID, reason)
+	return nil
+}
+
+// getMetrics serves the number and disk usage of hosted bundles, and the evictions, in the
+// Prometheus text format
+func (h *BundleHost) getMetrics(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	count, usage := len(h.bundles), int64(0)
+	for _, b := range h.bundles {
+		usage += b.DiskUsage
+	}
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "# HELP sbctl_hosted_bundles Number of hosted bundles.\n# TYPE sbctl_hosted_bundles gauge\nsbctl_hosted_bundles %d\n", count)
+	fmt.Fprintf(b, "# HELP sbctl_hosted_bundles_bytes Disk space used by hosted bundles.\n# TYPE sbctl_hosted_bundles_bytes gauge\nsbctl_hosted_bundles_bytes %d\n", usage)
+	fmt.Fprintf(b, "# HELP sbctl_hosted_evictions_total Number of evicted bundles by reason.\n# TYPE sbctl_hosted_evictions_total counter\n")
+	for _, reason := range []string{evictionReasonAdmin, evictionReasonAge, evictionReasonDisk} {
+		fmt.Fprintf(b, "sbctl_hosted_evictions_total{reason=%q} %d\n", reason, h.metrics.evictions[reason])
+	}
+	fmt.Fprintf(b, "# HELP sbctl_hosted_evicted_bytes_total Disk space freed by evicting bundles by reason.\n# TYPE sbctl_hosted_evicted_bytes_total counter\n")
+	for _, reason := range []string{evictionReasonAdmin, evictionReasonAge, evictionReasonDisk} {
+		fmt.Fprintf(b, "sbctl_hosted_evicted_bytes_total{reason=%q} %d\n", reason, h.metrics.evictedBytes[reason])
+	}
+	h.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_, _ = w.Write([]byte(b.String()))
+}
+
+// dirSize returns the size of the files in dir
+func dirSize(dir string) (int64, error) {
+	size := int64(0)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Impersonation headers sent by kubectl --as, --as-group and --as-uid
+const (
+	impersonateUserHeader        = "Impersonate-User"
+	impersonateGroupHeader       = "Impersonate-Group"
+	impersonateUIDHeader         = "Impersonate-Uid"
+	impersonateExtraHeaderPrefix = "Impersonate-Extra-"
+)
+
+const (
+	adminUser          = "sbctl"
+	viewUserPrefix     = "sbctl:view:"
+	authenticatedGroup = "system:authenticated"
+)
+
+type viewKey struct{}
+
+// withView returns r with the view its token belongs to
+func withView(r *http.Request, view *View) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), viewKey{}, view))
+}
+
+// requestView returns the view of the token of r, or nil when the request has full access
+func requestView(r *http.Request) *View {
+	view, _ := r.Context().Value(viewKey{}).(*View)
+	return view
+}
+
+// impersonatedUser returns the user r impersonates, if any
+func impersonatedUser(r *http.Request) (authenticationv1.UserInfo, bool) {
+	username := r.Header.Get(impersonateUserHeader)
+	if username == "" {
+		return authenticationv1.UserInfo{}, false
+	}
+
+	user := authenticationv1.UserInfo{
+		Username: username,
+		UID:      r.Header.Get(impersonateUIDHeader),
+		Groups:   r.Header.Values(impersonateGroupHeader),
+	}
+	for name, values := range r.Header {
+		if !strings.HasPrefix(name, impersonateExtraHeaderPrefix) {
+			continue
+		}
+		// Extra keys are escaped so that they can be header names
+		key, err := url.PathUnescape(strings.TrimPrefix(name, impersonateExtraHeaderPrefix))
+		if err != nil {
+			continue
+		}
+		if user.Extra == nil {
+			user.Extra = map[string]authenticationv1.ExtraValue{}
+		}
+		user.Extra[strings.ToLower(key)] = values
+	}
+	// Like the API server, impersonated users other than anonymous are authenticated
+	if username != "system:anonymous" && !containsView(user.Groups, authenticatedGroup) {
+		user.Groups = append(user.Groups, authenticatedGroup)
+	}
+	return user, true
+}
+
+// requestUser returns who r is made by: the user it impersonates, the view of its token, or the
+// admin of the server
+func requestUser(r *http.Request) authenticationv1.UserInfo {
+	if user, ok := impersonatedUser(r); ok {
+		return user
+	}
+	if view := requestView(r); view != nil {
+		return authenticationv1.UserInfo{Username: viewUserPrefix + view.Name, Groups: []string{authenticatedGroup}}
+	}
+	return authenticationv1.UserInfo{Username: adminUser, Groups: []string{"system:masters", authenticatedGroup}}
+}
+
+// logImpersonation is a middleware that accepts requests impersonating a user, so scripts that
+// always pass kubectl --as keep working. Impersonation only changes who SelfSubjectReviews say
+// the user is: requests are still served with the access of their token.
+func logImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, ok := impersonatedUser(r); ok {
+			requestLogger(r).Debugf("serving request impersonating %s with the access of its token", user.Username)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// createSelfSubjectReview responds to kubectl auth whoami with the user of the request
+func (h handler) createSelfSubjectReview(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+	logger.Println("called createSelfSubjectReview")
+
+	version := mux.Vars(r)["version"]
+	switch version {
+	case "v1", "v1beta1", "v1alpha1":
+	default:
+		JSON(w, http.StatusNotFound, errorNotFound)
+		return
+	}
+
+	review := &authenticationv1.SelfSubjectReview{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: authenticationv1.GroupName + "/" + version,
+			Kind:       "SelfSubjectReview",
+		},
+		Status: authenticationv1.SelfSubjectReviewStatus{
+			UserInfo: requestUser(r),
+		},
+	}
+	review.SetCreationTimestamp(metav1.Now())
+
+	JSON(w, http.StatusCreated, review)
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Tables of Karpenter's node pools and claims have the columns of the printer columns of its CRDs
+func init() {
+	age := metav1.TableColumnDefinition{Name: "Age", Type: "date"}
+
+	RegisterPrinter(schema.GroupKind{Group: sbctl.KarpenterGroup, Kind: "NodePool"}, Printer{
+		Columns: []metav1.TableColumnDefinition{{Name: "NodeClass", Type: "string"}, {Name: "Nodes", Type: "string"}, {Name: "Ready", Type: "string"}, age},
+		PrintRow: func(obj *unstructured.Unstructured) ([]interface{}, error) {
+			nodeClass, _, _ := unstructured.NestedString(obj.Object, "spec", "template", "spec", "nodeClassRef", "name")
+			nodes := ""
+			if n, found, _ := unstructured.NestedFieldNoCopy(obj.Object, "status", "resources", "nodes"); found {
+				nodes = fmt.Sprint(n)
+			}
+			return []interface{}{nodeClass, nodes, unstructuredConditionStatus(obj, "Ready"), unstructuredAge(obj)}, nil
+		},
+	})
+	RegisterPrinter(schema.GroupKind{Group: sbctl.KarpenterGroup, Kind: "NodeClaim"}, Printer{
+		Columns: []metav1.TableColumnDefinition{
+			{Name: "Type", Type: "string"}, {Name: "Capacity", Type: "string"}, {Name: "Zone", Type: "string"},
+			{Name: "Node", Type: "string"}, {Name: "Ready", Type: "string"}, age,
+		},
+		PrintRow: func(obj *unstructured.Unstructured) ([]interface{}, error) {
+			labels := obj.GetLabels()
+			node, _, _ := unstructured.NestedString(obj.Object, "status", "nodeName")
+			return []interface{}{
+				labels["node.kubernetes.io/instance-type"], labels["karpenter.sh/capacity-type"], labels["topology.kubernetes.io/zone"],
+				node, unstructuredConditionStatus(obj, "Ready"), unstructuredAge(obj),
+			}, nil
+		},
+	})
+}
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// extraListeners are the listeners given with --listen, which serve the same API as the one in
+// the kubeconfig, e.g. a unix socket for local tools and HTTPS for a browser UI
+var extraListeners = struct {
+	mu        sync.Mutex
+	listeners []net.Listener
+	urls      []string
+}{}
+
+// openListeners opens a listener for each address, which are URLs such as
+// unix:///tmp/sbctl.sock, http://127.0.0.1:8080 or https://0.0.0.0:8443. HTTPS listeners use
+// --tls-cert-file and --tls-private-key-file, or a self-signed certificate when they are not set.
+func openListeners(addresses []string) ([]net.Listener, error) {
+	listeners := []net.Listener{}
+	closeAll := func() {
+		for _, l := range listeners {
+			_ = l.Close()
+		}
+	}
+
+	var tlsConfig *tls.Config
+	for _, address := range addresses {
+		u, err := url.Parse(address)
+		if err != nil {
+			closeAll()
+			return nil, errors.Wrapf(err, "invalid listen address %q", address)
+		}
+
+		var listener net.Listener
+		switch u.Scheme {
+		case "unix":
+			listener, err = listenUnix(u.Path + u.Opaque)
+		case "http":
+			listener, err = net.Listen("tcp", u.Host)
+		case "https":
+			if tlsConfig == nil {
+				tlsConfig, err = serverTLSConfig(addresses)
+				if err != nil {
+					closeAll()
+					return nil, err
+				}
+			}
+			listener, err = net.Listen("tcp", u.Host)
+			if err == nil {
+				listener = tls.NewListener(listener, tlsConfig)
+			}
+		default:
+			err = errors.Errorf("unsupported scheme %q, must be unix, http or https", u.Scheme)
+		}
+		if err != nil {
+			closeAll()
+			return nil, errors.Wrapf(err, "failed to listen on %s", address)
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
+
+// listenUnix listens on a unix socket only the current user can connect to. A socket left by a
+// server that did not stop cleanly is replaced, any other file is not.
+func listenUnix(path string) (net.Listener, error) {
+	if path == "" {
+		return nil, errors.New("socket path is empty")
+	}
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, errors.Errorf("%s exists and is not a socket", path)
+		}
+		_ = os.Remove(path)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		_ = listener.Close()
+		return nil, errors.Wrap(err, "failed to restrict socket permissions")
+	}
+	return listener, nil
+}
+
+// serverTLSConfig loads the certificate of --tls-cert-file and --tls-private-key-file, or
+// generates a self-signed one for the hosts of addresses
+func serverTLSConfig(addresses []string) (*tls.Config, error) {
+	certFile := viper.GetString("tls-cert-file")
+	keyFile := viper.GetString("tls-private-key-file")
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load TLS certificate")
+		}
+		return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12, NextProtos: []string{"http/1.1"}}, nil
+	}
+
+	hosts := []string{"localhost", localServerEndPoint}
+	for _, address := range addresses {
+		if u, err := url.Parse(address); err == nil && u.Scheme == "https" && u.Hostname() != "" {
+			hosts = append(hosts, u.Hostname())
+		}
+	}
+	cert, err := selfSignedCertificate(hosts)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate TLS certificate")
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12, NextProtos: []string{"http/1.1"}}, nil
+}
+
+func selfSignedCertificate(hosts []string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "sbctl"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// listenerURL returns the URL clients connect to, with the port that was picked for port 0
+func listenerURL(address string, listener net.Listener) string {
+	switch {
+	case strings.HasPrefix(address, "unix:"):
+		return "unix://" + listener.Addr().String()
+	case strings.HasPrefix(address, "https:"):
+		return "https://" + listener.Addr().String()
+	default:
+		return "http://" + listener.Addr().String()
+	}
+}
+
+// ListenURLs returns the URLs of the listeners given with --listen
+func ListenURLs() []string {
+	extraListeners.mu.Lock()
+	defer extraListeners.mu.Unlock()
+	return append([]string{}, extraListeners.urls...)
+}
+
+// CloseListeners closes the listeners given with --listen, which removes their unix sockets
+func CloseListeners() {
+	extraListeners.mu.Lock()
+	defer extraListeners.mu.Unlock()
+	for _, l := range extraListeners.listeners {
+		_ = l.Close()
+	}
+	extraListeners.listeners = nil
+	extraListeners.urls = nil
+}
@@ -1,18 +1,37 @@
 package api
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
 	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/httpstream/wsstream"
 )
 
+// defaultContainerAnnotation names the container kubectl and the API server use for a pod
+// when none is given
+const defaultContainerAnnotation = "kubectl.kubernetes.io/default-container"
+
+// logScanChunkSize is how much of a log is read at a time when scanning backwards from its end
+const logScanChunkSize = 64 * 1024
+
 func (h handler) getAPIV1NamespaceResourceLog(w http.ResponseWriter, r *http.Request) {
-	log.Println("called getAPIV1NamespaceResourceLog")
+	logger := requestLogger(r)
+	logger.Println("called getAPIV1NamespaceResourceLog")
 
 	namespace := mux.Vars(r)["namespace"]
 	resource := mux.Vars(r)["resource"]
@@ -20,19 +39,54 @@ func (h handler) getAPIV1NamespaceResourceLog(w http.ResponseWriter, r *http.Req
 	container := r.URL.Query().Get("container")
 	previous, _ := strconv.ParseBool(r.URL.Query().Get("previous"))
 
+	if container == "" && resource == "pods" {
+		var err error
+		container, err = h.defaultContainer(namespace, name)
+		var required containerRequiredError
+		if errors.As(err, &required) {
+			viewStatus(w, http.StatusBadRequest, metav1.StatusReasonBadRequest, err.Error())
+			return
+		} else if err != nil {
+			logger.Error("failed to find default container: ", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// The names are joined into a path in the bundle, and views only restrict the namespace of the URL
+	for _, value := range []string{namespace, resource, name, container} {
+		if value != "" && !isPathElement(value) {
+			viewStatus(w, http.StatusBadRequest, metav1.StatusReasonBadRequest, fmt.Sprintf("invalid name %q", value))
+			return
+		}
+	}
+
 	logFileName := fmt.Sprintf("%s.log", container)
 	if previous {
 		logFileName = fmt.Sprintf("%s-previous.log", container)
 	}
 
+	opts, err := parseLogOptions(r)
+	if err != nil {
+		PlainText(w, http.StatusBadRequest, []byte(err.Error()))
+		return
+	}
+
 	fileName := filepath.Join(h.clusterData.ClusterResourcesDir, resource, "logs", namespace, name, logFileName)
-	data, err := readFileAndLog(fileName)
+	log.Printf("Reading %s file", fileName)
+	var indexed *sbctl.IndexedLog
+	if h.clusterData.Index != nil {
+		if l, ok := h.clusterData.Index.Log(filepath.Join(resource, "logs", namespace, name, logFileName)); ok {
+			indexed = &l
+		}
+	}
+	f, err := openLog(fileName, opts, indexed)
 	if err != nil {
-		log.Error("failed to load file :", err)
+		logger.Error("failed to load file :", err)
 		if os.IsNotExist(err) {
 			// try reading from -logs-errors.log file
 			errFileName := filepath.Join(h.clusterData.ClusterResourcesDir, resource, "logs", namespace, name, fmt.Sprintf("%s-logs-errors.log", container))
-			data, err = readFileAndLog(errFileName)
+			data, err := readFileAndLog(r.Context(), errFileName)
 			if err != nil {
 				if os.IsNotExist(err) {
 					PlainText(w, http.StatusNotFound, []byte(fmt.Sprintf("log files not found in support-bundle.\n%v\n%v", fileName, errFileName)))
@@ -41,12 +95,394 @@ func (h handler) getAPIV1NamespaceResourceLog(w http.ResponseWriter, r *http.Req
 				w.WriteHeader(http.StatusInternalServerError)
 				return
 			}
-		} else {
-			w.WriteHeader(http.StatusInternalServerError)
+			writeLog(w, r, bytes.NewReader(data))
 			return
 		}
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	writeLog(w, r, f)
+}
+
+// isPathElement returns whether a name from a request is a single file name, which cannot reach
+// files outside of the directory it is joined to
+func isPathElement(name string) bool {
+	return name != "." && name != ".." && !strings.ContainsAny(name, `/\`) && filepath.Base(name) == name
+}
+
+// containerRequiredError is returned for pods with several containers and no default one
+type containerRequiredError struct {
+	pod        string
+	containers []string
+}
+
+func (e containerRequiredError) Error() string {
+	return fmt.Sprintf("a container name must be specified for pod %s, choose one of: %v", e.pod, e.containers)
+}
+
+// defaultContainer returns the container whose log is served when no container is requested, as
+// the API server does: the container named by the default-container annotation, or the only
+// container of the pod. Pods that are not in the bundle have no default container.
+func (h handler) defaultContainer(namespace string, name string) (string, error) {
+	fileName := filepath.Join(h.clusterData.ClusterResourcesDir, "pods", fmt.Sprintf("%s.json", namespace))
+	if !fileExists(fileName) {
+		return "", nil
+	}
+
+	objects, err := sbctl.ReadResourceFile(fileName, "pods")
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to read pods of namespace %s", namespace)
+	}
+	for _, o := range objects {
+		if o.GetName() != name {
+			continue
+		}
+
+		pod := corev1.Pod{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(o.Object, &pod); err != nil {
+			return "", errors.Wrapf(err, "failed to convert pod %s", name)
+		}
+		if container := pod.Annotations[defaultContainerAnnotation]; container != "" {
+			return container, nil
+		}
+		if len(pod.Spec.Containers) == 1 {
+			return pod.Spec.Containers[0].Name, nil
+		}
+		names := []string{}
+		for _, c := range pod.Spec.Containers {
+			names = append(names, c.Name)
+		}
+		return "", containerRequiredError{pod: name, containers: names}
+	}
+	return "", nil
+}
+
+// writeLog streams a log to the client, so logs larger than memory can be served. No
+// Content-Length is set, which also keeps the response size limit meant for lists from
+// rejecting large logs.
+func writeLog(w http.ResponseWriter, r *http.Request, reader io.Reader) {
+	logger := requestLogger(r)
+
+	// Logs in a bundle are complete, so following a log streams the stored log and ends
+	if wsstream.IsWebSocketRequest(r) {
+		err := wsstream.NewReader(reader, true, wsstream.NewDefaultReaderProtocols()).Copy(w, r)
+		if err != nil {
+			logger.Error("failed to stream log over websocket: ", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, reader); err != nil {
+		logger.Error("failed to stream log: ", err)
+	}
+}
+
+// LogOptions select the part of a log to read, as the options of the pod log endpoint do.
+// TailLines is -1 to read every line.
+type LogOptions struct {
+	TailLines  int64
+	Since      time.Time
+	LimitBytes int64
+}
+
+func parseLogOptions(r *http.Request) (LogOptions, error) {
+	opts := NewLogOptions()
+	query := r.URL.Query()
+
+	if value := query.Get("tailLines"); value != "" {
+		tailLines, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || tailLines < 0 {
+			return opts, errors.Errorf("invalid tailLines %q", value)
+		}
+		opts.TailLines = tailLines
+	}
+
+	if value := query.Get("sinceSeconds"); value != "" {
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || seconds < 1 {
+			return opts, errors.Errorf("invalid sinceSeconds %q", value)
+		}
+		opts.Since = time.Now().Add(-time.Duration(seconds) * time.Second)
+	}
+
+	if value := query.Get("sinceTime"); value != "" {
+		since, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return opts, errors.Errorf("invalid sinceTime %q", value)
+		}
+		opts.Since = since
+	}
+
+	if value := query.Get("limitBytes"); value != "" {
+		limitBytes, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || limitBytes < 1 {
+			return opts, errors.Errorf("invalid limitBytes %q", value)
+		}
+		opts.LimitBytes = limitBytes
+	}
+
+	return opts, nil
+}
+
+// NewLogOptions returns options that select the whole log
+func NewLogOptions() LogOptions {
+	return LogOptions{TailLines: -1}
+}
+
+type logReader struct {
+	io.Reader
+	io.Closer
+}
+
+// OpenLog opens the part of a log file opts select. Errors opening the file are returned as they
+// are, so that os.IsNotExist can be used on them.
+func OpenLog(fileName string, opts LogOptions) (io.ReadCloser, error) {
+	return openLog(fileName, opts, nil)
+}
+
+// openLog opens a log like OpenLog. When the log is indexed, the line offsets of the index are
+// used to find where the last lines start.
+func openLog(fileName string, opts LogOptions, indexed *sbctl.IndexedLog) (io.ReadCloser, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, errors.Wrap(err, "failed to stat log file")
+	}
+
+	var start int64
+	if indexed != nil && indexed.Size == stat.Size() && opts.Since.IsZero() && opts.TailLines >= 0 {
+		start, err = indexedTailOffset(f, stat.Size(), *indexed, opts.TailLines)
+	} else {
+		start, err = logStartOffset(f, stat.Size(), opts)
+	}
+	if err != nil {
+		f.Close()
+		return nil, errors.Wrap(err, "failed to scan log file")
+	}
+
+	var reader io.Reader = io.NewSectionReader(f, start, stat.Size()-start)
+	if opts.LimitBytes > 0 {
+		reader = io.LimitReader(reader, opts.LimitBytes)
+	}
+	return logReader{Reader: reader, Closer: f}, nil
+}
+
+// logStartOffset returns where a log should be served from to honour tailLines and since. Only the
+// served part of the log is read: since is found with a binary search over the file, and tailLines
+// by scanning backwards from its end one line at a time, stopping at since.
+func logStartOffset(f io.ReaderAt, size int64, opts LogOptions) (int64, error) {
+	if opts.TailLines < 0 && opts.Since.IsZero() {
+		return 0, nil
+	}
+
+	sinceStart := int64(0)
+	if !opts.Since.IsZero() {
+		var err error
+		sinceStart, err = logSinceOffset(f, size, opts.Since)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if opts.TailLines < 0 {
+		return sinceStart, nil
+	}
+
+	start := sinceStart
+	lines := int64(0)
+	err := scanLinesBackwards(f, size, func(offset int64, line []byte) bool {
+		if offset < sinceStart {
+			return false
+		}
+		if lines >= opts.TailLines {
+			start = offset + int64(len(line)) + 1
+			return false
+		}
+		lines++
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	if start > size {
+		start = size
+	}
+	return start, nil
+}
+
+// indexedTailOffset returns where the last tailLines lines of an indexed log start, reading
+// forward from the closest line offset of the index
+func indexedTailOffset(f io.ReaderAt, size int64, indexed sbctl.IndexedLog, tailLines int64) (int64, error) {
+	offset, skip := indexed.LineOffset(tailLines)
+	if skip == 0 {
+		return offset, nil
+	}
+
+	r := bufio.NewReaderSize(io.NewSectionReader(f, offset, size-offset), logScanChunkSize)
+	for skip > 0 {
+		line, err := r.ReadSlice('\n')
+		offset += int64(len(line))
+		for err == bufio.ErrBufferFull {
+			line, err = r.ReadSlice('\n')
+			offset += int64(len(line))
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, errors.Wrap(err, "failed to read log")
+		}
+		skip--
+	}
+	return offset, nil
+}
+
+// logSinceOffset returns the offset of the first line with a timestamp at or after since. Logs are
+// written in order, so the line is found with a binary search. since can only be applied to lines
+// that start with a timestamp, i.e. logs collected with timestamps. Lines without one, such as
+// continuations of multi-line messages, are kept with the timestamped line before them, and logs
+// that start with them are served from the beginning when nothing is older than since.
+func logSinceOffset(f io.ReaderAt, size int64, since time.Time) (int64, error) {
+	// Find the smallest offset from which the next timestamped line is not before since
+	lo, hi := int64(0), size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		_, ts, found, err := nextTimestampedLine(f, size, mid)
+		if err != nil {
+			return 0, err
+		}
+		if !found || !ts.Before(since) {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	if lo == 0 {
+		return 0, nil
+	}
+
+	offset, _, found, err := nextTimestampedLine(f, size, lo)
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return size, nil
+	}
+	return offset, nil
+}
+
+// nextTimestampedLine returns the first line starting at or after offset that has a timestamp
+func nextTimestampedLine(f io.ReaderAt, size int64, offset int64) (int64, time.Time, bool, error) {
+	// A line starts at the beginning of the file or after a newline
+	lineStart := offset
+	if offset > 0 {
+		lineStart = offset - 1
+	}
+	r := bufio.NewReaderSize(io.NewSectionReader(f, lineStart, size-lineStart), logScanChunkSize)
+	if offset > 0 {
+		skipped, err := r.ReadSlice('\n')
+		for err == bufio.ErrBufferFull {
+			lineStart += int64(len(skipped))
+			skipped, err = r.ReadSlice('\n')
+		}
+		lineStart += int64(len(skipped))
+		if err == io.EOF {
+			return 0, time.Time{}, false, nil
+		} else if err != nil {
+			return 0, time.Time{}, false, errors.Wrap(err, "failed to read log")
+		}
+	}
+
+	for {
+		line, err := r.ReadSlice('\n')
+		if len(line) > 0 {
+			if ts, ok := logLineTimestamp(bytes.TrimSuffix(line, []byte("\n"))); ok {
+				return lineStart, ts, true, nil
+			}
+		}
+		lineStart += int64(len(line))
+		// Lines longer than the buffer only need their start for the timestamp
+		for err == bufio.ErrBufferFull {
+			line, err = r.ReadSlice('\n')
+			lineStart += int64(len(line))
+		}
+		if err == io.EOF {
+			return 0, time.Time{}, false, nil
+		} else if err != nil {
+			return 0, time.Time{}, false, errors.Wrap(err, "failed to read log")
+		}
+	}
+}
+
+// scanLinesBackwards calls fn with each line of a file and its offset, starting with the last
+// line, until fn returns false. A trailing newline does not start an empty last line.
+func scanLinesBackwards(f io.ReaderAt, size int64, fn func(offset int64, line []byte) bool) error {
+	end := size
+	if end > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, end-1); err != nil {
+			return errors.Wrap(err, "failed to read log")
+		}
+		if last[0] == '\n' {
+			end--
+		}
+	}
+
+	// partial holds the start of the line being assembled, which can span chunks
+	var partial []byte
+	pos := end
+	for pos > 0 {
+		n := int64(logScanChunkSize)
+		if pos < n {
+			n = pos
+		}
+		pos -= n
+
+		chunk := make([]byte, n)
+		if _, err := f.ReadAt(chunk, pos); err != nil && err != io.EOF {
+			return errors.Wrap(err, "failed to read log")
+		}
+		partial = append(chunk, partial...)
+
+		for {
+			i := bytes.LastIndexByte(partial, '\n')
+			if i < 0 {
+				break
+			}
+			if !fn(pos+int64(i)+1, partial[i+1:]) {
+				return nil
+			}
+			partial = partial[:i]
+		}
+	}
+
+	if end > 0 {
+		fn(0, partial)
+	}
+	return nil
+}
+
+// logLineTimestamp parses the RFC3339 timestamp kubelet prefixes log lines with when they are
+// requested with timestamps, or the timestamp of journalctl -o short-iso, which has no colon in
+// its zone offset
+func logLineTimestamp(line []byte) (time.Time, bool) {
+	i := bytes.IndexByte(line, ' ')
+	if i < 0 {
+		i = len(line)
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05-0700"} {
+		if ts, err := time.Parse(layout, string(line[:i])); err == nil {
+			return ts, true
+		}
 	}
-	PlainText(w, http.StatusOK, data)
+	return time.Time{}, false
 }
 
 func PlainText(w http.ResponseWriter, responseCode int, responseBody []byte) {
@@ -0,0 +1,242 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Node and pod usage found in kubelet metrics dumps is served as the metrics.k8s.io group of
+// the metrics server, so that kubectl top works
+const (
+	metricsGroup        = "metrics.k8s.io"
+	metricsVersion      = "v1beta1"
+	metricsGroupVersion = metricsGroup + "/" + metricsVersion
+)
+
+func metricsAPIResources() []metav1.APIResource {
+	return []metav1.APIResource{
+		{Name: "nodes", Namespaced: false, Kind: "NodeMetrics", Verbs: metav1.Verbs{"get", "list"}},
+		{Name: "pods", Namespaced: true, Kind: "PodMetrics", Verbs: metav1.Verbs{"get", "list"}},
+	}
+}
+
+func metricsAPIGroup() metav1.APIGroup {
+	version := metav1.GroupVersionForDiscovery{
+		GroupVersion: metricsGroupVersion,
+		Version:      metricsVersion,
+	}
+	return metav1.APIGroup{
+		Name:             metricsGroup,
+		Versions:         []metav1.GroupVersionForDiscovery{version},
+		PreferredVersion: version,
+	}
+}
+
+// hasMetrics returns whether the bundle has usage to serve as metrics.k8s.io
+func (h handler) hasMetrics() bool {
+	usage, err := sbctl.FindResourceUsage(h.clusterData)
+	return err == nil && len(usage) > 0
+}
+
+func (h handler) getNodeMetrics(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+	logger.Println("called getNodeMetrics")
+
+	selector, err := labels.Parse(r.URL.Query().Get("labelSelector"))
+	if err != nil {
+		JSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid label selector: %v", err)})
+		return
+	}
+	name := mux.Vars(r)["name"]
+
+	usage, err := sbctl.FindResourceUsage(h.clusterData)
+	if err != nil {
+		logger.Error("failed to read resource usage: ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	nodes, err := sbctl.ListResources(h.clusterData, "", "nodes")
+	if err != nil {
+		logger.Error("failed to list nodes: ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	list := &unstructured.UnstructuredList{}
+	list.SetAPIVersion(metricsGroupVersion)
+	list.SetKind("NodeMetricsList")
+	list.Items = []unstructured.Unstructured{}
+	for _, node := range nodes {
+		if name != "" && node.GetName() != name {
+			continue
+		}
+		if !selector.Matches(labels.Set(node.GetLabels())) {
+			continue
+		}
+		u, ok := mergeMetricsUsage(usage, node.GetName(), "", "")
+		if !ok {
+			continue
+		}
+		item := metricsObject("NodeMetrics", "", node.GetName(), node.GetLabels(), u.Time)
+		item.Object["usage"] = metricsResources(u.CPU, u.Memory)
+		list.Items = append(list.Items, item)
+	}
+
+	if name != "" {
+		if len(list.Items) == 0 {
+			JSON(w, http.StatusNotFound, errorNotFound)
+			return
+		}
+		JSON(w, http.StatusOK, &list.Items[0])
+		return
+	}
+	JSON(w, http.StatusOK, list)
+}
+
+func (h handler) getPodMetrics(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+	logger.Println("called getPodMetrics")
+
+	selector, err := labels.Parse(r.URL.Query().Get("labelSelector"))
+	if err != nil {
+		JSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid label selector: %v", err)})
+		return
+	}
+	namespace, name := mux.Vars(r)["namespace"], mux.Vars(r)["name"]
+
+	usage, err := sbctl.FindResourceUsage(h.clusterData)
+	if err != nil {
+		logger.Error("failed to read resource usage: ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	pods, err := sbctl.ListResources(h.clusterData, "", "pods")
+	if err != nil {
+		logger.Error("failed to list pods: ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	sort.SliceStable(pods, func(i, j int) bool {
+		if pods[i].GetNamespace() != pods[j].GetNamespace() {
+			return pods[i].GetNamespace() < pods[j].GetNamespace()
+		}
+		return pods[i].GetName() < pods[j].GetName()
+	})
+
+	list := &unstructured.UnstructuredList{}
+	list.SetAPIVersion(metricsGroupVersion)
+	list.SetKind("PodMetricsList")
+	list.Items = []unstructured.Unstructured{}
+	for _, pod := range pods {
+		if namespace != "" && pod.GetNamespace() != namespace {
+			continue
+		}
+		if name != "" && pod.GetName() != name {
+			continue
+		}
+		if !selector.Matches(labels.Set(pod.GetLabels())) {
+			continue
+		}
+		nodeName, _, _ := unstructured.NestedString(pod.Object, "spec", "nodeName")
+		u, ok := mergeMetricsUsage(usage, nodeName, pod.GetNamespace(), pod.GetName())
+		if !ok {
+			continue
+		}
+
+		// Dumps that only measure whole pods have one container named after the pod
+		containers := []interface{}{}
+		if len(u.Containers) == 0 {
+			u.Containers = []sbctl.ContainerUsage{{Name: pod.GetName(), CPU: u.CPU, Memory: u.Memory}}
+		}
+		for _, c := range u.Containers {
+			containers = append(containers, map[string]interface{}{
+				"name":  c.Name,
+				"usage": metricsResources(c.CPU, c.Memory),
+			})
+		}
+
+		item := metricsObject("PodMetrics", pod.GetNamespace(), pod.GetName(), pod.GetLabels(), u.Time)
+		item.Object["containers"] = containers
+		list.Items = append(list.Items, item)
+	}
+
+	if name != "" {
+		if len(list.Items) == 0 {
+			JSON(w, http.StatusNotFound, errorNotFound)
+			return
+		}
+		JSON(w, http.StatusOK, &list.Items[0])
+		return
+	}
+	JSON(w, http.StatusOK, list)
+}
+
+// mergeMetricsUsage returns the usage of a node or pod from all the dumps that measured it.
+// Summary dumps are preferred, since they measure both CPU and memory, and containers.
+func mergeMetricsUsage(usage []sbctl.ResourceUsage, node string, namespace string, pod string) (sbctl.ResourceUsage, bool) {
+	merged := sbctl.ResourceUsage{Node: node, Namespace: namespace, Pod: pod}
+	found := false
+	for _, source := range []string{sbctl.UsageSourceSummary, sbctl.UsageSourceCadvisor} {
+		for _, u := range usage {
+			if u.Source != source || u.Namespace != namespace || u.Pod != pod {
+				continue
+			}
+			// Pods are found by name alone when the bundle does not say where they ran
+			if node != "" && u.Node != node {
+				continue
+			}
+			found = true
+			if merged.CPU == nil {
+				merged.CPU = u.CPU
+			}
+			if merged.Memory == nil {
+				merged.Memory = u.Memory
+			}
+			if len(merged.Containers) == 0 {
+				merged.Containers = u.Containers
+			}
+			if merged.Time == nil {
+				merged.Time = u.Time
+			}
+		}
+	}
+	return merged, found
+}
+
+func metricsObject(kind string, namespace string, name string, objectLabels map[string]string, measured *time.Time) unstructured.Unstructured {
+	item := unstructured.Unstructured{Object: map[string]interface{}{}}
+	item.SetAPIVersion(metricsGroupVersion)
+	item.SetKind(kind)
+	item.SetNamespace(namespace)
+	item.SetName(name)
+	if len(objectLabels) > 0 {
+		item.SetLabels(objectLabels)
+	}
+	if measured != nil {
+		item.SetCreationTimestamp(metav1.NewTime(*measured))
+		item.Object["timestamp"] = measured.UTC().Format(time.RFC3339)
+	}
+	// Kubelet summaries are instant values rather than rates over a window
+	item.Object["window"] = "0s"
+	return item
+}
+
+func metricsResources(cpu *resource.Quantity, memory *resource.Quantity) map[string]interface{} {
+	resources := map[string]interface{}{}
+	if cpu != nil {
+		resources["cpu"] = cpu.String()
+	}
+	if memory != nil {
+		resources["memory"] = memory.String()
+	}
+	return resources
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+)
+
+// getAPIV1NodeProxyLogs emulates the kubelet's /logs endpoint, reached through the API server's
+// node proxy, with the node logs collected by host collectors. The node log query parameters
+// query, pattern, tailLines and sinceTime are supported; query names a component such as
+// kubelet. Without a query, /logs/ lists the logs of the node and /logs/<file> returns one, as
+// the kubelet does for /var/log.
+func (h handler) getAPIV1NodeProxyLogs(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+	logger.Println("called getAPIV1NodeProxyLogs")
+
+	node := mux.Vars(r)["name"]
+	logPath := strings.Trim(mux.Vars(r)["path"], "/")
+	query := r.URL.Query()
+
+	opts, err := parseLogOptions(r)
+	if err != nil {
+		PlainText(w, http.StatusBadRequest, []byte(err.Error()))
+		return
+	}
+
+	var pattern *regexp.Regexp
+	if value := query.Get("pattern"); value != "" {
+		pattern, err = regexp.Compile(value)
+		if err != nil {
+			PlainText(w, http.StatusBadRequest, []byte(fmt.Sprintf("invalid pattern %q: %v", value, err)))
+			return
+		}
+	}
+
+	logs, err := sbctl.FindNodeLogs(h.clusterData)
+	if err != nil {
+		logger.Error("failed to find node logs: ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	nodeLogs := []sbctl.NodeLog{}
+	for _, l := range logs {
+		if l.Node == node {
+			nodeLogs = append(nodeLogs, l)
+		}
+	}
+
+	components := query["query"]
+	if len(components) == 0 && logPath == "" {
+		writeNodeLogsIndex(w, nodeLogs)
+		return
+	}
+	if len(components) == 0 {
+		components = []string{logPath}
+	}
+
+	readers := []io.Reader{}
+	for _, component := range components {
+		nodeLog, ok := findNodeProxyLog(nodeLogs, component)
+		if !ok {
+			PlainText(w, http.StatusNotFound, []byte(fmt.Sprintf("no %s log of node %s found in support bundle\n", component, node)))
+			return
+		}
+
+		readOpts := opts
+		if pattern != nil {
+			// Lines are matched before tailLines and limitBytes are applied, as journalctl does
+			readOpts = NewLogOptions()
+			readOpts.Since = opts.Since
+		}
+		f, err := OpenLog(filepath.Join(filepath.Dir(h.clusterData.ClusterResourcesDir), filepath.FromSlash(nodeLog.File)), readOpts)
+		if err != nil {
+			logger.Error("failed to open node log: ", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer f.Close()
+		readers = append(readers, f)
+	}
+
+	reader := io.MultiReader(readers...)
+	if pattern != nil {
+		filtered, err := filterLogLines(reader, pattern, opts.TailLines)
+		if err != nil {
+			logger.Error("failed to filter node log: ", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		reader = filtered
+		if opts.LimitBytes > 0 {
+			reader = io.LimitReader(reader, opts.LimitBytes)
+		}
+	}
+
+	writeLog(w, r, reader)
+}
+
+// findNodeProxyLog finds a log by component, by file name with or without its extension, or by
+// its path in the bundle
+func findNodeProxyLog(logs []sbctl.NodeLog, name string) (sbctl.NodeLog, bool) {
+	for _, l := range logs {
+		if l.Component == name || l.File == name {
+			return l, true
+		}
+	}
+	for _, l := range logs {
+		base := path.Base(l.File)
+		if base == name || strings.TrimSuffix(base, path.Ext(base)) == strings.TrimSuffix(name, path.Ext(name)) {
+			return l, true
+		}
+	}
+	return sbctl.NodeLog{}, false
+}
+
+// writeNodeLogsIndex lists the logs of a node as the kubelet lists /var/log
+func writeNodeLogsIndex(w http.ResponseWriter, logs []sbctl.NodeLog) {
+	var b bytes.Buffer
+	b.WriteString("<pre>\n")
+	for _, l := range logs {
+		name := path.Base(l.File)
+		fmt.Fprintf(&b, "<a href=\"%s\">%s</a>\n", html.EscapeString(name), html.EscapeString(name))
+	}
+	b.WriteString("</pre>\n")
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(b.Bytes())
+}
+
+// filterLogLines keeps the lines matching pattern, and only the last tailLines of them unless
+// tailLines is negative
+func filterLogLines(reader io.Reader, pattern *regexp.Regexp, tailLines int64) (io.Reader, error) {
+	lines := [][]byte{}
+	bufReader := bufio.NewReader(reader)
+	for {
+		line, err := bufReader.ReadBytes('\n')
+		if len(line) > 0 && pattern.Match(line) {
+			lines = append(lines, line)
+			if tailLines >= 0 && int64(len(lines)) > tailLines {
+				lines = lines[1:]
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read log")
+		}
+	}
+	return bytes.NewReader(bytes.Join(lines, nil)), nil
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/gorilla/handlers"
+	log "github.com/sirupsen/logrus"
+)
+
+const requestIDHeader = "X-Request-Id"
+
+type requestIDKey struct{}
+
+// withRequestID is a middleware that assigns every request an ID, or reuses the one sent by the
+// client. The ID is returned in the X-Request-Id header and in error bodies, and is logged with
+// every message logged while handling the request, so a failing client request can be matched
+// to the server logs.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" {
+			id = newRequestID()
+			r.Header.Set(requestIDHeader, id)
+		}
+
+		w.Header().Set(requestIDHeader, id)
+		r = r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+
+		ew := &errorBodyWriter{ResponseWriter: w}
+		next.ServeHTTP(ew, r)
+		ew.finish(id)
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestLogger returns a logger that adds the request ID to every message
+func requestLogger(r *http.Request) *log.Entry {
+	return log.WithField("requestID", requestID(r))
+}
+
+// writeLogWithRequestID writes the access log in the common log format, prefixed with the request ID
+func writeLogWithRequestID(out io.Writer, params handlers.LogFormatterParams) {
+	fmt.Fprintf(out, "[%s] %s - - [%s] \"%s %s %s\" %d %d\n",
+		params.Request.Header.Get(requestIDHeader),
+		params.Request.RemoteAddr,
+		params.TimeStamp.Format("02/Jan/2006:15:04:05 -0700"),
+		params.Request.Method,
+		params.URL.RequestURI(),
+		params.Request.Proto,
+		params.StatusCode,
+		params.Size,
+	)
+}
+
+// errorBodyWriter holds back error status codes until the body is written. Most handlers respond
+// to errors with a status code only, in which case an error body with the request ID is added.
+type errorBodyWriter struct {
+	http.ResponseWriter
+	code        int
+	wroteHeader bool
+}
+
+func (w *errorBodyWriter) WriteHeader(code int) {
+	if code < http.StatusBadRequest {
+		w.wroteHeader = true
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.code = code
+}
+
+func (w *errorBodyWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if w.code != 0 {
+			w.ResponseWriter.WriteHeader(w.code)
+		}
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *errorBodyWriter) finish(id string) {
+	if w.wroteHeader || w.code == 0 {
+		return
+	}
+
+	body, _ := json.Marshal(errorResponse{
+		Error:     http.StatusText(w.code),
+		RequestID: id,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(w.code)
+	_, _ = w.ResponseWriter.Write(body)
+}
+
+func (w *errorBodyWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *errorBodyWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.(http.Hijacker).Hijack()
+}
@@ -0,0 +1,345 @@
+package api
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Responses smaller than this are not worth compressing. This is the threshold the Kubernetes API server uses.
+const minCompressedResponseSize = 128 * 1024
+
+// paginateList is a middleware that implements the limit and continue parameters of list requests.
+// kubectl requests lists in chunks of 500 objects by default, so large lists are sent in several
+// smaller responses. The continue token is the offset of the next object in the list.
+func paginateList(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		limit, err := strconv.Atoi(query.Get("limit"))
+		// The sbctl API has its own limit parameter
+		if r.Method != http.MethodGet || err != nil || limit <= 0 || strings.HasPrefix(r.URL.Path, sbctlAPIPrefix+"/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		offset := 0
+		if token := query.Get("continue"); token != "" {
+			offset, err = decodeContinueToken(token)
+			if err != nil {
+				requestLogger(r).Warn("invalid continue token: ", err)
+				JSON(w, http.StatusBadRequest, errorResponse{Error: "invalid continue token"})
+				return
+			}
+		}
+
+		list := newBufferedResponseWriter()
+		list.header.Set(requestIDHeader, w.Header().Get(requestIDHeader))
+		next.ServeHTTP(list, r)
+
+		for k, v := range list.header {
+			w.Header()[k] = v
+		}
+		body := list.body.Bytes()
+		if list.code == http.StatusOK {
+			if paged, err := pageList(body, offset, limit); err == nil {
+				body = paged
+			} else {
+				requestLogger(r).Warn("failed to paginate response: ", err)
+			}
+		}
+
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(list.code)
+		_, _ = w.Write(body)
+	})
+}
+
+// pageList returns limit items of a list, or rows of a table, starting at offset. Other responses are returned unchanged.
+func pageList(data []byte, offset int, limit int) ([]byte, error) {
+	obj := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+
+	key := "items"
+	if _, ok := obj["rows"]; ok {
+		key = "rows"
+	} else if _, ok := obj[key]; !ok {
+		return data, nil
+	}
+
+	items := []json.RawMessage{}
+	if len(obj[key]) > 0 && string(obj[key]) != "null" {
+		if err := json.Unmarshal(obj[key], &items); err != nil {
+			return nil, err
+		}
+	}
+
+	if offset > len(items) {
+		offset = len(items)
+	}
+	end := offset + limit
+	if end > len(items) {
+		end = len(items)
+	}
+
+	listMeta := metav1.ListMeta{}
+	if raw, ok := obj["metadata"]; ok {
+		if err := json.Unmarshal(raw, &listMeta); err != nil {
+			return nil, err
+		}
+	}
+	listMeta.Continue = ""
+	listMeta.RemainingItemCount = nil
+	if end < len(items) {
+		remaining := int64(len(items) - end)
+		listMeta.Continue = encodeContinueToken(end)
+		listMeta.RemainingItemCount = &remaining
+	}
+
+	var err error
+	if obj["metadata"], err = json.Marshal(listMeta); err != nil {
+		return nil, err
+	}
+	if obj[key], err = json.Marshal(items[offset:end]); err != nil {
+		return nil, err
+	}
+	return json.Marshal(obj)
+}
+
+func encodeContinueToken(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+func decodeContinueToken(token string) (int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, err
+	}
+	offset, err := strconv.Atoi(string(data))
+	if err != nil {
+		return 0, err
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative offset %d", offset)
+	}
+	return offset, nil
+}
+
+// limitResponseSize is a middleware that refuses responses larger than the --max-response-size
+// flag, so a client pulling an enormous list gets an error that tells it how to request less
+// instead of the server holding several copies of the list in memory while sending it. Only
+// responses with a known length are limited, which excludes streamed logs and watches.
+func limitResponseSize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		maxSize := maxResponseSize()
+		if maxSize <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		next.ServeHTTP(&sizeLimitedResponseWriter{ResponseWriter: w, maxSize: maxSize}, r)
+	})
+}
+
+func maxResponseSize() int64 {
+	value := viper.GetString("max-response-size")
+	if value == "" {
+		return 0
+	}
+	q, err := resource.ParseQuantity(value)
+	if err != nil {
+		log.Warnf("ignoring invalid max response size %q: %v", value, err)
+		return 0
+	}
+	return q.Value()
+}
+
+type sizeLimitedResponseWriter struct {
+	http.ResponseWriter
+	maxSize  int64
+	exceeded bool
+}
+
+func (w *sizeLimitedResponseWriter) WriteHeader(code int) {
+	size, err := strconv.ParseInt(w.Header().Get("Content-Length"), 10, 64)
+	if code != http.StatusOK || err != nil || size <= w.maxSize {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	w.exceeded = true
+	status := &metav1.Status{
+		Status: metav1.StatusFailure,
+		Message: fmt.Sprintf("the response of %d bytes exceeds the maximum response size of %d bytes. "+
+			"Request fewer objects with a label or field selector, or page through them with the limit "+
+			"parameter (kubectl --chunk-size), or raise the limit with --max-response-size", size, w.maxSize),
+		Reason: metav1.StatusReasonRequestEntityTooLarge,
+		Code:   http.StatusRequestEntityTooLarge,
+	}
+	status.SetGroupVersionKind(metav1.SchemeGroupVersion.WithKind("Status"))
+
+	w.Header().Del("Content-Length")
+	JSON(w.ResponseWriter, http.StatusRequestEntityTooLarge, status)
+}
+
+func (w *sizeLimitedResponseWriter) Write(b []byte) (int, error) {
+	if w.exceeded {
+		// The error was sent instead of the response, so the response is discarded
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *sizeLimitedResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *sizeLimitedResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+// compressResponse is a middleware that gzips responses for clients that accept it, unless the
+// --disable-compression flag is set. Small responses and responses flushed before reaching
+// minCompressedResponseSize, such as watch events, are sent uncompressed.
+func compressResponse(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if viper.GetBool("disable-compression") || !acceptsGzip(r) || r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressedResponseWriter{ResponseWriter: w, code: http.StatusOK}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, _, _ := strings.Cut(strings.TrimSpace(encoding), ";")
+		if name == "gzip" {
+			return true
+		}
+	}
+	return false
+}
+
+// compressedResponseWriter holds back the start of a response until it knows whether the response
+// is large enough to compress
+type compressedResponseWriter struct {
+	http.ResponseWriter
+	code        int
+	wroteHeader bool
+	buf         []byte
+	gz          *gzip.Writer
+	// started is set once the status and headers have been sent
+	started bool
+	hijack  bool
+}
+
+func (w *compressedResponseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.code = code
+
+	// Responses with a known small size are sent as they are
+	size, err := strconv.Atoi(w.Header().Get("Content-Length"))
+	if err == nil && size < minCompressedResponseSize {
+		w.start(false)
+	}
+}
+
+func (w *compressedResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.started {
+		if w.gz != nil {
+			return w.gz.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+
+	w.buf = append(w.buf, b...)
+	if len(w.buf) >= minCompressedResponseSize {
+		w.start(true)
+		if _, err := w.gz.Write(w.buf); err != nil {
+			return 0, err
+		}
+		w.buf = nil
+	}
+	return len(b), nil
+}
+
+// start sends the status and headers, and what was held back so far when not compressing
+func (w *compressedResponseWriter) start(compress bool) {
+	w.started = true
+	if compress && w.code != http.StatusNoContent && w.code != http.StatusNotModified {
+		w.Header().Del("Content-Length")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.code)
+	if w.gz == nil && len(w.buf) > 0 {
+		_, _ = w.ResponseWriter.Write(w.buf)
+		w.buf = nil
+	}
+}
+
+func (w *compressedResponseWriter) Flush() {
+	if w.hijack {
+		return
+	}
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.started {
+		w.start(false)
+	}
+	if w.gz != nil {
+		_ = w.gz.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *compressedResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.hijack = true
+	return w.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+// Close sends what is still held back and ends the gzip stream
+func (w *compressedResponseWriter) Close() {
+	if w.hijack {
+		return
+	}
+	if !w.started {
+		if !w.wroteHeader && len(w.buf) == 0 {
+			return
+		}
+		w.start(false)
+	}
+	if w.gz != nil {
+		if err := w.gz.Close(); err != nil {
+			log.Errorf("failed to finish compressed response: %v", err)
+		}
+	}
+}
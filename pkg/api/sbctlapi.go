@@ -0,0 +1,594 @@
+package api
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// The sbctl API is a small JSON API for editor extensions and UIs, served next to the emulated
+// Kubernetes API. Unlike the Kubernetes API, it is shaped around browsing a bundle rather than
+// around kubectl, and it only changes in backwards compatible ways within a version.
+//
+//	GET /sbctl/v1/resources                       collected resources and how many objects each has
+//	GET /sbctl/v1/tree                            object names grouped by namespace and resource
+//	GET /sbctl/v1/search?q=&resource=&namespace=&labelSelector=&annotationSelector=&limit=
+//	                                              objects whose name contains or matches the pattern q,
+//	                                              across all resources unless resource is set
+//	GET /sbctl/v1/manifests/{group}/{resource}/{name}?namespace=
+//	                                              a single object, group is "core" for the core group
+//	GET /sbctl/v1/logs/{namespace}/{pod}          containers with collected logs
+//	GET /sbctl/v1/logs/{namespace}/{pod}/{container}?previous=&tailLines=&sinceTime=&limitBytes=
+//	                                              a container log as plain text
+//	GET /sbctl/v1/node-logs                       logs of node services such as kubelet, collected by host collectors
+//	GET /sbctl/v1/node-logs/{node}/{component}?file=&tailLines=&sinceTime=&limitBytes=
+//	                                              a node service log as plain text
+//	GET /sbctl/v1/audit?user=&verb=&resource=&namespace=&name=&since=&until=
+//	                                              kube-apiserver audit events, oldest first
+//	GET /sbctl/v1/analysis                        analyzer results
+//	GET /sbctl/v1/collector-errors                errors of collectors that failed, whose data is missing
+//	GET /sbctl/v1/related?kind=&name=&namespace=&group=
+//	                                              objects related to an object by owners, selectors and references
+//	GET /sbctl/v1/usage-report                    requests sbctl could not serve, when --usage-report is set
+//	GET /sbctl/v1/openapi.json                    the OpenAPI document of this API, to generate clients from
+//
+// Errors are returned as {"error": "..."} with a 4xx or 5xx status.
+const sbctlAPIPrefix = "/sbctl/v1"
+
+//go:embed sbctlapi.openapi.json
+var sbctlAPIOpenAPI []byte
+
+// searchLimit is how many search results are returned when the request does not set limit
+const searchLimit = 100
+
+type sbctlAPIResource struct {
+	Group      string `json:"group"`
+	Version    string `json:"version"`
+	Resource   string `json:"resource"`
+	Kind       string `json:"kind"`
+	Namespaced bool   `json:"namespaced"`
+	Count      int    `json:"count"`
+}
+
+type sbctlAPIObjectRef struct {
+	Group     string `json:"group"`
+	Version   string `json:"version"`
+	Resource  string `json:"resource"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+type sbctlAPITreeResource struct {
+	Group    string   `json:"group"`
+	Resource string   `json:"resource"`
+	Kind     string   `json:"kind"`
+	Names    []string `json:"names"`
+}
+
+type sbctlAPITreeNamespace struct {
+	Name      string                 `json:"name"`
+	Resources []sbctlAPITreeResource `json:"resources"`
+}
+
+type sbctlAPITree struct {
+	Cluster    []sbctlAPITreeResource  `json:"cluster"`
+	Namespaces []sbctlAPITreeNamespace `json:"namespaces"`
+}
+
+type sbctlAPIContainerLog struct {
+	Container string `json:"container"`
+	Previous  bool   `json:"previous"`
+	// The size, lines and timestamps of logs are only known when the bundle has an index
+	Size           int64      `json:"size,omitempty"`
+	Lines          int64      `json:"lines,omitempty"`
+	FirstTimestamp *time.Time `json:"firstTimestamp,omitempty"`
+	LastTimestamp  *time.Time `json:"lastTimestamp,omitempty"`
+}
+
+type sbctlAPIRelatedObject struct {
+	sbctlAPIObjectRef
+	Relation string `json:"relation"`
+	Via      string `json:"via"`
+	Missing  bool   `json:"missing,omitempty"`
+}
+
+type sbctlAPIRelated struct {
+	Object  sbctlAPIObjectRef       `json:"object"`
+	Related []sbctlAPIRelatedObject `json:"related"`
+}
+
+type sbctlAPIAnalysisResult struct {
+	Name     string            `json:"name"`
+	Severity string            `json:"severity"`
+	Outcome  string            `json:"outcome"`
+	Title    string            `json:"title"`
+	Message  string            `json:"message"`
+	Labels   map[string]string `json:"labels,omitempty"`
+}
+
+func registerSbctlAPI(r *mux.Router, source *ClusterDataSource) {
+	router := r.PathPrefix(sbctlAPIPrefix).Subrouter()
+	router.HandleFunc("/resources", source.handle(handler.getSbctlResources)).Methods(http.MethodGet)
+	router.HandleFunc("/tree", source.handle(handler.getSbctlTree)).Methods(http.MethodGet)
+	router.HandleFunc("/search", source.handle(handler.getSbctlSearch)).Methods(http.MethodGet)
+	router.HandleFunc("/manifests/{group}/{resource}/{name}", source.handle(handler.getSbctlManifest)).Methods(http.MethodGet)
+	router.HandleFunc("/logs/{namespace}/{pod}", source.handle(handler.getSbctlContainerLogs)).Methods(http.MethodGet)
+	router.HandleFunc("/logs/{namespace}/{pod}/{container}", source.handle(handler.getSbctlContainerLog)).Methods(http.MethodGet)
+	router.HandleFunc("/node-logs", source.handle(handler.getSbctlNodeLogs)).Methods(http.MethodGet)
+	router.HandleFunc("/node-logs/{node}/{component}", source.handle(handler.getSbctlNodeLog)).Methods(http.MethodGet)
+	router.HandleFunc("/audit", source.handle(handler.getSbctlAudit)).Methods(http.MethodGet)
+	router.HandleFunc("/analysis", source.handle(handler.getSbctlAnalysis)).Methods(http.MethodGet)
+	router.HandleFunc("/collector-errors", source.handle(handler.getSbctlCollectorErrors)).Methods(http.MethodGet)
+	router.HandleFunc("/related", source.handle(handler.getSbctlRelated)).Methods(http.MethodGet)
+	router.HandleFunc("/usage-report", source.handle(handler.getSbctlUsageReport)).Methods(http.MethodGet)
+	router.HandleFunc("/openapi.json", getSbctlOpenAPI).Methods(http.MethodGet)
+}
+
+type listedResource struct {
+	sbctlAPIResource
+	items []unstructured.Unstructured
+}
+
+// listResources reads every collected resource listed in resources.json. With metadataOnly, the
+// items only have their namespace, name, labels and annotations when the bundle has an index,
+// which is much faster for large bundles.
+func (h handler) listResources(metadataOnly bool) ([]listedResource, error) {
+	list := sbctl.ListCollectedResources
+	if metadataOnly {
+		list = sbctl.ListIndexedResources
+	}
+	collected, err := list(h.clusterData)
+	if err != nil {
+		return nil, err
+	}
+
+	resources := []listedResource{}
+	for _, r := range collected {
+		resources = append(resources, listedResource{
+			sbctlAPIResource: sbctlAPIResource{
+				Group:      r.Group,
+				Version:    r.Version,
+				Resource:   r.Resource,
+				Kind:       r.Kind,
+				Namespaced: r.Namespaced,
+				Count:      len(r.Items),
+			},
+			items: r.Items,
+		})
+	}
+
+	return resources, nil
+}
+
+func (h handler) getSbctlResources(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+	logger.Println("called getSbctlResources")
+
+	resources, err := h.listResources(true)
+	if err != nil {
+		logger.Error("failed to list resources: ", err)
+		JSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to list resources"})
+		return
+	}
+
+	result := []sbctlAPIResource{}
+	for _, resource := range resources {
+		if resource.Count > 0 {
+			result = append(result, resource.sbctlAPIResource)
+		}
+	}
+	JSON(w, http.StatusOK, result)
+}
+
+func (h handler) getSbctlTree(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+	logger.Println("called getSbctlTree")
+
+	resources, err := h.listResources(true)
+	if err != nil {
+		logger.Error("failed to list resources: ", err)
+		JSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to list resources"})
+		return
+	}
+
+	tree := sbctlAPITree{Cluster: []sbctlAPITreeResource{}, Namespaces: []sbctlAPITreeNamespace{}}
+	namespaces := map[string]*sbctlAPITreeNamespace{}
+	for _, resource := range resources {
+		names := map[string][]string{}
+		for _, item := range resource.items {
+			names[item.GetNamespace()] = append(names[item.GetNamespace()], item.GetName())
+		}
+
+		for namespace, objectNames := range names {
+			sort.Strings(objectNames)
+			node := sbctlAPITreeResource{Group: resource.Group, Resource: resource.Resource, Kind: resource.Kind, Names: objectNames}
+			if namespace == "" {
+				tree.Cluster = append(tree.Cluster, node)
+				continue
+			}
+			if namespaces[namespace] == nil {
+				namespaces[namespace] = &sbctlAPITreeNamespace{Name: namespace}
+			}
+			namespaces[namespace].Resources = append(namespaces[namespace].Resources, node)
+		}
+	}
+
+	for _, namespace := range namespaces {
+		tree.Namespaces = append(tree.Namespaces, *namespace)
+	}
+	sort.Slice(tree.Namespaces, func(i, j int) bool {
+		return tree.Namespaces[i].Name < tree.Namespaces[j].Name
+	})
+
+	JSON(w, http.StatusOK, tree)
+}
+
+func (h handler) getSbctlSearch(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+	logger.Println("called getSbctlSearch")
+
+	resourceFilter := []string{}
+	if value := r.URL.Query().Get("resource"); value != "" {
+		resourceFilter = strings.Split(value, ",")
+	}
+	query, err := sbctl.ParseFindQuery(resourceFilter, r.URL.Query().Get("namespace"), r.URL.Query().Get("q"),
+		r.URL.Query().Get("labelSelector"), r.URL.Query().Get("annotationSelector"))
+	if err != nil {
+		JSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	limit := searchLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			JSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid limit %q", value)})
+			return
+		}
+		limit = n
+	}
+
+	resources, err := h.listResources(true)
+	if err != nil {
+		logger.Error("failed to list resources: ", err)
+		JSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to list resources"})
+		return
+	}
+
+	results := []sbctlAPIObjectRef{}
+	for _, resource := range resources {
+		if !query.MatchesResource(resource.Group, resource.Resource, resource.Kind) {
+			continue
+		}
+		for _, item := range resource.items {
+			if !query.Matches(item) {
+				continue
+			}
+			results = append(results, sbctlAPIObjectRef{
+				Group:     resource.Group,
+				Version:   resource.Version,
+				Resource:  resource.Resource,
+				Kind:      resource.Kind,
+				Namespace: item.GetNamespace(),
+				Name:      item.GetName(),
+			})
+			if len(results) == limit {
+				JSON(w, http.StatusOK, results)
+				return
+			}
+		}
+	}
+
+	JSON(w, http.StatusOK, results)
+}
+
+func (h handler) getSbctlManifest(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+	logger.Println("called getSbctlManifest")
+
+	group := mux.Vars(r)["group"]
+	if group == "core" {
+		group = ""
+	}
+	resource := mux.Vars(r)["resource"]
+	name := mux.Vars(r)["name"]
+	namespace := r.URL.Query().Get("namespace")
+
+	items, err := sbctl.ListResourcesContext(r.Context(), h.clusterData, group, resource)
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		writeRequestError(w, logger, err)
+		return
+	}
+	if err != nil {
+		logger.Error("failed to list ", resource, ": ", err)
+		JSON(w, http.StatusInternalServerError, errorResponse{Error: fmt.Sprintf("failed to list %s", resource)})
+		return
+	}
+
+	for i := range items {
+		if items[i].GetNamespace() == namespace && items[i].GetName() == name {
+			JSON(w, http.StatusOK, &items[i])
+			return
+		}
+	}
+
+	JSON(w, http.StatusNotFound, errorNotFound)
+}
+
+func (h handler) getSbctlContainerLogs(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+	logger.Println("called getSbctlContainerLogs")
+
+	dir := filepath.Join(h.clusterData.ClusterResourcesDir, "pods", "logs", mux.Vars(r)["namespace"], mux.Vars(r)["pod"])
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		JSON(w, http.StatusNotFound, errorNotFound)
+		return
+	}
+	if err != nil {
+		logger.Error("failed to read logs dir: ", err)
+		JSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to read logs"})
+		return
+	}
+
+	logs := []sbctlAPIContainerLog{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".log") || strings.HasSuffix(name, "-logs-errors.log") {
+			continue
+		}
+		container := strings.TrimSuffix(name, ".log")
+		previous := strings.HasSuffix(container, "-previous")
+		containerLog := sbctlAPIContainerLog{Container: strings.TrimSuffix(container, "-previous"), Previous: previous}
+		if h.clusterData.Index != nil {
+			rel, _ := filepath.Rel(h.clusterData.ClusterResourcesDir, filepath.Join(dir, name))
+			if indexed, ok := h.clusterData.Index.Log(rel); ok {
+				containerLog.Size = indexed.Size
+				containerLog.Lines = indexed.Lines
+				containerLog.FirstTimestamp = indexed.FirstTimestamp
+				containerLog.LastTimestamp = indexed.LastTimestamp
+			}
+		}
+		logs = append(logs, containerLog)
+	}
+
+	JSON(w, http.StatusOK, logs)
+}
+
+// getSbctlContainerLog serves a log like the pod log endpoint, which takes the same options
+func (h handler) getSbctlContainerLog(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	query := r.URL.Query()
+	query.Set("container", vars["container"])
+	r.URL.RawQuery = query.Encode()
+
+	r = mux.SetURLVars(r, map[string]string{
+		"namespace": vars["namespace"],
+		"resource":  "pods",
+		"name":      vars["pod"],
+	})
+	h.getAPIV1NamespaceResourceLog(w, r)
+}
+
+func (h handler) getSbctlNodeLogs(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+	logger.Println("called getSbctlNodeLogs")
+
+	logs, err := sbctl.FindNodeLogs(h.clusterData)
+	if err != nil {
+		logger.Error("failed to find node logs: ", err)
+		JSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to find node logs"})
+		return
+	}
+	JSON(w, http.StatusOK, logs)
+}
+
+// getSbctlNodeLog serves a node service log with the options of the pod log endpoint. file chooses
+// between several logs of the component.
+func (h handler) getSbctlNodeLog(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+	logger.Println("called getSbctlNodeLog")
+
+	opts, err := parseLogOptions(r)
+	if err != nil {
+		JSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+
+	component := mux.Vars(r)["component"]
+	if file := r.URL.Query().Get("file"); file != "" {
+		component = file
+	}
+	nodeLog, err := sbctl.FindNodeLog(h.clusterData, mux.Vars(r)["node"], component)
+	if err != nil {
+		JSON(w, http.StatusNotFound, errorResponse{Error: err.Error()})
+		return
+	}
+
+	f, err := OpenLog(filepath.Join(filepath.Dir(h.clusterData.ClusterResourcesDir), filepath.FromSlash(nodeLog.File)), opts)
+	if err != nil {
+		logger.Error("failed to open node log: ", err)
+		JSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to open node log"})
+		return
+	}
+	defer f.Close()
+
+	writeLog(w, r, f)
+}
+
+func (h handler) getSbctlAudit(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+	logger.Println("called getSbctlAudit")
+
+	values := r.URL.Query()
+	query := sbctl.AuditQuery{
+		User:      values.Get("user"),
+		Resource:  values.Get("resource"),
+		Namespace: values.Get("namespace"),
+		Name:      values.Get("name"),
+	}
+	if verb := values.Get("verb"); verb != "" {
+		query.Verbs = strings.Split(verb, ",")
+	}
+	for param, t := range map[string]*time.Time{"since": &query.Since, "until": &query.Until} {
+		value := values.Get(param)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			JSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid %s %q", param, value)})
+			return
+		}
+		*t = parsed
+	}
+
+	indexed, err := sbctl.AuditEvents(h.clusterData)
+	if err != nil {
+		logger.Error("failed to index audit events: ", err)
+		JSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to read audit events"})
+		return
+	}
+	events, err := sbctl.ReadAuditEvents(h.clusterData, sbctl.FilterAuditEvents(indexed, query))
+	if err != nil {
+		logger.Error("failed to read audit events: ", err)
+		JSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to read audit events"})
+		return
+	}
+	JSON(w, http.StatusOK, events)
+}
+
+func (h handler) getSbctlAnalysis(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+	logger.Println("called getSbctlAnalysis")
+
+	results, err := sbctl.ReadAnalysis(h.clusterData)
+	if err != nil {
+		logger.Error("failed to read analysis results: ", err)
+		JSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to read analysis results"})
+		return
+	}
+
+	response := []sbctlAPIAnalysisResult{}
+	for _, result := range results {
+		response = append(response, sbctlAPIAnalysisResult{
+			Name:     result.Name,
+			Severity: result.Severity,
+			Outcome:  result.Outcome(),
+			Title:    result.Title(),
+			Message:  result.Message(),
+			Labels:   result.Labels,
+		})
+	}
+	JSON(w, http.StatusOK, response)
+}
+
+func (h handler) getSbctlCollectorErrors(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+	logger.Println("called getSbctlCollectorErrors")
+
+	collectorErrors, err := sbctl.ReadCollectorErrors(h.clusterData)
+	if err != nil {
+		logger.Error("failed to read collector errors: ", err)
+		JSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to read collector errors"})
+		return
+	}
+	JSON(w, http.StatusOK, collectorErrors)
+}
+
+func (h handler) getSbctlRelated(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+	logger.Println("called getSbctlRelated")
+
+	query := r.URL.Query()
+	kind := query.Get("kind")
+	name := query.Get("name")
+	namespace := query.Get("namespace")
+	group := query.Get("group")
+	if group == "core" {
+		group = ""
+	}
+	if kind == "" || name == "" {
+		JSON(w, http.StatusBadRequest, errorResponse{Error: "kind and name are required"})
+		return
+	}
+
+	resources, err := h.listResources(false)
+	if err != nil {
+		logger.Error("failed to list resources: ", err)
+		JSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to list resources"})
+		return
+	}
+
+	// Items of lists often do not have their kind set, which relations are matched by
+	refs := map[schema.GroupKind]sbctlAPIObjectRef{}
+	objects := []unstructured.Unstructured{}
+	var target *unstructured.Unstructured
+	var targetRef sbctlAPIObjectRef
+	for _, resource := range resources {
+		gk := schema.GroupKind{Group: resource.Group, Kind: resource.Kind}
+		ref := sbctlAPIObjectRef{Group: resource.Group, Version: resource.Version, Resource: resource.Resource, Kind: resource.Kind}
+		refs[gk] = ref
+
+		matchesKind := strings.EqualFold(kind, resource.Kind) || kind == resource.Resource
+		if query.Has("group") && group != resource.Group {
+			matchesKind = false
+		}
+		for _, item := range resource.items {
+			item.SetGroupVersionKind(gk.WithVersion(resource.Version))
+			objects = append(objects, item)
+			if matchesKind && target == nil && item.GetName() == name && item.GetNamespace() == namespace {
+				target = &objects[len(objects)-1]
+				targetRef = ref
+				targetRef.Namespace = namespace
+				targetRef.Name = name
+			}
+		}
+	}
+	if target == nil {
+		JSON(w, http.StatusNotFound, errorNotFound)
+		return
+	}
+
+	response := sbctlAPIRelated{Object: targetRef, Related: []sbctlAPIRelatedObject{}}
+	for _, related := range sbctl.FindRelatedObjects(*target, objects) {
+		ref := refs[schema.GroupKind{Group: related.Group, Kind: related.Kind}]
+		ref.Group = related.Group
+		ref.Kind = related.Kind
+		ref.Namespace = related.Namespace
+		ref.Name = related.Name
+		response.Related = append(response.Related, sbctlAPIRelatedObject{
+			sbctlAPIObjectRef: ref,
+			Relation:          related.Relation,
+			Via:               related.Via,
+			Missing:           related.Missing,
+		})
+	}
+	JSON(w, http.StatusOK, response)
+}
+
+func (h handler) getSbctlUsageReport(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+	logger.Println("called getSbctlUsageReport")
+
+	JSON(w, http.StatusOK, GetUsageReport())
+}
+
+func getSbctlOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(sbctlAPIOpenAPI)
+}
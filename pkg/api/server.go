@@ -11,6 +11,8 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strconv"
 	"strings"
 	"time"
 
@@ -18,19 +20,17 @@ import (
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
-	"github.com/replicatedhq/sbctl/pkg/k8s"
 	"github.com/replicatedhq/sbctl/pkg/sbctl"
-	sbctlutil "github.com/replicatedhq/sbctl/pkg/util"
 	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
 	appsv1 "k8s.io/api/apps/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
 	authorizationv1 "k8s.io/api/authorization/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	corev1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
 	networkingv1 "k8s.io/api/networking/v1"
-	rbacv1 "k8s.io/api/rbac/v1"
-	storagev1 "k8s.io/api/storage/v1"
-	extensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -47,6 +47,7 @@ import (
 	apisbatchv1beta1 "k8s.io/kubernetes/pkg/apis/batch/v1beta1"
 	apicore "k8s.io/kubernetes/pkg/apis/core"
 	apicorev1 "k8s.io/kubernetes/pkg/apis/core/v1"
+	apieventsv1 "k8s.io/kubernetes/pkg/apis/events/v1"
 	networking "k8s.io/kubernetes/pkg/apis/networking"
 	apinetworkingv1 "k8s.io/kubernetes/pkg/apis/networking/v1"
 	"k8s.io/kubernetes/pkg/printers"
@@ -56,6 +57,9 @@ import (
 
 const (
 	localServerEndPoint = "127.0.0.1"
+
+	// readChunkSize is how much of a file is read before checking whether the request was canceled
+	readChunkSize = 4 << 20
 )
 
 var (
@@ -66,6 +70,7 @@ var (
 
 type handler struct {
 	clusterData sbctl.ClusterData
+	mapper      *sbctl.RESTMapper
 }
 type clusterVersion struct {
 	Info   *version.Info `json:"info"`
@@ -74,48 +79,70 @@ type clusterVersion struct {
 
 // fake, kubectl can't parse this anyways
 type errorResponse struct {
-	Error string `json:"error"`
+	Error     string `json:"error"`
+	RequestID string `json:"requestId,omitempty"`
 }
 
 func StartAPIServer(clusterData sbctl.ClusterData, logOutput io.Writer) (string, error) {
-	h := handler{
-		clusterData: clusterData,
+	return StartAPIServerFromSource(NewClusterDataSource(clusterData), logOutput)
+}
+
+// StartAPIServerFromSource starts an API server which serves the cluster data in source at the time of each request
+func StartAPIServerFromSource(source *ClusterDataSource, logOutput io.Writer) (string, error) {
+	endPoint, err := startServer(source, logOutput, viper.GetInt("port"), viper.GetStringSlice("listen"))
+	if err != nil {
+		return "", err
 	}
 
-	r := mux.NewRouter()
-	r.Use(dumpRequestResponse)
+	configFile, err := createConfigFile([]KubeContext{{Name: sbctl.DefaultClusterName, Server: endPoint}})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create clientset for local endpoint")
+	}
 
-	r.HandleFunc("/api", h.getAPI)
-	apiRouter := r.PathPrefix("/api").Subrouter()
-	apiRouter.HandleFunc("/v1", h.getAPIV1)
-	apiv1Router := apiRouter.PathPrefix("/v1").Subrouter()
-	apiv1Router.HandleFunc("/{resource}", h.getAPIV1ClusterResources)
-	apiv1Router.HandleFunc("/{resource}/{name}", h.getAPIV1ClusterResource)
-	apiv1Router.HandleFunc("/namespaces/{namespace}/{resource}", h.getAPIV1NamespaceResources)
-	apiv1Router.HandleFunc("/namespaces/{namespace}/{resource}/{name}", h.getAPIV1NamespaceResource)
-	apiv1Router.HandleFunc("/namespaces/{namespace}/{resource}/{name}/log", h.getAPIV1NamespaceResourceLog)
+	return configFile, nil
+}
 
-	r.HandleFunc("/apis", h.getAPIs)
-	apisRouter := r.PathPrefix("/apis").Subrouter()
-	apisRouter.HandleFunc("/{group}/{version}", h.getAPIByGroupAndVersion)
-	apisRouter.HandleFunc("/{group}/{version}/{resource}", h.getAPIsClusterResources)
-	apisRouter.HandleFunc("/{group}/{version}/{resource}/{name}", h.getAPIsClusterResource)
-	apisRouter.HandleFunc("/{group}/{version}/namespaces/{namespace}/{resource}", h.getAPIsNamespaceResources)
-	apisRouter.HandleFunc("/{group}/{version}/namespaces/{namespace}/{resource}/{name}", h.getAPIsNamespaceResource)
+// StartFleetAPIServer starts an API server for each cluster of a fleet bundle, and returns a
+// kubeconfig with a context named after each cluster. The first cluster is the current context
+// and the only one served on --port and --listen, the others use random free ports.
+func StartFleetAPIServer(clusters []sbctl.FleetCluster, logOutput io.Writer) (string, error) {
+	contexts := []KubeContext{}
+	for i, cluster := range clusters {
+		port, addresses := 0, []string(nil)
+		if i == 0 {
+			port, addresses = viper.GetInt("port"), viper.GetStringSlice("listen")
+		}
+		endPoint, err := startServer(NewClusterDataSource(cluster.ClusterData), logOutput, port, addresses)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to start server for cluster %s", cluster.Name)
+		}
+		contexts = append(contexts, KubeContext{Name: cluster.Name, Server: endPoint})
+	}
 
-	r.HandleFunc("/version", h.getVersion)
+	configFile, err := createConfigFile(contexts)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create clientset for local endpoint")
+	}
 
-	r.PathPrefix("/").HandlerFunc(h.getNotFound)
+	return configFile, nil
+}
 
+// startServer starts an API server on port and on the additional addresses, and returns its URL
+func startServer(source *ClusterDataSource, logOutput io.Writer, port int, addresses []string) (string, error) {
 	// Pipe the error server logs to the standard logger
 	srvLogsPipe := log.StandardLogger().WriterLevel(log.ErrorLevel)
+	address := listenAddress()
 	srv := &http.Server{
-		Handler:           handlers.LoggingHandler(logOutput, r), // Handler with logging
-		Addr:              localServerEndPoint,
+		Handler:           newServerHandler(source, logOutput),
+		Addr:              address,
 		ReadHeaderTimeout: 3 * time.Second,
 		ErrorLog:          stdLog.New(srvLogsPipe, "", 0),
 	}
-	listener, err := net.Listen("tcp", fmt.Sprintf("%s:", localServerEndPoint))
+	activity.mu.Lock()
+	activity.last = time.Now()
+	activity.mu.Unlock()
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(address, strconv.Itoa(port)))
 	if err != nil {
 		return "", errors.Wrap(err, "listening on port")
 	}
@@ -129,6 +156,24 @@ func StartAPIServer(clusterData sbctl.ClusterData, logOutput io.Writer) (string,
 		}
 	}(srv, srvLogsPipe)
 
+	listeners, err := openListeners(addresses)
+	if err != nil {
+		return "", err
+	}
+	extraListeners.mu.Lock()
+	for i, l := range listeners {
+		extraListeners.listeners = append(extraListeners.listeners, l)
+		extraListeners.urls = append(extraListeners.urls, listenerURL(addresses[i], l))
+		go func(l net.Listener) {
+			// Listeners are closed by CloseListeners when the server stops
+			err := srv.Serve(l)
+			if !errors.Is(err, http.ErrServerClosed) && !errors.Is(err, net.ErrClosed) {
+				log.Panic(err)
+			}
+		}(l)
+	}
+	extraListeners.mu.Unlock()
+
 	timeout := 10 * time.Second
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
@@ -137,8 +182,11 @@ WAIT_FOR_SERVER:
 	for {
 		select {
 		case <-time.After(1):
-			resp, err := http.Get(fmt.Sprintf("http://%s/api/v1", listener.Addr()))
-			if err == nil && resp.StatusCode == http.StatusOK {
+			// Bundles that are still being collected may not have the resources yet,
+			// so any response means the server is up
+			resp, err := http.Get(fmt.Sprintf("%s/api/v1", serverURL(listener.Addr())))
+			if err == nil {
+				resp.Body.Close()
 				break WAIT_FOR_SERVER
 			}
 		case <-ctx.Done():
@@ -146,16 +194,86 @@ WAIT_FOR_SERVER:
 		}
 	}
 
-	configFile, err := createConfigFile(fmt.Sprintf("http://%s", listener.Addr()))
-	if err != nil {
-		return "", errors.Wrap(err, "failed to create clientset for local endpoint")
+	return serverURL(listener.Addr()), nil
+}
+
+// listenAddress returns the IP address the API server listens on, set with --address. The
+// server only listens on the loopback interface by default.
+func listenAddress() string {
+	if address := viper.GetString("address"); address != "" {
+		return address
 	}
+	return localServerEndPoint
+}
 
-	return configFile, nil
+// serverURL returns the URL clients on this host use to reach a server listening on addr.
+// Servers listening on all interfaces are reached over the loopback interface.
+func serverURL(addr net.Addr) string {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok || !tcpAddr.IP.IsUnspecified() {
+		return fmt.Sprintf("http://%s", addr)
+	}
+	return fmt.Sprintf("http://%s", net.JoinHostPort(localServerEndPoint, strconv.Itoa(tcpAddr.Port)))
+}
+
+// newServerHandler returns the handler of an API server serving the cluster data in source, with
+// logging to logOutput
+func newServerHandler(source *ClusterDataSource, logOutput io.Writer) http.Handler {
+	r := mux.NewRouter()
+	r.Use(dumpRequestResponse)
+	r.Use(limitRequestTime)
+	r.Use(serveWatch)
+	r.Use(paginateList)
+	r.Use(restrictViews)
+	r.Use(logImpersonation)
+	r.Use(recordRequests(source))
+
+	r.HandleFunc("/api", source.handle(handler.getAPI))
+	apiRouter := r.PathPrefix("/api").Subrouter()
+	apiRouter.HandleFunc("/v1", source.handle(handler.getAPIV1))
+	apiv1Router := apiRouter.PathPrefix("/v1").Subrouter()
+	apiv1Router.HandleFunc("/nodes/{name}/proxy/logs", source.handle(handler.getAPIV1NodeProxyLogs))
+	apiv1Router.HandleFunc("/nodes/{name}/proxy/logs/{path:.*}", source.handle(handler.getAPIV1NodeProxyLogs))
+	apiv1Router.HandleFunc("/{resource}", source.handle(handler.getAPIV1ClusterResources))
+	apiv1Router.HandleFunc("/{resource}/{name}", source.handle(handler.getAPIV1ClusterResource))
+	apiv1Router.HandleFunc("/namespaces/{namespace}/{resource}", source.handle(handler.getAPIV1NamespaceResources))
+	apiv1Router.HandleFunc("/namespaces/{namespace}/{resource}/{name}", source.handle(handler.getAPIV1NamespaceResource))
+	apiv1Router.HandleFunc("/namespaces/{namespace}/{resource}/{name}/log", source.handle(handler.getAPIV1NamespaceResourceLog))
+
+	r.HandleFunc("/apis", source.handle(handler.getAPIs))
+	apisRouter := r.PathPrefix("/apis").Subrouter()
+	apisRouter.HandleFunc(fmt.Sprintf("/%s/%s", analysisGroupVersion, analysisResource), source.handle(handler.getAnalysisResults))
+	apisRouter.HandleFunc(fmt.Sprintf("/%s/%s/{name}", analysisGroupVersion, analysisResource), source.handle(handler.getAnalysisResult))
+	apisRouter.HandleFunc("/"+metricsGroupVersion+"/nodes", source.handle(handler.getNodeMetrics))
+	apisRouter.HandleFunc("/"+metricsGroupVersion+"/nodes/{name}", source.handle(handler.getNodeMetrics))
+	apisRouter.HandleFunc("/"+metricsGroupVersion+"/pods", source.handle(handler.getPodMetrics))
+	apisRouter.HandleFunc("/"+metricsGroupVersion+"/namespaces/{namespace}/pods", source.handle(handler.getPodMetrics))
+	apisRouter.HandleFunc("/"+metricsGroupVersion+"/namespaces/{namespace}/pods/{name}", source.handle(handler.getPodMetrics))
+	apisRouter.HandleFunc("/"+authenticationv1.GroupName+"/{version}/selfsubjectreviews", source.handle(handler.createSelfSubjectReview)).Methods(http.MethodPost)
+	apisRouter.HandleFunc("/{group}/{version}", source.handle(handler.getAPIByGroupAndVersion))
+	apisRouter.HandleFunc("/{group}/{version}/{resource}", source.handle(handler.getAPIsClusterResources))
+	apisRouter.HandleFunc("/{group}/{version}/{resource}/{name}", source.handle(handler.getAPIsClusterResource))
+	apisRouter.HandleFunc("/{group}/{version}/namespaces/{namespace}/{resource}", source.handle(handler.getAPIsNamespaceResources))
+	apisRouter.HandleFunc("/{group}/{version}/namespaces/{namespace}/{resource}/{name}", source.handle(handler.getAPIsNamespaceResource))
+
+	r.HandleFunc("/version", source.handle(handler.getVersion))
+	r.HandleFunc("/readyz", source.handle(handler.getReadyz))
+
+	registerSbctlAPI(r, source)
+
+	if viper.GetBool("serve-files") {
+		r.Handle(filesPrefix, http.RedirectHandler(filesPrefix+"/", http.StatusMovedPermanently))
+		r.PathPrefix(filesPrefix + "/").HandlerFunc(source.handle(handler.getFiles))
+	}
+
+	r.PathPrefix("/").HandlerFunc(source.handle(handler.getNotFound))
+
+	return trackActivity(withRequestID(handlers.CustomLoggingHandler(logOutput, compressResponse(limitResponseSize(r)), writeLogWithRequestID))) // Handler with logging
 }
 
 func (h handler) getAPI(w http.ResponseWriter, r *http.Request) {
-	log.Println("called getAPI")
+	logger := requestLogger(r)
+	logger.Println("called getAPI")
 	apiVersions := &metav1.APIVersions{
 		Versions: []string{"v1"},
 		ServerAddressByClientCIDRs: []metav1.ServerAddressByClientCIDR{
@@ -172,15 +290,33 @@ func (h handler) getAPI(w http.ResponseWriter, r *http.Request) {
 	JSON(w, http.StatusOK, apiVersions)
 }
 
+// getReadyz responds with 200 once the bundle has cluster resources to serve. Bundles that are
+// served while they are being collected are not ready until the collectors write them.
+func (h handler) getReadyz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	if h.clusterData.ClusterResourcesDir == "" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = io.WriteString(w, "no cluster resources in bundle\n")
+		return
+	}
+	if _, err := os.Stat(h.clusterData.ClusterResourcesDir); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = io.WriteString(w, "cluster resources not collected yet\n")
+		return
+	}
+	_, _ = io.WriteString(w, "ok\n")
+}
+
 func (h handler) getVersion(w http.ResponseWriter, r *http.Request) {
-	log.Println("called getVersion")
-	data, err := readFileAndLog(h.clusterData.ClusterInfoFile)
+	logger := requestLogger(r)
+	logger.Println("called getVersion")
+	data, err := readFileAndLog(r.Context(), h.clusterData.ClusterInfoFile)
 	if err != nil {
-		log.Error("failed to load data: ", err)
 		if os.IsNotExist(err) {
+			logger.Error("failed to load data: ", err)
 			w.WriteHeader(http.StatusNotFound)
 		} else {
-			w.WriteHeader(http.StatusInternalServerError)
+			writeRequestError(w, logger, err, "failed to load data: ")
 		}
 		return
 	}
@@ -188,7 +324,7 @@ func (h handler) getVersion(w http.ResponseWriter, r *http.Request) {
 	var obj clusterVersion
 	err = json.Unmarshal(data, &obj)
 	if err != nil {
-		log.Errorf("unable to parse the server version: %v", err)
+		logger.Errorf("unable to parse the server version: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -197,15 +333,16 @@ func (h handler) getVersion(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h handler) getAPIV1(w http.ResponseWriter, r *http.Request) {
-	log.Println("called getAPIV1")
+	logger := requestLogger(r)
+	logger.Println("called getAPIV1")
 
-	data, err := readFileAndLog(filepath.Join(h.clusterData.ClusterResourcesDir, "resources.json"))
+	data, err := readFileAndLog(r.Context(), filepath.Join(h.clusterData.ClusterResourcesDir, "resources.json"))
 	if err != nil {
-		log.Error("failed to load data: ", err)
 		if os.IsNotExist(err) {
+			logger.Error("failed to load data: ", err)
 			w.WriteHeader(http.StatusNotFound)
 		} else {
-			w.WriteHeader(http.StatusInternalServerError)
+			writeRequestError(w, logger, err, "failed to load data: ")
 		}
 		return
 	}
@@ -220,7 +357,7 @@ func (h handler) getAPIV1(w http.ResponseWriter, r *http.Request) {
 
 	err = json.Unmarshal(data, &allResources)
 	if err != nil {
-		log.Error("failed to unmarshal data: ", err)
+		logger.Error("failed to unmarshal data: ", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -236,166 +373,79 @@ func (h handler) getAPIV1(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h handler) getAPIV1ClusterResources(w http.ResponseWriter, r *http.Request) {
-	log.Println("called getAPIV1ClusterResources")
+	logger := requestLogger(r)
+	logger.Println("called getAPIV1ClusterResources")
 
 	resource := mux.Vars(r)["resource"]
 	asTable := strings.Contains(r.Header.Get("Accept"), "as=Table") // who needs parsing
 
 	fieldSelector, err := fields.ParseSelector(r.URL.Query().Get("fieldSelector"))
 	if err != nil {
-		log.Error("failed to parse fieldSelector ", r.URL.Query().Get("fieldSelector"), ": ", err)
+		logger.Error("failed to parse fieldSelector ", r.URL.Query().Get("fieldSelector"), ": ", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	labelSelector, err := fields.ParseSelector(r.URL.Query().Get("labelSelector"))
+	labelSelector, err := labels.Parse(r.URL.Query().Get("labelSelector"))
 	if err != nil {
-		log.Error("failed to parse labelSelector ", r.URL.Query().Get("labelSelector"), ": ", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		JSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid label selector: %v", err)})
 		return
 	}
 
-	var result runtime.Object
-	filenames := []string{}
-	switch resource {
-	case "namespaces", "nodes", "persistentvolumes", "clusterroles", "clusterrolebindings":
-		filenames = []string{filepath.Join(h.clusterData.ClusterResourcesDir, fmt.Sprintf("%s.json", sbctlutil.GetSBCompatibleResourceName(resource)))}
-	case "pods":
-		result = k8s.GetEmptyPodList()
-		dirName := filepath.Join(h.clusterData.ClusterResourcesDir, resource)
-		filenames, err = getJSONFileListFromDir(dirName)
-		if err != nil {
-			log.Error("failed to get pod files from dir: ", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-	case "events":
-		result = k8s.GetEmptyEventList()
-		dirName := filepath.Join(h.clusterData.ClusterResourcesDir, resource)
-		filenames, err = getJSONFileListFromDir(dirName)
-		if err != nil {
-			log.Error("failed to get event files from dir: ", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-	case "limitranges":
-		result = k8s.GetEmptyLimitRangeList()
-		dirName := filepath.Join(h.clusterData.ClusterResourcesDir, resource)
-		filenames, err = getJSONFileListFromDir(dirName)
-		if err != nil {
-			log.Error("failed to get event files from dir: ", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-	case "services":
-		result = k8s.GetEmptyServiceList()
-		dirName := filepath.Join(h.clusterData.ClusterResourcesDir, resource)
-		filenames, err = getJSONFileListFromDir(dirName)
-		if err != nil {
-			log.Error("failed to get service files from dir: ", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-	case "persistentvolumeclaims":
-		result = k8s.GetEmptyPersistentVolumeClaimList()
-		dirName := filepath.Join(h.clusterData.ClusterResourcesDir, sbctlutil.GetSBCompatibleResourceName(resource))
-		filenames, err = getJSONFileListFromDir(dirName)
-		if err != nil {
-			log.Error("failed to get persistentvolumeclaim files from dir: ", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-	case "configmaps":
-		result = k8s.GetEmptyConfigMapList()
-		dirName := filepath.Join(h.clusterData.ClusterResourcesDir, sbctlutil.GetSBCompatibleResourceName(resource))
-		filenames, err = getJSONFileListFromDir(dirName)
-		if err != nil {
-			log.Error("failed to get configmap files from dir: ", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: resource}
+	filenames, err := h.mapper.ResourceFiles(h.clusterData, gvr)
+	if err != nil {
+		logger.Errorf("failed to get %s files: %v", resource, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
 
+	var result runtime.Object
 	for _, fileName := range filenames {
 		// If we know the file does not exist, just respond with an empty list
 		if !fileExists(fileName) {
 			continue
 		}
 
-		data, err := readFileAndLog(fileName)
+		data, err := readFileAndLog(r.Context(), fileName)
 		if err != nil {
-			log.Error("failed to load file: ", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			writeRequestError(w, logger, err, "failed to load file: ")
 			return
 		}
 
-		decoded, _, err := sbctl.Decode(resource, data)
+		decoded, _, err := sbctl.DecodeWithContext(r.Context(), resource, data, logger)
 		if err != nil {
-			log.Error("failed to decode wrapped ", resource, ": ", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			writeRequestError(w, logger, err, "failed to decode wrapped ", resource, ": ")
 			return
 		}
 
 		// TODO: is this an AND or an OR
 		decoded, err = filterObjectsByLabels(decoded, labelSelector)
 		if err != nil {
-			log.Error("failed to filter by labels: ", err)
+			logger.Error("failed to filter by labels: ", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
 		decoded = filterObjectsByFields(decoded, fieldSelector)
 
-		// The switch below is incomplete, so let's skip it if we are only dealing with 1 list of items
-		if len(filenames) == 1 {
-			result = decoded
-			break
-		}
-
-		switch o := decoded.(type) {
-		case *corev1.EventList:
-			r := result.(*corev1.EventList)
-			r.Items = append(r.Items, o.Items...)
-		case *corev1.PodList:
-			r := result.(*corev1.PodList)
-			r.Items = append(r.Items, o.Items...)
-		case *corev1.LimitRangeList:
-			r := result.(*corev1.LimitRangeList)
-			r.Items = append(r.Items, o.Items...)
-		case *corev1.ServiceList:
-			r := result.(*corev1.ServiceList)
-			r.Items = append(r.Items, o.Items...)
-		case *corev1.PersistentVolumeClaimList:
-			r := result.(*corev1.PersistentVolumeClaimList)
-			r.Items = append(r.Items, o.Items...)
-		case *corev1.ConfigMapList:
-			r := result.(*corev1.ConfigMapList)
-			r.Items = append(r.Items, o.Items...)
-		default:
-			result, err = sbctl.ToUnstructuredList(decoded)
-			if err != nil {
-				log.Error("failed to convert type to unstructured: ", err)
-				w.WriteHeader(http.StatusInternalServerError)
-				return
-			}
+		result, err = appendList(result, decoded)
+		if err != nil {
+			logger.Error("failed to append list: ", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
 		}
 	}
 
 	if result == nil {
-		obj := unstructured.UnstructuredList{}
-		obj.SetGroupVersionKind(schema.GroupVersionKind{
-			Group:   mux.Vars(r)["group"],
-			Version: mux.Vars(r)["version"],
-			Kind:    resource,
-		})
-
-		result = &obj
+		result = h.mapper.NewList(gvr)
 	}
+	result = aggregateEvents(result)
 
 	if asTable {
 		table, err := toTable(result, r)
 		if err != nil {
-			log.Error("could not convert to table: ", err)
+			logger.Error("could not convert to table: ", err)
 		} else {
 			result = table
 		}
@@ -405,54 +455,40 @@ func (h handler) getAPIV1ClusterResources(w http.ResponseWriter, r *http.Request
 }
 
 func (h handler) getAPIV1ClusterResource(w http.ResponseWriter, r *http.Request) {
-	log.Println("called getAPIV1ClusterResource")
+	logger := requestLogger(r)
+	logger.Println("called getAPIV1ClusterResource")
 
 	resource := mux.Vars(r)["resource"]
 	name := mux.Vars(r)["name"]
 
-	filename := filepath.Join(h.clusterData.ClusterResourcesDir, fmt.Sprintf("%s.json", sbctlutil.GetSBCompatibleResourceName(resource)))
-	data, err := readFileAndLog(filename)
+	filenames, err := h.mapper.ResourceFiles(h.clusterData, schema.GroupVersionResource{Version: "v1", Resource: resource})
 	if err != nil {
-		log.Error("failed to load file: ", err)
-		if os.IsNotExist(err) {
-			w.WriteHeader(http.StatusNotFound)
-		} else {
-			w.WriteHeader(http.StatusInternalServerError)
-		}
+		logger.Errorf("failed to get %s files: %v", resource, err)
+		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-
-	decoded, _, err := sbctl.Decode(resource, data)
-	if err != nil {
-		log.Error("failed to decode wrapped ", resource, ": ", err)
-		w.WriteHeader(http.StatusInternalServerError)
+	if len(filenames) == 0 {
+		logger.Errorf("no %s files found", resource)
+		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	// TODO: filter list by selector
-	// selector := r.URL.Query().Get("fieldSelector")
-
-	switch o := decoded.(type) {
-	case *corev1.NamespaceList:
-		for _, item := range o.Items {
-			if item.Name == name {
-				JSON(w, http.StatusOK, item)
-				return
-			}
+	for _, fileName := range filenames {
+		data, err := readFileAndLog(r.Context(), fileName)
+		if err != nil {
+			writeRequestError(w, logger, err, "failed to load file: ")
+			return
 		}
-	case *corev1.NodeList:
-		for _, item := range o.Items {
-			if item.Name == name {
-				JSON(w, http.StatusOK, item)
-				return
-			}
+
+		decoded, _, err := sbctl.DecodeWithContext(r.Context(), resource, data, logger)
+		if err != nil {
+			writeRequestError(w, logger, err, "failed to decode wrapped ", resource, ": ")
+			return
 		}
-	case *corev1.PersistentVolumeList:
-		for _, item := range o.Items {
-			if item.Name == name {
-				JSON(w, http.StatusOK, item)
-				return
-			}
+
+		if item := findListItem(decoded, name); item != nil {
+			JSON(w, http.StatusOK, item)
+			return
 		}
 	}
 
@@ -460,7 +496,8 @@ func (h handler) getAPIV1ClusterResource(w http.ResponseWriter, r *http.Request)
 }
 
 func (h handler) getAPIV1NamespaceResources(w http.ResponseWriter, r *http.Request) {
-	log.Println("called getAPIV1NamespaceResources")
+	logger := requestLogger(r)
+	logger.Println("called getAPIV1NamespaceResources")
 
 	namespace := mux.Vars(r)["namespace"]
 	resource := mux.Vars(r)["resource"]
@@ -468,60 +505,58 @@ func (h handler) getAPIV1NamespaceResources(w http.ResponseWriter, r *http.Reque
 
 	fieldSelector, err := fields.ParseSelector(r.URL.Query().Get("fieldSelector"))
 	if err != nil {
-		log.Error("failed to parse fieldSelector ", fieldSelector, ": ", err)
+		logger.Error("failed to parse fieldSelector ", fieldSelector, ": ", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	labelSelector, err := fields.ParseSelector(r.URL.Query().Get("labelSelector"))
+	labelSelector, err := labels.Parse(r.URL.Query().Get("labelSelector"))
 	if err != nil {
-		log.Error("failed to parse labelSelector ", r.URL.Query().Get("labelSelector"), ": ", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		JSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid label selector: %v", err)})
 		return
 	}
 
-	fileName := filepath.Join(h.clusterData.ClusterResourcesDir, sbctlutil.GetSBCompatibleResourceName(resource), fmt.Sprintf("%s.json", namespace))
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: resource}
+	fileName, err := h.namespaceResourceFile(gvr, namespace)
+	if err != nil {
+		logger.Errorf("failed to get %s files: %v", resource, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 
 	var decoded runtime.Object
 	// If we know the file does not exist, just respond with an empty list
-	if !fileExists(fileName) {
-		obj := unstructured.UnstructuredList{}
-		obj.SetGroupVersionKind(schema.GroupVersionKind{
-			Group:   mux.Vars(r)["group"],
-			Version: mux.Vars(r)["version"],
-			Kind:    resource,
-		})
-		decoded = &obj
+	if fileName == "" {
+		decoded = h.mapper.NewList(gvr)
 	} else {
-		data, err := readFileAndLog(fileName)
+		data, err := readFileAndLog(r.Context(), fileName)
 		if err != nil {
-			log.Error("failed to load file: ", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			writeRequestError(w, logger, err, "failed to load file: ")
 			return
 		}
 
-		decoded, _, err = sbctl.Decode(resource, data)
+		decoded, _, err = sbctl.DecodeWithContext(r.Context(), resource, data, logger)
 		if err != nil {
-			log.Error("failed to decode wrapped ", resource, ": ", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			writeRequestError(w, logger, err, "failed to decode wrapped ", resource, ": ")
 			return
 		}
 
 		// TODO: is this an AND or an OR
 		decoded, err = filterObjectsByLabels(decoded, labelSelector)
 		if err != nil {
-			log.Error("failed to filter by labels: ", err)
+			logger.Error("failed to filter by labels: ", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
 		decoded = filterObjectsByFields(decoded, fieldSelector)
+		decoded = aggregateEvents(decoded)
 	}
 
 	if asTable {
 		table, err := toTable(decoded, r)
 		if err != nil {
-			log.Warn("could not convert to table: ", err)
+			logger.Warn("could not convert to table: ", err)
 		} else {
 			decoded = table
 		}
@@ -531,102 +566,56 @@ func (h handler) getAPIV1NamespaceResources(w http.ResponseWriter, r *http.Reque
 }
 
 func (h handler) getAPIV1NamespaceResource(w http.ResponseWriter, r *http.Request) {
-	log.Println("called getAPIV1NamespaceResource")
+	logger := requestLogger(r)
+	logger.Println("called getAPIV1NamespaceResource")
 
 	namespace := mux.Vars(r)["namespace"]
 	resource := mux.Vars(r)["resource"]
 	name := mux.Vars(r)["name"]
-	fileName := filepath.Join(h.clusterData.ClusterResourcesDir, sbctlutil.GetSBCompatibleResourceName(resource), fmt.Sprintf("%s.json", namespace))
 
-	data, err := readFileAndLog(fileName)
+	fileName, err := h.namespaceResourceFile(schema.GroupVersionResource{Version: "v1", Resource: resource}, namespace)
 	if err != nil {
-		log.Error("failed to load file: ", err)
-		if os.IsNotExist(err) {
-			w.WriteHeader(http.StatusNotFound)
-		} else {
-			w.WriteHeader(http.StatusInternalServerError)
-		}
+		logger.Errorf("failed to get %s files: %v", resource, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if fileName == "" {
+		logger.Errorf("no %s file found for namespace %s", resource, namespace)
+		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	decoded, gvk, err := sbctl.Decode(resource, data)
+	data, err := readFileAndLog(r.Context(), fileName)
 	if err != nil {
-		log.Error("failed to decode wrapped ", resource, ": ", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeRequestError(w, logger, err, "failed to load file: ")
 		return
 	}
 
-	switch o := decoded.(type) {
-	case *corev1.EventList:
-		for _, item := range o.Items {
-			if item.Name == name {
-				JSON(w, http.StatusOK, item)
-				return
-			}
-		}
-	case *corev1.PodList:
-		for _, item := range o.Items {
-			if item.Name == name {
-				JSON(w, http.StatusOK, item)
-				return
-			}
-		}
-	case *corev1.LimitRangeList:
-		for _, item := range o.Items {
-			if item.Name == name {
-				JSON(w, http.StatusOK, item)
-				return
-			}
-		}
-	case *corev1.ServiceList:
-		for _, item := range o.Items {
-			if item.Name == name {
-				JSON(w, http.StatusOK, item)
-				return
-			}
-		}
-	case *corev1.PersistentVolumeClaimList:
-		for _, item := range o.Items {
-			if item.Name == name {
-				JSON(w, http.StatusOK, item)
-				return
-			}
-		}
-	case *corev1.ConfigMapList:
-		for _, item := range o.Items {
-			if item.Name == name {
-				JSON(w, http.StatusOK, item)
-				return
-			}
-		}
-	default:
-		uObjList, err := sbctl.ToUnstructuredList(decoded)
-		if err != nil {
-			log.Error("failed to convert type to unstructured: ", gvk)
-			return
-		} else {
-			for _, item := range uObjList.Items {
-				if item.GetName() == name {
-					JSON(w, http.StatusOK, item)
-					return
-				}
-			}
-		}
+	decoded, _, err := sbctl.DecodeWithContext(r.Context(), resource, data, logger)
+	if err != nil {
+		writeRequestError(w, logger, err, "failed to decode wrapped ", resource, ": ")
+		return
+	}
+
+	if item := findListItem(decoded, name); item != nil {
+		JSON(w, http.StatusOK, item)
+		return
 	}
 
 	JSON(w, http.StatusNotFound, errorNotFound)
 }
 
 func (h handler) getAPIs(w http.ResponseWriter, r *http.Request) {
-	log.Println("called getAPIs")
+	logger := requestLogger(r)
+	logger.Println("called getAPIs")
 
-	data, err := readFileAndLog(filepath.Join(h.clusterData.ClusterResourcesDir, "groups.json"))
+	data, err := readFileAndLog(r.Context(), filepath.Join(h.clusterData.ClusterResourcesDir, "groups.json"))
 	if err != nil {
-		log.Error("failed to load data: ", err)
 		if os.IsNotExist(err) {
+			logger.Error("failed to load data: ", err)
 			w.WriteHeader(http.StatusNotFound)
 		} else {
-			w.WriteHeader(http.StatusInternalServerError)
+			writeRequestError(w, logger, err, "failed to load data: ")
 		}
 		return
 	}
@@ -634,7 +623,7 @@ func (h handler) getAPIs(w http.ResponseWriter, r *http.Request) {
 	allGroups := []metav1.APIGroup{}
 	err = json.Unmarshal(data, &allGroups)
 	if err != nil {
-		log.Error("failed to unmarshal data: ", err)
+		logger.Error("failed to unmarshal data: ", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -647,6 +636,51 @@ func (h handler) getAPIs(w http.ResponseWriter, r *http.Request) {
 		}
 		filteredGroups = append(filteredGroups, group)
 	}
+
+	if h.clusterData.AnalysisFile != "" {
+		found := false
+		for _, group := range filteredGroups {
+			found = found || group.Name == analysisGroup
+		}
+		if !found {
+			filteredGroups = append(filteredGroups, analysisAPIGroup())
+		}
+	}
+	if h.hasMetrics() {
+		found := false
+		for _, group := range filteredGroups {
+			found = found || group.Name == metricsGroup
+		}
+		if !found {
+			filteredGroups = append(filteredGroups, metricsAPIGroup())
+		}
+	}
+	// Older bundles may be from clusters without the events.k8s.io group, core events are served in it
+	eventsFound := false
+	for _, group := range filteredGroups {
+		eventsFound = eventsFound || group.Name == eventsv1.GroupName
+	}
+	if !eventsFound {
+		filteredGroups = append(filteredGroups, eventsAPIGroup())
+	}
+	// Virtual groups and groups of well-known CRDs may be served in part by the cluster already
+	for _, virtualGroup := range append(h.virtualAPIGroups(), h.wellKnownCRDGroups()...) {
+		found := false
+		for i, group := range filteredGroups {
+			if group.Name != virtualGroup.Name {
+				continue
+			}
+			found = true
+			for _, version := range virtualGroup.Versions {
+				if !containsGroupVersion(group.Versions, version) {
+					filteredGroups[i].Versions = append(filteredGroups[i].Versions, version)
+				}
+			}
+		}
+		if !found {
+			filteredGroups = append(filteredGroups, virtualGroup)
+		}
+	}
 	groupList := map[string]interface{}{
 		"kind":       "APIGroupList",
 		"apiVersion": "v1",
@@ -657,18 +691,19 @@ func (h handler) getAPIs(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h handler) getAPIByGroupAndVersion(w http.ResponseWriter, r *http.Request) {
-	log.Println("called getAPIByGroupAndVersion")
+	logger := requestLogger(r)
+	logger.Println("called getAPIByGroupAndVersion")
 
 	group := mux.Vars(r)["group"]
 	version := mux.Vars(r)["version"]
 
-	data, err := readFileAndLog(filepath.Join(h.clusterData.ClusterResourcesDir, "resources.json"))
+	data, err := readFileAndLog(r.Context(), filepath.Join(h.clusterData.ClusterResourcesDir, "resources.json"))
 	if err != nil {
-		log.Error("failed to load data: ", err)
 		if os.IsNotExist(err) {
+			logger.Error("failed to load data: ", err)
 			w.WriteHeader(http.StatusNotFound)
 		} else {
-			w.WriteHeader(http.StatusInternalServerError)
+			writeRequestError(w, logger, err, "failed to load data: ")
 		}
 		return
 	}
@@ -683,233 +718,117 @@ func (h handler) getAPIByGroupAndVersion(w http.ResponseWriter, r *http.Request)
 
 	err = json.Unmarshal(data, &allResources)
 	if err != nil {
-		log.Error("failed to unmarshal data: ", err)
+		logger.Error("failed to unmarshal data: ", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
 	groupVersion := fmt.Sprintf("%s/%s", group, version)
-	for _, resources := range allResources {
-		if resources.GroupVersion == groupVersion {
-			JSON(w, http.StatusOK, resources)
-			return
-		}
+	syntheticResources := []metav1.APIResource{}
+	if groupVersion == analysisGroupVersion && h.clusterData.AnalysisFile != "" {
+		syntheticResources = append(syntheticResources, analysisAPIResource())
 	}
-
-	JSON(w, http.StatusNotFound, errorNotFound)
-}
-
-// This one below here needs to stay complete:
-func (h handler) getAPIsClusterResources(w http.ResponseWriter, r *http.Request) {
-	log.Println("called getAPIsClusterResources")
-
-	group := mux.Vars(r)["group"]
-	version := mux.Vars(r)["version"]
-	resource := mux.Vars(r)["resource"]
-	asTable := strings.Contains(r.Header.Get("Accept"), "as=Table") // who needs parsing
-
-	var result runtime.Object
-	var err error
-	var filenames []string
-	switch resource {
-	case "jobs":
-		result = &batchv1.JobList{
-			Items: []batchv1.Job{},
-		}
-		result.GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{
-			Group:   group,
-			Version: version,
-			Kind:    "JobList",
-		})
-		dirName := filepath.Join(h.clusterData.ClusterResourcesDir, resource)
-		filenames, err = getJSONFileListFromDir(dirName)
-		if err != nil {
-			log.Error("failed to get job files from dir: ", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-	case "cronjobs":
-		result = &batchv1beta1.CronJobList{
-			Items: []batchv1beta1.CronJob{},
-		}
-		result.GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{
-			Group:   group,
-			Version: version,
-			Kind:    "CronJobList",
-		})
-		dirName := filepath.Join(h.clusterData.ClusterResourcesDir, resource)
-		filenames, err = getJSONFileListFromDir(dirName)
-		if err != nil {
-			log.Error("failed to get cronjob files from dir: ", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-	case "deployments":
-		result = &appsv1.DeploymentList{
-			Items: []appsv1.Deployment{},
-		}
-		result.GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{
-			Group:   group,
-			Version: version,
-			Kind:    "DeploymentList",
-		})
-		dirName := filepath.Join(h.clusterData.ClusterResourcesDir, resource)
-		filenames, err = getJSONFileListFromDir(dirName)
-		if err != nil {
-			log.Error("failed to get deployment files from dir: ", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-	case "replicasets":
-		result = &appsv1.ReplicaSetList{
-			Items: []appsv1.ReplicaSet{},
-		}
-		result.GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{
-			Group:   group,
-			Version: version,
-			Kind:    "ReplicaSetList",
-		})
-		dirName := filepath.Join(h.clusterData.ClusterResourcesDir, resource)
-		filenames, err = getJSONFileListFromDir(dirName)
-		if err != nil {
-			log.Error("failed to get replicaset files from dir: ", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-	case "statefulsets":
-		result = &appsv1.StatefulSetList{
-			Items: []appsv1.StatefulSet{},
-		}
-		result.GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{
-			Group:   group,
-			Version: version,
-			Kind:    "StatefulSetList",
-		})
-		dirName := filepath.Join(h.clusterData.ClusterResourcesDir, resource)
-		filenames, err = getJSONFileListFromDir(dirName)
-		if err != nil {
-			log.Error("failed to get replicaset files from dir: ", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-	case "storageclasses":
-		result = &storagev1.StorageClassList{
-			Items: []storagev1.StorageClass{},
-		}
-		result.GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{
-			Group:   group,
-			Version: version,
-			Kind:    "StorageClassList",
-		})
-		filenames = []string{filepath.Join(h.clusterData.ClusterResourcesDir, fmt.Sprintf("%s.json", sbctlutil.GetSBCompatibleResourceName(resource)))}
-		if err != nil {
-			log.Error("failed to get storageclasses files from dir: ", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-	case "customresourcedefinitions":
-		result = &extensionsv1.CustomResourceDefinitionList{
-			Items: []extensionsv1.CustomResourceDefinition{},
-		}
-		result.GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{
-			Group:   group,
-			Version: version,
-			Kind:    "CustomResourceDefinitionList",
-		})
-		filenames = []string{filepath.Join(h.clusterData.ClusterResourcesDir, fmt.Sprintf("%s.json", sbctlutil.GetSBCompatibleResourceName(resource)))}
-		if err != nil {
-			log.Error("failed to get customresourcedefinitions files from dir: ", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-	case "ingresses":
-		result = &networkingv1.IngressList{
-			Items: []networkingv1.Ingress{},
-		}
-		result.GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{
-			Group:   group,
-			Version: version,
-			Kind:    "IngressList",
-		})
-		dirName := filepath.Join(h.clusterData.ClusterResourcesDir, sbctlutil.GetSBCompatibleResourceName(resource))
-		filenames, err = getJSONFileListFromDir(dirName)
-		if err != nil {
-			log.Error("failed to get ingresses files from dir: ", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-	case "roles":
-		result = &rbacv1.RoleList{
-			Items: []rbacv1.Role{},
-		}
-		result.GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{
-			Group:   group,
-			Version: version,
-			Kind:    "RoleList",
-		})
-		dirName := filepath.Join(h.clusterData.ClusterResourcesDir, sbctlutil.GetSBCompatibleResourceName(resource))
-		filenames, err = getJSONFileListFromDir(dirName)
-		if err != nil {
-			log.Error("failed to get roles files from dir: ", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
+	if groupVersion == metricsGroupVersion && h.hasMetrics() {
+		syntheticResources = append(syntheticResources, metricsAPIResources()...)
+	}
+	if groupVersion == eventsv1.SchemeGroupVersion.String() {
+		eventsFound := false
+		for _, resources := range allResources {
+			eventsFound = eventsFound || resources.GroupVersion == groupVersion
 		}
-	case "clusterroles":
-		result = &rbacv1.ClusterRoleList{
-			Items: []rbacv1.ClusterRole{},
+		if !eventsFound {
+			syntheticResources = append(syntheticResources, eventsAPIResource())
 		}
-		result.GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{
-			Group:   group,
-			Version: version,
-			Kind:    "ClusterRoleList",
-		})
-		filenames = []string{filepath.Join(h.clusterData.ClusterResourcesDir, fmt.Sprintf("%s.json", sbctlutil.GetSBCompatibleResourceName(resource)))}
-		if err != nil {
-			log.Error("failed to get clusterrole files from dir: ", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
+	}
+	for _, r := range h.virtualResources() {
+		if r.Group == group && r.Version == version {
+			syntheticResources = append(syntheticResources, virtualAPIResource(r))
 		}
-	case "rolebindings":
-		result = &rbacv1.RoleBindingList{
-			Items: []rbacv1.RoleBinding{},
+	}
+	if sbctl.IsWellKnownCRDGroup(group) {
+		discovered := map[string]bool{}
+		for _, resources := range allResources {
+			if resources.GroupVersion != groupVersion {
+				continue
+			}
+			list := []metav1.APIResource{}
+			data, err := json.Marshal(resources.Resources)
+			if err == nil && json.Unmarshal(data, &list) == nil {
+				for _, r := range list {
+					discovered[r.Name] = true
+				}
+			}
 		}
-		result.GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{
-			Group:   group,
-			Version: version,
-			Kind:    "RoleBindingList",
-		})
-		dirName := filepath.Join(h.clusterData.ClusterResourcesDir, sbctlutil.GetSBCompatibleResourceName(resource))
-		filenames, err = getJSONFileListFromDir(dirName)
-		if err != nil {
-			log.Error("failed to get rolebindings files from dir: ", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
+		for _, list := range h.wellKnownCRDResources() {
+			if list.GroupVersion != groupVersion {
+				continue
+			}
+			for _, r := range list.APIResources {
+				if !discovered[r.Name] {
+					syntheticResources = append(syntheticResources, r)
+				}
+			}
 		}
-	case "clusterrolebindings":
-		result = &rbacv1.ClusterRoleBindingList{
-			Items: []rbacv1.ClusterRoleBinding{},
+	}
+	if len(syntheticResources) > 0 {
+		// Resources of the group may be installed in the cluster, so synthetic ones are added to them
+		groupResources := metav1.APIResourceList{GroupVersion: groupVersion}
+		groupResources.Kind = "APIResourceList"
+		groupResources.APIVersion = "v1"
+		for _, resources := range allResources {
+			if resources.GroupVersion != groupVersion {
+				continue
+			}
+			data, err := json.Marshal(resources.Resources)
+			if err == nil {
+				_ = json.Unmarshal(data, &groupResources.APIResources)
+			}
 		}
-		result.GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{
-			Group:   group,
-			Version: version,
-			Kind:    "ClusterRoleBindingList",
-		})
-		filenames = []string{filepath.Join(h.clusterData.ClusterResourcesDir, fmt.Sprintf("%s.json", sbctlutil.GetSBCompatibleResourceName(resource)))}
-		if err != nil {
-			log.Error("failed to get cluster-role-binding files from dir: ", err)
-			w.WriteHeader(http.StatusInternalServerError)
+		groupResources.APIResources = append(groupResources.APIResources, syntheticResources...)
+		JSON(w, http.StatusOK, groupResources)
+		return
+	}
+
+	for _, resources := range allResources {
+		if resources.GroupVersion == groupVersion {
+			JSON(w, http.StatusOK, resources)
 			return
 		}
-	case "selfsubjectaccessreviews":
+	}
+
+	JSON(w, http.StatusNotFound, errorNotFound)
+}
+
+// This one below here needs to stay complete:
+func (h handler) getAPIsClusterResources(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+	logger.Println("called getAPIsClusterResources")
+
+	if h.serveVirtualResource(w, r) {
+		return
+	}
+
+	group := mux.Vars(r)["group"]
+	version := mux.Vars(r)["version"]
+	resource := mux.Vars(r)["resource"]
+	asTable := strings.Contains(r.Header.Get("Accept"), "as=Table") // who needs parsing
+
+	labelSelector, err := labels.Parse(r.URL.Query().Get("labelSelector"))
+	if err != nil {
+		JSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid label selector: %v", err)})
+		return
+	}
+
+	if resource == "selfsubjectaccessreviews" {
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
-			log.Error("failed to read request body: ", err)
+			logger.Error("failed to read request body: ", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
-		decoded, gvk, err := sbctl.Decode(resource, body)
+		decoded, gvk, err := sbctl.DecodeWithLogger(resource, body, logger)
 		if err != nil {
-			log.Error("failed to decode wrapped ", resource, ": ", err)
+			logger.Error("failed to decode wrapped ", resource, ": ", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
@@ -917,50 +836,52 @@ func (h handler) getAPIsClusterResources(w http.ResponseWriter, r *http.Request)
 			selfReview.Status.Allowed = true // In sbctl, we always allow self access reviews
 			JSON(w, http.StatusOK, selfReview)
 		} else {
-			log.Warnf("We do not know gvk: %s\n", gvk)
+			logger.Warnf("We do not know gvk: %s\n", gvk)
 			JSON(w, http.StatusNotFound, errorNotFound)
 		}
 		return
-	default:
-		dirName := filepath.Join(h.clusterData.ClusterResourcesDir, sbctlutil.GetSBCompatibleResourceName(resource))
-
-		// Check if its in custom resources dir
-		if !pathExists(dirName) {
-			g := fmt.Sprintf("%s.%s", resource, mux.Vars(r)["group"])
-			dirName = filepath.Join(h.clusterData.ClusterResourcesDir, "custom-resources", g)
-		}
+	}
 
-		filenames, err = getJSONFileListFromDir(dirName)
-		if err != nil {
-			log.Errorf("failed to get %s files from dir: %v\n", resource, err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+	gvr := schema.GroupVersionResource{Group: group, Version: version, Resource: resource}
+	filenames, err := h.mapper.ResourceFiles(h.clusterData, gvr)
+	if err != nil {
+		logger.Errorf("failed to get %s files: %v\n", resource, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if len(filenames) == 0 && h.serveFallback(w, r) {
+		return
 	}
 
+	var result runtime.Object
 	for _, fileName := range filenames {
 		// If we know the file does not exist, just respond with an empty list
 		if !fileExists(fileName) {
 			continue
 		}
 
-		data, err := readFileAndLog(fileName)
+		data, err := readFileAndLog(r.Context(), fileName)
 		if err != nil {
-			log.Error("failed to load file: ", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			writeRequestError(w, logger, err, "failed to load file: ")
 			return
 		}
 
-		decoded, _, err := sbctl.Decode(resource, data)
+		decoded, _, err := sbctl.DecodeWithContext(r.Context(), resource, data, logger)
 		if err != nil {
-			log.Error("failed to decode wrapped ", resource, ": ", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			writeRequestError(w, logger, err, "failed to decode wrapped ", resource, ": ")
 			return
 		}
 
 		// No need to do type conversions if only one file is returned.
 		// This will always be the case for cluster level resources, and sometimes for namespaced resources.
 		if len(filenames) == 1 {
+			decoded = convertToRequestedVersion(decoded, schema.GroupVersion{Group: group, Version: version})
+			decoded, err = filterObjectsByLabels(decoded, labelSelector)
+			if err != nil {
+				logger.Error("failed to filter by labels: ", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
 			if asTable {
 				if list, ok := decoded.(*unstructured.UnstructuredList); ok {
 					sbctl.SortUnstructuredList(list)
@@ -969,7 +890,7 @@ func (h handler) getAPIsClusterResources(w http.ResponseWriter, r *http.Request)
 
 				table, err := toTable(decoded, r)
 				if err != nil {
-					log.Warn("could not convert to table:", err)
+					logger.Warn("could not convert to table:", err)
 				} else {
 					decoded = table
 				}
@@ -977,55 +898,25 @@ func (h handler) getAPIsClusterResources(w http.ResponseWriter, r *http.Request)
 			JSON(w, http.StatusOK, decoded)
 			return
 		}
-		// TODO: filter list by selector
-		// selector := r.URL.Query().Get("fieldSelector")
-		switch o := decoded.(type) {
-		case *batchv1.JobList:
-			r := result.(*batchv1.JobList)
-			r.Items = append(r.Items, o.Items...)
-		case *batchv1beta1.CronJobList:
-			r := result.(*batchv1beta1.CronJobList)
-			r.Items = append(r.Items, o.Items...)
-		case *appsv1.DeploymentList:
-			r := result.(*appsv1.DeploymentList)
-			r.Items = append(r.Items, o.Items...)
-		case *appsv1.ReplicaSetList:
-			r := result.(*appsv1.ReplicaSetList)
-			r.Items = append(r.Items, o.Items...)
-		case *appsv1.StatefulSetList:
-			r := result.(*appsv1.StatefulSetList)
-			r.Items = append(r.Items, o.Items...)
-		case *storagev1.StorageClassList:
-			r := result.(*storagev1.StorageClassList)
-			r.Items = append(r.Items, o.Items...)
-		case *networkingv1.IngressList:
-			r := result.(*networkingv1.IngressList)
-			r.Items = append(r.Items, o.Items...)
-		case *rbacv1.RoleList:
-			r := result.(*rbacv1.RoleList)
-			r.Items = append(r.Items, o.Items...)
-		case *rbacv1.RoleBindingList:
-			r := result.(*rbacv1.RoleBindingList)
-			r.Items = append(r.Items, o.Items...)
-		default:
-			result, err = sbctl.ToUnstructuredList(decoded)
-			if err != nil {
-				log.Error("failed to convert type to unstructured list: ", err)
-				w.WriteHeader(http.StatusInternalServerError)
-				return
-			}
+
+		result, err = appendList(result, decoded)
+		if err != nil {
+			logger.Error("failed to append list: ", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
 		}
 	}
 
 	if result == nil {
-		obj := unstructured.UnstructuredList{}
-		obj.SetGroupVersionKind(schema.GroupVersionKind{
-			Group:   mux.Vars(r)["group"],
-			Version: mux.Vars(r)["version"],
-			Kind:    resource,
-		})
-
-		result = &obj
+		result = h.mapper.NewList(gvr)
+	}
+	result = aggregateEvents(result)
+	result = convertToRequestedVersion(result, schema.GroupVersion{Group: group, Version: version})
+	result, err = filterObjectsByLabels(result, labelSelector)
+	if err != nil {
+		logger.Error("failed to filter by labels: ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
 
 	if asTable {
@@ -1036,7 +927,7 @@ func (h handler) getAPIsClusterResources(w http.ResponseWriter, r *http.Request)
 
 		table, err := toTable(result, r)
 		if err != nil {
-			log.Warn("could not convert to table:", err)
+			logger.Warn("could not convert to table:", err)
 		} else {
 			result = table
 		}
@@ -1046,94 +937,116 @@ func (h handler) getAPIsClusterResources(w http.ResponseWriter, r *http.Request)
 }
 
 func (h handler) getAPIsClusterResource(w http.ResponseWriter, r *http.Request) {
-	log.Println("called getAPIsClusterResource")
+	logger := requestLogger(r)
+	logger.Println("called getAPIsClusterResource")
 
-	resource := mux.Vars(r)["resource"]
-	name := mux.Vars(r)["name"]
-	fileName := filepath.Join(h.clusterData.ClusterResourcesDir, fmt.Sprintf("%s.json", sbctlutil.GetSBCompatibleResourceName(resource)))
-	data, err := readFileAndLog(fileName)
-	if err != nil {
-		log.Error("failed to load file", err)
-		if os.IsNotExist(err) {
-			w.WriteHeader(http.StatusNotFound)
-		} else {
-			w.WriteHeader(http.StatusInternalServerError)
-		}
+	if h.serveVirtualResource(w, r) {
 		return
 	}
 
-	decoded, _, err := sbctl.Decode(resource, data)
+	group := mux.Vars(r)["group"]
+	resource := mux.Vars(r)["resource"]
+	name := mux.Vars(r)["name"]
+	gvr := schema.GroupVersionResource{Group: group, Version: mux.Vars(r)["version"], Resource: resource}
+	filenames, err := h.mapper.ResourceFiles(h.clusterData, gvr)
 	if err != nil {
-		log.Error("failed to decode wrapped", resource, ":", err)
+		logger.Error("failed to get resource files: ", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	if len(filenames) == 0 && h.serveFallback(w, r) {
+		return
+	}
 
-	switch o := decoded.(type) {
-	case *storagev1.StorageClassList:
-		for _, item := range o.Items {
-			if item.Name == name {
-				JSON(w, http.StatusOK, item)
-				return
+	for _, fileName := range filenames {
+		data, err := readFileAndLog(r.Context(), fileName)
+		if err != nil {
+			if os.IsNotExist(err) {
+				logger.Error("failed to load file", err)
+				w.WriteHeader(http.StatusNotFound)
+			} else {
+				writeRequestError(w, logger, err, "failed to load file")
 			}
+			return
 		}
-	case *extensionsv1.CustomResourceDefinitionList:
-		for _, item := range o.Items {
-			if item.Name == name {
-				JSON(w, http.StatusOK, item)
-				return
-			}
+
+		decoded, _, err := sbctl.DecodeWithContext(r.Context(), resource, data, logger)
+		if err != nil {
+			writeRequestError(w, logger, err, "failed to decode wrapped", resource, ":")
+			return
+		}
+		decoded = convertToRequestedVersion(decoded, schema.GroupVersion{Group: group, Version: mux.Vars(r)["version"]})
+
+		if item := findListItem(decoded, name); item != nil {
+			JSON(w, http.StatusOK, item)
+			return
 		}
 	}
+
 	JSON(w, http.StatusNotFound, errorNotFound)
 }
 
 func (h handler) getAPIsNamespaceResources(w http.ResponseWriter, r *http.Request) {
-	log.Println("called getAPIsNamespaceResources")
+	logger := requestLogger(r)
+	logger.Println("called getAPIsNamespaceResources")
+
+	if h.serveVirtualResource(w, r) {
+		return
+	}
 
 	namespace := mux.Vars(r)["namespace"]
 	resource := mux.Vars(r)["resource"]
 	asTable := strings.Contains(r.Header.Get("Accept"), "as=Table") // who needs parsing
 
-	fileName := filepath.Join(h.clusterData.ClusterResourcesDir, sbctlutil.GetSBCompatibleResourceName(resource), fmt.Sprintf("%s.json", namespace))
+	labelSelector, err := labels.Parse(r.URL.Query().Get("labelSelector"))
+	if err != nil {
+		JSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid label selector: %v", err)})
+		return
+	}
 
-	// Check if its in custom resources dir
-	if !fileExists(fileName) {
-		dirName := fmt.Sprintf("%s.%s", resource, mux.Vars(r)["group"])
-		fileName = filepath.Join(h.clusterData.ClusterResourcesDir, "custom-resources", dirName, fmt.Sprintf("%s.json", namespace))
+	gvr := schema.GroupVersionResource{Group: mux.Vars(r)["group"], Version: mux.Vars(r)["version"], Resource: resource}
+	fileName, err := h.namespaceResourceFile(gvr, namespace)
+	if err != nil {
+		logger.Errorf("failed to get %s files: %v", resource, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
 
 	var decoded runtime.Object
 	// If the file does not exist, return an empty list
-	if fileExists(fileName) {
-		data, err := readFileAndLog(fileName)
+	if fileName != "" {
+		data, err := readFileAndLog(r.Context(), fileName)
 		if err != nil {
-			log.Error("failed to load file: ", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			writeRequestError(w, logger, err, "failed to load file: ")
 			return
 		}
 
-		decoded, _, err = sbctl.Decode(resource, data)
+		decoded, _, err = sbctl.DecodeWithContext(r.Context(), resource, data, logger)
 		if err != nil {
-			log.Error("failed to decode wrapped ", resource, ": ", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			writeRequestError(w, logger, err, "failed to decode wrapped ", resource, ": ")
 			return
 		}
+		decoded = aggregateEvents(decoded)
+		decoded = convertToRequestedVersion(decoded, schema.GroupVersion{Group: mux.Vars(r)["group"], Version: mux.Vars(r)["version"]})
 	} else {
-		obj := unstructured.UnstructuredList{}
-		obj.SetGroupVersionKind(schema.GroupVersionKind{
-			Group:   mux.Vars(r)["group"],
-			Version: mux.Vars(r)["version"],
-			Kind:    resource,
-		})
+		if h.serveFallback(w, r) {
+			return
+		}
 
-		decoded = &obj
+		decoded = h.mapper.NewList(gvr)
+	}
+
+	decoded, err = filterObjectsByLabels(decoded, labelSelector)
+	if err != nil {
+		logger.Error("failed to filter by labels: ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
 
 	if asTable {
 		table, err := toTable(decoded, r)
 		if err != nil {
-			log.Warn("could not convert to table: ", err)
+			logger.Warn("could not convert to table: ", err)
 		} else {
 			decoded = table
 		}
@@ -1143,7 +1056,12 @@ func (h handler) getAPIsNamespaceResources(w http.ResponseWriter, r *http.Reques
 }
 
 func (h handler) getAPIsNamespaceResource(w http.ResponseWriter, r *http.Request) {
-	log.Println("called getAPIsNamespaceResource")
+	logger := requestLogger(r)
+	logger.Println("called getAPIsNamespaceResource")
+
+	if h.serveVirtualResource(w, r) {
+		return
+	}
 
 	// It's important to respond with correct group and version here.  If the request is for batch/v1beta1/cronjobs,
 	// we cannot return a batch/v1/cronjobs object.
@@ -1158,7 +1076,7 @@ func (h handler) getAPIsNamespaceResource(w http.ResponseWriter, r *http.Request
 		if asTable {
 			table, err := toTable(d, r)
 			if err != nil {
-				log.Warn("could not convert to table: ", err)
+				logger.Warn("could not convert to table: ", err)
 			} else {
 				d = table
 			}
@@ -1166,146 +1084,60 @@ func (h handler) getAPIsNamespaceResource(w http.ResponseWriter, r *http.Request
 		JSON(w, http.StatusOK, d)
 	}
 
-	fileName := filepath.Join(h.clusterData.ClusterResourcesDir, sbctlutil.GetSBCompatibleResourceName(resource), fmt.Sprintf("%s.json", namespace))
-
-	// Check if its in custom resources dir
-	if !fileExists(fileName) {
-		dirName := fmt.Sprintf("%s.%s", resource, mux.Vars(r)["group"])
-		fileName = filepath.Join(h.clusterData.ClusterResourcesDir, "custom-resources", dirName, fmt.Sprintf("%s.json", namespace))
-	}
-
-	data, err := readFileAndLog(fileName)
-	if err != nil {
-		log.Error("failed to load file: ", err)
-		if os.IsNotExist(err) {
-			w.WriteHeader(http.StatusNotFound)
-		} else {
-			w.WriteHeader(http.StatusInternalServerError)
-		}
-		return
-	}
-
-	decoded, _, err := sbctl.Decode(resource, data)
+	fileName, err := h.namespaceResourceFile(schema.GroupVersionResource{Group: group, Version: version, Resource: resource}, namespace)
 	if err != nil {
-		log.Error("failed to decode wrapped ", resource, ": ", err)
+		logger.Errorf("failed to get %s files: %v", resource, err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-
-	if group == "apps" && version == "v1" {
-		switch o := decoded.(type) {
-		case *appsv1.ReplicaSetList:
-			for _, item := range o.Items {
-				if item.Name == name {
-					item := item
-					setResponse(&item)
-					return
-				}
-			}
-		case *appsv1.DeploymentList:
-			for _, item := range o.Items {
-				if item.Name == name {
-					item := item
-					setResponse(&item)
-					return
-				}
-			}
-		case *appsv1.DaemonSetList:
-			for _, item := range o.Items {
-				if item.Name == name {
-					item := item
-					setResponse(&item)
-					return
-				}
-			}
-		case *appsv1.StatefulSetList:
-			for _, item := range o.Items {
-				if item.Name == name {
-					item := item
-					setResponse(&item)
-					return
-				}
-			}
-		}
-	}
-
-	if group == "batch" && version == "v1" {
-		switch o := decoded.(type) {
-		case *batchv1.JobList:
-			for _, item := range o.Items {
-				if item.Name == name {
-					item := item
-					setResponse(&item)
-					return
-				}
-			}
-		case *batchv1.CronJobList:
-			for _, item := range o.Items {
-				if item.Name == name {
-					item := item
-					setResponse(&item)
-					return
-				}
-			}
+	if fileName == "" {
+		if h.serveFallback(w, r) {
+			return
 		}
+		logger.Errorf("no %s file found for namespace %s", resource, namespace)
+		w.WriteHeader(http.StatusNotFound)
+		return
 	}
 
-	if group == "batch" && version == "v1beta1" {
-		switch o := decoded.(type) { // nolint: gocritic
-		case *batchv1beta1.CronJobList:
-			for _, item := range o.Items {
-				if item.Name == name {
-					item := item
-					setResponse(&item)
-					return
-				}
-			}
-		}
+	data, err := readFileAndLog(r.Context(), fileName)
+	if err != nil {
+		writeRequestError(w, logger, err, "failed to load file: ")
+		return
 	}
 
-	if group == "networking" && version == "v1" {
-		switch o := decoded.(type) { // nolint: gocritic
-		case *networkingv1.IngressList:
-			for _, item := range o.Items {
-				if item.Name == name {
-					item := item
-					setResponse(&item)
-					return
-				}
-			}
-		}
+	decoded, _, err := sbctl.DecodeWithContext(r.Context(), resource, data, logger)
+	if err != nil {
+		writeRequestError(w, logger, err, "failed to decode wrapped ", resource, ": ")
+		return
 	}
+	decoded = convertToRequestedVersion(decoded, schema.GroupVersion{Group: group, Version: version})
 
-	uObjList, err := sbctl.ToUnstructuredList(decoded)
-	if err != nil {
-		log.Error("failed to convert type to unstructured list: ", err)
+	if item := findListItem(decoded, name); item != nil {
+		setResponse(item)
 		return
-	} else {
-		for _, item := range uObjList.Items {
-			if item.GetName() == name {
-				item := item
-				setResponse(&item)
-				return
-			}
-		}
 	}
 
-	log.Printf("unknown type in group=%s version=%s: %T\n", group, version, decoded)
 	JSON(w, http.StatusNotFound, errorNotFound)
 }
 
 func (h handler) getNotFound(w http.ResponseWriter, r *http.Request) {
-	log.Println("called getNotFound")
+	logger := requestLogger(r)
+	logger.Println("called getNotFound")
 
 	var b bytes.Buffer
 	_, _ = io.Copy(&b, r.Body)
 
 	body := b.Bytes()
 	if len(body) > 0 {
-		log.Printf("body: %s\n", body)
+		logger.Printf("body: %s\n", body)
+	}
+
+	// Paths under /apis that no route matches, such as subresources, are looked up by resource
+	if vars, ok := parseAPIsPath(r.URL.Path); ok && h.serveFallback(w, mux.SetURLVars(r, vars)) {
+		return
 	}
 
-	http.Error(w, "", http.StatusNotFound)
+	w.WriteHeader(http.StatusNotFound)
 }
 
 func fileExists(filename string) bool {
@@ -1322,6 +1154,11 @@ func pathExists(filename string) bool {
 }
 
 func JSON(w http.ResponseWriter, code int, payload interface{}) {
+	if e, ok := payload.(errorResponse); ok {
+		e.RequestID = w.Header().Get(requestIDHeader)
+		payload = e
+	}
+
 	if obj, ok := interface{}(payload).(runtime.Object); ok {
 		log.Printf("Reponse GVK: (%s)\n", obj.GetObjectKind().GroupVersionKind())
 	}
@@ -1334,6 +1171,7 @@ func JSON(w http.ResponseWriter, code int, payload interface{}) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(response)))
 	w.WriteHeader(code)
 
 	_, err = w.Write(response)
@@ -1342,73 +1180,112 @@ func JSON(w http.ResponseWriter, code int, payload interface{}) {
 	}
 }
 
-func getJSONFileListFromDir(dir string) ([]string, error) {
-	filenames := []string{}
+// findListItem returns the item of list with the given name, or nil if there is none
+func findListItem(list runtime.Object, name string) runtime.Object {
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return nil
+	}
+	for _, item := range items {
+		if accessor, err := meta.Accessor(item); err == nil && accessor.GetName() == name {
+			return item
+		}
+	}
+	return nil
+}
 
-	files, err := os.ReadDir(dir)
+// namespaceResourceFile returns the file that the objects of a resource in a namespace are stored
+// in, which is named after the namespace, or an empty string when the bundle has none
+func (h handler) namespaceResourceFile(resource schema.GroupVersionResource, namespace string) (string, error) {
+	filenames, err := h.mapper.ResourceFiles(h.clusterData, resource)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to read dir")
+		return "", err
+	}
+	for _, fileName := range filenames {
+		base := filepath.Base(fileName)
+		if strings.TrimSuffix(base, filepath.Ext(base)) == namespace {
+			return fileName, nil
+		}
 	}
+	return "", nil
+}
 
-	for _, file := range files {
-		if file.IsDir() || strings.ToLower(filepath.Ext(file.Name())) != ".json" {
-			continue
+// appendList appends the items of list to those of result, or returns list if result is nil. Lists
+// of different types, e.g. of different versions of a resource, are merged as unstructured lists.
+func appendList(result runtime.Object, list runtime.Object) (runtime.Object, error) {
+	if result == nil {
+		return list, nil
+	}
+
+	if reflect.TypeOf(result) != reflect.TypeOf(list) {
+		var err error
+		if result, err = sbctl.ToUnstructuredList(result); err != nil {
+			return nil, errors.Wrap(err, "failed to convert list to unstructured")
+		}
+		if list, err = sbctl.ToUnstructuredList(list); err != nil {
+			return nil, errors.Wrap(err, "failed to convert list to unstructured")
 		}
-		filenames = append(filenames, filepath.Join(dir, file.Name()))
 	}
 
-	return filenames, nil
+	resultItems, err := meta.ExtractList(result)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot append to type %v", result.GetObjectKind().GroupVersionKind())
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot append type %v", list.GetObjectKind().GroupVersionKind())
+	}
+	if err := meta.SetList(result, append(resultItems, items...)); err != nil {
+		return nil, errors.Wrap(err, "failed to set list items")
+	}
+	return result, nil
 }
 
-func filterObjectsByLabels(object runtime.Object, selector fields.Selector) (runtime.Object, error) {
+// filterObjectsByLabels keeps the items of a list, typed or unstructured, whose labels match
+// selector, which can have equality, set-based and exists requirements. It is only called by list
+// routes, so single objects, such as custom resources stored as one object rather than a list,
+// are returned in a list too.
+func filterObjectsByLabels(object runtime.Object, selector labels.Selector) (runtime.Object, error) {
+	if !meta.IsListType(object) {
+		var err error
+		if object, err = singleObjectList(object); err != nil {
+			return nil, err
+		}
+	}
 	if selector.Empty() {
 		return object, nil
 	}
 
-	switch o := object.(type) {
-	case *corev1.EventList:
-		r := k8s.GetEmptyEventList()
-		for _, i := range o.Items {
-			if selector.Matches(labels.Set(i.GetObjectMeta().GetLabels())) {
-				r.Items = append(r.Items, i)
-			}
-		}
-		return r, nil
-	case *corev1.PodList:
-		r := k8s.GetEmptyPodList()
-		for _, i := range o.Items {
-			if selector.Matches(labels.Set(i.GetObjectMeta().GetLabels())) {
-				r.Items = append(r.Items, i)
-			}
-		}
-		return r, nil
-	case *corev1.LimitRangeList:
-		r := k8s.GetEmptyLimitRangeList()
-		for _, i := range o.Items {
-			if selector.Matches(labels.Set(i.GetObjectMeta().GetLabels())) {
-				r.Items = append(r.Items, i)
-			}
-		}
-		return r, nil
-	case *corev1.ServiceList:
-		r := k8s.GetEmptyServiceList()
-		for _, i := range o.Items {
-			if selector.Matches(labels.Set(i.GetObjectMeta().GetLabels())) {
-				r.Items = append(r.Items, i)
-			}
+	items, err := meta.ExtractList(object)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot filter type %v", object.GetObjectKind().GroupVersionKind())
+	}
+	filtered := []runtime.Object{}
+	for _, item := range items {
+		accessor, err := meta.Accessor(item)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read object metadata")
 		}
-		return r, nil
-	case *corev1.PersistentVolumeClaimList:
-		r := k8s.GetEmptyPersistentVolumeClaimList()
-		for _, i := range o.Items {
-			if selector.Matches(labels.Set(i.GetObjectMeta().GetLabels())) {
-				r.Items = append(r.Items, i)
-			}
+		if selector.Matches(labels.Set(accessor.GetLabels())) {
+			filtered = append(filtered, item)
 		}
-		return r, nil
-	default:
-		return nil, errors.Errorf("cannot filter type %v", object.GetObjectKind().GroupVersionKind())
 	}
+	if err := meta.SetList(object, filtered); err != nil {
+		return nil, errors.Wrap(err, "failed to set list items")
+	}
+	return object, nil
+}
+
+// singleObjectList returns a list with the object as its only item
+func singleObjectList(object runtime.Object) (runtime.Object, error) {
+	obj, err := sbctl.ToUnstructured(object)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert object to unstructured")
+	}
+	list := &unstructured.UnstructuredList{Items: []unstructured.Unstructured{*obj}}
+	list.SetAPIVersion(obj.GetAPIVersion())
+	list.SetKind(obj.GetKind() + "List")
+	return list, nil
 }
 
 func filterObjectsByFields(object runtime.Object, selector fields.Selector) runtime.Object {
@@ -1458,6 +1335,14 @@ func eventToSelectableFields(event *corev1.Event) fields.Set {
 }
 
 func toTable(object runtime.Object, r *http.Request) (runtime.Object, error) {
+	table, registered, err := registeredPrinterTable(object)
+	if err != nil {
+		return nil, err
+	}
+	if registered {
+		return tableResponse(table, r)
+	}
+
 	switch o := object.(type) {
 	case *corev1.PodList:
 		converted := &apicore.PodList{}
@@ -1627,6 +1512,27 @@ func toTable(object runtime.Object, r *http.Request) (runtime.Object, error) {
 			return nil, errors.Wrap(err, "failed to convert configmap list")
 		}
 		object = converted
+	case *eventsv1.EventList:
+		converted := &apicore.EventList{}
+		err := apieventsv1.Convert_v1_EventList_To_core_EventList(o, converted, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to convert event list")
+		}
+		object = converted
+	case *eventsv1.Event:
+		converted := &apicore.Event{}
+		err := apieventsv1.Convert_v1_Event_To_core_Event(o, converted, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to convert event")
+		}
+		object = converted
+	}
+
+	switch o := object.(type) {
+	case *apicore.EventList:
+		return tableResponse(eventListTable(o, time.Now()), r)
+	case *apicore.Event:
+		return tableResponse(eventsTable([]*apicore.Event{o}, time.Now()), r)
 	}
 
 	ctx := context.TODO()
@@ -1634,11 +1540,16 @@ func toTable(object runtime.Object, r *http.Request) (runtime.Object, error) {
 	tableConvertor := printerstorage.TableConvertor{
 		TableGenerator: printers.NewTableGenerator().With(printersinternal.AddHandlers),
 	}
-	table, err := tableConvertor.ConvertToTable(ctx, object, tableOptions)
+	table, err = tableConvertor.ConvertToTable(ctx, object, tableOptions)
 	if err != nil {
 		return nil, err
 	}
 
+	return tableResponse(table, r)
+}
+
+// tableResponse sets the Table version the client asked for and trims row objects down to their metadata
+func tableResponse(table *metav1.Table, r *http.Request) (runtime.Object, error) {
 	// TODO: github.com/golang/gddo is no longer maintained. We should
 	// replace it with something else. https://github.com/golang/go/issues/44417
 	// tracks a proposal to add this functionality to the standard library.
@@ -1677,7 +1588,32 @@ func toTable(object runtime.Object, r *http.Request) (runtime.Object, error) {
 	return table, nil
 }
 
-func readFileAndLog(filename string) ([]byte, error) {
+// readFileAndLog reads a file in chunks, so that reading large files stops when ctx is done
+func readFileAndLog(ctx context.Context, filename string) ([]byte, error) {
 	log.Printf("Reading %s file", filename)
-	return os.ReadFile(filename)
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var b bytes.Buffer
+	if info, err := f.Stat(); err == nil {
+		b.Grow(int(info.Size()))
+	}
+	chunk := make([]byte, readChunkSize)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, errors.Wrapf(err, "reading %s canceled", filename)
+		}
+		n, err := f.Read(chunk)
+		b.Write(chunk[:n])
+		if err == io.EOF {
+			return b.Bytes(), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
 }
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// statusClientClosedRequest is what nginx logs for requests the client canceled. The client is
+// gone, so the status only shows in the access log.
+const statusClientClosedRequest = 499
+
+// limitRequestTime cancels the context of requests after the timeout kubectl sends with its
+// --request-timeout flag, or else after --request-timeout of sbctl. Handlers stop reading and
+// decoding files once the context is done, which also happens when the client disconnects.
+// Watches and followed logs run until the client stops them, as they do in the API server.
+func limitRequestTime(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if watch := query.Get("watch"); watch == "true" || watch == "1" || query.Get("follow") == "true" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		timeout := viper.GetDuration("request-timeout")
+		if value := query.Get("timeout"); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				JSON(w, http.StatusBadRequest, errorResponse{Error: "invalid timeout: " + err.Error()})
+				return
+			}
+			timeout = d
+		}
+		if timeout <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// writeRequestError responds to a request that failed with err. Requests that timed out get the
+// Timeout status of the API server and requests the client canceled are not answered. Any other
+// error is logged with args and fails the request with 500 Internal Server Error.
+func writeRequestError(w http.ResponseWriter, logger *log.Entry, err error, args ...interface{}) {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		logger.Warn("request timed out: ", err)
+		status := metav1.Status{
+			TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+			Status:   metav1.StatusFailure,
+			Message:  "Timeout: request did not complete within the allotted timeout",
+			Reason:   metav1.StatusReasonTimeout,
+			Code:     http.StatusGatewayTimeout,
+		}
+		JSON(w, http.StatusGatewayTimeout, status)
+	case errors.Is(err, context.Canceled):
+		logger.Info("request canceled by the client: ", err)
+		w.WriteHeader(statusClientClosedRequest)
+	default:
+		logger.Error(append(args, err)...)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,277 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// UsageMiss counts requests for a resource sbctl could not serve. It does not include object
+// names, namespaces or anything else from the bundle, so reports can be shared.
+type UsageMiss struct {
+	Method   string `json:"method"`
+	Group    string `json:"group,omitempty"`
+	Version  string `json:"version,omitempty"`
+	Resource string `json:"resource,omitempty"`
+	// Path is set for requests that did not match any API route, with everything after the
+	// first segments removed
+	Path  string `json:"path,omitempty"`
+	Count int    `json:"count"`
+}
+
+// UsageReport is written to the file given with --usage-report. Users opt in by setting the flag.
+type UsageReport struct {
+	Misses []UsageMiss `json:"misses"`
+}
+
+// UnservedRequest counts requests of the session that were answered with 404 Not Found or 405
+// Method Not Allowed, to explain failures of tools to their users when the session ends. Paths
+// have namespaces and names replaced with placeholders, so that requests of a resource are
+// counted together.
+type UnservedRequest struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Status int    `json:"status"`
+	Count  int    `json:"count"`
+}
+
+var (
+	recordedMu       sync.Mutex
+	usageMisses      = map[UsageMiss]int{}
+	unservedRequests = map[UnservedRequest]int{}
+)
+
+// recordRequests returns a middleware that counts the requests sbctl could not serve: those
+// answered with 404 or 405, which are summarized when the session ends, and when --usage-report
+// is set, list and discovery requests for resources the bundle has no data for. Requests of the
+// sbctl API are not counted, since they are made by sbctl's own integrations rather than
+// Kubernetes tools.
+func recordRequests(source *ClusterDataSource) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sw := &statusRecordingWriter{ResponseWriter: w, code: http.StatusOK}
+			next.ServeHTTP(sw, r)
+
+			if strings.HasPrefix(r.URL.Path, sbctlAPIPrefix) {
+				return
+			}
+
+			if sw.code == http.StatusNotFound || sw.code == http.StatusMethodNotAllowed {
+				addUnservedRequest(UnservedRequest{Method: r.Method, Path: requestPath(r.URL.Path), Status: sw.code})
+			}
+
+			reportFile := viper.GetString("usage-report")
+			if reportFile == "" {
+				return
+			}
+			if miss, ok := usageMiss(source, r, sw.code); ok {
+				if err := addUsageMiss(reportFile, miss); err != nil {
+					log.Warnf("failed to write usage report: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// usageMiss returns the miss a request answered with code is, to find resources that are worth
+// adding decode mappings for. Requests for single objects are not misses, since the object not
+// being in the bundle is not something sbctl can fix.
+func usageMiss(source *ClusterDataSource, r *http.Request, code int) (UsageMiss, bool) {
+	vars := mux.Vars(r)
+	if vars["name"] != "" {
+		return UsageMiss{}, false
+	}
+
+	miss := UsageMiss{Method: r.Method, Group: vars["group"], Version: vars["version"], Resource: vars["resource"]}
+	if strings.HasPrefix(r.URL.Path, "/api/") && miss.Version == "" {
+		miss.Version = "v1"
+	}
+	switch {
+	case miss.Resource != "":
+		// Lists of resources without files are served empty rather than not found
+		h := source.handler()
+		if code != http.StatusNotFound && h.hasResourceData(miss.Group, miss.Resource) {
+			return UsageMiss{}, false
+		}
+	case code != http.StatusNotFound:
+		return UsageMiss{}, false
+	case miss.Version == "":
+		miss.Path = requestPath(r.URL.Path)
+	}
+	return miss, true
+}
+
+// hasResourceData returns whether a resource was discovered when the bundle was collected, or is
+// served by sbctl itself
+func (h handler) hasResourceData(group string, resource string) bool {
+	if resource == "events" || (group == analysisGroup && resource == analysisResource) {
+		return true
+	}
+	for _, r := range h.virtualResources() {
+		if r.Group == group && r.Resource == resource {
+			return true
+		}
+	}
+
+	lists, err := sbctl.ListAPIResources(h.clusterData)
+	if err != nil {
+		return true
+	}
+	for _, list := range lists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil || gv.Group != group {
+			continue
+		}
+		for _, r := range list.APIResources {
+			if r.Name == resource {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// requestPath replaces the namespace and name of API paths with placeholders, e.g.
+// /api/v1/namespaces/{namespace}/pods/{name}/exec, and keeps the first two segments of other
+// paths, e.g. /apis/example.com of a group sbctl does not know about, so that requests are
+// counted together and nothing from the bundle is recorded
+func requestPath(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+
+	prefixLen := 0
+	switch {
+	case len(parts) >= 2 && parts[0] == "api":
+		prefixLen = 2
+	case len(parts) >= 3 && parts[0] == "apis":
+		prefixLen = 3
+	default:
+		if len(parts) > 2 {
+			parts = parts[:2]
+		}
+		return "/" + strings.Join(parts, "/")
+	}
+
+	rest := parts[prefixLen:]
+	if len(rest) >= 3 && rest[0] == "namespaces" {
+		rest[1] = "{namespace}"
+		rest = rest[2:]
+	}
+	if len(rest) >= 2 {
+		rest[1] = "{name}"
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+func addUnservedRequest(request UnservedRequest) {
+	recordedMu.Lock()
+	defer recordedMu.Unlock()
+	unservedRequests[request]++
+}
+
+func addUsageMiss(reportFile string, miss UsageMiss) error {
+	recordedMu.Lock()
+	defer recordedMu.Unlock()
+
+	usageMisses[miss]++
+	return writeUsageReport(reportFile, currentUsageReport())
+}
+
+func currentUsageReport() UsageReport {
+	report := UsageReport{Misses: []UsageMiss{}}
+	for miss, count := range usageMisses {
+		miss.Count = count
+		report.Misses = append(report.Misses, miss)
+	}
+	sort.Slice(report.Misses, func(i, j int) bool {
+		if report.Misses[i].Count != report.Misses[j].Count {
+			return report.Misses[i].Count > report.Misses[j].Count
+		}
+		a, b := report.Misses[i], report.Misses[j]
+		return a.Group+"/"+a.Version+"/"+a.Resource+a.Path < b.Group+"/"+b.Version+"/"+b.Resource+b.Path
+	})
+	return report
+}
+
+// GetUsageReport returns the misses recorded so far
+func GetUsageReport() UsageReport {
+	recordedMu.Lock()
+	defer recordedMu.Unlock()
+	return currentUsageReport()
+}
+
+// GetUnservedRequests returns the requests answered with 404 or 405 so far, most frequent first
+func GetUnservedRequests() []UnservedRequest {
+	recordedMu.Lock()
+	defer recordedMu.Unlock()
+
+	requests := []UnservedRequest{}
+	for request, count := range unservedRequests {
+		request.Count = count
+		requests = append(requests, request)
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		if requests[i].Count != requests[j].Count {
+			return requests[i].Count > requests[j].Count
+		}
+		if requests[i].Path != requests[j].Path {
+			return requests[i].Path < requests[j].Path
+		}
+		return requests[i].Method < requests[j].Method
+	})
+	return requests
+}
+
+// writeUsageReport replaces the report file, so that it is complete whenever sbctl exits
+func writeUsageReport(reportFile string, report UsageReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(reportFile), ".sbctl-usage-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write(append(data, '\n')); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), reportFile)
+}
+
+type statusRecordingWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusRecordingWriter) WriteHeader(code int) {
+	w.code = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusRecordingWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *statusRecordingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.ResponseWriter.(http.Hijacker).Hijack()
+}
@@ -0,0 +1,326 @@
+package api
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// View restricts what a token can see to some namespaces, and optionally to some resources in
+// them, so a bundle can be shared with a team without exposing everything in it
+type View struct {
+	Name       string   `json:"name"`
+	Token      string   `json:"token,omitempty"`
+	Namespaces []string `json:"namespaces"`
+	// Resources are plural resource names such as pods or deployments.apps. All namespaced
+	// resources are visible when empty.
+	Resources []string `json:"resources,omitempty"`
+}
+
+type viewsFile struct {
+	Views []View `json:"views"`
+}
+
+var (
+	viewsMu    sync.RWMutex
+	views      []View
+	adminToken string
+)
+
+// LoadViews reads views from a YAML or JSON file. Views without a token are given a random one.
+func LoadViews(fileName string) ([]View, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read views file")
+	}
+
+	config := viewsFile{}
+	if err := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), len(data)).Decode(&config); err != nil {
+		return nil, errors.Wrap(err, "failed to decode views file")
+	}
+
+	names := map[string]bool{}
+	for i, v := range config.Views {
+		if v.Name == "" {
+			return nil, errors.Errorf("view %d has no name", i+1)
+		}
+		if names[v.Name] {
+			return nil, errors.Errorf("view %s is defined more than once", v.Name)
+		}
+		names[v.Name] = true
+		if len(v.Namespaces) == 0 {
+			return nil, errors.Errorf("view %s has no namespaces", v.Name)
+		}
+		if v.Token == "" {
+			token, err := randomToken()
+			if err != nil {
+				return nil, err
+			}
+			config.Views[i].Token = token
+		}
+	}
+
+	return config.Views, nil
+}
+
+// SetViews makes API servers require a token. The token of the kubeconfig returned when starting
+// a server has full access, the tokens of views only see their namespaces and resources.
+func SetViews(v []View) error {
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	viewsMu.Lock()
+	defer viewsMu.Unlock()
+	views = v
+	adminToken = token
+	return nil
+}
+
+// serverAdminToken returns the token kubeconfigs need for full access, or an empty string when
+// no views are set and no token is needed
+func serverAdminToken() string {
+	viewsMu.RLock()
+	defer viewsMu.RUnlock()
+	if len(views) == 0 {
+		return ""
+	}
+	return adminToken
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "failed to generate token")
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// restrictViews authenticates requests when views are set and limits view tokens to their
+// namespaces and resources. Lists across namespaces are filtered to the view's namespaces.
+func restrictViews(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		viewsMu.RLock()
+		currentViews, currentAdminToken := views, adminToken
+		viewsMu.RUnlock()
+
+		// Readiness is checked by scripts before they have a token
+		if len(currentViews) == 0 || r.URL.Path == "/readyz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if tokensEqual(token, currentAdminToken) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var view *View
+		for i := range currentViews {
+			if tokensEqual(token, currentViews[i].Token) {
+				view = &currentViews[i]
+				break
+			}
+		}
+		if view == nil {
+			viewStatus(w, http.StatusUnauthorized, metav1.StatusReasonUnauthorized, "a valid bearer token is required")
+			return
+		}
+		r = withView(r, view)
+
+		target := parseResourcePath(r.URL.Path)
+		switch {
+		case target.discovery:
+			next.ServeHTTP(w, r)
+		case target.group == authenticationv1.GroupName && target.resource == "selfsubjectreviews":
+			// Views can see who they are, e.g. with kubectl auth whoami
+			next.ServeHTTP(w, r)
+		case target.resource == "":
+			viewStatus(w, http.StatusForbidden, metav1.StatusReasonForbidden, fmt.Sprintf("view %s cannot access %s", view.Name, r.URL.Path))
+		case target.namespace != "":
+			if !containsView(view.Namespaces, target.namespace) || !view.allowsResource(target.group, target.resource) {
+				viewStatus(w, http.StatusForbidden, metav1.StatusReasonForbidden,
+					fmt.Sprintf("view %s cannot access %s in namespace %s", view.Name, target.groupResource(), target.namespace))
+				return
+			}
+			next.ServeHTTP(w, r)
+		case target.group == "" && target.resource == "namespaces":
+			if target.name != "" {
+				if !containsView(view.Namespaces, target.name) {
+					viewStatus(w, http.StatusForbidden, metav1.StatusReasonForbidden, fmt.Sprintf("view %s cannot access namespace %s", view.Name, target.name))
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+			filterViewList(w, r, next, func(namespace string, name string) bool {
+				return containsView(view.Namespaces, name)
+			})
+		case target.name == "" && view.allowsResource(target.group, target.resource):
+			// Lists of namespaced resources across all namespaces, such as kubectl get pods -A.
+			// Cluster scoped resources have no namespace and are filtered out entirely.
+			filterViewList(w, r, next, func(namespace string, name string) bool {
+				return containsView(view.Namespaces, namespace)
+			})
+		default:
+			viewStatus(w, http.StatusForbidden, metav1.StatusReasonForbidden, fmt.Sprintf("view %s cannot access %s", view.Name, target.groupResource()))
+		}
+	})
+}
+
+func tokensEqual(a string, b string) bool {
+	return a != "" && subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+func containsView(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (v View) allowsResource(group string, resource string) bool {
+	if len(v.Resources) == 0 {
+		return true
+	}
+	name := resource
+	if group != "" {
+		name = resource + "." + group
+	}
+	return containsView(v.Resources, name)
+}
+
+type resourcePath struct {
+	discovery bool
+	group     string
+	namespace string
+	resource  string
+	name      string
+}
+
+func (p resourcePath) groupResource() string {
+	if p.group == "" {
+		return p.resource
+	}
+	return p.resource + "." + p.group
+}
+
+// parseResourcePath splits a Kubernetes API path into its parts. Discovery and version paths,
+// which reveal no objects, are marked as such.
+func parseResourcePath(path string) resourcePath {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	p := resourcePath{}
+
+	switch {
+	case len(parts) >= 1 && (parts[0] == "version" || parts[0] == "openapi"):
+		p.discovery = true
+		return p
+	case parts[0] == "api" && len(parts) <= 2:
+		p.discovery = true
+		return p
+	case parts[0] == "api":
+		parts = parts[2:]
+	case parts[0] == "apis" && len(parts) <= 3:
+		p.discovery = true
+		return p
+	case parts[0] == "apis":
+		p.group = parts[1]
+		parts = parts[3:]
+	default:
+		return p
+	}
+
+	if len(parts) >= 3 && parts[0] == "namespaces" {
+		p.namespace = parts[1]
+		parts = parts[2:]
+	}
+	p.resource = parts[0]
+	if len(parts) >= 2 {
+		p.name = parts[1]
+	}
+	return p
+}
+
+func viewStatus(w http.ResponseWriter, code int, reason metav1.StatusReason, message string) {
+	status := &metav1.Status{
+		Status:  metav1.StatusFailure,
+		Message: message,
+		Reason:  reason,
+		Code:    int32(code),
+	}
+	status.SetGroupVersionKind(metav1.SchemeGroupVersion.WithKind("Status"))
+	JSON(w, code, status)
+}
+
+// filterViewList drops the items or table rows of a list response that keep returns false for
+func filterViewList(w http.ResponseWriter, r *http.Request, next http.Handler, keep func(namespace string, name string) bool) {
+	list := newBufferedResponseWriter()
+	list.header.Set(requestIDHeader, w.Header().Get(requestIDHeader))
+	next.ServeHTTP(list, r)
+
+	for k, v := range list.header {
+		w.Header()[k] = v
+	}
+	body := list.body.Bytes()
+	if list.code != http.StatusOK {
+		w.Header().Del("Content-Length")
+		w.WriteHeader(list.code)
+		_, _ = w.Write(body)
+		return
+	}
+
+	obj := map[string]interface{}{}
+	if err := json.Unmarshal(body, &obj); err != nil {
+		viewStatus(w, http.StatusForbidden, metav1.StatusReasonForbidden, "response could not be filtered for the view")
+		return
+	}
+
+	itemsKey, metadataOf := "items", func(item map[string]interface{}) map[string]interface{} {
+		m, _ := item["metadata"].(map[string]interface{})
+		return m
+	}
+	if _, ok := obj["rows"]; ok {
+		itemsKey, metadataOf = "rows", func(row map[string]interface{}) map[string]interface{} {
+			object, _ := row["object"].(map[string]interface{})
+			m, _ := object["metadata"].(map[string]interface{})
+			return m
+		}
+	}
+
+	items, _ := obj[itemsKey].([]interface{})
+	if items == nil {
+		// A single object, such as a cluster scoped one, has no namespace to check
+		viewStatus(w, http.StatusForbidden, metav1.StatusReasonForbidden, "view cannot access cluster scoped objects")
+		return
+	}
+	kept := []interface{}{}
+	for _, item := range items {
+		m, _ := item.(map[string]interface{})
+		metadata := metadataOf(m)
+		namespace, _ := metadata["namespace"].(string)
+		name, _ := metadata["name"].(string)
+		if keep(namespace, name) {
+			kept = append(kept, item)
+		}
+	}
+	obj[itemsKey] = kept
+
+	w.Header().Del("Content-Length")
+	JSON(w, http.StatusOK, obj)
+}
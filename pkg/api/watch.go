@@ -0,0 +1,243 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/websocket"
+	"k8s.io/apimachinery/pkg/util/httpstream/wsstream"
+)
+
+// bufferedResponseWriter captures a response so it can be converted before being sent
+type bufferedResponseWriter struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func newBufferedResponseWriter() *bufferedResponseWriter {
+	return &bufferedResponseWriter{
+		header: http.Header{},
+		code:   http.StatusOK,
+	}
+}
+
+func (w *bufferedResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedResponseWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+func (w *bufferedResponseWriter) WriteHeader(code int) {
+	w.code = code
+}
+
+type watchEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// initialEventsEndAnnotation marks the bookmark that ends the initial events of a watch
+// requested with sendInitialEvents, which clients using watch lists wait for
+const initialEventsEndAnnotation = "k8s.io/initial-events-end"
+
+// serveWatch is a middleware that answers watch requests. A bundle never changes, so the
+// list is served as ADDED events and the watch is closed afterwards, which makes clients
+// such as "kubectl get -w" print everything and exit. With allowWatchBookmarks or
+// sendInitialEvents, a BOOKMARK event follows the ADDED events. With timeoutSeconds, as
+// informers of controllers request, the watch stays open until the timeout, so they don't
+// list and watch again in a loop. Watches are streamed as chunked HTTP, or as one websocket
+// message per event when the client requests a websocket.
+func serveWatch(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if watch := query.Get("watch"); watch != "true" && watch != "1" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allowBookmarks, _ := strconv.ParseBool(query.Get("allowWatchBookmarks"))
+		sendInitialEvents, _ := strconv.ParseBool(query.Get("sendInitialEvents"))
+		timeoutSeconds, _ := strconv.ParseInt(query.Get("timeoutSeconds"), 10, 64)
+
+		query.Del("watch")
+		query.Del("allowWatchBookmarks")
+		query.Del("sendInitialEvents")
+		query.Del("resourceVersionMatch")
+		query.Del("timeoutSeconds")
+		query.Del("limit")
+		query.Del("continue")
+		listRequest := r.Clone(r.Context())
+		listRequest.URL.RawQuery = query.Encode()
+		listRequest.Header.Del("Upgrade")
+		listRequest.Header.Del("Connection")
+
+		list := newBufferedResponseWriter()
+		list.header.Set(requestIDHeader, w.Header().Get(requestIDHeader))
+		next.ServeHTTP(list, listRequest)
+		if list.code != http.StatusOK {
+			for k, v := range list.header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(list.code)
+			_, _ = w.Write(list.body.Bytes())
+			return
+		}
+
+		events, err := listToWatchEvents(list.body.Bytes())
+		if err != nil {
+			log.Errorf("failed to convert list to watch events: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if allowBookmarks || sendInitialEvents {
+			bookmark, err := watchBookmark(list.body.Bytes(), sendInitialEvents)
+			if err != nil {
+				log.Errorf("failed to create watch bookmark: %v", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			if bookmark != nil {
+				events = append(events, bookmark)
+			}
+		}
+
+		if wsstream.IsWebSocketRequest(r) {
+			websocket.Server{Handler: func(ws *websocket.Conn) {
+				defer ws.Close()
+				for _, event := range events {
+					if err := websocket.Message.Send(ws, string(event)); err != nil {
+						log.Errorf("failed to send watch event: %v", err)
+						return
+					}
+				}
+				waitForWatchTimeout(r, timeoutSeconds)
+			}}.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		flusher, _ := w.(http.Flusher)
+		for _, event := range events {
+			if _, err := w.Write(append(event, '\n')); err != nil {
+				log.Errorf("failed to write watch event: %v", err)
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		waitForWatchTimeout(r, timeoutSeconds)
+	})
+}
+
+// waitForWatchTimeout keeps a watch open until timeoutSeconds pass or the client goes away
+func waitForWatchTimeout(r *http.Request, timeoutSeconds int64) {
+	if timeoutSeconds <= 0 {
+		return
+	}
+	timer := time.NewTimer(time.Duration(timeoutSeconds) * time.Second)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-r.Context().Done():
+	}
+}
+
+// watchBookmark returns an encoded BOOKMARK event with the resource version of a list. Nil
+// is returned for responses that are not lists.
+func watchBookmark(data []byte, initialEventsEnd bool) ([]byte, error) {
+	obj := map[string]interface{}{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	kind, _ := obj["kind"].(string)
+	if !strings.HasSuffix(kind, "List") {
+		return nil, nil
+	}
+	resourceVersion := ""
+	if metadata, ok := obj["metadata"].(map[string]interface{}); ok {
+		resourceVersion, _ = metadata["resourceVersion"].(string)
+	}
+
+	metadata := map[string]interface{}{"resourceVersion": resourceVersion}
+	if initialEventsEnd {
+		metadata["annotations"] = map[string]interface{}{initialEventsEndAnnotation: "true"}
+	}
+	encoded, err := json.Marshal(map[string]interface{}{
+		"kind":       strings.TrimSuffix(kind, "List"),
+		"apiVersion": obj["apiVersion"],
+		"metadata":   metadata,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(watchEvent{Type: "BOOKMARK", Object: encoded})
+}
+
+// listToWatchEvents converts a list, table or single object response into encoded ADDED events
+func listToWatchEvents(data []byte) ([][]byte, error) {
+	obj := map[string]interface{}{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+
+	objects := []interface{}{}
+	kind, _ := obj["kind"].(string)
+	apiVersion, _ := obj["apiVersion"].(string)
+	switch {
+	case kind == "Table":
+		// Each event holds a table with a single row, which is what the API server sends
+		// when kubectl watches with server side printing
+		rows, _ := obj["rows"].([]interface{})
+		for _, row := range rows {
+			table := map[string]interface{}{}
+			for k, v := range obj {
+				table[k] = v
+			}
+			table["rows"] = []interface{}{row}
+			objects = append(objects, table)
+		}
+	case strings.HasSuffix(kind, "List"):
+		items, _ := obj["items"].([]interface{})
+		for _, i := range items {
+			item, ok := i.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			// Items of typed lists don't carry their kind, but watch events must
+			if _, ok := item["kind"]; !ok {
+				item["kind"] = strings.TrimSuffix(kind, "List")
+			}
+			if _, ok := item["apiVersion"]; !ok {
+				item["apiVersion"] = apiVersion
+			}
+			objects = append(objects, item)
+		}
+	default:
+		objects = append(objects, obj)
+	}
+
+	events := [][]byte{}
+	for _, o := range objects {
+		encoded, err := json.Marshal(o)
+		if err != nil {
+			return nil, err
+		}
+		event, err := json.Marshal(watchEvent{Type: "ADDED", Object: encoded})
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
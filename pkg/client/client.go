@@ -0,0 +1,349 @@
+// Package client is a client of the sbctl API, the JSON API for browsing a bundle that sbctl
+// serves at /sbctl/v1 next to the emulated Kubernetes API. Its types follow the OpenAPI document
+// served at /sbctl/v1/openapi.json.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const apiPrefix = "/sbctl/v1"
+
+// Client calls the sbctl API of a running sbctl server
+type Client struct {
+	server     string
+	token      string
+	httpClient *http.Client
+}
+
+// New returns a client of the server at a URL such as http://127.0.0.1:41235. The token is only
+// needed when the server has views.
+func New(server string, token string) *Client {
+	return &Client{
+		server:     strings.TrimSuffix(server, "/"),
+		token:      token,
+		httpClient: &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+// NewFromKubeConfig returns a client of the server of the current context of a kubeconfig
+// written by sbctl, e.g. the one printed by sbctl serve
+func NewFromKubeConfig(kubeConfig string) (*Client, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", kubeConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read kubeconfig")
+	}
+	return New(config.Host, config.BearerToken), nil
+}
+
+type Resource struct {
+	Group      string `json:"group"`
+	Version    string `json:"version"`
+	Resource   string `json:"resource"`
+	Kind       string `json:"kind"`
+	Namespaced bool   `json:"namespaced"`
+	Count      int    `json:"count"`
+}
+
+type ObjectRef struct {
+	Group     string `json:"group"`
+	Version   string `json:"version"`
+	Resource  string `json:"resource"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+type TreeResource struct {
+	Group    string   `json:"group"`
+	Resource string   `json:"resource"`
+	Kind     string   `json:"kind"`
+	Names    []string `json:"names"`
+}
+
+type TreeNamespace struct {
+	Name      string         `json:"name"`
+	Resources []TreeResource `json:"resources"`
+}
+
+type Tree struct {
+	Cluster    []TreeResource  `json:"cluster"`
+	Namespaces []TreeNamespace `json:"namespaces"`
+}
+
+type ContainerLog struct {
+	Container string `json:"container"`
+	Previous  bool   `json:"previous"`
+}
+
+type NodeLog struct {
+	Node      string `json:"node"`
+	Component string `json:"component"`
+	// File is relative to the bundle root
+	File string `json:"file"`
+}
+
+type AnalysisResult struct {
+	Name     string            `json:"name"`
+	Severity string            `json:"severity"`
+	Outcome  string            `json:"outcome"`
+	Title    string            `json:"title"`
+	Message  string            `json:"message"`
+	Labels   map[string]string `json:"labels,omitempty"`
+}
+
+type CollectorError struct {
+	Collector string `json:"collector"`
+	File      string `json:"file"`
+	Message   string `json:"message"`
+}
+
+type RelatedObject struct {
+	ObjectRef
+	Relation string `json:"relation"`
+	Via      string `json:"via"`
+	Missing  bool   `json:"missing,omitempty"`
+}
+
+type Related struct {
+	Object  ObjectRef       `json:"object"`
+	Related []RelatedObject `json:"related"`
+}
+
+// SearchOptions select objects. Empty fields match everything.
+type SearchOptions struct {
+	// Query is a glob pattern such as velero-*, or a substring when it has no wildcards
+	Query              string
+	Resources          []string
+	Namespace          string
+	LabelSelector      string
+	AnnotationSelector string
+	// Limit is 100 when not set
+	Limit int
+}
+
+// AuditOptions select audit events. Empty fields match everything.
+type AuditOptions struct {
+	User      string
+	Verbs     []string
+	Resource  string
+	Namespace string
+	Name      string
+	Since     time.Time
+	Until     time.Time
+}
+
+// LogOptions select part of a log
+type LogOptions struct {
+	Previous   bool
+	TailLines  int
+	SinceTime  time.Time
+	LimitBytes int
+}
+
+// Error is an error response of the API
+type Error struct {
+	StatusCode int
+	Message    string `json:"error"`
+	RequestID  string `json:"requestId,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.RequestID != "" {
+		return fmt.Sprintf("%s (status %d, request %s)", e.Message, e.StatusCode, e.RequestID)
+	}
+	return fmt.Sprintf("%s (status %d)", e.Message, e.StatusCode)
+}
+
+// IsNotFound returns whether err is a 404 Not Found response
+func IsNotFound(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+func (c *Client) Resources(ctx context.Context) ([]Resource, error) {
+	result := []Resource{}
+	return result, c.getJSON(ctx, "/resources", nil, &result)
+}
+
+func (c *Client) Tree(ctx context.Context) (*Tree, error) {
+	result := &Tree{}
+	return result, c.getJSON(ctx, "/tree", nil, result)
+}
+
+func (c *Client) Search(ctx context.Context, opts SearchOptions) ([]ObjectRef, error) {
+	query := url.Values{}
+	setQuery(query, "q", opts.Query)
+	setQuery(query, "resource", strings.Join(opts.Resources, ","))
+	setQuery(query, "namespace", opts.Namespace)
+	setQuery(query, "labelSelector", opts.LabelSelector)
+	setQuery(query, "annotationSelector", opts.AnnotationSelector)
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+
+	result := []ObjectRef{}
+	return result, c.getJSON(ctx, "/search", query, &result)
+}
+
+// Manifest returns an object. The group of core resources such as pods is empty or core.
+func (c *Client) Manifest(ctx context.Context, group string, resource string, namespace string, name string) (map[string]interface{}, error) {
+	if group == "" {
+		group = "core"
+	}
+	query := url.Values{}
+	setQuery(query, "namespace", namespace)
+
+	result := map[string]interface{}{}
+	return result, c.getJSON(ctx, fmt.Sprintf("/manifests/%s/%s/%s", url.PathEscape(group), url.PathEscape(resource), url.PathEscape(name)), query, &result)
+}
+
+func (c *Client) ContainerLogs(ctx context.Context, namespace string, pod string) ([]ContainerLog, error) {
+	result := []ContainerLog{}
+	return result, c.getJSON(ctx, fmt.Sprintf("/logs/%s/%s", url.PathEscape(namespace), url.PathEscape(pod)), nil, &result)
+}
+
+func (c *Client) ContainerLog(ctx context.Context, namespace string, pod string, container string, opts LogOptions) (string, error) {
+	return c.getText(ctx, fmt.Sprintf("/logs/%s/%s/%s", url.PathEscape(namespace), url.PathEscape(pod), url.PathEscape(container)), logQuery(opts))
+}
+
+func (c *Client) NodeLogs(ctx context.Context) ([]NodeLog, error) {
+	result := []NodeLog{}
+	return result, c.getJSON(ctx, "/node-logs", nil, &result)
+}
+
+func (c *Client) NodeLog(ctx context.Context, node string, component string, opts LogOptions) (string, error) {
+	return c.getText(ctx, fmt.Sprintf("/node-logs/%s/%s", url.PathEscape(node), url.PathEscape(component)), logQuery(opts))
+}
+
+func (c *Client) Analysis(ctx context.Context) ([]AnalysisResult, error) {
+	result := []AnalysisResult{}
+	return result, c.getJSON(ctx, "/analysis", nil, &result)
+}
+
+func (c *Client) CollectorErrors(ctx context.Context) ([]CollectorError, error) {
+	result := []CollectorError{}
+	return result, c.getJSON(ctx, "/collector-errors", nil, &result)
+}
+
+// AuditEvents returns kube-apiserver audit events, oldest first
+func (c *Client) AuditEvents(ctx context.Context, opts AuditOptions) ([]auditv1.Event, error) {
+	query := url.Values{}
+	setQuery(query, "user", opts.User)
+	setQuery(query, "verb", strings.Join(opts.Verbs, ","))
+	setQuery(query, "resource", opts.Resource)
+	setQuery(query, "namespace", opts.Namespace)
+	setQuery(query, "name", opts.Name)
+	if !opts.Since.IsZero() {
+		query.Set("since", opts.Since.Format(time.RFC3339))
+	}
+	if !opts.Until.IsZero() {
+		query.Set("until", opts.Until.Format(time.RFC3339))
+	}
+
+	result := []auditv1.Event{}
+	return result, c.getJSON(ctx, "/audit", query, &result)
+}
+
+// Related returns the objects related to an object by owners, selectors and references. kind is
+// a kind or resource, the group is only needed when several groups have the kind.
+func (c *Client) Related(ctx context.Context, group string, kind string, namespace string, name string) (*Related, error) {
+	query := url.Values{}
+	query.Set("kind", kind)
+	query.Set("name", name)
+	setQuery(query, "namespace", namespace)
+	setQuery(query, "group", group)
+
+	result := &Related{}
+	return result, c.getJSON(ctx, "/related", query, result)
+}
+
+func setQuery(query url.Values, key string, value string) {
+	if value != "" {
+		query.Set(key, value)
+	}
+}
+
+func logQuery(opts LogOptions) url.Values {
+	query := url.Values{}
+	if opts.Previous {
+		query.Set("previous", "true")
+	}
+	if opts.TailLines > 0 {
+		query.Set("tailLines", strconv.Itoa(opts.TailLines))
+	}
+	if !opts.SinceTime.IsZero() {
+		query.Set("sinceTime", opts.SinceTime.Format(time.RFC3339))
+	}
+	if opts.LimitBytes > 0 {
+		query.Set("limitBytes", strconv.Itoa(opts.LimitBytes))
+	}
+	return query
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	u := c.server + apiPrefix + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create request")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		apiErr := &Error{StatusCode: resp.StatusCode}
+		if err := json.NewDecoder(resp.Body).Decode(apiErr); err != nil || apiErr.Message == "" {
+			apiErr.Message = http.StatusText(resp.StatusCode)
+		}
+		return nil, apiErr
+	}
+	return resp, nil
+}
+
+func (c *Client) getJSON(ctx context.Context, path string, query url.Values, result interface{}) error {
+	resp, err := c.get(ctx, path, query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return errors.Wrapf(err, "failed to decode response of %s", path)
+	}
+	return nil
+}
+
+func (c *Client) getText(ctx context.Context, path string, query url.Values) (string, error) {
+	resp, err := c.get(ctx, path, query)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to read response of %s", path)
+	}
+	return string(data), nil
+}
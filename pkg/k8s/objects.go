@@ -70,3 +70,14 @@ func GetEmptyConfigMapList() *corev1.ConfigMapList {
 	})
 	return r
 }
+
+func GetEmptyReplicationControllerList() *corev1.ReplicationControllerList {
+	r := &corev1.ReplicationControllerList{
+		Items: []corev1.ReplicationController{},
+	}
+	r.GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{
+		Version: "v1",
+		Kind:    "ReplicationControllerList",
+	})
+	return r
+}
@@ -0,0 +1,137 @@
+// Package output renders the human readable output of sbctl's own commands, with colors when
+// writing to a terminal and tables that stay aligned with them.
+package output
+
+import (
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"golang.org/x/term"
+)
+
+const (
+	// ColorAuto colors output written to a terminal, unless NO_COLOR is set or TERM is dumb
+	ColorAuto = "auto"
+	// ColorAlways colors output even when it is piped, e.g. to less -R
+	ColorAlways = "always"
+	// ColorNever never colors output
+	ColorNever = "never"
+)
+
+const (
+	codeReset  = "\x1b[0m"
+	codeBold   = "\x1b[1m"
+	codeFaint  = "\x1b[2m"
+	codeRed    = "\x1b[31m"
+	codeGreen  = "\x1b[32m"
+	codeYellow = "\x1b[33m"
+)
+
+var escapeSequence = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// Printer writes output for a terminal, or plain output when it is redirected
+type Printer struct {
+	out   io.Writer
+	color bool
+	// width is the width of the terminal, 0 when out is not one
+	width int
+}
+
+// NewPrinter returns a printer writing to out. colorMode is one of ColorAuto, ColorAlways and
+// ColorNever.
+func NewPrinter(out io.Writer, colorMode string) (*Printer, error) {
+	p := &Printer{out: out}
+
+	isTerminal := false
+	if f, ok := out.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		isTerminal = true
+		if width, _, err := term.GetSize(int(f.Fd())); err == nil {
+			p.width = width
+		}
+	}
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 && isTerminal {
+		p.width = columns
+	}
+
+	switch colorMode {
+	case ColorAuto, "":
+		// https://no-color.org
+		p.color = isTerminal && os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb"
+	case ColorAlways:
+		p.color = true
+	case ColorNever:
+		p.color = false
+	default:
+		return nil, errors.Errorf("unsupported color mode %q, must be one of %s, %s or %s", colorMode, ColorAuto, ColorAlways, ColorNever)
+	}
+	return p, nil
+}
+
+// Writer returns the writer the printer writes to
+func (p *Printer) Writer() io.Writer {
+	return p.out
+}
+
+// Color returns whether output is colored
+func (p *Printer) Color() bool {
+	return p.color
+}
+
+// Width returns the width of the terminal, or 0 when output is not written to one
+func (p *Printer) Width() int {
+	return p.width
+}
+
+func (p *Printer) style(code string, s string) string {
+	if !p.color || s == "" {
+		return s
+	}
+	return code + s + codeReset
+}
+
+func (p *Printer) Bold(s string) string   { return p.style(codeBold, s) }
+func (p *Printer) Faint(s string) string  { return p.style(codeFaint, s) }
+func (p *Printer) Red(s string) string    { return p.style(codeRed, s) }
+func (p *Printer) Green(s string) string  { return p.style(codeGreen, s) }
+func (p *Printer) Yellow(s string) string { return p.style(codeYellow, s) }
+
+// Status colors a status as kubectl users read it: green when healthy, yellow when progressing
+// or worth a look, and red when failed. Other values are left as they are.
+func (p *Printer) Status(s string) string {
+	switch s {
+	case "Running", "Ready", "True", "Normal", "Bound", "Available", "Active", "Succeeded", "Completed", "Healthy":
+		return p.Green(s)
+	case "Warning", "Pending", "ContainerCreating", "PodInitializing", "Terminating", "Released", "Unknown":
+		return p.Yellow(s)
+	case "Failed", "Error", "NotReady", "False", "Lost", "Evicted", "OOMKilled", "CrashLoopBackOff",
+		"ImagePullBackOff", "ErrImagePull", "CreateContainerConfigError", "InvalidImageName":
+		return p.Red(s)
+	}
+	if strings.HasPrefix(s, "Init:") && s != "Init:0/0" {
+		return p.Yellow(s)
+	}
+	return s
+}
+
+// VisibleWidth returns how many columns s takes in a terminal, without escape sequences
+func VisibleWidth(s string) int {
+	return utf8.RuneCountInString(escapeSequence.ReplaceAllString(s, ""))
+}
+
+// truncate shortens s to width visible columns, ending it with an ellipsis. Styles of s are
+// dropped when it is shortened.
+func truncate(s string, width int) string {
+	if VisibleWidth(s) <= width {
+		return s
+	}
+	plain := []rune(escapeSequence.ReplaceAllString(s, ""))
+	if width <= 1 {
+		return string(plain[:width])
+	}
+	return string(plain[:width-1]) + "…"
+}
@@ -0,0 +1,81 @@
+package output
+
+import (
+	"fmt"
+	"strings"
+)
+
+// columnPadding is the space between columns, as in kubectl's tables
+const columnPadding = 3
+
+// minLastColumnWidth is the narrowest the last column is truncated to on narrow terminals
+const minLastColumnWidth = 20
+
+// Table is a table of rows that are aligned when printed. Unlike text/tabwriter, cells can be
+// styled without breaking the alignment.
+type Table struct {
+	p       *Printer
+	headers []string
+	rows    [][]string
+}
+
+// NewTable returns a table with the given column headers, which are printed in bold
+func (p *Printer) NewTable(headers ...string) *Table {
+	return &Table{p: p, headers: headers}
+}
+
+// AddRow adds a row of cells, which may be styled by the printer
+func (t *Table) AddRow(cells ...string) {
+	t.rows = append(t.rows, cells)
+}
+
+// Print writes the table. On terminals, the last column is truncated to the width of the
+// terminal, as it usually has long messages. Output that is redirected is never truncated.
+func (t *Table) Print() error {
+	widths := make([]int, len(t.headers))
+	for _, row := range append([][]string{t.headers}, t.rows...) {
+		for i, cell := range row {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if w := VisibleWidth(cell); w > widths[i] {
+				widths[i] = w
+			}
+		}
+	}
+
+	lastWidth := 0
+	if t.p.width > 0 && len(widths) > 0 {
+		used := 0
+		for _, w := range widths[:len(widths)-1] {
+			used += w + columnPadding
+		}
+		lastWidth = t.p.width - used
+		if lastWidth < minLastColumnWidth {
+			lastWidth = minLastColumnWidth
+		}
+	}
+
+	headers := make([]string, len(t.headers))
+	for i, h := range t.headers {
+		headers[i] = t.p.Bold(h)
+	}
+	for _, row := range append([][]string{headers}, t.rows...) {
+		line := strings.Builder{}
+		for i, cell := range row {
+			if i == len(row)-1 {
+				if lastWidth > 0 {
+					cell = truncate(cell, lastWidth)
+				}
+				line.WriteString(cell)
+				break
+			}
+			line.WriteString(cell)
+			line.WriteString(strings.Repeat(" ", widths[i]-VisibleWidth(cell)+columnPadding))
+		}
+		if _, err := fmt.Fprintln(t.p.out, strings.TrimRight(line.String(), " ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package sbctl
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// AnalysisResult is an analyzer result as stored in analysis.json by the troubleshoot support-bundle CLI
+type AnalysisResult struct {
+	Name         string            `json:"name"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	Insight      *AnalysisInsight  `json:"insight,omitempty"`
+	Severity     string            `json:"severity"`
+	AnalyzerSpec string            `json:"analyzerSpec,omitempty"`
+}
+
+type AnalysisInsight struct {
+	Name     string            `json:"name"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Primary  string            `json:"primary"`
+	Detail   string            `json:"detail"`
+	Severity string            `json:"severity"`
+}
+
+// Outcome returns the analyzer outcome, which troubleshoot stores as a severity
+func (r AnalysisResult) Outcome() string {
+	switch r.Severity {
+	case "error":
+		return "fail"
+	case "warn":
+		return "warn"
+	default:
+		return "pass"
+	}
+}
+
+func (r AnalysisResult) Title() string {
+	if r.Insight != nil && r.Insight.Primary != "" {
+		return r.Insight.Primary
+	}
+	return r.Name
+}
+
+func (r AnalysisResult) Message() string {
+	if r.Insight != nil {
+		return r.Insight.Detail
+	}
+	return ""
+}
+
+// ReadAnalysis returns the analyzer results stored in the bundle. Bundles without analysis.json have no results.
+func ReadAnalysis(clusterData ClusterData) ([]AnalysisResult, error) {
+	results := []AnalysisResult{}
+	if clusterData.AnalysisFile == "" {
+		return results, nil
+	}
+
+	data, err := os.ReadFile(clusterData.AnalysisFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read analysis file")
+	}
+
+	if err := json.Unmarshal(data, &results); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal analysis results")
+	}
+
+	return results, nil
+}
@@ -0,0 +1,226 @@
+package sbctl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// AnalyzerProtocolVersion is the version of the JSON protocol sbctl speaks with external analyzers
+	AnalyzerProtocolVersion = "v1"
+	// ExternalAnalyzerPrefix is the prefix of the names of external analyzer binaries, which are
+	// found in PATH and in the analyzers directory of the sbctl config dir
+	ExternalAnalyzerPrefix = "sbctl-analyzer-"
+)
+
+// BundleReader is the read-only access to a support bundle analyzers get. Its methods are kept
+// stable, so that analyzers maintained outside this repository keep building.
+type BundleReader interface {
+	// ListResources returns the objects of a resource, see ListResources
+	ListResources(ctx context.Context, group string, resource string) ([]unstructured.Unstructured, error)
+	// ReadFile reads a file by its path relative to the root of the bundle, e.g. analysis.json
+	ReadFile(name string) ([]byte, error)
+	// ClusterData returns the locations of the bundle's files
+	ClusterData() ClusterData
+}
+
+// Analyzer checks a support bundle for problems and reports them as analyzer results, which are
+// printed by "sbctl analyze" like the results troubleshoot stores in analysis.json
+type Analyzer interface {
+	Name() string
+	Analyze(ctx context.Context, bundle BundleReader) ([]AnalysisResult, error)
+}
+
+var (
+	analyzersMu sync.Mutex
+	analyzers   = map[string]Analyzer{}
+)
+
+// RegisterAnalyzer adds an analyzer that runs in the sbctl process. Analyzers are registered from
+// init functions, as printers are.
+func RegisterAnalyzer(a Analyzer) {
+	analyzersMu.Lock()
+	defer analyzersMu.Unlock()
+	analyzers[a.Name()] = a
+}
+
+// RegisteredAnalyzers returns the analyzers added with RegisterAnalyzer, sorted by name
+func RegisteredAnalyzers() []Analyzer {
+	analyzersMu.Lock()
+	defer analyzersMu.Unlock()
+
+	list := make([]Analyzer, 0, len(analyzers))
+	for _, a := range analyzers {
+		list = append(list, a)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name() < list[j].Name()
+	})
+	return list
+}
+
+type bundleReader struct {
+	clusterData ClusterData
+}
+
+// NewBundleReader returns the BundleReader of an extracted bundle
+func NewBundleReader(clusterData ClusterData) BundleReader {
+	return bundleReader{clusterData: clusterData}
+}
+
+func (r bundleReader) ListResources(ctx context.Context, group string, resource string) ([]unstructured.Unstructured, error) {
+	return ListResourcesContext(ctx, r.clusterData, group, resource)
+}
+
+func (r bundleReader) ReadFile(name string) ([]byte, error) {
+	fileName := filepath.Join(r.clusterData.BundleDir, filepath.FromSlash(name))
+	if rel, err := filepath.Rel(r.clusterData.BundleDir, fileName); err != nil || strings.HasPrefix(rel, "..") {
+		return nil, errors.Errorf("%s is outside of the support bundle", name)
+	}
+	return os.ReadFile(fileName)
+}
+
+func (r bundleReader) ClusterData() ClusterData {
+	return r.clusterData
+}
+
+// AnalyzerRequest is what sbctl writes to the stdin of external analyzers. They reply with a JSON
+// array of AnalysisResult on stdout, and exit with a non-zero code when they fail.
+type AnalyzerRequest struct {
+	ProtocolVersion     string `json:"protocolVersion"`
+	BundleDir           string `json:"bundleDir"`
+	ClusterResourcesDir string `json:"clusterResourcesDir"`
+	ClusterInfoFile     string `json:"clusterInfoFile,omitempty"`
+	AnalysisFile        string `json:"analysisFile,omitempty"`
+}
+
+// ExternalAnalyzer runs an analyzer binary with the JSON protocol of AnalyzerRequest. Analyzers
+// written in Go implement Analyzer and call ServeAnalyzer from their main function.
+type ExternalAnalyzer struct {
+	Path string
+}
+
+func (a ExternalAnalyzer) Name() string {
+	name := strings.TrimSuffix(filepath.Base(a.Path), ".exe")
+	return strings.TrimPrefix(name, ExternalAnalyzerPrefix)
+}
+
+func (a ExternalAnalyzer) Analyze(ctx context.Context, bundle BundleReader) ([]AnalysisResult, error) {
+	clusterData := bundle.ClusterData()
+	request, err := json.Marshal(AnalyzerRequest{
+		ProtocolVersion:     AnalyzerProtocolVersion,
+		BundleDir:           clusterData.BundleDir,
+		ClusterResourcesDir: clusterData.ClusterResourcesDir,
+		ClusterInfoFile:     clusterData.ClusterInfoFile,
+		AnalysisFile:        clusterData.AnalysisFile,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal analyzer request")
+	}
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, a.Path)
+	cmd.Stdin = bytes.NewReader(request)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, errors.Wrapf(err, "failed to run %s: %s", a.Path, msg)
+		}
+		return nil, errors.Wrapf(err, "failed to run %s", a.Path)
+	}
+
+	results := []AnalysisResult{}
+	if err := json.Unmarshal(stdout.Bytes(), &results); err != nil {
+		return nil, errors.Wrapf(err, "failed to unmarshal results of %s", a.Path)
+	}
+	for i := range results {
+		if results[i].Name == "" {
+			results[i].Name = a.Name()
+		}
+	}
+	return results, nil
+}
+
+// FindExternalAnalyzers returns the executables named sbctl-analyzer-* in dirs, with the first
+// one of a name winning. Directories that do not exist or cannot be read are skipped, as PATH
+// lookups do.
+func FindExternalAnalyzers(dirs []string) []ExternalAnalyzer {
+	found := []ExternalAnalyzer{}
+	names := map[string]bool{}
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+
+		for _, entry := range entries {
+			if !strings.HasPrefix(entry.Name(), ExternalAnalyzerPrefix) || entry.IsDir() {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil || (runtime.GOOS != "windows" && info.Mode()&0111 == 0) {
+				continue
+			}
+			a := ExternalAnalyzer{Path: filepath.Join(dir, entry.Name())}
+			if names[a.Name()] {
+				continue
+			}
+			names[a.Name()] = true
+			found = append(found, a)
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].Name() < found[j].Name()
+	})
+	return found
+}
+
+// ServeAnalyzer implements the analyzer side of the JSON protocol, so that an Analyzer can be
+// built as an external analyzer binary:
+//
+//	func main() {
+//		if err := sbctl.ServeAnalyzer(context.Background(), myAnalyzer{}, os.Stdin, os.Stdout); err != nil {
+//			fmt.Fprintln(os.Stderr, err)
+//			os.Exit(1)
+//		}
+//	}
+func ServeAnalyzer(ctx context.Context, a Analyzer, in io.Reader, out io.Writer) error {
+	request := AnalyzerRequest{}
+	if err := json.NewDecoder(in).Decode(&request); err != nil {
+		return errors.Wrap(err, "failed to decode analyzer request")
+	}
+	if request.ProtocolVersion != AnalyzerProtocolVersion {
+		return errors.Errorf("unsupported analyzer protocol version %q, expected %q", request.ProtocolVersion, AnalyzerProtocolVersion)
+	}
+
+	results, err := a.Analyze(ctx, NewBundleReader(ClusterData{
+		BundleDir:           request.BundleDir,
+		ClusterResourcesDir: request.ClusterResourcesDir,
+		ClusterInfoFile:     request.ClusterInfoFile,
+		AnalysisFile:        request.AnalysisFile,
+	}))
+	if err != nil {
+		return err
+	}
+	if results == nil {
+		results = []AnalysisResult{}
+	}
+	return json.NewEncoder(out).Encode(results)
+}
@@ -0,0 +1,315 @@
+package sbctl
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+)
+
+// auditStageOrder orders the stages an audit event can be logged at, so that only the last one
+// logged for a request is kept
+var auditStageOrder = map[auditv1.Stage]int{
+	auditv1.StageRequestReceived:  0,
+	auditv1.StageResponseStarted:  1,
+	auditv1.StageResponseComplete: 2,
+	auditv1.StagePanic:            3,
+}
+
+// IsAuditLogFile matches kube-apiserver audit logs copied from hosts, such as audit.log or
+// k8s-audit.log, and their rotated files
+func IsAuditLogFile(relPath string) bool {
+	name := strings.ToLower(filepath.Base(relPath))
+	if !strings.Contains(name, "audit") || isCollectorErrorsFile(name) {
+		return false
+	}
+	switch filepath.Ext(name) {
+	case ".log", ".json", ".jsonl", ".txt", "":
+		return true
+	}
+	return false
+}
+
+// FindAuditLogs returns the audit logs outside of cluster resources, relative to the bundle root
+func FindAuditLogs(clusterData ClusterData) ([]string, error) {
+	files := []string{}
+	if clusterData.ClusterResourcesDir == "" {
+		return files, nil
+	}
+
+	bundleRoot := filepath.Dir(clusterData.ClusterResourcesDir)
+	err := filepath.Walk(bundleRoot, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path == clusterData.ClusterResourcesDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		relPath, err := filepath.Rel(bundleRoot, path)
+		if err != nil || !IsAuditLogFile(relPath) {
+			return nil
+		}
+		files = append(files, filepath.ToSlash(relPath))
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to walk bundle")
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// IndexedAuditEvent is where an audit event is in the audit logs of a bundle, with the fields
+// that audit queries select events by
+type IndexedAuditEvent struct {
+	// File is relative to the bundle root, with slashes
+	File             string                   `json:"file"`
+	Offset           int64                    `json:"offset"`
+	Received         time.Time                `json:"received"`
+	Verb             string                   `json:"verb"`
+	User             string                   `json:"user,omitempty"`
+	ImpersonatedUser string                   `json:"impersonatedUser,omitempty"`
+	ObjectRef        *auditv1.ObjectReference `json:"objectRef,omitempty"`
+
+	stage auditv1.Stage
+}
+
+// event returns an event with the fields of the indexed event, that queries can match
+func (e IndexedAuditEvent) event() auditv1.Event {
+	event := auditv1.Event{
+		Verb:                     e.Verb,
+		User:                     authenticationv1.UserInfo{Username: e.User},
+		ObjectRef:                e.ObjectRef,
+		RequestReceivedTimestamp: metav1.NewMicroTime(e.Received),
+	}
+	if e.ImpersonatedUser != "" {
+		event.ImpersonatedUser = &authenticationv1.UserInfo{Username: e.ImpersonatedUser}
+	}
+	return event
+}
+
+// IndexAuditEvents reads every audit log in the bundle into an index of their events, sorted by
+// the time requests were received. Requests logged at several stages are indexed once, at the
+// last stage logged. Lines that are not audit events are skipped.
+func IndexAuditEvents(clusterData ClusterData) ([]IndexedAuditEvent, error) {
+	files, err := FindAuditLogs(clusterData)
+	if err != nil {
+		return nil, err
+	}
+
+	bundleRoot := filepath.Dir(clusterData.ClusterResourcesDir)
+	byID := map[string]int{}
+	events := []IndexedAuditEvent{}
+	for _, file := range files {
+		err := readAuditLog(filepath.Join(bundleRoot, filepath.FromSlash(file)), func(event auditv1.Event, offset int64) {
+			indexed := IndexedAuditEvent{
+				File:      file,
+				Offset:    offset,
+				Received:  event.RequestReceivedTimestamp.Time,
+				Verb:      event.Verb,
+				User:      event.User.Username,
+				ObjectRef: event.ObjectRef,
+				stage:     event.Stage,
+			}
+			if event.ImpersonatedUser != nil {
+				indexed.ImpersonatedUser = event.ImpersonatedUser.Username
+			}
+
+			i, ok := byID[string(event.AuditID)]
+			if !ok || event.AuditID == "" {
+				byID[string(event.AuditID)] = len(events)
+				events = append(events, indexed)
+				return
+			}
+			if auditStageOrder[event.Stage] >= auditStageOrder[events[i].stage] {
+				events[i] = indexed
+			}
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read audit log %s", file)
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Received.Before(events[j].Received)
+	})
+	return events, nil
+}
+
+// AuditEvents returns the index of the audit events of the bundle, from the bundle index when the
+// cluster data has one, so that the audit logs are only read for the events a query selects
+func AuditEvents(clusterData ClusterData) ([]IndexedAuditEvent, error) {
+	if clusterData.Index != nil {
+		return clusterData.Index.Audit, nil
+	}
+	return IndexAuditEvents(clusterData)
+}
+
+// ReadAuditEvents reads indexed events from the audit logs of the bundle
+func ReadAuditEvents(clusterData ClusterData, indexed []IndexedAuditEvent) ([]auditv1.Event, error) {
+	bundleRoot := filepath.Dir(clusterData.ClusterResourcesDir)
+	files := map[string]*os.File{}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	events := make([]auditv1.Event, 0, len(indexed))
+	for _, e := range indexed {
+		f, ok := files[e.File]
+		if !ok {
+			var err error
+			if f, err = os.Open(filepath.Join(bundleRoot, filepath.FromSlash(e.File))); err != nil {
+				return nil, errors.Wrapf(err, "failed to open audit log %s", e.File)
+			}
+			files[e.File] = f
+		}
+
+		line, err := bufio.NewReader(io.NewSectionReader(f, e.Offset, math.MaxInt64-e.Offset)).ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, errors.Wrapf(err, "failed to read audit log %s", e.File)
+		}
+		event := auditv1.Event{}
+		if err := json.Unmarshal(line, &event); err != nil {
+			return nil, errors.Wrapf(err, "failed to decode event at offset %d of audit log %s", e.Offset, e.File)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// readAuditLog calls fn with every event of a log with one JSON event per line, and the offset of
+// its line. Lines are read with a bufio.Reader rather than a Scanner, since events with request
+// and response objects can be larger than a Scanner's buffer.
+func readAuditLog(fileName string, fn func(auditv1.Event, int64)) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	offset := int64(0)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			event := auditv1.Event{}
+			if json.Unmarshal(line, &event) == nil && event.Kind == "Event" && event.Verb != "" {
+				fn(event, offset)
+			}
+		}
+		offset += int64(len(line))
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// AuditQuery selects audit events. Empty fields match everything.
+type AuditQuery struct {
+	// User is matched against the user and the impersonated user, as a glob pattern such as
+	// system:serviceaccount:* or as a substring when it has no wildcards
+	User  string
+	Verbs []string
+	// Resource is a resource name or resource.group, compared ignoring case
+	Resource  string
+	Namespace string
+	// Name is a glob pattern or a substring, as User is
+	Name  string
+	Since time.Time
+	Until time.Time
+}
+
+// Matches returns whether an event is selected by the query
+func (q AuditQuery) Matches(event auditv1.Event) bool {
+	if q.User != "" {
+		matched := MatchesNamePattern(q.User, event.User.Username)
+		if event.ImpersonatedUser != nil {
+			matched = matched || MatchesNamePattern(q.User, event.ImpersonatedUser.Username)
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(q.Verbs) > 0 {
+		matched := false
+		for _, verb := range q.Verbs {
+			matched = matched || strings.EqualFold(verb, event.Verb)
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	ref := event.ObjectRef
+	if q.Resource != "" || q.Namespace != "" || q.Name != "" {
+		if ref == nil {
+			return false
+		}
+		if q.Resource != "" && !strings.EqualFold(q.Resource, ref.Resource) && !strings.EqualFold(q.Resource, ref.Resource+"."+ref.APIGroup) {
+			return false
+		}
+		if q.Namespace != "" && ref.Namespace != q.Namespace {
+			return false
+		}
+		if q.Name != "" && !MatchesNamePattern(q.Name, ref.Name) {
+			return false
+		}
+	}
+
+	received := event.RequestReceivedTimestamp.Time
+	if !q.Since.IsZero() && received.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && received.After(q.Until) {
+		return false
+	}
+	return true
+}
+
+// FilterAuditEvents returns the indexed events selected by the query. Events must be sorted by the
+// time requests were received, as IndexAuditEvents returns them, so that only the events between
+// Since and Until are matched instead of every event of long audit logs.
+func FilterAuditEvents(events []IndexedAuditEvent, query AuditQuery) []IndexedAuditEvent {
+	start, end := 0, len(events)
+	if !query.Since.IsZero() {
+		start = sort.Search(len(events), func(i int) bool {
+			return !events[i].Received.Before(query.Since)
+		})
+	}
+	if !query.Until.IsZero() {
+		end = sort.Search(len(events), func(i int) bool {
+			return events[i].Received.After(query.Until)
+		})
+	}
+	if end < start {
+		end = start
+	}
+
+	matched := []IndexedAuditEvent{}
+	for _, event := range events[start:end] {
+		if query.Matches(event.event()) {
+			matched = append(matched, event)
+		}
+	}
+	return matched
+}
@@ -0,0 +1,355 @@
+package sbctl
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	AutoscalerClusterAutoscaler = "cluster-autoscaler"
+	AutoscalerKarpenter         = "karpenter"
+
+	clusterAutoscalerStatusConfigMap = "cluster-autoscaler-status"
+)
+
+var (
+	// scaleUpFailureEventReasons are the reasons of events cluster-autoscaler and Karpenter report
+	// failed scale-ups with
+	scaleUpFailureEventReasons = []string{
+		"FailedToScaleUpGroup", "ScaleUpFailed", "ScaleUpTimedOut", // cluster-autoscaler
+		"InsufficientCapacityError", "FailedLaunch", "FailedRegistration", "FailedConsistencyCheck", // Karpenter
+	}
+	// disruptionBlockedEventReasons are the reasons of events about nodes that cannot be removed
+	disruptionBlockedEventReasons = []string{"DisruptionBlocked", "ScaleDownFailed", "Unconsolidatable"}
+
+	// cluster-autoscaler logs with klog, e.g. "E0102 15:04:05.000000 1 scale_up.go:123] Failed to
+	// scale up: ..."
+	clusterAutoscalerLogPattern     = regexp.MustCompile(`^[EW]\d{4} [\d:.]+\s+\d+ [^\]]+\] (.*)$`)
+	clusterAutoscalerFailurePattern = regexp.MustCompile(`(?i)(failed to (scale up|increase|fix|create)|scale-up failed|no expansion options|out of resources|quota|max node group size reached|could not)`)
+)
+
+// AutoscalerIssue is a problem an autoscaler reported, as often as it was reported
+type AutoscalerIssue struct {
+	Autoscaler string    `json:"autoscaler,omitempty"`
+	Object     string    `json:"object,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	Message    string    `json:"message"`
+	Count      int       `json:"count"`
+	LastTime   time.Time `json:"lastTime,omitempty"`
+	// Source is event, nodeclaim, or the file of the log relative to the cluster resources directory
+	Source string `json:"source"`
+}
+
+// AutoscalingPod is a pod waiting for a scale-up, or blocking a scale-down
+type AutoscalingPod struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Node      string `json:"node,omitempty"`
+	Reason    string `json:"reason"`
+}
+
+// AutoscalingSummary is what autoscalers did, and failed to do, when the bundle was collected
+type AutoscalingSummary struct {
+	Autoscalers []string `json:"autoscalers"`
+	// ClusterAutoscalerStatus is the status cluster-autoscaler writes to its status ConfigMap
+	ClusterAutoscalerStatus string            `json:"clusterAutoscalerStatus,omitempty"`
+	ScaleUpFailures         []AutoscalerIssue `json:"scaleUpFailures"`
+	ScaleDownBlocked        []AutoscalerIssue `json:"scaleDownBlocked"`
+	PendingPods             []AutoscalingPod  `json:"pendingPods"`
+	BlockingPods            []AutoscalingPod  `json:"blockingPods"`
+}
+
+// FindAutoscaling summarizes cluster-autoscaler and Karpenter from their status ConfigMap, events,
+// NodeClaims and collected logs: failed scale-ups, unschedulable pods with the reason autoscalers
+// did not add nodes for them, and pods and events that keep nodes from being removed
+func FindAutoscaling(clusterData ClusterData) (*AutoscalingSummary, error) {
+	pods, err := ListTypedResources[corev1.Pod](clusterData, "", "pods")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list pods")
+	}
+	events, err := ListTypedResources[corev1.Event](clusterData, "", "events")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list events")
+	}
+	configMaps, err := ListTypedResources[corev1.ConfigMap](clusterData, "", "configmaps")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list configmaps")
+	}
+	nodeClaims, err := ListResources(clusterData, KarpenterGroup, "nodeclaims")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list nodeclaims")
+	}
+
+	summary := &AutoscalingSummary{
+		Autoscalers:      []string{},
+		ScaleUpFailures:  []AutoscalerIssue{},
+		ScaleDownBlocked: []AutoscalerIssue{},
+		PendingPods:      []AutoscalingPod{},
+		BlockingPods:     []AutoscalingPod{},
+	}
+	addAutoscaler := func(autoscaler string) {
+		if !containsString(summary.Autoscalers, autoscaler) {
+			summary.Autoscalers = append(summary.Autoscalers, autoscaler)
+		}
+	}
+
+	for _, cm := range configMaps {
+		if cm.Name == clusterAutoscalerStatusConfigMap {
+			summary.ClusterAutoscalerStatus = strings.TrimSpace(cm.Data["status"])
+			addAutoscaler(AutoscalerClusterAutoscaler)
+		}
+	}
+	if len(nodeClaims) > 0 {
+		addAutoscaler(AutoscalerKarpenter)
+	}
+
+	scaleUp, scaleDown := newAutoscalerIssues(), newAutoscalerIssues()
+	for _, pod := range pods {
+		for _, c := range pod.Spec.Containers {
+			autoscaler := autoscalerOfImage(c.Image)
+			if autoscaler == "" {
+				continue
+			}
+			addAutoscaler(autoscaler)
+			if err := readAutoscalerLogs(clusterData, pod, c.Name, autoscaler, scaleUp); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, claim := range nodeClaims {
+		conditions, _, _ := unstructured.NestedSlice(claim.Object, "status", "conditions")
+		for _, c := range conditions {
+			m, ok := c.(map[string]interface{})
+			if !ok || m["status"] != "False" || m["message"] == nil {
+				continue
+			}
+			reason := fmt.Sprint(m["type"])
+			if r, ok := m["reason"].(string); ok && r != "" {
+				reason += ": " + r
+			}
+			scaleUp.add(AutoscalerIssue{
+				Autoscaler: AutoscalerKarpenter,
+				Object:     "nodeclaim/" + claim.GetName(),
+				Reason:     reason,
+				Message:    fmt.Sprint(m["message"]),
+				Source:     "nodeclaim",
+			})
+		}
+	}
+
+	// The latest reason autoscalers gave for not adding a node for each unschedulable pod
+	podReasons := map[string]string{}
+	podReasonTimes := map[string]time.Time{}
+	for _, e := range events {
+		issue := AutoscalerIssue{
+			Autoscaler: eventAutoscaler(e),
+			Object:     strings.ToLower(e.InvolvedObject.Kind) + "/" + e.InvolvedObject.Name,
+			Reason:     e.Reason,
+			Message:    e.Message,
+			Count:      int(e.Count),
+			LastTime:   eventLastTime(e),
+			Source:     "event",
+		}
+		switch {
+		case containsString(scaleUpFailureEventReasons, e.Reason):
+			scaleUp.add(issue)
+		case containsString(disruptionBlockedEventReasons, e.Reason):
+			scaleDown.add(issue)
+		case e.InvolvedObject.Kind == "Pod" && (e.Reason == "NotTriggerScaleUp" || (e.Reason == "FailedScheduling" && issue.Autoscaler == AutoscalerKarpenter)):
+			key := e.InvolvedObject.Namespace + "/" + e.InvolvedObject.Name
+			if t, ok := podReasonTimes[key]; !ok || !issue.LastTime.Before(t) {
+				podReasons[key] = e.Message
+				podReasonTimes[key] = issue.LastTime
+			}
+		}
+	}
+	summary.ScaleUpFailures = scaleUp.issues
+	summary.ScaleDownBlocked = scaleDown.issues
+
+	for _, pod := range pods {
+		key := pod.Namespace + "/" + pod.Name
+		if isUnschedulablePod(pod) {
+			reason, ok := podReasons[key]
+			if !ok {
+				reason = "no autoscaler event"
+			}
+			summary.PendingPods = append(summary.PendingPods, AutoscalingPod{Namespace: pod.Namespace, Name: pod.Name, Reason: reason})
+			continue
+		}
+		if reason := scaleDownBlockingAnnotation(pod); reason != "" && pod.Spec.NodeName != "" && pod.Status.Phase == corev1.PodRunning {
+			summary.BlockingPods = append(summary.BlockingPods, AutoscalingPod{Namespace: pod.Namespace, Name: pod.Name, Node: pod.Spec.NodeName, Reason: reason})
+		}
+	}
+
+	sort.Strings(summary.Autoscalers)
+	for _, list := range [][]AutoscalerIssue{summary.ScaleUpFailures, summary.ScaleDownBlocked} {
+		sort.SliceStable(list, func(i, j int) bool {
+			return list[i].LastTime.After(list[j].LastTime)
+		})
+	}
+	return summary, nil
+}
+
+// autoscalerIssues merges issues with the same message from the same object and source
+type autoscalerIssues struct {
+	issues []AutoscalerIssue
+	index  map[string]int
+}
+
+func newAutoscalerIssues() *autoscalerIssues {
+	return &autoscalerIssues{issues: []AutoscalerIssue{}, index: map[string]int{}}
+}
+
+func (a *autoscalerIssues) add(issue AutoscalerIssue) {
+	if issue.Count < 1 {
+		issue.Count = 1
+	}
+	key := strings.Join([]string{issue.Source, issue.Object, issue.Message}, "/")
+	if i, ok := a.index[key]; ok {
+		a.issues[i].Count += issue.Count
+		if issue.LastTime.After(a.issues[i].LastTime) {
+			a.issues[i].LastTime = issue.LastTime
+		}
+		return
+	}
+	a.index[key] = len(a.issues)
+	a.issues = append(a.issues, issue)
+}
+
+func autoscalerOfImage(image string) string {
+	name := path.Base(strings.SplitN(image, "@", 2)[0])
+	name = strings.SplitN(name, ":", 2)[0]
+	switch {
+	case strings.Contains(name, "cluster-autoscaler"):
+		return AutoscalerClusterAutoscaler
+	case strings.Contains(image, "karpenter") && (name == "controller" || strings.Contains(name, "karpenter")):
+		return AutoscalerKarpenter
+	}
+	return ""
+}
+
+func eventAutoscaler(e corev1.Event) string {
+	for _, s := range []string{e.Source.Component, e.ReportingController} {
+		switch {
+		case strings.Contains(s, "cluster-autoscaler"):
+			return AutoscalerClusterAutoscaler
+		case strings.Contains(s, "karpenter"):
+			return AutoscalerKarpenter
+		}
+	}
+	if e.InvolvedObject.Name == clusterAutoscalerStatusConfigMap || e.Reason == "NotTriggerScaleUp" {
+		return AutoscalerClusterAutoscaler
+	}
+	return ""
+}
+
+func eventLastTime(e corev1.Event) time.Time {
+	switch {
+	case !e.LastTimestamp.IsZero():
+		return e.LastTimestamp.Time
+	case !e.EventTime.IsZero():
+		return e.EventTime.Time
+	}
+	return e.FirstTimestamp.Time
+}
+
+func isUnschedulablePod(pod corev1.Pod) bool {
+	if pod.Status.Phase != corev1.PodPending || pod.Spec.NodeName != "" {
+		return false
+	}
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodScheduled && c.Status == corev1.ConditionFalse && c.Reason == corev1.PodReasonUnschedulable {
+			return true
+		}
+	}
+	return false
+}
+
+// scaleDownBlockingAnnotation returns the annotation that keeps autoscalers from removing the
+// node of a pod
+func scaleDownBlockingAnnotation(pod corev1.Pod) string {
+	if pod.Annotations["cluster-autoscaler.kubernetes.io/safe-to-evict"] == "false" {
+		return "cluster-autoscaler.kubernetes.io/safe-to-evict=false"
+	}
+	for _, annotation := range []string{"karpenter.sh/do-not-disrupt", "karpenter.sh/do-not-evict"} {
+		if pod.Annotations[annotation] == "true" {
+			return annotation + "=true"
+		}
+	}
+	return ""
+}
+
+// readAutoscalerLogs adds the scale-up failures in the current and previous logs of an
+// autoscaler's container
+func readAutoscalerLogs(clusterData ClusterData, pod corev1.Pod, container string, autoscaler string, scaleUp *autoscalerIssues) error {
+	for _, name := range []string{container + ".log", container + "-previous.log"} {
+		relPath := path.Join("pods", "logs", pod.Namespace, pod.Name, name)
+		f, err := os.Open(filepath.Join(clusterData.ClusterResourcesDir, filepath.FromSlash(relPath)))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return errors.Wrapf(err, "failed to open %s", relPath)
+		}
+
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			issue, ok := parseAutoscalerLogLine(scanner.Text(), autoscaler)
+			if !ok {
+				continue
+			}
+			issue.Object = "pod/" + pod.Name
+			issue.Source = relPath
+			scaleUp.add(issue)
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return errors.Wrapf(err, "failed to read %s", relPath)
+		}
+	}
+	return nil
+}
+
+// parseAutoscalerLogLine returns the scale-up failure a log line reports. Karpenter logs JSON
+// with a message and an error, cluster-autoscaler logs with klog.
+func parseAutoscalerLogLine(line string, autoscaler string) (AutoscalerIssue, bool) {
+	issue := AutoscalerIssue{Autoscaler: autoscaler}
+	if autoscaler == AutoscalerKarpenter {
+		entry := struct {
+			Level   string    `json:"level"`
+			Time    time.Time `json:"time"`
+			Message string    `json:"message"`
+			Error   string    `json:"error"`
+		}{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil || !strings.EqualFold(entry.Level, "error") {
+			return issue, false
+		}
+		issue.Message = entry.Message
+		if entry.Error != "" {
+			issue.Message += ": " + entry.Error
+		}
+		issue.LastTime = entry.Time
+		return issue, true
+	}
+
+	m := clusterAutoscalerLogPattern.FindStringSubmatch(line)
+	if m == nil || !clusterAutoscalerFailurePattern.MatchString(m[1]) {
+		return issue, false
+	}
+	issue.Message = m[1]
+	return issue, true
+}
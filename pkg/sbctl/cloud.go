@@ -0,0 +1,456 @@
+package sbctl
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	CloudProviderAWS   = "aws"
+	CloudProviderGCP   = "gcp"
+	CloudProviderAzure = "azure"
+)
+
+// maxCloudFileSize is the largest JSON file read when looking for cloud collector output
+const maxCloudFileSize = 16 << 20
+
+// CloudInstance is a VM described by instance metadata collected from the cloud provider's
+// metadata service, e.g. by a run or http collector on the host
+type CloudInstance struct {
+	Provider string `json:"provider"`
+	// ID is the instance ID on AWS and the resource ID of the VM on Azure. GCP node provider IDs
+	// have the name of the instance instead.
+	ID         string   `json:"id"`
+	Name       string   `json:"name,omitempty"`
+	Type       string   `json:"type,omitempty"`
+	Region     string   `json:"region,omitempty"`
+	Zone       string   `json:"zone,omitempty"`
+	PrivateIPs []string `json:"privateIPs,omitempty"`
+	// File is relative to the bundle root
+	File string `json:"file"`
+}
+
+// CloudLoadBalancer is a load balancer described by the cloud provider's CLI or API, e.g.
+// aws elbv2 describe-load-balancers, gcloud compute forwarding-rules list or az network lb list
+type CloudLoadBalancer struct {
+	Provider string   `json:"provider"`
+	Name     string   `json:"name"`
+	ID       string   `json:"id,omitempty"`
+	DNSName  string   `json:"dnsName,omitempty"`
+	IPs      []string `json:"ips,omitempty"`
+	Type     string   `json:"type,omitempty"`
+	Scheme   string   `json:"scheme,omitempty"`
+	State    string   `json:"state,omitempty"`
+	// File is relative to the bundle root
+	File string `json:"file"`
+}
+
+// CloudData is the cloud collector output found in a bundle
+type CloudData struct {
+	Instances     []CloudInstance     `json:"instances"`
+	LoadBalancers []CloudLoadBalancer `json:"loadBalancers"`
+}
+
+// FindCloudData reads instance metadata and load balancer descriptions of AWS, GCP and Azure
+// from JSON files outside of cluster resources. Files are recognized by their content, since
+// collectors name them freely.
+func FindCloudData(clusterData ClusterData) (CloudData, error) {
+	data := CloudData{Instances: []CloudInstance{}, LoadBalancers: []CloudLoadBalancer{}}
+	if clusterData.ClusterResourcesDir == "" {
+		return data, nil
+	}
+	root := clusterData.BundleDir
+	if root == "" {
+		root = filepath.Dir(clusterData.ClusterResourcesDir)
+	}
+
+	// Azure describes public IPs separately from the load balancers they belong to
+	azurePublicIPs := map[string][]string{}
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path == clusterData.ClusterResourcesDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ".json" || info.Size() > maxCloudFileSize || path == clusterData.AnalysisFile {
+			return nil
+		}
+
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read %s", path)
+		}
+		var doc interface{}
+		if err := json.Unmarshal(b, &doc); err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, path)
+		rel = filepath.ToSlash(rel)
+
+		switch doc := doc.(type) {
+		case map[string]interface{}:
+			if instance, ok := parseCloudInstance(doc); ok {
+				instance.File = rel
+				data.Instances = append(data.Instances, instance)
+			}
+			for _, lb := range parseAWSLoadBalancers(doc) {
+				lb.File = rel
+				data.LoadBalancers = append(data.LoadBalancers, lb)
+			}
+		case []interface{}:
+			for _, item := range doc {
+				obj, _ := item.(map[string]interface{})
+				if lb, ok := parseListedLoadBalancer(obj); ok {
+					lb.File = rel
+					data.LoadBalancers = append(data.LoadBalancers, lb)
+				}
+				if ip, configID := parseAzurePublicIP(obj); ip != "" {
+					azurePublicIPs[configID] = append(azurePublicIPs[configID], ip)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return data, err
+	}
+
+	for i, lb := range data.LoadBalancers {
+		if lb.Provider != CloudProviderAzure {
+			continue
+		}
+		for configID, ips := range azurePublicIPs {
+			if strings.HasPrefix(strings.ToLower(configID), strings.ToLower(lb.ID)+"/") {
+				data.LoadBalancers[i].IPs = append(data.LoadBalancers[i].IPs, ips...)
+			}
+		}
+	}
+
+	sort.SliceStable(data.Instances, func(i, j int) bool {
+		return data.Instances[i].File < data.Instances[j].File
+	})
+	sort.SliceStable(data.LoadBalancers, func(i, j int) bool {
+		return data.LoadBalancers[i].Name < data.LoadBalancers[j].Name
+	})
+	return data, nil
+}
+
+// field returns the value of a key, ignoring case, since providers and their CLIs disagree on it
+func field(obj map[string]interface{}, key string) interface{} {
+	if v, ok := obj[key]; ok {
+		return v
+	}
+	for k, v := range obj {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return nil
+}
+
+func stringField(obj map[string]interface{}, key string) string {
+	s, _ := field(obj, key).(string)
+	return s
+}
+
+func objectField(obj map[string]interface{}, key string) map[string]interface{} {
+	m, _ := field(obj, key).(map[string]interface{})
+	return m
+}
+
+func listField(obj map[string]interface{}, key string) []map[string]interface{} {
+	items, _ := field(obj, key).([]interface{})
+	result := []map[string]interface{}{}
+	for _, item := range items {
+		if m, ok := item.(map[string]interface{}); ok {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+// lastSegment returns what follows the last slash, e.g. the zone of projects/1/zones/us-central1-a
+func lastSegment(s string) string {
+	return s[strings.LastIndex(s, "/")+1:]
+}
+
+// parseCloudInstance recognizes the AWS instance identity document, the GCP instance metadata
+// read with ?recursive=true, and the Azure instance metadata
+func parseCloudInstance(doc map[string]interface{}) (CloudInstance, bool) {
+	if id := stringField(doc, "instanceId"); id != "" && stringField(doc, "availabilityZone") != "" {
+		instance := CloudInstance{
+			Provider: CloudProviderAWS,
+			ID:       id,
+			Type:     stringField(doc, "instanceType"),
+			Region:   stringField(doc, "region"),
+			Zone:     stringField(doc, "availabilityZone"),
+		}
+		if ip := stringField(doc, "privateIp"); ip != "" {
+			instance.PrivateIPs = append(instance.PrivateIPs, ip)
+		}
+		return instance, true
+	}
+
+	if compute := objectField(doc, "compute"); compute != nil && stringField(compute, "vmId") != "" {
+		instance := CloudInstance{
+			Provider: CloudProviderAzure,
+			ID:       stringField(compute, "resourceId"),
+			Name:     stringField(compute, "name"),
+			Type:     stringField(compute, "vmSize"),
+			Region:   stringField(compute, "location"),
+			Zone:     stringField(compute, "zone"),
+		}
+		for _, iface := range listField(objectField(doc, "network"), "interface") {
+			for _, addr := range listField(objectField(iface, "ipv4"), "ipAddress") {
+				if ip := stringField(addr, "privateIpAddress"); ip != "" {
+					instance.PrivateIPs = append(instance.PrivateIPs, ip)
+				}
+			}
+		}
+		return instance, true
+	}
+
+	if zone := stringField(doc, "zone"); strings.Contains(zone, "/zones/") && stringField(doc, "machineType") != "" {
+		instance := CloudInstance{
+			Provider: CloudProviderGCP,
+			ID:       stringField(doc, "name"),
+			Name:     stringField(doc, "name"),
+			Type:     lastSegment(stringField(doc, "machineType")),
+			Zone:     lastSegment(zone),
+		}
+		if i := strings.LastIndex(instance.Zone, "-"); i > 0 {
+			instance.Region = instance.Zone[:i]
+		}
+		for _, iface := range listField(doc, "networkInterfaces") {
+			if ip := stringField(iface, "ip"); ip != "" {
+				instance.PrivateIPs = append(instance.PrivateIPs, ip)
+			}
+		}
+		return instance, true
+	}
+
+	return CloudInstance{}, false
+}
+
+// parseAWSLoadBalancers reads the output of aws elbv2 describe-load-balancers and of
+// aws elb describe-load-balancers for classic load balancers
+func parseAWSLoadBalancers(doc map[string]interface{}) []CloudLoadBalancer {
+	result := []CloudLoadBalancer{}
+	for _, lb := range listField(doc, "LoadBalancers") {
+		result = append(result, CloudLoadBalancer{
+			Provider: CloudProviderAWS,
+			Name:     stringField(lb, "LoadBalancerName"),
+			ID:       stringField(lb, "LoadBalancerArn"),
+			DNSName:  stringField(lb, "DNSName"),
+			Type:     stringField(lb, "Type"),
+			Scheme:   stringField(lb, "Scheme"),
+			State:    stringField(objectField(lb, "State"), "Code"),
+		})
+	}
+	for _, lb := range listField(doc, "LoadBalancerDescriptions") {
+		result = append(result, CloudLoadBalancer{
+			Provider: CloudProviderAWS,
+			Name:     stringField(lb, "LoadBalancerName"),
+			DNSName:  stringField(lb, "DNSName"),
+			Type:     "classic",
+			Scheme:   stringField(lb, "Scheme"),
+		})
+	}
+	return result
+}
+
+// parseListedLoadBalancer reads an item of gcloud compute forwarding-rules list --format=json or
+// of az network lb list
+func parseListedLoadBalancer(obj map[string]interface{}) (CloudLoadBalancer, bool) {
+	if obj == nil {
+		return CloudLoadBalancer{}, false
+	}
+
+	if stringField(obj, "kind") == "compute#forwardingRule" {
+		lb := CloudLoadBalancer{
+			Provider: CloudProviderGCP,
+			Name:     stringField(obj, "name"),
+			ID:       stringField(obj, "selfLink"),
+			Type:     lastSegment(stringField(obj, "target")),
+			Scheme:   stringField(obj, "loadBalancingScheme"),
+		}
+		if ip := stringField(obj, "IPAddress"); ip != "" {
+			lb.IPs = append(lb.IPs, ip)
+		}
+		return lb, true
+	}
+
+	if strings.EqualFold(stringField(obj, "type"), "Microsoft.Network/loadBalancers") {
+		lb := CloudLoadBalancer{
+			Provider: CloudProviderAzure,
+			Name:     stringField(obj, "name"),
+			ID:       stringField(obj, "id"),
+			Type:     stringField(objectField(obj, "sku"), "name"),
+			State:    stringField(obj, "provisioningState"),
+		}
+		for _, frontend := range listField(obj, "frontendIPConfigurations") {
+			if ip := stringField(frontend, "privateIPAddress"); ip != "" {
+				lb.IPs = append(lb.IPs, ip)
+			}
+		}
+		return lb, true
+	}
+
+	return CloudLoadBalancer{}, false
+}
+
+// parseAzurePublicIP reads an item of az network public-ip list, returning its address and the
+// ID of the frontend IP configuration of the load balancer it belongs to
+func parseAzurePublicIP(obj map[string]interface{}) (string, string) {
+	if obj == nil || !strings.EqualFold(stringField(obj, "type"), "Microsoft.Network/publicIPAddresses") {
+		return "", ""
+	}
+	configID := stringField(objectField(obj, "ipConfiguration"), "id")
+	if configID == "" {
+		return "", ""
+	}
+	return stringField(obj, "ipAddress"), configID
+}
+
+// ParseProviderID returns the provider and instance of a node's spec.providerID, e.g.
+// aws:///us-east-1a/i-0abc, gce://project/us-central1-a/name or
+// azure:///subscriptions/.../virtualMachines/name. The instance is the instance ID on AWS, the
+// instance name on GCP and the resource ID of the VM on Azure.
+func ParseProviderID(providerID string) (string, string) {
+	scheme, rest, ok := strings.Cut(providerID, "://")
+	if !ok {
+		return "", ""
+	}
+	switch scheme {
+	case "aws":
+		return CloudProviderAWS, lastSegment(rest)
+	case "gce":
+		return CloudProviderGCP, lastSegment(rest)
+	case "azure":
+		return CloudProviderAzure, rest
+	}
+	return scheme, rest
+}
+
+// NodeCloudResource is a node with the cloud instance it runs on
+type NodeCloudResource struct {
+	Node     string `json:"node"`
+	Provider string `json:"provider,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Zone     string `json:"zone,omitempty"`
+	// Metadata is the collected instance metadata, nil when none was collected for the node
+	Metadata *CloudInstance `json:"metadata,omitempty"`
+}
+
+// CorrelateNodes matches nodes with collected instance metadata, by the instance in their
+// provider ID or else by their internal IPs. The type and zone come from the well-known labels
+// of nodes, or else from the metadata.
+func CorrelateNodes(nodes []corev1.Node, cloud CloudData) []NodeCloudResource {
+	result := []NodeCloudResource{}
+	for _, node := range nodes {
+		r := NodeCloudResource{
+			Node: node.Name,
+			Type: node.Labels[corev1.LabelInstanceTypeStable],
+			Zone: node.Labels[corev1.LabelTopologyZone],
+		}
+		r.Provider, r.Instance = ParseProviderID(node.Spec.ProviderID)
+
+		ips := []string{}
+		for _, addr := range node.Status.Addresses {
+			if addr.Type == corev1.NodeInternalIP {
+				ips = append(ips, addr.Address)
+			}
+		}
+
+		for i, instance := range cloud.Instances {
+			matches := r.Instance != "" && instance.Provider == r.Provider && strings.EqualFold(instance.ID, r.Instance)
+			if !matches && r.Instance == "" {
+				matches = instance.Name == node.Name || intersects(instance.PrivateIPs, ips)
+			}
+			if matches {
+				r.Metadata = &cloud.Instances[i]
+				break
+			}
+		}
+
+		if r.Metadata != nil {
+			r.Provider = r.Metadata.Provider
+			if r.Instance == "" {
+				r.Instance = r.Metadata.ID
+			}
+			if r.Type == "" {
+				r.Type = r.Metadata.Type
+			}
+			if r.Zone == "" {
+				r.Zone = r.Metadata.Zone
+			}
+		}
+		result = append(result, r)
+	}
+	return result
+}
+
+// ServiceCloudResource is a Service of type LoadBalancer with the cloud load balancer that
+// serves it
+type ServiceCloudResource struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Ingress are the hostnames and IPs in the status of the Service
+	Ingress []string `json:"ingress"`
+	// LoadBalancer is nil when no collected load balancer has the hostname or IPs of the Service
+	LoadBalancer *CloudLoadBalancer `json:"loadBalancer,omitempty"`
+}
+
+// CorrelateServices matches Services of type LoadBalancer with collected load balancers, by the
+// DNS name or IPs in their status
+func CorrelateServices(services []corev1.Service, cloud CloudData) []ServiceCloudResource {
+	result := []ServiceCloudResource{}
+	for _, svc := range services {
+		if svc.Spec.Type != corev1.ServiceTypeLoadBalancer {
+			continue
+		}
+		r := ServiceCloudResource{Namespace: svc.Namespace, Name: svc.Name, Ingress: []string{}}
+		for _, ingress := range svc.Status.LoadBalancer.Ingress {
+			if ingress.Hostname != "" {
+				r.Ingress = append(r.Ingress, ingress.Hostname)
+			}
+			if ingress.IP != "" {
+				r.Ingress = append(r.Ingress, ingress.IP)
+			}
+		}
+
+		for i, lb := range cloud.LoadBalancers {
+			for _, ingress := range r.Ingress {
+				if (lb.DNSName != "" && strings.EqualFold(lb.DNSName, ingress)) || containsString(lb.IPs, ingress) {
+					r.LoadBalancer = &cloud.LoadBalancers[i]
+				}
+			}
+			if r.LoadBalancer != nil {
+				break
+			}
+		}
+		result = append(result, r)
+	}
+	return result
+}
+
+func intersects(a []string, b []string) bool {
+	for _, s := range a {
+		if containsString(b, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package sbctl
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// CollectorError is an error recorded by a collector that failed to collect some or all of its data.
+// Troubleshoot stores these next to the collected data, e.g. in cluster-resources/events-errors.json.
+type CollectorError struct {
+	// Collector is the path of the data the collector writes, relative to the bundle root,
+	// e.g. cluster-resources/events
+	Collector string `json:"collector"`
+	// File is the path of the errors file, relative to the bundle root
+	File    string `json:"file"`
+	Message string `json:"message"`
+}
+
+// ReadCollectorErrors returns the errors recorded by collectors anywhere in the bundle, sorted by
+// collector. Bundles without error files have none.
+func ReadCollectorErrors(clusterData ClusterData) ([]CollectorError, error) {
+	result := []CollectorError{}
+
+	root := clusterData.BundleDir
+	if root == "" && clusterData.ClusterResourcesDir != "" {
+		root = filepath.Dir(clusterData.ClusterResourcesDir)
+	}
+	if root == "" {
+		return result, nil
+	}
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !isCollectorErrorsFile(info.Name()) {
+			return nil
+		}
+
+		messages, err := readCollectorErrorsFile(path)
+		if err != nil {
+			return err
+		}
+
+		file, err := filepath.Rel(root, path)
+		if err != nil {
+			file = path
+		}
+		file = filepath.ToSlash(file)
+		collector := strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(file, ".json"), ".log"), "errors")
+		collector = strings.TrimSuffix(strings.TrimSuffix(collector, "-"), "/")
+		if collector == "" {
+			collector = "."
+		}
+
+		for _, message := range messages {
+			result = append(result, CollectorError{Collector: collector, File: file, Message: message})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to walk bundle dir")
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Collector < result[j].Collector
+	})
+	return result, nil
+}
+
+// isCollectorErrorsFile matches errors.json and files such as events-errors.json, and the
+// <container>-logs-errors.log files of pod logs that could not be collected
+func isCollectorErrorsFile(name string) bool {
+	return name == "errors.json" || strings.HasSuffix(name, "-errors.json") || strings.HasSuffix(name, "-errors.log")
+}
+
+// readCollectorErrorsFile reads an errors file, which troubleshoot writes as a JSON list of
+// strings. Files in another format, such as logs errors, are returned as a single message.
+func readCollectorErrorsFile(fileName string) ([]string, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", fileName)
+	}
+
+	messages := []string{}
+	if err := json.Unmarshal(data, &messages); err == nil {
+		return messages, nil
+	}
+
+	message := strings.TrimSpace(string(data))
+	if message == "" {
+		return []string{}, nil
+	}
+	return []string{message}, nil
+}
@@ -1,22 +1,20 @@
 package sbctl
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"sort"
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
-	appsv1 "k8s.io/api/apps/v1"
-	batchv1 "k8s.io/api/batch/v1"
-	batchv1beta1 "k8s.io/api/batch/v1beta1"
-	corev1 "k8s.io/api/core/v1"
-	storagev1 "k8s.io/api/storage/v1"
 	extensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
 	"k8s.io/kubectl/pkg/scheme"
 )
 
@@ -25,6 +23,31 @@ func init() {
 }
 
 func Decode(resource string, data []byte) (runtime.Object, *schema.GroupVersionKind, error) {
+	return DecodeWithLogger(resource, data, log.StandardLogger())
+}
+
+// DecodeWithLogger is Decode with the warnings about fallback decoding logged to logger
+func DecodeWithLogger(resource string, data []byte, logger log.FieldLogger) (runtime.Object, *schema.GroupVersionKind, error) {
+	return DecodeWithContext(context.Background(), resource, data, logger)
+}
+
+// DecodeWithContext is DecodeWithLogger that gives up when ctx is done. Every fallback decoding
+// of large files takes long, so ctx is checked before each of them.
+func DecodeWithContext(ctx context.Context, resource string, data []byte, logger log.FieldLogger) (runtime.Object, *schema.GroupVersionKind, error) {
+	decoded, gvk, err := decodeWithLogger(ctx, resource, data, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	SynthesizeMissingMetadata(decoded)
+	return decoded, gvk, nil
+}
+
+func decodeWithLogger(ctx context.Context, resource string, data []byte, logger log.FieldLogger) (runtime.Object, *schema.GroupVersionKind, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, errors.Wrap(err, "decoding canceled")
+	}
+
 	originalData := data
 	decode := scheme.Codecs.UniversalDeserializer().Decode
 	decoded, gvk, err := decode(data, nil, nil)
@@ -32,18 +55,30 @@ func Decode(resource string, data []byte) (runtime.Object, *schema.GroupVersionK
 		return decoded, gvk, nil
 	}
 
-	log.Warn("could not to decode data, will try adding list GVK", err)
+	if err := ctx.Err(); err != nil {
+		return nil, nil, errors.Wrap(err, "decoding canceled")
+	}
+	logger.Warn("could not to decode data, will try adding list GVK", err)
 	data, err = wrapListData(resource, data)
 	if err != nil {
-		log.Warn(err)
+		logger.Warn(err)
 	} else {
 		decoded, gvk, err = decode(data, nil, nil)
 		if err != nil {
-			log.Warn("could not decode wrapped data: ", err)
+			logger.Warn("could not decode wrapped data: ", err)
 		}
 	}
 
 	if decoded == nil {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, errors.Wrap(err, "decoding canceled")
+		}
+
+		// Custom resources can be stored as YAML, which the unstructured decoding below does not understand
+		if jsonData, err := yaml.ToJSON(originalData); err == nil {
+			originalData = jsonData
+		}
+
 		// Try to decode object into an unstructured object
 		var v unstructured.Unstructured
 		err = json.Unmarshal(originalData, &v)
@@ -52,7 +87,7 @@ func Decode(resource string, data []byte) (runtime.Object, *schema.GroupVersionK
 			gvk := o.GetObjectKind().GroupVersionKind()
 			return o, &gvk, nil
 		}
-		log.Warn("could not decode data into an unstructured object: ", err)
+		logger.Warn("could not decode data into an unstructured object: ", err)
 
 		// Try to decode object into an unstructured list
 		var vList []unstructured.Unstructured
@@ -66,193 +101,40 @@ func Decode(resource string, data []byte) (runtime.Object, *schema.GroupVersionK
 			return &list, &gvk, nil
 		}
 		if err != nil {
-			log.Warn("could not decode data into an unstructured list object: ", err)
+			logger.Warn("could not decode data into an unstructured list object: ", err)
 		}
 		return nil, nil, errors.Wrap(err, "could not decode data into a k8s object")
 	}
 
-	switch o := decoded.(type) {
-	case *corev1.EventList:
-		for i := range o.Items {
-			o.Items[i].GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{
-				Kind:    "Event",
-				Version: "v1",
-			})
-		}
-	case *corev1.PodList:
-		for i := range o.Items {
-			o.Items[i].GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{
-				Kind:    "Pod",
-				Version: "v1",
-			})
-		}
-	case *corev1.LimitRangeList:
-		for i := range o.Items {
-			o.Items[i].GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{
-				Kind:    "LimitRange",
-				Version: "v1",
-			})
-		}
-	case *corev1.ServiceList:
-		for i := range o.Items {
-			o.Items[i].GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{
-				Kind:    "Service",
-				Version: "v1",
-			})
-		}
-	case *corev1.NamespaceList:
-		for i := range o.Items {
-			o.Items[i].GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{
-				Kind:    "Namespace",
-				Version: "v1",
-			})
-		}
-	case *corev1.NodeList:
-		for i := range o.Items {
-			o.Items[i].GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{
-				Kind:    "Node",
-				Version: "v1",
-			})
-		}
-	case *corev1.PersistentVolumeList:
-		for i := range o.Items {
-			o.Items[i].GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{
-				Kind:    "PersistentVolume",
-				Version: "v1",
-			})
-		}
-	case *corev1.PersistentVolumeClaimList:
-		for i := range o.Items {
-			o.Items[i].GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{
-				Kind:    "PersistentVolumeClaim",
-				Version: "v1",
-			})
-		}
-	case *batchv1.JobList:
-		for i := range o.Items {
-			o.Items[i].GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{
-				Group:   "batch",
-				Kind:    "Job",
-				Version: "v1",
-			})
-		}
-	case *batchv1beta1.CronJobList:
-		for i := range o.Items {
-			o.Items[i].GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{
-				Group:   "batch",
-				Kind:    "CronJob",
-				Version: "v1beta1",
-			})
-		}
-	case *appsv1.DeploymentList:
-		for i := range o.Items {
-			o.Items[i].GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{
-				Group:   "apps",
-				Kind:    "Deployment",
-				Version: "v1",
-			})
-		}
-	case *appsv1.ReplicaSetList:
-		for i := range o.Items {
-			o.Items[i].GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{
-				Group:   "apps",
-				Kind:    "ReplicaSet",
-				Version: "v1",
-			})
-		}
-	case *appsv1.StatefulSetList:
-		for i := range o.Items {
-			o.Items[i].GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{
-				Group:   "apps",
-				Kind:    "StatefulSet",
-				Version: "v1",
-			})
-		}
-	case *storagev1.StorageClassList:
-		for i := range o.Items {
-			o.Items[i].GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{
-				Group:   "storage.k8s.io",
-				Kind:    "StorageClass",
-				Version: "v1",
-			})
-		}
-	case *extensionsv1.CustomResourceDefinitionList:
-		for i := range o.Items {
-			o.Items[i].GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{
-				Group:   "apiextensions.k8s.io",
-				Kind:    "CustomResourceDefinitionList",
-				Version: "v1",
-			})
-		}
-	case *corev1.ConfigMapList:
-		for i := range o.Items {
-			o.Items[i].GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{
-				Kind:    "ConfigMap",
-				Version: "v1",
-			})
-		}
-	}
+	setListItemKinds(decoded, gvk)
 
 	return decoded, gvk, nil
 }
 
+// setListItemKinds sets the kinds of the items of a typed list, which the deserializer leaves
+// empty, from the kind of the list
+func setListItemKinds(list runtime.Object, gvk *schema.GroupVersionKind) {
+	if gvk == nil || !meta.IsListType(list) {
+		return
+	}
+	itemKind, ok := DefaultRESTMapper().ListItemKind(*gvk)
+	if !ok {
+		return
+	}
+	_ = meta.EachListItem(list, func(item runtime.Object) error {
+		item.GetObjectKind().SetGroupVersionKind(itemKind)
+		return nil
+	})
+}
+
+// wrapListData makes a List of a JSON array of objects, which older bundles store resources as
 func wrapListData(resource string, data []byte) ([]byte, error) {
-	var kind, apiVersion string
-	switch resource {
-	case "pods":
-		kind = "PodList"
-		apiVersion = "v1"
-	case "events":
-		kind = "EventList"
-		apiVersion = "v1"
-	case "cronjobs":
-		kind = "CronJobList"
-		apiVersion = "batch/v1beta1"
-	case "deployments":
-		kind = "DeploymentList"
-		apiVersion = "apps/v1"
-	case "ingress", "ingresses":
-		kind = "IngressList"
-		apiVersion = "networking.k8s.io/v1"
-	case "jobs":
-		kind = "JobList"
-		apiVersion = "batch/v1"
-	case "limitranges":
-		kind = "LimitRangeList"
-		apiVersion = "v1"
-	case "pvcs":
-		kind = "PersistentVolumeClaimList"
-		apiVersion = "v1"
-	case "replicasets":
-		kind = "ReplicaSetList"
-		apiVersion = "apps/v1"
-	case "services":
-		kind = "ServiceList"
-		apiVersion = "v1"
-	case "statefulsets":
-		kind = "StatefulSetList"
-		apiVersion = "apps/v1"
-	case "namespaces":
-		kind = "NamespaceList"
-		apiVersion = "v1"
-	case "nodes":
-		kind = "NodeList"
-		apiVersion = "v1"
-	case "persistentvolumes":
-		kind = "PersistentVolumeList"
-		apiVersion = "v1"
-	case "persistentvolumeclaims":
-		kind = "PersistentVolumeClaimList"
-		apiVersion = "v1"
-	case "storageclasses":
-		kind = "StorageClassList"
-		apiVersion = "storage.k8s.io/v1"
-	case "customresourcedefinitions":
-		kind = "CustomResourceDefinitionList"
-		apiVersion = "apiextensions.k8s.io/v1"
-	default:
+	gvk, err := DefaultRESTMapper().KindFor(schema.GroupVersionResource{Resource: ResourceForFileName(resource)})
+	if err != nil {
 		return nil, errors.Errorf("don't know how to wrap %s", resource)
 	}
+	kind := gvk.Kind + "List"
+	apiVersion := gvk.GroupVersion().String()
 
 	return []byte(fmt.Sprintf(`{
 		"kind": "%s",
@@ -0,0 +1,145 @@
+package sbctl
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// CrashLoop is a container in CrashLoopBackOff
+type CrashLoop struct {
+	Node      string `json:"node,omitempty"`
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Container string `json:"container"`
+	Restarts  int32  `json:"restarts"`
+	// Message is the message of the waiting state, with the back-off delay
+	Message string `json:"message,omitempty"`
+	// LastReason, LastExitCode, and LastFinished are the termination of the last run of the
+	// container
+	LastReason   string    `json:"lastReason,omitempty"`
+	LastExitCode int32     `json:"lastExitCode"`
+	LastSignal   int32     `json:"lastSignal,omitempty"`
+	LastMessage  string    `json:"lastMessage,omitempty"`
+	LastFinished time.Time `json:"lastFinished,omitempty"`
+	// Events are the reasons of the warning events of the pod with their counts, e.g. failed
+	// liveness probes restarting the container
+	Events []CrashLoopEvent `json:"events,omitempty"`
+	// LogFile is the log of the last run of the container, relative to the cluster resources
+	// directory, or empty when it was not collected
+	LogFile string `json:"logFile,omitempty"`
+}
+
+// CrashLoopEvent is the reason of warning events of a pod, and how often they were reported
+type CrashLoopEvent struct {
+	Reason  string `json:"reason"`
+	Count   int32  `json:"count"`
+	Message string `json:"message,omitempty"`
+}
+
+// FindCrashLoops lists containers in CrashLoopBackOff with how their last run terminated, the
+// warning events of their pods, and the log of their last run, most restarted first
+func FindCrashLoops(clusterData ClusterData) ([]CrashLoop, error) {
+	pods, err := ListTypedResources[corev1.Pod](clusterData, "", "pods")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list pods")
+	}
+	events, err := ListTypedResources[corev1.Event](clusterData, "", "events")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list events")
+	}
+
+	crashLoops := []CrashLoop{}
+	for _, pod := range pods {
+		statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+		for _, status := range statuses {
+			if status.State.Waiting == nil || status.State.Waiting.Reason != "CrashLoopBackOff" {
+				continue
+			}
+			crashLoop := CrashLoop{
+				Node:      pod.Spec.NodeName,
+				Namespace: pod.Namespace,
+				Pod:       pod.Name,
+				Container: status.Name,
+				Restarts:  status.RestartCount,
+				Message:   status.State.Waiting.Message,
+				Events:    crashLoopEvents(events, pod),
+				LogFile:   lastRunLogFile(clusterData, pod, status.Name),
+			}
+			if terminated := status.LastTerminationState.Terminated; terminated != nil {
+				crashLoop.LastReason = terminated.Reason
+				crashLoop.LastExitCode = terminated.ExitCode
+				crashLoop.LastSignal = terminated.Signal
+				crashLoop.LastMessage = terminated.Message
+				crashLoop.LastFinished = terminated.FinishedAt.Time
+			}
+			crashLoops = append(crashLoops, crashLoop)
+		}
+	}
+
+	sort.SliceStable(crashLoops, func(i, j int) bool {
+		if crashLoops[i].Restarts != crashLoops[j].Restarts {
+			return crashLoops[i].Restarts > crashLoops[j].Restarts
+		}
+		return fmt.Sprintf("%s/%s/%s", crashLoops[i].Namespace, crashLoops[i].Pod, crashLoops[i].Container) <
+			fmt.Sprintf("%s/%s/%s", crashLoops[j].Namespace, crashLoops[j].Pod, crashLoops[j].Container)
+	})
+	return crashLoops, nil
+}
+
+// crashLoopEvents sums the counts of the warning events of a pod by reason, most frequent first,
+// keeping the message of the latest event of each reason
+func crashLoopEvents(events []corev1.Event, pod corev1.Pod) []CrashLoopEvent {
+	byReason := map[string]*CrashLoopEvent{}
+	latest := map[string]time.Time{}
+	for _, event := range events {
+		if event.Type != corev1.EventTypeWarning || event.InvolvedObject.Kind != "Pod" ||
+			event.InvolvedObject.Namespace != pod.Namespace || event.InvolvedObject.Name != pod.Name {
+			continue
+		}
+		count := event.Count
+		if count < 1 {
+			count = 1
+		}
+		e, ok := byReason[event.Reason]
+		if !ok {
+			e = &CrashLoopEvent{Reason: event.Reason}
+			byReason[event.Reason] = e
+		}
+		e.Count += count
+		if t := event.LastTimestamp.Time; !ok || t.After(latest[event.Reason]) {
+			e.Message = event.Message
+			latest[event.Reason] = t
+		}
+	}
+
+	result := []CrashLoopEvent{}
+	for _, e := range byReason {
+		result = append(result, *e)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Reason < result[j].Reason
+	})
+	return result
+}
+
+// lastRunLogFile returns the log of the container's previous run, which is the run that crashed,
+// or else its current log, relative to the cluster resources directory
+func lastRunLogFile(clusterData ClusterData, pod corev1.Pod, container string) string {
+	for _, name := range []string{container + "-previous.log", container + ".log"} {
+		relPath := path.Join("pods", "logs", pod.Namespace, pod.Name, name)
+		if _, err := os.Stat(filepath.Join(clusterData.ClusterResourcesDir, filepath.FromSlash(relPath))); err == nil {
+			return relPath
+		}
+	}
+	return ""
+}
@@ -0,0 +1,64 @@
+package sbctl
+
+import (
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// GatewayAPIGroup is the group of the Gateway API, which Kubernetes ships as CRDs
+	GatewayAPIGroup = "gateway.networking.k8s.io"
+	// KarpenterGroup and KarpenterAWSGroup are the groups of Karpenter's node pools and claims,
+	// and of its AWS node classes
+	KarpenterGroup    = "karpenter.sh"
+	KarpenterAWSGroup = "karpenter.k8s.aws"
+	// AutoscalingGroup is the group of cluster-autoscaler's ProvisioningRequests
+	AutoscalingGroup = "autoscaling.x-k8s.io"
+)
+
+// wellKnownCRDGroups are the groups of CRDs sbctl serves even when the discovery data of a bundle
+// does not list them, as long as the bundle has their objects
+var wellKnownCRDGroups = []string{GatewayAPIGroup, KarpenterGroup, KarpenterAWSGroup, AutoscalingGroup}
+
+// IsWellKnownCRDGroup returns true for the groups of CRDs sbctl knows the resources of
+func IsWellKnownCRDGroup(group string) bool {
+	return containsString(wellKnownCRDGroups, group)
+}
+
+// WellKnownCRDResources returns discovery data of the resources of well-known CRDs that have
+// objects in the bundle, for serving them when the bundle's own discovery data does not list them
+func WellKnownCRDResources(clusterData ClusterData) ([]metav1.APIResourceList, error) {
+	lists := []metav1.APIResourceList{}
+	index := map[string]int{}
+	for _, b := range builtinResources {
+		gv, err := schema.ParseGroupVersion(b.GroupVersion)
+		if err != nil || !IsWellKnownCRDGroup(gv.Group) {
+			continue
+		}
+		files, err := FindResourceFiles(clusterData, gv.Group, b.Resource)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			continue
+		}
+
+		i, ok := index[b.GroupVersion]
+		if !ok {
+			i = len(lists)
+			index[b.GroupVersion] = i
+			lists = append(lists, metav1.APIResourceList{GroupVersion: b.GroupVersion})
+		}
+		lists[i].APIResources = append(lists[i].APIResources, metav1.APIResource{
+			Name:         b.Resource,
+			SingularName: strings.ToLower(b.Kind),
+			Namespaced:   b.Namespaced,
+			Kind:         b.Kind,
+			Verbs:        metav1.Verbs{"get", "list", "watch"},
+			ShortNames:   b.ShortNames,
+		})
+	}
+	return lists, nil
+}
@@ -0,0 +1,80 @@
+package sbctl
+
+import (
+	"context"
+	"runtime"
+	"sync"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// DecodeWorkers is the number of files ReadResourceFiles decodes at the same time
+var DecodeWorkers = runtime.GOMAXPROCS(0)
+
+// ResourceFile is a file that stores objects of a resource
+type ResourceFile struct {
+	Name     string
+	Resource string
+}
+
+// ReadResourceFiles reads the objects of many files concurrently, see ReadResourceFile. The objects
+// are returned in the order of the files. A file that fails to decode, even with a panic in a
+// decoder, fails the whole read with the error of the first such file.
+func ReadResourceFiles(files []ResourceFile) ([][]unstructured.Unstructured, error) {
+	return ReadResourceFilesContext(context.Background(), files)
+}
+
+// ReadResourceFilesContext is ReadResourceFiles that stops reading files when ctx is done
+func ReadResourceFilesContext(ctx context.Context, files []ResourceFile) ([][]unstructured.Unstructured, error) {
+	results := make([][]unstructured.Unstructured, len(files))
+	errs := make([]error, len(files))
+
+	workers := DecodeWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(files) {
+		workers = len(files)
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if err := ctx.Err(); err != nil {
+					errs[i] = errors.Wrap(err, "reading canceled")
+					continue
+				}
+				results[i], errs[i] = readResourceFileRecover(ctx, files[i])
+			}
+		}()
+	}
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// readResourceFileRecover turns panics of decoders on malformed files into errors, so that one
+// file cannot take down the process
+func readResourceFileRecover(ctx context.Context, file ResourceFile) (items []unstructured.Unstructured, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			items = nil
+			err = errors.Errorf("failed to decode %s: panic: %v", file.Name, r)
+		}
+	}()
+	return readResourceFile(ctx, file.Name, file.Resource)
+}
@@ -0,0 +1,164 @@
+package sbctl
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// OverlayBundles writes the files of base to outDir, then overlays the files of deltas, bundles
+// collected later that only have what changed since. Deltas are given oldest first. When a delta
+// has a file that is in the bundle already, objects of lists in both files are merged by
+// namespace and name, with the objects of the delta shadowing older ones, and other files are
+// replaced. Objects are never removed by a delta. It returns the cluster data of outDir.
+func OverlayBundles(base ClusterData, deltas []ClusterData, outDir string) (ClusterData, error) {
+	if base.ClusterResourcesDir == "" {
+		return ClusterData{}, errors.Errorf("bundle in %s has no cluster-resources directory", base.BundleDir)
+	}
+	if err := copyDir(filepath.Dir(base.ClusterResourcesDir), outDir); err != nil {
+		return ClusterData{}, errors.Wrap(err, "failed to copy base bundle")
+	}
+
+	for _, delta := range deltas {
+		if delta.ClusterResourcesDir == "" {
+			return ClusterData{}, errors.Errorf("delta bundle in %s has no cluster-resources directory", delta.BundleDir)
+		}
+		root := filepath.Dir(delta.ClusterResourcesDir)
+
+		err := filepath.Walk(root, func(filename string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(root, filename)
+			if err != nil {
+				return err
+			}
+			dst := filepath.Join(outDir, rel)
+			if info.IsDir() {
+				return os.MkdirAll(dst, 0755)
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+
+			data, err := os.ReadFile(filename)
+			if err != nil {
+				return errors.Wrapf(err, "failed to read %s", filename)
+			}
+			if filepath.Ext(filename) == ".json" {
+				existing, err := os.ReadFile(dst)
+				if err != nil && !os.IsNotExist(err) {
+					return errors.Wrapf(err, "failed to read %s", dst)
+				}
+				if merged, ok := overlayObjects(existing, data); ok {
+					data = merged
+				}
+			}
+			if err := os.WriteFile(dst, data, 0644); err != nil {
+				return errors.Wrapf(err, "failed to write %s", dst)
+			}
+			return os.Chtimes(dst, info.ModTime(), info.ModTime())
+		})
+		if err != nil {
+			return ClusterData{}, errors.Wrapf(err, "failed to overlay %s", delta.BundleDir)
+		}
+	}
+
+	return FindClusterData(outDir)
+}
+
+// overlayObjects merges the objects of the lists in older and newer, which are either lists
+// with items or arrays of objects. Objects of newer replace the objects of older with the same
+// namespace and name, in place, and the other objects of newer are appended. False is returned
+// when either file is not such a list.
+func overlayObjects(older []byte, newer []byte) ([]byte, bool) {
+	olderList, olderItems, ok := decodeObjectList(older)
+	if !ok {
+		return nil, false
+	}
+	newerList, newerItems, ok := decodeObjectList(newer)
+	if !ok {
+		return nil, false
+	}
+
+	index := map[string]int{}
+	for i, item := range olderItems {
+		index[objectKey(item)] = i
+	}
+	items := olderItems
+	for _, item := range newerItems {
+		key := objectKey(item)
+		if i, ok := index[key]; ok {
+			items[i] = item
+			continue
+		}
+		index[key] = len(items)
+		items = append(items, item)
+	}
+
+	// The list of the delta has the newer list metadata, such as the resource version
+	var out interface{} = items
+	if newerList != nil {
+		newerList["items"] = items
+		out = newerList
+	} else if olderList != nil {
+		olderList["items"] = items
+		out = olderList
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// decodeObjectList decodes a list with items, which is returned with them, or an array of
+// objects
+func decodeObjectList(data []byte) (map[string]interface{}, []map[string]interface{}, bool) {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, nil, false
+	}
+
+	var list map[string]interface{}
+	var rawItems []interface{}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		raw, found := v["items"]
+		if !found {
+			return nil, nil, false
+		}
+		// Empty lists have null items
+		items, ok := raw.([]interface{})
+		if !ok && raw != nil {
+			return nil, nil, false
+		}
+		list, rawItems = v, items
+	case []interface{}:
+		rawItems = v
+	default:
+		return nil, nil, false
+	}
+
+	items := make([]map[string]interface{}, 0, len(rawItems))
+	for _, rawItem := range rawItems {
+		item, ok := rawItem.(map[string]interface{})
+		if !ok {
+			return nil, nil, false
+		}
+		if _, ok := item["metadata"].(map[string]interface{}); !ok {
+			return nil, nil, false
+		}
+		items = append(items, item)
+	}
+	return list, items, true
+}
+
+func objectKey(item map[string]interface{}) string {
+	metadata := item["metadata"].(map[string]interface{})
+	namespace, _ := metadata["namespace"].(string)
+	name, _ := metadata["name"].(string)
+	return namespace + "/" + name
+}
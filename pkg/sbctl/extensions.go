@@ -0,0 +1,166 @@
+package sbctl
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// ExtensionsFileName is the manifest vendors include in bundles to declare virtual resources
+const ExtensionsFileName = "sbctl-extensions.yaml"
+
+// SourceFileAnnotation is set on virtual resource objects to the bundle file they were read from
+const SourceFileAnnotation = "sbctl.replicated.com/source-file"
+
+var invalidObjectNameChars = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+type Extensions struct {
+	Resources []VirtualResource `json:"resources"`
+}
+
+// VirtualResource is a resource that does not exist in the cluster, computed from files collected
+// in the bundle, such as a JSON report collected by a vendor's collector
+type VirtualResource struct {
+	Group   string `json:"group"`
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+	// Resource is the plural name, e.g. backupreports
+	Resource   string                  `json:"resource"`
+	ShortNames []string                `json:"shortNames,omitempty"`
+	Namespaced bool                    `json:"namespaced,omitempty"`
+	Columns    []VirtualResourceColumn `json:"columns,omitempty"`
+	Sources    []VirtualResourceSource `json:"sources"`
+}
+
+// VirtualResourceColumn is an additional column shown by kubectl get, like the
+// additionalPrinterColumns of a CRD
+type VirtualResourceColumn struct {
+	Name     string `json:"name"`
+	Type     string `json:"type,omitempty"`
+	JSONPath string `json:"jsonPath"`
+}
+
+// VirtualResourceSource turns each file matching Files into an object
+type VirtualResourceSource struct {
+	// Files is a glob relative to the directory of the manifest
+	Files string `json:"files"`
+	// Name of the object. The file name without its extension is used when empty.
+	Name      string `json:"name,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	// Field the file contents are stored in, spec when empty
+	Field       string            `json:"field,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ReadExtensions returns the virtual resources declared in the bundle. Bundles without
+// sbctl-extensions.yaml have none.
+func ReadExtensions(clusterData ClusterData) ([]VirtualResource, error) {
+	if clusterData.ExtensionsFile == "" {
+		return []VirtualResource{}, nil
+	}
+
+	data, err := os.ReadFile(clusterData.ExtensionsFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read extensions file")
+	}
+
+	extensions := Extensions{}
+	if err := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), len(data)).Decode(&extensions); err != nil {
+		return nil, errors.Wrap(err, "failed to decode extensions file")
+	}
+
+	for i, r := range extensions.Resources {
+		if r.Version == "" || r.Kind == "" || r.Resource == "" {
+			return nil, errors.Errorf("resource %d needs a version, kind and resource", i+1)
+		}
+		if r.Group == "" {
+			return nil, errors.Errorf("resource %s needs a group, the core group is reserved", r.Resource)
+		}
+	}
+
+	return extensions.Resources, nil
+}
+
+// Objects reads the files of the resource's sources. baseDir is the directory of the manifest.
+func (r VirtualResource) Objects(baseDir string) ([]unstructured.Unstructured, error) {
+	objects := []unstructured.Unstructured{}
+	for _, source := range r.Sources {
+		fileNames, err := filepath.Glob(filepath.Join(baseDir, source.Files))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid files pattern %q", source.Files)
+		}
+		sort.Strings(fileNames)
+
+		for _, fileName := range fileNames {
+			obj, err := r.object(source, fileName, baseDir)
+			if err != nil {
+				return nil, err
+			}
+			objects = append(objects, *obj)
+		}
+	}
+	return objects, nil
+}
+
+func (r VirtualResource) object(source VirtualResourceSource, fileName string, baseDir string) (*unstructured.Unstructured, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read source file")
+	}
+
+	var content interface{}
+	if err := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), len(data)).Decode(&content); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode %s", fileName)
+	}
+
+	field := source.Field
+	if field == "" {
+		field = "spec"
+	}
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		field: content,
+	}}
+	obj.SetAPIVersion(r.Group + "/" + r.Version)
+	obj.SetKind(r.Kind)
+
+	name := source.Name
+	if name == "" {
+		base := strings.TrimSuffix(filepath.Base(fileName), filepath.Ext(fileName))
+		name = strings.Trim(invalidObjectNameChars.ReplaceAllString(strings.ToLower(base), "-"), "-.")
+	}
+	obj.SetName(name)
+	if r.Namespaced {
+		namespace := source.Namespace
+		if namespace == "" {
+			namespace = "default"
+		}
+		obj.SetNamespace(namespace)
+	}
+	if len(source.Labels) > 0 {
+		obj.SetLabels(source.Labels)
+	}
+
+	annotations := map[string]string{}
+	for k, v := range source.Annotations {
+		annotations[k] = v
+	}
+	if rel, err := filepath.Rel(baseDir, fileName); err == nil {
+		annotations[SourceFileAnnotation] = rel
+	}
+	obj.SetAnnotations(annotations)
+
+	if info, err := os.Stat(fileName); err == nil {
+		obj.SetCreationTimestamp(metav1.NewTime(info.ModTime()))
+	}
+
+	return obj, nil
+}
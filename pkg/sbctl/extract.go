@@ -0,0 +1,129 @@
+package sbctl
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ExtractFiles extracts the files of a bundle archive that match patterns into outDir, keeping
+// their paths in the archive, and returns the names of the extracted files. Patterns are
+// path.Match patterns relative to the archive, or to the top directory of the bundle in it, and
+// a pattern that matches a directory extracts everything below it. Gzipped archives cannot be
+// read from an offset, so the archive is read once from the start, but only matching files are
+// written, and reading stops when every pattern without wildcards found its file.
+func ExtractFiles(filename string, patterns []string, outDir string) ([]string, error) {
+	literal := map[string]bool{}
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.Wrapf(err, "invalid pattern %q", pattern)
+		}
+		if !strings.ContainsAny(pattern, `*?[\`) {
+			literal[path.Clean(pattern)] = false
+		}
+	}
+	allLiteral := len(literal) == len(patterns)
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open input file")
+	}
+	defer f.Close()
+
+	gzf, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get new gzip reader")
+	}
+	tarReader := tar.NewReader(gzf)
+
+	extracted := []string{}
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return extracted, errors.Wrap(err, "failed to read tar header")
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := path.Clean(strings.TrimPrefix(header.Name, "./"))
+		matched, exact := matchExtractPatterns(patterns, name)
+		if !matched {
+			continue
+		}
+		if !filepath.IsLocal(filepath.FromSlash(name)) {
+			return extracted, errors.Errorf("archive has file outside of it: %s", header.Name)
+		}
+
+		outFilename := filepath.Join(outDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(outFilename), 0755); err != nil {
+			return extracted, errors.Wrap(err, "failed to create file path")
+		}
+		outFile, err := os.Create(outFilename)
+		if err != nil {
+			return extracted, errors.Wrap(err, "failed to create output file")
+		}
+		_, err = io.Copy(outFile, tarReader) // nolint: gosec // ignore decompression bombs
+		outFile.Close()
+		if err != nil {
+			return extracted, errors.Wrap(err, "failed to copy file")
+		}
+		extracted = append(extracted, name)
+
+		if exact != "" {
+			literal[exact] = true
+		}
+		if allLiteral && allFound(literal) {
+			break
+		}
+	}
+
+	return extracted, nil
+}
+
+// matchExtractPatterns returns whether name, or one of its directories, matches one of the
+// patterns, with or without its top directory. When a pattern without wildcards is the name of
+// the file, it is returned too.
+func matchExtractPatterns(patterns []string, name string) (bool, string) {
+	candidates := []string{name}
+	if i := strings.Index(name, "/"); i >= 0 {
+		candidates = append(candidates, name[i+1:])
+	}
+
+	matched := false
+	for _, candidate := range candidates {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, candidate); ok {
+				if path.Clean(pattern) == candidate {
+					return true, candidate
+				}
+				matched = true
+				continue
+			}
+			for dir := path.Dir(candidate); dir != "."; dir = path.Dir(dir) {
+				if ok, _ := path.Match(strings.TrimSuffix(pattern, "/"), dir); ok {
+					matched = true
+					break
+				}
+			}
+		}
+	}
+	return matched, ""
+}
+
+func allFound(found map[string]bool) bool {
+	for _, ok := range found {
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
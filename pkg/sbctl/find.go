@@ -0,0 +1,253 @@
+package sbctl
+
+import (
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// CollectedResource is a resource listed in resources.json with the objects the bundle has of it
+type CollectedResource struct {
+	Group      string
+	Version    string
+	Resource   string
+	Kind       string
+	Namespaced bool
+	ShortNames []string
+	Items      []unstructured.Unstructured
+	// Files are the files items were read from, Files[i] is the file of Items[i]. They are not set
+	// for indexed resources.
+	Files []string
+}
+
+// ListCollectedResources reads every collected resource listed in resources.json. Resources
+// served in several versions are only read once.
+func ListCollectedResources(clusterData ClusterData) ([]CollectedResource, error) {
+	apiResources, err := ListAPIResources(clusterData)
+	if err != nil {
+		return nil, err
+	}
+	return ReadCollectedResources(clusterData, apiResources)
+}
+
+// ReadCollectedResources reads the objects the bundle has of the given resources, e.g. of well
+// known resources for bundles without resources.json. Subresources are skipped. All files are
+// decoded in one go, which is what takes most of the time for large bundles.
+func ReadCollectedResources(clusterData ClusterData, apiResources []metav1.APIResourceList) ([]CollectedResource, error) {
+	type resourceFiles struct {
+		resource CollectedResource
+		first    int
+		last     int
+	}
+
+	resources := []resourceFiles{}
+	files := []ResourceFile{}
+	listed := map[schema.GroupResource]bool{}
+	for _, list := range apiResources {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			continue
+		}
+		for _, r := range list.APIResources {
+			gr := schema.GroupResource{Group: gv.Group, Resource: r.Name}
+			if strings.Contains(r.Name, "/") || listed[gr] {
+				continue
+			}
+			listed[gr] = true
+
+			fileNames, err := FindResourceFiles(clusterData, gv.Group, r.Name)
+			if err != nil {
+				return nil, err
+			}
+
+			rf := resourceFiles{
+				resource: CollectedResource{
+					Group:      gv.Group,
+					Version:    gv.Version,
+					Resource:   r.Name,
+					Kind:       r.Kind,
+					Namespaced: r.Namespaced,
+					ShortNames: r.ShortNames,
+					Items:      []unstructured.Unstructured{},
+					Files:      []string{},
+				},
+				first: len(files),
+			}
+			for _, fileName := range fileNames {
+				files = append(files, ResourceFile{Name: fileName, Resource: r.Name})
+			}
+			rf.last = len(files)
+			resources = append(resources, rf)
+		}
+	}
+
+	decoded, err := ReadResourceFiles(files)
+	if err != nil {
+		return nil, err
+	}
+
+	collected := make([]CollectedResource, 0, len(resources))
+	for _, rf := range resources {
+		r := rf.resource
+		for i := rf.first; i < rf.last; i++ {
+			for _, item := range decoded[i] {
+				// Resources of another group with the same name can read the same files
+				if item.GetKind() != "" && item.GetKind() != r.Kind {
+					continue
+				}
+				r.Items = append(r.Items, item)
+				r.Files = append(r.Files, files[i].Name)
+			}
+		}
+		collected = append(collected, r)
+	}
+
+	return collected, nil
+}
+
+// FindQuery selects objects across resources. Empty fields match everything.
+type FindQuery struct {
+	// Resources are resource names, resource.group names or kinds, compared ignoring case
+	Resources []string
+	Namespace string
+	// Name is a glob pattern such as velero-*, or a substring when it has no wildcards
+	Name        string
+	Labels      labels.Selector
+	Annotations []AnnotationRequirement
+}
+
+// ParseFindQuery builds a query from label and annotation selectors in the kubectl syntax, e.g.
+// app=foo,tier!=db. Annotation selectors only support =, != and existence, since annotation
+// values are not restricted like label values.
+func ParseFindQuery(resources []string, namespace string, name string, labelSelector string, annotationSelector string) (FindQuery, error) {
+	query := FindQuery{Resources: resources, Namespace: namespace, Name: name, Labels: labels.Everything()}
+
+	if name != "" {
+		if _, err := path.Match(name, ""); err != nil {
+			return query, errors.Wrapf(err, "invalid name pattern %q", name)
+		}
+	}
+
+	if labelSelector != "" {
+		selector, err := labels.Parse(labelSelector)
+		if err != nil {
+			return query, errors.Wrap(err, "invalid label selector")
+		}
+		query.Labels = selector
+	}
+
+	if annotationSelector != "" {
+		requirements, err := parseAnnotationSelector(annotationSelector)
+		if err != nil {
+			return query, errors.Wrap(err, "invalid annotation selector")
+		}
+		query.Annotations = requirements
+	}
+
+	return query, nil
+}
+
+// AnnotationRequirement is a requirement of an annotation selector
+type AnnotationRequirement struct {
+	Key      string
+	Operator selection.Operator
+	Value    string
+}
+
+// Matches returns whether annotations meet the requirement
+func (r AnnotationRequirement) Matches(annotations map[string]string) bool {
+	value, ok := annotations[r.Key]
+	switch r.Operator {
+	case selection.Exists:
+		return ok
+	case selection.DoesNotExist:
+		return !ok
+	case selection.Equals:
+		return ok && value == r.Value
+	case selection.NotEquals:
+		return !ok || value != r.Value
+	}
+	return false
+}
+
+// parseAnnotationSelector parses key, !key, key=value and key!=value requirements without
+// validating values, which labels.Parse would reject for most annotations
+func parseAnnotationSelector(selector string) ([]AnnotationRequirement, error) {
+	requirements := []AnnotationRequirement{}
+	for _, part := range strings.Split(selector, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		var r AnnotationRequirement
+		switch {
+		case strings.Contains(part, "!="):
+			kv := strings.SplitN(part, "!=", 2)
+			r = AnnotationRequirement{Key: kv[0], Operator: selection.NotEquals, Value: kv[1]}
+		case strings.Contains(part, "="):
+			kv := strings.SplitN(strings.Replace(part, "==", "=", 1), "=", 2)
+			r = AnnotationRequirement{Key: kv[0], Operator: selection.Equals, Value: kv[1]}
+		case strings.HasPrefix(part, "!"):
+			r = AnnotationRequirement{Key: part[1:], Operator: selection.DoesNotExist}
+		default:
+			r = AnnotationRequirement{Key: part, Operator: selection.Exists}
+		}
+		r.Key = strings.TrimSpace(r.Key)
+		if r.Key == "" {
+			return nil, errors.Errorf("missing key in %q", part)
+		}
+		requirements = append(requirements, r)
+	}
+	return requirements, nil
+}
+
+// MatchesResource returns whether the query selects objects of a resource
+func (q FindQuery) MatchesResource(group string, resource string, kind string) bool {
+	if len(q.Resources) == 0 {
+		return true
+	}
+	for _, r := range q.Resources {
+		if strings.EqualFold(r, resource) || strings.EqualFold(r, kind) || (group != "" && strings.EqualFold(r, resource+"."+group)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches returns whether an object is selected by the query, not taking its resource into account
+func (q FindQuery) Matches(o unstructured.Unstructured) bool {
+	if q.Namespace != "" && o.GetNamespace() != q.Namespace {
+		return false
+	}
+	if q.Name != "" && !MatchesNamePattern(q.Name, o.GetName()) {
+		return false
+	}
+	if q.Labels != nil && !q.Labels.Matches(labels.Set(o.GetLabels())) {
+		return false
+	}
+	for _, r := range q.Annotations {
+		if !r.Matches(o.GetAnnotations()) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchesNamePattern matches a name against a glob pattern, or a substring when the pattern has no
+// wildcards, ignoring case
+func MatchesNamePattern(pattern string, name string) bool {
+	name = strings.ToLower(name)
+	pattern = strings.ToLower(pattern)
+	if strings.ContainsAny(pattern, "*?[") {
+		matched, _ := path.Match(pattern, name)
+		return matched
+	}
+	return strings.Contains(name, pattern)
+}
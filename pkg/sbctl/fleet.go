@@ -0,0 +1,93 @@
+package sbctl
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultClusterName is the name of the cluster at the root of a fleet bundle, usually the
+// management cluster, and the context name of bundles of one cluster
+const DefaultClusterName = "default"
+
+// FleetCluster is one of the clusters of a bundle collected from several clusters, e.g. a
+// management cluster and its workload clusters
+type FleetCluster struct {
+	// Name is the path of the cluster's directory relative to the shallowest cluster in the
+	// bundle, with slashes replaced by dashes, or DefaultClusterName for that cluster
+	Name        string
+	ClusterData ClusterData
+}
+
+// FindFleetClusters returns the clusters of a bundle, one for each cluster-resources directory
+// that is not inside another one, shallowest first. Bundles of one cluster have one.
+func FindFleetClusters(bundlePath string) ([]FleetCluster, error) {
+	roots := []string{}
+	err := filepath.Walk(bundlePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == "cluster-resources" {
+			roots = append(roots, filepath.Dir(path))
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to walk bundle dir")
+	}
+	if len(roots) == 0 {
+		return []FleetCluster{}, nil
+	}
+
+	sort.SliceStable(roots, func(i, j int) bool {
+		di, dj := strings.Count(roots[i], string(filepath.Separator)), strings.Count(roots[j], string(filepath.Separator))
+		if di != dj {
+			return di < dj
+		}
+		return roots[i] < roots[j]
+	})
+
+	// Names are relative to the shallowest cluster when it contains the others, so that the top
+	// directory of the archive is not part of every name
+	top := roots[0]
+	for _, root := range roots[1:] {
+		if !isSubPath(top, root) {
+			top = bundlePath
+			break
+		}
+	}
+
+	clusters := []FleetCluster{}
+	for _, root := range roots {
+		clusterData, err := FindClusterData(root)
+		if err != nil {
+			return nil, err
+		}
+		// The walk also found the files of clusters nested in this one
+		clusterData.ClusterInfoFile = ""
+		if fileName := filepath.Join(root, "cluster-info", "cluster_version.json"); fileExists(fileName) {
+			clusterData.ClusterInfoFile = fileName
+		}
+
+		name := DefaultClusterName
+		if rel, err := filepath.Rel(top, root); err == nil && rel != "." {
+			name = strings.ReplaceAll(filepath.ToSlash(rel), "/", "-")
+		}
+		clusters = append(clusters, FleetCluster{Name: name, ClusterData: clusterData})
+	}
+	return clusters, nil
+}
+
+func isSubPath(dir string, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func fileExists(fileName string) bool {
+	info, err := os.Stat(fileName)
+	return err == nil && !info.IsDir()
+}
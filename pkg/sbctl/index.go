@@ -0,0 +1,380 @@
+package sbctl
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// IndexFileName is the name of the index of a bundle directory. The index of a bundle archive is
+// next to the archive, named after it with this suffix, e.g. bundle.tar.gz.sbctl-index.
+const IndexFileName = ".sbctl-index"
+
+// indexVersion is increased when the index format changes, so older indexes are rebuilt
+const indexVersion = 2
+
+// indexLineInterval is how many lines of a log are between the offsets the index records
+const indexLineInterval = 10000
+
+// BundleIndex is what sbctl learns about a bundle by reading all of its resources and logs. It is
+// saved next to the bundle the first time the bundle is loaded, so later loads of the same bundle
+// can list and search objects, find log lines and query audit events without reading every file
+// again.
+type BundleIndex struct {
+	Version int `json:"version"`
+	// Source identifies the archive or directory the index was built from, so that the index of
+	// an earlier version of a bundle is not used
+	Source    IndexSource       `json:"source"`
+	Created   time.Time         `json:"created"`
+	Resources []IndexedResource `json:"resources"`
+	Logs      []IndexedLog      `json:"logs"`
+	// Audit has the events of the audit logs, sorted by the time requests were received
+	Audit []IndexedAuditEvent `json:"audit"`
+
+	logs map[string]int
+}
+
+// IndexSource is the size and modification time of a bundle archive, or the total size and
+// latest modification time of the files of a bundle directory
+type IndexSource struct {
+	Size    int64     `json:"size"`
+	Files   int       `json:"files"`
+	ModTime time.Time `json:"modTime"`
+}
+
+type IndexedResource struct {
+	Group      string          `json:"group"`
+	Version    string          `json:"version"`
+	Resource   string          `json:"resource"`
+	Kind       string          `json:"kind"`
+	Namespaced bool            `json:"namespaced"`
+	Objects    []IndexedObject `json:"objects"`
+}
+
+// IndexedObject has the metadata of an object that objects are selected by
+type IndexedObject struct {
+	Namespace   string            `json:"namespace,omitempty"`
+	Name        string            `json:"name"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// IndexedLog describes a container log of the bundle
+type IndexedLog struct {
+	// Path is relative to the cluster-resources directory, with slashes
+	Path  string `json:"path"`
+	Size  int64  `json:"size"`
+	Lines int64  `json:"lines"`
+	// Offsets are the offsets of every indexLineInterval-th line, starting with the first
+	Offsets        []int64    `json:"offsets"`
+	FirstTimestamp *time.Time `json:"firstTimestamp,omitempty"`
+	LastTimestamp  *time.Time `json:"lastTimestamp,omitempty"`
+}
+
+// LineOffset returns the offset of the first line to read so that the last tail lines of the
+// log are read, and the number of lines to skip from there
+func (l IndexedLog) LineOffset(tail int64) (int64, int64) {
+	first := l.Lines - tail
+	if first <= 0 || len(l.Offsets) == 0 {
+		return 0, 0
+	}
+	checkpoint := first / indexLineInterval
+	if checkpoint >= int64(len(l.Offsets)) {
+		checkpoint = int64(len(l.Offsets)) - 1
+	}
+	return l.Offsets[checkpoint], first - checkpoint*indexLineInterval
+}
+
+// IndexPath returns where the index of the bundle at location is saved
+func IndexPath(location string) (string, error) {
+	info, err := os.Stat(location)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return filepath.Join(location, IndexFileName), nil
+	}
+	return location + IndexFileName, nil
+}
+
+// indexSource returns the source of the index of the bundle at location
+func indexSource(location string) (IndexSource, error) {
+	info, err := os.Stat(location)
+	if err != nil {
+		return IndexSource{}, err
+	}
+	if !info.IsDir() {
+		return IndexSource{Size: info.Size(), Files: 1, ModTime: info.ModTime().UTC()}, nil
+	}
+
+	source := IndexSource{}
+	err = filepath.WalkDir(location, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || d.Name() == IndexFileName {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		source.Size += info.Size()
+		source.Files++
+		if info.ModTime().After(source.ModTime) {
+			source.ModTime = info.ModTime().UTC()
+		}
+		return nil
+	})
+	return source, err
+}
+
+// LoadBundleIndex reads the index of the bundle at location. Nil is returned when there is no
+// index, or when it was built from another version of the bundle or by another version of sbctl.
+func LoadBundleIndex(location string) (*BundleIndex, error) {
+	fileName, err := IndexPath(location)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(fileName)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to open index")
+	}
+	defer f.Close()
+
+	gzr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read index")
+	}
+	index := &BundleIndex{}
+	if err := json.NewDecoder(gzr).Decode(index); err != nil {
+		return nil, errors.Wrap(err, "failed to decode index")
+	}
+
+	source, err := indexSource(location)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to stat bundle")
+	}
+	if index.Version != indexVersion || index.Source.Size != source.Size || index.Source.Files != source.Files || !index.Source.ModTime.Equal(source.ModTime) {
+		return nil, nil
+	}
+
+	index.buildLogMap()
+	return index, nil
+}
+
+// SaveBundleIndex writes the index of the bundle at location next to it
+func SaveBundleIndex(location string, index *BundleIndex) error {
+	fileName, err := IndexPath(location)
+	if err != nil {
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+	gzw := gzip.NewWriter(buf)
+	if err := json.NewEncoder(gzw).Encode(index); err != nil {
+		return errors.Wrap(err, "failed to encode index")
+	}
+	if err := gzw.Close(); err != nil {
+		return errors.Wrap(err, "failed to compress index")
+	}
+
+	// Readers never see a partly written index
+	tmpFile := fileName + ".tmp"
+	if err := os.WriteFile(tmpFile, buf.Bytes(), 0644); err != nil {
+		return errors.Wrap(err, "failed to write index")
+	}
+	if err := os.Rename(tmpFile, fileName); err != nil {
+		_ = os.Remove(tmpFile)
+		return errors.Wrap(err, "failed to write index")
+	}
+	return nil
+}
+
+// BuildBundleIndex reads the resources, container logs and audit logs of the bundle at location,
+// whose cluster data is clusterData
+func BuildBundleIndex(location string, clusterData ClusterData) (*BundleIndex, error) {
+	source, err := indexSource(location)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to stat bundle")
+	}
+	index := &BundleIndex{
+		Version:   indexVersion,
+		Source:    source,
+		Created:   time.Now().UTC(),
+		Resources: []IndexedResource{},
+		Logs:      []IndexedLog{},
+	}
+
+	resources, err := ListCollectedResources(clusterData)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list resources")
+	}
+	for _, r := range resources {
+		indexed := IndexedResource{
+			Group:      r.Group,
+			Version:    r.Version,
+			Resource:   r.Resource,
+			Kind:       r.Kind,
+			Namespaced: r.Namespaced,
+			Objects:    make([]IndexedObject, 0, len(r.Items)),
+		}
+		for _, item := range r.Items {
+			indexed.Objects = append(indexed.Objects, IndexedObject{
+				Namespace:   item.GetNamespace(),
+				Name:        item.GetName(),
+				Labels:      item.GetLabels(),
+				Annotations: item.GetAnnotations(),
+			})
+		}
+		index.Resources = append(index.Resources, indexed)
+	}
+
+	logsDir := filepath.Join(clusterData.ClusterResourcesDir, "pods", "logs")
+	err = filepath.WalkDir(logsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".log") {
+			return nil
+		}
+		l, err := indexLog(path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to index %s", path)
+		}
+		rel, err := filepath.Rel(clusterData.ClusterResourcesDir, path)
+		if err != nil {
+			return err
+		}
+		l.Path = filepath.ToSlash(rel)
+		index.Logs = append(index.Logs, l)
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "failed to index logs")
+	}
+	sort.Slice(index.Logs, func(i, j int) bool {
+		return index.Logs[i].Path < index.Logs[j].Path
+	})
+
+	index.Audit, err = IndexAuditEvents(clusterData)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to index audit logs")
+	}
+
+	index.buildLogMap()
+	return index, nil
+}
+
+// indexLog counts the lines of a log, records the offset of every indexLineInterval-th line,
+// and the timestamps of the first and last lines that have one
+func indexLog(fileName string) (IndexedLog, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return IndexedLog{}, err
+	}
+	defer f.Close()
+
+	l := IndexedLog{Offsets: []int64{}}
+	r := bufio.NewReaderSize(f, 64*1024)
+	offset := int64(0)
+	for {
+		line, err := r.ReadSlice('\n')
+		if len(line) > 0 {
+			if l.Lines%indexLineInterval == 0 {
+				l.Offsets = append(l.Offsets, offset)
+			}
+			l.Lines++
+			if ts, ok := lineTimestamp(line); ok {
+				if l.FirstTimestamp == nil {
+					l.FirstTimestamp = &ts
+				}
+				l.LastTimestamp = &ts
+			}
+		}
+		offset += int64(len(line))
+		// The rest of lines longer than the buffer is skipped
+		for err == bufio.ErrBufferFull {
+			line, err = r.ReadSlice('\n')
+			offset += int64(len(line))
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return IndexedLog{}, err
+		}
+	}
+	l.Size = offset
+	return l, nil
+}
+
+// lineTimestamp parses the RFC3339 timestamp log lines start with when logs are collected with
+// timestamps
+func lineTimestamp(line []byte) (time.Time, bool) {
+	i := bytes.IndexByte(line, ' ')
+	if i < 0 {
+		return time.Time{}, false
+	}
+	ts, err := time.Parse(time.RFC3339Nano, string(line[:i]))
+	return ts, err == nil
+}
+
+func (i *BundleIndex) buildLogMap() {
+	i.logs = map[string]int{}
+	for n, l := range i.Logs {
+		i.logs[l.Path] = n
+	}
+}
+
+// Log returns the index of the log at path, relative to the cluster-resources directory
+func (i *BundleIndex) Log(path string) (IndexedLog, bool) {
+	n, ok := i.logs[filepath.ToSlash(path)]
+	if !ok {
+		return IndexedLog{}, false
+	}
+	return i.Logs[n], true
+}
+
+// ListIndexedResources returns the collected resources like ListCollectedResources, but when the
+// cluster data has an index, their items only have the metadata the index has: namespace, name,
+// labels and annotations. Callers that need whole objects use ListCollectedResources.
+func ListIndexedResources(clusterData ClusterData) ([]CollectedResource, error) {
+	if clusterData.Index == nil {
+		return ListCollectedResources(clusterData)
+	}
+
+	resources := make([]CollectedResource, 0, len(clusterData.Index.Resources))
+	for _, r := range clusterData.Index.Resources {
+		items := make([]unstructured.Unstructured, 0, len(r.Objects))
+		for _, o := range r.Objects {
+			item := unstructured.Unstructured{Object: map[string]interface{}{}}
+			item.SetNamespace(o.Namespace)
+			item.SetName(o.Name)
+			item.SetLabels(o.Labels)
+			item.SetAnnotations(o.Annotations)
+			items = append(items, item)
+		}
+		resources = append(resources, CollectedResource{
+			Group:      r.Group,
+			Version:    r.Version,
+			Resource:   r.Resource,
+			Kind:       r.Kind,
+			Namespaced: r.Namespaced,
+			Items:      items,
+		})
+	}
+	return resources, nil
+}
@@ -0,0 +1,114 @@
+package sbctl
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// MergeConflictLatest keeps the file of the most recently collected bundle
+	MergeConflictLatest = "latest"
+	// MergeConflictKeepBoth keeps the file of the most recently collected bundle, and differing
+	// files of earlier bundles next to it with .1, .2 and so on appended, as rotated logs are
+	MergeConflictKeepBoth = "keep-both"
+)
+
+// mergeFile is a file at the same path in one of the merged bundles
+type mergeFile struct {
+	filename string
+	modTime  time.Time
+	sum      [sha256.Size]byte
+}
+
+// MergeBundles writes a gzipped tar archive to out with the files of all bundles, below a
+// directory named topDir. Bundles are given in the order they were collected, oldest first.
+// Files are merged by their path in the bundle, and conflict is one of MergeConflictLatest and
+// MergeConflictKeepBoth. It returns the number of files written.
+func MergeBundles(bundles []ClusterData, conflict string, out io.Writer, topDir string) (int, error) {
+	if conflict != MergeConflictLatest && conflict != MergeConflictKeepBoth {
+		return 0, errors.Errorf("unsupported conflict policy %q, must be %s or %s", conflict, MergeConflictLatest, MergeConflictKeepBoth)
+	}
+
+	// Versions of each file, oldest first. Identical copies are only kept once.
+	versions := map[string][]mergeFile{}
+	for _, clusterData := range bundles {
+		if clusterData.ClusterResourcesDir == "" {
+			return 0, errors.Errorf("bundle in %s has no cluster-resources directory", clusterData.BundleDir)
+		}
+		root := filepath.Dir(clusterData.ClusterResourcesDir)
+
+		err := filepath.Walk(root, func(filename string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			rel, err := filepath.Rel(root, filename)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+
+			data, err := os.ReadFile(filename)
+			if err != nil {
+				return errors.Wrapf(err, "failed to read %s", filename)
+			}
+			file := mergeFile{filename: filename, modTime: info.ModTime(), sum: sha256.Sum256(data)}
+
+			existing := versions[rel]
+			for i := range existing {
+				if existing[i].sum == file.sum {
+					// Newer bundles win, even when the content is the same
+					existing = append(existing[:i], existing[i+1:]...)
+					break
+				}
+			}
+			versions[rel] = append(existing, file)
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	paths := make([]string, 0, len(versions))
+	for rel := range versions {
+		paths = append(paths, rel)
+	}
+	sort.Strings(paths)
+
+	w := newBundleWriter(out, topDir)
+	for _, rel := range paths {
+		files := versions[rel]
+		if conflict == MergeConflictLatest {
+			files = files[len(files)-1:]
+		}
+		for i := len(files) - 1; i >= 0; i-- {
+			data, err := os.ReadFile(files[i].filename)
+			if err != nil {
+				return 0, errors.Wrapf(err, "failed to read %s", files[i].filename)
+			}
+
+			name := rel
+			if age := len(files) - 1 - i; age > 0 {
+				name = fmt.Sprintf("%s.%d", rel, age)
+			}
+			if err := w.WriteFile(name, data, files[i].modTime); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return 0, err
+	}
+	return w.count, nil
+}
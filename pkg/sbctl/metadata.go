@@ -0,0 +1,90 @@
+package sbctl
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// SynthesizeMissingMetadata fills in the uid and resourceVersion of objects that were collected
+// without them. The values are derived from the object's group, kind, namespace and name, so they
+// are the same every time the bundle is served, and owner references resolve to the synthesized
+// uid of their owner. The version is left out, so an object served in several versions keeps its uid.
+func SynthesizeMissingMetadata(obj runtime.Object) {
+	if !meta.IsListType(obj) {
+		synthesizeObjectMetadata(obj, obj.GetObjectKind().GroupVersionKind())
+		return
+	}
+
+	items, err := meta.ExtractList(obj)
+	if err != nil {
+		return
+	}
+
+	// Items of typed lists often have no kind of their own
+	listGVK := obj.GetObjectKind().GroupVersionKind()
+	itemGVK := listGVK.GroupVersion().WithKind(strings.TrimSuffix(listGVK.Kind, "List"))
+	for _, item := range items {
+		gvk := item.GetObjectKind().GroupVersionKind()
+		if gvk.Kind == "" {
+			gvk = itemGVK
+		}
+		synthesizeObjectMetadata(item, gvk)
+	}
+}
+
+func synthesizeObjectMetadata(obj runtime.Object, gvk schema.GroupVersionKind) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil || accessor.GetName() == "" || gvk.Kind == "" {
+		return
+	}
+
+	if accessor.GetUID() == "" {
+		accessor.SetUID(SynthesizeUID(gvk.Group, gvk.Kind, accessor.GetNamespace(), accessor.GetName()))
+	}
+	if accessor.GetResourceVersion() == "" {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(accessor.GetUID()))
+		accessor.SetResourceVersion(strconv.FormatUint(uint64(h.Sum32()), 10))
+	}
+
+	owners := accessor.GetOwnerReferences()
+	changed := false
+	for i, o := range owners {
+		if o.UID != "" {
+			continue
+		}
+		gv, err := schema.ParseGroupVersion(o.APIVersion)
+		if err != nil {
+			continue
+		}
+		// Owners are in the namespace of the objects they own. Nodes, which own mirror pods, are
+		// the common cluster scoped owner of namespaced objects.
+		namespace := accessor.GetNamespace()
+		if gv.Group == "" && o.Kind == "Node" {
+			namespace = ""
+		}
+		owners[i].UID = SynthesizeUID(gv.Group, o.Kind, namespace, o.Name)
+		changed = true
+	}
+	if changed {
+		accessor.SetOwnerReferences(owners)
+	}
+}
+
+// SynthesizeUID returns a stable UUID formatted uid for an object
+func SynthesizeUID(group string, kind string, namespace string, name string) types.UID {
+	sum := sha256.Sum256([]byte(strings.Join([]string{group, kind, namespace, name}, "/")))
+	b := sum[:16]
+	// Mark it as a name based (version 5 style) UUID with the RFC 4122 variant
+	b[6] = (b[6] & 0x0f) | 0x50
+	b[8] = (b[8] & 0x3f) | 0x80
+	return types.UID(fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]))
+}
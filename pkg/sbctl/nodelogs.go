@@ -0,0 +1,169 @@
+package sbctl
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// nodeLogComponents are the services whose logs host collectors usually collect, e.g. with
+// journald or run collectors. Longer names come first, so kube-apiserver is not taken for etcd or
+// apiserver for kube-apiserver.
+var nodeLogComponents = []string{
+	"kube-apiserver", "kube-controller-manager", "kube-scheduler", "kube-proxy", "kubelet",
+	"containerd", "cri-o", "crio", "docker", "etcd", "k0scontroller", "k0sworker", "rke2-server",
+	"rke2-agent", "k3s", "dmesg", "syslog", "journal",
+}
+
+// NodeLog is a log of a service on a node, collected by a host collector
+type NodeLog struct {
+	Node      string `json:"node"`
+	Component string `json:"component"`
+	// File is relative to the bundle root
+	File string `json:"file"`
+}
+
+// FindNodeLogs finds logs of node services outside of cluster resources. A log belongs to the
+// node whose name is a directory in its path or part of its file name, and to the first
+// component in nodeLogComponents its file name, or else its directory, contains. Bundles of
+// single node clusters often have no node names in their paths, so their logs belong to that node.
+func FindNodeLogs(clusterData ClusterData) ([]NodeLog, error) {
+	logs := []NodeLog{}
+	if clusterData.ClusterResourcesDir == "" {
+		return logs, nil
+	}
+
+	nodes, err := ListResources(clusterData, "", "nodes")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list nodes")
+	}
+	nodeNames := []string{}
+	for _, node := range nodes {
+		nodeNames = append(nodeNames, node.GetName())
+	}
+	// Longer names first, so node-10 is not taken for node-1
+	sort.Slice(nodeNames, func(i, j int) bool {
+		return len(nodeNames[i]) > len(nodeNames[j])
+	})
+
+	bundleRoot := filepath.Dir(clusterData.ClusterResourcesDir)
+	err = filepath.Walk(bundleRoot, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path == clusterData.ClusterResourcesDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".log", ".txt", "":
+		default:
+			return nil
+		}
+
+		relPath, err := filepath.Rel(bundleRoot, path)
+		if err != nil || IsAuditLogFile(relPath) {
+			return nil
+		}
+		component := nodeLogComponent(relPath)
+		if component == "" {
+			return nil
+		}
+		node := nodeLogNode(relPath, nodeNames)
+		if node == "" {
+			return nil
+		}
+
+		logs = append(logs, NodeLog{Node: node, Component: component, File: filepath.ToSlash(relPath)})
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to walk bundle")
+	}
+
+	sort.Slice(logs, func(i, j int) bool {
+		if logs[i].Node != logs[j].Node {
+			return logs[i].Node < logs[j].Node
+		}
+		if logs[i].Component != logs[j].Component {
+			return logs[i].Component < logs[j].Component
+		}
+		return logs[i].File < logs[j].File
+	})
+	return logs, nil
+}
+
+func nodeLogComponent(relPath string) string {
+	base := strings.ToLower(filepath.Base(relPath))
+	dir := strings.ToLower(filepath.Dir(relPath))
+	for _, s := range []string{base, dir} {
+		for _, component := range nodeLogComponents {
+			if strings.Contains(s, component) {
+				return component
+			}
+		}
+	}
+	return ""
+}
+
+func nodeLogNode(relPath string, nodeNames []string) string {
+	segments := strings.Split(filepath.ToSlash(relPath), "/")
+	base := segments[len(segments)-1]
+	for _, name := range nodeNames {
+		for _, segment := range segments[:len(segments)-1] {
+			if segment == name {
+				return name
+			}
+		}
+		if strings.Contains(base, name) {
+			return name
+		}
+	}
+	if len(nodeNames) == 1 {
+		return nodeNames[0]
+	}
+	return ""
+}
+
+// FindNodeLog returns the log of a component on a node. component can also be the file of the log,
+// to choose between several logs of a component.
+func FindNodeLog(clusterData ClusterData, node string, component string) (NodeLog, error) {
+	logs, err := FindNodeLogs(clusterData)
+	if err != nil {
+		return NodeLog{}, err
+	}
+
+	matches := []NodeLog{}
+	components := []string{}
+	for _, l := range logs {
+		if l.Node != node {
+			continue
+		}
+		if len(components) == 0 || components[len(components)-1] != l.Component {
+			components = append(components, l.Component)
+		}
+		if l.Component == component || l.File == component {
+			matches = append(matches, l)
+		}
+	}
+
+	switch {
+	case len(matches) == 1:
+		return matches[0], nil
+	case len(matches) > 1:
+		files := []string{}
+		for _, m := range matches {
+			files = append(files, m.File)
+		}
+		return NodeLog{}, errors.Errorf("node %s has several %s logs, choose one of %s", node, component, strings.Join(files, ", "))
+	case len(components) == 0:
+		return NodeLog{}, errors.Errorf("no logs of node %s found in support bundle", node)
+	}
+	return NodeLog{}, errors.Errorf("no %s log of node %s found in support bundle, found logs of %s", component, node, strings.Join(components, ", "))
+}
@@ -0,0 +1,291 @@
+package sbctl
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	OOMSourcePodStatus = "pod status"
+	OOMSourceEvent     = "event"
+
+	// oomCorrelationWindow is how far apart a container's termination and a kill the node
+	// reported can be to be taken for the same kill
+	oomCorrelationWindow = time.Minute
+)
+
+var (
+	// kubelet reports kills with "System OOM encountered, victim process: java, pid: 1234", the
+	// kernel and node-problem-detector with "Killed process 1234 (java)"
+	oomVictimPattern = regexp.MustCompile(`victim process: ([^,]+), pid: (\d+)`)
+	oomKilledPattern = regexp.MustCompile(`Killed process (\d+) \(([^)]+)\)`)
+
+	oomLogTimestampPattern = regexp.MustCompile(`^\S*?(\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:?\d{2}))`)
+)
+
+// OOMKill is a process killed for running out of memory
+type OOMKill struct {
+	Node      string `json:"node,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Pod       string `json:"pod,omitempty"`
+	Container string `json:"container,omitempty"`
+	// Process and PID are set when the node reported the kill, which names the process rather
+	// than the container
+	Process string    `json:"process,omitempty"`
+	PID     string    `json:"pid,omitempty"`
+	Time    time.Time `json:"time,omitempty"`
+	// Restarts is the restart count of the container
+	Restarts      int32  `json:"restarts,omitempty"`
+	MemoryRequest string `json:"memoryRequest,omitempty"`
+	MemoryLimit   string `json:"memoryLimit,omitempty"`
+	// NodeMemoryPressure is the status of the node's MemoryPressure condition at the time of the
+	// kill, or Unknown when it changed since
+	NodeMemoryPressure string `json:"nodeMemoryPressure,omitempty"`
+	NodeAllocatable    string `json:"nodeAllocatableMemory,omitempty"`
+	// Sources are where the kill was found: pod status, event, or the files of node logs relative
+	// to the bundle root
+	Sources []string `json:"sources"`
+}
+
+// FindOOMKills lists containers terminated as OOMKilled, with their memory requests and limits,
+// and kills reported by nodes in events and kubelet or kernel logs. Kills of a node close in time
+// to a container's termination on that node are taken for the container's. The state of the
+// node's memory at the time is added to each kill.
+func FindOOMKills(clusterData ClusterData) ([]OOMKill, error) {
+	pods, err := ListTypedResources[corev1.Pod](clusterData, "", "pods")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list pods")
+	}
+	events, err := ListTypedResources[corev1.Event](clusterData, "", "events")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list events")
+	}
+	nodes, err := ListTypedResources[corev1.Node](clusterData, "", "nodes")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list nodes")
+	}
+
+	kills := containerOOMKills(pods)
+
+	nodeKills := nodeOOMKillsFromEvents(events)
+	logKills, err := nodeOOMKillsFromLogs(clusterData)
+	if err != nil {
+		return nil, err
+	}
+	nodeKills = append(nodeKills, logKills...)
+
+	for _, nodeKill := range dedupeNodeOOMKills(nodeKills) {
+		if i := matchingContainerKill(kills, nodeKill); i >= 0 {
+			kills[i].Process = nodeKill.Process
+			kills[i].PID = nodeKill.PID
+			kills[i].Sources = append(kills[i].Sources, nodeKill.Sources...)
+			continue
+		}
+		kills = append(kills, nodeKill)
+	}
+
+	nodesByName := map[string]corev1.Node{}
+	for _, node := range nodes {
+		nodesByName[node.Name] = node
+	}
+	for i := range kills {
+		node, ok := nodesByName[kills[i].Node]
+		if !ok {
+			continue
+		}
+		kills[i].NodeMemoryPressure = memoryPressureAt(node, kills[i].Time)
+		if allocatable, ok := node.Status.Allocatable[corev1.ResourceMemory]; ok {
+			kills[i].NodeAllocatable = allocatable.String()
+		}
+	}
+
+	// Oldest first, kills without a time last
+	sort.SliceStable(kills, func(i, j int) bool {
+		if kills[i].Time.IsZero() != kills[j].Time.IsZero() {
+			return !kills[i].Time.IsZero()
+		}
+		return kills[i].Time.Before(kills[j].Time)
+	})
+	return kills, nil
+}
+
+func containerOOMKills(pods []corev1.Pod) []OOMKill {
+	kills := []OOMKill{}
+	for _, pod := range pods {
+		containers := map[string]corev1.Container{}
+		for _, c := range append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...) {
+			containers[c.Name] = c
+		}
+
+		statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+		for _, status := range statuses {
+			for _, state := range []corev1.ContainerState{status.State, status.LastTerminationState} {
+				if state.Terminated == nil || state.Terminated.Reason != "OOMKilled" {
+					continue
+				}
+				kill := OOMKill{
+					Node:      pod.Spec.NodeName,
+					Namespace: pod.Namespace,
+					Pod:       pod.Name,
+					Container: status.Name,
+					Time:      state.Terminated.FinishedAt.Time,
+					Restarts:  status.RestartCount,
+					Sources:   []string{OOMSourcePodStatus},
+				}
+				c := containers[status.Name]
+				if request, ok := c.Resources.Requests[corev1.ResourceMemory]; ok {
+					kill.MemoryRequest = request.String()
+				}
+				if limit, ok := c.Resources.Limits[corev1.ResourceMemory]; ok {
+					kill.MemoryLimit = limit.String()
+				}
+				kills = append(kills, kill)
+			}
+		}
+	}
+	return kills
+}
+
+// parseOOMVictim returns the process and PID of a kill reported by kubelet or the kernel
+func parseOOMVictim(message string) (string, string, bool) {
+	if m := oomVictimPattern.FindStringSubmatch(message); m != nil {
+		return strings.TrimSpace(m[1]), m[2], true
+	}
+	if m := oomKilledPattern.FindStringSubmatch(message); m != nil {
+		return m[2], m[1], true
+	}
+	return "", "", false
+}
+
+func nodeOOMKillsFromEvents(events []corev1.Event) []OOMKill {
+	kills := []OOMKill{}
+	for _, event := range events {
+		if event.InvolvedObject.Kind != "Node" || (event.Reason != "SystemOOM" && event.Reason != "OOMKilling") {
+			continue
+		}
+		kill := OOMKill{Node: event.InvolvedObject.Name, Sources: []string{OOMSourceEvent}}
+		kill.Process, kill.PID, _ = parseOOMVictim(event.Message)
+
+		switch {
+		case !event.LastTimestamp.IsZero():
+			kill.Time = event.LastTimestamp.Time
+		case !event.EventTime.IsZero():
+			kill.Time = event.EventTime.Time
+		default:
+			kill.Time = event.FirstTimestamp.Time
+		}
+		kills = append(kills, kill)
+	}
+	return kills
+}
+
+// nodeOOMKillsFromLogs reads kills from the kubelet and kernel logs collected by host collectors
+func nodeOOMKillsFromLogs(clusterData ClusterData) ([]OOMKill, error) {
+	logs, err := FindNodeLogs(clusterData)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find node logs")
+	}
+
+	root := filepath.Dir(clusterData.ClusterResourcesDir)
+	kills := []OOMKill{}
+	for _, nodeLog := range logs {
+		if nodeLog.Component != "kubelet" && nodeLog.Component != "dmesg" {
+			continue
+		}
+
+		f, err := os.Open(filepath.Join(root, filepath.FromSlash(nodeLog.File)))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to open %s", nodeLog.File)
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := scanner.Text()
+			process, pid, ok := parseOOMVictim(line)
+			if !ok {
+				continue
+			}
+			kill := OOMKill{Node: nodeLog.Node, Process: process, PID: pid, Sources: []string{nodeLog.File}}
+			if m := oomLogTimestampPattern.FindStringSubmatch(line); m != nil {
+				kill.Time, _ = time.Parse(time.RFC3339Nano, m[1])
+			}
+			kills = append(kills, kill)
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read %s", nodeLog.File)
+		}
+	}
+	return kills, nil
+}
+
+// dedupeNodeOOMKills merges the reports of the same kill by the event, kubelet and kernel
+func dedupeNodeOOMKills(kills []OOMKill) []OOMKill {
+	result := []OOMKill{}
+	byKey := map[string]int{}
+	for _, kill := range kills {
+		key := kill.Node + "/" + kill.PID
+		i, ok := byKey[key]
+		if !ok || kill.PID == "" {
+			byKey[key] = len(result)
+			result = append(result, kill)
+			continue
+		}
+		for _, source := range kill.Sources {
+			if !containsString(result[i].Sources, source) {
+				result[i].Sources = append(result[i].Sources, source)
+			}
+		}
+		if result[i].Time.IsZero() {
+			result[i].Time = kill.Time
+		}
+	}
+	return result
+}
+
+// matchingContainerKill returns the index of the container kill on the same node closest in time
+// to a kill the node reported, or -1 when there is none within oomCorrelationWindow
+func matchingContainerKill(kills []OOMKill, nodeKill OOMKill) int {
+	if nodeKill.Time.IsZero() {
+		return -1
+	}
+	best := -1
+	var bestDiff time.Duration
+	for i, kill := range kills {
+		if kill.Container == "" || kill.Node != nodeKill.Node || kill.PID != "" || kill.Time.IsZero() {
+			continue
+		}
+		diff := kill.Time.Sub(nodeKill.Time)
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff <= oomCorrelationWindow && (best < 0 || diff < bestDiff) {
+			best, bestDiff = i, diff
+		}
+	}
+	return best
+}
+
+// memoryPressureAt returns the status of the node's MemoryPressure condition at t, which is only
+// known when the condition did not change after t
+func memoryPressureAt(node corev1.Node, t time.Time) string {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type != corev1.NodeMemoryPressure {
+			continue
+		}
+		if !t.IsZero() && condition.LastTransitionTime.Time.After(t) {
+			return string(corev1.ConditionUnknown)
+		}
+		return string(condition.Status)
+	}
+	return string(corev1.ConditionUnknown)
+}
@@ -0,0 +1,283 @@
+package sbctl
+
+import (
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Relations between objects. Every relation has an inverse, which is what the other object sees.
+const (
+	RelationOwner        = "owner"
+	RelationOwned        = "owned"
+	RelationSelects      = "selects"
+	RelationSelectedBy   = "selected-by"
+	RelationReferences   = "references"
+	RelationReferencedBy = "referenced-by"
+)
+
+var inverseRelations = map[string]string{
+	RelationOwner:        RelationOwned,
+	RelationOwned:        RelationOwner,
+	RelationSelects:      RelationSelectedBy,
+	RelationSelectedBy:   RelationSelects,
+	RelationReferences:   RelationReferencedBy,
+	RelationReferencedBy: RelationReferences,
+}
+
+// RelatedObject is an object related to another one through owner references, label selectors or
+// fields that reference objects by name, such as volumes and service accounts
+type RelatedObject struct {
+	Group     string `json:"group"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Relation  string `json:"relation"`
+	// Via is the field that relates the objects, e.g. spec.volumes[data] or ownerReferences
+	Via string `json:"via"`
+	// Missing is set for referenced objects that are not in the bundle
+	Missing bool `json:"missing,omitempty"`
+}
+
+// FindRelatedObjects returns the objects related to target. objects are all objects of the bundle,
+// which must have their kind and API version set. Objects that target references but which are not
+// in objects are returned as missing.
+func FindRelatedObjects(target unstructured.Unstructured, objects []unstructured.Unstructured) []RelatedObject {
+	result := []RelatedObject{}
+	seen := map[RelatedObject]bool{}
+	add := func(r RelatedObject) {
+		if !seen[r] {
+			seen[r] = true
+			result = append(result, r)
+		}
+	}
+
+	index := map[RelatedObject]bool{}
+	for _, o := range objects {
+		index[RelatedObject{Group: o.GroupVersionKind().Group, Kind: o.GetKind(), Namespace: o.GetNamespace(), Name: o.GetName()}] = true
+	}
+
+	for _, link := range objectLinks(target) {
+		key := RelatedObject{Group: link.Group, Kind: link.Kind, Namespace: link.Namespace, Name: link.Name}
+		link.Missing = !index[key]
+		add(link)
+	}
+
+	targetGroup := target.GroupVersionKind().Group
+	for _, o := range objects {
+		if o.GroupVersionKind().Group == targetGroup && o.GetKind() == target.GetKind() && o.GetNamespace() == target.GetNamespace() && o.GetName() == target.GetName() {
+			continue
+		}
+		for _, link := range objectLinks(o) {
+			if link.Group != targetGroup || link.Kind != target.GetKind() || link.Namespace != target.GetNamespace() || link.Name != target.GetName() {
+				continue
+			}
+			add(RelatedObject{
+				Group:     o.GroupVersionKind().Group,
+				Kind:      o.GetKind(),
+				Namespace: o.GetNamespace(),
+				Name:      o.GetName(),
+				Relation:  inverseRelations[link.Relation],
+				Via:       link.Via,
+			})
+		}
+	}
+
+	// Selectors only select pods. Workloads also select their replica sets, but those are owned.
+	if selector, via, ok := objectSelector(target); ok {
+		for _, o := range objects {
+			if o.GetKind() == "Pod" && o.GetNamespace() == target.GetNamespace() && selector.Matches(labels.Set(o.GetLabels())) {
+				add(RelatedObject{Kind: "Pod", Namespace: o.GetNamespace(), Name: o.GetName(), Relation: RelationSelects, Via: via})
+			}
+		}
+	}
+	if target.GetKind() == "Pod" && targetGroup == "" {
+		for _, o := range objects {
+			if o.GetNamespace() != target.GetNamespace() {
+				continue
+			}
+			if selector, via, ok := objectSelector(o); ok && selector.Matches(labels.Set(target.GetLabels())) {
+				add(RelatedObject{
+					Group:     o.GroupVersionKind().Group,
+					Kind:      o.GetKind(),
+					Namespace: o.GetNamespace(),
+					Name:      o.GetName(),
+					Relation:  RelationSelectedBy,
+					Via:       via,
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Relation != result[j].Relation {
+			return result[i].Relation < result[j].Relation
+		}
+		if result[i].Kind != result[j].Kind {
+			return result[i].Kind < result[j].Kind
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// objectLinks returns the objects an object refers to by name, as seen from the object
+func objectLinks(o unstructured.Unstructured) []RelatedObject {
+	links := []RelatedObject{}
+	namespace := o.GetNamespace()
+	ref := func(group string, kind string, ns string, name string, via string) {
+		if name != "" {
+			links = append(links, RelatedObject{Group: group, Kind: kind, Namespace: ns, Name: name, Relation: RelationReferences, Via: via})
+		}
+	}
+
+	for _, owner := range o.GetOwnerReferences() {
+		gv, _ := schema.ParseGroupVersion(owner.APIVersion)
+		ownerNamespace := namespace
+		if namespaced, err := DefaultRESTMapper().IsNamespaced(schema.GroupKind{Group: gv.Group, Kind: owner.Kind}); err == nil && !namespaced {
+			ownerNamespace = ""
+		}
+		links = append(links, RelatedObject{Group: gv.Group, Kind: owner.Kind, Namespace: ownerNamespace, Name: owner.Name, Relation: RelationOwner, Via: "ownerReferences"})
+	}
+
+	group := o.GroupVersionKind().Group
+	switch {
+	case group == "" && o.GetKind() == "Pod":
+		podSpecLinks(o.Object, []string{"spec"}, namespace, ref)
+	case group == "apps" || (group == "batch" && o.GetKind() == "Job"):
+		podSpecLinks(o.Object, []string{"spec", "template", "spec"}, namespace, ref)
+	case group == "batch" && o.GetKind() == "CronJob":
+		podSpecLinks(o.Object, []string{"spec", "jobTemplate", "spec", "template", "spec"}, namespace, ref)
+	case group == "" && o.GetKind() == "PersistentVolumeClaim":
+		ref("", "PersistentVolume", "", nestedString(o.Object, "spec", "volumeName"), "spec.volumeName")
+		ref("storage.k8s.io", "StorageClass", "", nestedString(o.Object, "spec", "storageClassName"), "spec.storageClassName")
+	case group == "" && o.GetKind() == "PersistentVolume":
+		ref("", "PersistentVolumeClaim", nestedString(o.Object, "spec", "claimRef", "namespace"), nestedString(o.Object, "spec", "claimRef", "name"), "spec.claimRef")
+		ref("storage.k8s.io", "StorageClass", "", nestedString(o.Object, "spec", "storageClassName"), "spec.storageClassName")
+	case group == "" && o.GetKind() == "ServiceAccount":
+		for _, s := range nestedMaps(o.Object, "secrets") {
+			ref("", "Secret", namespace, nestedString(s, "name"), "secrets")
+		}
+		for _, s := range nestedMaps(o.Object, "imagePullSecrets") {
+			ref("", "Secret", namespace, nestedString(s, "name"), "imagePullSecrets")
+		}
+	case group == "networking.k8s.io" && o.GetKind() == "Ingress":
+		ref("", "Service", namespace, nestedString(o.Object, "spec", "defaultBackend", "service", "name"), "spec.defaultBackend")
+		for _, rule := range nestedMaps(o.Object, "spec", "rules") {
+			for _, path := range nestedMaps(rule, "http", "paths") {
+				ref("", "Service", namespace, nestedString(path, "backend", "service", "name"), "spec.rules")
+			}
+		}
+		for _, tls := range nestedMaps(o.Object, "spec", "tls") {
+			ref("", "Secret", namespace, nestedString(tls, "secretName"), "spec.tls")
+		}
+	case group == "rbac.authorization.k8s.io" && (o.GetKind() == "RoleBinding" || o.GetKind() == "ClusterRoleBinding"):
+		roleKind := nestedString(o.Object, "roleRef", "kind")
+		roleNamespace := namespace
+		if roleKind == "ClusterRole" {
+			roleNamespace = ""
+		}
+		ref("rbac.authorization.k8s.io", roleKind, roleNamespace, nestedString(o.Object, "roleRef", "name"), "roleRef")
+		for _, subject := range nestedMaps(o.Object, "subjects") {
+			if nestedString(subject, "kind") == "ServiceAccount" {
+				ref("", "ServiceAccount", nestedString(subject, "namespace"), nestedString(subject, "name"), "subjects")
+			}
+		}
+	}
+
+	return links
+}
+
+// podSpecLinks adds the objects a pod spec refers to: volumes, service account, node, and the config
+// maps and secrets of environment variables and image pull secrets
+func podSpecLinks(obj map[string]interface{}, path []string, namespace string, ref func(group string, kind string, ns string, name string, via string)) {
+	spec, ok, _ := unstructured.NestedMap(obj, path...)
+	if !ok {
+		return
+	}
+
+	ref("", "ServiceAccount", namespace, nestedString(spec, "serviceAccountName"), "spec.serviceAccountName")
+	ref("", "Node", "", nestedString(spec, "nodeName"), "spec.nodeName")
+	for _, s := range nestedMaps(spec, "imagePullSecrets") {
+		ref("", "Secret", namespace, nestedString(s, "name"), "spec.imagePullSecrets")
+	}
+
+	for _, v := range nestedMaps(spec, "volumes") {
+		via := "spec.volumes[" + nestedString(v, "name") + "]"
+		ref("", "PersistentVolumeClaim", namespace, nestedString(v, "persistentVolumeClaim", "claimName"), via)
+		ref("", "ConfigMap", namespace, nestedString(v, "configMap", "name"), via)
+		ref("", "Secret", namespace, nestedString(v, "secret", "secretName"), via)
+		for _, source := range nestedMaps(v, "projected", "sources") {
+			ref("", "ConfigMap", namespace, nestedString(source, "configMap", "name"), via)
+			ref("", "Secret", namespace, nestedString(source, "secret", "name"), via)
+		}
+	}
+
+	containers := append(nestedMaps(spec, "initContainers"), nestedMaps(spec, "containers")...)
+	for _, c := range containers {
+		via := "spec.containers[" + nestedString(c, "name") + "]"
+		for _, env := range nestedMaps(c, "env") {
+			ref("", "ConfigMap", namespace, nestedString(env, "valueFrom", "configMapKeyRef", "name"), via+".env")
+			ref("", "Secret", namespace, nestedString(env, "valueFrom", "secretKeyRef", "name"), via+".env")
+		}
+		for _, envFrom := range nestedMaps(c, "envFrom") {
+			ref("", "ConfigMap", namespace, nestedString(envFrom, "configMapRef", "name"), via+".envFrom")
+			ref("", "Secret", namespace, nestedString(envFrom, "secretRef", "name"), via+".envFrom")
+		}
+	}
+}
+
+// objectSelector returns the pod selector of services, workloads, pod disruption budgets and
+// network policies. Services without a selector do not select anything.
+func objectSelector(o unstructured.Unstructured) (labels.Selector, string, bool) {
+	group := o.GroupVersionKind().Group
+	switch {
+	case group == "" && o.GetKind() == "Service":
+		selector, ok, _ := unstructured.NestedStringMap(o.Object, "spec", "selector")
+		if !ok || len(selector) == 0 {
+			return nil, "", false
+		}
+		return labels.SelectorFromSet(selector), "spec.selector", true
+	case group == "apps", group == "batch" && o.GetKind() == "Job", group == "policy" && o.GetKind() == "PodDisruptionBudget":
+		return labelSelector(o.Object, "spec.selector", "spec", "selector")
+	case group == "networking.k8s.io" && o.GetKind() == "NetworkPolicy":
+		return labelSelector(o.Object, "spec.podSelector", "spec", "podSelector")
+	}
+	return nil, "", false
+}
+
+func labelSelector(obj map[string]interface{}, via string, fields ...string) (labels.Selector, string, bool) {
+	m, ok, _ := unstructured.NestedMap(obj, fields...)
+	if !ok {
+		return nil, "", false
+	}
+	ls := metav1.LabelSelector{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(m, &ls); err != nil {
+		return nil, "", false
+	}
+	selector, err := metav1.LabelSelectorAsSelector(&ls)
+	if err != nil {
+		return nil, "", false
+	}
+	return selector, via, true
+}
+
+func nestedString(obj map[string]interface{}, fields ...string) string {
+	s, _, _ := unstructured.NestedString(obj, fields...)
+	return s
+}
+
+func nestedMaps(obj map[string]interface{}, fields ...string) []map[string]interface{} {
+	items, _, _ := unstructured.NestedSlice(obj, fields...)
+	result := []map[string]interface{}{}
+	for _, item := range items {
+		if m, ok := item.(map[string]interface{}); ok {
+			result = append(result, m)
+		}
+	}
+	return result
+}
@@ -0,0 +1,190 @@
+package sbctl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// ListResources reads all objects of a resource from the bundle, regardless of whether it is cluster scoped,
+// namespaced or a custom resource. Custom resources are looked up using group. Resources which are not in
+// the bundle result in an empty list.
+func ListResources(clusterData ClusterData, group string, resource string) ([]unstructured.Unstructured, error) {
+	return ListResourcesContext(context.Background(), clusterData, group, resource)
+}
+
+// ListResourcesContext is ListResources that stops reading files when ctx is done
+func ListResourcesContext(ctx context.Context, clusterData ClusterData, group string, resource string) ([]unstructured.Unstructured, error) {
+	filenames, err := FindResourceFiles(clusterData, group, resource)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]ResourceFile, 0, len(filenames))
+	for _, fileName := range filenames {
+		files = append(files, ResourceFile{Name: fileName, Resource: resource})
+	}
+
+	decoded, err := ReadResourceFilesContext(ctx, files)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []unstructured.Unstructured{}
+	for _, fileItems := range decoded {
+		items = append(items, fileItems...)
+	}
+
+	return items, nil
+}
+
+// FindResourceFiles returns the files the objects of a resource are stored in, see ListResources
+// and RESTMapper.ResourceFiles
+func FindResourceFiles(clusterData ClusterData, group string, resource string) ([]string, error) {
+	return DefaultRESTMapper().ResourceFiles(clusterData, schema.GroupVersionResource{Group: group, Resource: resource})
+}
+
+// ReadResourceFile reads the objects of a resource stored in a single file
+func ReadResourceFile(fileName string, resource string) ([]unstructured.Unstructured, error) {
+	return readResourceFile(context.Background(), fileName, resource)
+}
+
+func readResourceFile(ctx context.Context, fileName string, resource string) ([]unstructured.Unstructured, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", fileName)
+	}
+
+	decoded, _, err := DecodeWithContext(ctx, resource, data, log.StandardLogger())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decode %s", fileName)
+	}
+
+	obj, err := ToUnstructured(decoded)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to convert %s to unstructured", fileName)
+	}
+
+	if !obj.IsList() {
+		return []unstructured.Unstructured{*obj}, nil
+	}
+
+	list, err := obj.ToList()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to convert %s to list", fileName)
+	}
+
+	return list.Items, nil
+}
+
+// ListTypedResources is ListResources with the objects converted to a typed API object such as corev1.Pod
+func ListTypedResources[T any](clusterData ClusterData, group string, resource string) ([]T, error) {
+	objects, err := ListResources(clusterData, group, resource)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]T, 0, len(objects))
+	for _, o := range objects {
+		var item T
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(o.Object, &item); err != nil {
+			return nil, errors.Wrapf(err, "failed to convert %s %s", resource, o.GetName())
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// ListAPIResources returns the API resources the cluster served when the bundle was collected.
+// Bundles without resources.json result in an empty list.
+func ListAPIResources(clusterData ClusterData) ([]metav1.APIResourceList, error) {
+	resources := []metav1.APIResourceList{}
+
+	fileName := filepath.Join(clusterData.ClusterResourcesDir, "resources.json")
+	if !isFile(fileName) {
+		return resources, nil
+	}
+
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read resources.json")
+	}
+	if err := json.Unmarshal(data, &resources); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal resources.json")
+	}
+
+	return resources, nil
+}
+
+// findResourceFiles returns the files of a resource given by its plural name
+func findResourceFiles(clusterData ClusterData, group string, resource string) ([]string, error) {
+	compatibleName := ResourceFileName(resource)
+
+	// Cluster scoped resources are stored in a single file
+	fileName := filepath.Join(clusterData.ClusterResourcesDir, fmt.Sprintf("%s.json", compatibleName))
+	if isFile(fileName) {
+		return []string{fileName}, nil
+	}
+
+	// Namespaced resources are stored as one file per namespace
+	dirName := filepath.Join(clusterData.ClusterResourcesDir, compatibleName)
+	if group != "" {
+		crDirName := filepath.Join(clusterData.ClusterResourcesDir, "custom-resources", fmt.Sprintf("%s.%s", resource, group))
+		for _, ext := range []string{".json", ".yaml", ".yml"} {
+			if isFile(crDirName + ext) {
+				return []string{crDirName + ext}, nil
+			}
+		}
+		if !isDir(dirName) {
+			dirName = crDirName
+		}
+	}
+
+	if !isDir(dirName) {
+		return []string{}, nil
+	}
+
+	files, err := os.ReadDir(dirName)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read dir")
+	}
+
+	filenames := []string{}
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+
+		switch strings.ToLower(filepath.Ext(file.Name())) {
+		case ".json":
+			filenames = append(filenames, filepath.Join(dirName, file.Name()))
+		case ".yaml", ".yml":
+			// Newer bundles store custom resources as both JSON and YAML
+			base := strings.TrimSuffix(file.Name(), filepath.Ext(file.Name()))
+			if !isFile(filepath.Join(dirName, base+".json")) {
+				filenames = append(filenames, filepath.Join(dirName, file.Name()))
+			}
+		}
+	}
+
+	return filenames, nil
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return !info.IsDir()
+}
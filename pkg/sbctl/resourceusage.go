@@ -0,0 +1,333 @@
+package sbctl
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	// UsageSourceSummary is the source of usage read from kubelet summary API dumps, such as
+	// the ones troubleshoot's nodeMetrics collector writes to node-metrics/<node>.json
+	UsageSourceSummary = "summary"
+	// UsageSourceCadvisor is the source of usage read from dumps of the kubelet's cAdvisor
+	// metrics. They only have cumulative CPU counters, so CPU usage is unknown.
+	UsageSourceCadvisor = "cadvisor"
+)
+
+// ResourceUsage is what a node, or a pod when Pod is set, was using when the bundle was
+// collected. CPU or Memory is nil when the source does not measure it.
+type ResourceUsage struct {
+	Node      string             `json:"node"`
+	Namespace string             `json:"namespace,omitempty"`
+	Pod       string             `json:"pod,omitempty"`
+	CPU       *resource.Quantity `json:"cpu,omitempty"`
+	Memory    *resource.Quantity `json:"memory,omitempty"`
+	Source    string             `json:"source"`
+	// File is relative to the bundle root
+	File string `json:"file"`
+	// Containers is the usage of the containers of a pod, when the source measures them
+	Containers []ContainerUsage `json:"containers,omitempty"`
+	// Time is when the usage was measured, when the source says so
+	Time *time.Time `json:"time,omitempty"`
+}
+
+// ContainerUsage is what a container of a pod was using when the bundle was collected
+type ContainerUsage struct {
+	Name   string             `json:"name"`
+	CPU    *resource.Quantity `json:"cpu,omitempty"`
+	Memory *resource.Quantity `json:"memory,omitempty"`
+}
+
+// statsSummary is the part of the kubelet's /stats/summary response sbctl reads
+type statsSummary struct {
+	Node struct {
+		NodeName string       `json:"nodeName"`
+		CPU      *statsCPU    `json:"cpu"`
+		Memory   *statsMemory `json:"memory"`
+	} `json:"node"`
+	Pods []struct {
+		PodRef struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"podRef"`
+		CPU        *statsCPU    `json:"cpu"`
+		Memory     *statsMemory `json:"memory"`
+		Containers []struct {
+			Name   string       `json:"name"`
+			CPU    *statsCPU    `json:"cpu"`
+			Memory *statsMemory `json:"memory"`
+		} `json:"containers"`
+	} `json:"pods"`
+}
+
+type statsCPU struct {
+	Time           *time.Time `json:"time"`
+	UsageNanoCores *uint64    `json:"usageNanoCores"`
+}
+
+type statsMemory struct {
+	Time            *time.Time `json:"time"`
+	WorkingSetBytes *uint64    `json:"workingSetBytes"`
+}
+
+// FindResourceUsage reads node and pod usage from kubelet summary API and cAdvisor metrics
+// dumps outside of cluster resources. Summary dumps are JSON files in a node-metrics directory
+// or with summary in their name, and cAdvisor dumps are files with cadvisor in their path. Like
+// node logs, cAdvisor dumps belong to the node whose name is in their path.
+func FindResourceUsage(clusterData ClusterData) ([]ResourceUsage, error) {
+	usage := []ResourceUsage{}
+	if clusterData.ClusterResourcesDir == "" {
+		return usage, nil
+	}
+
+	nodes, err := ListResources(clusterData, "", "nodes")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list nodes")
+	}
+	nodeNames := []string{}
+	for _, node := range nodes {
+		nodeNames = append(nodeNames, node.GetName())
+	}
+	sort.Slice(nodeNames, func(i, j int) bool {
+		return len(nodeNames[i]) > len(nodeNames[j])
+	})
+
+	bundleRoot := filepath.Dir(clusterData.ClusterResourcesDir)
+	err = filepath.Walk(bundleRoot, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path == clusterData.ClusterResourcesDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		relPath, err := filepath.Rel(bundleRoot, path)
+		if err != nil {
+			return nil
+		}
+		lowerPath := strings.ToLower(filepath.ToSlash(relPath))
+		base := filepath.Base(lowerPath)
+
+		switch {
+		case strings.Contains(lowerPath, "cadvisor"):
+			node := nodeLogNode(relPath, nodeNames)
+			if node == "" {
+				return nil
+			}
+			found, err := readCadvisorUsage(path, node)
+			if err != nil {
+				return errors.Wrapf(err, "failed to read %s", relPath)
+			}
+			for i := range found {
+				found[i].File = filepath.ToSlash(relPath)
+			}
+			usage = append(usage, found...)
+		case filepath.Ext(base) == ".json" && (strings.Contains(lowerPath, "node-metrics/") || strings.Contains(base, "summary")):
+			found, err := readSummaryUsage(path)
+			if err != nil {
+				// Other JSON files can have summary in their name
+				return nil
+			}
+			for i := range found {
+				found[i].File = filepath.ToSlash(relPath)
+			}
+			usage = append(usage, found...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to walk bundle")
+	}
+
+	sort.SliceStable(usage, func(i, j int) bool {
+		if usage[i].Node != usage[j].Node {
+			return usage[i].Node < usage[j].Node
+		}
+		if usage[i].Namespace != usage[j].Namespace {
+			return usage[i].Namespace < usage[j].Namespace
+		}
+		return usage[i].Pod < usage[j].Pod
+	})
+	return usage, nil
+}
+
+func readSummaryUsage(fileName string) ([]ResourceUsage, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read file")
+	}
+	summary := statsSummary{}
+	if err := json.Unmarshal(data, &summary); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal summary")
+	}
+	if summary.Node.NodeName == "" {
+		return nil, errors.New("not a kubelet summary")
+	}
+
+	node := summary.Node.NodeName
+	usage := []ResourceUsage{{
+		Node:   node,
+		CPU:    summaryCPU(summary.Node.CPU),
+		Memory: summaryMemory(summary.Node.Memory),
+		Source: UsageSourceSummary,
+		Time:   summaryTime(summary.Node.CPU, summary.Node.Memory),
+	}}
+	for _, pod := range summary.Pods {
+		containers := []ContainerUsage{}
+		for _, c := range pod.Containers {
+			containers = append(containers, ContainerUsage{
+				Name:   c.Name,
+				CPU:    summaryCPU(c.CPU),
+				Memory: summaryMemory(c.Memory),
+			})
+		}
+		usage = append(usage, ResourceUsage{
+			Node:       node,
+			Namespace:  pod.PodRef.Namespace,
+			Pod:        pod.PodRef.Name,
+			CPU:        summaryCPU(pod.CPU),
+			Memory:     summaryMemory(pod.Memory),
+			Source:     UsageSourceSummary,
+			Containers: containers,
+			Time:       summaryTime(pod.CPU, pod.Memory),
+		})
+	}
+	return usage, nil
+}
+
+func summaryTime(cpu *statsCPU, memory *statsMemory) *time.Time {
+	if cpu != nil && cpu.Time != nil {
+		return cpu.Time
+	}
+	if memory != nil {
+		return memory.Time
+	}
+	return nil
+}
+
+func summaryCPU(cpu *statsCPU) *resource.Quantity {
+	if cpu == nil || cpu.UsageNanoCores == nil {
+		return nil
+	}
+	return resource.NewScaledQuantity(int64(*cpu.UsageNanoCores), resource.Nano)
+}
+
+func summaryMemory(memory *statsMemory) *resource.Quantity {
+	if memory == nil || memory.WorkingSetBytes == nil {
+		return nil
+	}
+	return resource.NewQuantity(int64(*memory.WorkingSetBytes), resource.BinarySI)
+}
+
+// readCadvisorUsage reads the memory working set of the node's root cgroup and of pod cgroups,
+// which have a pod label and no container label, from metrics in the Prometheus text format
+func readCadvisorUsage(fileName string, node string) ([]ResourceUsage, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open file")
+	}
+	defer f.Close()
+
+	usage := []ResourceUsage{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		name, labels, value, ok := parseMetricLine(scanner.Text())
+		if !ok || name != "container_memory_working_set_bytes" {
+			continue
+		}
+		memory := resource.NewQuantity(int64(value), resource.BinarySI)
+
+		switch {
+		case labels["id"] == "/":
+			usage = append(usage, ResourceUsage{Node: node, Memory: memory, Source: UsageSourceCadvisor})
+		case labels["pod"] != "" && labels["container"] == "":
+			usage = append(usage, ResourceUsage{
+				Node:      node,
+				Namespace: labels["namespace"],
+				Pod:       labels["pod"],
+				Memory:    memory,
+				Source:    UsageSourceCadvisor,
+			})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read metrics")
+	}
+	return usage, nil
+}
+
+// parseMetricLine parses a sample such as name{label="value",...} 123 1650000000000. Comments and
+// malformed lines are not ok.
+func parseMetricLine(line string) (string, map[string]string, float64, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", nil, 0, false
+	}
+
+	labels := map[string]string{}
+	name, rest := line, ""
+	if i := strings.IndexByte(line, '{'); i >= 0 {
+		end := strings.LastIndexByte(line, '}')
+		if end < i {
+			return "", nil, 0, false
+		}
+		name, rest = line[:i], line[end+1:]
+		for _, pair := range splitMetricLabels(line[i+1 : end]) {
+			key, value, found := strings.Cut(pair, "=")
+			if !found {
+				continue
+			}
+			if unquoted, err := strconv.Unquote(strings.TrimSpace(value)); err == nil {
+				labels[strings.TrimSpace(key)] = unquoted
+			}
+		}
+	} else if i := strings.IndexAny(line, " \t"); i >= 0 {
+		name, rest = line[:i], line[i:]
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return "", nil, 0, false
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return "", nil, 0, false
+	}
+	return name, labels, value, true
+}
+
+// splitMetricLabels splits labels at commas outside of quoted values
+func splitMetricLabels(s string) []string {
+	pairs := []string{}
+	start, quoted, escaped := 0, false, false
+	for i, c := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			pairs = append(pairs, s[start:i])
+			start = i + 1
+		}
+	}
+	if strings.TrimSpace(s[start:]) != "" {
+		pairs = append(pairs, s[start:])
+	}
+	return pairs
+}
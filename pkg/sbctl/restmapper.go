@@ -0,0 +1,319 @@
+package sbctl
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/kubectl/pkg/scheme"
+)
+
+// builtinResource is a resource sbctl knows without discovery data, for bundles that were
+// collected without resources.json and for decoding files before a bundle is loaded. Versions
+// are the ones troubleshoot stores the resources in.
+type builtinResource struct {
+	GroupVersion string
+	Resource     string
+	Kind         string
+	Namespaced   bool
+	ShortNames   []string
+}
+
+var builtinResources = []builtinResource{
+	{"v1", "pods", "Pod", true, []string{"po"}},
+	{"v1", "events", "Event", true, []string{"ev"}},
+	{"v1", "configmaps", "ConfigMap", true, []string{"cm"}},
+	{"v1", "limitranges", "LimitRange", true, []string{"limits"}},
+	{"v1", "persistentvolumeclaims", "PersistentVolumeClaim", true, []string{"pvc"}},
+	{"v1", "services", "Service", true, []string{"svc"}},
+	{"v1", "namespaces", "Namespace", false, []string{"ns"}},
+	{"v1", "nodes", "Node", false, []string{"no"}},
+	{"v1", "persistentvolumes", "PersistentVolume", false, []string{"pv"}},
+	{"v1", "replicationcontrollers", "ReplicationController", true, []string{"rc"}},
+	{"v1", "resourcequotas", "ResourceQuota", true, []string{"quota"}},
+	{"v1", "endpoints", "Endpoints", true, []string{"ep"}},
+	{"apps/v1", "deployments", "Deployment", true, []string{"deploy"}},
+	{"apps/v1", "daemonsets", "DaemonSet", true, []string{"ds"}},
+	{"apps/v1", "replicasets", "ReplicaSet", true, []string{"rs"}},
+	{"apps/v1", "statefulsets", "StatefulSet", true, []string{"sts"}},
+	{"batch/v1", "jobs", "Job", true, nil},
+	{"batch/v1", "cronjobs", "CronJob", true, []string{"cj"}},
+	{"autoscaling/v2", "horizontalpodautoscalers", "HorizontalPodAutoscaler", true, []string{"hpa"}},
+	{"policy/v1", "poddisruptionbudgets", "PodDisruptionBudget", true, []string{"pdb"}},
+	{"networking.k8s.io/v1", "ingresses", "Ingress", true, []string{"ing"}},
+	{"networking.k8s.io/v1", "networkpolicies", "NetworkPolicy", true, []string{"netpol"}},
+	{"discovery.k8s.io/v1", "endpointslices", "EndpointSlice", true, nil},
+	{"storage.k8s.io/v1", "storageclasses", "StorageClass", false, []string{"sc"}},
+	{"storage.k8s.io/v1", "csidrivers", "CSIDriver", false, nil},
+	{"storage.k8s.io/v1", "volumeattachments", "VolumeAttachment", false, nil},
+	{"rbac.authorization.k8s.io/v1", "clusterroles", "ClusterRole", false, nil},
+	{"rbac.authorization.k8s.io/v1", "clusterrolebindings", "ClusterRoleBinding", false, nil},
+	{"admissionregistration.k8s.io/v1", "mutatingwebhookconfigurations", "MutatingWebhookConfiguration", false, nil},
+	{"admissionregistration.k8s.io/v1", "validatingwebhookconfigurations", "ValidatingWebhookConfiguration", false, nil},
+	{"apiextensions.k8s.io/v1", "customresourcedefinitions", "CustomResourceDefinition", false, []string{"crd", "crds"}},
+	// Well-known CRDs, whose objects are often in bundles whose discovery data is missing them,
+	// see WellKnownCRDResources
+	{GatewayAPIGroup + "/v1", "gatewayclasses", "GatewayClass", false, []string{"gc"}},
+	{GatewayAPIGroup + "/v1", "gateways", "Gateway", true, []string{"gtw"}},
+	{GatewayAPIGroup + "/v1", "httproutes", "HTTPRoute", true, nil},
+	{GatewayAPIGroup + "/v1", "grpcroutes", "GRPCRoute", true, nil},
+	{GatewayAPIGroup + "/v1beta1", "referencegrants", "ReferenceGrant", true, []string{"refgrant"}},
+	{GatewayAPIGroup + "/v1alpha2", "tcproutes", "TCPRoute", true, nil},
+	{GatewayAPIGroup + "/v1alpha2", "tlsroutes", "TLSRoute", true, nil},
+	{GatewayAPIGroup + "/v1alpha2", "udproutes", "UDPRoute", true, nil},
+	{KarpenterGroup + "/v1", "nodepools", "NodePool", false, nil},
+	{KarpenterGroup + "/v1", "nodeclaims", "NodeClaim", false, nil},
+	{KarpenterGroup + "/v1alpha5", "provisioners", "Provisioner", false, nil},
+	{KarpenterGroup + "/v1alpha5", "machines", "Machine", false, nil},
+	{KarpenterAWSGroup + "/v1", "ec2nodeclasses", "EC2NodeClass", false, []string{"ec2nc", "ec2ncs"}},
+	{AutoscalingGroup + "/v1", "provisioningrequests", "ProvisioningRequest", true, []string{"provreq", "provreqs"}},
+}
+
+// resourceFileNames are the names troubleshoot stores the files of resources under, where they are
+// not the resources' plural names
+var resourceFileNames = map[string]string{
+	"persistentvolumeclaims":    "pvcs",
+	"persistentvolumes":         "pvs",
+	"storageclasses":            "storage-classes",
+	"ingresses":                 "ingress",
+	"customresourcedefinitions": "custom-resource-definitions",
+	"clusterrolebindings":       "clusterRoleBindings",
+	"poddisruptionbudgets":      "pod-disruption-budgets",
+	"networkpolicies":           "network-policy",
+	"resourcequotas":            "resource-quota",
+}
+
+// ResourceFileName returns the name of the file or directory in cluster resources that the objects
+// of a resource are stored in, e.g. pvcs for persistentvolumeclaims
+func ResourceFileName(resource string) string {
+	if name, ok := resourceFileNames[resource]; ok {
+		return name
+	}
+	return resource
+}
+
+// ResourceForFileName returns the resource stored in a file or directory of cluster resources,
+// the reverse of ResourceFileName
+func ResourceForFileName(name string) string {
+	for resource, fileName := range resourceFileNames {
+		if fileName == name {
+			return resource
+		}
+	}
+	return name
+}
+
+// RESTMapper maps resources, as users and file names spell them, to kinds and back. It is the one
+// place sbctl resolves plural, singular and short names, so that the API server, decoding and
+// command arguments agree on them.
+type RESTMapper struct {
+	mapper     *meta.DefaultRESTMapper
+	shortNames map[string][]schema.GroupResource
+}
+
+// NewRESTMapper builds a mapper from discovery data. Built-in resources are added after the ones
+// in resources, which are preferred when both have a resource in different versions.
+func NewRESTMapper(resources []metav1.APIResourceList) *RESTMapper {
+	type mapping struct {
+		gv         schema.GroupVersion
+		resource   metav1.APIResource
+		namespaced bool
+	}
+	mappings := []mapping{}
+	for _, list := range resources {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			continue
+		}
+		for _, r := range list.APIResources {
+			// Subresources such as pods/log are not kinds of their own
+			if strings.Contains(r.Name, "/") || r.Kind == "" {
+				continue
+			}
+			mappings = append(mappings, mapping{gv: gv, resource: r, namespaced: r.Namespaced})
+		}
+	}
+	for _, b := range builtinResources {
+		gv, _ := schema.ParseGroupVersion(b.GroupVersion)
+		mappings = append(mappings, mapping{
+			gv:         gv,
+			resource:   metav1.APIResource{Name: b.Resource, Kind: b.Kind, ShortNames: b.ShortNames},
+			namespaced: b.Namespaced,
+		})
+	}
+
+	groupVersions := []schema.GroupVersion{}
+	seen := map[schema.GroupVersion]bool{}
+	for _, m := range mappings {
+		if !seen[m.gv] {
+			seen[m.gv] = true
+			groupVersions = append(groupVersions, m.gv)
+		}
+	}
+
+	result := &RESTMapper{
+		mapper:     meta.NewDefaultRESTMapper(groupVersions),
+		shortNames: map[string][]schema.GroupResource{},
+	}
+	for _, m := range mappings {
+		scope := meta.RESTScopeRoot
+		if m.namespaced {
+			scope = meta.RESTScopeNamespace
+		}
+		singular := m.resource.SingularName
+		if singular == "" {
+			singular = strings.ToLower(m.resource.Kind)
+		}
+		result.mapper.AddSpecific(
+			m.gv.WithKind(m.resource.Kind),
+			m.gv.WithResource(m.resource.Name),
+			m.gv.WithResource(singular),
+			scope,
+		)
+
+		gr := schema.GroupResource{Group: m.gv.Group, Resource: m.resource.Name}
+		for _, shortName := range m.resource.ShortNames {
+			if !containsGroupResource(result.shortNames[shortName], gr) {
+				result.shortNames[shortName] = append(result.shortNames[shortName], gr)
+			}
+		}
+	}
+	return result
+}
+
+func containsGroupResource(list []schema.GroupResource, gr schema.GroupResource) bool {
+	for _, item := range list {
+		if item == gr {
+			return true
+		}
+	}
+	return false
+}
+
+var defaultRESTMapper = NewRESTMapper(nil)
+
+// DefaultRESTMapper returns a mapper of the built-in resources only
+func DefaultRESTMapper() *RESTMapper {
+	return defaultRESTMapper
+}
+
+// LoadRESTMapper returns a mapper of the resources the cluster served when the bundle was
+// collected, including custom resources, and of the built-in resources
+func LoadRESTMapper(clusterData ClusterData) (*RESTMapper, error) {
+	resources, err := ListAPIResources(clusterData)
+	if err != nil {
+		return nil, err
+	}
+	return NewRESTMapper(resources), nil
+}
+
+// ResourceFor resolves a resource as kubectl does, by its plural, singular or short name or its
+// kind, optionally qualified with its group, e.g. deploy or deployments.apps
+func (m *RESTMapper) ResourceFor(arg string) (schema.GroupVersionResource, error) {
+	arg = strings.ToLower(strings.TrimSpace(arg))
+
+	candidates := []schema.GroupVersionResource{}
+	fullySpecified, groupResource := schema.ParseResourceArg(arg)
+	if fullySpecified != nil {
+		candidates = append(candidates, *fullySpecified)
+	}
+	candidates = append(candidates, groupResource.WithVersion(""))
+	if grs, ok := m.shortNames[groupResource.Resource]; ok {
+		for _, gr := range grs {
+			if groupResource.Group == "" || strings.HasPrefix(gr.Group, groupResource.Group) {
+				candidates = append(candidates, gr.WithVersion(""))
+			}
+		}
+	}
+
+	for _, candidate := range candidates {
+		if resources, err := m.mapper.ResourcesFor(candidate); err == nil && len(resources) > 0 {
+			return resources[0], nil
+		}
+	}
+	return schema.GroupVersionResource{}, usererrors.New(usererrors.UnknownResource, nil, arg)
+}
+
+// KindFor returns the kind of a resource. The group and version of the resource can be empty,
+// the preferred version is returned then.
+func (m *RESTMapper) KindFor(resource schema.GroupVersionResource) (schema.GroupVersionKind, error) {
+	kinds, err := m.mapper.KindsFor(resource)
+	if err != nil {
+		return schema.GroupVersionKind{}, err
+	}
+	return kinds[0], nil
+}
+
+// ResourceForKind returns the resource of a kind, e.g. deployments for Deployment
+func (m *RESTMapper) ResourceForKind(gk schema.GroupKind) (schema.GroupVersionResource, error) {
+	mapping, err := m.mapper.RESTMapping(gk)
+	if err != nil {
+		return schema.GroupVersionResource{}, err
+	}
+	return mapping.Resource, nil
+}
+
+// IsNamespaced returns whether objects of a kind are namespaced
+func (m *RESTMapper) IsNamespaced(gk schema.GroupKind) (bool, error) {
+	mapping, err := m.mapper.RESTMapping(gk)
+	if err != nil {
+		return false, err
+	}
+	return mapping.Scope.Name() == meta.RESTScopeNameNamespace, nil
+}
+
+// ListItemKind returns the kind of the items of a list kind, e.g. apps/v1 Deployment for apps/v1
+// DeploymentList. It returns false if the list kind is not a list of a kind the mapper knows.
+func (m *RESTMapper) ListItemKind(listKind schema.GroupVersionKind) (schema.GroupVersionKind, bool) {
+	if !strings.HasSuffix(listKind.Kind, "List") {
+		return schema.GroupVersionKind{}, false
+	}
+	kind := listKind.GroupVersion().WithKind(strings.TrimSuffix(listKind.Kind, "List"))
+	if _, err := m.mapper.RESTMapping(kind.GroupKind()); err != nil {
+		return schema.GroupVersionKind{}, false
+	}
+	return kind, true
+}
+
+// ResourceFiles returns the files of a bundle that objects of a resource are stored in. Resources
+// the mapper knows are looked up by their plural name, others by the name they are given.
+func (m *RESTMapper) ResourceFiles(clusterData ClusterData, resource schema.GroupVersionResource) ([]string, error) {
+	if resources, err := m.mapper.ResourcesFor(resource.GroupResource().WithVersion("")); err == nil && len(resources) > 0 {
+		resource.Resource = resources[0].Resource
+	}
+	filenames, err := findResourceFiles(clusterData, resource.Group, resource.Resource)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find %s files", resource.Resource)
+	}
+	return filenames, nil
+}
+
+// NewList returns an empty list of objects of a resource that lists of the resource decoded from
+// bundle files can be appended to. Lists of built-in kinds are typed. Lists of resources the
+// mapper does not know are unstructured, with the resource as their kind.
+func (m *RESTMapper) NewList(resource schema.GroupVersionResource) runtime.Object {
+	kind, err := m.KindFor(resource)
+	if err != nil {
+		// The requested version can be one that bundles do not store the resource in
+		kind, err = m.KindFor(resource.GroupResource().WithVersion(""))
+	}
+	if err != nil {
+		list := &unstructured.UnstructuredList{Items: []unstructured.Unstructured{}}
+		list.SetGroupVersionKind(resource.GroupVersion().WithKind(resource.Resource))
+		return list
+	}
+
+	listKind := kind.GroupVersion().WithKind(kind.Kind + "List")
+	if list, err := scheme.Scheme.New(listKind); err == nil && meta.SetList(list, []runtime.Object{}) == nil {
+		list.GetObjectKind().SetGroupVersionKind(listKind)
+		return list
+	}
+	list := &unstructured.UnstructuredList{Items: []unstructured.Unstructured{}}
+	list.SetGroupVersionKind(listKind)
+	return list
+}
@@ -0,0 +1,401 @@
+package sbctl
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+const (
+	RunbookStepQuery   = "query"
+	RunbookStepAssert  = "assert"
+	RunbookStepLogs    = "logs"
+	RunbookStepMessage = "message"
+
+	// defaultRunbookMaxMatches is how many log lines a logs step keeps when maxMatches is not set
+	defaultRunbookMaxMatches = 20
+)
+
+// Runbook is a guided triage flow vendors ship with their product. Its steps run in order
+// against a bundle, and can use the results of earlier steps.
+type Runbook struct {
+	Name        string        `json:"name"`
+	Description string        `json:"description,omitempty"`
+	Steps       []RunbookStep `json:"steps"`
+}
+
+// RunbookStep is one of query, assert or logs, or only a message
+type RunbookStep struct {
+	Name string `json:"name"`
+	// When is a template. The step is skipped unless it renders to true, e.g.
+	// {{ (step "velero-running").Failed }}
+	When   string         `json:"when,omitempty"`
+	Query  *RunbookQuery  `json:"query,omitempty"`
+	Assert *RunbookAssert `json:"assert,omitempty"`
+	Logs   *RunbookLogs   `json:"logs,omitempty"`
+	// Message is a template rendered when an assert fails, or always for other steps
+	Message string `json:"message,omitempty"`
+}
+
+// RunbookQuery selects objects of a resource, such as pods or deployments.apps
+type RunbookQuery struct {
+	Resource  string `json:"resource"`
+	Namespace string `json:"namespace,omitempty"`
+	// Name is a glob pattern such as velero-*, or a substring when it has no wildcards
+	Name          string `json:"name,omitempty"`
+	LabelSelector string `json:"labelSelector,omitempty"`
+	// JSONPath extracts a value of each object, e.g. {.status.phase}. The values are the
+	// namespaced names of the objects when it is empty.
+	JSONPath string `json:"jsonPath,omitempty"`
+}
+
+// RunbookAssert checks the result of an earlier step
+type RunbookAssert struct {
+	// Step is the name of the query or logs step to check
+	Step     string `json:"step"`
+	MinCount *int   `json:"minCount,omitempty"`
+	MaxCount *int   `json:"maxCount,omitempty"`
+	// Values are the allowed values. Every value of the step must be one of them.
+	Values []string `json:"values,omitempty"`
+}
+
+// RunbookLogs extracts lines matching a pattern from pod logs
+type RunbookLogs struct {
+	Namespace string `json:"namespace,omitempty"`
+	// Pod is a glob pattern such as velero-*, or a substring when it has no wildcards
+	Pod       string `json:"pod,omitempty"`
+	Container string `json:"container,omitempty"`
+	// Pattern is a regular expression
+	Pattern string `json:"pattern"`
+	// Context is the number of lines kept before and after each match
+	Context    int `json:"context,omitempty"`
+	MaxMatches int `json:"maxMatches,omitempty"`
+}
+
+// RunbookStepResult is the outcome of a step, available to the templates of later steps
+type RunbookStepResult struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Skipped bool   `json:"skipped,omitempty"`
+	Failed  bool   `json:"failed,omitempty"`
+	// Count is the number of objects of a query, or of matching lines of a logs step
+	Count   int      `json:"count"`
+	Values  []string `json:"values,omitempty"`
+	Lines   []string `json:"lines,omitempty"`
+	Message string   `json:"message,omitempty"`
+}
+
+// Type returns which kind of step this is
+func (s RunbookStep) Type() string {
+	switch {
+	case s.Query != nil:
+		return RunbookStepQuery
+	case s.Assert != nil:
+		return RunbookStepAssert
+	case s.Logs != nil:
+		return RunbookStepLogs
+	}
+	return RunbookStepMessage
+}
+
+// LoadRunbook reads a runbook from a YAML or JSON file and validates it
+func LoadRunbook(fileName string) (*Runbook, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read runbook")
+	}
+
+	runbook := &Runbook{}
+	if err := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), len(data)).Decode(runbook); err != nil {
+		return nil, errors.Wrap(err, "failed to decode runbook")
+	}
+	if err := runbook.validate(); err != nil {
+		return nil, errors.Wrapf(err, "invalid runbook %s", fileName)
+	}
+	return runbook, nil
+}
+
+func (r *Runbook) validate() error {
+	if len(r.Steps) == 0 {
+		return errors.New("runbook has no steps")
+	}
+
+	seen := map[string]string{}
+	for i, step := range r.Steps {
+		if step.Name == "" {
+			return errors.Errorf("step %d has no name", i+1)
+		}
+		if _, ok := seen[step.Name]; ok {
+			return errors.Errorf("step %s is defined more than once", step.Name)
+		}
+
+		kinds := 0
+		for _, set := range []bool{step.Query != nil, step.Assert != nil, step.Logs != nil} {
+			if set {
+				kinds++
+			}
+		}
+		if kinds > 1 {
+			return errors.Errorf("step %s must have only one of query, assert or logs", step.Name)
+		}
+
+		switch step.Type() {
+		case RunbookStepQuery:
+			if step.Query.Resource == "" {
+				return errors.Errorf("query of step %s has no resource", step.Name)
+			}
+		case RunbookStepAssert:
+			stepType, ok := seen[step.Assert.Step]
+			if !ok {
+				return errors.Errorf("assert of step %s refers to %q, which is not an earlier step", step.Name, step.Assert.Step)
+			}
+			if stepType != RunbookStepQuery && stepType != RunbookStepLogs {
+				return errors.Errorf("assert of step %s refers to %s, which is not a query or logs step", step.Name, step.Assert.Step)
+			}
+		case RunbookStepLogs:
+			if _, err := regexp.Compile(step.Logs.Pattern); err != nil || step.Logs.Pattern == "" {
+				return errors.Errorf("logs of step %s must have a valid pattern", step.Name)
+			}
+		case RunbookStepMessage:
+			if step.Message == "" {
+				return errors.Errorf("step %s has nothing to do", step.Name)
+			}
+		}
+		seen[step.Name] = step.Type()
+	}
+	return nil
+}
+
+// RunRunbook runs the steps of a runbook against a bundle. Failed asserts are reported in their
+// results, errors are only returned when a step cannot run.
+func RunRunbook(clusterData ClusterData, runbook *Runbook) ([]RunbookStepResult, error) {
+	results := []RunbookStepResult{}
+	byName := map[string]RunbookStepResult{}
+	funcs := template.FuncMap{
+		"step": func(name string) (RunbookStepResult, error) {
+			result, ok := byName[name]
+			if !ok {
+				return result, errors.Errorf("step %q has not run", name)
+			}
+			return result, nil
+		},
+		"join": strings.Join,
+	}
+
+	var mapper *RESTMapper
+	for _, step := range runbook.Steps {
+		result := RunbookStepResult{Name: step.Name, Type: step.Type()}
+
+		if step.When != "" {
+			when, err := renderRunbookTemplate(step.When, funcs)
+			if err != nil {
+				return results, errors.Wrapf(err, "failed to render when of step %s", step.Name)
+			}
+			result.Skipped = strings.TrimSpace(when) != "true"
+		}
+
+		var err error
+		switch {
+		case result.Skipped:
+		case step.Query != nil:
+			if mapper == nil {
+				mapper, err = LoadRESTMapper(clusterData)
+				if err != nil {
+					return results, errors.Wrap(err, "failed to load resources")
+				}
+			}
+			result.Values, err = runRunbookQuery(clusterData, mapper, *step.Query)
+			result.Count = len(result.Values)
+		case step.Assert != nil:
+			result.Failed = !runbookAssertPasses(*step.Assert, byName[step.Assert.Step])
+		case step.Logs != nil:
+			result.Count, result.Lines, err = runRunbookLogs(clusterData, *step.Logs)
+		}
+		if err != nil {
+			return results, errors.Wrapf(err, "failed to run step %s", step.Name)
+		}
+
+		// Messages can use the result of their own step
+		byName[step.Name] = result
+		if !result.Skipped && step.Message != "" && (step.Assert == nil || result.Failed) {
+			result.Message, err = renderRunbookTemplate(step.Message, funcs)
+			if err != nil {
+				return results, errors.Wrapf(err, "failed to render message of step %s", step.Name)
+			}
+			result.Message = strings.TrimSpace(result.Message)
+		}
+
+		byName[step.Name] = result
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func renderRunbookTemplate(text string, funcs template.FuncMap) (string, error) {
+	t, err := template.New("runbook").Funcs(funcs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	b := &strings.Builder{}
+	if err := t.Execute(b, nil); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func runRunbookQuery(clusterData ClusterData, mapper *RESTMapper, q RunbookQuery) ([]string, error) {
+	gvr, err := mapper.ResourceFor(q.Resource)
+	if err != nil {
+		return nil, err
+	}
+	query, err := ParseFindQuery(nil, q.Namespace, q.Name, q.LabelSelector, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var path *jsonpath.JSONPath
+	if q.JSONPath != "" {
+		path = jsonpath.New("query").AllowMissingKeys(true)
+		if err := path.Parse(q.JSONPath); err != nil {
+			return nil, errors.Wrapf(err, "invalid jsonPath %q", q.JSONPath)
+		}
+	}
+
+	objects, err := ListResources(clusterData, gvr.Group, gvr.Resource)
+	if err != nil {
+		return nil, err
+	}
+
+	values := []string{}
+	for _, o := range objects {
+		if !query.Matches(o) {
+			continue
+		}
+		if path == nil {
+			values = append(values, strings.TrimPrefix(o.GetNamespace()+"/"+o.GetName(), "/"))
+			continue
+		}
+		b := &bytes.Buffer{}
+		if err := path.Execute(b, o.Object); err != nil {
+			return nil, errors.Wrapf(err, "failed to evaluate jsonPath on %s", o.GetName())
+		}
+		values = append(values, b.String())
+	}
+	return values, nil
+}
+
+func runbookAssertPasses(a RunbookAssert, result RunbookStepResult) bool {
+	if a.MinCount != nil && result.Count < *a.MinCount {
+		return false
+	}
+	if a.MaxCount != nil && result.Count > *a.MaxCount {
+		return false
+	}
+	if len(a.Values) > 0 {
+		for _, v := range result.Values {
+			if !containsString(a.Values, v) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// runRunbookLogs returns the number of matching lines in the selected pod logs, and the matches
+// with their context, each prefixed with the pod and container they were logged by
+func runRunbookLogs(clusterData ClusterData, l RunbookLogs) (int, []string, error) {
+	pattern, err := regexp.Compile(l.Pattern)
+	if err != nil {
+		return 0, nil, err
+	}
+	maxMatches := l.MaxMatches
+	if maxMatches <= 0 {
+		maxMatches = defaultRunbookMaxMatches
+	}
+
+	logsDir := filepath.Join(clusterData.ClusterResourcesDir, "pods", "logs")
+	files, err := filepath.Glob(filepath.Join(logsDir, "*", "*", "*.log"))
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "failed to list pod logs")
+	}
+	sort.Strings(files)
+
+	count := 0
+	lines := []string{}
+	for _, fileName := range files {
+		rel, _ := filepath.Rel(logsDir, fileName)
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		namespace, pod, container := parts[0], parts[1], strings.TrimSuffix(parts[2], ".log")
+		if strings.HasSuffix(container, "-logs-errors") || strings.HasSuffix(container, "-previous") {
+			continue
+		}
+		if (l.Namespace != "" && namespace != l.Namespace) || (l.Pod != "" && !MatchesNamePattern(l.Pod, pod)) || (l.Container != "" && container != l.Container) {
+			continue
+		}
+
+		n, matched, err := grepLogFile(fileName, pattern, l.Context, maxMatches-len(lines))
+		if err != nil {
+			return 0, nil, err
+		}
+		count += n
+		for _, line := range matched {
+			lines = append(lines, fmt.Sprintf("%s/%s: %s", pod, container, line))
+		}
+	}
+	return count, lines, nil
+}
+
+// grepLogFile returns the number of lines matching pattern, and up to limit matches with context
+// lines around them
+func grepLogFile(fileName string, pattern *regexp.Regexp, context int, limit int) (int, []string, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "failed to open log file")
+	}
+	defer f.Close()
+
+	count := 0
+	result := []string{}
+	before := []string{}
+	after := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if pattern.MatchString(line) {
+			count++
+			if count <= limit {
+				result = append(result, before...)
+				result = append(result, line)
+				after = context
+			}
+			before = before[:0]
+			continue
+		}
+		if after > 0 {
+			result = append(result, line)
+			after--
+			continue
+		}
+		if context > 0 {
+			before = append(before, line)
+			if len(before) > context {
+				before = before[1:]
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return count, result, errors.Wrap(err, "failed to read log file")
+	}
+	return count, result, nil
+}
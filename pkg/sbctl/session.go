@@ -0,0 +1,138 @@
+package sbctl
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+const (
+	SessionAPIVersion = "sbctl.replicated.com/v1"
+	SessionKind       = "Session"
+
+	SessionModeServe = "serve"
+	SessionModeShell = "shell"
+)
+
+// Session declares how to start sbctl for a bundle, so that a session can be repeated or shared
+// with `sbctl up -f`
+type Session struct {
+	APIVersion string      `json:"apiVersion"`
+	Kind       string      `json:"kind"`
+	Spec       SessionSpec `json:"spec"`
+}
+
+// SessionSpec has a field for each serve and shell flag that is worth sharing. Relative paths are
+// relative to the session file.
+type SessionSpec struct {
+	// Bundle is a support bundle archive, directory, or URL. Tokens for URLs are read from
+	// SBCTL_TOKEN rather than the spec, so specs can be shared.
+	Bundle string `json:"bundle"`
+	// Mode is serve or shell, serve by default
+	Mode string `json:"mode,omitempty"`
+	// Port is the API server port, a random free port when 0
+	Port int `json:"port,omitempty"`
+	// Sandbox starts a restricted shell that only runs read-only kubectl commands
+	Sandbox         bool     `json:"sandbox,omitempty"`
+	SandboxCommands []string `json:"sandboxCommands,omitempty"`
+	// Views is a views file restricting tokens to some namespaces
+	Views              string   `json:"views,omitempty"`
+	PrinterPlugins     []string `json:"printerPlugins,omitempty"`
+	MaxResponseSize    string   `json:"maxResponseSize,omitempty"`
+	DisableCompression bool     `json:"disableCompression,omitempty"`
+	Reload             *bool    `json:"reload,omitempty"`
+	UsageReport        string   `json:"usageReport,omitempty"`
+	Debug              bool     `json:"debug,omitempty"`
+}
+
+// LoadSession reads and validates a session file. Unknown fields are errors rather than ignored,
+// so that a misspelled or unsupported setting is not silently dropped.
+func LoadSession(fileName string) (*Session, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read session file")
+	}
+
+	jsonData, err := yaml.ToJSON(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse session file")
+	}
+
+	session := &Session{}
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(session); err != nil {
+		return nil, errors.Wrap(err, "invalid session file")
+	}
+
+	dir := filepath.Dir(fileName)
+	resolve := func(path string) string {
+		if path == "" || filepath.IsAbs(path) || strings.HasPrefix(path, "http") {
+			return path
+		}
+		return filepath.Join(dir, path)
+	}
+	session.Spec.Bundle = resolve(session.Spec.Bundle)
+	session.Spec.Views = resolve(session.Spec.Views)
+	session.Spec.UsageReport = resolve(session.Spec.UsageReport)
+	for i := range session.Spec.PrinterPlugins {
+		session.Spec.PrinterPlugins[i] = resolve(session.Spec.PrinterPlugins[i])
+	}
+
+	if err := session.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "invalid session file %s", fileName)
+	}
+	return session, nil
+}
+
+// Validate returns the first problem with the session, checking that referenced files exist
+func (s *Session) Validate() error {
+	if s.APIVersion != SessionAPIVersion {
+		return errors.Errorf("apiVersion must be %s", SessionAPIVersion)
+	}
+	if s.Kind != SessionKind {
+		return errors.Errorf("kind must be %s", SessionKind)
+	}
+
+	spec := s.Spec
+	if spec.Bundle == "" {
+		return errors.New("spec.bundle is required")
+	}
+	if !strings.HasPrefix(spec.Bundle, "http") {
+		if _, err := os.Stat(spec.Bundle); err != nil {
+			return errors.Wrap(err, "spec.bundle")
+		}
+	}
+
+	switch spec.Mode {
+	case "", SessionModeServe, SessionModeShell:
+	default:
+		return errors.Errorf("spec.mode must be %s or %s", SessionModeServe, SessionModeShell)
+	}
+	if spec.Port < 0 || spec.Port > 65535 {
+		return errors.New("spec.port must be between 0 and 65535")
+	}
+	if (spec.Sandbox || len(spec.SandboxCommands) > 0) && spec.Mode != SessionModeShell {
+		return errors.Errorf("spec.sandbox requires spec.mode %s", SessionModeShell)
+	}
+	if spec.Reload != nil && spec.Mode == SessionModeShell {
+		return errors.Errorf("spec.reload requires spec.mode %s", SessionModeServe)
+	}
+
+	if spec.Views != "" {
+		if _, err := os.Stat(spec.Views); err != nil {
+			return errors.Wrap(err, "spec.views")
+		}
+	}
+	for _, path := range spec.PrinterPlugins {
+		if _, err := os.Stat(path); err != nil {
+			return errors.Wrap(err, "spec.printerPlugins")
+		}
+	}
+	return nil
+}
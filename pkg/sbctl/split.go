@@ -0,0 +1,201 @@
+package sbctl
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+// SplitOptions selects the part of a bundle SplitBundle keeps
+type SplitOptions struct {
+	// Namespaces are the namespaces whose files are kept. Files of all namespaces are kept when empty.
+	Namespaces []string
+	// Resources are the resources whose files are kept. All resources are kept when empty.
+	Resources []schema.GroupResource
+	// NoLogs drops pod logs
+	NoLogs bool
+	// KeepOtherFiles keeps files outside cluster-resources, such as host collector output and
+	// analysis results, which can mention any namespace. Only the cluster version is kept otherwise.
+	KeepOtherFiles bool
+}
+
+// splitFile is what SplitBundle needs to know about a file of the bundle to select it
+type splitFile struct {
+	// resource is the resource the file has objects or logs of, empty for other files
+	resource string
+	// custom is set for files in custom-resources, whose resource is qualified with its group
+	custom bool
+	// namespace is empty for cluster-scoped resources
+	namespace string
+	log       bool
+}
+
+// SplitBundle writes a gzipped tar archive of the selected files of a bundle to out, below a
+// directory named topDir. The namespace list is reduced to the selected
+// namespaces. It returns the number of files written.
+func SplitBundle(clusterData ClusterData, opts SplitOptions, out io.Writer, topDir string) (int, error) {
+	if clusterData.ClusterResourcesDir == "" {
+		return 0, errors.New("bundle has no cluster-resources directory")
+	}
+	root := filepath.Dir(clusterData.ClusterResourcesDir)
+
+	w := newBundleWriter(out, topDir)
+	err := filepath.Walk(root, func(filename string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, filename)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		var data []byte
+		if resourcesRel, ok := strings.CutPrefix(rel, "cluster-resources/"); ok {
+			file := classifySplitFile(resourcesRel)
+			if !opts.keep(file) {
+				return nil
+			}
+			if resourcesRel == "namespaces.json" || resourcesRel == "namespaces.yaml" {
+				if data, err = filterNamespaceList(filename, opts.Namespaces); err != nil {
+					return err
+				}
+			}
+		} else if !opts.KeepOtherFiles && filename != clusterData.ClusterInfoFile {
+			return nil
+		}
+
+		if data == nil {
+			if data, err = os.ReadFile(filename); err != nil {
+				return errors.Wrapf(err, "failed to read %s", filename)
+			}
+		}
+
+		return w.WriteFile(rel, data, info.ModTime())
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if err := w.Close(); err != nil {
+		return 0, err
+	}
+	return w.count, nil
+}
+
+// classifySplitFile tells the resource and namespace of a file from its path in cluster-resources,
+// e.g. pods/velero.json, pods/logs/velero/<pod>/<container>.log,
+// custom-resources/backups.velero.io/velero.yaml or image-pull-secrets/default/<secret>.json.
+// Files directly in cluster-resources are of cluster-scoped resources.
+func classifySplitFile(rel string) splitFile {
+	parts := strings.Split(rel, "/")
+	trimExt := func(name string) string {
+		return strings.TrimSuffix(name, filepath.Ext(name))
+	}
+
+	if parts[0] == "custom-resources" && len(parts) > 1 {
+		file := splitFile{custom: true}
+		if len(parts) == 2 {
+			file.resource = strings.TrimSuffix(trimExt(parts[1]), "-errors")
+			return file
+		}
+		file.resource = parts[1]
+		file.namespace = trimExt(parts[2])
+		return file
+	}
+
+	if len(parts) == 1 {
+		name := strings.TrimSuffix(trimExt(parts[0]), "-errors")
+		if name == "resources" || name == "groups" {
+			return splitFile{}
+		}
+		return splitFile{resource: ResourceForFileName(name)}
+	}
+
+	file := splitFile{resource: ResourceForFileName(parts[0])}
+	if parts[0] == "pods" && parts[1] == "logs" && len(parts) > 2 {
+		file.namespace = parts[2]
+		file.log = true
+		return file
+	}
+	file.namespace = trimExt(parts[1])
+	return file
+}
+
+func (o SplitOptions) keep(file splitFile) bool {
+	if file.resource == "" && file.namespace == "" {
+		// Discovery data is needed to serve whatever is left
+		return true
+	}
+	if file.resource == "namespaces" && !file.custom {
+		// The namespace list is reduced to the selected namespaces instead
+		return true
+	}
+	if file.log && o.NoLogs {
+		return false
+	}
+	if file.namespace != "" && len(o.Namespaces) > 0 && !containsString(o.Namespaces, file.namespace) {
+		return false
+	}
+	if len(o.Resources) == 0 {
+		return true
+	}
+	for _, gr := range o.Resources {
+		if file.custom && gr.String() == file.resource {
+			return true
+		}
+		if !file.custom && gr.Resource == file.resource {
+			return true
+		}
+	}
+	return false
+}
+
+// filterNamespaceList returns the namespace list in filename with only the given namespaces, or
+// with all of them when namespaces is empty
+func filterNamespaceList(filename string, namespaces []string) ([]byte, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", filename)
+	}
+	if len(namespaces) == 0 {
+		return data, nil
+	}
+
+	list := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &list); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s", filename)
+	}
+	items, _ := list["items"].([]interface{})
+	kept := []interface{}{}
+	for _, item := range items {
+		obj, _ := item.(map[string]interface{})
+		metadata, _ := obj["metadata"].(map[string]interface{})
+		if name, _ := metadata["name"].(string); containsString(namespaces, name) {
+			kept = append(kept, item)
+		}
+	}
+	list["items"] = kept
+
+	// JSON is also valid YAML, so a namespaces.yaml stays readable
+	return json.MarshalIndent(list, "", "  ")
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,376 @@
+package sbctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/apimachinery/pkg/version"
+)
+
+// Rancher's support-bundle-kit (used by RKE2, k3s and Harvester) stores resources as
+//
+//	yamls/cluster/<group>/<version>/<resource>.yaml
+//	yamls/namespaced/<namespace>/<group>/<version>/<resource>.yaml
+//	logs/<namespace>/<pod>/<container>.log
+//
+// where the core group is stored directly under "v1". These bundles are converted into the
+// troubleshoot layout so they can be served like any other support bundle.
+
+var (
+	kitShortNames = map[string][]string{
+		"configmaps":                {"cm"},
+		"cronjobs":                  {"cj"},
+		"customresourcedefinitions": {"crd", "crds"},
+		"daemonsets":                {"ds"},
+		"deployments":               {"deploy"},
+		"events":                    {"ev"},
+		"ingresses":                 {"ing"},
+		"limitranges":               {"limits"},
+		"namespaces":                {"ns"},
+		"nodes":                     {"no"},
+		"persistentvolumeclaims":    {"pvc"},
+		"persistentvolumes":         {"pv"},
+		"pods":                      {"po"},
+		"replicasets":               {"rs"},
+		"serviceaccounts":           {"sa"},
+		"services":                  {"svc"},
+		"statefulsets":              {"sts"},
+		"storageclasses":            {"sc"},
+	}
+
+	kubeletVersionRegexp = regexp.MustCompile(`^v?(\d+)\.(\d+)`)
+)
+
+// IsSupportBundleKitDir returns true if dir is the "yamls" directory of a support-bundle-kit bundle
+func IsSupportBundleKitDir(dir string) bool {
+	if filepath.Base(dir) != "yamls" {
+		return false
+	}
+	return isDir(filepath.Join(dir, "cluster")) || isDir(filepath.Join(dir, "namespaced"))
+}
+
+// ConvertSupportBundleKit converts a support-bundle-kit bundle, given the path to its "yamls" directory,
+// into the troubleshoot layout in outDir. The returned ClusterData points into outDir.
+func ConvertSupportBundleKit(yamlsDir string, outDir string) (ClusterData, error) {
+	result := ClusterData{
+		ClusterResourcesDir: filepath.Join(outDir, "cluster-resources"),
+	}
+
+	apiResources := map[string]*metav1.APIResourceList{}
+	addAPIResource := func(groupVersion string, resource string, kind string, namespaced bool) {
+		list, ok := apiResources[groupVersion]
+		if !ok {
+			list = &metav1.APIResourceList{GroupVersion: groupVersion}
+			apiResources[groupVersion] = list
+		}
+		for _, r := range list.APIResources {
+			if r.Name == resource {
+				return
+			}
+		}
+		list.APIResources = append(list.APIResources, metav1.APIResource{
+			Name:         resource,
+			SingularName: strings.ToLower(kind),
+			Namespaced:   namespaced,
+			Kind:         kind,
+			Verbs:        metav1.Verbs{"get", "list"},
+			ShortNames:   kitShortNames[resource],
+		})
+		if resource == "pods" {
+			list.APIResources = append(list.APIResources, metav1.APIResource{
+				Name:       "pods/log",
+				Namespaced: true,
+				Kind:       "Pod",
+				Verbs:      metav1.Verbs{"get"},
+			})
+		}
+	}
+
+	// Cluster scoped resources
+	clusterDir := filepath.Join(yamlsDir, "cluster")
+	if isDir(clusterDir) {
+		err := walkKitResources(clusterDir, func(group, groupVersion, resource string, list *unstructured.UnstructuredList) error {
+			addAPIResource(groupVersion, resource, listItemKind(list, resource), false)
+
+			fileName := filepath.Join(result.ClusterResourcesDir, fmt.Sprintf("%s.json", ResourceFileName(resource)))
+			if !isBuiltinGroup(group) {
+				fileName = filepath.Join(result.ClusterResourcesDir, "custom-resources", fmt.Sprintf("%s.%s.json", resource, group))
+			}
+			if err := writeJSONFile(fileName, list); err != nil {
+				return err
+			}
+
+			if resource == "nodes" {
+				result.ClusterInfoFile = filepath.Join(outDir, "cluster-info", "cluster_version.json")
+				if err := writeKitClusterVersion(result.ClusterInfoFile, list); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return result, errors.Wrap(err, "failed to convert cluster resources")
+		}
+	}
+
+	// Namespaced resources
+	namespacedDir := filepath.Join(yamlsDir, "namespaced")
+	if isDir(namespacedDir) {
+		namespaces, err := os.ReadDir(namespacedDir)
+		if err != nil {
+			return result, errors.Wrap(err, "failed to read namespaced dir")
+		}
+		for _, ns := range namespaces {
+			if !ns.IsDir() {
+				continue
+			}
+			namespace := ns.Name()
+			err := walkKitResources(filepath.Join(namespacedDir, namespace), func(group, groupVersion, resource string, list *unstructured.UnstructuredList) error {
+				addAPIResource(groupVersion, resource, listItemKind(list, resource), true)
+
+				dirName := filepath.Join(result.ClusterResourcesDir, ResourceFileName(resource))
+				if !isBuiltinGroup(group) {
+					dirName = filepath.Join(result.ClusterResourcesDir, "custom-resources", fmt.Sprintf("%s.%s", resource, group))
+				}
+				return writeJSONFile(filepath.Join(dirName, fmt.Sprintf("%s.json", namespace)), list)
+			})
+			if err != nil {
+				return result, errors.Wrapf(err, "failed to convert resources in namespace %s", namespace)
+			}
+		}
+	}
+
+	// Pod logs
+	logsDir := filepath.Join(filepath.Dir(yamlsDir), "logs")
+	if isDir(logsDir) {
+		err := copyDir(logsDir, filepath.Join(result.ClusterResourcesDir, "pods", "logs"))
+		if err != nil {
+			return result, errors.Wrap(err, "failed to copy pod logs")
+		}
+	}
+
+	err := writeKitDiscovery(result.ClusterResourcesDir, apiResources)
+	if err != nil {
+		return result, errors.Wrap(err, "failed to write discovery data")
+	}
+
+	return result, nil
+}
+
+// walkKitResources calls fn for every <group>/<version>/<resource>.yaml, or v1/<resource>.yaml for the core group, in dir
+func walkKitResources(dir string, fn func(group, groupVersion, resource string, list *unstructured.UnstructuredList) error) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		ext := filepath.Ext(info.Name())
+		if info.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		var group, groupVersion string
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		switch len(parts) {
+		case 2:
+			groupVersion = parts[0]
+		case 3:
+			group = parts[0]
+			groupVersion = fmt.Sprintf("%s/%s", parts[0], parts[1])
+		default:
+			return nil
+		}
+		resource := strings.TrimSuffix(parts[len(parts)-1], ext)
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read %s", path)
+		}
+
+		list, err := decodeKitList(data)
+		if err != nil {
+			return errors.Wrapf(err, "failed to decode %s", path)
+		}
+
+		// Lists are stored with "kind: List", use a typed list kind so they can be decoded into k8s types
+		if kind := listItemKind(list, ""); kind != "" {
+			list.SetKind(fmt.Sprintf("%sList", kind))
+			list.SetAPIVersion(groupVersion)
+		}
+
+		return fn(group, groupVersion, resource, list)
+	})
+}
+
+func decodeKitList(data []byte) (*unstructured.UnstructuredList, error) {
+	jsonData, err := yaml.ToJSON(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert yaml to json")
+	}
+
+	list := &unstructured.UnstructuredList{}
+	err = list.UnmarshalJSON(jsonData)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal list")
+	}
+
+	return list, nil
+}
+
+func listItemKind(list *unstructured.UnstructuredList, resource string) string {
+	for _, item := range list.Items {
+		if kind := item.GetKind(); kind != "" {
+			return kind
+		}
+	}
+	return resource
+}
+
+// isBuiltinGroup returns true for API groups which are not stored in the custom-resources directory
+func isBuiltinGroup(group string) bool {
+	if group == "" || !strings.Contains(group, ".") {
+		return true
+	}
+	return strings.HasSuffix(group, ".k8s.io")
+}
+
+func writeKitDiscovery(clusterResourcesDir string, apiResources map[string]*metav1.APIResourceList) error {
+	groupVersions := []string{}
+	for gv := range apiResources {
+		groupVersions = append(groupVersions, gv)
+	}
+	sort.Strings(groupVersions)
+
+	resources := []*metav1.APIResourceList{}
+	groups := []metav1.APIGroup{}
+	groupIndex := map[string]int{}
+	for _, gv := range groupVersions {
+		resources = append(resources, apiResources[gv])
+
+		group, version := "", gv
+		if i := strings.Index(gv, "/"); i >= 0 {
+			group, version = gv[:i], gv[i+1:]
+		}
+		gvd := metav1.GroupVersionForDiscovery{GroupVersion: gv, Version: version}
+		if i, ok := groupIndex[group]; ok {
+			groups[i].Versions = append(groups[i].Versions, gvd)
+			continue
+		}
+		groupIndex[group] = len(groups)
+		groups = append(groups, metav1.APIGroup{
+			Name:             group,
+			Versions:         []metav1.GroupVersionForDiscovery{gvd},
+			PreferredVersion: gvd,
+		})
+	}
+
+	if err := writeJSONFile(filepath.Join(clusterResourcesDir, "resources.json"), resources); err != nil {
+		return err
+	}
+	return writeJSONFile(filepath.Join(clusterResourcesDir, "groups.json"), groups)
+}
+
+// writeKitClusterVersion writes a cluster_version.json using the kubelet version of the first node,
+// since support-bundle-kit does not collect the server version.
+func writeKitClusterVersion(fileName string, nodes *unstructured.UnstructuredList) error {
+	for _, node := range nodes.Items {
+		kubeletVersion, _, _ := unstructured.NestedString(node.Object, "status", "nodeInfo", "kubeletVersion")
+		matches := kubeletVersionRegexp.FindStringSubmatch(kubeletVersion)
+		if matches == nil {
+			continue
+		}
+
+		clusterVersion := struct {
+			Info   version.Info `json:"info"`
+			String string       `json:"string"`
+		}{
+			Info: version.Info{
+				Major:      matches[1],
+				Minor:      matches[2],
+				GitVersion: kubeletVersion,
+			},
+			String: kubeletVersion,
+		}
+		return writeJSONFile(fileName, clusterVersion)
+	}
+	return nil
+}
+
+func writeJSONFile(fileName string, o interface{}) error {
+	data, err := json.Marshal(o)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal data")
+	}
+
+	err = os.MkdirAll(filepath.Dir(fileName), 0755)
+	if err != nil {
+		return errors.Wrap(err, "failed to create file path")
+	}
+
+	err = os.WriteFile(fileName, data, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "failed to write %s", fileName)
+	}
+
+	return nil
+}
+
+func copyDir(srcDir string, dstDir string) error {
+	return filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+
+		dst := filepath.Join(dstDir, rel)
+		if info.IsDir() {
+			return os.MkdirAll(dst, 0755)
+		}
+
+		src, err := os.Open(path)
+		if err != nil {
+			return errors.Wrap(err, "failed to open file")
+		}
+		defer src.Close()
+
+		out, err := os.Create(dst)
+		if err != nil {
+			return errors.Wrap(err, "failed to create file")
+		}
+		defer out.Close()
+
+		_, err = io.Copy(out, src)
+		if err != nil {
+			return errors.Wrap(err, "failed to copy file")
+		}
+
+		return nil
+	})
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return info.IsDir()
+}
@@ -3,23 +3,52 @@ package sbctl
 import (
 	"archive/tar"
 	"compress/gzip"
+	"crypto/sha256"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"time"
 
 	"github.com/pkg/errors"
 )
 
 type ClusterData struct {
+	// BundleDir is the directory the bundle was found in
+	BundleDir           string
 	ClusterInfoFile     string
 	ClusterResourcesDir string
+	// SupportBundleKitDir is set when the bundle was collected with Rancher's support-bundle-kit
+	// and needs to be converted with ConvertSupportBundleKit before it can be served.
+	SupportBundleKitDir string
+	// AnalysisFile contains the results of the analyzers that ran when the bundle was collected
+	AnalysisFile string
+	// ExtensionsFile declares virtual resources computed from files in the bundle
+	ExtensionsFile string
+	// Index is the saved index of the bundle, when it has an up to date one
+	Index *BundleIndex
 }
 
+// ErrBundleTooLarge is returned by ExtractBundleLimited when the files of an archive add up to
+// more than the limit
+var ErrBundleTooLarge = errors.New("bundle is too large when extracted")
+
+// ExtractBundle extracts a bundle archive into outDir. Files with the same content, which are
+// common with rotated logs, are extracted once and hard linked, as are hard links and symlinks to
+// files of the archive. Files are copied when hard links are not supported.
 func ExtractBundle(filename string, outDir string) error {
+	return ExtractBundleLimited(filename, outDir, 0)
+}
+
+// ExtractBundleLimited is ExtractBundle that fails with ErrBundleTooLarge before extracting a file
+// that makes the files of the archive add up to more than maxSize bytes, so that small archives
+// of highly compressed data cannot fill the disk. 0 means no limit.
+func ExtractBundleLimited(filename string, outDir string, maxSize int64) error {
 	fileReader, err := os.Open(filename)
 	if err != nil {
 		return errors.Wrap(err, "failed to open input file")
 	}
+	defer fileReader.Close()
 
 	gzf, err := gzip.NewReader(fileReader)
 	if err != nil {
@@ -28,6 +57,10 @@ func ExtractBundle(filename string, outDir string) error {
 
 	tarReader := tar.NewReader(gzf)
 
+	// Extracted files by content and by name in the archive
+	extracted := map[[sha256.Size]byte]string{}
+	names := map[string]string{}
+	var size int64
 	for {
 		header, err := tarReader.Next()
 
@@ -39,31 +72,79 @@ func ExtractBundle(filename string, outDir string) error {
 			return errors.Wrap(err, "failed to read tar header")
 		}
 
-		if header.Typeflag != tar.TypeReg {
+		// Archives can be uploaded to hosted servers, files must not be written outside of outDir
+		if !filepath.IsLocal(filepath.FromSlash(header.Name)) {
+			return errors.Errorf("archive has file outside of it: %s", header.Name)
+		}
+		outFilename := filepath.Join(outDir, header.Name) // nolint: gosec // the name is checked to be local above
+
+		switch header.Typeflag {
+		case tar.TypeLink, tar.TypeSymlink:
+			// Links are only made to files extracted from the archive, never to files outside of it
+			target := path.Clean(header.Linkname)
+			if header.Typeflag == tar.TypeSymlink {
+				target = path.Join(path.Dir(path.Clean(header.Name)), header.Linkname)
+			}
+			if path.IsAbs(header.Linkname) || !filepath.IsLocal(filepath.FromSlash(target)) {
+				return errors.Errorf("archive has link outside of it: %s -> %s", header.Name, header.Linkname)
+			}
+			if existing, ok := names[target]; ok {
+				if err := linkExtractedFile(existing, outFilename); err != nil {
+					return err
+				}
+				names[path.Clean(header.Name)] = outFilename
+			}
 			continue
+		case tar.TypeReg:
+		default:
+			continue
+		}
+
+		// The tar reader returns exactly the size in the header of each file
+		size += header.Size
+		if maxSize > 0 && size > maxSize {
+			return errors.Wrapf(ErrBundleTooLarge, "files add up to more than %d bytes", maxSize)
 		}
 
 		err = func() error {
-			outFilename := filepath.Join(outDir, header.Name) // nolint: gosec // ignore decompression bombs
 			outPath := filepath.Dir(outFilename)
 			err = os.MkdirAll(outPath, 0755)
 			if err != nil {
 				return errors.Wrap(err, "failed to create file path")
 			}
 
+			// Files with the same name as an earlier entry replace it, rather than being written
+			// through a link to another file
+			if err := os.Remove(outFilename); err != nil && !os.IsNotExist(err) {
+				return errors.Wrap(err, "failed to replace file")
+			}
 			outFile, err := os.Create(outFilename)
 			if err != nil {
 				return errors.Wrap(err, "failed to create output file")
 			}
 			defer outFile.Close()
 
-			// ignore decompression bombs
-			_, err = io.Copy(outFile, tarReader) // nolint: gosec // ignore decompression bombs)
+			hash := sha256.New()
+			_, err = io.CopyN(io.MultiWriter(outFile, hash), tarReader, header.Size)
 			if err != nil {
 				return errors.Wrap(err, "failed to copy file")
 			}
+			names[path.Clean(header.Name)] = outFilename
 
-			return nil
+			if header.Size == 0 {
+				return nil
+			}
+			var sum [sha256.Size]byte
+			copy(sum[:], hash.Sum(nil))
+			existing, ok := extracted[sum]
+			if !ok {
+				extracted[sum] = outFilename
+				return nil
+			}
+			if err := outFile.Close(); err != nil {
+				return errors.Wrap(err, "failed to close output file")
+			}
+			return linkExtractedFile(existing, outFilename)
 		}()
 
 		if err != nil {
@@ -72,8 +153,80 @@ func ExtractBundle(filename string, outDir string) error {
 	}
 }
 
+// linkExtractedFile replaces the file at newname, if any, with a hard link to the extracted file
+// existing. The file is copied when it cannot be linked.
+func linkExtractedFile(existing string, newname string) error {
+	if err := os.MkdirAll(filepath.Dir(newname), 0755); err != nil {
+		return errors.Wrap(err, "failed to create file path")
+	}
+	tmpName := newname + ".sbctl-link"
+	if err := os.Link(existing, tmpName); err == nil {
+		if err := os.Rename(tmpName, newname); err != nil {
+			_ = os.Remove(tmpName)
+			return errors.Wrap(err, "failed to link file")
+		}
+		return nil
+	}
+
+	// The file system has no hard links, the copy is kept or made
+	if _, err := os.Stat(newname); err == nil {
+		return nil
+	}
+	data, err := os.ReadFile(existing)
+	if err != nil {
+		return errors.Wrap(err, "failed to read file")
+	}
+	if err := os.WriteFile(newname, data, 0644); err != nil {
+		return errors.Wrap(err, "failed to write file")
+	}
+	return nil
+}
+
+// bundleWriter writes files to a gzipped tar archive of a bundle, below a directory named topDir
+// as troubleshoot does. It can be read with ExtractBundle.
+type bundleWriter struct {
+	gzw    *gzip.Writer
+	tw     *tar.Writer
+	topDir string
+	count  int
+}
+
+func newBundleWriter(out io.Writer, topDir string) *bundleWriter {
+	gzw := gzip.NewWriter(out)
+	return &bundleWriter{gzw: gzw, tw: tar.NewWriter(gzw), topDir: topDir}
+}
+
+// WriteFile adds a file at rel, a slash separated path relative to the top directory
+func (w *bundleWriter) WriteFile(rel string, data []byte, modTime time.Time) error {
+	header := &tar.Header{
+		Name:     path.Join(w.topDir, rel),
+		Mode:     0644,
+		Size:     int64(len(data)),
+		ModTime:  modTime,
+		Typeflag: tar.TypeReg,
+	}
+	if err := w.tw.WriteHeader(header); err != nil {
+		return errors.Wrap(err, "failed to write tar header")
+	}
+	if _, err := w.tw.Write(data); err != nil {
+		return errors.Wrapf(err, "failed to write %s", rel)
+	}
+	w.count++
+	return nil
+}
+
+func (w *bundleWriter) Close() error {
+	if err := w.tw.Close(); err != nil {
+		return errors.Wrap(err, "failed to close tar writer")
+	}
+	if err := w.gzw.Close(); err != nil {
+		return errors.Wrap(err, "failed to close gzip writer")
+	}
+	return nil
+}
+
 func FindClusterData(bundlePath string) (ClusterData, error) {
-	result := ClusterData{}
+	result := ClusterData{BundleDir: bundlePath}
 
 	err := filepath.Walk(bundlePath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -81,6 +234,11 @@ func FindClusterData(bundlePath string) (ClusterData, error) {
 		}
 
 		if info.IsDir() {
+			if IsSupportBundleKitDir(path) {
+				if result.SupportBundleKitDir == "" || len(path) < len(result.SupportBundleKitDir) {
+					result.SupportBundleKitDir = path
+				}
+			}
 			if info.Name() == "cluster-resources" {
 				// Support bundle can have multiple cluster-resources directories.
 				// We want the one at the root, so find the file with the shortest name
@@ -90,6 +248,14 @@ func FindClusterData(bundlePath string) (ClusterData, error) {
 			}
 		} else if info.Name() == "cluster_version.json" {
 			result.ClusterInfoFile = path
+		} else if info.Name() == "analysis.json" {
+			if result.AnalysisFile == "" || len(path) < len(result.AnalysisFile) {
+				result.AnalysisFile = path
+			}
+		} else if info.Name() == ExtensionsFileName {
+			if result.ExtensionsFile == "" || len(path) < len(result.ExtensionsFile) {
+				result.ExtensionsFile = path
+			}
 		}
 
 		return nil
@@ -0,0 +1,370 @@
+package sbctl
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+const (
+	WebhookMutating   = "mutating"
+	WebhookValidating = "validating"
+
+	admissionRegistrationGroup = "admissionregistration.k8s.io"
+)
+
+// WebhookTrace is whether the API server calls an admission webhook for a request
+type WebhookTrace struct {
+	Type          string `json:"type"`
+	Configuration string `json:"configuration"`
+	Webhook       string `json:"webhook"`
+	Called        bool   `json:"called"`
+	// Reason is why the webhook is not called, or what could not be evaluated offline when it is
+	Reason         string `json:"reason,omitempty"`
+	FailurePolicy  string `json:"failurePolicy"`
+	TimeoutSeconds int32  `json:"timeoutSeconds"`
+	Backend        string `json:"backend"`
+	// BackendIssue is set when the Service of the webhook is missing or has no ready endpoints
+	BackendIssue string `json:"backendIssue,omitempty"`
+}
+
+// WebhookTracer evaluates the webhook configurations of a bundle against objects, as the API
+// server does when they are created, updated or deleted
+type WebhookTracer struct {
+	mutating   []admissionregistrationv1.MutatingWebhookConfiguration
+	validating []admissionregistrationv1.ValidatingWebhookConfiguration
+	namespaces map[string]map[string]string
+	mapper     *RESTMapper
+	services   []corev1.Service
+	endpoints  []corev1.Endpoints
+	slices     []discoveryv1.EndpointSlice
+}
+
+// LoadWebhookTracer reads the webhook configurations of a bundle with the namespaces, Services
+// and endpoints needed to evaluate them
+func LoadWebhookTracer(clusterData ClusterData) (*WebhookTracer, error) {
+	t := &WebhookTracer{namespaces: map[string]map[string]string{}}
+
+	var err error
+	t.mutating, err = ListTypedResources[admissionregistrationv1.MutatingWebhookConfiguration](clusterData, admissionRegistrationGroup, "mutatingwebhookconfigurations")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list mutating webhook configurations")
+	}
+	t.validating, err = ListTypedResources[admissionregistrationv1.ValidatingWebhookConfiguration](clusterData, admissionRegistrationGroup, "validatingwebhookconfigurations")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list validating webhook configurations")
+	}
+	namespaces, err := ListTypedResources[corev1.Namespace](clusterData, "", "namespaces")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list namespaces")
+	}
+	for _, ns := range namespaces {
+		t.namespaces[ns.Name] = ns.Labels
+	}
+	t.mapper, err = LoadRESTMapper(clusterData)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load API resources")
+	}
+	t.services, err = ListTypedResources[corev1.Service](clusterData, "", "services")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list services")
+	}
+	t.endpoints, err = ListTypedResources[corev1.Endpoints](clusterData, "", "endpoints")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list endpoints")
+	}
+	t.slices, err = ListTypedResources[discoveryv1.EndpointSlice](clusterData, "discovery.k8s.io", "endpointslices")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list endpointslices")
+	}
+
+	// Mutating webhooks are called one after another in the order of their configurations' names,
+	// validating webhooks are called in parallel after them
+	sort.SliceStable(t.mutating, func(i, j int) bool {
+		return t.mutating[i].Name < t.mutating[j].Name
+	})
+	sort.SliceStable(t.validating, func(i, j int) bool {
+		return t.validating[i].Name < t.validating[j].Name
+	})
+	return t, nil
+}
+
+// webhookRequest is what of a request webhooks are matched against
+type webhookRequest struct {
+	operation       admissionregistrationv1.OperationType
+	resource        schema.GroupVersionResource
+	namespaced      bool
+	namespaceLabels labels.Set
+	objectLabels    labels.Set
+}
+
+// Trace returns the webhooks of the bundle in the order they are called, with whether they are
+// called for operation on obj. Match conditions, which are CEL expressions, are not evaluated.
+func (t *WebhookTracer) Trace(obj unstructured.Unstructured, operation string) ([]WebhookTrace, error) {
+	gvk := obj.GroupVersionKind()
+	if gvk.Kind == "" {
+		return nil, errors.Errorf("object %q has no kind", obj.GetName())
+	}
+	gvr, err := t.mapper.ResourceForKind(gvk.GroupKind())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find the resource of %s", gvk.Kind)
+	}
+	namespaced, err := t.mapper.IsNamespaced(gvk.GroupKind())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find the scope of %s", gvk.Kind)
+	}
+
+	req := webhookRequest{
+		operation:    admissionregistrationv1.OperationType(strings.ToUpper(operation)),
+		resource:     gvr.GroupResource().WithVersion(gvk.Version),
+		namespaced:   namespaced,
+		objectLabels: labels.Set(obj.GetLabels()),
+	}
+	switch {
+	case namespaced:
+		namespace := obj.GetNamespace()
+		if namespace == "" {
+			namespace = metav1.NamespaceDefault
+		}
+		req.namespaceLabels = t.namespaceLabels(namespace)
+	case gvk.Group == "" && gvk.Kind == "Namespace":
+		req.namespaceLabels = t.namespaceLabels(obj.GetName())
+		for k, v := range obj.GetLabels() {
+			req.namespaceLabels[k] = v
+		}
+	}
+
+	traces := []WebhookTrace{}
+	for _, c := range t.mutating {
+		for _, w := range c.Webhooks {
+			trace := t.newTrace(WebhookMutating, c.Name, w.Name, w.FailurePolicy, w.TimeoutSeconds, w.ClientConfig)
+			trace.Called, trace.Reason = req.matches(w.Rules, w.MatchPolicy, w.NamespaceSelector, w.ObjectSelector, len(w.MatchConditions))
+			traces = append(traces, trace)
+		}
+	}
+	for _, c := range t.validating {
+		for _, w := range c.Webhooks {
+			trace := t.newTrace(WebhookValidating, c.Name, w.Name, w.FailurePolicy, w.TimeoutSeconds, w.ClientConfig)
+			trace.Called, trace.Reason = req.matches(w.Rules, w.MatchPolicy, w.NamespaceSelector, w.ObjectSelector, len(w.MatchConditions))
+			traces = append(traces, trace)
+		}
+	}
+	return traces, nil
+}
+
+// namespaceLabels returns the labels of a namespace. Namespaces missing from the bundle have the
+// name label every namespace gets.
+func (t *WebhookTracer) namespaceLabels(namespace string) labels.Set {
+	set := labels.Set{corev1.LabelMetadataName: namespace}
+	for k, v := range t.namespaces[namespace] {
+		set[k] = v
+	}
+	return set
+}
+
+func (t *WebhookTracer) newTrace(webhookType string, configuration string, webhook string, failurePolicy *admissionregistrationv1.FailurePolicyType, timeoutSeconds *int32, clientConfig admissionregistrationv1.WebhookClientConfig) WebhookTrace {
+	trace := WebhookTrace{
+		Type:           webhookType,
+		Configuration:  configuration,
+		Webhook:        webhook,
+		FailurePolicy:  string(admissionregistrationv1.Fail),
+		TimeoutSeconds: 10,
+	}
+	if failurePolicy != nil {
+		trace.FailurePolicy = string(*failurePolicy)
+	}
+	if timeoutSeconds != nil {
+		trace.TimeoutSeconds = *timeoutSeconds
+	}
+
+	if clientConfig.URL != nil {
+		trace.Backend = *clientConfig.URL
+		return trace
+	}
+	svc := clientConfig.Service
+	if svc == nil {
+		trace.BackendIssue = "no service or URL"
+		return trace
+	}
+	port := int32(443)
+	if svc.Port != nil {
+		port = *svc.Port
+	}
+	trace.Backend = fmt.Sprintf("%s/%s:%d", svc.Namespace, svc.Name, port)
+	if svc.Path != nil {
+		trace.Backend += *svc.Path
+	}
+	trace.BackendIssue = t.serviceIssue(svc.Namespace, svc.Name)
+	return trace
+}
+
+// serviceIssue returns why requests to a webhook's Service fail, or an empty string when it has
+// ready endpoints
+func (t *WebhookTracer) serviceIssue(namespace string, name string) string {
+	found := false
+	for _, svc := range t.services {
+		if svc.Namespace == namespace && svc.Name == name {
+			found = true
+			if svc.Spec.Type == corev1.ServiceTypeExternalName {
+				return ""
+			}
+			break
+		}
+	}
+	if !found {
+		return "service not found"
+	}
+
+	for _, e := range t.endpoints {
+		if e.Namespace != namespace || e.Name != name {
+			continue
+		}
+		for _, subset := range e.Subsets {
+			if len(subset.Addresses) > 0 {
+				return ""
+			}
+		}
+	}
+	for _, s := range t.slices {
+		if s.Namespace != namespace || s.Labels[discoveryv1.LabelServiceName] != name {
+			continue
+		}
+		for _, e := range s.Endpoints {
+			if (e.Conditions.Ready == nil || *e.Conditions.Ready) && len(e.Addresses) > 0 {
+				return ""
+			}
+		}
+	}
+	return "no ready endpoints"
+}
+
+// matches returns whether a webhook is called for the request, and why not. With the default
+// Equivalent match policy, rules match any version of the resource, since the API server converts
+// requests to a version the webhook accepts.
+func (r webhookRequest) matches(rules []admissionregistrationv1.RuleWithOperations, policy *admissionregistrationv1.MatchPolicyType, namespaceSelector *metav1.LabelSelector, objectSelector *metav1.LabelSelector, matchConditions int) (bool, string) {
+	// The API server does not call webhooks for webhook configurations, so that they cannot lock themselves in
+	if r.resource.Group == admissionRegistrationGroup && strings.HasSuffix(r.resource.Resource, "webhookconfigurations") {
+		return false, "webhooks are not called for webhook configurations"
+	}
+
+	equivalent := policy == nil || *policy == admissionregistrationv1.Equivalent
+	matched := false
+	for _, rule := range rules {
+		if r.matchesRule(rule, equivalent) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return false, fmt.Sprintf("no rule matches %s %s", r.operation, r.resource.GroupResource())
+	}
+
+	if r.namespaceLabels != nil {
+		if ok, err := selectorMatches(namespaceSelector, r.namespaceLabels); err != nil {
+			return false, fmt.Sprintf("invalid namespaceSelector: %v", err)
+		} else if !ok {
+			return false, "namespaceSelector does not match the namespace"
+		}
+	}
+	if ok, err := selectorMatches(objectSelector, r.objectLabels); err != nil {
+		return false, fmt.Sprintf("invalid objectSelector: %v", err)
+	} else if !ok {
+		return false, "objectSelector does not match the object"
+	}
+
+	if matchConditions > 0 {
+		return true, fmt.Sprintf("%d match conditions not evaluated", matchConditions)
+	}
+	return true, ""
+}
+
+func (r webhookRequest) matchesRule(rule admissionregistrationv1.RuleWithOperations, equivalent bool) bool {
+	operationMatches := false
+	for _, op := range rule.Operations {
+		if op == r.operation || op == admissionregistrationv1.OperationAll {
+			operationMatches = true
+		}
+	}
+	if !operationMatches {
+		return false
+	}
+
+	if !containsString(rule.APIGroups, r.resource.Group) && !containsString(rule.APIGroups, "*") {
+		return false
+	}
+	if !equivalent && !containsString(rule.APIVersions, r.resource.Version) && !containsString(rule.APIVersions, "*") {
+		return false
+	}
+	if !containsString(rule.Resources, r.resource.Resource) && !containsString(rule.Resources, "*") && !containsString(rule.Resources, "*/*") {
+		return false
+	}
+
+	if rule.Scope != nil {
+		switch *rule.Scope {
+		case admissionregistrationv1.ClusterScope:
+			return !r.namespaced
+		case admissionregistrationv1.NamespacedScope:
+			return r.namespaced
+		}
+	}
+	return true
+}
+
+// selectorMatches is whether set matches a webhook's selector. Unlike LabelSelectorAsSelector, a
+// missing selector matches everything.
+func selectorMatches(selector *metav1.LabelSelector, set labels.Set) (bool, error) {
+	if selector == nil {
+		return true, nil
+	}
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return false, err
+	}
+	return s.Matches(set), nil
+}
+
+// ReadManifestObjects reads the objects of a YAML or JSON manifest with any number of documents.
+// Items of List objects are returned as separate objects.
+func ReadManifestObjects(r io.Reader) ([]unstructured.Unstructured, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read manifest")
+	}
+
+	objects := []unstructured.Unstructured{}
+	decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	for {
+		obj := unstructured.Unstructured{}
+		if err := decoder.Decode(&obj.Object); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrap(err, "failed to decode manifest")
+		}
+		if len(obj.Object) == 0 {
+			continue
+		}
+
+		if !obj.IsList() {
+			objects = append(objects, obj)
+			continue
+		}
+		list, err := obj.ToList()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decode list in manifest")
+		}
+		objects = append(objects, list.Items...)
+	}
+	return objects, nil
+}
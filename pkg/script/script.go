@@ -0,0 +1,274 @@
+// Package script runs Starlark scripts against a support bundle, for analyses too ad-hoc to be
+// written as analyzers
+package script
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/api"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"go.starlark.net/starlark"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Runner runs scripts with the bundle query primitives list, get, logs and events predeclared
+type Runner struct {
+	clusterData sbctl.ClusterData
+	mapper      *sbctl.RESTMapper
+	out         io.Writer
+}
+
+func NewRunner(clusterData sbctl.ClusterData, out io.Writer) (*Runner, error) {
+	mapper, err := sbctl.LoadRESTMapper(clusterData)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load API resources")
+	}
+	return &Runner{clusterData: clusterData, mapper: mapper, out: out}, nil
+}
+
+// Run executes a script. args are available to it as the args list. Errors of the script are
+// returned with the Starlark backtrace.
+func (r *Runner) Run(fileName string, src []byte, args []string) error {
+	thread := &starlark.Thread{
+		Name: fileName,
+		Print: func(_ *starlark.Thread, msg string) {
+			fmt.Fprintln(r.out, msg)
+		},
+	}
+
+	scriptArgs := []starlark.Value{}
+	for _, a := range args {
+		scriptArgs = append(scriptArgs, starlark.String(a))
+	}
+	predeclared := starlark.StringDict{
+		"args":   starlark.NewList(scriptArgs),
+		"list":   starlark.NewBuiltin("list", r.list),
+		"get":    starlark.NewBuiltin("get", r.get),
+		"logs":   starlark.NewBuiltin("logs", r.logs),
+		"events": starlark.NewBuiltin("events", r.events),
+	}
+
+	if _, err := starlark.ExecFile(thread, fileName, src, predeclared); err != nil {
+		if evalErr, ok := err.(*starlark.EvalError); ok {
+			return errors.New(evalErr.Backtrace())
+		}
+		return err
+	}
+	return nil
+}
+
+// list(resource, namespace="") returns the objects of a resource, such as pods or deployments.apps
+func (r *Runner) list(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var resource, namespace string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "resource", &resource, "namespace?", &namespace); err != nil {
+		return nil, err
+	}
+
+	objects, err := r.listObjects(resource, namespace)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]starlark.Value, 0, len(objects))
+	for _, o := range objects {
+		v, err := toStarlark(o.Object)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return starlark.NewList(values), nil
+}
+
+// get(resource, name, namespace="") returns an object, or None when the bundle does not have it
+func (r *Runner) get(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var resource, name, namespace string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "resource", &resource, "name", &name, "namespace?", &namespace); err != nil {
+		return nil, err
+	}
+
+	objects, err := r.listObjects(resource, namespace)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range objects {
+		if o.GetName() == name {
+			return toStarlark(o.Object)
+		}
+	}
+	return starlark.None, nil
+}
+
+// logs(pod, namespace="default", container="", previous=False, tail=-1) returns the lines of a
+// container's log. The first container of the pod is used when container is not set.
+func (r *Runner) logs(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pod, container string
+	namespace := "default"
+	previous := false
+	tail := -1
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "pod", &pod, "namespace?", &namespace, "container?", &container, "previous?", &previous, "tail?", &tail); err != nil {
+		return nil, err
+	}
+
+	logDir := filepath.Join(r.clusterData.ClusterResourcesDir, "pods", "logs", namespace, pod)
+	if container == "" {
+		containers, err := logContainers(logDir)
+		if err != nil {
+			return nil, err
+		}
+		if len(containers) == 0 {
+			return nil, errors.Errorf("%s: no logs of pod %s/%s in support bundle", fn.Name(), namespace, pod)
+		}
+		container = containers[0]
+	}
+	fileName := filepath.Join(logDir, container+".log")
+	if previous {
+		fileName = filepath.Join(logDir, container+"-previous.log")
+	}
+
+	opts := api.NewLogOptions()
+	opts.TailLines = int64(tail)
+	f, err := api.OpenLog(fileName, opts)
+	if os.IsNotExist(err) {
+		return starlark.NewList(nil), nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "%s: failed to open log", fn.Name())
+	}
+	defer f.Close()
+
+	lines := []starlark.Value{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, starlark.String(scanner.Text()))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "%s: failed to read log", fn.Name())
+	}
+	return starlark.NewList(lines), nil
+}
+
+// events(namespace="", kind="", name="") returns the events of a namespace, or of all namespaces,
+// optionally only the ones about an object
+func (r *Runner) events(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var namespace, kind, name string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "namespace?", &namespace, "kind?", &kind, "name?", &name); err != nil {
+		return nil, err
+	}
+
+	events, err := r.listObjects("events", namespace)
+	if err != nil {
+		return nil, err
+	}
+	values := []starlark.Value{}
+	for _, e := range events {
+		involvedKind, _, _ := unstructured.NestedString(e.Object, "involvedObject", "kind")
+		involvedName, _, _ := unstructured.NestedString(e.Object, "involvedObject", "name")
+		if (kind != "" && !strings.EqualFold(kind, involvedKind)) || (name != "" && name != involvedName) {
+			continue
+		}
+		v, err := toStarlark(e.Object)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return starlark.NewList(values), nil
+}
+
+func (r *Runner) listObjects(resource string, namespace string) ([]unstructured.Unstructured, error) {
+	gvr, err := r.mapper.ResourceFor(resource)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := sbctl.ListResources(r.clusterData, gvr.Group, gvr.Resource)
+	if err != nil {
+		return nil, err
+	}
+	if namespace == "" {
+		return objects, nil
+	}
+
+	filtered := []unstructured.Unstructured{}
+	for _, o := range objects {
+		if o.GetNamespace() == namespace {
+			filtered = append(filtered, o)
+		}
+	}
+	return filtered, nil
+}
+
+// logContainers returns the containers a pod's log directory has current logs of, sorted by name
+func logContainers(logDir string) ([]string, error) {
+	entries, err := os.ReadDir(logDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to read log dir")
+	}
+
+	containers := []string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".log") || strings.HasSuffix(name, "-previous.log") || strings.HasSuffix(name, "-logs-errors.log") {
+			continue
+		}
+		containers = append(containers, strings.TrimSuffix(name, ".log"))
+	}
+	sort.Strings(containers)
+	return containers, nil
+}
+
+// toStarlark converts JSON values, as unstructured objects hold them, to Starlark values
+func toStarlark(v interface{}) (starlark.Value, error) {
+	switch v := v.(type) {
+	case nil:
+		return starlark.None, nil
+	case bool:
+		return starlark.Bool(v), nil
+	case string:
+		return starlark.String(v), nil
+	case int64:
+		return starlark.MakeInt64(v), nil
+	case int:
+		return starlark.MakeInt(v), nil
+	case float64:
+		return starlark.Float(v), nil
+	case []interface{}:
+		values := make([]starlark.Value, 0, len(v))
+		for _, item := range v {
+			value, err := toStarlark(item)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return starlark.NewList(values), nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		dict := starlark.NewDict(len(v))
+		for _, k := range keys {
+			value, err := toStarlark(v[k])
+			if err != nil {
+				return nil, err
+			}
+			if err := dict.SetKey(starlark.String(k), value); err != nil {
+				return nil, err
+			}
+		}
+		return dict, nil
+	default:
+		return nil, errors.Errorf("cannot convert %T to a Starlark value", v)
+	}
+}
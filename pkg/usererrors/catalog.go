@@ -0,0 +1,149 @@
+// Package usererrors is the catalog of errors sbctl reports to users. Every error has a stable
+// code, so that support automation can classify failures without parsing messages, which may be
+// reworded or translated. Messages are only written here, keyed by code.
+package usererrors
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// Code identifies a kind of failure. Codes are never renamed or reused once released.
+type Code string
+
+const (
+	// Unclassified is the code of errors that are not in the catalog
+	Unclassified Code = "UNCLASSIFIED"
+
+	BundleLocationRequired Code = "BUNDLE_LOCATION_REQUIRED"
+	BundleNotFound         Code = "BUNDLE_NOT_FOUND"
+	BundleExtractFailed    Code = "BUNDLE_EXTRACT_FAILED"
+	BundleDownloadFailed   Code = "BUNDLE_DOWNLOAD_FAILED"
+	BundleTokenRequired    Code = "BUNDLE_TOKEN_REQUIRED"
+	BundleConvertFailed    Code = "BUNDLE_CONVERT_FAILED"
+	UnknownResource        Code = "UNKNOWN_RESOURCE"
+	InvalidArgument        Code = "INVALID_ARGUMENT"
+	MissingArgument        Code = "MISSING_ARGUMENT"
+	ServerStartFailed      Code = "SERVER_START_FAILED"
+)
+
+type entry struct {
+	// Message is a format string for the arguments given to New
+	Message string
+	// Hint tells the user what to do about the error
+	Hint string
+}
+
+var catalog = map[Code]entry{
+	BundleLocationRequired: {
+		Message: "support bundle location is required",
+		Hint:    "pass the bundle with --support-bundle-location, or as an argument where the command accepts one",
+	},
+	BundleNotFound: {
+		Message: "support bundle %s not found",
+		Hint:    "check the path, or pass the URL of a bundle on the vendor portal",
+	},
+	BundleExtractFailed: {
+		Message: "failed to extract support bundle %s",
+		Hint:    "check that the archive is a complete .tar.gz support bundle",
+	},
+	BundleDownloadFailed: {
+		Message: "failed to download support bundle %s",
+		Hint:    "check the URL and the token, or download the bundle and pass the archive",
+	},
+	BundleTokenRequired: {
+		Message: "a token is required to download support bundles",
+		Hint:    "pass an API token with --token, or log in to the portal with sbctl login",
+	},
+	BundleConvertFailed: {
+		Message: "failed to convert support-bundle-kit bundle",
+	},
+	UnknownResource: {
+		Message: "the server doesn't have a resource type %q",
+		Hint:    "resources the cluster served are listed by kubectl api-resources in sbctl shell",
+	},
+	InvalidArgument: {
+		Message: "invalid %s",
+		Hint:    "run the command with --help for the accepted values",
+	},
+	MissingArgument: {
+		Message: "%s is required",
+		Hint:    "run the command with --help for its flags",
+	},
+	ServerStartFailed: {
+		Message: "failed to start the API server",
+		Hint:    "when --port is set, check that no other process listens on it",
+	},
+}
+
+// Error is an error of the catalog, with the error that caused it
+type Error struct {
+	Code    Code
+	Message string
+	Cause   error
+}
+
+func (e *Error) Error() string {
+	if e.Cause == nil {
+		return e.Message
+	}
+	return e.Message + ": " + e.Cause.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// New returns an error of the catalog. args are formatted into the message of the code.
+func New(code Code, cause error, args ...interface{}) *Error {
+	message := string(code)
+	if e, ok := catalog[code]; ok {
+		message = fmt.Sprintf(e.Message, args...)
+	}
+	return &Error{Code: code, Message: message, Cause: cause}
+}
+
+// CodeOf returns the code of the first error of the catalog in the chain of err, or
+// Unclassified when there is none
+func CodeOf(err error) Code {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return Unclassified
+}
+
+// jsonError is how errors are written for machines
+type jsonError struct {
+	Code    Code   `json:"code"`
+	Message string `json:"message"`
+	Hint    string `json:"hint,omitempty"`
+	// Details is the whole error, including its causes
+	Details string `json:"details,omitempty"`
+}
+
+// JSON returns err as a JSON object with its code, message and the hint of the catalog
+func JSON(err error) ([]byte, error) {
+	result := jsonError{Code: Unclassified, Message: err.Error()}
+	var e *Error
+	if errors.As(err, &e) {
+		result.Code = e.Code
+		result.Message = e.Message
+		result.Hint = catalog[e.Code].Hint
+		if details := err.Error(); details != e.Message {
+			result.Details = details
+		}
+	}
+	return json.Marshal(result)
+}
+
+// Hint returns what the user can do about err, or an empty string
+func Hint(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return catalog[e.Code].Hint
+	}
+	return ""
+}
@@ -0,0 +1,65 @@
+package util
+
+import (
+	"crypto/rand"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// ShredDir overwrites every file in dir with random data and then removes dir. This is best
+// effort: copy-on-write and journaling file systems, SSD wear leveling and backups can keep copies
+// of the data that overwriting does not reach. All files are overwritten even when some fail, and
+// the first error is returned.
+func ShredDir(dir string) error {
+	var firstErr error
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if err := shredFile(path); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		return nil
+	})
+	if err != nil && firstErr == nil {
+		firstErr = err
+	}
+
+	if err := os.RemoveAll(dir); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+// shredFile overwrites a file with random data and truncates it, leaving it to be removed
+func shredFile(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open %s", path)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return errors.Wrapf(err, "failed to stat %s", path)
+	}
+	if _, err := io.CopyN(f, rand.Reader, info.Size()); err != nil {
+		return errors.Wrapf(err, "failed to overwrite %s", path)
+	}
+	if err := f.Sync(); err != nil {
+		return errors.Wrapf(err, "failed to sync %s", path)
+	}
+	if err := f.Truncate(0); err != nil {
+		return errors.Wrapf(err, "failed to truncate %s", path)
+	}
+	return nil
+}
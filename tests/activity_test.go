@@ -0,0 +1,26 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/api"
+)
+
+var _ = Describe("Inactivity", func() {
+	It("Is reset by requests, but not by readiness checks", func() {
+		_, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/api/v1", apiServerEndpoint), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(api.IdleTime()).To(BeNumerically("<", time.Second))
+
+		time.Sleep(50 * time.Millisecond)
+		_, statusCode, err = HTTPExec("GET", fmt.Sprintf("%s/readyz", apiServerEndpoint), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(api.IdleTime()).To(BeNumerically(">=", 50*time.Millisecond))
+	})
+})
@@ -0,0 +1,36 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GET /apis/troubleshoot.sh/v1beta2/analysisresults", func() {
+	Context("When getting the analyzer results stored in the bundle", func() {
+		It("Returns all results", func() {
+			resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/apis/troubleshoot.sh/v1beta2/analysisresults", apiServerEndpoint), getHeaders)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(statusCode).To(Equal(http.StatusOK))
+			Expect(resp).To(ContainSubstring(`"kind":"AnalysisResultList"`))
+			Expect(resp).To(ContainSubstring(`"name":"kubernetes.version"`))
+			Expect(resp).To(ContainSubstring(`"outcome":"fail"`))
+		})
+
+		It("Returns a single result by name", func() {
+			resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/apis/troubleshoot.sh/v1beta2/analysisresults/velero.deployment.status", apiServerEndpoint), getHeaders)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(statusCode).To(Equal(http.StatusOK))
+			Expect(resp).To(ContainSubstring("The velero deployment does not have any ready replicas"))
+		})
+
+		It("Lists the resource in discovery", func() {
+			resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/apis/troubleshoot.sh/v1beta2", apiServerEndpoint), getHeaders)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(statusCode).To(Equal(http.StatusOK))
+			Expect(resp).To(ContainSubstring(`"name":"analysisresults"`))
+		})
+	})
+})
@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+)
+
+// podCountAnalyzer fails when a bundle has no pods
+type podCountAnalyzer struct{}
+
+func (podCountAnalyzer) Name() string {
+	return "pod-count"
+}
+
+func (podCountAnalyzer) Analyze(ctx context.Context, bundle sbctl.BundleReader) ([]sbctl.AnalysisResult, error) {
+	pods, err := bundle.ListResources(ctx, "", "pods")
+	if err != nil {
+		return nil, err
+	}
+	severity := "debug"
+	if len(pods) == 0 {
+		severity = "error"
+	}
+	return []sbctl.AnalysisResult{{Name: "pod-count", Severity: severity}}, nil
+}
+
+var _ = Describe("Analyzers", func() {
+	It("Serves analyzers over the external analyzer protocol", func() {
+		clusterData, err := sbctl.FindClusterData("./support-bundle")
+		Expect(err).NotTo(HaveOccurred())
+
+		request, err := json.Marshal(sbctl.AnalyzerRequest{
+			ProtocolVersion:     sbctl.AnalyzerProtocolVersion,
+			BundleDir:           clusterData.BundleDir,
+			ClusterResourcesDir: clusterData.ClusterResourcesDir,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		out := &bytes.Buffer{}
+		Expect(sbctl.ServeAnalyzer(context.Background(), podCountAnalyzer{}, bytes.NewReader(request), out)).To(Succeed())
+
+		results := []sbctl.AnalysisResult{}
+		Expect(json.Unmarshal(out.Bytes(), &results)).To(Succeed())
+		Expect(results).To(HaveLen(1))
+		Expect(results[0].Outcome()).To(Equal("pass"))
+	})
+
+	It("Rejects requests of other protocol versions", func() {
+		err := sbctl.ServeAnalyzer(context.Background(), podCountAnalyzer{}, bytes.NewReader([]byte(`{"protocolVersion":"v0"}`)), &bytes.Buffer{})
+		Expect(err).To(MatchError(ContainSubstring("unsupported analyzer protocol version")))
+	})
+
+	It("Keeps reads inside the bundle", func() {
+		bundle := sbctl.NewBundleReader(sbctl.ClusterData{BundleDir: GinkgoT().TempDir()})
+		_, err := bundle.ReadFile("../secret")
+		Expect(err).To(MatchError(ContainSubstring("outside of the support bundle")))
+	})
+
+	It("Finds and runs external analyzers", func() {
+		first, second := GinkgoT().TempDir(), GinkgoT().TempDir()
+		script := "#!/bin/sh\ncat > /dev/null\necho '[{\"severity\": \"error\", \"insight\": {\"primary\": \"License expired\"}}]'\n"
+		Expect(os.WriteFile(filepath.Join(first, "sbctl-analyzer-license"), []byte(script), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(second, "sbctl-analyzer-license"), []byte(script), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(second, "sbctl-analyzer-notes.txt"), []byte("not executable"), 0644)).To(Succeed())
+
+		analyzers := sbctl.FindExternalAnalyzers([]string{filepath.Join(first, "missing"), first, second})
+		Expect(analyzers).To(Equal([]sbctl.ExternalAnalyzer{{Path: filepath.Join(first, "sbctl-analyzer-license")}}))
+		Expect(analyzers[0].Name()).To(Equal("license"))
+
+		results, err := analyzers[0].Analyze(context.Background(), sbctl.NewBundleReader(sbctl.ClusterData{BundleDir: first}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(results).To(HaveLen(1))
+		Expect(results[0].Name).To(Equal("license"))
+		Expect(results[0].Outcome()).To(Equal("fail"))
+		Expect(results[0].Title()).To(Equal("License expired"))
+	})
+})
@@ -0,0 +1,106 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+)
+
+var _ = Describe("Audit logs", func() {
+	getAudit := func(query string) []map[string]interface{} {
+		resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/sbctl/v1/audit?%s", apiServerEndpoint, query), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+
+		events := []map[string]interface{}{}
+		Expect(json.Unmarshal([]byte(resp), &events)).To(Succeed())
+		return events
+	}
+
+	It("Returns each request once, at its last stage", func() {
+		events := getAudit("")
+		Expect(events).To(HaveLen(3))
+		Expect(events[1]).To(HaveKeyWithValue("auditID", "5d6e7f80-91a2-4b3c-8d4e-5f6071829304"))
+		Expect(events[1]).To(HaveKeyWithValue("stage", "ResponseComplete"))
+	})
+
+	It("Finds who deleted an object", func() {
+		events := getAudit("verb=delete&resource=configmaps&namespace=velero")
+		Expect(events).To(HaveLen(1))
+		Expect(events[0]).To(HaveKeyWithValue("user", HaveKeyWithValue("username", "kubernetes-admin")))
+		Expect(events[0]).To(HaveKeyWithValue("objectRef", HaveKeyWithValue("name", "restore-settings")))
+	})
+
+	It("Filters by user pattern and time", func() {
+		events := getAudit("user=system:serviceaccount:*")
+		Expect(events).To(HaveLen(1))
+		Expect(events[0]).To(HaveKeyWithValue("verb", "list"))
+
+		events = getAudit("user=admin&since=2023-03-08T00:45:00Z")
+		Expect(events).To(HaveLen(1))
+		Expect(events[0]).To(HaveKeyWithValue("verb", "create"))
+	})
+
+	It("Rejects invalid times", func() {
+		_, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/sbctl/v1/audit?since=yesterday", apiServerEndpoint), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusBadRequest))
+	})
+
+	It("Indexes each request once and reads the events it selects from the audit logs", func() {
+		clusterData, err := sbctl.FindClusterData("./support-bundle")
+		Expect(err).NotTo(HaveOccurred())
+
+		indexed, err := sbctl.IndexAuditEvents(clusterData)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(indexed).To(HaveLen(3))
+		for i := 1; i < len(indexed); i++ {
+			Expect(indexed[i].Received).NotTo(BeTemporally("<", indexed[i-1].Received))
+		}
+
+		selected := sbctl.FilterAuditEvents(indexed, sbctl.AuditQuery{Verbs: []string{"delete"}})
+		Expect(selected).To(HaveLen(1))
+		events, err := sbctl.ReadAuditEvents(clusterData, selected)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Verb).To(Equal("delete"))
+		Expect(events[0].ObjectRef.Name).To(Equal("restore-settings"))
+
+		// Queries search the index saved with the bundle rather than the audit logs
+		clusterData.Index = &sbctl.BundleIndex{Audit: indexed[:1]}
+		fromIndex, err := sbctl.AuditEvents(clusterData)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fromIndex).To(Equal(indexed[:1]))
+	})
+
+	It("Filters sorted events by time window", func() {
+		start := time.Date(2023, 3, 8, 0, 0, 0, 0, time.UTC)
+		events := []sbctl.IndexedAuditEvent{}
+		for i := 0; i < 6; i++ {
+			events = append(events, sbctl.IndexedAuditEvent{
+				Verb:     []string{"get", "list"}[i%2],
+				Received: start.Add(time.Duration(i) * time.Minute),
+			})
+		}
+		received := func(events []sbctl.IndexedAuditEvent) []time.Time {
+			times := []time.Time{}
+			for _, e := range events {
+				times = append(times, e.Received)
+			}
+			return times
+		}
+
+		Expect(sbctl.FilterAuditEvents(events, sbctl.AuditQuery{})).To(HaveLen(6))
+		Expect(received(sbctl.FilterAuditEvents(events, sbctl.AuditQuery{Since: start.Add(2 * time.Minute), Until: start.Add(4 * time.Minute)}))).
+			To(Equal([]time.Time{start.Add(2 * time.Minute), start.Add(3 * time.Minute), start.Add(4 * time.Minute)}))
+		Expect(received(sbctl.FilterAuditEvents(events, sbctl.AuditQuery{Verbs: []string{"list"}, Since: start.Add(2 * time.Minute)}))).
+			To(Equal([]time.Time{start.Add(3 * time.Minute), start.Add(5 * time.Minute)}))
+		Expect(sbctl.FilterAuditEvents(events, sbctl.AuditQuery{Since: start.Add(time.Hour)})).To(BeEmpty())
+		Expect(sbctl.FilterAuditEvents(events, sbctl.AuditQuery{Since: start.Add(4 * time.Minute), Until: start.Add(time.Minute)})).To(BeEmpty())
+	})
+})
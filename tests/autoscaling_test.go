@@ -0,0 +1,75 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+)
+
+var _ = Describe("Autoscaling", func() {
+	var clusterData sbctl.ClusterData
+
+	BeforeEach(func() {
+		dir := GinkgoT().TempDir()
+		files := map[string]string{
+			"cluster-resources/configmaps/kube-system.json": `{"kind":"ConfigMapList","apiVersion":"v1","items":[{
+				"metadata": {"name": "cluster-autoscaler-status", "namespace": "kube-system"},
+				"data": {"status": "Cluster-autoscaler status at 2024-01-02 10:00:00 +0000 UTC:\nCluster-wide:\n  Health: Healthy\n"}}]}`,
+			"cluster-resources/pods/kube-system.json": `{"kind":"PodList","apiVersion":"v1","items":[{
+				"metadata": {"name": "cluster-autoscaler-abc", "namespace": "kube-system"},
+				"spec": {"nodeName": "node-1", "containers": [{"name": "cluster-autoscaler",
+					"image": "registry.k8s.io/autoscaling/cluster-autoscaler:v1.29.0"}]},
+				"status": {"phase": "Running"}}]}`,
+			"cluster-resources/pods/default.json": `{"kind":"PodList","apiVersion":"v1","items":[{
+				"metadata": {"name": "big-0", "namespace": "default"},
+				"spec": {"containers": [{"name": "big", "image": "nginx"}]},
+				"status": {"phase": "Pending", "conditions": [{"type": "PodScheduled", "status": "False", "reason": "Unschedulable"}]}
+			}, {
+				"metadata": {"name": "batch-0", "namespace": "default",
+					"annotations": {"cluster-autoscaler.kubernetes.io/safe-to-evict": "false"}},
+				"spec": {"nodeName": "node-1", "containers": [{"name": "batch", "image": "busybox"}]},
+				"status": {"phase": "Running"}}]}`,
+			"cluster-resources/pods/logs/kube-system/cluster-autoscaler-abc/cluster-autoscaler.log": "I0102 10:00:00.000000       1 static_autoscaler.go:290] Starting main loop\n" +
+				"E0102 10:00:01.000000       1 static_autoscaler.go:470] Failed to scale up: max node group size reached\n",
+			"cluster-resources/events/default.json": `{"kind":"EventList","apiVersion":"v1","items":[{
+				"metadata": {"name": "big-0.scaleup", "namespace": "default"},
+				"involvedObject": {"kind": "Pod", "name": "big-0", "namespace": "default"},
+				"reason": "NotTriggerScaleUp", "message": "pod didn't trigger scale-up: 1 max node group size reached",
+				"count": 4, "lastTimestamp": "2024-01-02T10:00:02Z"}]}`,
+		}
+		for name, content := range files {
+			fileName := filepath.Join(dir, name)
+			Expect(os.MkdirAll(filepath.Dir(fileName), 0755)).To(Succeed())
+			Expect(os.WriteFile(fileName, []byte(content), 0644)).To(Succeed())
+		}
+		clusterData = sbctl.ClusterData{BundleDir: dir, ClusterResourcesDir: filepath.Join(dir, "cluster-resources")}
+	})
+
+	It("Summarizes scale-up failures and blocking pods", func() {
+		summary, err := sbctl.FindAutoscaling(clusterData)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(summary.Autoscalers).To(Equal([]string{sbctl.AutoscalerClusterAutoscaler}))
+		Expect(summary.ClusterAutoscalerStatus).To(ContainSubstring("Health: Healthy"))
+
+		Expect(summary.ScaleUpFailures).To(HaveLen(1))
+		Expect(summary.ScaleUpFailures[0].Message).To(Equal("Failed to scale up: max node group size reached"))
+		Expect(summary.ScaleUpFailures[0].Object).To(Equal("pod/cluster-autoscaler-abc"))
+		Expect(summary.ScaleUpFailures[0].Source).To(Equal("pods/logs/kube-system/cluster-autoscaler-abc/cluster-autoscaler.log"))
+
+		Expect(summary.PendingPods).To(Equal([]sbctl.AutoscalingPod{
+			{Namespace: "default", Name: "big-0", Reason: "pod didn't trigger scale-up: 1 max node group size reached"},
+		}))
+		Expect(summary.BlockingPods).To(Equal([]sbctl.AutoscalingPod{
+			{Namespace: "default", Name: "batch-0", Node: "node-1", Reason: "cluster-autoscaler.kubernetes.io/safe-to-evict=false"},
+		}))
+	})
+
+	It("Resolves Karpenter resources without discovery data", func() {
+		gvr, err := sbctl.DefaultRESTMapper().ResourceFor("nodeclaims")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(gvr.Group).To(Equal(sbctl.KarpenterGroup))
+	})
+})
@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
+)
+
+var _ = Describe("Batch command", func() {
+	writeBundle := func(dir string, files map[string]string) {
+		for name, content := range files {
+			fileName := filepath.Join(dir, name)
+			Expect(os.MkdirAll(filepath.Dir(fileName), 0755)).To(Succeed())
+			Expect(os.WriteFile(fileName, []byte(content), 0644)).To(Succeed())
+		}
+	}
+
+	var dir string
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+
+		// An archive of the velero namespace of the test bundle
+		clusterData, err := sbctl.FindClusterData("./support-bundle")
+		Expect(err).NotTo(HaveOccurred())
+		f, err := os.Create(filepath.Join(dir, "a.tgz"))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = sbctl.SplitBundle(clusterData, sbctl.SplitOptions{Namespaces: []string{"velero"}}, f, "support-bundle")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(f.Close()).To(Succeed())
+
+		// An extracted bundle
+		writeBundle(filepath.Join(dir, "b"), map[string]string{
+			"cluster-info/cluster_version.json": `{"string": "v1.29.1"}`,
+			"cluster-resources/resources.json": `[{"kind": "APIResourceList", "groupVersion": "apps/v1", "resources": [
+				{"name": "deployments", "namespaced": true, "kind": "Deployment", "verbs": ["get", "list"]}]}]`,
+			"cluster-resources/deployments/default.json": `{"kind": "DeploymentList", "apiVersion": "apps/v1", "items": [
+				{"metadata": {"name": "web", "namespace": "default"},
+					"spec": {"template": {"spec": {"containers": [{"name": "web", "image": "nginx:1.25"}]}}}}]}`,
+		})
+
+		// A broken archive, and files that are not bundles
+		writeBundle(dir, map[string]string{
+			"c.tar.gz":         "not a bundle",
+			"notes.txt":        "bundles of the fleet",
+			"empty/readme.txt": "",
+		})
+	})
+
+	batch := func(args ...string) []map[string]string {
+		out, err := SbctlExec(append([]string{"batch", dir, "--format", "json", "--no-index"}, args...)...)
+		Expect(err).NotTo(HaveOccurred())
+		rows := []map[string]string{}
+		Expect(json.Unmarshal([]byte(out), &rows)).To(Succeed())
+		return rows
+	}
+
+	It("Runs queries in every bundle of a directory", func() {
+		rows := batch("--query", "version,images,find", "--image", "velero/velero:*", "--kind", "deployments", "--name", "web", "--parallel", "2")
+		Expect(rows).To(HaveLen(5))
+
+		Expect(rows[0]).To(Equal(map[string]string{"bundle": "a.tgz", "query": "version", "kind": "Cluster", "details": "v1.23.5"}))
+		Expect(rows[1]).To(HaveKeyWithValue("bundle", "a.tgz"))
+		Expect(rows[1]).To(HaveKeyWithValue("query", "images"))
+		Expect(rows[1]).To(HaveKeyWithValue("name", "velero/velero:v1.7.1"))
+		Expect(rows[1]["details"]).To(ContainSubstring("Deployment velero/velero"))
+		Expect(rows[2]).To(Equal(map[string]string{"bundle": "b", "query": "version", "kind": "Cluster", "details": "v1.29.1"}))
+		Expect(rows[3]).To(Equal(map[string]string{"bundle": "b", "query": "find", "kind": "Deployment", "namespace": "default", "name": "web"}))
+
+		// Bundles that fail to load are reported without stopping the others
+		Expect(rows[4]).To(HaveKeyWithValue("bundle", "c.tar.gz"))
+		Expect(rows[4]).To(HaveKeyWithValue("query", "error"))
+		Expect(rows[4]["details"]).NotTo(BeEmpty())
+	})
+
+	It("Writes the results as CSV", func() {
+		output := filepath.Join(GinkgoT().TempDir(), "fleet.csv")
+		out, err := SbctlExec("batch", dir, "--query", "version", "--no-index", "-o", output)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(BeEmpty())
+
+		data, err := os.ReadFile(output)
+		Expect(err).NotTo(HaveOccurred())
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		Expect(lines).To(HaveLen(4))
+		Expect(lines[0]).To(Equal("bundle,query,kind,namespace,name,details"))
+		Expect(lines[1]).To(Equal("a.tgz,version,Cluster,,,v1.23.5"))
+		Expect(lines[2]).To(Equal("b,version,Cluster,,,v1.29.1"))
+		Expect(lines[3]).To(HavePrefix("c.tar.gz,error,,,,"))
+	})
+
+	It("Rejects unknown queries and directories without bundles", func() {
+		_, err := SbctlExec("batch", dir, "--query", "version,nope")
+		Expect(usererrors.CodeOf(err)).To(Equal(usererrors.InvalidArgument))
+		Expect(err).To(MatchError(`invalid --query: unknown query "nope", must be one of: version, images, checks, analysis, find`))
+
+		_, err = SbctlExec("batch", dir)
+		Expect(usererrors.CodeOf(err)).To(Equal(usererrors.MissingArgument))
+
+		_, err = SbctlExec("batch", filepath.Join(dir, "empty"), "--query", "version")
+		Expect(err).To(MatchError("no support bundles found in " + filepath.Join(dir, "empty")))
+	})
+})
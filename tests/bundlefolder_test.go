@@ -0,0 +1,83 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+)
+
+var _ = Describe("Folders of bundles", func() {
+	// writeBundle writes a bundle with a single Velero backup
+	writeBundle := func(dir string, backup string) sbctl.ClusterData {
+		fileName := filepath.Join(dir, "cluster-resources", "custom-resources", "backups.velero.io", "velero.yaml")
+		Expect(os.MkdirAll(filepath.Dir(fileName), 0755)).To(Succeed())
+		Expect(os.WriteFile(fileName, []byte(`- apiVersion: velero.io/v1
+  kind: Backup
+  metadata:
+    name: `+backup+`
+    namespace: velero
+  status:
+    phase: Completed
+`), 0644)).To(Succeed())
+		clusterData, err := sbctl.FindClusterData(dir)
+		Expect(err).NotTo(HaveOccurred())
+		return clusterData
+	}
+
+	// writeArchive writes an archive of a bundle with a single Velero backup, last modified at modTime
+	writeArchive := func(archive string, backup string, modTime time.Time) {
+		clusterData := writeBundle(GinkgoT().TempDir(), backup)
+		f, err := os.Create(archive)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = sbctl.SplitBundle(clusterData, sbctl.SplitOptions{}, f, "support-bundle-"+backup)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(f.Close()).To(Succeed())
+		Expect(os.Chtimes(archive, modTime, modTime)).To(Succeed())
+	}
+
+	var dir string
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		writeArchive(filepath.Join(dir, "old.tar.gz"), "old-1", time.Now().Add(-48*time.Hour))
+
+		// Commands do not ask which bundle to use unless stdin is a terminal
+		stdin, err := os.CreateTemp("", "sbctl-stdin-")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.Remove, stdin.Name())
+		DeferCleanup(stdin.Close)
+		in := os.Stdin
+		os.Stdin = stdin
+		DeferCleanup(func() { os.Stdin = in })
+	})
+
+	It("Uses the only bundle archive in a folder", func() {
+		out, err := SbctlExec("velero", "-s", dir, "--no-index", "--log-errors", "0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(ContainSubstring("old-1"))
+	})
+
+	It("Uses the most recently modified bundle archive with --latest", func() {
+		writeArchive(filepath.Join(dir, "new.tgz"), "new-1", time.Now().Add(-time.Hour))
+
+		out, err := SbctlExec("velero", "-s", dir, "--no-index", "--log-errors", "0", "--latest")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(ContainSubstring("new-1"))
+		Expect(out).NotTo(ContainSubstring("old-1"))
+
+		_, err = SbctlExec("velero", "-s", dir, "--no-index", "--log-errors", "0")
+		Expect(err).To(MatchError(dir + " contains 2 support bundles, pass one of them or use --latest: new.tgz, old.tar.gz"))
+	})
+
+	It("Uses folders that are extracted bundles as is", func() {
+		writeBundle(dir, "extracted-1")
+
+		out, err := SbctlExec("velero", "-s", dir, "--no-index", "--log-errors", "0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(ContainSubstring("extracted-1"))
+		Expect(out).NotTo(ContainSubstring("old-1"))
+	})
+})
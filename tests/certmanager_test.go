@@ -0,0 +1,155 @@
+package tests
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cert-manager command", func() {
+	writeFile := func(fileName string, content string) {
+		Expect(os.MkdirAll(filepath.Dir(fileName), 0755)).To(Succeed())
+		Expect(os.WriteFile(fileName, []byte(content), 0644)).To(Succeed())
+	}
+
+	// certificatePEM returns a self-signed certificate expiring at notAfter
+	certificatePEM := func(notAfter time.Time) string {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: "web.example.com"},
+			NotBefore:    notAfter.Add(-90 * 24 * time.Hour),
+			NotAfter:     notAfter,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		Expect(err).NotTo(HaveOccurred())
+		return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	}
+
+	var dir string
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		resources := filepath.Join(dir, "cluster-resources")
+		writeFile(filepath.Join(resources, "custom-resources", "certificates.cert-manager.io", "web.yaml"), `- apiVersion: cert-manager.io/v1
+  kind: Certificate
+  metadata:
+    name: api-tls
+    namespace: web
+    creationTimestamp: "2024-01-01T00:00:00Z"
+  spec:
+    secretName: api-tls
+    dnsNames: ["api.example.com"]
+  status:
+    conditions:
+    - type: Ready
+      status: "True"
+    notAfter: "2024-07-01T00:00:00Z"
+    renewalTime: "2024-06-01T00:00:00Z"
+- apiVersion: cert-manager.io/v1
+  kind: Certificate
+  metadata:
+    name: web-tls
+    namespace: web
+    creationTimestamp: "2024-02-01T00:00:00Z"
+  spec:
+    secretName: web-tls
+    dnsNames: ["web.example.com"]
+  status:
+    conditions:
+    - type: Ready
+      status: "False"
+      reason: Failed
+      message: issuance failed
+    notAfter: "2024-05-05T12:00:00Z"
+    renewalTime: "2024-04-05T12:00:00Z"
+`)
+		writeFile(filepath.Join(resources, "custom-resources", "challenges.acme.cert-manager.io", "web.yaml"), `- apiVersion: acme.cert-manager.io/v1
+  kind: Challenge
+  metadata:
+    name: web-tls-1-123-0
+    namespace: web
+  spec:
+    dnsName: web.example.com
+  status:
+    state: pending
+    reason: Waiting for HTTP-01 challenge propagation
+- apiVersion: acme.cert-manager.io/v1
+  kind: Challenge
+  metadata:
+    name: api-tls-1-456-0
+    namespace: web
+  spec:
+    dnsName: api.example.com
+  status:
+    state: valid
+`)
+		writeFile(filepath.Join(resources, "events", "web.json"), `{"kind": "EventList", "apiVersion": "v1", "items": [
+			{"metadata": {"name": "web-tls-1.1", "namespace": "web"}, "type": "Warning", "reason": "Failed",
+				"message": "The certificate request has failed to complete and will be retried",
+				"involvedObject": {"kind": "CertificateRequest", "namespace": "web", "name": "web-tls-1"},
+				"lastTimestamp": "2024-05-01T12:00:00Z"},
+			{"metadata": {"name": "api-tls.1", "namespace": "web"}, "type": "Normal", "reason": "Issuing",
+				"message": "The certificate has been successfully issued",
+				"involvedObject": {"kind": "Certificate", "namespace": "web", "name": "api-tls"},
+				"lastTimestamp": "2024-01-01T00:00:00Z"}
+		]}`)
+
+		secret, err := json.Marshal(map[string]string{
+			"namespace": "web",
+			"name":      "web-tls",
+			"key":       "tls.crt",
+			"value":     certificatePEM(time.Date(2024, 4, 30, 12, 0, 0, 0, time.UTC)),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		writeFile(filepath.Join(dir, "secrets", "web", "web-tls", "tls.crt.json"), string(secret))
+	})
+
+	It("Diagnoses certificates relative to when the bundle was collected", func() {
+		out, err := SbctlExec("cert-manager", "-s", dir, "--no-index")
+		Expect(err).NotTo(HaveOccurred())
+
+		sections := strings.Split(strings.TrimSpace(out), "\n\n")
+		Expect(sections).To(HaveLen(2))
+
+		rows := strings.Split(sections[0], "\n")
+		Expect(rows).To(HaveLen(3))
+		Expect(strings.Fields(rows[0])).To(Equal([]string{"NAMESPACE", "CERTIFICATE", "READY", "NOT", "AFTER", "RENEWAL", "TIME", "SECRET", "SECRET", "EXPIRY", "ISSUES"}))
+		Expect(strings.Fields(rows[1])).To(Equal([]string{"web", "api-tls", "True", "2024-07-01T00:00:00Z", "2024-06-01T00:00:00Z", "api-tls", "<unknown>", "0"}))
+		Expect(strings.Fields(rows[2])).To(Equal([]string{"web", "web-tls", "False", "2024-05-05T12:00:00Z", "2024-04-05T12:00:00Z", "web-tls", "2024-04-30T12:00:00Z", "7"}))
+
+		Expect(sections[1]).To(Equal(`web/web-tls:
+  - not ready: Failed: issuance failed
+  - expires 96h0m0s after the bundle was collected
+  - renewal was due at 2024-04-05T12:00:00Z but has not happened
+  - secret web-tls contains a certificate expiring at 2024-04-30T12:00:00Z, which does not match the Certificate status
+  - certificate in secret web-tls is expired
+  - challenge web-tls-1-123-0 for web.example.com is pending: Waiting for HTTP-01 challenge propagation
+  - CertificateRequest web-tls-1: Failed: The certificate request has failed to complete and will be retried`))
+	})
+
+	It("Shows timestamps relative to when the bundle was collected", func() {
+		out, err := SbctlExec("cert-manager", "-s", dir, "--no-index", "--time-format", "relative")
+		Expect(err).NotTo(HaveOccurred())
+		rows := strings.Split(out, "\n")
+		Expect(rows[2]).To(MatchRegexp(`^web\s+web-tls\s+False\s+in 4d\s+26d ago\s+web-tls\s+24h ago\s+7\s*$`))
+	})
+
+	It("Reports bundles without certificates", func() {
+		out, err := SbctlExec("cert-manager", "-s", "./support-bundle", "--no-index")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(Equal("No cert-manager Certificates found in support bundle\n"))
+	})
+})
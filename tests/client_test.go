@@ -0,0 +1,57 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/client"
+)
+
+var _ = Describe("sbctl API client", func() {
+	var c *client.Client
+	ctx := context.Background()
+
+	BeforeEach(func() {
+		c = client.New(apiServerEndpoint, "")
+	})
+
+	It("Searches objects and reads their manifests", func() {
+		refs, err := c.Search(ctx, client.SearchOptions{Query: "velero-6996", Resources: []string{"pods"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(refs).To(HaveLen(1))
+		Expect(refs[0].Namespace).To(Equal("velero"))
+
+		manifest, err := c.Manifest(ctx, refs[0].Group, refs[0].Resource, refs[0].Namespace, refs[0].Name)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(manifest).To(HaveKeyWithValue("kind", "Pod"))
+	})
+
+	It("Reads container logs", func() {
+		logs, err := c.ContainerLogs(ctx, "velero", "velero-6996dd565b-xl44t")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(logs).To(ContainElement(client.ContainerLog{Container: "velero", Previous: true}))
+
+		log, err := c.ContainerLog(ctx, "velero", "velero-6996dd565b-xl44t", "velero", client.LogOptions{TailLines: 1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(log).NotTo(BeEmpty())
+	})
+
+	It("Returns API errors", func() {
+		_, err := c.Manifest(ctx, "", "pods", "velero", "missing")
+		Expect(client.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("Serves the OpenAPI document", func() {
+		resp, statusCode, err := HTTPExec("GET", apiServerEndpoint+"/sbctl/v1/openapi.json", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+
+		doc := map[string]interface{}{}
+		Expect(json.Unmarshal([]byte(resp), &doc)).To(Succeed())
+		Expect(doc).To(HaveKeyWithValue("openapi", "3.0.3"))
+		Expect(doc["paths"]).To(HaveKey("/search"))
+	})
+})
@@ -0,0 +1,101 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Cloud resources", func() {
+	var clusterData sbctl.ClusterData
+
+	BeforeEach(func() {
+		dir := GinkgoT().TempDir()
+		files := map[string]string{
+			"cluster-resources/namespaces.json": `{"kind":"NamespaceList","apiVersion":"v1","items":[]}`,
+			"host-collectors/run-host/instance-identity.json": `{
+				"instanceId": "i-0abc", "region": "us-east-1", "availabilityZone": "us-east-1a",
+				"instanceType": "m5.large", "privateIp": "10.0.1.5"}`,
+			"aws/load-balancers.json": `{"LoadBalancers": [{
+				"LoadBalancerName": "a1b2c3", "DNSName": "a1b2c3.elb.us-east-1.amazonaws.com",
+				"Type": "network", "Scheme": "internet-facing", "State": {"Code": "active"}}]}`,
+			"gcp/instance.json": `{"name": "gke-pool-1", "zone": "projects/1/zones/us-central1-a",
+				"machineType": "projects/1/machineTypes/e2-standard-4", "networkInterfaces": [{"ip": "10.128.0.2"}]}`,
+		}
+		for name, content := range files {
+			fileName := filepath.Join(dir, name)
+			Expect(os.MkdirAll(filepath.Dir(fileName), 0755)).To(Succeed())
+			Expect(os.WriteFile(fileName, []byte(content), 0644)).To(Succeed())
+		}
+		clusterData = sbctl.ClusterData{BundleDir: dir, ClusterResourcesDir: filepath.Join(dir, "cluster-resources")}
+	})
+
+	It("Finds instance metadata and load balancers by their content", func() {
+		cloud, err := sbctl.FindCloudData(clusterData)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(cloud.Instances).To(HaveLen(2))
+		Expect(cloud.Instances[0].Provider).To(Equal(sbctl.CloudProviderGCP))
+		Expect(cloud.Instances[0].Type).To(Equal("e2-standard-4"))
+		Expect(cloud.Instances[0].Region).To(Equal("us-central1"))
+		Expect(cloud.Instances[1].Provider).To(Equal(sbctl.CloudProviderAWS))
+		Expect(cloud.Instances[1].File).To(Equal("host-collectors/run-host/instance-identity.json"))
+
+		Expect(cloud.LoadBalancers).To(HaveLen(1))
+		Expect(cloud.LoadBalancers[0].State).To(Equal("active"))
+	})
+
+	It("Parses provider IDs", func() {
+		provider, instance := sbctl.ParseProviderID("aws:///us-east-1a/i-0abc")
+		Expect(provider).To(Equal(sbctl.CloudProviderAWS))
+		Expect(instance).To(Equal("i-0abc"))
+
+		provider, instance = sbctl.ParseProviderID("gce://project/us-central1-a/gke-pool-1")
+		Expect(provider).To(Equal(sbctl.CloudProviderGCP))
+		Expect(instance).To(Equal("gke-pool-1"))
+
+		provider, _ = sbctl.ParseProviderID("")
+		Expect(provider).To(BeEmpty())
+	})
+
+	It("Matches nodes and services with cloud resources", func() {
+		cloud, err := sbctl.FindCloudData(clusterData)
+		Expect(err).NotTo(HaveOccurred())
+
+		nodes := []corev1.Node{
+			{ObjectMeta: metav1.ObjectMeta{Name: "ip-10-0-1-5"}, Spec: corev1.NodeSpec{ProviderID: "aws:///us-east-1a/i-0abc"}},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "worker"},
+				Status:     corev1.NodeStatus{Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.128.0.2"}}},
+			},
+			{ObjectMeta: metav1.ObjectMeta{Name: "on-prem"}},
+		}
+		resources := sbctl.CorrelateNodes(nodes, cloud)
+		Expect(resources).To(HaveLen(3))
+		Expect(resources[0].Metadata).NotTo(BeNil())
+		Expect(resources[0].Type).To(Equal("m5.large"))
+		Expect(resources[1].Provider).To(Equal(sbctl.CloudProviderGCP))
+		Expect(resources[1].Instance).To(Equal("gke-pool-1"))
+		Expect(resources[2].Metadata).To(BeNil())
+
+		services := []corev1.Service{
+			{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ingress", Name: "nginx"},
+				Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer},
+				Status: corev1.ServiceStatus{LoadBalancer: corev1.LoadBalancerStatus{
+					Ingress: []corev1.LoadBalancerIngress{{Hostname: "a1b2c3.elb.us-east-1.amazonaws.com"}},
+				}},
+			},
+			{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "kubernetes"}},
+		}
+		svcResources := sbctl.CorrelateServices(services, cloud)
+		Expect(svcResources).To(HaveLen(1))
+		Expect(svcResources[0].LoadBalancer).NotTo(BeNil())
+		Expect(svcResources[0].LoadBalancer.Name).To(Equal("a1b2c3"))
+	})
+})
@@ -0,0 +1,32 @@
+package tests
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("Compatibility", func() {
+	It("Decodes DaemonSets stored as a JSON array", func() {
+		decoded, _, err := sbctl.Decode("daemonsets", []byte(`[{"metadata": {"name": "calico-node", "namespace": "kube-system"}}]`))
+		Expect(err).NotTo(HaveOccurred())
+		list, ok := decoded.(*appsv1.DaemonSetList)
+		Expect(ok).To(BeTrue())
+		Expect(list.Items).To(HaveLen(1))
+		Expect(list.Items[0].Name).To(Equal("calico-node"))
+		Expect(list.Items[0].APIVersion).To(Equal("apps/v1"))
+		Expect(list.Items[0].Kind).To(Equal("DaemonSet"))
+	})
+
+	It("Decodes ReplicationControllers stored as a JSON array", func() {
+		decoded, _, err := sbctl.Decode("replicationcontrollers", []byte(`[{"metadata": {"name": "web", "namespace": "default"}}]`))
+		Expect(err).NotTo(HaveOccurred())
+		list, ok := decoded.(*corev1.ReplicationControllerList)
+		Expect(ok).To(BeTrue())
+		Expect(list.Items).To(HaveLen(1))
+		Expect(list.Items[0].APIVersion).To(Equal("v1"))
+		Expect(list.Items[0].Kind).To(Equal("ReplicationController"))
+	})
+})
@@ -0,0 +1,49 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Version conversion", func() {
+	headers := map[string]string{"Accept": "application/json"}
+
+	It("Lists deployments at an older version of the group", func() {
+		resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/apis/apps/v1beta2/namespaces/velero/deployments", apiServerEndpoint), headers)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(resp).To(ContainSubstring(`"apiVersion":"apps/v1beta2"`))
+		Expect(resp).NotTo(ContainSubstring(`"apiVersion":"apps/v1"`))
+	})
+
+	It("Gets a deployment at an older version of the group", func() {
+		resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/apis/apps/v1beta2/namespaces/velero/deployments/velero", apiServerEndpoint), headers)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(resp).To(ContainSubstring(`"apiVersion":"apps/v1beta2"`))
+		Expect(resp).To(ContainSubstring(`"name":"velero"`))
+	})
+})
+
+var _ = Describe("Events", func() {
+	headers := map[string]string{"Accept": "application/json"}
+
+	It("Are served in the events.k8s.io group", func() {
+		resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/apis/events.k8s.io/v1/namespaces/velero/events", apiServerEndpoint), headers)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(resp).To(ContainSubstring(`"kind":"EventList","apiVersion":"events.k8s.io/v1"`))
+		Expect(resp).To(ContainSubstring(`"regarding":{`))
+	})
+
+	It("Are listed across namespaces in the events.k8s.io group", func() {
+		resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/apis/events.k8s.io/v1/events", apiServerEndpoint), headers)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(resp).To(ContainSubstring(`"namespace":"velero"`))
+		Expect(resp).To(ContainSubstring(`"namespace":"kube-system"`))
+	})
+})
@@ -0,0 +1,28 @@
+package tests
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+)
+
+var _ = Describe("Crash loops", func() {
+	It("Lists containers in CrashLoopBackOff with their last termination and events", func() {
+		clusterData, err := sbctl.FindClusterData("./support-bundle")
+		Expect(err).NotTo(HaveOccurred())
+
+		crashLoops, err := sbctl.FindCrashLoops(clusterData)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(crashLoops).To(HaveLen(1))
+
+		c := crashLoops[0]
+		Expect(c.Namespace).To(Equal("velero"))
+		Expect(c.Pod).To(Equal("velero-6996dd565b-xl44t"))
+		Expect(c.Container).To(Equal("velero"))
+		Expect(c.Restarts).To(BeEquivalentTo(3))
+		Expect(c.LastReason).To(Equal("Error"))
+		Expect(c.LastExitCode).To(BeEquivalentTo(1))
+		Expect(c.Events).To(Equal([]sbctl.CrashLoopEvent{{Reason: "BackOff", Count: 2, Message: "Back-off restarting failed container"}}))
+		Expect(c.LogFile).To(Equal("pods/logs/velero/velero-6996dd565b-xl44t/velero-previous.log"))
+	})
+})
@@ -0,0 +1,65 @@
+package tests
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/api"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+)
+
+var _ = Describe("Decoding resource files", func() {
+	var dir string
+	var widgetsFile string
+
+	BeforeEach(func() {
+		dir = filepath.Join(GinkgoT().TempDir(), "bundle")
+		resourcesDir := filepath.Join(dir, "cluster-resources")
+		widgetsFile = filepath.Join(resourcesDir, "custom-resources", "widgets.example.com", "default.json")
+		Expect(os.MkdirAll(filepath.Dir(widgetsFile), 0755)).To(Succeed())
+
+		// An empty array of objects of a resource the decoder does not know leaves it without an
+		// object, which panics when its metadata is synthesized
+		Expect(os.WriteFile(widgetsFile, []byte("[]"), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(resourcesDir, "namespaces.json"),
+			[]byte(`{"kind": "NamespaceList", "apiVersion": "v1", "items": [{"metadata": {"name": "default"}}]}`), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(resourcesDir, "resources.json"), []byte(`[
+			{"kind": "APIResourceList", "groupVersion": "v1", "resources": [{"name": "namespaces", "namespaced": false, "kind": "Namespace", "verbs": ["get", "list"]}]},
+			{"kind": "APIResourceList", "groupVersion": "example.com/v1", "resources": [{"name": "widgets", "namespaced": true, "kind": "Widget", "verbs": ["get", "list"]}]}
+		]`), 0644)).To(Succeed())
+	})
+
+	It("Returns an error for files that make the decoder panic", func() {
+		_, err := sbctl.ReadResourceFiles([]sbctl.ResourceFile{{Name: widgetsFile, Resource: "widgets"}})
+		Expect(err).To(MatchError(ContainSubstring("failed to decode " + widgetsFile + ": panic:")))
+
+		clusterData, err := sbctl.FindClusterData(dir)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = sbctl.ListResources(clusterData, "example.com", "widgets")
+		Expect(err).To(MatchError(ContainSubstring("panic:")))
+	})
+
+	It("Keeps serving after a decoder panicked", func() {
+		clusterData, err := sbctl.FindClusterData(dir)
+		Expect(err).NotTo(HaveOccurred())
+		kubeConfig, err := api.StartAPIServer(clusterData, io.Discard)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, kubeConfig)
+		endpoint, err := getAPIEndpoint(kubeConfig)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/sbctl/v1/resources", endpoint), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusInternalServerError))
+
+		resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/api/v1/namespaces", endpoint), getHeaders)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(resp).To(ContainSubstring(`"default"`))
+	})
+})
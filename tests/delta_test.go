@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+)
+
+var _ = Describe("Delta bundles", func() {
+	writeBundle := func(dir string, files map[string]string) sbctl.ClusterData {
+		for name, content := range files {
+			fileName := filepath.Join(dir, "cluster-resources", name)
+			Expect(os.MkdirAll(filepath.Dir(fileName), 0755)).To(Succeed())
+			Expect(os.WriteFile(fileName, []byte(content), 0644)).To(Succeed())
+		}
+		clusterData, err := sbctl.FindClusterData(dir)
+		Expect(err).NotTo(HaveOccurred())
+		return clusterData
+	}
+
+	It("Overlays the objects of a delta on the base bundle", func() {
+		tmp := GinkgoT().TempDir()
+		base := writeBundle(filepath.Join(tmp, "base"), map[string]string{
+			"configmaps/default.json": `{"kind":"ConfigMapList","apiVersion":"v1","items":[
+				{"metadata":{"name":"a","namespace":"default"},"data":{"v":"1"}},
+				{"metadata":{"name":"b","namespace":"default"},"data":{"v":"1"}}]}`,
+			"configmaps/other.json": `{"kind":"ConfigMapList","apiVersion":"v1","items":[
+				{"metadata":{"name":"c","namespace":"other"},"data":{"v":"1"}}]}`,
+		})
+		delta := writeBundle(filepath.Join(tmp, "delta"), map[string]string{
+			"configmaps/default.json": `{"kind":"ConfigMapList","apiVersion":"v1","items":[
+				{"metadata":{"name":"b","namespace":"default"},"data":{"v":"2"}},
+				{"metadata":{"name":"d","namespace":"default"},"data":{"v":"2"}}]}`,
+			"configmaps/other.json": `{"kind":"ConfigMapList","apiVersion":"v1","items":null}`,
+		})
+
+		overlaid, err := sbctl.OverlayBundles(base, []sbctl.ClusterData{delta}, filepath.Join(tmp, "out"))
+		Expect(err).NotTo(HaveOccurred())
+
+		configMaps, err := sbctl.ListResources(overlaid, "", "configmaps")
+		Expect(err).NotTo(HaveOccurred())
+		values := map[string]string{}
+		for _, cm := range configMaps {
+			values[cm.GetNamespace()+"/"+cm.GetName()] = cm.Object["data"].(map[string]interface{})["v"].(string)
+		}
+		Expect(values).To(Equal(map[string]string{
+			"default/a": "1",
+			"default/b": "2",
+			"default/d": "2",
+			"other/c":   "1",
+		}))
+
+		// The bundles are not changed
+		configMaps, err = sbctl.ListResources(base, "", "configmaps")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(configMaps).To(HaveLen(3))
+	})
+})
@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Event aggregation", func() {
+	listEvents := func(reason string, name string) []corev1.Event {
+		resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/api/v1/namespaces/velero/events", apiServerEndpoint), map[string]string{"Accept": "application/json"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+
+		list := corev1.EventList{}
+		Expect(json.Unmarshal([]byte(resp), &list)).To(Succeed())
+		events := []corev1.Event{}
+		for _, event := range list.Items {
+			if event.Reason == reason && event.InvolvedObject.Name == name {
+				events = append(events, event)
+			}
+		}
+		return events
+	}
+
+	It("Combines repeated events about the same object", func() {
+		events := listEvents("SuccessfulCreate", "velero-6996dd565b")
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Count).To(Equal(int32(3)))
+		Expect(events[0].FirstTimestamp.UTC().Format("15:04:05")).To(Equal("00:30:26"))
+		Expect(events[0].LastTimestamp.UTC().Format("15:04:05")).To(Equal("00:58:08"))
+		Expect(events[0].Message).To(Equal("(combined from similar events): Created pod: velero-6996dd565b-xl44t"))
+		Expect(events[0].Annotations).To(HaveKeyWithValue("sbctl.replicated.com/aggregated-events", "3"))
+	})
+
+	It("Lists every event with --no-aggregate", func() {
+		viper.Set("no-aggregate", true)
+		defer viper.Set("no-aggregate", false)
+
+		Expect(listEvents("SuccessfulCreate", "velero-6996dd565b")).To(HaveLen(3))
+	})
+
+	It("Prints events as a timeline with their counts", func() {
+		resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/api/v1/namespaces/velero/events", apiServerEndpoint), getHeaders)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+
+		table := metav1.Table{}
+		Expect(json.Unmarshal([]byte(resp), &table)).To(Succeed())
+		columns := []string{}
+		for _, column := range table.ColumnDefinitions {
+			if column.Priority == 0 {
+				columns = append(columns, column.Name)
+			}
+		}
+		Expect(columns).To(Equal([]string{"Last Seen", "Type", "Reason", "Object", "Message"}))
+
+		var row []interface{}
+		for _, r := range table.Rows {
+			if r.Cells[2] == "SuccessfulCreate" && r.Cells[3] == "replicaset/velero-6996dd565b" {
+				row = r.Cells
+			}
+		}
+		Expect(row).NotTo(BeNil())
+		Expect(row[0]).To(ContainSubstring("(x3 over "))
+		Expect(row[8]).To(BeEquivalentTo(3))
+	})
+})
@@ -0,0 +1,56 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Virtual resources", func() {
+	It("Are discoverable", func() {
+		resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/apis/reports.example.com/v1", apiServerEndpoint), getHeaders)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(resp).To(ContainSubstring(`"name":"backupreports"`))
+	})
+
+	It("Are computed from bundle files", func() {
+		resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/apis/reports.example.com/v1/namespaces/velero/backupreports/nightly-backup", apiServerEndpoint), map[string]string{"Accept": "application/json"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(resp).To(ContainSubstring(`"kind":"BackupReport"`))
+		Expect(resp).To(ContainSubstring(`"phase":"Completed"`))
+		Expect(resp).To(ContainSubstring(`"sbctl.replicated.com/source-file":"vendor-reports/nightly-backup.json"`))
+	})
+
+	It("Are printed with their columns", func() {
+		resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/apis/reports.example.com/v1/backupreports", apiServerEndpoint), getHeaders)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(resp).To(ContainSubstring(`"name":"Phase"`))
+		Expect(resp).To(ContainSubstring(`"cells":["nightly-backup","Completed",412]`))
+	})
+})
+
+var _ = Describe("Resources without a mapping", func() {
+	jsonHeaders := map[string]string{"Accept": "application/json"}
+
+	It("Are served from files named after the resource", func() {
+		resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/apis/example.com/v1/namespaces/default/widgetconfigs", apiServerEndpoint), jsonHeaders)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(resp).To(ContainSubstring(`"kind":"WidgetConfigList"`))
+		Expect(resp).To(ContainSubstring(`"name":"blue"`))
+	})
+
+	It("Serve single objects and their subresources", func() {
+		for _, path := range []string{"blue", "blue/status"} {
+			resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/apis/example.com/v1/namespaces/default/widgetconfigs/%s", apiServerEndpoint, path), jsonHeaders)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(statusCode).To(Equal(http.StatusOK))
+			Expect(resp).To(ContainSubstring(`"color":"blue"`))
+		}
+	})
+})
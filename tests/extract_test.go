@@ -0,0 +1,54 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+)
+
+var _ = Describe("Selective extraction", func() {
+	var dir, archive string
+
+	BeforeEach(func() {
+		clusterData, err := sbctl.FindClusterData("./support-bundle")
+		Expect(err).NotTo(HaveOccurred())
+
+		dir = GinkgoT().TempDir()
+		archive = filepath.Join(dir, "bundle.tgz")
+		f, err := os.Create(archive)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = sbctl.SplitBundle(clusterData, sbctl.SplitOptions{Namespaces: []string{"velero"}}, f, "bundle")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(f.Close()).To(Succeed())
+	})
+
+	It("Extracts the files matching a glob", func() {
+		outDir := filepath.Join(dir, "out")
+		extracted, err := sbctl.ExtractFiles(archive, []string{"cluster-resources/pods/logs/velero/*/velero*.log"}, outDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(extracted).NotTo(BeEmpty())
+		for _, name := range extracted {
+			Expect(name).To(MatchRegexp(`^bundle/cluster-resources/pods/logs/velero/[^/]+/velero[^/]*\.log$`))
+			Expect(filepath.Join(outDir, name)).To(BeARegularFile())
+		}
+		Expect(filepath.Join(outDir, "bundle", "cluster-resources", "nodes.json")).NotTo(BeAnExistingFile())
+	})
+
+	It("Extracts files and directories by path", func() {
+		outDir := filepath.Join(dir, "out")
+		extracted, err := sbctl.ExtractFiles(archive, []string{"cluster-resources/nodes.json", "bundle/cluster-resources/pods/logs"}, outDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(extracted).To(ContainElement("bundle/cluster-resources/nodes.json"))
+		Expect(len(extracted)).To(BeNumerically(">", 1))
+		Expect(filepath.Join(outDir, "bundle", "cluster-resources", "pods", "logs", "velero")).To(BeADirectory())
+		Expect(filepath.Join(outDir, "bundle", "cluster-resources", "pods", "velero.json")).NotTo(BeAnExistingFile())
+	})
+
+	It("Rejects invalid patterns", func() {
+		_, err := sbctl.ExtractFiles(archive, []string{"cluster-resources/["}, filepath.Join(dir, "out"))
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,119 @@
+package tests
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+)
+
+var _ = Describe("Extracting bundles", func() {
+	It("Links files with the same content", func() {
+		dir := GinkgoT().TempDir()
+		archive := filepath.Join(dir, "bundle.tgz")
+		f, err := os.Create(archive)
+		Expect(err).NotTo(HaveOccurred())
+		gzw := gzip.NewWriter(f)
+		tw := tar.NewWriter(gzw)
+		writeFile := func(name string, content string) {
+			Expect(tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})).To(Succeed())
+			_, err := tw.Write([]byte(content))
+			Expect(err).NotTo(HaveOccurred())
+		}
+		logs := "bundle/cluster-resources/pods/logs/default/web-0/"
+		writeFile(logs+"nginx.log", "GET /\n")
+		writeFile(logs+"nginx-previous.log", "GET /\n")
+		writeFile(logs+"sidecar.log", "started\n")
+		Expect(tw.WriteHeader(&tar.Header{Name: logs + "nginx-current.log", Linkname: "nginx.log", Typeflag: tar.TypeSymlink})).To(Succeed())
+		Expect(tw.Close()).To(Succeed())
+		Expect(gzw.Close()).To(Succeed())
+		Expect(f.Close()).To(Succeed())
+
+		outDir := filepath.Join(dir, "out")
+		Expect(sbctl.ExtractBundle(archive, outDir)).To(Succeed())
+
+		stat := func(name string) os.FileInfo {
+			info, err := os.Stat(filepath.Join(outDir, logs, name))
+			Expect(err).NotTo(HaveOccurred())
+			return info
+		}
+		Expect(os.SameFile(stat("nginx.log"), stat("nginx-previous.log"))).To(BeTrue())
+		Expect(os.SameFile(stat("nginx.log"), stat("nginx-current.log"))).To(BeTrue())
+		Expect(os.SameFile(stat("nginx.log"), stat("sidecar.log"))).To(BeFalse())
+
+		data, err := os.ReadFile(filepath.Join(outDir, logs, "nginx-previous.log"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal("GET /\n"))
+	})
+
+	writeArchive := func(dir string, headers []tar.Header, contents []string) string {
+		archive := filepath.Join(dir, "bundle.tgz")
+		f, err := os.Create(archive)
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+		gzw := gzip.NewWriter(f)
+		tw := tar.NewWriter(gzw)
+		for i := range headers {
+			headers[i].Mode = 0644
+			headers[i].Size = int64(len(contents[i]))
+			Expect(tw.WriteHeader(&headers[i])).To(Succeed())
+			_, err := tw.Write([]byte(contents[i]))
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(tw.Close()).To(Succeed())
+		Expect(gzw.Close()).To(Succeed())
+		return archive
+	}
+
+	It("Rejects links outside of the archive", func() {
+		links := []tar.Header{
+			{Name: "bundle/passwd", Linkname: "/etc/passwd", Typeflag: tar.TypeSymlink},
+			{Name: "bundle/passwd", Linkname: "../../etc/passwd", Typeflag: tar.TypeSymlink},
+			{Name: "bundle/passwd", Linkname: "../x", Typeflag: tar.TypeLink},
+			{Name: "../passwd", Linkname: "bundle/a.log", Typeflag: tar.TypeLink},
+		}
+		for _, link := range links {
+			dir := GinkgoT().TempDir()
+			archive := writeArchive(dir, []tar.Header{{Name: "bundle/a.log", Typeflag: tar.TypeReg}, link}, []string{"a\n", ""})
+			Expect(sbctl.ExtractBundle(archive, filepath.Join(dir, "out"))).NotTo(Succeed())
+		}
+	})
+
+	It("Does not write files through links", func() {
+		dir := GinkgoT().TempDir()
+		archive := writeArchive(dir, []tar.Header{
+			{Name: "bundle/a.log", Typeflag: tar.TypeReg},
+			{Name: "bundle/b.log", Typeflag: tar.TypeReg},
+			{Name: "bundle/b.log", Typeflag: tar.TypeReg},
+		}, []string{"same\n", "same\n", "changed\n"})
+		outDir := filepath.Join(dir, "out")
+		Expect(sbctl.ExtractBundle(archive, outDir)).To(Succeed())
+
+		data, err := os.ReadFile(filepath.Join(outDir, "bundle", "a.log"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal("same\n"))
+		data, err = os.ReadFile(filepath.Join(outDir, "bundle", "b.log"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal("changed\n"))
+	})
+
+	It("Stops extracting archives whose files add up to more than the limit", func() {
+		dir := GinkgoT().TempDir()
+		archive := writeArchive(dir, []tar.Header{
+			{Name: "bundle/a.log", Typeflag: tar.TypeReg},
+			{Name: "bundle/b.log", Typeflag: tar.TypeReg},
+		}, []string{"first\n", "second\n"})
+
+		err := sbctl.ExtractBundleLimited(archive, filepath.Join(dir, "small"), 10)
+		Expect(errors.Is(err, sbctl.ErrBundleTooLarge)).To(BeTrue())
+		Expect(filepath.Join(dir, "small", "bundle", "b.log")).NotTo(BeAnExistingFile())
+
+		Expect(sbctl.ExtractBundleLimited(archive, filepath.Join(dir, "large"), 13)).To(Succeed())
+		Expect(filepath.Join(dir, "large", "bundle", "b.log")).To(BeARegularFile())
+	})
+})
@@ -0,0 +1,69 @@
+package tests
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/api"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/spf13/viper"
+)
+
+var _ = Describe("GET /files/", func() {
+	var endpoint string
+
+	BeforeEach(func() {
+		tmp := GinkgoT().TempDir()
+		dir := filepath.Join(tmp, "bundle")
+		logDir := filepath.Join(dir, "cluster-resources", "pods", "logs", "default", "web-0")
+		Expect(os.MkdirAll(logDir, 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(logDir, "nginx.log"), []byte("GET /\n"), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(tmp, "secret.txt"), []byte("hunter2"), 0644)).To(Succeed())
+		Expect(os.Symlink(filepath.Join(tmp, "secret.txt"), filepath.Join(dir, "secret.txt"))).To(Succeed())
+
+		viper.Set("serve-files", true)
+		defer viper.Set("serve-files", false)
+
+		clusterData, err := sbctl.FindClusterData(dir)
+		Expect(err).NotTo(HaveOccurred())
+		kubeConfig, err := api.StartAPIServer(clusterData, io.Discard)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, kubeConfig)
+
+		endpoint, err = getAPIEndpoint(kubeConfig)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("Serves files as text", func() {
+		resp, err := http.Get(endpoint + "/files/cluster-resources/pods/logs/default/web-0/nginx.log")
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get("Content-Type")).To(HavePrefix("text/plain"))
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(body)).To(Equal("GET /\n"))
+	})
+
+	It("Lists directories", func() {
+		resp, err := http.Get(endpoint + "/files/cluster-resources/pods/logs/default/")
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get("Content-Type")).To(HavePrefix("text/html"))
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(body)).To(ContainSubstring(`href="web-0/"`))
+	})
+
+	It("Does not follow symlinks out of the bundle", func() {
+		resp, err := http.Get(endpoint + "/files/secret.txt")
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+	})
+})
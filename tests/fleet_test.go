@@ -0,0 +1,63 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/api"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+var _ = Describe("Fleet bundles", func() {
+	It("Finds a cluster for each cluster-resources directory", func() {
+		dir := GinkgoT().TempDir()
+		for _, name := range []string{
+			"bundle/cluster-resources/namespaces.json",
+			"bundle/cluster-info/cluster_version.json",
+			"bundle/workload-clusters/prod/cluster-resources/namespaces.json",
+			"bundle/workload-clusters/prod/cluster-info/cluster_version.json",
+			"bundle/workload-clusters/staging/cluster-resources/namespaces.json",
+		} {
+			fileName := filepath.Join(dir, name)
+			Expect(os.MkdirAll(filepath.Dir(fileName), 0755)).To(Succeed())
+			Expect(os.WriteFile(fileName, []byte(`{}`), 0644)).To(Succeed())
+		}
+
+		clusters, err := sbctl.FindFleetClusters(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(clusters).To(HaveLen(3))
+
+		Expect(clusters[0].Name).To(Equal(sbctl.DefaultClusterName))
+		Expect(clusters[0].ClusterData.ClusterResourcesDir).To(Equal(filepath.Join(dir, "bundle", "cluster-resources")))
+		Expect(clusters[0].ClusterData.ClusterInfoFile).To(Equal(filepath.Join(dir, "bundle", "cluster-info", "cluster_version.json")))
+
+		Expect(clusters[1].Name).To(Equal("workload-clusters-prod"))
+		Expect(clusters[1].ClusterData.ClusterInfoFile).To(Equal(filepath.Join(dir, "bundle", "workload-clusters", "prod", "cluster-info", "cluster_version.json")))
+
+		// Files of other clusters are not mistaken for this cluster's
+		Expect(clusters[2].Name).To(Equal("workload-clusters-staging"))
+		Expect(clusters[2].ClusterData.ClusterInfoFile).To(BeEmpty())
+	})
+
+	It("Finds one cluster in other bundles", func() {
+		clusters, err := sbctl.FindFleetClusters("./support-bundle")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(clusters).To(HaveLen(1))
+		Expect(clusters[0].Name).To(Equal(sbctl.DefaultClusterName))
+	})
+
+	It("Writes a kubeconfig context for each cluster", func() {
+		config, err := clientcmd.Load([]byte(api.KubeConfigContexts([]api.KubeContext{
+			{Name: "default", Server: "http://127.0.0.1:1000"},
+			{Name: "workload-clusters-prod", Server: "http://127.0.0.1:2000"},
+		}, "")))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(config.CurrentContext).To(Equal("default"))
+		Expect(config.Contexts).To(HaveKey("workload-clusters-prod"))
+		Expect(config.Clusters[config.Contexts["workload-clusters-prod"].Cluster].Server).To(Equal("http://127.0.0.1:2000"))
+	})
+})
@@ -0,0 +1,42 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var _ = Describe("Gateway API resources", func() {
+	It("Resolves Gateway API resources without discovery data", func() {
+		mapper := sbctl.DefaultRESTMapper()
+		gvr, err := mapper.ResourceFor("gtw")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(gvr).To(Equal(schema.GroupVersionResource{Group: sbctl.GatewayAPIGroup, Version: "v1", Resource: "gateways"}))
+
+		gvr, err = mapper.ResourceFor("httproute")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(gvr.Resource).To(Equal("httproutes"))
+
+		namespaced, err := mapper.IsNamespaced(schema.GroupKind{Group: sbctl.GatewayAPIGroup, Kind: "GatewayClass"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(namespaced).To(BeFalse())
+	})
+
+	It("Lists discovery data of the Gateway API resources in a bundle", func() {
+		dir := GinkgoT().TempDir()
+		fileName := filepath.Join(dir, "cluster-resources", "custom-resources", "httproutes.gateway.networking.k8s.io", "default.json")
+		Expect(os.MkdirAll(filepath.Dir(fileName), 0755)).To(Succeed())
+		Expect(os.WriteFile(fileName, []byte(`[{"apiVersion":"gateway.networking.k8s.io/v1","kind":"HTTPRoute","metadata":{"name":"web","namespace":"default"}}]`), 0644)).To(Succeed())
+
+		lists, err := sbctl.WellKnownCRDResources(sbctl.ClusterData{ClusterResourcesDir: filepath.Join(dir, "cluster-resources")})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lists).To(HaveLen(1))
+		Expect(lists[0].GroupVersion).To(Equal("gateway.networking.k8s.io/v1"))
+		Expect(lists[0].APIResources).To(HaveLen(1))
+		Expect(lists[0].APIResources[0].Kind).To(Equal("HTTPRoute"))
+	})
+})
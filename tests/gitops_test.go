@@ -0,0 +1,20 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GET /apis/kustomize.toolkit.fluxcd.io/v1/namespaces/{namespace}/kustomizations", func() {
+	Context("When getting Flux Kustomizations", func() {
+		It("Returns the kustomizations with their reconciliation status", func() {
+			resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/apis/kustomize.toolkit.fluxcd.io/v1/namespaces/flux-system/kustomizations", apiServerEndpoint), getHeaders)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(statusCode).To(Equal(http.StatusOK))
+			Expect(resp).To(ContainSubstring(`"lastAttemptedRevision":"main@sha1:b71d03aa"`))
+		})
+	})
+})
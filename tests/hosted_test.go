@@ -0,0 +1,285 @@
+package tests
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/api"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+)
+
+var _ = Describe("Hosted bundles", func() {
+	var (
+		dataDir  string
+		host     *api.BundleHost
+		server   *httptest.Server
+		auditLog *bytes.Buffer
+		admin    map[string]string
+	)
+
+	BeforeEach(func() {
+		var err error
+		dataDir = GinkgoT().TempDir()
+		host, err = api.NewBundleHost(dataDir, GinkgoWriter)
+		Expect(err).NotTo(HaveOccurred())
+		auditLog = &bytes.Buffer{}
+		host.AuditLog = auditLog
+		server = httptest.NewServer(host.Handler())
+		admin = map[string]string{"Authorization": "Bearer " + host.AdminToken}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	do := func(method string, path string, token string, body io.Reader) *http.Response {
+		req, err := http.NewRequest(method, server.URL+path, body)
+		Expect(err).NotTo(HaveOccurred())
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		return resp
+	}
+
+	upload := func(query string) api.HostedBundle {
+		clusterData, err := sbctl.FindClusterData("./support-bundle")
+		Expect(err).NotTo(HaveOccurred())
+		archive := &bytes.Buffer{}
+		_, err = sbctl.SplitBundle(clusterData, sbctl.SplitOptions{Namespaces: []string{"velero"}}, archive, "upload")
+		Expect(err).NotTo(HaveOccurred())
+
+		resp := do("POST", "/sbctl/v1/bundles?"+query, host.AdminToken, archive)
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+		bundle := api.HostedBundle{}
+		Expect(json.NewDecoder(resp.Body).Decode(&bundle)).To(Succeed())
+		return bundle
+	}
+
+	It("Serves uploaded bundles under their own path to their tokens", func() {
+		bundle := upload("name=acme&user=alice&ttl=1h")
+		Expect(bundle.Name).To(Equal("acme"))
+		Expect(bundle.Path).To(Equal("/bundles/" + bundle.ID))
+		Expect(bundle.Token).NotTo(BeNil())
+		Expect(bundle.Token.User).To(Equal("alice"))
+		Expect(bundle.Token.Expires).To(BeTemporally("~", time.Now().Add(time.Hour), time.Minute))
+
+		podsPath := fmt.Sprintf("%s%s/api/v1/namespaces/velero/pods", server.URL, bundle.Path)
+		body, statusCode, err := HTTPExec("GET", podsPath, map[string]string{"Authorization": "Bearer " + bundle.Token.Token})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(body).To(ContainSubstring("velero-6996dd565b-xl44t"))
+
+		_, statusCode, err = HTTPExec("GET", podsPath, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusUnauthorized))
+
+		// Tokens of a bundle cannot access other bundles
+		other := upload("name=other")
+		_, statusCode, err = HTTPExec("GET", fmt.Sprintf("%s%s/api/v1/pods", server.URL, other.Path), map[string]string{"Authorization": "Bearer " + bundle.Token.Token})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusUnauthorized))
+
+		_, statusCode, err = HTTPExec("GET", fmt.Sprintf("%s/bundles/missing/api/v1/pods", server.URL), admin)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusNotFound))
+
+		Expect(auditLog.String()).To(ContainSubstring(`"action":"access","bundle":"` + bundle.ID + `","token":"` + bundle.Token.ID + `","user":"alice"`))
+		Expect(auditLog.String()).To(ContainSubstring(`"action":"denied"`))
+
+		// A host started again with the same data dir serves the bundles with their tokens
+		restarted, err := api.NewBundleHost(dataDir, GinkgoWriter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(restarted.Bundles()).To(HaveLen(2))
+		restartedServer := httptest.NewServer(restarted.Handler())
+		defer restartedServer.Close()
+		_, statusCode, err = HTTPExec("GET", fmt.Sprintf("%s%s/api/v1/pods", restartedServer.URL, bundle.Path), map[string]string{"Authorization": "Bearer " + bundle.Token.Token})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+	})
+
+	It("Refuses log requests of a bundle's tokens that reach files of other bundles", func() {
+		bundle := upload("name=acme")
+		other := upload("name=other")
+		headers := map[string]string{"Authorization": "Bearer " + bundle.Token.Token}
+		logPath := fmt.Sprintf("%s%s/api/v1/namespaces/velero/pods/velero-6996dd565b-xl44t/log", server.URL, bundle.Path)
+
+		body, statusCode, err := HTTPExec("GET", logPath+"?container=velero", headers)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(body).NotTo(BeEmpty())
+
+		// The path of the same log in the other bundle, relative to the directory of the pod's logs
+		bundleData, err := sbctl.FindClusterData(filepath.Join(dataDir, bundle.ID, "bundle"))
+		Expect(err).NotTo(HaveOccurred())
+		otherData, err := sbctl.FindClusterData(filepath.Join(dataDir, other.ID, "bundle"))
+		Expect(err).NotTo(HaveOccurred())
+		podLogsDir := filepath.Join(bundleData.ClusterResourcesDir, "pods", "logs", "velero", "velero-6996dd565b-xl44t")
+		otherLog := filepath.Join(otherData.ClusterResourcesDir, "pods", "logs", "velero", "velero-6996dd565b-xl44t", "velero.log")
+		Expect(otherLog).To(BeARegularFile())
+		container, err := filepath.Rel(podLogsDir, strings.TrimSuffix(otherLog, ".log"))
+		Expect(err).NotTo(HaveOccurred())
+
+		_, statusCode, err = HTTPExec("GET", logPath+"?container="+url.QueryEscape(filepath.ToSlash(container)), headers)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusBadRequest))
+	})
+
+	It("Issues, lists and revokes tokens, and evicts bundles", func() {
+		bundle := upload("name=acme")
+
+		resp := do("POST", "/sbctl/v1/bundles/"+bundle.ID+"/tokens?user=bob&ttl=2h", host.AdminToken, nil)
+		Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+		token := api.HostedToken{}
+		Expect(json.NewDecoder(resp.Body).Decode(&token)).To(Succeed())
+		resp.Body.Close()
+		Expect(token.Token).NotTo(BeEmpty())
+
+		body, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/sbctl/v1/bundles/%s/tokens", server.URL, bundle.ID), admin)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+		tokens := []api.HostedToken{}
+		Expect(json.Unmarshal([]byte(body), &tokens)).To(Succeed())
+		Expect(tokens).To(HaveLen(2))
+		for _, t := range tokens {
+			Expect(t.Token).To(BeEmpty())
+		}
+		Expect(body).NotTo(ContainSubstring(token.Token))
+
+		resp = do("DELETE", "/sbctl/v1/bundles/"+bundle.ID+"/tokens/"+token.ID, host.AdminToken, nil)
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusNoContent))
+		_, statusCode, err = HTTPExec("GET", fmt.Sprintf("%s%s/api/v1/pods", server.URL, bundle.Path), map[string]string{"Authorization": "Bearer " + token.Token})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusUnauthorized))
+
+		resp = do("DELETE", "/sbctl/v1/bundles/"+bundle.ID, host.AdminToken, nil)
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusNoContent))
+		Expect(host.Bundles()).To(BeEmpty())
+		Expect(filepath.Join(dataDir, bundle.ID)).NotTo(BeADirectory())
+		Expect(auditLog.String()).To(ContainSubstring(`"action":"evict"`))
+	})
+
+	It("Evicts bundles by age and disk usage, and counts evictions", func() {
+		first := upload("name=first")
+		second := upload("name=second")
+		_, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s%s/api/v1/pods", server.URL, first.Path), admin)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+
+		// The second bundle was accessed less recently than the first
+		host.MaxDiskUsage = first.DiskUsage + 1
+		evicted := host.CollectGarbage()
+		Expect(evicted).To(HaveLen(1))
+		Expect(evicted[0].ID).To(Equal(second.ID))
+		Expect(filepath.Join(dataDir, second.ID)).NotTo(BeADirectory())
+
+		// The most recently accessed bundle is kept even when it alone is over the limit
+		host.MaxDiskUsage = 1
+		Expect(host.CollectGarbage()).To(BeEmpty())
+
+		host.MaxAge = time.Nanosecond
+		evicted = host.CollectGarbage()
+		Expect(evicted).To(HaveLen(1))
+		Expect(evicted[0].ID).To(Equal(first.ID))
+		Expect(host.Bundles()).To(BeEmpty())
+
+		Expect(auditLog.String()).To(ContainSubstring(`"action":"evict","bundle":"` + second.ID + `","reason":"disk"`))
+		_, statusCode, err = HTTPExec("GET", server.URL+"/metrics", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusUnauthorized))
+		body, statusCode, err := HTTPExec("GET", server.URL+"/metrics", admin)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(body).To(ContainSubstring("sbctl_hosted_bundles 0\n"))
+		Expect(body).To(ContainSubstring(`sbctl_hosted_evictions_total{reason="age"} 1`))
+		Expect(body).To(ContainSubstring(`sbctl_hosted_evictions_total{reason="disk"} 1`))
+		Expect(body).To(ContainSubstring(fmt.Sprintf(`sbctl_hosted_evicted_bytes_total{reason="disk"} %d`, second.DiskUsage)))
+	})
+
+	It("Requires the admin token to manage bundles", func() {
+		_, statusCode, err := HTTPExec("GET", server.URL+"/sbctl/v1/bundles", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusUnauthorized))
+
+		bundle := upload("name=acme")
+		resp := do("DELETE", "/sbctl/v1/bundles/"+bundle.ID, bundle.Token.Token, nil)
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+		Expect(host.Bundles()).To(HaveLen(1))
+	})
+
+	It("Rejects uploads that are not bundle archives", func() {
+		resp := do("POST", "/sbctl/v1/bundles", host.AdminToken, strings.NewReader("not a bundle"))
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+
+		Expect(host.Bundles()).To(BeEmpty())
+		entries, err := os.ReadDir(dataDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(BeEmpty())
+	})
+
+	It("Rejects archives that are too large once extracted", func() {
+		host.MaxExtractedSize = 1 << 20
+
+		// Zeros compress to a small fraction of their size
+		archive := &bytes.Buffer{}
+		gzw := gzip.NewWriter(archive)
+		tw := tar.NewWriter(gzw)
+		zeros := make([]byte, 10<<20)
+		Expect(tw.WriteHeader(&tar.Header{Name: "bundle/zeros.log", Mode: 0644, Size: int64(len(zeros)), Typeflag: tar.TypeReg})).To(Succeed())
+		_, err := tw.Write(zeros)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tw.Close()).To(Succeed())
+		Expect(gzw.Close()).To(Succeed())
+		Expect(archive.Len()).To(BeNumerically("<", 1<<20))
+
+		resp := do("POST", "/sbctl/v1/bundles", host.AdminToken, archive)
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusRequestEntityTooLarge))
+
+		Expect(host.Bundles()).To(BeEmpty())
+		entries, err := os.ReadDir(dataDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(BeEmpty())
+	})
+
+	It("Rejects archives with files outside of them", func() {
+		for _, name := range []string{"../x", "../../x", "/tmp/x"} {
+			archive := &bytes.Buffer{}
+			gzw := gzip.NewWriter(archive)
+			tw := tar.NewWriter(gzw)
+			Expect(tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: 1, Typeflag: tar.TypeReg})).To(Succeed())
+			_, err := tw.Write([]byte("x"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tw.Close()).To(Succeed())
+			Expect(gzw.Close()).To(Succeed())
+
+			resp := do("POST", "/sbctl/v1/bundles", host.AdminToken, archive)
+			resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+		}
+
+		Expect(host.Bundles()).To(BeEmpty())
+		entries, err := os.ReadDir(dataDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(BeEmpty())
+	})
+})
@@ -0,0 +1,57 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	authenticationv1 "k8s.io/api/authentication/v1"
+)
+
+var _ = Describe("Impersonation", func() {
+	whoami := func(headers map[string]string) authenticationv1.UserInfo {
+		resp, statusCode, err := HTTPExec("POST", fmt.Sprintf("%s/apis/authentication.k8s.io/v1/selfsubjectreviews", apiServerEndpoint), headers)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusCreated))
+
+		review := authenticationv1.SelfSubjectReview{}
+		Expect(json.Unmarshal([]byte(resp), &review)).To(Succeed())
+		Expect(review.Kind).To(Equal("SelfSubjectReview"))
+		return review.Status.UserInfo
+	}
+
+	It("Reviews the server's own user", func() {
+		user := whoami(getHeaders)
+		Expect(user.Username).To(Equal("sbctl"))
+		Expect(user.Groups).To(ContainElement("system:masters"))
+	})
+
+	It("Reflects the impersonated user in reviews", func() {
+		headers := map[string]string{
+			"Impersonate-User":        "jane",
+			"Impersonate-Group":       "developers",
+			"Impersonate-Extra-Scope": "view",
+		}
+		for k, v := range getHeaders {
+			headers[k] = v
+		}
+
+		user := whoami(headers)
+		Expect(user.Username).To(Equal("jane"))
+		Expect(user.Groups).To(ConsistOf("developers", "system:authenticated"))
+		Expect(user.Extra).To(HaveKeyWithValue("scope", authenticationv1.ExtraValue{"view"}))
+	})
+
+	It("Serves requests that impersonate a user", func() {
+		headers := map[string]string{"Impersonate-User": "jane"}
+		for k, v := range getHeaders {
+			headers[k] = v
+		}
+
+		_, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/api/v1/namespaces/velero/pods", apiServerEndpoint), headers)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+	})
+})
@@ -0,0 +1,103 @@
+package tests
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+)
+
+var _ = Describe("Bundle index", func() {
+	var dir string
+	var clusterData sbctl.ClusterData
+
+	BeforeEach(func() {
+		dir = filepath.Join(GinkgoT().TempDir(), "bundle")
+		logDir := filepath.Join(dir, "cluster-resources", "pods", "logs", "default", "web-0")
+		Expect(os.MkdirAll(logDir, 0755)).To(Succeed())
+
+		lines := &strings.Builder{}
+		start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		for i := 0; i < 25000; i++ {
+			fmt.Fprintf(lines, "%s line %d\n", start.Add(time.Duration(i)*time.Second).Format(time.RFC3339Nano), i)
+		}
+		Expect(os.WriteFile(filepath.Join(logDir, "nginx.log"), []byte(lines.String()), 0644)).To(Succeed())
+
+		var err error
+		clusterData, err = sbctl.FindClusterData(dir)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("Indexes container logs", func() {
+		index, err := sbctl.BuildBundleIndex(dir, clusterData)
+		Expect(err).NotTo(HaveOccurred())
+
+		l, ok := index.Log("pods/logs/default/web-0/nginx.log")
+		Expect(ok).To(BeTrue())
+		Expect(l.Lines).To(Equal(int64(25000)))
+		Expect(l.Offsets).To(HaveLen(3))
+		Expect(l.FirstTimestamp.Equal(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))).To(BeTrue())
+		Expect(l.LastTimestamp.Equal(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC).Add(24999 * time.Second))).To(BeTrue())
+
+		offset, skip := l.LineOffset(3)
+		Expect(offset).To(Equal(l.Offsets[2]))
+		Expect(skip).To(Equal(int64(4997)))
+
+		offset, skip = l.LineOffset(30000)
+		Expect(offset).To(BeZero())
+		Expect(skip).To(BeZero())
+	})
+
+	It("Saves the index next to the bundle and ignores it when the bundle changes", func() {
+		index, err := sbctl.BuildBundleIndex(dir, clusterData)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sbctl.SaveBundleIndex(dir, index)).To(Succeed())
+		Expect(filepath.Join(dir, sbctl.IndexFileName)).To(BeARegularFile())
+
+		loaded, err := sbctl.LoadBundleIndex(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loaded).NotTo(BeNil())
+		l, ok := loaded.Log("pods/logs/default/web-0/nginx.log")
+		Expect(ok).To(BeTrue())
+		Expect(l.Lines).To(Equal(int64(25000)))
+
+		logFile := filepath.Join(dir, "cluster-resources", "pods", "logs", "default", "web-0", "nginx.log")
+		f, err := os.OpenFile(logFile, os.O_APPEND|os.O_WRONLY, 0644)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = f.WriteString("one more line\n")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(f.Close()).To(Succeed())
+
+		loaded, err = sbctl.LoadBundleIndex(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loaded).To(BeNil())
+	})
+
+	It("Lists objects from the index", func() {
+		clusterData, err := sbctl.FindClusterData("./support-bundle")
+		Expect(err).NotTo(HaveOccurred())
+		collected, err := sbctl.ListCollectedResources(clusterData)
+		Expect(err).NotTo(HaveOccurred())
+
+		index, err := sbctl.BuildBundleIndex("./support-bundle", clusterData)
+		Expect(err).NotTo(HaveOccurred())
+		clusterData.Index = index
+		indexed, err := sbctl.ListIndexedResources(clusterData)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(indexed).To(HaveLen(len(collected)))
+		for i := range collected {
+			Expect(indexed[i].Resource).To(Equal(collected[i].Resource))
+			Expect(indexed[i].Items).To(HaveLen(len(collected[i].Items)))
+			for j := range collected[i].Items {
+				Expect(indexed[i].Items[j].GetName()).To(Equal(collected[i].Items[j].GetName()))
+				Expect(indexed[i].Items[j].GetLabels()).To(Equal(collected[i].Items[j].GetLabels()))
+			}
+		}
+	})
+})
@@ -0,0 +1,127 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/api"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+)
+
+var _ = Describe("Kubeconfig command", func() {
+	var tmpDir, bundle string
+
+	BeforeEach(func() {
+		// Running servers are recorded in TMPDIR
+		tmpDir = GinkgoT().TempDir()
+		DeferCleanup(os.Setenv, "TMPDIR", os.Getenv("TMPDIR"))
+		Expect(os.Setenv("TMPDIR", tmpDir)).To(Succeed())
+
+		var err error
+		bundle, err = filepath.Abs("./support-bundle")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	instanceFiles := func() []string {
+		files, err := filepath.Glob(filepath.Join(tmpDir, "sbctl-instances", "*.json"))
+		Expect(err).NotTo(HaveOccurred())
+		return files
+	}
+
+	// recordInstance records a server the way serve and shell do
+	recordInstance := func(pid int, server string, bundle string, kubeConfig string) {
+		data, err := json.Marshal(map[string]interface{}{
+			"pid":        pid,
+			"server":     server,
+			"bundle":     bundle,
+			"kubeconfig": kubeConfig,
+			"startedAt":  time.Date(2024, 5, 1, 12, pid, 0, 0, time.UTC),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.MkdirAll(filepath.Join(tmpDir, "sbctl-instances"), 0700)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(tmpDir, "sbctl-instances", fmt.Sprintf("%d.json", pid)), data, 0600)).To(Succeed())
+	}
+
+	It("Reports when no servers are running", func() {
+		out, err := SbctlExec("kubeconfig", "--list")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(Equal("No running sbctl API servers found\n"))
+
+		_, err = SbctlExec("kubeconfig")
+		Expect(err).To(MatchError("no running sbctl API servers found, use --support-bundle-location to start one"))
+	})
+
+	It("Prints the kubeconfig of running servers", func() {
+		clusterData, err := sbctl.FindClusterData("./support-bundle")
+		Expect(err).NotTo(HaveOccurred())
+		kubeConfig, err := api.StartAPIServer(clusterData, io.Discard)
+		Expect(err).NotTo(HaveOccurred())
+		endpoint, err := getAPIEndpoint(kubeConfig)
+		Expect(err).NotTo(HaveOccurred())
+		config, err := os.ReadFile(kubeConfig)
+		Expect(err).NotTo(HaveOccurred())
+
+		recordInstance(1, endpoint, bundle, kubeConfig)
+		// Servers that stopped without removing their record are forgotten
+		recordInstance(2, "http://127.0.0.1:1", "/stopped", kubeConfig)
+
+		out, err := SbctlExec("kubeconfig", "--list")
+		Expect(err).NotTo(HaveOccurred())
+		lines := strings.Split(strings.TrimSpace(out), "\n")
+		Expect(lines).To(HaveLen(2))
+		Expect(strings.Fields(lines[0])).To(Equal([]string{"PID", "SERVER", "STARTED", "BUNDLE"}))
+		Expect(strings.Fields(lines[1])).To(Equal([]string{"1", endpoint, "2024-05-01T12:01:00Z", bundle}))
+		Expect(instanceFiles()).To(HaveLen(1))
+
+		out, err = SbctlExec("kubeconfig")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(Equal(string(config)))
+
+		recordInstance(3, endpoint, "/other-bundle", kubeConfig)
+		_, err = SbctlExec("kubeconfig")
+		Expect(err).To(MatchError("2 sbctl API servers are running, select one with --support-bundle-location. Run with --list to see them"))
+
+		// Relative bundle locations match the absolute paths servers are recorded with
+		output := filepath.Join(tmpDir, "kube", "config")
+		out, err = SbctlExec("kubeconfig", "-s", "./support-bundle", "-o", output)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(BeEmpty())
+		Expect(os.ReadFile(output)).To(Equal(config))
+	})
+
+	It("Starts a server for a bundle and stops it after the TTL", func() {
+		output := filepath.Join(tmpDir, "kubeconfig")
+		done := make(chan error, 1)
+		go func() {
+			_, err := SbctlExec("kubeconfig", "-s", "./support-bundle", "-o", output, "--ttl", "2s")
+			done <- err
+		}()
+
+		var endpoint string
+		Eventually(func() (string, error) {
+			var err error
+			endpoint, err = getAPIEndpoint(output)
+			return endpoint, err
+		}, "30s").Should(HavePrefix("http"))
+		_, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/api/v1/namespaces", endpoint), getHeaders)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+
+		files := instanceFiles()
+		Expect(files).To(HaveLen(1))
+		data, err := os.ReadFile(files[0])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring(fmt.Sprintf(`"bundle":%q`, bundle)))
+
+		Eventually(done, "30s").Should(Receive(BeNil()))
+		Expect(instanceFiles()).To(BeEmpty())
+	})
+})
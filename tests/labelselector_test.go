@@ -0,0 +1,107 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/api"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+)
+
+var _ = Describe("Label selectors", func() {
+	list := func(path string, selector string) []string {
+		v := url.Values{}
+		v.Set("labelSelector", selector)
+		resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s%s?%s", apiServerEndpoint, path, v.Encode()), getHeaders)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+
+		objects := struct {
+			Items []struct {
+				Metadata struct {
+					Name string `json:"name"`
+				} `json:"metadata"`
+			} `json:"items"`
+		}{}
+		Expect(json.Unmarshal([]byte(resp), &objects)).To(Succeed())
+		names := []string{}
+		for _, item := range objects.Items {
+			names = append(names, item.Metadata.Name)
+		}
+		return names
+	}
+
+	It("Filters with set-based requirements", func() {
+		names := list("/api/v1/namespaces/velero/pods", "component=velero,deploy in (velero)")
+		Expect(names).To(ConsistOf("velero-6796549f-5j2vv", "velero-6996dd565b-xl44t"))
+
+		names = list("/api/v1/namespaces/velero/pods", "name notin (restic)")
+		Expect(names).To(ConsistOf("velero-6796549f-5j2vv", "velero-6996dd565b-xl44t"))
+	})
+
+	It("Filters with exists requirements", func() {
+		names := list("/api/v1/namespaces/velero/pods", "name")
+		Expect(names).To(ConsistOf("restic-5dkdh", "restic-cccz9", "restic-f8vwl"))
+
+		names = list("/apis/apps/v1/namespaces/longhorn-system/deployments", "!longhorn.io/managed-by")
+		Expect(names).To(ConsistOf("longhorn-driver-deployer", "longhorn-ui"))
+	})
+
+	It("Filters lists of every resource", func() {
+		names := list("/apis/apps/v1/deployments", "app in (contour,registry)")
+		Expect(names).To(ConsistOf("contour", "registry"))
+
+		names = list("/apis/apps/v1/namespaces/velero/deployments", "component=velero")
+		Expect(names).To(ConsistOf("velero"))
+	})
+
+	It("Rejects invalid selectors", func() {
+		v := url.Values{}
+		v.Set("labelSelector", "app in (contour")
+		_, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/api/v1/pods?%s", apiServerEndpoint, v.Encode()), getHeaders)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusBadRequest))
+	})
+
+	It("Filters single objects, unless they are requested by name", func() {
+		v := url.Values{}
+		v.Set("labelSelector", "app=web")
+		resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/api/v1/namespaces/velero/pods/velero-6996dd565b-xl44t?%s", apiServerEndpoint, v.Encode()), getHeaders)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(resp).To(ContainSubstring("velero-6996dd565b-xl44t"))
+
+		// Custom resources can be stored as a single object rather than a list
+		dir := filepath.Join(GinkgoT().TempDir(), "bundle")
+		crDir := filepath.Join(dir, "cluster-resources", "custom-resources")
+		Expect(os.MkdirAll(crDir, 0755)).To(Succeed())
+		widget := `{"apiVersion": "example.com/v1", "kind": "Widget", "metadata": {"name": "blue", "labels": {"app": "db"}}}`
+		Expect(os.WriteFile(filepath.Join(crDir, "widgets.example.com.json"), []byte(widget), 0644)).To(Succeed())
+
+		clusterData, err := sbctl.FindClusterData(dir)
+		Expect(err).NotTo(HaveOccurred())
+		kubeConfig, err := api.StartAPIServer(clusterData, io.Discard)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, kubeConfig)
+		endpoint, err := getAPIEndpoint(kubeConfig)
+		Expect(err).NotTo(HaveOccurred())
+
+		resp, statusCode, err = HTTPExec("GET", fmt.Sprintf("%s/apis/example.com/v1/widgets?%s", endpoint, v.Encode()), getHeaders)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(resp).NotTo(ContainSubstring(`"blue"`))
+
+		v.Set("labelSelector", "app=db")
+		resp, statusCode, err = HTTPExec("GET", fmt.Sprintf("%s/apis/example.com/v1/widgets?%s", endpoint, v.Encode()), getHeaders)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(resp).To(ContainSubstring(`"blue"`))
+	})
+})
@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/api"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/spf13/viper"
+)
+
+var _ = Describe("Additional listeners", func() {
+	It("Serves the API on a unix socket and over HTTPS", func() {
+		// Socket paths are limited to about 100 characters, which temp dirs of tests can exceed
+		dir, err := os.MkdirTemp("", "sbctl-")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+		socket := filepath.Join(dir, "api.sock")
+
+		viper.Set("listen", []string{"unix://" + socket, "https://127.0.0.1:0"})
+		defer viper.Set("listen", nil)
+
+		clusterData, err := sbctl.FindClusterData("./support-bundle")
+		Expect(err).NotTo(HaveOccurred())
+		kubeConfig, err := api.StartAPIServer(clusterData, io.Discard)
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(kubeConfig)
+
+		urls := api.ListenURLs()
+		Expect(urls).To(HaveLen(2))
+		Expect(urls[0]).To(Equal("unix://" + socket))
+		Expect(urls[1]).To(HavePrefix("https://127.0.0.1:"))
+
+		unixClient := &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+			},
+		}}
+		resp, err := unixClient.Get("http://sbctl/api/v1/namespaces/velero/pods")
+		Expect(err).NotTo(HaveOccurred())
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(string(body)).To(ContainSubstring("velero-6996dd565b-xl44t"))
+
+		// The certificate is self-signed
+		httpsClient := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, // nolint: gosec // self-signed test certificate
+		}}
+		resp, err = httpsClient.Get(urls[1] + "/version")
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.TLS).NotTo(BeNil())
+		Expect(strings.Join(resp.TLS.PeerCertificates[0].DNSNames, ",")).To(ContainSubstring("localhost"))
+
+		api.CloseListeners()
+		Expect(socket).NotTo(BeAnExistingFile())
+	})
+})
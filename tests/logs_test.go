@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GET /api/v1/namespaces/{namespace}/pods/{name}/log", func() {
+	logURL := func(query string) string {
+		return fmt.Sprintf("%s/api/v1/namespaces/velero/pods/velero-6996dd565b-xl44t/log?container=velero%s", apiServerEndpoint, query)
+	}
+
+	It("Returns the whole log", func() {
+		resp, statusCode, err := HTTPExec("GET", logURL(""), getHeaders)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(resp).To(HavePrefix(`Error: unknown command "server-junk" for "velero"`))
+		Expect(resp).To(HaveSuffix("An error occurred: unknown command \"server-junk\" for \"velero\"\n"))
+	})
+
+	It("Returns the last lines of the log with tailLines", func() {
+		resp, statusCode, err := HTTPExec("GET", logURL("&tailLines=2"), getHeaders)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(resp).To(Equal("Run 'velero --help' for usage.\nAn error occurred: unknown command \"server-junk\" for \"velero\"\n"))
+	})
+
+	It("Keeps logs without timestamps whole with sinceTime", func() {
+		resp, statusCode, err := HTTPExec("GET", logURL("&sinceTime=2099-01-01T00:00:00Z&tailLines=2"), getHeaders)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(resp).To(Equal("Run 'velero --help' for usage.\nAn error occurred: unknown command \"server-junk\" for \"velero\"\n"))
+	})
+
+	It("Caps the log with limitBytes", func() {
+		resp, statusCode, err := HTTPExec("GET", logURL("&limitBytes=6"), getHeaders)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(resp).To(Equal("Error:"))
+	})
+
+	It("Defaults to the only container of the pod", func() {
+		withContainer, _, err := HTTPExec("GET", logURL(""), getHeaders)
+		Expect(err).NotTo(HaveOccurred())
+
+		url := fmt.Sprintf("%s/api/v1/namespaces/velero/pods/velero-6996dd565b-xl44t/log", apiServerEndpoint)
+		resp, statusCode, err := HTTPExec("GET", url, getHeaders)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(resp).To(Equal(withContainer))
+
+		resp, statusCode, err = HTTPExec("GET", url+"?previous=true&tailLines=1", getHeaders)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(resp).NotTo(BeEmpty())
+	})
+
+	It("Requires a container for pods with several containers", func() {
+		url := fmt.Sprintf("%s/api/v1/namespaces/projectcontour/pods/envoy-b4bxc/log", apiServerEndpoint)
+		resp, statusCode, err := HTTPExec("GET", url, getHeaders)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusBadRequest))
+		Expect(resp).To(ContainSubstring("choose one of: [envoy shutdown-manager]"))
+	})
+
+	It("Rejects invalid options", func() {
+		_, statusCode, err := HTTPExec("GET", logURL("&tailLines=-1"), getHeaders)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusBadRequest))
+	})
+})
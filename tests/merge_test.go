@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+)
+
+var _ = Describe("Merging bundles", func() {
+	const logFile = "cluster-resources/pods/logs/velero/velero-6996dd565b-xl44t/velero.log"
+
+	merge := func(conflict string) string {
+		dir := GinkgoT().TempDir()
+		original, err := sbctl.FindClusterData("./support-bundle")
+		Expect(err).NotTo(HaveOccurred())
+
+		// A later bundle of the velero namespace, with more logs
+		archive := filepath.Join(dir, "later.tgz")
+		f, err := os.Create(archive)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = sbctl.SplitBundle(original, sbctl.SplitOptions{Namespaces: []string{"velero"}}, f, "later")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(f.Close()).To(Succeed())
+		Expect(sbctl.ExtractBundle(archive, filepath.Join(dir, "later"))).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "later", "later", logFile), []byte("later\n"), 0644)).To(Succeed())
+		later, err := sbctl.FindClusterData(filepath.Join(dir, "later"))
+		Expect(err).NotTo(HaveOccurred())
+
+		merged := filepath.Join(dir, "merged.tgz")
+		f, err = os.Create(merged)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = sbctl.MergeBundles([]sbctl.ClusterData{original, later}, conflict, f, "merged")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(f.Close()).To(Succeed())
+		Expect(sbctl.ExtractBundle(merged, filepath.Join(dir, "out"))).To(Succeed())
+		return filepath.Join(dir, "out", "merged")
+	}
+
+	It("Keeps the files of the latest bundle", func() {
+		dir := merge(sbctl.MergeConflictLatest)
+		data, err := os.ReadFile(filepath.Join(dir, logFile))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal("later\n"))
+		Expect(filepath.Join(dir, logFile+".1")).NotTo(BeAnExistingFile())
+
+		// Files that are only in the earlier bundle are kept
+		Expect(filepath.Join(dir, "cluster-resources", "pods", "default.json")).To(BeAnExistingFile())
+		Expect(filepath.Join(dir, "analysis.json")).To(BeAnExistingFile())
+	})
+
+	It("Keeps earlier files with a suffix", func() {
+		dir := merge(sbctl.MergeConflictKeepBoth)
+		data, err := os.ReadFile(filepath.Join(dir, logFile))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal("later\n"))
+
+		earlier, err := os.ReadFile(filepath.Join(dir, logFile+".1"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(earlier)).NotTo(Equal("later\n"))
+
+		// Identical files are not duplicated
+		Expect(filepath.Join(dir, "cluster-resources", "pods", "velero.json.1")).NotTo(BeAnExistingFile())
+	})
+
+	It("Rejects unknown conflict policies", func() {
+		clusterData, err := sbctl.FindClusterData("./support-bundle")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = sbctl.MergeBundles([]sbctl.ClusterData{clusterData}, "oldest", GinkgoWriter, "merged")
+		Expect(err).To(HaveOccurred())
+	})
+})
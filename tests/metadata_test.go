@@ -0,0 +1,59 @@
+package tests
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"k8s.io/apimachinery/pkg/api/meta"
+)
+
+const podsWithoutUIDs = `{
+  "kind": "PodList",
+  "apiVersion": "v1",
+  "items": [
+    {
+      "metadata": {
+        "name": "web-5d4f8b7c9-abcde",
+        "namespace": "default",
+        "ownerReferences": [{"apiVersion": "apps/v1", "kind": "ReplicaSet", "name": "web-5d4f8b7c9", "controller": true}]
+      },
+      "spec": {"containers": [{"name": "web", "image": "nginx"}]}
+    }
+  ]
+}`
+
+const replicaSetWithoutUID = `{
+  "kind": "ReplicaSet",
+  "apiVersion": "apps/v1",
+  "metadata": {"name": "web-5d4f8b7c9", "namespace": "default"},
+  "spec": {"selector": {"matchLabels": {"app": "web"}}, "template": {"spec": {"containers": [{"name": "web", "image": "nginx"}]}}}
+}`
+
+var _ = Describe("Decoding objects without uids", func() {
+	It("Synthesizes stable uids and resource versions that owner references resolve to", func() {
+		decodePod := func() (string, string, string) {
+			decoded, _, err := sbctl.Decode("pods", []byte(podsWithoutUIDs))
+			Expect(err).NotTo(HaveOccurred())
+			items, err := meta.ExtractList(decoded)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(items).To(HaveLen(1))
+			pod, err := meta.Accessor(items[0])
+			Expect(err).NotTo(HaveOccurred())
+			return string(pod.GetUID()), pod.GetResourceVersion(), string(pod.GetOwnerReferences()[0].UID)
+		}
+
+		uid, resourceVersion, ownerUID := decodePod()
+		Expect(uid).To(MatchRegexp(`^[0-9a-f]{8}-[0-9a-f]{4}-5[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`))
+		Expect(resourceVersion).NotTo(BeEmpty())
+
+		uid2, resourceVersion2, _ := decodePod()
+		Expect(uid2).To(Equal(uid))
+		Expect(resourceVersion2).To(Equal(resourceVersion))
+
+		decoded, _, err := sbctl.Decode("replicasets", []byte(replicaSetWithoutUID))
+		Expect(err).NotTo(HaveOccurred())
+		rs, err := meta.Accessor(decoded)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(rs.GetUID())).To(Equal(ownerUID))
+	})
+})
@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GET /apis/metrics.k8s.io/v1beta1", func() {
+	type metrics struct {
+		Kind  string `json:"kind"`
+		Items []struct {
+			Metadata struct {
+				Name      string `json:"name"`
+				Namespace string `json:"namespace"`
+			} `json:"metadata"`
+			Usage      map[string]string `json:"usage"`
+			Containers []struct {
+				Name  string            `json:"name"`
+				Usage map[string]string `json:"usage"`
+			} `json:"containers"`
+		} `json:"items"`
+	}
+	get := func(path string) metrics {
+		resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/apis/metrics.k8s.io/v1beta1/%s", apiServerEndpoint, path), getHeaders)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+		list := metrics{}
+		Expect(json.Unmarshal([]byte(resp), &list)).To(Succeed())
+		return list
+	}
+
+	It("Is discovered", func() {
+		resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/apis", apiServerEndpoint), getHeaders)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(resp).To(ContainSubstring(`"metrics.k8s.io/v1beta1"`))
+
+		resp, statusCode, err = HTTPExec("GET", fmt.Sprintf("%s/apis/metrics.k8s.io/v1beta1", apiServerEndpoint), getHeaders)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(resp).To(ContainSubstring(`"kind":"NodeMetrics"`))
+		Expect(resp).To(ContainSubstring(`"kind":"PodMetrics"`))
+	})
+
+	It("Serves node metrics", func() {
+		list := get("nodes")
+		Expect(list.Kind).To(Equal("NodeMetricsList"))
+		found := false
+		for _, item := range list.Items {
+			if item.Metadata.Name == "troubleshoot-demo-001" {
+				found = true
+				Expect(item.Usage).To(HaveKeyWithValue("cpu", "850m"))
+				Expect(item.Usage).To(HaveKeyWithValue("memory", "3Gi"))
+			}
+		}
+		Expect(found).To(BeTrue())
+	})
+
+	It("Serves pod metrics of a namespace", func() {
+		list := get("namespaces/velero/pods")
+		Expect(list.Kind).To(Equal("PodMetricsList"))
+		found := false
+		for _, item := range list.Items {
+			Expect(item.Metadata.Namespace).To(Equal("velero"))
+			if item.Metadata.Name == "restic-cccz9" {
+				found = true
+				Expect(item.Containers).To(HaveLen(1))
+				Expect(item.Containers[0].Usage).To(HaveKeyWithValue("cpu", "12m"))
+			}
+		}
+		Expect(found).To(BeTrue())
+	})
+})
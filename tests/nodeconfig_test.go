@@ -0,0 +1,109 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Node-config command", func() {
+	writeBundle := func(dir string, files map[string]string) {
+		for name, content := range files {
+			fileName := filepath.Join(dir, name)
+			Expect(os.MkdirAll(filepath.Dir(fileName), 0755)).To(Succeed())
+			Expect(os.WriteFile(fileName, []byte(content), 0644)).To(Succeed())
+		}
+	}
+
+	// apiServerManifest returns a static pod manifest of kube-apiserver
+	apiServerManifest := func(address string) string {
+		return `apiVersion: v1
+kind: Pod
+metadata:
+  name: kube-apiserver
+  namespace: kube-system
+spec:
+  hostNetwork: true
+  containers:
+  - name: kube-apiserver
+    image: registry.k8s.io/kube-apiserver:v1.29.0
+    command:
+    - kube-apiserver
+    - --advertise-address=` + address + `
+    volumeMounts:
+    - name: certs
+      mountPath: /etc/kubernetes/pki
+`
+	}
+	kubeletConfig := `apiVersion: kubelet.config.k8s.io/v1beta1
+kind: KubeletConfiguration
+maxPods: 250
+`
+
+	var dir string
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		writeBundle(dir, map[string]string{
+			"cluster-resources/pods/kube-system.json": `{"kind": "PodList", "apiVersion": "v1", "items": [
+				{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "kube-apiserver-node-1", "namespace": "kube-system"}}]}`,
+			"host-collectors/node-1/etc/kubernetes/manifests/kube-apiserver.yaml": apiServerManifest("10.0.0.1"),
+			"host-collectors/node-2/etc/kubernetes/manifests/kube-apiserver.yaml": apiServerManifest("10.0.0.2"),
+			"host-collectors/node-1/var/lib/kubelet/config.yaml":                  kubeletConfig,
+			"host-collectors/node-1/etc/kubernetes/admin.yaml":                    "apiVersion: v1\nkind: Config\n",
+			"host-collectors/node-1/kubelet.log":                                  "kind: Pod\n",
+		})
+	})
+
+	It("Lists the static pod manifests and kubelet configs copied from hosts", func() {
+		out, err := SbctlExec("node-config", "-s", dir, "--no-index")
+		Expect(err).NotTo(HaveOccurred())
+
+		lines := strings.Split(strings.TrimSpace(out), "\n")
+		Expect(lines).To(HaveLen(4))
+		Expect(strings.Fields(lines[0])).To(Equal([]string{"KIND", "NAME", "SOURCE"}))
+		Expect(strings.Fields(lines[1])).To(Equal([]string{"Pod", "kube-apiserver", "host-collectors/node-1/etc/kubernetes/manifests/kube-apiserver.yaml"}))
+		Expect(strings.Fields(lines[2])).To(Equal([]string{"Pod", "kube-apiserver", "host-collectors/node-2/etc/kubernetes/manifests/kube-apiserver.yaml"}))
+		Expect(strings.Fields(lines[3])).To(Equal([]string{"KubeletConfiguration", "kubelet", "host-collectors/node-1/var/lib/kubelet/config.yaml"}))
+	})
+
+	It("Shows the containers of static pods by name or file", func() {
+		node1 := `Kind:   Pod
+Name:   kube-apiserver
+Source: host-collectors/node-1/etc/kubernetes/manifests/kube-apiserver.yaml
+Host Network: true
+
+Container kube-apiserver:
+  Image: registry.k8s.io/kube-apiserver:v1.29.0
+  Command:
+    kube-apiserver
+    --advertise-address=10.0.0.1
+  Mount: /etc/kubernetes/pki
+`
+		out, err := SbctlExec("node-config", "host-collectors/node-1/etc/kubernetes/manifests/kube-apiserver.yaml", "-s", dir, "--no-index")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(Equal(node1))
+
+		out, err = SbctlExec("node-config", "kube-apiserver", "-s", dir, "--no-index")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(HavePrefix(node1 + "\nKind:   Pod\n"))
+		Expect(out).To(HaveSuffix("    --advertise-address=10.0.0.2\n  Mount: /etc/kubernetes/pki\n"))
+	})
+
+	It("Shows kubelet configs as they are", func() {
+		out, err := SbctlExec("node-config", "kubelet", "-s", dir, "--no-index")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(Equal("Kind:   KubeletConfiguration\nName:   kubelet\nSource: host-collectors/node-1/var/lib/kubelet/config.yaml\n\n" + kubeletConfig))
+
+		_, err = SbctlExec("node-config", "kube-scheduler", "-s", dir, "--no-index")
+		Expect(err).To(MatchError(`no static pod manifest or kubelet config "kube-scheduler" found`))
+	})
+
+	It("Reports bundles without node config files", func() {
+		out, err := SbctlExec("node-config", "-s", "./support-bundle", "--no-index")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(Equal("No static pod manifests or kubelet configs found in support bundle\n"))
+	})
+})
@@ -0,0 +1,69 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Node logs", func() {
+	get := func(path string) (string, int) {
+		resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/sbctl/v1%s", apiServerEndpoint, path), nil)
+		Expect(err).NotTo(HaveOccurred())
+		return resp, statusCode
+	}
+
+	It("Lists logs collected from nodes", func() {
+		resp, statusCode := get("/node-logs")
+		Expect(statusCode).To(Equal(http.StatusOK))
+
+		logs := []map[string]interface{}{}
+		Expect(json.Unmarshal([]byte(resp), &logs)).To(Succeed())
+		Expect(logs).To(ConsistOf(And(
+			HaveKeyWithValue("node", "troubleshoot-demo-001"),
+			HaveKeyWithValue("component", "kubelet"),
+			HaveKeyWithValue("file", "host-collectors/run-host/troubleshoot-demo-001/kubelet.txt"),
+		)))
+	})
+
+	It("Returns node logs with the options of pod logs", func() {
+		resp, statusCode := get("/node-logs/troubleshoot-demo-001/kubelet?tailLines=1")
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(resp).To(HavePrefix("2023-03-08T00:36:06+0000"))
+
+		resp, statusCode = get("/node-logs/troubleshoot-demo-001/kubelet?sinceTime=2023-03-08T00:30:24Z")
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(resp).NotTo(ContainSubstring("Started kubelet"))
+		Expect(resp).To(ContainSubstring("Successfully registered node"))
+	})
+
+	It("Returns not found for components without logs", func() {
+		resp, statusCode := get("/node-logs/troubleshoot-demo-001/containerd")
+		Expect(statusCode).To(Equal(http.StatusNotFound))
+		Expect(resp).To(ContainSubstring("found logs of kubelet"))
+
+		_, statusCode = get("/node-logs/troubleshoot-demo-002/kubelet")
+		Expect(statusCode).To(Equal(http.StatusNotFound))
+	})
+
+	It("Serves node logs through the node proxy", func() {
+		resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/api/v1/nodes/troubleshoot-demo-001/proxy/logs/?query=kubelet&pattern=pod&tailLines=1", apiServerEndpoint), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(resp).To(ContainSubstring("Error syncing pod"))
+		Expect(resp).NotTo(ContainSubstring("Started kubelet"))
+
+		resp, statusCode, err = HTTPExec("GET", fmt.Sprintf("%s/api/v1/nodes/troubleshoot-demo-001/proxy/logs/", apiServerEndpoint), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(resp).To(ContainSubstring(`<a href="kubelet.txt">kubelet.txt</a>`))
+
+		resp, statusCode, err = HTTPExec("GET", fmt.Sprintf("%s/api/v1/nodes/troubleshoot-demo-001/proxy/logs/kubelet.txt?tailLines=1", apiServerEndpoint), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(resp).To(HavePrefix("2023-03-08T00:36:06+0000"))
+	})
+})
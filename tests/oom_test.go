@@ -0,0 +1,75 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+)
+
+var _ = Describe("OOM kills", func() {
+	var clusterData sbctl.ClusterData
+
+	BeforeEach(func() {
+		dir := GinkgoT().TempDir()
+		files := map[string]string{
+			"cluster-resources/pods/default.json": `{"kind":"PodList","apiVersion":"v1","items":[{
+				"metadata": {"name": "api-0", "namespace": "default"},
+				"spec": {"nodeName": "node-1", "containers": [{"name": "api",
+					"resources": {"requests": {"memory": "256Mi"}, "limits": {"memory": "512Mi"}}}]},
+				"status": {"containerStatuses": [{"name": "api", "restartCount": 3,
+					"state": {"running": {"startedAt": "2024-01-02T10:00:30Z"}},
+					"lastState": {"terminated": {"reason": "OOMKilled", "exitCode": 137,
+						"finishedAt": "2024-01-02T10:00:05Z"}}}]}}]}`,
+			"cluster-resources/nodes.json": `{"kind":"NodeList","apiVersion":"v1","items":[{
+				"metadata": {"name": "node-1"},
+				"status": {"allocatable": {"memory": "8Gi"}, "conditions": [{"type": "MemoryPressure",
+					"status": "False", "lastTransitionTime": "2024-01-01T00:00:00Z"}]}}]}`,
+			"cluster-resources/events/default.json": `{"kind":"EventList","apiVersion":"v1","items":[{
+				"metadata": {"name": "node-1.oom", "namespace": "default"},
+				"involvedObject": {"kind": "Node", "name": "node-1"},
+				"reason": "SystemOOM", "message": "System OOM encountered, victim process: java, pid: 4321",
+				"lastTimestamp": "2024-01-02T10:00:04Z"}]}`,
+			"host-collectors/run-host/dmesg.txt": "2024-01-02T11:00:00+00:00 Out of memory: Killed process 999 (containerd-shim) total-vm:1024kB\n",
+		}
+		for name, content := range files {
+			fileName := filepath.Join(dir, name)
+			Expect(os.MkdirAll(filepath.Dir(fileName), 0755)).To(Succeed())
+			Expect(os.WriteFile(fileName, []byte(content), 0644)).To(Succeed())
+		}
+		clusterData = sbctl.ClusterData{BundleDir: dir, ClusterResourcesDir: filepath.Join(dir, "cluster-resources")}
+	})
+
+	It("Correlates container terminations with kills reported by nodes", func() {
+		kills, err := sbctl.FindOOMKills(clusterData)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(kills).To(HaveLen(2))
+
+		Expect(kills[0].Pod).To(Equal("api-0"))
+		Expect(kills[0].Container).To(Equal("api"))
+		Expect(kills[0].Restarts).To(BeEquivalentTo(3))
+		Expect(kills[0].MemoryRequest).To(Equal("256Mi"))
+		Expect(kills[0].MemoryLimit).To(Equal("512Mi"))
+		Expect(kills[0].Process).To(Equal("java"))
+		Expect(kills[0].PID).To(Equal("4321"))
+		Expect(kills[0].NodeMemoryPressure).To(Equal("False"))
+		Expect(kills[0].NodeAllocatable).To(Equal("8Gi"))
+		Expect(kills[0].Sources).To(Equal([]string{sbctl.OOMSourcePodStatus, sbctl.OOMSourceEvent}))
+
+		Expect(kills[1].Node).To(Equal("node-1"))
+		Expect(kills[1].Container).To(BeEmpty())
+		Expect(kills[1].Process).To(Equal("containerd-shim"))
+		Expect(kills[1].Sources).To(Equal([]string{"host-collectors/run-host/dmesg.txt"}))
+	})
+
+	It("Finds no kills in bundles without any", func() {
+		clusterData, err := sbctl.FindClusterData("./support-bundle")
+		Expect(err).NotTo(HaveOccurred())
+
+		kills, err := sbctl.FindOOMKills(clusterData)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(kills).To(BeEmpty())
+	})
+})
@@ -0,0 +1,38 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GET /apis/route.openshift.io/v1/namespaces/{namespace}/routes", func() {
+	Context("When getting routes stored as YAML custom resources", func() {
+		It("Returns the routes", func() {
+			resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/apis/route.openshift.io/v1/namespaces/default/routes", apiServerEndpoint), getHeaders)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(statusCode).To(Equal(http.StatusOK))
+			Expect(resp).To(ContainSubstring("kotsadm-default.apps.example.com"))
+		})
+	})
+})
+
+var _ = Describe("GET /apis/config.openshift.io/v1/clusteroperators", func() {
+	Context("When getting cluster scoped custom resources", func() {
+		It("Returns all clusteroperators", func() {
+			resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/apis/config.openshift.io/v1/clusteroperators", apiServerEndpoint), getHeaders)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(statusCode).To(Equal(http.StatusOK))
+			Expect(resp).To(ContainSubstring(`"name":"dns"`))
+		})
+
+		It("Returns a single clusteroperator by name", func() {
+			resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/apis/config.openshift.io/v1/clusteroperators/dns", apiServerEndpoint), getHeaders)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(statusCode).To(Equal(http.StatusOK))
+			Expect(resp).To(ContainSubstring(`"kind":"ClusterOperator"`))
+		})
+	})
+})
@@ -0,0 +1,45 @@
+package tests
+
+import (
+	"bytes"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/output"
+)
+
+var _ = Describe("Human readable output", func() {
+	It("Aligns tables with colored cells", func() {
+		buf := &bytes.Buffer{}
+		p, err := output.NewPrinter(buf, output.ColorAlways)
+		Expect(err).NotTo(HaveOccurred())
+
+		t := p.NewTable("NAME", "STATUS", "AGE")
+		t.AddRow("velero-6996dd565b-xl44t", p.Status("Running"), "5d")
+		t.AddRow("restic-cccz9", p.Status("CrashLoopBackOff"), "5d")
+		Expect(t.Print()).To(Succeed())
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		Expect(lines).To(HaveLen(3))
+		Expect(lines[1]).To(ContainSubstring("\x1b[32mRunning\x1b[0m"))
+		Expect(lines[2]).To(ContainSubstring("\x1b[31mCrashLoopBackOff\x1b[0m"))
+		// The AGE column starts at the same visible column in every row
+		ageColumn := output.VisibleWidth(lines[0]) - len("AGE")
+		for _, line := range lines[1:] {
+			Expect(output.VisibleWidth(line) - len("5d")).To(Equal(ageColumn))
+		}
+	})
+
+	It("Does not color output that is not written to a terminal", func() {
+		buf := &bytes.Buffer{}
+		p, err := output.NewPrinter(buf, output.ColorAuto)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(p.Color()).To(BeFalse())
+		Expect(p.Width()).To(Equal(0))
+		Expect(p.Status("Failed")).To(Equal("Failed"))
+
+		_, err = output.NewPrinter(buf, "sometimes")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("GET /api/v1/namespaces/{namespace}/pods?limit=", func() {
+	Context("When listing pods in chunks", func() {
+		It("Returns the pods in pages linked by continue tokens", func() {
+			names := []string{}
+			token := ""
+			for page := 0; page < 100; page++ {
+				v := url.Values{}
+				v.Set("limit", "2")
+				if token != "" {
+					v.Set("continue", token)
+				}
+
+				resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/api/v1/namespaces/longhorn-system/pods?%s", apiServerEndpoint, v.Encode()), getHeaders)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(statusCode).To(Equal(http.StatusOK))
+
+				list := corev1.PodList{}
+				Expect(json.Unmarshal([]byte(resp), &list)).To(Succeed())
+				Expect(len(list.Items)).To(BeNumerically("<=", 2))
+				for _, p := range list.Items {
+					names = append(names, p.Name)
+				}
+
+				token = list.Continue
+				if token == "" {
+					Expect(list.RemainingItemCount).To(BeNil())
+					break
+				}
+				Expect(*list.RemainingItemCount).To(BeNumerically(">", 0))
+			}
+
+			resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/api/v1/namespaces/longhorn-system/pods", apiServerEndpoint), getHeaders)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(statusCode).To(Equal(http.StatusOK))
+
+			all := corev1.PodList{}
+			Expect(json.Unmarshal([]byte(resp), &all)).To(Succeed())
+			Expect(len(names)).To(Equal(len(all.Items)))
+			Expect(len(names)).To(BeNumerically(">", 2))
+		})
+
+		It("Rejects invalid continue tokens", func() {
+			_, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/api/v1/namespaces/longhorn-system/pods?limit=2&continue=not-a-token", apiServerEndpoint), getHeaders)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(statusCode).To(Equal(http.StatusBadRequest))
+		})
+	})
+})
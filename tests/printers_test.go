@@ -0,0 +1,32 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/api"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var _ = Describe("Registered table printers", func() {
+	It("Render custom resources with their columns", func() {
+		api.RegisterPrinter(schema.GroupKind{Group: "route.openshift.io", Kind: "Route"}, api.Printer{
+			Columns: []metav1.TableColumnDefinition{{Name: "Host", Type: "string"}},
+			PrintRow: func(obj *unstructured.Unstructured) ([]interface{}, error) {
+				host, _, err := unstructured.NestedString(obj.Object, "spec", "host")
+				return []interface{}{host}, err
+			},
+		})
+
+		resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/apis/route.openshift.io/v1/namespaces/default/routes", apiServerEndpoint), getHeaders)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(resp).To(ContainSubstring(`"kind":"Table"`))
+		Expect(resp).To(ContainSubstring(`"name":"Host"`))
+		Expect(resp).To(ContainSubstring(`"kotsadm-default.apps.example.com"`))
+	})
+})
@@ -0,0 +1,18 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Readiness", func() {
+	It("Is reported once the bundle can be served", func() {
+		resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/readyz", apiServerEndpoint), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(resp).To(Equal("ok\n"))
+	})
+})
@@ -0,0 +1,32 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Request IDs", func() {
+	Context("When a request fails", func() {
+		It("Returns an error body with a generated request ID", func() {
+			resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/does/not/exist", apiServerEndpoint), getHeaders)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(statusCode).To(Equal(http.StatusNotFound))
+			Expect(resp).To(MatchRegexp(`"requestId":"[0-9a-f]{16}"`))
+		})
+
+		It("Returns the request ID sent by the client", func() {
+			headers := map[string]string{"X-Request-Id": "test-request-id"}
+			for k, v := range getHeaders {
+				headers[k] = v
+			}
+
+			resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/api/v1/namespaces/default/pods/does-not-exist", apiServerEndpoint), headers)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(statusCode).To(Equal(http.StatusNotFound))
+			Expect(resp).To(ContainSubstring(`"requestId":"test-request-id"`))
+		})
+	})
+})
@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	appsv1 "k8s.io/api/apps/v1"
+	extensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var _ = Describe("REST mapper", func() {
+	It("Resolves built-in resources by any of their names", func() {
+		mapper := sbctl.DefaultRESTMapper()
+		for _, arg := range []string{"deploy", "deployment", "deployments", "Deployment", "deployments.apps"} {
+			gvr, err := mapper.ResourceFor(arg)
+			Expect(err).NotTo(HaveOccurred(), arg)
+			Expect(gvr).To(Equal(schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}), arg)
+		}
+
+		gvk, err := mapper.KindFor(schema.GroupVersionResource{Resource: "persistentvolumeclaims"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(gvk.Kind).To(Equal("PersistentVolumeClaim"))
+
+		namespaced, err := mapper.IsNamespaced(schema.GroupKind{Kind: "Node"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(namespaced).To(BeFalse())
+
+		_, err = mapper.ResourceFor("httpproxies")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Resolves the built-in resources troubleshoot collects in the versions it stores them in", func() {
+		mapper := sbctl.DefaultRESTMapper()
+		for arg, expected := range map[string]schema.GroupVersionResource{
+			"cj":     {Group: "batch", Version: "v1", Resource: "cronjobs"},
+			"quota":  {Version: "v1", Resource: "resourcequotas"},
+			"netpol": {Group: "networking.k8s.io", Version: "v1", Resource: "networkpolicies"},
+			"pdb":    {Group: "policy", Version: "v1", Resource: "poddisruptionbudgets"},
+			"hpa":    {Group: "autoscaling", Version: "v2", Resource: "horizontalpodautoscalers"},
+		} {
+			gvr, err := mapper.ResourceFor(arg)
+			Expect(err).NotTo(HaveOccurred(), arg)
+			Expect(gvr).To(Equal(expected), arg)
+		}
+	})
+
+	It("Resolves resources the cluster served, including custom resources", func() {
+		clusterData, err := sbctl.FindClusterData("./support-bundle")
+		Expect(err).NotTo(HaveOccurred())
+		mapper, err := sbctl.LoadRESTMapper(clusterData)
+		Expect(err).NotTo(HaveOccurred())
+
+		gvr, err := mapper.ResourceFor("proxy")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(gvr).To(Equal(schema.GroupVersionResource{Group: "projectcontour.io", Version: "v1", Resource: "httpproxies"}))
+
+		gvr, err = mapper.ResourceFor("ev")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(gvr.Group).To(BeEmpty())
+
+		gvr, err = mapper.ResourceFor("events.events.k8s.io")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(gvr.Group).To(Equal("events.k8s.io"))
+	})
+
+	It("Finds the files of resources by any of their names", func() {
+		clusterData, err := sbctl.FindClusterData("./support-bundle")
+		Expect(err).NotTo(HaveOccurred())
+		mapper, err := sbctl.LoadRESTMapper(clusterData)
+		Expect(err).NotTo(HaveOccurred())
+
+		files, err := mapper.ResourceFiles(clusterData, schema.GroupVersionResource{Group: "apps", Resource: "deployment"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files).To(ContainElement(filepath.Join(clusterData.ClusterResourcesDir, "deployments", "default.json")))
+
+		files, err = mapper.ResourceFiles(clusterData, schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files).To(Equal([]string{filepath.Join(clusterData.ClusterResourcesDir, "custom-resource-definitions.json")}))
+	})
+
+	It("Creates empty lists of the kind of resources", func() {
+		mapper := sbctl.DefaultRESTMapper()
+
+		list := mapper.NewList(schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"})
+		Expect(list).To(BeAssignableToTypeOf(&appsv1.DeploymentList{}))
+		Expect(list.(*appsv1.DeploymentList).Items).To(BeEmpty())
+		Expect(list.GetObjectKind().GroupVersionKind()).To(Equal(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "DeploymentList"}))
+
+		list = mapper.NewList(schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"})
+		Expect(list).To(BeAssignableToTypeOf(&unstructured.UnstructuredList{}))
+		Expect(list.GetObjectKind().GroupVersionKind().Kind).To(Equal("widgets"))
+	})
+
+	It("Sets the kinds of the items of decoded lists", func() {
+		decoded, _, err := sbctl.Decode("deployments", []byte(`[{"metadata": {"name": "web"}}]`))
+		Expect(err).NotTo(HaveOccurred())
+		deployments, ok := decoded.(*appsv1.DeploymentList)
+		Expect(ok).To(BeTrue())
+		Expect(deployments.Items).To(HaveLen(1))
+		Expect(deployments.Items[0].GroupVersionKind()).To(Equal(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}))
+
+		decoded, _, err = sbctl.Decode("custom-resource-definitions", []byte(`[{"metadata": {"name": "widgets.example.com"}}]`))
+		Expect(err).NotTo(HaveOccurred())
+		crds, ok := decoded.(*extensionsv1.CustomResourceDefinitionList)
+		Expect(ok).To(BeTrue())
+		Expect(crds.Items[0].Kind).To(Equal("CustomResourceDefinition"))
+	})
+
+	It("Serves lists of the kind of resources", func() {
+		resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/apis/apps/v1/deployments", apiServerEndpoint), getHeaders)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+
+		list := appsv1.DeploymentList{}
+		Expect(json.Unmarshal([]byte(resp), &list)).To(Succeed())
+		Expect(list.Kind).To(Equal("DeploymentList"))
+		Expect(list.Items).NotTo(BeEmpty())
+		for _, item := range list.Items {
+			Expect(item.Kind).To(Equal("Deployment"))
+		}
+	})
+})
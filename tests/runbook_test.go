@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+)
+
+const veleroRunbook = `
+name: Velero
+steps:
+- name: velero-pods
+  query:
+    resource: pods
+    namespace: velero
+    name: velero-*
+    jsonPath: '{.status.phase}'
+- name: velero-running
+  assert:
+    step: velero-pods
+    minCount: 1
+    values: [Running]
+  message: Velero is not running
+- name: velero-errors
+  logs:
+    namespace: velero
+    pod: velero-*
+    container: velero
+    pattern: unknown command
+- name: no-errors
+  assert:
+    step: velero-errors
+    maxCount: 0
+  message: 'Velero failed to start: {{ index (step "velero-errors").Lines 0 }}'
+- name: summary
+  when: '{{ (step "no-errors").Failed }}'
+  message: '{{ (step "velero-pods").Count }} velero pods are running, but velero does not start'
+`
+
+var _ = Describe("Runbooks", func() {
+	writeRunbook := func(content string) string {
+		fileName := filepath.Join(GinkgoT().TempDir(), "runbook.yaml")
+		Expect(os.WriteFile(fileName, []byte(content), 0644)).To(Succeed())
+		return fileName
+	}
+
+	It("Runs queries, asserts, log extraction and messages", func() {
+		runbook, err := sbctl.LoadRunbook(writeRunbook(veleroRunbook))
+		Expect(err).NotTo(HaveOccurred())
+		clusterData, err := sbctl.FindClusterData("./support-bundle")
+		Expect(err).NotTo(HaveOccurred())
+
+		results, err := sbctl.RunRunbook(clusterData, runbook)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(results).To(HaveLen(5))
+
+		Expect(results[0].Count).To(Equal(2))
+		Expect(results[0].Values).To(ConsistOf("Running", "Running"))
+
+		Expect(results[1].Failed).To(BeFalse())
+		Expect(results[1].Message).To(BeEmpty())
+
+		Expect(results[2].Count).To(BeNumerically(">", 0))
+		Expect(results[2].Lines[0]).To(HavePrefix("velero-6996dd565b-xl44t/velero: "))
+
+		Expect(results[3].Failed).To(BeTrue())
+		Expect(results[3].Message).To(ContainSubstring(`unknown command "server-junk"`))
+
+		Expect(results[4].Skipped).To(BeFalse())
+		Expect(results[4].Message).To(Equal("2 velero pods are running, but velero does not start"))
+	})
+
+	It("Rejects asserts of steps that have not run", func() {
+		_, err := sbctl.LoadRunbook(writeRunbook(`
+name: Broken
+steps:
+- name: check
+  assert:
+    step: missing
+    minCount: 1
+`))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring(`refers to "missing"`))
+	})
+})
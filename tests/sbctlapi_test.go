@@ -0,0 +1,120 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/viper"
+)
+
+var _ = Describe("sbctl API", func() {
+	get := func(path string) (string, int) {
+		resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/sbctl/v1%s", apiServerEndpoint, path), nil)
+		Expect(err).NotTo(HaveOccurred())
+		return resp, statusCode
+	}
+
+	It("Lists collected resources", func() {
+		resp, statusCode := get("/resources")
+		Expect(statusCode).To(Equal(http.StatusOK))
+
+		resources := []map[string]interface{}{}
+		Expect(json.Unmarshal([]byte(resp), &resources)).To(Succeed())
+		Expect(resources).To(ContainElement(HaveKeyWithValue("resource", "pods")))
+	})
+
+	It("Searches objects by name", func() {
+		resp, statusCode := get("/search?q=velero-6996&resource=pods")
+		Expect(statusCode).To(Equal(http.StatusOK))
+
+		results := []map[string]interface{}{}
+		Expect(json.Unmarshal([]byte(resp), &results)).To(Succeed())
+		Expect(results).To(HaveLen(1))
+		Expect(results[0]).To(HaveKeyWithValue("name", "velero-6996dd565b-xl44t"))
+		Expect(results[0]).To(HaveKeyWithValue("namespace", "velero"))
+	})
+
+	It("Searches objects across kinds by labels", func() {
+		resp, statusCode := get("/search?labelSelector=component%3Dvelero,name!%3Drestic&namespace=velero")
+		Expect(statusCode).To(Equal(http.StatusOK))
+
+		results := []map[string]interface{}{}
+		Expect(json.Unmarshal([]byte(resp), &results)).To(Succeed())
+		Expect(results).To(ContainElement(And(HaveKeyWithValue("kind", "Deployment"), HaveKeyWithValue("name", "velero"))))
+		Expect(results).To(ContainElement(And(HaveKeyWithValue("kind", "Pod"), HaveKeyWithValue("name", "velero-6996dd565b-xl44t"))))
+		Expect(results).NotTo(ContainElement(HaveKeyWithValue("name", "restic-5dkdh")))
+	})
+
+	It("Rejects invalid selectors", func() {
+		_, statusCode := get("/search?labelSelector=a%20in%20(b")
+		Expect(statusCode).To(Equal(http.StatusBadRequest))
+	})
+
+	It("Returns a manifest", func() {
+		resp, statusCode := get("/manifests/core/pods/velero-6996dd565b-xl44t?namespace=velero")
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(resp).To(ContainSubstring(`"name":"velero-6996dd565b-xl44t"`))
+
+		_, statusCode = get("/manifests/core/pods/missing?namespace=velero")
+		Expect(statusCode).To(Equal(http.StatusNotFound))
+	})
+
+	It("Lists and returns container logs", func() {
+		resp, statusCode := get("/logs/velero/velero-6996dd565b-xl44t")
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(resp).To(ContainSubstring(`{"container":"velero","previous":false}`))
+
+		resp, statusCode = get("/logs/velero/velero-6996dd565b-xl44t/velero?tailLines=1")
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(resp).To(Equal("An error occurred: unknown command \"server-junk\" for \"velero\"\n"))
+	})
+
+	It("Returns collector errors", func() {
+		resp, statusCode := get("/collector-errors")
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(resp).To(ContainSubstring(`{"collector":"cluster-resources/events","file":"cluster-resources/events-errors.json","message":"failed to list events in namespace kurl: forbidden"}`))
+	})
+
+	It("Lists objects related to a pod", func() {
+		resp, statusCode := get("/related?kind=Pod&namespace=velero&name=velero-6996dd565b-xl44t")
+		Expect(statusCode).To(Equal(http.StatusOK))
+
+		related := struct {
+			Related []map[string]interface{} `json:"related"`
+		}{}
+		Expect(json.Unmarshal([]byte(resp), &related)).To(Succeed())
+		Expect(related.Related).To(ContainElement(And(
+			HaveKeyWithValue("kind", "ReplicaSet"),
+			HaveKeyWithValue("name", "velero-6996dd565b"),
+			HaveKeyWithValue("relation", "owner"),
+		)))
+		Expect(related.Related).To(ContainElement(And(
+			HaveKeyWithValue("kind", "ServiceAccount"),
+			HaveKeyWithValue("name", "velero"),
+			HaveKeyWithValue("relation", "references"),
+		)))
+	})
+
+	It("Returns not found for related objects of unknown objects", func() {
+		_, statusCode := get("/related?kind=Pod&namespace=velero&name=does-not-exist")
+		Expect(statusCode).To(Equal(http.StatusNotFound))
+	})
+
+	It("Records resources that could not be served when opted in", func() {
+		viper.Set("usage-report", filepath.Join(GinkgoT().TempDir(), "usage.json"))
+		defer viper.Set("usage-report", "")
+
+		_, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/apis/example.com/v1/namespaces/default/widgets", apiServerEndpoint), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusNotFound))
+
+		resp, statusCode := get("/usage-report")
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(resp).To(ContainSubstring(`{"method":"GET","group":"example.com","version":"v1","resource":"widgets","count":1}`))
+		Expect(resp).NotTo(ContainSubstring("default"))
+	})
+})
@@ -0,0 +1,45 @@
+package tests
+
+import (
+	"bytes"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/replicatedhq/sbctl/pkg/script"
+)
+
+var _ = Describe("Scripts", func() {
+	It("Queries the bundle from Starlark", func() {
+		clusterData, err := sbctl.FindClusterData("./support-bundle")
+		Expect(err).NotTo(HaveOccurred())
+
+		out := &bytes.Buffer{}
+		runner, err := script.NewRunner(clusterData, out)
+		Expect(err).NotTo(HaveOccurred())
+
+		src := `
+pod = get("pods", "velero-6996dd565b-xl44t", namespace="velero")
+print(pod["metadata"]["name"])
+print(get("pods", "missing", namespace="velero"))
+print(len(list("pods", namespace=args[0])) > 0)
+print(len(logs("velero-6996dd565b-xl44t", namespace="velero", container="velero", previous=True, tail=1)))
+print(all([e["involvedObject"]["name"] == pod["metadata"]["name"] for e in events(namespace="velero", kind="Pod", name=pod["metadata"]["name"])]))
+`
+		err = runner.Run("test.star", []byte(src), []string{"velero"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out.String()).To(Equal("velero-6996dd565b-xl44t\nNone\nTrue\n1\nTrue\n"))
+	})
+
+	It("Returns script errors with a backtrace", func() {
+		clusterData, err := sbctl.FindClusterData("./support-bundle")
+		Expect(err).NotTo(HaveOccurred())
+
+		runner, err := script.NewRunner(clusterData, &bytes.Buffer{})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = runner.Run("test.star", []byte(`list("nosuchresources")`), nil)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("test.star:1"))
+	})
+})
@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/api"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+)
+
+var _ = Describe("Serve command", func() {
+	// freePort returns a port nothing listens on
+	freePort := func() int {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		defer listener.Close()
+		return listener.Addr().(*net.TCPAddr).Port
+	}
+
+	// externalIP returns an IPv4 address of this host other than loopback, if it has one
+	externalIP := func() string {
+		addrs, err := net.InterfaceAddrs()
+		Expect(err).NotTo(HaveOccurred())
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && ipNet.IP.To4() != nil {
+				return ipNet.IP.String()
+			}
+		}
+		return ""
+	}
+
+	It("Listens on the loopback interface by default", func() {
+		clusterData, err := sbctl.FindClusterData("./support-bundle")
+		Expect(err).NotTo(HaveOccurred())
+		kubeConfig, err := api.StartAPIServer(clusterData, io.Discard)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, kubeConfig)
+
+		endpoint, err := getAPIEndpoint(kubeConfig)
+		Expect(err).NotTo(HaveOccurred())
+		u, err := url.Parse(endpoint)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(u.Hostname()).To(Equal("127.0.0.1"))
+
+		if ip := externalIP(); ip != "" {
+			_, _, err = HTTPExec("GET", fmt.Sprintf("http://%s/api/v1", net.JoinHostPort(ip, u.Port())), nil)
+			Expect(err).To(HaveOccurred())
+		}
+	})
+
+	It("Serves on the address and port given and writes the kubeconfig where asked", func() {
+		port := freePort()
+		kubeConfig := filepath.Join(GinkgoT().TempDir(), "kubeconfig")
+		done := make(chan error, 1)
+		output := make(chan string, 1)
+		go func() {
+			out, err := SbctlExec("serve", "-s", "./support-bundle", "--no-index", "--address", "0.0.0.0", "--port", strconv.Itoa(port), "--kubeconfig-out", kubeConfig, "--ttl", "2s")
+			output <- out
+			done <- err
+		}()
+
+		// Servers listening on all interfaces are reached over the loopback interface
+		Eventually(func() (string, error) {
+			return getAPIEndpoint(kubeConfig)
+		}, "30s").Should(Equal(fmt.Sprintf("http://127.0.0.1:%d", port)))
+
+		_, statusCode, err := HTTPExec("GET", fmt.Sprintf("http://127.0.0.1:%d/api/v1/namespaces", port), getHeaders)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+		if ip := externalIP(); ip != "" {
+			_, statusCode, err = HTTPExec("GET", fmt.Sprintf("http://%s/api/v1/namespaces", net.JoinHostPort(ip, strconv.Itoa(port))), getHeaders)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(statusCode).To(Equal(http.StatusOK))
+		}
+
+		Eventually(done, "30s").Should(Receive(BeNil()))
+		Expect(<-output).To(ContainSubstring(fmt.Sprintf("export KUBECONFIG=%s\n", kubeConfig)))
+		Expect(kubeConfig).NotTo(BeAnExistingFile())
+	})
+})
@@ -0,0 +1,69 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+)
+
+var _ = Describe("Session files", func() {
+	writeSession := func(content string) string {
+		dir := GinkgoT().TempDir()
+		Expect(os.Mkdir(filepath.Join(dir, "bundle"), 0700)).To(Succeed())
+		fileName := filepath.Join(dir, "session.yaml")
+		Expect(os.WriteFile(fileName, []byte(content), 0600)).To(Succeed())
+		return fileName
+	}
+
+	It("Resolve paths relative to the session file", func() {
+		fileName := writeSession(`
+apiVersion: sbctl.replicated.com/v1
+kind: Session
+spec:
+  bundle: ./bundle
+  mode: shell
+  port: 8443
+  sandbox: true
+`)
+		session, err := sbctl.LoadSession(fileName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(session.Spec.Bundle).To(Equal(filepath.Join(filepath.Dir(fileName), "bundle")))
+		Expect(session.Spec.Port).To(Equal(8443))
+		Expect(session.Spec.Sandbox).To(BeTrue())
+	})
+
+	It("Reject unknown fields", func() {
+		_, err := sbctl.LoadSession(writeSession(`
+apiVersion: sbctl.replicated.com/v1
+kind: Session
+spec:
+  bundle: ./bundle
+  redaction: true
+`))
+		Expect(err).To(MatchError(ContainSubstring(`unknown field "redaction"`)))
+	})
+
+	It("Reject a sandbox outside of shell mode", func() {
+		_, err := sbctl.LoadSession(writeSession(`
+apiVersion: sbctl.replicated.com/v1
+kind: Session
+spec:
+  bundle: ./bundle
+  sandbox: true
+`))
+		Expect(err).To(MatchError(ContainSubstring("spec.sandbox requires spec.mode shell")))
+	})
+
+	It("Reject missing bundles", func() {
+		_, err := sbctl.LoadSession(writeSession(`
+apiVersion: sbctl.replicated.com/v1
+kind: Session
+spec:
+  bundle: ./missing
+`))
+		Expect(err).To(MatchError(ContainSubstring("spec.bundle")))
+	})
+})
@@ -0,0 +1,30 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	sbctlutil "github.com/replicatedhq/sbctl/pkg/util"
+)
+
+var _ = Describe("Secure cleanup", func() {
+	It("Overwrites and removes extracted files", func() {
+		dir := filepath.Join(GinkgoT().TempDir(), "bundle")
+		fileName := filepath.Join(dir, "cluster-resources", "secrets", "default.json")
+		Expect(os.MkdirAll(filepath.Dir(fileName), 0755)).To(Succeed())
+		Expect(os.WriteFile(fileName, []byte(`{"password":"hunter2"}`), 0644)).To(Succeed())
+
+		// A hard link keeps the data of the file reachable after the bundle is removed
+		linkName := filepath.Join(filepath.Dir(dir), "link.json")
+		Expect(os.Link(fileName, linkName)).To(Succeed())
+
+		Expect(sbctlutil.ShredDir(dir)).To(Succeed())
+		Expect(dir).NotTo(BeADirectory())
+
+		data, err := os.ReadFile(linkName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).NotTo(ContainSubstring("hunter2"))
+	})
+})
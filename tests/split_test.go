@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var _ = Describe("Splitting bundles", func() {
+	split := func(opts sbctl.SplitOptions) sbctl.ClusterData {
+		clusterData, err := sbctl.FindClusterData("./support-bundle")
+		Expect(err).NotTo(HaveOccurred())
+
+		dir := GinkgoT().TempDir()
+		archive := filepath.Join(dir, "split.tgz")
+		f, err := os.Create(archive)
+		Expect(err).NotTo(HaveOccurred())
+		count, err := sbctl.SplitBundle(clusterData, opts, f, "split")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(f.Close()).To(Succeed())
+		Expect(count).To(BeNumerically(">", 0))
+
+		outDir := filepath.Join(dir, "out")
+		Expect(sbctl.ExtractBundle(archive, outDir)).To(Succeed())
+		result, err := sbctl.FindClusterData(outDir)
+		Expect(err).NotTo(HaveOccurred())
+		return result
+	}
+
+	It("Keeps only the selected namespaces", func() {
+		clusterData := split(sbctl.SplitOptions{Namespaces: []string{"velero"}})
+		Expect(clusterData.ClusterResourcesDir).To(HaveSuffix(filepath.Join("split", "cluster-resources")))
+		Expect(clusterData.ClusterInfoFile).NotTo(BeEmpty())
+		Expect(clusterData.AnalysisFile).To(BeEmpty())
+
+		pods, err := sbctl.ListTypedResources[corev1.Pod](clusterData, "", "pods")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pods).NotTo(BeEmpty())
+		for _, pod := range pods {
+			Expect(pod.Namespace).To(Equal("velero"))
+		}
+
+		namespaces, err := sbctl.ListTypedResources[corev1.Namespace](clusterData, "", "namespaces")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(namespaces).To(HaveLen(1))
+		Expect(namespaces[0].Name).To(Equal("velero"))
+
+		Expect(filepath.Join(clusterData.ClusterResourcesDir, "nodes.json")).To(BeAnExistingFile())
+		Expect(filepath.Join(clusterData.ClusterResourcesDir, "pods", "logs", "velero")).To(BeADirectory())
+		Expect(filepath.Join(clusterData.ClusterResourcesDir, "custom-resources", "backupstoragelocations.velero.io", "velero.yaml")).To(BeAnExistingFile())
+		Expect(filepath.Join(clusterData.ClusterResourcesDir, "pods", "default.json")).NotTo(BeAnExistingFile())
+	})
+
+	It("Keeps only the selected resources", func() {
+		clusterData := split(sbctl.SplitOptions{
+			Resources: []schema.GroupResource{{Resource: "pods"}, {Resource: "events"}},
+			NoLogs:    true,
+		})
+
+		Expect(filepath.Join(clusterData.ClusterResourcesDir, "resources.json")).To(BeAnExistingFile())
+		Expect(filepath.Join(clusterData.ClusterResourcesDir, "pods", "velero.json")).To(BeAnExistingFile())
+		Expect(filepath.Join(clusterData.ClusterResourcesDir, "events", "velero.json")).To(BeAnExistingFile())
+		Expect(filepath.Join(clusterData.ClusterResourcesDir, "pods", "logs")).NotTo(BeADirectory())
+		Expect(filepath.Join(clusterData.ClusterResourcesDir, "nodes.json")).NotTo(BeAnExistingFile())
+		Expect(filepath.Join(clusterData.ClusterResourcesDir, "deployments")).NotTo(BeADirectory())
+	})
+})
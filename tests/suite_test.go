@@ -39,6 +39,7 @@ var _ = BeforeSuite(func() {
 
 	Expect(clusterData.ClusterResourcesDir).To(Equal("support-bundle/cluster-resources"))
 	Expect(clusterData.ClusterInfoFile).To(Equal("support-bundle/cluster-info/cluster_version.json"))
+	Expect(clusterData.AnalysisFile).To(Equal("support-bundle/analysis.json"))
 
 	kubeConfig, err := api.StartAPIServer(clusterData, os.Stderr)
 	Expect(err).NotTo(HaveOccurred())
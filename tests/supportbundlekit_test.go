@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/api"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+)
+
+var _ = Describe("Support-bundle-kit bundles", func() {
+	It("Finds the yamls dir of support-bundle-kit bundles", func() {
+		clusterData, err := sbctl.FindClusterData("./support-bundle-kit")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(clusterData.SupportBundleKitDir).To(Equal("support-bundle-kit/yamls"))
+		Expect(clusterData.ClusterResourcesDir).To(BeEmpty())
+
+		Expect(sbctl.IsSupportBundleKitDir("support-bundle-kit/yamls")).To(BeTrue())
+		Expect(sbctl.IsSupportBundleKitDir("support-bundle-kit/logs")).To(BeFalse())
+		Expect(sbctl.IsSupportBundleKitDir("support-bundle/cluster-resources")).To(BeFalse())
+	})
+
+	It("Converts support-bundle-kit bundles into the troubleshoot layout", func() {
+		outDir := GinkgoT().TempDir()
+		clusterData, err := sbctl.ConvertSupportBundleKit("support-bundle-kit/yamls", outDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(clusterData.ClusterResourcesDir).To(Equal(filepath.Join(outDir, "cluster-resources")))
+
+		for _, name := range []string{
+			"nodes.json",
+			"namespaces.json",
+			"pods/default.json",
+			"deployments/default.json",
+			"custom-resources/settings.harvesterhci.io.json",
+			"pods/logs/default/web-0/app.log",
+			"resources.json",
+			"groups.json",
+		} {
+			Expect(filepath.Join(clusterData.ClusterResourcesDir, name)).To(BeAnExistingFile())
+		}
+
+		version, err := os.ReadFile(clusterData.ClusterInfoFile)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(version)).To(ContainSubstring(`"major":"1","minor":"24"`))
+
+		found, err := sbctl.FindClusterData(outDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found.ClusterResourcesDir).To(Equal(clusterData.ClusterResourcesDir))
+		Expect(found.SupportBundleKitDir).To(BeEmpty())
+
+		settings, err := sbctl.ListResources(found, "harvesterhci.io", "settings")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(settings).To(HaveLen(1))
+		Expect(settings[0].GetName()).To(Equal("server-version"))
+	})
+
+	It("Serves converted support-bundle-kit bundles", func() {
+		clusterData, err := sbctl.ConvertSupportBundleKit("support-bundle-kit/yamls", GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+		kubeConfig, err := api.StartAPIServer(clusterData, io.Discard)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, kubeConfig)
+		endpoint, err := getAPIEndpoint(kubeConfig)
+		Expect(err).NotTo(HaveOccurred())
+
+		resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/apis/apps/v1/namespaces/default/deployments", endpoint), getHeaders)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(resp).To(ContainSubstring(`"web"`))
+
+		resp, statusCode, err = HTTPExec("GET", fmt.Sprintf("%s/api/v1/namespaces/default/pods/web-0/log?container=app", endpoint), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(resp).To(Equal("starting nginx\nready to serve\n"))
+	})
+})
@@ -3,8 +3,11 @@ package tests
 import (
 	"io"
 	"net/http"
+	"os"
 
 	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/cli"
+	"github.com/spf13/viper"
 )
 
 func HTTPExec(verb string, url string, headers map[string]string) (string, int, error) {
@@ -30,3 +33,29 @@ func HTTPExec(verb string, url string, headers map[string]string) (string, int,
 
 	return string(data), res.StatusCode, nil
 }
+
+// SbctlExec runs an sbctl command and returns what it printed to stdout. Flags are reset before
+// and after every command, since commands and API servers read them from the global viper.
+func SbctlExec(args ...string) (string, error) {
+	out, err := os.CreateTemp("", "sbctl-stdout-")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create stdout file")
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	viper.Reset()
+	defer viper.Reset()
+	stdout := os.Stdout
+	os.Stdout = out
+	cmd := cli.RootCmd()
+	cmd.SetArgs(args)
+	cmdErr := cmd.Execute()
+	os.Stdout = stdout
+
+	data, err := os.ReadFile(out.Name())
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read stdout file")
+	}
+	return string(data), cmdErr
+}
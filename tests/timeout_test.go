@@ -0,0 +1,35 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Request timeouts", func() {
+	It("Stops requests that take longer than their timeout", func() {
+		resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/api/v1/namespaces/velero/pods?timeout=1ns", apiServerEndpoint), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusGatewayTimeout))
+
+		status := metav1.Status{}
+		Expect(json.Unmarshal([]byte(resp), &status)).To(Succeed())
+		Expect(status.Reason).To(Equal(metav1.StatusReasonTimeout))
+	})
+
+	It("Serves requests within their timeout", func() {
+		_, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/api/v1/namespaces/velero/pods?timeout=30s", apiServerEndpoint), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+	})
+
+	It("Rejects invalid timeouts", func() {
+		_, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/api/v1/namespaces/velero/pods?timeout=soon", apiServerEndpoint), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusBadRequest))
+	})
+})
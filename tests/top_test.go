@@ -0,0 +1,45 @@
+package tests
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+)
+
+var _ = Describe("Resource usage", func() {
+	find := func(usage []sbctl.ResourceUsage, node string, namespace string, pod string) *sbctl.ResourceUsage {
+		for i := range usage {
+			if usage[i].Node == node && usage[i].Namespace == namespace && usage[i].Pod == pod {
+				return &usage[i]
+			}
+		}
+		return nil
+	}
+
+	It("Reads usage from kubelet summary and cAdvisor dumps", func() {
+		clusterData, err := sbctl.FindClusterData("./support-bundle")
+		Expect(err).NotTo(HaveOccurred())
+		usage, err := sbctl.FindResourceUsage(clusterData)
+		Expect(err).NotTo(HaveOccurred())
+
+		node := find(usage, "troubleshoot-demo-001", "", "")
+		Expect(node).NotTo(BeNil())
+		Expect(node.Source).To(Equal(sbctl.UsageSourceSummary))
+		Expect(node.CPU.MilliValue()).To(Equal(int64(850)))
+		Expect(node.Memory.Value()).To(Equal(int64(3221225472)))
+
+		pod := find(usage, "troubleshoot-demo-001", "velero", "restic-cccz9")
+		Expect(pod).NotTo(BeNil())
+		Expect(pod.CPU.MilliValue()).To(Equal(int64(12)))
+		Expect(pod.File).To(Equal("node-metrics/troubleshoot-demo-001.json"))
+
+		pod = find(usage, "troubleshoot-demo-002", "velero", "velero-6996dd565b-xl44t")
+		Expect(pod).NotTo(BeNil())
+		Expect(pod.Source).To(Equal(sbctl.UsageSourceCadvisor))
+		Expect(pod.CPU).To(BeNil())
+		Expect(pod.Memory.Value()).To(Equal(int64(83886080)))
+
+		Expect(find(usage, "troubleshoot-demo-002", "", "")).NotTo(BeNil())
+		Expect(find(usage, "troubleshoot-demo-003", "", "")).To(BeNil())
+	})
+})
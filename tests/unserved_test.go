@@ -0,0 +1,50 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/api"
+)
+
+var _ = Describe("Unserved requests", func() {
+	It("Counts requests answered with not found by resource", func() {
+		for _, name := range []string{"a", "b"} {
+			_, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/apis/metrics.k8s.io/v1beta1/namespaces/velero/pods/%s", apiServerEndpoint, name), nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(statusCode).To(Equal(http.StatusNotFound))
+		}
+
+		Expect(api.GetUnservedRequests()).To(ContainElement(api.UnservedRequest{
+			Method: "GET",
+			Path:   "/apis/metrics.k8s.io/v1beta1/namespaces/{namespace}/pods/{name}",
+			Status: http.StatusNotFound,
+			Count:  2,
+		}))
+	})
+
+	It("Counts requests of other paths by their first segments", func() {
+		_, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/unknown/v1/velero/pods", apiServerEndpoint), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusNotFound))
+
+		Expect(api.GetUnservedRequests()).To(ContainElement(api.UnservedRequest{
+			Method: "GET",
+			Path:   "/unknown/v1",
+			Status: http.StatusNotFound,
+			Count:  1,
+		}))
+	})
+
+	It("Does not count requests that were served", func() {
+		_, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/api/v1/namespaces/velero/pods", apiServerEndpoint), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+
+		for _, r := range api.GetUnservedRequests() {
+			Expect(r.Path).NotTo(Equal("/api/v1/namespaces/{namespace}/pods"))
+		}
+	})
+})
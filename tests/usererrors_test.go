@@ -0,0 +1,40 @@
+package tests
+
+import (
+	"encoding/json"
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+	"github.com/replicatedhq/sbctl/pkg/usererrors"
+)
+
+var _ = Describe("Error catalog", func() {
+	It("Classifies errors through wrapping", func() {
+		err := errors.Wrap(usererrors.New(usererrors.BundleNotFound, os.ErrNotExist, "bundle.tar.gz"), "failed to load bundle")
+		Expect(usererrors.CodeOf(err)).To(Equal(usererrors.BundleNotFound))
+		Expect(errors.Is(err, os.ErrNotExist)).To(BeTrue())
+		Expect(usererrors.CodeOf(errors.New("boom"))).To(Equal(usererrors.Unclassified))
+
+		_, err = sbctl.DefaultRESTMapper().ResourceFor("httpproxies")
+		Expect(usererrors.CodeOf(err)).To(Equal(usererrors.UnknownResource))
+	})
+
+	It("Renders errors as JSON with stable codes", func() {
+		data, err := usererrors.JSON(usererrors.New(usererrors.BundleNotFound, os.ErrNotExist, "bundle.tar.gz"))
+		Expect(err).NotTo(HaveOccurred())
+
+		result := map[string]string{}
+		Expect(json.Unmarshal(data, &result)).To(Succeed())
+		Expect(result).To(HaveKeyWithValue("code", "BUNDLE_NOT_FOUND"))
+		Expect(result).To(HaveKeyWithValue("message", "support bundle bundle.tar.gz not found"))
+		Expect(result).To(HaveKeyWithValue("details", "support bundle bundle.tar.gz not found: file does not exist"))
+		Expect(result["hint"]).NotTo(BeEmpty())
+
+		data, err = usererrors.JSON(errors.New("boom"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal(`{"code":"UNCLASSIFIED","message":"boom"}`))
+	})
+})
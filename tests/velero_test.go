@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Velero command", func() {
+	writeBundle := func(dir string, files map[string]string) {
+		for name, content := range files {
+			fileName := filepath.Join(dir, "cluster-resources", name)
+			Expect(os.MkdirAll(filepath.Dir(fileName), 0755)).To(Succeed())
+			Expect(os.WriteFile(fileName, []byte(content), 0644)).To(Succeed())
+		}
+	}
+
+	var dir string
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		writeBundle(dir, map[string]string{
+			"custom-resources/backups.velero.io/velero.yaml": `- apiVersion: velero.io/v1
+  kind: Backup
+  metadata:
+    name: nightly-1
+    namespace: velero
+    creationTimestamp: "2022-04-11T01:00:00Z"
+  spec:
+    storageLocation: default
+    ttl: 720h0m0s
+    includedNamespaces: ["app"]
+  status:
+    phase: Completed
+    warnings: 2
+    progress:
+      itemsBackedUp: 40
+      totalItems: 40
+- apiVersion: velero.io/v1
+  kind: Backup
+  metadata:
+    name: nightly-2
+    namespace: velero
+    creationTimestamp: "2022-04-12T01:00:00Z"
+  spec:
+    storageLocation: default
+  status:
+    phase: PartiallyFailed
+    errors: 3
+    failureReason: volume snapshot failed
+    progress:
+      itemsBackedUp: 37
+      totalItems: 40
+`,
+			"custom-resources/restores.velero.io/velero.yaml": `- apiVersion: velero.io/v1
+  kind: Restore
+  metadata:
+    name: nightly-1-restore
+    namespace: velero
+    creationTimestamp: "2022-04-12T02:00:00Z"
+  spec:
+    backupName: nightly-1
+  status:
+    phase: Completed
+`,
+			"pods/logs/velero/velero-abc/velero.log": `level=info msg="Backup starting" backup=velero/nightly-2
+level=error msg="Error backing up item" backup=velero/nightly-2 error="snapshot timed out"
+level=info msg="Backup completed" backup=velero/nightly-2
+level=error msg="Error uploading log file" backup=velero/nightly-2
+`,
+		})
+	})
+
+	It("Lists backups, restores and the errors in the Velero logs", func() {
+		out, err := SbctlExec("velero", "-s", dir, "--no-index")
+		Expect(err).NotTo(HaveOccurred())
+
+		sections := strings.Split(strings.TrimSpace(out), "\n\n")
+		Expect(sections).To(HaveLen(3))
+
+		backups := strings.Split(sections[0], "\n")
+		Expect(backups).To(HaveLen(3))
+		Expect(strings.Fields(backups[0])).To(Equal([]string{"BACKUP", "NAMESPACE", "PHASE", "ERRORS", "WARNINGS", "STARTED", "COMPLETED", "EXPIRES", "STORAGE", "LOCATION"}))
+		Expect(strings.Fields(backups[1])[:5]).To(Equal([]string{"nightly-1", "velero", "Completed", "0", "2"}))
+		Expect(strings.Fields(backups[2])[:5]).To(Equal([]string{"nightly-2", "velero", "PartiallyFailed", "3", "0"}))
+
+		restores := strings.Split(sections[1], "\n")
+		Expect(restores).To(HaveLen(2))
+		Expect(strings.Fields(restores[0])[0]).To(Equal("RESTORE"))
+		Expect(strings.Fields(restores[1])[:4]).To(Equal([]string{"nightly-1-restore", "velero", "nightly-1", "Completed"}))
+
+		Expect(sections[2]).To(Equal(`Errors in velero/velero-abc/velero.log:
+  level=error msg="Error backing up item" backup=velero/nightly-2 error="snapshot timed out"
+  level=error msg="Error uploading log file" backup=velero/nightly-2`))
+	})
+
+	It("Limits the number of log error lines", func() {
+		out, err := SbctlExec("velero", "-s", dir, "--no-index", "--log-errors", "1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(HaveSuffix("Errors in velero/velero-abc/velero.log:\n  level=error msg=\"Error uploading log file\" backup=velero/nightly-2\n"))
+
+		out, err = SbctlExec("velero", "-s", dir, "--no-index", "--log-errors", "0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).NotTo(ContainSubstring("level=error"))
+	})
+
+	It("Shows the details of a backup and its restores", func() {
+		out, err := SbctlExec("velero", "nightly-2", "-s", dir, "--no-index")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(ContainSubstring("Name:                nightly-2\n"))
+		Expect(out).To(ContainSubstring("Phase:               PartiallyFailed\n"))
+		Expect(out).To(ContainSubstring("Failure Reason:      volume snapshot failed\n"))
+		Expect(out).To(ContainSubstring("Included Namespaces: *\n"))
+		Expect(out).To(ContainSubstring("Items Backed Up:     37/40\n"))
+		Expect(out).To(HaveSuffix("No restores from this backup found in support bundle\n"))
+
+		out, err = SbctlExec("velero", "nightly-1", "-s", dir, "--no-index")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(ContainSubstring("Included Namespaces: app\n"))
+		Expect(out).To(ContainSubstring("nightly-1-restore"))
+
+		_, err = SbctlExec("velero", "weekly-1", "-s", dir, "--no-index")
+		Expect(err).To(MatchError(`backup "weekly-1" not found in support bundle`))
+	})
+
+	It("Reports bundles without Velero backups", func() {
+		out, err := SbctlExec("velero", "-s", "./support-bundle", "--no-index")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(Equal("No Velero backups or restores found in support bundle\n"))
+	})
+})
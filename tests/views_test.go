@@ -0,0 +1,127 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/api"
+)
+
+var _ = Describe("Loading views", func() {
+	writeViews := func(content string) string {
+		fileName := filepath.Join(GinkgoT().TempDir(), "views.yaml")
+		Expect(os.WriteFile(fileName, []byte(content), 0600)).To(Succeed())
+		return fileName
+	}
+
+	It("Generates tokens for views without one", func() {
+		views, err := api.LoadViews(writeViews(`
+views:
+- name: app-team
+  namespaces: [default]
+  resources: [pods, deployments.apps]
+- name: ops
+  token: fixed-token
+  namespaces: [kube-system]
+`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(views).To(HaveLen(2))
+		Expect(views[0].Token).To(HaveLen(48))
+		Expect(views[0].Resources).To(Equal([]string{"pods", "deployments.apps"}))
+		Expect(views[1].Token).To(Equal("fixed-token"))
+	})
+
+	It("Rejects views without namespaces", func() {
+		_, err := api.LoadViews(writeViews(`
+views:
+- name: app-team
+`))
+		Expect(err).To(MatchError(ContainSubstring("has no namespaces")))
+	})
+})
+
+var _ = Describe("Serving views", Serial, func() {
+	const token = "velero-team-token"
+
+	BeforeEach(func() {
+		Expect(api.SetViews([]api.View{
+			{Name: "velero-team", Token: token, Namespaces: []string{"velero"}, Resources: []string{"pods", "namespaces"}},
+		})).To(Succeed())
+		DeferCleanup(func() {
+			Expect(api.SetViews(nil)).To(Succeed())
+		})
+	})
+
+	get := func(path string, bearer string) (string, int) {
+		headers := map[string]string{"Accept": "application/json"}
+		if bearer != "" {
+			headers["Authorization"] = "Bearer " + bearer
+		}
+		resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s%s", apiServerEndpoint, path), headers)
+		Expect(err).NotTo(HaveOccurred())
+		return resp, statusCode
+	}
+
+	It("Requires a known token", func() {
+		_, statusCode := get("/api/v1/namespaces/velero/pods", "")
+		Expect(statusCode).To(Equal(http.StatusUnauthorized))
+
+		_, statusCode = get("/api/v1/namespaces/velero/pods", "unknown-token")
+		Expect(statusCode).To(Equal(http.StatusUnauthorized))
+
+		_, statusCode = get("/api/v1/namespaces/velero/pods", token)
+		Expect(statusCode).To(Equal(http.StatusOK))
+	})
+
+	It("Forbids namespaces and resources outside of the view", func() {
+		_, statusCode := get("/api/v1/namespaces/default/pods", token)
+		Expect(statusCode).To(Equal(http.StatusForbidden))
+
+		_, statusCode = get("/api/v1/namespaces/kube-system", token)
+		Expect(statusCode).To(Equal(http.StatusForbidden))
+
+		_, statusCode = get("/apis/apps/v1/namespaces/velero/deployments", token)
+		Expect(statusCode).To(Equal(http.StatusForbidden))
+	})
+
+	It("Filters lists across namespaces to the namespaces of the view", func() {
+		list := struct {
+			Items []struct {
+				Metadata struct {
+					Namespace string `json:"namespace"`
+					Name      string `json:"name"`
+				} `json:"metadata"`
+			} `json:"items"`
+		}{}
+
+		resp, statusCode := get("/api/v1/pods", token)
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(json.Unmarshal([]byte(resp), &list)).To(Succeed())
+		Expect(list.Items).NotTo(BeEmpty())
+		for _, item := range list.Items {
+			Expect(item.Metadata.Namespace).To(Equal("velero"))
+		}
+
+		resp, statusCode = get("/api/v1/namespaces", token)
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(json.Unmarshal([]byte(resp), &list)).To(Succeed())
+		Expect(list.Items).To(HaveLen(1))
+		Expect(list.Items[0].Metadata.Name).To(Equal("velero"))
+	})
+
+	It("Refuses logs of other namespaces reached through the container name", func() {
+		Expect(api.SetViews([]api.View{
+			{Name: "default-team", Token: "default-team-token", Namespaces: []string{"default"}, Resources: []string{"pods"}},
+		})).To(Succeed())
+
+		container := url.QueryEscape("../../velero/velero-6996dd565b-xl44t/velero")
+		_, statusCode := get("/api/v1/namespaces/default/pods/web/log?container="+container, "default-team-token")
+		Expect(statusCode).To(Equal(http.StatusBadRequest))
+	})
+})
@@ -0,0 +1,56 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GET /api/v1/namespaces/{namespace}/pods?watch=true", func() {
+	Context("When watching pods", func() {
+		It("Returns every pod as an ADDED event and ends the watch", func() {
+			v := url.Values{}
+			v.Set("watch", "true")
+			v.Set("labelSelector", "name=restic")
+
+			resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/api/v1/namespaces/velero/pods?%s", apiServerEndpoint, v.Encode()), getHeaders)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(statusCode).To(Equal(http.StatusOK))
+			Expect(resp).To(HavePrefix(`{"type":"ADDED","object":{`))
+			Expect(resp).To(ContainSubstring(`"kind":"Pod"`))
+			Expect(resp).NotTo(ContainSubstring(`"kind":"PodList"`))
+		})
+
+		It("Ends the initial events with a bookmark", func() {
+			v := url.Values{}
+			v.Set("watch", "true")
+			v.Set("sendInitialEvents", "true")
+			v.Set("allowWatchBookmarks", "true")
+			v.Set("labelSelector", "name=restic")
+
+			resp, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/api/v1/namespaces/velero/pods?%s", apiServerEndpoint, v.Encode()), getHeaders)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(statusCode).To(Equal(http.StatusOK))
+			lines := strings.Split(strings.TrimSpace(resp), "\n")
+			Expect(lines[len(lines)-1]).To(HavePrefix(`{"type":"BOOKMARK","object":{`))
+			Expect(lines[len(lines)-1]).To(ContainSubstring(`"k8s.io/initial-events-end":"true"`))
+		})
+
+		It("Keeps the watch open until timeoutSeconds", func() {
+			v := url.Values{}
+			v.Set("watch", "true")
+			v.Set("timeoutSeconds", "1")
+
+			start := time.Now()
+			_, statusCode, err := HTTPExec("GET", fmt.Sprintf("%s/api/v1/namespaces/velero/pods?%s", apiServerEndpoint, v.Encode()), getHeaders)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(statusCode).To(Equal(http.StatusOK))
+			Expect(time.Since(start)).To(BeNumerically(">=", time.Second))
+		})
+	})
+})
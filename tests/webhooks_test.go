@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/replicatedhq/sbctl/pkg/sbctl"
+)
+
+var _ = Describe("Webhook trace", func() {
+	var tracer *sbctl.WebhookTracer
+
+	BeforeEach(func() {
+		dir := GinkgoT().TempDir()
+		files := map[string]string{
+			"cluster-resources/mutatingwebhookconfigurations.json": `{"kind":"MutatingWebhookConfigurationList","apiVersion":"admissionregistration.k8s.io/v1","items":[{
+				"metadata": {"name": "istio-sidecar-injector"},
+				"webhooks": [{"name": "sidecar-injector.istio.io",
+					"clientConfig": {"service": {"namespace": "istio-system", "name": "istiod", "path": "/inject"}},
+					"rules": [{"operations": ["CREATE"], "apiGroups": [""], "apiVersions": ["v1"], "resources": ["pods"]}],
+					"namespaceSelector": {"matchLabels": {"istio-injection": "enabled"}},
+					"failurePolicy": "Fail", "sideEffects": "None", "admissionReviewVersions": ["v1"]}]}]}`,
+			"cluster-resources/validatingwebhookconfigurations.json": `{"kind":"ValidatingWebhookConfigurationList","apiVersion":"admissionregistration.k8s.io/v1","items":[{
+				"metadata": {"name": "policy"},
+				"webhooks": [{"name": "validate.policy.example.com",
+					"clientConfig": {"url": "https://policy.example.com/validate"},
+					"rules": [{"operations": ["*"], "apiGroups": ["*"], "apiVersions": ["*"], "resources": ["*"], "scope": "Namespaced"}],
+					"objectSelector": {"matchExpressions": [{"key": "policy.example.com/skip", "operator": "DoesNotExist"}]},
+					"failurePolicy": "Ignore", "timeoutSeconds": 5, "sideEffects": "None", "admissionReviewVersions": ["v1"]}]}]}`,
+			"cluster-resources/namespaces.json": `{"kind":"NamespaceList","apiVersion":"v1","items":[{
+				"metadata": {"name": "shop", "labels": {"istio-injection": "enabled"}}}]}`,
+			"cluster-resources/services/istio-system.json": `{"kind":"ServiceList","apiVersion":"v1","items":[{
+				"metadata": {"name": "istiod", "namespace": "istio-system"},
+				"spec": {"selector": {"app": "istiod"}}}]}`,
+		}
+		for name, content := range files {
+			fileName := filepath.Join(dir, name)
+			Expect(os.MkdirAll(filepath.Dir(fileName), 0755)).To(Succeed())
+			Expect(os.WriteFile(fileName, []byte(content), 0644)).To(Succeed())
+		}
+
+		var err error
+		tracer, err = sbctl.LoadWebhookTracer(sbctl.ClusterData{BundleDir: dir, ClusterResourcesDir: filepath.Join(dir, "cluster-resources")})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	trace := func(manifest string, operation string) []sbctl.WebhookTrace {
+		objects, err := sbctl.ReadManifestObjects(strings.NewReader(manifest))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(objects).To(HaveLen(1))
+		traces, err := tracer.Trace(objects[0], operation)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(traces).To(HaveLen(2))
+		return traces
+	}
+
+	It("Matches webhooks by rules and namespace labels", func() {
+		traces := trace("apiVersion: v1\nkind: Pod\nmetadata:\n  name: web\n  namespace: shop\n", "CREATE")
+
+		Expect(traces[0].Type).To(Equal(sbctl.WebhookMutating))
+		Expect(traces[0].Called).To(BeTrue())
+		Expect(traces[0].FailurePolicy).To(Equal("Fail"))
+		Expect(traces[0].TimeoutSeconds).To(BeEquivalentTo(10))
+		Expect(traces[0].Backend).To(Equal("istio-system/istiod:443/inject"))
+		Expect(traces[0].BackendIssue).To(Equal("no ready endpoints"))
+
+		Expect(traces[1].Type).To(Equal(sbctl.WebhookValidating))
+		Expect(traces[1].Called).To(BeTrue())
+		Expect(traces[1].Backend).To(Equal("https://policy.example.com/validate"))
+	})
+
+	It("Reports why webhooks are not called", func() {
+		traces := trace("apiVersion: v1\nkind: Pod\nmetadata:\n  name: web\n  namespace: default\n  labels:\n    policy.example.com/skip: \"true\"\n", "CREATE")
+		Expect(traces[0].Called).To(BeFalse())
+		Expect(traces[0].Reason).To(Equal("namespaceSelector does not match the namespace"))
+		Expect(traces[1].Called).To(BeFalse())
+		Expect(traces[1].Reason).To(Equal("objectSelector does not match the object"))
+
+		traces = trace("apiVersion: v1\nkind: Namespace\nmetadata:\n  name: shop\n", "DELETE")
+		Expect(traces[0].Reason).To(Equal("no rule matches DELETE namespaces"))
+		Expect(traces[1].Called).To(BeFalse())
+	})
+})